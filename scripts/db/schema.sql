@@ -17,6 +17,8 @@ CREATE TABLE price_data (
     quote_volume DECIMAL(20,8) NOT NULL,
     change_rate DECIMAL(10,6),
     change_price DECIMAL(20,8),
+    best_bid DECIMAL(20,8),
+    best_ask DECIMAL(20,8),
     created_at TIMESTAMP DEFAULT NOW(),
     CONSTRAINT unique_symbol_timestamp UNIQUE(symbol, timestamp)
 );
@@ -26,6 +28,19 @@ CREATE INDEX idx_price_data_symbol_timestamp ON price_data(symbol, timestamp DES
 CREATE INDEX idx_price_data_timestamp ON price_data(timestamp DESC);
 CREATE INDEX idx_price_data_symbol ON price_data(symbol);
 
+-- Hourly candles downsampled from price_data, each covering the hour starting
+-- at timestamp
+CREATE TABLE price_data_hourly (
+    symbol VARCHAR(20) NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    open DECIMAL(20,8) NOT NULL,
+    high DECIMAL(20,8) NOT NULL,
+    low DECIMAL(20,8) NOT NULL,
+    close DECIMAL(20,8) NOT NULL,
+    volume DECIMAL(20,8) NOT NULL,
+    PRIMARY KEY (symbol, timestamp)
+);
+
 -- Available trading pairs with metrics
 CREATE TABLE trading_pairs (
     id BIGSERIAL PRIMARY KEY,
@@ -60,12 +75,14 @@ CREATE TABLE selected_pairs (
     correlation_score DECIMAL(10,6),
     risk_level VARCHAR(10) DEFAULT 'medium',
     status VARCHAR(20) DEFAULT 'active',
+    trading_enabled BOOLEAN NOT NULL DEFAULT true,
     selected_at TIMESTAMP DEFAULT NOW(),
     last_evaluated TIMESTAMP DEFAULT NOW(),
     CONSTRAINT fk_selected_pairs_symbol FOREIGN KEY (symbol) REFERENCES trading_pairs(symbol)
 );
 
 -- Index for selected_pairs
+CREATE UNIQUE INDEX idx_selected_pairs_symbol_unique ON selected_pairs(symbol);
 CREATE INDEX idx_selected_pairs_score ON selected_pairs(selection_score DESC);
 CREATE INDEX idx_selected_pairs_status ON selected_pairs(status);
 
@@ -82,14 +99,22 @@ CREATE TABLE trading_configs (
     take_profit_percent DECIMAL(5,4) DEFAULT 0.03,
     max_positions INTEGER DEFAULT 5,
     is_active BOOLEAN DEFAULT true,
+    sizing_mode VARCHAR(20) NOT NULL DEFAULT 'quote', -- 'quote', 'base', 'balance_percent'
+    position_size_base DECIMAL(20,8) NOT NULL DEFAULT 0,
+    position_size_percent DECIMAL(10,6) NOT NULL DEFAULT 0,
+    confirm_exits BOOLEAN NOT NULL DEFAULT false, -- Hold signal exits until the confirmation timeframe agrees
+    trailing_stop_percent DECIMAL(10,6) NOT NULL DEFAULT 0, -- 0 uses the engine's TRAILING_STOP_PERCENT
     created_at TIMESTAMP DEFAULT NOW(),
     updated_at TIMESTAMP DEFAULT NOW(),
     CONSTRAINT fk_trading_configs_pair FOREIGN KEY (pair_id) REFERENCES selected_pairs(id)
 );
 
+CREATE UNIQUE INDEX idx_trading_configs_active_pair ON trading_configs(pair_id) WHERE is_active = true;
+
 -- Trading positions and orders
 CREATE TABLE positions (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    account_id VARCHAR(50) NOT NULL DEFAULT 'default', -- trading account holding the position
     pair_id BIGINT NOT NULL,
     config_id UUID NOT NULL,
     side VARCHAR(10) NOT NULL, -- 'buy' or 'sell'
@@ -98,8 +123,17 @@ CREATE TABLE positions (
     current_price DECIMAL(20,8),
     unrealized_pnl DECIMAL(20,8) DEFAULT 0,
     realized_pnl DECIMAL(20,8) DEFAULT 0,
+    total_fees DECIMAL(20,8) NOT NULL DEFAULT 0, -- entry and exit fees deducted from realized_pnl
     status VARCHAR(20) DEFAULT 'open', -- 'open', 'closed', 'partial'
     order_id VARCHAR(50), -- KuCoin order ID
+    strategy_tag VARCHAR(50) NOT NULL DEFAULT '',
+    config_version VARCHAR(50) NOT NULL DEFAULT '',
+    high_water_mark DECIMAL(20,8), -- best price since entry, lowest for short positions
+    trailing_stop_price DECIMAL(20,8), -- armed trailing stop, only ever moved in the position's favour
+    take_profit_levels_hit INTEGER NOT NULL DEFAULT 0,
+    closed_fraction DECIMAL(10,6) NOT NULL DEFAULT 0,
+    max_favorable_excursion DECIMAL(10,6) NOT NULL DEFAULT 0, -- best return since entry, fraction of entry price
+    max_adverse_excursion DECIMAL(10,6) NOT NULL DEFAULT 0, -- worst return since entry, as a positive fraction
     created_at TIMESTAMP DEFAULT NOW(),
     updated_at TIMESTAMP DEFAULT NOW(),
     closed_at TIMESTAMP,
@@ -110,13 +144,17 @@ CREATE TABLE positions (
 -- Index for positions
 CREATE INDEX idx_positions_pair_status ON positions(pair_id, status);
 CREATE INDEX idx_positions_created_at ON positions(created_at DESC);
+CREATE INDEX idx_positions_strategy ON positions(strategy_tag, config_version);
+CREATE INDEX idx_positions_account_status ON positions(account_id, status);
 
 -- Orders history
 CREATE TABLE orders (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    account_id VARCHAR(50) NOT NULL DEFAULT 'default',
     position_id UUID,
     pair_id BIGINT NOT NULL,
     kucoin_order_id VARCHAR(50) UNIQUE,
+    client_oid VARCHAR(50),
     side VARCHAR(10) NOT NULL,
     type VARCHAR(20) NOT NULL, -- 'market', 'limit'
     quantity DECIMAL(20,8) NOT NULL,
@@ -124,17 +162,63 @@ CREATE TABLE orders (
     filled_quantity DECIMAL(20,8) DEFAULT 0,
     status VARCHAR(20) DEFAULT 'pending',
     fee DECIMAL(20,8) DEFAULT 0,
+    strategy_tag VARCHAR(50) NOT NULL DEFAULT '',
+    config_version VARCHAR(50) NOT NULL DEFAULT '',
     created_at TIMESTAMP DEFAULT NOW(),
     updated_at TIMESTAMP DEFAULT NOW(),
     filled_at TIMESTAMP,
+    grid_unsettled BOOLEAN NOT NULL DEFAULT false, -- Grid fill not yet applied to a position
+    grid_position_id UUID, -- Position a grid exit sells
     CONSTRAINT fk_orders_position FOREIGN KEY (position_id) REFERENCES positions(id),
     CONSTRAINT fk_orders_pair FOREIGN KEY (pair_id) REFERENCES selected_pairs(id)
 );
 
 -- Index for orders
 CREATE INDEX idx_orders_kucoin_id ON orders(kucoin_order_id);
+CREATE INDEX idx_orders_stranded ON orders(created_at) WHERE status = 'pending' AND kucoin_order_id IS NULL;
 CREATE INDEX idx_orders_status ON orders(status);
 CREATE INDEX idx_orders_created_at ON orders(created_at DESC);
+CREATE INDEX idx_orders_account_status ON orders(account_id, status);
+
+-- Exchange-side OCO stop loss / take profit brackets protecting open positions
+CREATE TABLE bracket_orders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    position_id UUID NOT NULL,
+    pair_id BIGINT NOT NULL,
+    symbol VARCHAR(20) NOT NULL,
+    entry_order_id VARCHAR(50) NOT NULL,
+    oco_order_id VARCHAR(50),
+    side VARCHAR(10) NOT NULL, -- side of the exit legs
+    quantity DECIMAL(20,8) NOT NULL,
+    stop_price DECIMAL(20,8) NOT NULL,
+    stop_limit_price DECIMAL(20,8) NOT NULL,
+    take_profit_price DECIMAL(20,8) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- 'pending', 'active', 'stop_loss', 'take_profit', 'cancelled'
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    closed_at TIMESTAMP,
+    CONSTRAINT fk_bracket_orders_position FOREIGN KEY (position_id) REFERENCES positions(id)
+);
+
+CREATE INDEX idx_bracket_orders_status ON bracket_orders(status);
+CREATE INDEX idx_bracket_orders_position ON bracket_orders(position_id);
+
+-- Order placements the exchange rejected or that failed in transit
+CREATE TABLE failed_orders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    symbol VARCHAR(20) NOT NULL,
+    client_oid VARCHAR(64) NOT NULL,
+    side VARCHAR(10) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    quantity DECIMAL(20,8) NOT NULL,
+    price DECIMAL(20,8),
+    error_code VARCHAR(20) NOT NULL,
+    error_message TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_failed_orders_created_at ON failed_orders(created_at DESC);
+CREATE INDEX idx_failed_orders_symbol ON failed_orders(symbol, created_at DESC);
 
 -- System configuration
 CREATE TABLE system_config (
@@ -185,3 +269,89 @@ SELECT DISTINCT ON (symbol)
     change_rate
 FROM price_data 
 ORDER BY symbol, timestamp DESC;
+
+-- Grids rebuilt around a new price after a breakout
+CREATE TABLE grid_recenter_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    pair_id BIGINT NOT NULL,
+    config_id UUID NOT NULL,
+    price DECIMAL(20,8) NOT NULL,
+    old_range_min DECIMAL(20,8) NOT NULL,
+    old_range_max DECIMAL(20,8) NOT NULL,
+    new_range_min DECIMAL(20,8) NOT NULL,
+    new_range_max DECIMAL(20,8) NOT NULL,
+    cancelled_orders INTEGER NOT NULL DEFAULT 0,
+    buy_levels INTEGER NOT NULL DEFAULT 0,
+    funded_buy_levels INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT fk_grid_recenter_events_pair FOREIGN KEY (pair_id) REFERENCES selected_pairs(id)
+);
+
+CREATE INDEX idx_grid_recenter_events_pair ON grid_recenter_events(pair_id, created_at DESC);
+
+-- Last processed sequence per websocket topic
+CREATE TABLE ws_watermarks (
+    topic VARCHAR(200) PRIMARY KEY,
+    sequence BIGINT NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Backtest expectations compared against live results
+CREATE TABLE backtest_baselines (
+    strategy_tag VARCHAR(50) NOT NULL,
+    config_version VARCHAR(50) NOT NULL,
+    win_rate DECIMAL(10,6) NOT NULL,
+    avg_pnl_per_trade DECIMAL(20,8) NOT NULL,
+    trades INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (strategy_tag, config_version)
+);
+
+-- Circuit breaker halts, kept so a restart during a halt does not resume
+-- trading early. Portfolio halts use pair_id 0.
+CREATE TABLE risk_halts (
+    account_id VARCHAR(50) NOT NULL DEFAULT 'default',
+    scope VARCHAR(20) NOT NULL,
+    pair_id BIGINT NOT NULL DEFAULT 0,
+    reason VARCHAR(50) NOT NULL,
+    halted_until TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (account_id, scope, pair_id)
+);
+
+-- Inputs behind each entry (signal, indicators, open positions, risk state,
+-- size), captured when the order is placed for post-mortems of single trades
+CREATE TABLE trade_decisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    position_id UUID NOT NULL,
+    kucoin_order_id VARCHAR(50),
+    symbol VARCHAR(20) NOT NULL,
+    context JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT fk_trade_decisions_position FOREIGN KEY (position_id) REFERENCES positions(id)
+);
+
+CREATE INDEX idx_trade_decisions_position ON trade_decisions(position_id);
+CREATE INDEX idx_trade_decisions_order ON trade_decisions(kucoin_order_id);
+
+-- Orders the engine would have placed while running in observe mode
+CREATE TABLE would_trade (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    account_id VARCHAR(50) NOT NULL DEFAULT 'default',
+    pair_id BIGINT NOT NULL,
+    symbol VARCHAR(20) NOT NULL,
+    position_id UUID,
+    action VARCHAR(20) NOT NULL,
+    side VARCHAR(10) NOT NULL,
+    order_type VARCHAR(20) NOT NULL,
+    quantity DECIMAL(20,8) NOT NULL,
+    price DECIMAL(20,8) NOT NULL,
+    reason VARCHAR(100),
+    strategy_tag VARCHAR(50),
+    context JSONB,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_would_trade_symbol_created ON would_trade(symbol, created_at DESC);
@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
+	"math"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/database"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/quotes"
 	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
 
+	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/internal/api"
 	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/internal/config"
 	pairDB "github.com/paaavkata/crypto-trading-bot-v4/pair-selector/internal/database"
 	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/internal/scheduler"
@@ -30,6 +34,13 @@ func main() {
 		"max_active_pairs":    cfg.SelectionCriteria.MaxActivesPairs,
 	}).Info("Configuration loaded")
 
+	if err := cfg.SelectionCriteria.Validate(); err != nil {
+		logger.WithError(err).Fatal("Invalid selection criteria")
+	}
+	if sum := cfg.SelectionCriteria.WeightSum(); math.Abs(sum-1) > 1e-6 {
+		logger.WithField("weight_sum", sum).Warn("Score weights do not sum to 1, normalizing them")
+	}
+
 	// Initialize database connection
 	db, err := database.NewConnection(cfg.Database.DbUri, logger)
 	if err != nil {
@@ -38,10 +49,18 @@ func main() {
 	defer db.Close()
 
 	// Initialize repositories and services
-	repo := pairDB.NewRepository(db, logger)
-	analyzer := selector.NewAnalyzer(repo, logger)
+	repo := pairDB.NewRepository(db, cfg.MaxHistoryCandles, logger)
+	var quoteRates *quotes.Converter
+	if cfg.QuoteConversion {
+		quoteRates = quotes.NewConverter(repo, cfg.QuoteRateTTL, cfg.QuoteRateMaxAge, logger)
+	}
+	analyzer := selector.NewAnalyzer(repo, cfg.AnalysisWorkers, cfg.CorrelationMatrixTTL, cfg.VolatilityModel, cfg.RecencyHalfLife, quoteRates, logger)
 	pairScheduler := scheduler.NewScheduler(analyzer, repo, cfg.SelectionCriteria, cfg.EvaluationInterval, logger)
 
+	// Initialize API server (health checks and runtime criteria updates)
+	apiServer := api.NewServer(db, pairScheduler, logger)
+	httpServer := apiServer.Start(cfg.MetricsPort)
+
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -63,6 +82,14 @@ func main() {
 	// Stop scheduler
 	pairScheduler.Stop()
 
+	// Shutdown API server
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logger.WithError(err).Error("Failed to shutdown API server gracefully")
+	}
+
 	// Cancel context
 	cancel()
 
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/internal/scheduler"
+	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/pkg/models"
+	sharedDB "github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/database"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+type Server struct {
+	db        *sharedDB.DB
+	scheduler *scheduler.Scheduler
+	logger    *logrus.Logger
+}
+
+type HealthStatus struct {
+	Status    string            `json:"status"`
+	Timestamp time.Time         `json:"timestamp"`
+	Services  map[string]string `json:"services"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// CriteriaRequest updates selection criteria; fields left out keep their
+// current value
+type CriteriaRequest struct {
+	MinVolumeUSDT               *float64 `json:"min_volume_usdt"`
+	MaxVolatility               *float64 `json:"max_volatility"`
+	MinVolatility               *float64 `json:"min_volatility"`
+	MaxActivePairs              *int     `json:"max_active_pairs"`
+	WatchlistSize               *int     `json:"watchlist_size"`
+	VolumeWeight                *float64 `json:"volume_weight"`
+	VolatilityWeight            *float64 `json:"volatility_weight"`
+	ATRWeight                   *float64 `json:"atr_weight"`
+	CorrelationWeight           *float64 `json:"correlation_weight"`
+	CorrelationReference        *string  `json:"correlation_reference"`
+	UnknownCorrelationDefault   *float64 `json:"unknown_correlation_default"`
+	InsufficientCorrelationMode *string  `json:"insufficient_correlation_mode"`
+	ClusterCorrelationThreshold *float64 `json:"cluster_correlation_threshold"`
+	MaxPairsPerCluster          *int     `json:"max_pairs_per_cluster"`
+	HighRiskSpread              *float64 `json:"high_risk_spread"`
+}
+
+// CriteriaResponse is the selection criteria in effect
+type CriteriaResponse struct {
+	MinVolumeUSDT               float64 `json:"min_volume_usdt"`
+	MaxVolatility               float64 `json:"max_volatility"`
+	MinVolatility               float64 `json:"min_volatility"`
+	MaxActivePairs              int     `json:"max_active_pairs"`
+	WatchlistSize               int     `json:"watchlist_size"`
+	VolumeWeight                float64 `json:"volume_weight"`
+	VolatilityWeight            float64 `json:"volatility_weight"`
+	ATRWeight                   float64 `json:"atr_weight"`
+	CorrelationWeight           float64 `json:"correlation_weight"`
+	CorrelationReference        string  `json:"correlation_reference"`
+	UnknownCorrelationDefault   float64 `json:"unknown_correlation_default"`
+	InsufficientCorrelationMode string  `json:"insufficient_correlation_mode"`
+	ClusterCorrelationThreshold float64 `json:"cluster_correlation_threshold"`
+	MaxPairsPerCluster          int     `json:"max_pairs_per_cluster"`
+	HighRiskSpread              float64 `json:"high_risk_spread"`
+}
+
+func NewServer(db *sharedDB.DB, scheduler *scheduler.Scheduler, logger *logrus.Logger) *Server {
+	return &Server{
+		db:        db,
+		scheduler: scheduler,
+		logger:    logger,
+	}
+}
+
+func (s *Server) Start(port string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/ready", s.handleHealth) // Kubernetes readiness probe
+	mux.HandleFunc("GET /criteria", s.handleGetCriteria)
+	mux.HandleFunc("POST /criteria", s.handleUpdateCriteria)
+	mux.Handle("/metrics", metrics.Handler())
+
+	server := &http.Server{
+		Addr:         ":" + port,
+		Handler:      mux,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		s.logger.WithField("port", port).Info("Starting API server")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			s.logger.WithError(err).Error("API server failed")
+		}
+	}()
+
+	return server
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	services := make(map[string]string)
+	status := HealthStatus{Status: "healthy", Timestamp: time.Now(), Services: services}
+
+	if err := s.db.HealthCheck(); err != nil {
+		services["database"] = "unhealthy: " + err.Error()
+		status.Status = "unhealthy"
+		s.logger.WithError(err).Error("Database health check failed")
+	} else {
+		services["database"] = "healthy"
+	}
+
+	code := http.StatusOK
+	if status.Status != "healthy" {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
+
+func (s *Server) handleGetCriteria(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, criteriaResponse(s.scheduler.Criteria()))
+}
+
+// handleUpdateCriteria applies the given fields over the current criteria and
+// triggers an immediate re-selection. Invalid criteria are rejected as a whole.
+func (s *Server) handleUpdateCriteria(w http.ResponseWriter, r *http.Request) {
+	var req CriteriaRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "invalid criteria body: " + err.Error()})
+		return
+	}
+
+	criteria := s.scheduler.Criteria()
+	req.apply(&criteria)
+
+	if err := s.scheduler.UpdateCriteria(criteria); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, criteriaResponse(criteria))
+}
+
+func (req CriteriaRequest) apply(c *models.SelectionCriteria) {
+	setFloat(&c.MinVolumeUSDT, req.MinVolumeUSDT)
+	setFloat(&c.MaxVolatility, req.MaxVolatility)
+	setFloat(&c.MinVolatility, req.MinVolatility)
+	setInt(&c.MaxActivesPairs, req.MaxActivePairs)
+	setInt(&c.WatchlistSize, req.WatchlistSize)
+	setFloat(&c.VolumeWeight, req.VolumeWeight)
+	setFloat(&c.VolatilityWeight, req.VolatilityWeight)
+	setFloat(&c.ATRWeight, req.ATRWeight)
+	setFloat(&c.CorrelationWeight, req.CorrelationWeight)
+	if req.CorrelationReference != nil {
+		c.CorrelationReference = *req.CorrelationReference
+	}
+	setFloat(&c.UnknownCorrelationDefault, req.UnknownCorrelationDefault)
+	if req.InsufficientCorrelationMode != nil {
+		c.InsufficientCorrelationMode = *req.InsufficientCorrelationMode
+	}
+	setFloat(&c.ClusterCorrelationThreshold, req.ClusterCorrelationThreshold)
+	setInt(&c.MaxPairsPerCluster, req.MaxPairsPerCluster)
+	setFloat(&c.HighRiskSpread, req.HighRiskSpread)
+}
+
+func criteriaResponse(c models.SelectionCriteria) CriteriaResponse {
+	return CriteriaResponse{
+		MinVolumeUSDT:               c.MinVolumeUSDT,
+		MaxVolatility:               c.MaxVolatility,
+		MinVolatility:               c.MinVolatility,
+		MaxActivePairs:              c.MaxActivesPairs,
+		WatchlistSize:               c.WatchlistSize,
+		VolumeWeight:                c.VolumeWeight,
+		VolatilityWeight:            c.VolatilityWeight,
+		ATRWeight:                   c.ATRWeight,
+		CorrelationWeight:           c.CorrelationWeight,
+		CorrelationReference:        c.CorrelationReference,
+		UnknownCorrelationDefault:   c.UnknownCorrelationDefault,
+		InsufficientCorrelationMode: c.InsufficientCorrelationMode,
+		ClusterCorrelationThreshold: c.ClusterCorrelationThreshold,
+		MaxPairsPerCluster:          c.MaxPairsPerCluster,
+		HighRiskSpread:              c.HighRiskSpread,
+	}
+}
+
+func setFloat(field *float64, value *float64) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+func setInt(field *int, value *int) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
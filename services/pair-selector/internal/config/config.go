@@ -13,7 +13,19 @@ type Config struct {
 	Database           database.Config
 	SelectionCriteria  models.SelectionCriteria
 	EvaluationInterval time.Duration
+	AnalysisWorkers    int
+	MaxHistoryCandles  int
 	MetricsPort        string
+
+	CorrelationMatrixTTL time.Duration
+	VolatilityModel      string        // "close" or "true_range"
+	RecencyHalfLife      time.Duration // Age at which volume and volatility count half, 0 weighs the window evenly
+
+	// Volume of pairs quoted in other currencies is converted to USDT at the
+	// latest <QUOTE>-USDT price; pairs whose rate is stale are skipped
+	QuoteConversion bool
+	QuoteRateTTL    time.Duration
+	QuoteRateMaxAge time.Duration // 0 never treats a rate as stale
 }
 
 func Load() *Config {
@@ -31,9 +43,31 @@ func Load() *Config {
 			VolatilityWeight:  getEnvFloat("VOLATILITY_WEIGHT", 0.25),
 			ATRWeight:         getEnvFloat("ATR_WEIGHT", 0.25),
 			CorrelationWeight: getEnvFloat("CORRELATION_WEIGHT", 0.20),
+			EdgeWeight:        getEnvFloat("EDGE_WEIGHT", 0),
+
+			CorrelationReference:        getEnv("CORRELATION_REFERENCE_SYMBOL", "BTC-USDT"),
+			UnknownCorrelationDefault:   getEnvFloat("UNKNOWN_CORRELATION_DEFAULT", 0.5),
+			InsufficientCorrelationMode: getEnv("INSUFFICIENT_CORRELATION_MODE", models.InsufficientCorrelationNeutral),
+
+			ClusterCorrelationThreshold: getEnvFloat("CLUSTER_CORRELATION_THRESHOLD", 0),
+			MaxPairsPerCluster:          getEnvInt("MAX_PAIRS_PER_CLUSTER", 1),
+
+			HighRiskSpread: getEnvFloat("HIGH_RISK_SPREAD", 0.004), // 0.4%
+
+			FeeRate: getEnvFloat("FEE_RATE", 0.001), // 0.1% KuCoin taker
 		},
 		EvaluationInterval: time.Duration(getEnvInt("EVALUATION_INTERVAL_HOURS", 4)) * time.Hour,
+		AnalysisWorkers:    getEnvInt("ANALYSIS_WORKERS", 4),
+		MaxHistoryCandles:  getEnvInt("PRICE_HISTORY_MAX_CANDLES", 20000),
 		MetricsPort:        getEnv("METRICS_PORT", "8081"),
+
+		CorrelationMatrixTTL: time.Duration(getEnvInt("CORRELATION_MATRIX_TTL_MINUTES", 60)) * time.Minute,
+		VolatilityModel:      getEnv("VOLATILITY_MODEL", "close"),
+		RecencyHalfLife:      time.Duration(getEnvFloat("SELECTION_RECENCY_HALF_LIFE_HOURS", 0) * float64(time.Hour)),
+
+		QuoteConversion: getEnvBool("QUOTE_CONVERSION_ENABLED", true),
+		QuoteRateTTL:    time.Duration(getEnvInt("QUOTE_RATE_TTL_SECONDS", 60)) * time.Second,
+		QuoteRateMaxAge: time.Duration(getEnvInt("QUOTE_RATE_MAX_AGE_MINUTES", 15)) * time.Minute,
 	}
 }
 
@@ -61,3 +95,12 @@ func getEnvFloat(key string, defaultValue float64) float64 {
 	}
 	return defaultValue
 }
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
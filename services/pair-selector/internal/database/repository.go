@@ -12,14 +12,36 @@ import (
 )
 
 type Repository struct {
-	db     *database.DB
-	logger *logrus.Logger
+	db         *database.DB
+	maxCandles int // Most recent candles a price history read returns, 0 for no limit
+	logger     *logrus.Logger
 }
 
-func NewRepository(db *database.DB, logger *logrus.Logger) *Repository {
+func NewRepository(db *database.DB, maxCandles int, logger *logrus.Logger) *Repository {
 	return &Repository{
-		db:     db,
-		logger: logger,
+		db:         db,
+		maxCandles: maxCandles,
+		logger:     logger,
+	}
+}
+
+// candleLimit is the LIMIT argument for price history reads; NULL means no
+// limit in PostgreSQL
+func (r *Repository) candleLimit() interface{} {
+	if r.maxCandles <= 0 {
+		return nil
+	}
+	return r.maxCandles
+}
+
+// warnIfCapped logs when a price history read hit the candle cap, meaning
+// the requested window was truncated to its most recent candles
+func (r *Repository) warnIfCapped(symbol string, count int) {
+	if r.maxCandles > 0 && count >= r.maxCandles {
+		r.logger.WithFields(logrus.Fields{
+			"symbol":      symbol,
+			"max_candles": r.maxCandles,
+		}).Warn("Price history window exceeds the candle cap, older candles dropped")
 	}
 }
 
@@ -65,15 +87,22 @@ func (r *Repository) GetTradingPairs(ctx context.Context) ([]models.TradingPair,
 }
 
 func (r *Repository) GetPriceHistory(ctx context.Context, symbol string, hours int) ([]models.PricePoint, error) {
+	// The newest points are kept when the window exceeds the cap, then
+	// returned oldest first
 	query := `
-        SELECT timestamp, close, volume, high, low
-        FROM price_data 
-        WHERE symbol = $1 
-          AND timestamp >= NOW() - INTERVAL '%d hours'
+        SELECT timestamp, close, volume, high, low, best_bid, best_ask
+        FROM (
+            SELECT timestamp, close, volume, high, low, COALESCE(best_bid, 0) AS best_bid, COALESCE(best_ask, 0) AS best_ask
+            FROM price_data
+            WHERE symbol = $1
+              AND timestamp >= NOW() - INTERVAL '%d hours'
+            ORDER BY timestamp DESC
+            LIMIT $2
+        ) recent
         ORDER BY timestamp ASC
     `
 
-	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(query, hours), symbol)
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(query, hours), symbol, r.candleLimit())
 	if err != nil {
 		return nil, fmt.Errorf("failed to query price history for %s: %w", symbol, err)
 	}
@@ -82,7 +111,7 @@ func (r *Repository) GetPriceHistory(ctx context.Context, symbol string, hours i
 	var prices []models.PricePoint
 	for rows.Next() {
 		var price models.PricePoint
-		err := rows.Scan(&price.Timestamp, &price.Close, &price.Volume, &price.High, &price.Low)
+		err := rows.Scan(&price.Timestamp, &price.Close, &price.Volume, &price.High, &price.Low, &price.BestBid, &price.BestAsk)
 		if err != nil {
 			r.logger.WithError(err).WithField("symbol", symbol).Error("Failed to scan price point")
 			continue
@@ -90,23 +119,50 @@ func (r *Repository) GetPriceHistory(ctx context.Context, symbol string, hours i
 		prices = append(prices, price)
 	}
 
+	r.warnIfCapped(symbol, len(prices))
+
 	return prices, nil
 }
 
+// GetLatestQuote returns the newest close of the symbol with its timestamp
+func (r *Repository) GetLatestQuote(ctx context.Context, symbol string) (float64, time.Time, error) {
+	query := `
+        SELECT close, timestamp
+        FROM price_data
+        WHERE symbol = $1
+        ORDER BY timestamp DESC
+        LIMIT 1
+    `
+
+	var price float64
+	var observedAt time.Time
+	if err := r.db.QueryRowContext(ctx, query, symbol).Scan(&price, &observedAt); err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to get latest quote for %s: %w", symbol, err)
+	}
+
+	return price, observedAt, nil
+}
+
 func (r *Repository) UpdateTradingPairMetrics(ctx context.Context, symbol string, metrics map[string]float64) error {
 	query := `
         UPDATE trading_pairs 
         SET daily_volume_usdt = $2,
             volatility_score = $3,
             atr_14 = $4,
-            correlation_btc = $5,
+            correlation_btc = COALESCE($5, correlation_btc),
             last_updated = NOW()
         WHERE symbol = $1
     `
 
+	// A missing correlation keeps the previously stored value
+	var correlation interface{}
+	if value, ok := metrics["correlation_btc"]; ok {
+		correlation = value
+	}
+
 	_, err := r.db.ExecContext(ctx, query, symbol,
 		metrics["volume_usdt"], metrics["volatility"],
-		metrics["atr_14"], metrics["correlation_btc"])
+		metrics["atr_14"], correlation)
 
 	if err != nil {
 		return fmt.Errorf("failed to update metrics for %s: %w", symbol, err)
@@ -163,6 +219,10 @@ func (r *Repository) UpdateSelectedPairs(ctx context.Context, analyses []models.
 		return fmt.Errorf("failed to deactivate current selections: %w", err)
 	}
 
+	// A symbol may only appear once in the upsert, otherwise the conflict
+	// clause would hit the same row twice and abort the whole statement
+	analyses = deduplicateAnalyses(analyses)
+
 	// Insert new selections
 	if len(analyses) > 0 {
 		query := `
@@ -209,3 +269,23 @@ func (r *Repository) UpdateSelectedPairs(ctx context.Context, analyses []models.
 	r.logger.WithField("selected_pairs", len(analyses)).Info("Successfully updated selected pairs")
 	return nil
 }
+
+// deduplicateAnalyses keeps the highest scoring analysis for each symbol,
+// preserving the position of the symbol's first occurrence
+func deduplicateAnalyses(analyses []models.PairAnalysis) []models.PairAnalysis {
+	index := make(map[string]int, len(analyses))
+	unique := make([]models.PairAnalysis, 0, len(analyses))
+
+	for _, analysis := range analyses {
+		if i, exists := index[analysis.Symbol]; exists {
+			if analysis.FinalScore > unique[i].FinalScore {
+				unique[i] = analysis
+			}
+			continue
+		}
+		index[analysis.Symbol] = len(unique)
+		unique = append(unique, analysis)
+	}
+
+	return unique
+}
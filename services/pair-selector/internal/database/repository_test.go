@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/pkg/models"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestDeduplicateAnalysesKeepsHighestScore(t *testing.T) {
+	analyses := []models.PairAnalysis{
+		{Symbol: "ETH-USDT", FinalScore: 0.4},
+		{Symbol: "BTC-USDT", FinalScore: 0.7},
+		{Symbol: "ETH-USDT", FinalScore: 0.9},
+		{Symbol: "ETH-USDT", FinalScore: 0.5},
+		{Symbol: "SOL-USDT", FinalScore: 0.6},
+	}
+
+	got := deduplicateAnalyses(analyses)
+
+	want := []models.PairAnalysis{
+		{Symbol: "ETH-USDT", FinalScore: 0.9},
+		{Symbol: "BTC-USDT", FinalScore: 0.7},
+		{Symbol: "SOL-USDT", FinalScore: 0.6},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("deduplicateAnalyses() returned %d analyses, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Symbol != want[i].Symbol || got[i].FinalScore != want[i].FinalScore {
+			t.Errorf("analysis %d = %s %v, want %s %v", i, got[i].Symbol, got[i].FinalScore, want[i].Symbol, want[i].FinalScore)
+		}
+	}
+}
+
+// hourlyPoints answers a price history read from 48 stored points, honouring
+// the LIMIT argument the way PostgreSQL runs the query: the newest rows
+// within the limit, returned oldest first
+func hourlyPoints(start time.Time) func(string, []driver.Value) (fakeResult, error) {
+	return func(_ string, args []driver.Value) (fakeResult, error) {
+		stored := make([][]driver.Value, 48)
+		for i := range stored {
+			price := 100 + float64(i)
+			stored[i] = []driver.Value{start.Add(time.Duration(i) * time.Hour), price, 1.0, price, price, price - 0.05, price + 0.05}
+		}
+		if limit, ok := args[1].(int64); ok && int(limit) < len(stored) {
+			stored = stored[len(stored)-int(limit):]
+		}
+		return fakeResult{columns: []string{"timestamp", "close", "volume", "high", "low", "best_bid", "best_ask"}, rows: stored}, nil
+	}
+}
+
+func TestPriceHistoryCap(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		maxCandles int
+		wantLimit  driver.Value
+		wantFirst  float64
+		wantCount  int
+		wantWarned bool
+	}{
+		{name: "cap hit keeps the newest points", maxCandles: 24, wantLimit: int64(24), wantFirst: 124, wantCount: 24, wantWarned: true},
+		{name: "window within the cap", maxCandles: 100, wantLimit: int64(100), wantFirst: 100, wantCount: 48},
+		{name: "no cap", maxCandles: 0, wantLimit: nil, wantFirst: 100, wantCount: 48},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, db := newFakeDB(hourlyPoints(start))
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+			hook := test.NewLocal(logger)
+			repo := NewRepository(db, tt.maxCandles, logger)
+
+			prices, err := repo.GetPriceHistory(context.Background(), "BTC-USDT", 48)
+			if err != nil {
+				t.Fatalf("GetPriceHistory() error = %v", err)
+			}
+
+			queries := fake.Queries()
+			if len(queries) != 1 || queries[0].args[1] != tt.wantLimit {
+				t.Fatalf("queries = %+v, want one read with LIMIT %v", queries, tt.wantLimit)
+			}
+			query := queries[0].query
+			newest := strings.Index(query, "ORDER BY timestamp DESC")
+			limit := strings.Index(query, "LIMIT $2")
+			oldest := strings.LastIndex(query, "ORDER BY timestamp ASC")
+			if newest < 0 || limit < newest || oldest < limit {
+				t.Errorf("query does not limit the newest rows and return them oldest first:\n%s", query)
+			}
+
+			if len(prices) != tt.wantCount || prices[0].Close != tt.wantFirst {
+				t.Fatalf("got %d points from %v, want %d from %v", len(prices), prices[0].Close, tt.wantCount, tt.wantFirst)
+			}
+			for i := 1; i < len(prices); i++ {
+				if !prices[i].Timestamp.After(prices[i-1].Timestamp) {
+					t.Fatalf("point %d at %v not after %v, want ascending order", i, prices[i].Timestamp, prices[i-1].Timestamp)
+				}
+			}
+			if last := prices[len(prices)-1]; last.BestBid != 147-0.05 || last.BestAsk != 147+0.05 {
+				t.Errorf("newest bid/ask = %v/%v, want the stored spread", last.BestBid, last.BestAsk)
+			}
+
+			warned := false
+			for _, entry := range hook.AllEntries() {
+				warned = warned || entry.Level == logrus.WarnLevel
+			}
+			if warned != tt.wantWarned {
+				t.Errorf("warned = %v, want %v", warned, tt.wantWarned)
+			}
+		})
+	}
+}
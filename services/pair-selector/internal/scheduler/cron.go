@@ -2,22 +2,43 @@ package scheduler
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/internal/database"
 	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/internal/selector"
 	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/pkg/models"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
 	"github.com/robfig/cron/v3"
 	"github.com/sirupsen/logrus"
 )
 
+// pairAnalyzer scores the candidate pairs and picks the active set
+type pairAnalyzer interface {
+	AnalyzePairs(ctx context.Context, criteria models.SelectionCriteria) ([]models.PairAnalysis, error)
+	DiversifyByCluster(ctx context.Context, analyses []models.PairAnalysis, criteria models.SelectionCriteria) []models.PairAnalysis
+	SelectTopPairs(analyses []models.PairAnalysis, maxPairs int) []models.PairAnalysis
+}
+
+// selectionStore persists the outcome of a selection cycle
+type selectionStore interface {
+	UpdateSelectedPairs(ctx context.Context, analyses []models.PairAnalysis, criteria models.SelectionCriteria) error
+}
+
 type Scheduler struct {
-	analyzer *selector.Analyzer
-	repo     *database.Repository
+	analyzer pairAnalyzer
+	repo     selectionStore
 	cron     *cron.Cron
-	criteria models.SelectionCriteria
 	logger   *logrus.Logger
 	interval time.Duration
+
+	// Criteria can be replaced at runtime; each cycle works on the copy taken
+	// when it starts, and cycles never overlap
+	mu       sync.RWMutex
+	criteria models.SelectionCriteria
+	cycle    sync.Mutex
+	reselect chan struct{}
 }
 
 func NewScheduler(analyzer *selector.Analyzer, repo *database.Repository, criteria models.SelectionCriteria, interval time.Duration, logger *logrus.Logger) *Scheduler {
@@ -30,23 +51,26 @@ func NewScheduler(analyzer *selector.Analyzer, repo *database.Repository, criter
 		criteria: criteria,
 		logger:   logger,
 		interval: interval,
+		reselect: make(chan struct{}, 1),
 	}
 }
 
 func (s *Scheduler) Start(ctx context.Context) error {
-	s.logger.WithField("interval", s.interval).Info("Starting pair selection scheduler")
-
-	// Schedule pair selection every N hours
-	cronExpr := "0 0 */4 * * *" // Every 4 hours
-	if s.interval == 6*time.Hour {
-		cronExpr = "0 0 */6 * * *" // Every 6 hours
+	cronExpr, err := CronSpec(s.interval)
+	if err != nil {
+		return err
 	}
 
-	_, err := s.cron.AddFunc(cronExpr, func() {
+	s.logger.WithFields(logrus.Fields{
+		"interval": s.interval,
+		"schedule": cronExpr,
+	}).Info("Starting pair selection scheduler")
+
+	_, err = s.cron.AddFunc(cronExpr, func() {
 		s.selectPairs(ctx)
 	})
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to schedule pair selection: %w", err)
 	}
 
 	s.cron.Start()
@@ -54,42 +78,116 @@ func (s *Scheduler) Start(ctx context.Context) error {
 	// Run initial selection
 	go s.selectPairs(ctx)
 
+	// Re-run selection whenever the criteria change
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.reselect:
+				s.selectPairs(ctx)
+			}
+		}
+	}()
+
 	s.logger.Info("Pair selection scheduler started successfully")
 	return nil
 }
 
+// CronSpec returns the schedule running selection every interval. Intervals
+// that divide an hour or a day evenly stay aligned to the clock, e.g. 6h runs
+// at 00:00, 06:00, 12:00 and 18:00; any other interval counts from startup.
+func CronSpec(interval time.Duration) (string, error) {
+	if interval <= 0 {
+		return "", fmt.Errorf("evaluation interval must be positive, got %s", interval)
+	}
+
+	switch {
+	case interval%time.Hour == 0 && 24%int(interval/time.Hour) == 0:
+		return fmt.Sprintf("0 0 */%d * * *", int(interval/time.Hour)), nil
+	case interval < time.Hour && interval%time.Minute == 0 && 60%int(interval/time.Minute) == 0:
+		return fmt.Sprintf("0 */%d * * * *", int(interval/time.Minute)), nil
+	default:
+		return "@every " + interval.String(), nil
+	}
+}
+
 func (s *Scheduler) Stop() {
 	s.logger.Info("Stopping pair selection scheduler")
 	s.cron.Stop()
 }
 
+// Criteria returns the criteria the next selection cycle will use
+func (s *Scheduler) Criteria() models.SelectionCriteria {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.criteria
+}
+
+// UpdateCriteria validates and installs new criteria, then schedules an
+// immediate re-selection. A cycle already running finishes with the criteria
+// it started with.
+func (s *Scheduler) UpdateCriteria(criteria models.SelectionCriteria) error {
+	if err := criteria.Validate(); err != nil {
+		return fmt.Errorf("invalid selection criteria: %w", err)
+	}
+
+	s.mu.Lock()
+	s.criteria = criteria
+	s.mu.Unlock()
+
+	s.logger.WithFields(logrus.Fields{
+		"min_volume_usdt":  criteria.MinVolumeUSDT,
+		"min_volatility":   criteria.MinVolatility,
+		"max_volatility":   criteria.MaxVolatility,
+		"max_active_pairs": criteria.MaxActivesPairs,
+		"watchlist_size":   criteria.WatchlistSize,
+	}).Info("Selection criteria updated, scheduling re-selection")
+
+	// A pending re-selection already picks up the latest criteria
+	select {
+	case s.reselect <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
 func (s *Scheduler) selectPairs(ctx context.Context) {
+	s.cycle.Lock()
+	defer s.cycle.Unlock()
+
+	criteria := s.Criteria()
+
 	start := time.Now()
 	s.logger.Info("Starting pair selection cycle")
 
 	// Analyze all pairs
-	analyses, err := s.analyzer.AnalyzePairs(ctx, s.criteria)
+	analyses, err := s.analyzer.AnalyzePairs(ctx, criteria)
 	if err != nil {
 		s.logger.WithError(err).Error("Failed to analyze pairs")
 		return
 	}
 
-	// Select top pairs for active trading
-	selectedPairs := s.analyzer.SelectTopPairs(analyses, s.criteria.MaxActivesPairs)
+	// Keep correlated pairs from crowding out the active set, then select the
+	// top pairs for active trading
+	candidates := s.analyzer.DiversifyByCluster(ctx, analyses, criteria)
+	selectedPairs := s.analyzer.SelectTopPairs(candidates, criteria.MaxActivesPairs)
 
 	// Update selected pairs in database
-	if err := s.repo.UpdateSelectedPairs(ctx, selectedPairs, s.criteria); err != nil {
+	if err := s.repo.UpdateSelectedPairs(ctx, selectedPairs, criteria); err != nil {
 		s.logger.WithError(err).Error("Failed to update selected pairs")
 		return
 	}
 
 	duration := time.Since(start)
+	metrics.PairSelectionDuration.Observe(duration.Seconds())
 	s.logger.WithFields(logrus.Fields{
 		"duration_ms":      duration.Milliseconds(),
 		"analyzed_pairs":   len(analyses),
 		"selected_pairs":   len(selectedPairs),
-		"watchlist_size":   s.criteria.WatchlistSize,
-		"max_active_pairs": s.criteria.MaxActivesPairs,
+		"watchlist_size":   criteria.WatchlistSize,
+		"max_active_pairs": criteria.MaxActivesPairs,
 	}).Info("Pair selection cycle completed successfully")
 
 	// Log selected pairs for monitoring
@@ -0,0 +1,250 @@
+package scheduler
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/pkg/models"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/robfig/cron/v3"
+)
+
+// fakeAnalyzer keeps the pairs whose volume meets the criteria, recording the
+// criteria each step saw. A non-nil gate holds the first analysis until
+// closed.
+type fakeAnalyzer struct {
+	volumes map[string]float64
+	started chan struct{}
+	gate    chan struct{}
+
+	mu        sync.Mutex
+	diversify []models.SelectionCriteria
+}
+
+func (f *fakeAnalyzer) AnalyzePairs(_ context.Context, criteria models.SelectionCriteria) ([]models.PairAnalysis, error) {
+	if f.started != nil {
+		f.started <- struct{}{}
+	}
+	if f.gate != nil {
+		<-f.gate
+	}
+
+	var analyses []models.PairAnalysis
+	for symbol, volume := range f.volumes {
+		if volume >= criteria.MinVolumeUSDT {
+			analyses = append(analyses, models.PairAnalysis{Symbol: symbol, Volume24hUSDT: volume, FinalScore: volume})
+		}
+	}
+	sort.Slice(analyses, func(i, j int) bool { return analyses[i].FinalScore > analyses[j].FinalScore })
+	return analyses, nil
+}
+
+func (f *fakeAnalyzer) DiversifyByCluster(_ context.Context, analyses []models.PairAnalysis, criteria models.SelectionCriteria) []models.PairAnalysis {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.diversify = append(f.diversify, criteria)
+	return analyses
+}
+
+func (f *fakeAnalyzer) SelectTopPairs(analyses []models.PairAnalysis, maxPairs int) []models.PairAnalysis {
+	if len(analyses) > maxPairs {
+		return analyses[:maxPairs]
+	}
+	return analyses
+}
+
+type selection struct {
+	symbols  []string
+	criteria models.SelectionCriteria
+}
+
+// fakeStore hands each stored selection to the test
+type fakeStore struct {
+	selections chan selection
+}
+
+func (f *fakeStore) UpdateSelectedPairs(_ context.Context, analyses []models.PairAnalysis, criteria models.SelectionCriteria) error {
+	symbols := make([]string, len(analyses))
+	for i, analysis := range analyses {
+		symbols[i] = analysis.Symbol
+	}
+	f.selections <- selection{symbols: symbols, criteria: criteria}
+	return nil
+}
+
+func testCriteria(minVolume float64) models.SelectionCriteria {
+	return models.SelectionCriteria{
+		MinVolumeUSDT:               minVolume,
+		MinVolatility:               0.01,
+		MaxVolatility:               0.1,
+		MaxActivesPairs:             5,
+		WatchlistSize:               10,
+		VolumeWeight:                1,
+		CorrelationReference:        "BTC-USDT",
+		InsufficientCorrelationMode: models.InsufficientCorrelationNeutral,
+	}
+}
+
+func newTestScheduler(analyzer *fakeAnalyzer, store *fakeStore, criteria models.SelectionCriteria) *Scheduler {
+	s := NewScheduler(nil, nil, criteria, 24*time.Hour, utils.NewDiscardLogger())
+	s.analyzer = analyzer
+	s.repo = store
+	return s
+}
+
+func testVolumes() map[string]float64 {
+	return map[string]float64{"BTC-USDT": 50e6, "ETH-USDT": 20e6, "SOL-USDT": 2e6, "DOGE-USDT": 0.5e6}
+}
+
+func awaitSelection(t *testing.T, store *fakeStore) selection {
+	t.Helper()
+
+	select {
+	case s := <-store.selections:
+		return s
+	case <-time.After(2 * time.Second):
+		t.Fatal("no selection stored")
+		return selection{}
+	}
+}
+
+func TestUpdateCriteriaReselectsWithNewThresholds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &fakeStore{selections: make(chan selection, 4)}
+	s := newTestScheduler(&fakeAnalyzer{volumes: testVolumes()}, store, testCriteria(1e6))
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer s.Stop()
+
+	initial := awaitSelection(t, store)
+	if len(initial.symbols) != 3 {
+		t.Fatalf("initial selection = %v, want the three pairs above 1M", initial.symbols)
+	}
+
+	if err := s.UpdateCriteria(testCriteria(10e6)); err != nil {
+		t.Fatalf("UpdateCriteria() error = %v", err)
+	}
+
+	// The re-selection runs at once rather than at the next scheduled cycle
+	reselected := awaitSelection(t, store)
+	if reselected.criteria.MinVolumeUSDT != 10e6 {
+		t.Errorf("re-selection min volume = %v, want 10M", reselected.criteria.MinVolumeUSDT)
+	}
+	if len(reselected.symbols) != 2 || reselected.symbols[0] != "BTC-USDT" || reselected.symbols[1] != "ETH-USDT" {
+		t.Errorf("re-selection = %v, want BTC-USDT and ETH-USDT above 10M", reselected.symbols)
+	}
+	if got := s.Criteria().MinVolumeUSDT; got != 10e6 {
+		t.Errorf("Criteria() min volume = %v, want 10M", got)
+	}
+}
+
+func TestInvalidCriteriaRejected(t *testing.T) {
+	store := &fakeStore{selections: make(chan selection, 1)}
+	s := newTestScheduler(&fakeAnalyzer{volumes: testVolumes()}, store, testCriteria(1e6))
+
+	invalid := testCriteria(10e6)
+	invalid.WatchlistSize = 2 // Smaller than the active set
+
+	if err := s.UpdateCriteria(invalid); err == nil {
+		t.Fatal("UpdateCriteria() accepted a watchlist smaller than the active set")
+	}
+	if got := s.Criteria().MinVolumeUSDT; got != 1e6 {
+		t.Errorf("Criteria() min volume = %v, want the previous 1M kept", got)
+	}
+	if pending := len(s.reselect); pending != 0 {
+		t.Errorf("%d re-selections pending after a rejected update, want none", pending)
+	}
+}
+
+func TestCriteriaChangeMidCycleKeepsCycleConsistent(t *testing.T) {
+	analyzer := &fakeAnalyzer{volumes: testVolumes(), started: make(chan struct{}, 2), gate: make(chan struct{})}
+	store := &fakeStore{selections: make(chan selection, 2)}
+	s := newTestScheduler(analyzer, store, testCriteria(1e6))
+
+	done := make(chan struct{})
+	go func() {
+		s.selectPairs(context.Background())
+		close(done)
+	}()
+	<-analyzer.started
+
+	// Lands while the cycle is analyzing with the old criteria
+	if err := s.UpdateCriteria(testCriteria(10e6)); err != nil {
+		t.Fatalf("UpdateCriteria() error = %v", err)
+	}
+	close(analyzer.gate)
+	<-done
+
+	stored := awaitSelection(t, store)
+	if stored.criteria.MinVolumeUSDT != 1e6 || len(stored.symbols) != 3 {
+		t.Errorf("in-flight cycle stored %v with min volume %v, want its starting 1M criteria throughout",
+			stored.symbols, stored.criteria.MinVolumeUSDT)
+	}
+	analyzer.mu.Lock()
+	diversified := analyzer.diversify
+	analyzer.mu.Unlock()
+	if len(diversified) != 1 || diversified[0].MinVolumeUSDT != 1e6 {
+		t.Errorf("clustering saw %+v, want the cycle's starting criteria", diversified)
+	}
+
+	if pending := len(s.reselect); pending != 1 {
+		t.Errorf("%d re-selections pending, want one for the new criteria", pending)
+	}
+}
+
+func TestCronSpecFollowsInterval(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		want     string
+	}{
+		{interval: 4 * time.Hour, want: "0 0 */4 * * *"},
+		{interval: 6 * time.Hour, want: "0 0 */6 * * *"},
+		{interval: 2 * time.Hour, want: "0 0 */2 * * *"},
+		{interval: 12 * time.Hour, want: "0 0 */12 * * *"},
+		{interval: 15 * time.Minute, want: "0 */15 * * * *"},
+		{interval: 5 * time.Hour, want: "@every 5h0m0s"},
+		{interval: 90 * time.Minute, want: "@every 1h30m0s"},
+		{interval: 48 * time.Hour, want: "@every 48h0m0s"},
+	}
+
+	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	midnight := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tt := range tests {
+		t.Run(tt.interval.String(), func(t *testing.T) {
+			spec, err := CronSpec(tt.interval)
+			if err != nil {
+				t.Fatalf("CronSpec() error = %v", err)
+			}
+			if spec != tt.want {
+				t.Errorf("CronSpec() = %q, want %q", spec, tt.want)
+			}
+
+			schedule, err := parser.Parse(spec)
+			if err != nil {
+				t.Fatalf("schedule %q does not parse: %v", spec, err)
+			}
+			first := schedule.Next(midnight)
+			second := schedule.Next(first)
+			third := schedule.Next(second)
+			if second.Sub(first) != tt.interval || third.Sub(second) != tt.interval {
+				t.Errorf("runs at %v, %v, %v; want %v apart", first, second, third, tt.interval)
+			}
+		})
+	}
+}
+
+func TestCronSpecRejectsNonPositiveInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Hour} {
+		if spec, err := CronSpec(interval); err == nil {
+			t.Errorf("CronSpec(%v) = %q, want an error", interval, spec)
+		}
+	}
+}
@@ -2,11 +2,15 @@ package selector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/internal/database"
 	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/pkg/models"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/quotes"
 	"github.com/sirupsen/logrus"
 )
 
@@ -16,16 +20,25 @@ type Analyzer struct {
 	volumeAnalyzer      *VolumeAnalyzer
 	correlationAnalyzer *CorrelationAnalyzer
 	scorer              *Scorer
+	quoteRates          *quotes.Converter // nil takes every volume as quoted in USDT
+	workers             int               // Pairs analyzed concurrently
 	logger              *logrus.Logger
 }
 
-func NewAnalyzer(repo *database.Repository, logger *logrus.Logger) *Analyzer {
+func NewAnalyzer(repo *database.Repository, workers int, correlationMatrixTTL time.Duration, volatilityModel string,
+	recencyHalfLife time.Duration, quoteRates *quotes.Converter, logger *logrus.Logger) *Analyzer {
+	if workers < 1 {
+		workers = 1
+	}
+
 	return &Analyzer{
 		repo:                repo,
-		volatilityAnalyzer:  NewVolatilityAnalyzer(logger),
-		volumeAnalyzer:      NewVolumeAnalyzer(logger),
-		correlationAnalyzer: NewCorrelationAnalyzer(repo, logger),
+		volatilityAnalyzer:  NewVolatilityAnalyzer(volatilityModel, recencyHalfLife, logger),
+		volumeAnalyzer:      NewVolumeAnalyzer(recencyHalfLife, logger),
+		correlationAnalyzer: NewCorrelationAnalyzer(repo, correlationMatrixTTL, logger),
 		scorer:              NewScorer(logger),
+		quoteRates:          quoteRates,
+		workers:             workers,
 		logger:              logger,
 	}
 }
@@ -39,34 +52,72 @@ func (a *Analyzer) AnalyzePairs(ctx context.Context, criteria models.SelectionCr
 		return nil, fmt.Errorf("failed to get trading pairs: %w", err)
 	}
 
-	a.logger.WithField("total_pairs", len(pairs)).Info("Fetched trading pairs")
+	a.logger.WithFields(logrus.Fields{
+		"total_pairs": len(pairs),
+		"workers":     a.workers,
+	}).Info("Fetched trading pairs")
 
-	var analyses []models.PairAnalysis
+	analyses := a.analyzeConcurrently(pairs, func(pair models.TradingPair) (*models.PairAnalysis, error) {
+		return a.analyzeSinglePair(ctx, pair, criteria)
+	})
+	analyses = rankAnalyses(analyses, criteria.WatchlistSize)
 
-	for _, pair := range pairs {
-		analysis, err := a.analyzeSinglePair(ctx, pair, criteria)
-		if err != nil {
-			a.logger.WithError(err).WithField("symbol", pair.Symbol).Warn("Failed to analyze pair")
-			continue
-		}
+	a.logger.WithField("analyzed_pairs", len(analyses)).Info("Completed pair analysis")
+	return analyses, nil
+}
+
+// analyzeConcurrently runs analyze over the pairs on the worker pool and
+// returns the analyses in input order, dropping failed and skipped pairs
+func (a *Analyzer) analyzeConcurrently(pairs []models.TradingPair,
+	analyze func(models.TradingPair) (*models.PairAnalysis, error)) []models.PairAnalysis {
+
+	// Each worker writes only its own slot, so results keep the input order
+	// regardless of which pair finishes first
+	results := make([]*models.PairAnalysis, len(pairs))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < a.workers && w < len(pairs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				analysis, err := analyze(pairs[i])
+				if err != nil {
+					a.logger.WithError(err).WithField("symbol", pairs[i].Symbol).Warn("Failed to analyze pair")
+					continue
+				}
+				results[i] = analysis
+			}
+		}()
+	}
+
+	for i := range pairs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 
+	var analyses []models.PairAnalysis
+	for _, analysis := range results {
 		if analysis != nil {
 			analyses = append(analyses, *analysis)
 		}
 	}
+	return analyses
+}
 
-	// Sort by final score
-	sort.Slice(analyses, func(i, j int) bool {
+// rankAnalyses sorts by final score, keeping ties in input order, and limits
+// the result to the watchlist size
+func rankAnalyses(analyses []models.PairAnalysis, watchlistSize int) []models.PairAnalysis {
+	sort.SliceStable(analyses, func(i, j int) bool {
 		return analyses[i].FinalScore > analyses[j].FinalScore
 	})
 
-	// Limit to watchlist size
-	if len(analyses) > criteria.WatchlistSize {
-		analyses = analyses[:criteria.WatchlistSize]
+	if len(analyses) > watchlistSize {
+		analyses = analyses[:watchlistSize]
 	}
-
-	a.logger.WithField("analyzed_pairs", len(analyses)).Info("Completed pair analysis")
-	return analyses, nil
+	return analyses
 }
 
 func (a *Analyzer) analyzeSinglePair(ctx context.Context, pair models.TradingPair, criteria models.SelectionCriteria) (*models.PairAnalysis, error) {
@@ -86,9 +137,22 @@ func (a *Analyzer) analyzeSinglePair(ctx context.Context, pair models.TradingPai
 		PriceData: priceHistory,
 	}
 
-	// Volume Analysis
+	// Volume Analysis. Volume is summed in the pair's quote currency and
+	// converted, so pairs quoted in BTC or ETH compare with USDT pairs.
 	volumeMetrics := a.volumeAnalyzer.AnalyzeVolume(priceHistory)
-	analysis.Volume24hUSDT = volumeMetrics.Volume24hUSDT
+	quote := quotes.QuoteCurrency(pair.Symbol)
+	volume, rate, ok := a.quoteRates.ToUSDT(ctx, quote, volumeMetrics.Volume24hUSDT)
+	if !ok {
+		a.logger.WithFields(logrus.Fields{
+			"symbol":  pair.Symbol,
+			"quote":   quote,
+			"missing": rate.Missing,
+		}).Warn("Quote rate is not fresh, skipping pair")
+		return nil, nil
+	}
+	analysis.Volume24hUSDT = volume
+	analysis.AvgSpread = volumeMetrics.AverageSpread
+	analysis.VolumeConsistency = volumeMetrics.VolumeConsistency
 
 	// Skip pairs below minimum volume threshold
 	if analysis.Volume24hUSDT < criteria.MinVolumeUSDT {
@@ -105,52 +169,140 @@ func (a *Analyzer) analyzeSinglePair(ctx context.Context, pair models.TradingPai
 		return nil, nil
 	}
 
-	// Correlation Analysis (with BTC)
-	correlationMetrics, err := a.correlationAnalyzer.AnalyzeCorrelation(ctx, pair.Symbol, "BTC-USDT", 24)
-	if err != nil {
-		a.logger.WithError(err).WithField("symbol", pair.Symbol).Warn("Failed to analyze correlation")
-		analysis.CorrelationBTC = 0
+	// Correlation Analysis, averaged over the references. A reference would
+	// correlate perfectly with itself, so it is only measured against the
+	// others, and scored without correlation when it is the only one.
+	var correlationMetrics CorrelationMetrics
+	references := otherReferences(criteria.CorrelationReferences(), pair.Symbol)
+	if len(references) == 0 {
+		analysis.CorrelationSelf = true
 	} else {
+		correlationMetrics, err = a.correlationAnalyzer.AnalyzeReferenceCorrelation(ctx, pair.Symbol, references, 24)
+	}
+	if !a.applyCorrelation(&analysis, correlationMetrics, err, criteria) {
+		return nil, nil
+	}
+
+	a.scoreAnalysis(&analysis, criteria)
+
+	// Update trading pair metrics in database; an unknown correlation is left
+	// out so the last measured value is kept
+	metrics := map[string]float64{
+		"volume_usdt": analysis.Volume24hUSDT,
+		"volatility":  analysis.Volatility,
+		"atr_14":      analysis.ATR14,
+	}
+	if analysis.CorrelationKnown {
+		metrics["correlation_btc"] = analysis.CorrelationBTC
+	}
+
+	if err := a.repo.UpdateTradingPairMetrics(ctx, pair.Symbol, metrics); err != nil {
+		a.logger.WithError(err).WithField("symbol", pair.Symbol).Warn("Failed to update pair metrics")
+	}
+
+	return &analysis, nil
+}
+
+// applyCorrelation records the outcome of the correlation analysis on the
+// pair and reports whether the pair should still be scored. Too little aligned
+// data is handled by the configured InsufficientCorrelationMode.
+func (a *Analyzer) applyCorrelation(analysis *models.PairAnalysis, correlationMetrics CorrelationMetrics, err error,
+	criteria models.SelectionCriteria) bool {
+
+	switch {
+	case analysis.CorrelationSelf:
+		// Scored without correlation, like a pair with too little data
+	case errors.Is(err, ErrInsufficientCorrelationData):
+		switch criteria.InsufficientCorrelationMode {
+		case models.InsufficientCorrelationSkip:
+			a.logger.WithField("symbol", analysis.Symbol).Debug("Skipping pair until correlation data is backfilled")
+			return false
+		case models.InsufficientCorrelationDefault:
+			// Scored with UnknownCorrelationDefault like any other failure
+		default:
+			analysis.CorrelationThin = true
+		}
+	case err != nil:
+		a.logger.WithError(err).WithField("symbol", analysis.Symbol).Warn("Failed to analyze correlation")
+	default:
 		analysis.CorrelationBTC = correlationMetrics.Correlation
+		analysis.CorrelationKnown = true
 	}
 
+	return true
+}
+
+// scoreAnalysis fills in the component scores, the final score and the risk
+// level of an analyzed pair
+func (a *Analyzer) scoreAnalysis(analysis *models.PairAnalysis, criteria models.SelectionCriteria) {
 	// Calculate individual scores
-	analysis.VolumeScore = a.scorer.CalculateVolumeScore(analysis.Volume24hUSDT, criteria.MinVolumeUSDT)
+	analysis.VolumeScore = a.scorer.CalculateVolumeScore(analysis.Volume24hUSDT, criteria.MinVolumeUSDT, analysis.VolumeConsistency)
 	analysis.VolatilityScore = a.scorer.CalculateVolatilityScore(analysis.Volatility, criteria.MinVolatility, criteria.MaxVolatility)
 	analysis.ATRScore = a.scorer.CalculateATRScore(analysis.ATR14)
-	analysis.CorrelationScore = a.scorer.CalculateCorrelationScore(analysis.CorrelationBTC)
+	analysis.ExpectedEdge, analysis.EdgeScore = a.expectedEdge(*analysis, criteria)
+	if !analysis.CorrelationExcluded() {
+		analysis.CorrelationScore = a.scorer.CalculateCorrelationScore(effectiveCorrelation(*analysis, criteria))
+	}
 
 	// Calculate final weighted score
-	analysis.FinalScore = a.scorer.CalculateFinalScore(analysis, criteria)
+	analysis.FinalScore = a.scorer.CalculateFinalScore(*analysis, criteria)
 
 	// Determine risk level
-	analysis.RiskLevel = a.determineRiskLevel(analysis)
+	analysis.RiskLevel = a.determineRiskLevel(*analysis, criteria)
+}
 
-	// Update trading pair metrics in database
-	metrics := map[string]float64{
-		"volume_usdt":     analysis.Volume24hUSDT,
-		"volatility":      analysis.Volatility,
-		"atr_14":          analysis.ATR14,
-		"correlation_btc": analysis.CorrelationBTC,
+// expectedEdge is the pair's ATR relative to its last close minus the cost of
+// a round trip: crossing the average spread plus paying the fee on both
+// sides. Without collected spreads only the fees are counted.
+func (a *Analyzer) expectedEdge(analysis models.PairAnalysis, criteria models.SelectionCriteria) (float64, float64) {
+	if len(analysis.PriceData) == 0 {
+		return 0, 0
 	}
 
-	if err := a.repo.UpdateTradingPairMetrics(ctx, pair.Symbol, metrics); err != nil {
-		a.logger.WithError(err).WithField("symbol", pair.Symbol).Warn("Failed to update pair metrics")
+	lastClose := analysis.PriceData[len(analysis.PriceData)-1].Close
+	if lastClose <= 0 {
+		return 0, 0
 	}
 
-	return &analysis, nil
+	atrPercent := analysis.ATR14 / lastClose
+	roundTripCost := analysis.AvgSpread + 2*criteria.FeeRate
+
+	return atrPercent - roundTripCost, a.scorer.CalculateEdgeScore(atrPercent, roundTripCost)
 }
 
-func (a *Analyzer) determineRiskLevel(analysis models.PairAnalysis) string {
-	// Risk assessment based on volatility and correlation
-	if analysis.Volatility > 0.06 || analysis.CorrelationBTC < 0.3 {
+func (a *Analyzer) determineRiskLevel(analysis models.PairAnalysis, criteria models.SelectionCriteria) string {
+	correlation := effectiveCorrelation(analysis, criteria)
+	if analysis.CorrelationExcluded() {
+		correlation = 1 // Not meaningful, so risk rests on volatility alone
+	}
+
+	// A wide spread makes entries and exits expensive regardless of how the
+	// price behaves
+	spreadHigh, spreadMedium := false, false
+	if criteria.HighRiskSpread > 0 {
+		spreadHigh = analysis.AvgSpread > criteria.HighRiskSpread
+		spreadMedium = analysis.AvgSpread > criteria.HighRiskSpread/2
+	}
+
+	// Risk assessment based on volatility, correlation and liquidity
+	if analysis.Volatility > 0.06 || correlation < 0.3 || spreadHigh {
 		return "high"
-	} else if analysis.Volatility > 0.04 || analysis.CorrelationBTC < 0.6 {
+	} else if analysis.Volatility > 0.04 || correlation < 0.6 || spreadMedium {
 		return "medium"
 	}
 	return "low"
 }
 
+// effectiveCorrelation returns the measured BTC correlation, or the configured
+// neutral default when it could not be measured, so a data failure is not
+// mistaken for a genuinely uncorrelated (high risk) pair
+func effectiveCorrelation(analysis models.PairAnalysis, criteria models.SelectionCriteria) float64 {
+	if analysis.CorrelationKnown {
+		return analysis.CorrelationBTC
+	}
+	return criteria.UnknownCorrelationDefault
+}
+
 func (a *Analyzer) SelectTopPairs(analyses []models.PairAnalysis, maxPairs int) []models.PairAnalysis {
 	if len(analyses) <= maxPairs {
 		return analyses
@@ -227,3 +379,14 @@ func (a *Analyzer) SelectTopPairs(analyses []models.PairAnalysis, maxPairs int)
 
 	return selected
 }
+
+// otherReferences returns the correlation references other than the symbol
+func otherReferences(references []string, symbol string) []string {
+	others := make([]string, 0, len(references))
+	for _, reference := range references {
+		if reference != symbol {
+			others = append(others, reference)
+		}
+	}
+	return others
+}
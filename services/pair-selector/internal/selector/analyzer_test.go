@@ -0,0 +1,312 @@
+package selector
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/pkg/models"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+)
+
+func TestUnknownVersusZeroCorrelation(t *testing.T) {
+	criteria := models.SelectionCriteria{UnknownCorrelationDefault: 0.5}
+	a := &Analyzer{scorer: NewScorer(utils.NewDiscardLogger()), logger: utils.NewDiscardLogger()}
+
+	tests := []struct {
+		name            string
+		analysis        models.PairAnalysis
+		wantCorrelation float64
+		wantRisk        string
+	}{
+		{
+			name:            "measured zero correlation is high risk",
+			analysis:        models.PairAnalysis{Volatility: 0.03, CorrelationBTC: 0, CorrelationKnown: true},
+			wantCorrelation: 0,
+			wantRisk:        "high",
+		},
+		{
+			name:            "unknown correlation uses the neutral default",
+			analysis:        models.PairAnalysis{Volatility: 0.03, CorrelationKnown: false},
+			wantCorrelation: 0.5,
+			wantRisk:        "medium",
+		},
+		{
+			name:            "measured correlation is used as is",
+			analysis:        models.PairAnalysis{Volatility: 0.03, CorrelationBTC: 0.8, CorrelationKnown: true},
+			wantCorrelation: 0.8,
+			wantRisk:        "low",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := effectiveCorrelation(tt.analysis, criteria); got != tt.wantCorrelation {
+				t.Errorf("effectiveCorrelation() = %v, want %v", got, tt.wantCorrelation)
+			}
+			if got := a.determineRiskLevel(tt.analysis, criteria); got != tt.wantRisk {
+				t.Errorf("determineRiskLevel() = %s, want %s", got, tt.wantRisk)
+			}
+		})
+	}
+}
+
+func TestUnknownCorrelationScoresAboveZero(t *testing.T) {
+	criteria := models.SelectionCriteria{UnknownCorrelationDefault: 0.5}
+	scorer := NewScorer(utils.NewDiscardLogger())
+
+	unknown := scorer.CalculateCorrelationScore(effectiveCorrelation(models.PairAnalysis{}, criteria))
+	zero := scorer.CalculateCorrelationScore(effectiveCorrelation(models.PairAnalysis{CorrelationKnown: true}, criteria))
+
+	if unknown <= zero {
+		t.Fatalf("unknown correlation scores %v, want above the %v of a measured zero", unknown, zero)
+	}
+}
+
+func testPairs(n int) []models.TradingPair {
+	pairs := make([]models.TradingPair, n)
+	for i := range pairs {
+		pairs[i] = models.TradingPair{Symbol: fmt.Sprintf("PAIR%03d-USDT", i)}
+	}
+	return pairs
+}
+
+// scoreOf gives pairs a handful of distinct scores so ranking has ties
+func scoreOf(i int) float64 {
+	return float64(i%7) / 10
+}
+
+func TestAnalyzePairsConcurrently(t *testing.T) {
+	pairs := testPairs(60)
+
+	var inFlight, maxInFlight int32
+	var mu sync.Mutex
+	analyzed := make(map[string]int)
+
+	analyze := func(pair models.TradingPair) (*models.PairAnalysis, error) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			seen := atomic.LoadInt32(&maxInFlight)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+				break
+			}
+		}
+
+		mu.Lock()
+		analyzed[pair.Symbol]++
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		var i int
+		fmt.Sscanf(pair.Symbol, "PAIR%03d-USDT", &i)
+		switch {
+		case i%10 == 3:
+			return nil, errors.New("price history unavailable")
+		case i%10 == 5:
+			return nil, nil // Insufficient data
+		}
+		return &models.PairAnalysis{Symbol: pair.Symbol, FinalScore: scoreOf(i)}, nil
+	}
+
+	sequential := &Analyzer{workers: 1, logger: utils.NewDiscardLogger()}
+	want := rankAnalyses(sequential.analyzeConcurrently(pairs, analyze), 20)
+
+	for _, workers := range []int{1, 4, 16} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			atomic.StoreInt32(&maxInFlight, 0)
+			mu.Lock()
+			analyzed = make(map[string]int)
+			mu.Unlock()
+
+			a := &Analyzer{workers: workers, logger: utils.NewDiscardLogger()}
+			analyses := a.analyzeConcurrently(pairs, analyze)
+
+			if len(analyzed) != len(pairs) {
+				t.Fatalf("analyzed %d pairs, want %d", len(analyzed), len(pairs))
+			}
+			for symbol, count := range analyzed {
+				if count != 1 {
+					t.Errorf("%s analyzed %d times, want once", symbol, count)
+				}
+			}
+			if got := atomic.LoadInt32(&maxInFlight); got > int32(workers) {
+				t.Errorf("%d pairs analyzed at once, want at most %d", got, workers)
+			}
+			if len(analyses) != 48 {
+				t.Fatalf("kept %d analyses, want 48 without the failed and skipped pairs", len(analyses))
+			}
+
+			got := rankAnalyses(analyses, 20)
+			if len(got) != len(want) {
+				t.Fatalf("ranked %d analyses, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if got[i].Symbol != want[i].Symbol {
+					t.Fatalf("rank %d = %s, want %s as with sequential analysis", i, got[i].Symbol, want[i].Symbol)
+				}
+			}
+		})
+	}
+}
+
+func TestRankAnalysesKeepsTiesInInputOrder(t *testing.T) {
+	analyses := []models.PairAnalysis{
+		{Symbol: "A", FinalScore: 0.5},
+		{Symbol: "B", FinalScore: 0.9},
+		{Symbol: "C", FinalScore: 0.5},
+		{Symbol: "D", FinalScore: 0.7},
+		{Symbol: "E", FinalScore: 0.5},
+	}
+
+	got := rankAnalyses(analyses, 4)
+
+	want := []string{"B", "D", "A", "C"}
+	if len(got) != len(want) {
+		t.Fatalf("rankAnalyses() returned %d analyses, want %d", len(got), len(want))
+	}
+	for i, symbol := range want {
+		if got[i].Symbol != symbol {
+			t.Errorf("rank %d = %s, want %s", i, got[i].Symbol, symbol)
+		}
+	}
+}
+
+func TestInsufficientCorrelationDataScoresNeutral(t *testing.T) {
+	criteria := models.SelectionCriteria{
+		MinVolumeUSDT:             1_000_000,
+		MinVolatility:             0.02,
+		MaxVolatility:             0.08,
+		VolumeWeight:              0.3,
+		VolatilityWeight:          0.3,
+		ATRWeight:                 0.2,
+		CorrelationWeight:         0.2,
+		UnknownCorrelationDefault: 0.5,
+	}
+	insufficient := fmt.Errorf("SOL-USDT vs BTC-USDT has 4 points: %w", ErrInsufficientCorrelationData)
+
+	pair := func() models.PairAnalysis {
+		return models.PairAnalysis{Symbol: "SOL-USDT", Volume24hUSDT: 5_000_000, VolumeConsistency: 0.8, Volatility: 0.03, ATR14: 0.5}
+	}
+	a := &Analyzer{scorer: NewScorer(utils.NewDiscardLogger()), logger: utils.NewDiscardLogger()}
+
+	// The same pair with a measured zero correlation, which is high risk
+	zero := pair()
+	a.applyCorrelation(&zero, CorrelationMetrics{Correlation: 0}, nil, criteria)
+	a.scoreAnalysis(&zero, criteria)
+	if zero.RiskLevel != "high" {
+		t.Fatalf("measured zero correlation risk = %s, want high", zero.RiskLevel)
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		wantKept bool
+		wantThin bool
+		wantRisk string
+	}{
+		{name: "neutral by default", mode: "", wantKept: true, wantThin: true, wantRisk: "low"},
+		{name: "neutral", mode: models.InsufficientCorrelationNeutral, wantKept: true, wantThin: true, wantRisk: "low"},
+		{name: "assumed default correlation", mode: models.InsufficientCorrelationDefault, wantKept: true, wantRisk: "medium"},
+		{name: "skipped until backfilled", mode: models.InsufficientCorrelationSkip, wantKept: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			criteria := criteria
+			criteria.InsufficientCorrelationMode = tt.mode
+
+			analysis := pair()
+			kept := a.applyCorrelation(&analysis, CorrelationMetrics{}, insufficient, criteria)
+			if kept != tt.wantKept {
+				t.Fatalf("applyCorrelation() = %v, want %v", kept, tt.wantKept)
+			}
+			if !kept {
+				return
+			}
+
+			a.scoreAnalysis(&analysis, criteria)
+
+			if analysis.CorrelationKnown {
+				t.Error("CorrelationKnown = true for a correlation that was not measured")
+			}
+			if analysis.CorrelationThin != tt.wantThin {
+				t.Errorf("CorrelationThin = %v, want %v", analysis.CorrelationThin, tt.wantThin)
+			}
+			if analysis.RiskLevel != tt.wantRisk {
+				t.Errorf("risk = %s, want %s", analysis.RiskLevel, tt.wantRisk)
+			}
+			if analysis.FinalScore <= zero.FinalScore {
+				t.Errorf("final score %v, want above the %v of a measured zero correlation", analysis.FinalScore, zero.FinalScore)
+			}
+
+			if tt.wantThin {
+				others := criteria.VolumeWeight + criteria.VolatilityWeight + criteria.ATRWeight
+				want := (analysis.VolumeScore*criteria.VolumeWeight + analysis.VolatilityScore*criteria.VolatilityWeight +
+					analysis.ATRScore*criteria.ATRWeight) / others
+				if math.Abs(analysis.FinalScore-want) > 1e-9 {
+					t.Errorf("final score %v, want %v with the correlation weight redistributed", analysis.FinalScore, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReferencePairScoredWithoutSelfCorrelation(t *testing.T) {
+	criteria := models.SelectionCriteria{
+		MinVolumeUSDT:             1_000_000,
+		MinVolatility:             0.02,
+		MaxVolatility:             0.08,
+		VolumeWeight:              0.3,
+		VolatilityWeight:          0.3,
+		ATRWeight:                 0.2,
+		CorrelationWeight:         0.2,
+		CorrelationReference:      "BTC-USDT",
+		UnknownCorrelationDefault: 0.5,
+	}
+	a := &Analyzer{scorer: NewScorer(utils.NewDiscardLogger()), logger: utils.NewDiscardLogger()}
+
+	if others := otherReferences(criteria.CorrelationReferences(), "BTC-USDT"); len(others) != 0 {
+		t.Fatalf("BTC-USDT correlated against %v, want no reference but itself", others)
+	}
+	if others := otherReferences([]string{"BTC-USDT", "ETH-USDT"}, "BTC-USDT"); len(others) != 1 || others[0] != "ETH-USDT" {
+		t.Fatalf("BTC-USDT correlated against %v, want only ETH-USDT", others)
+	}
+
+	pair := func() models.PairAnalysis {
+		return models.PairAnalysis{Symbol: "BTC-USDT", Volume24hUSDT: 5_000_000, VolumeConsistency: 0.8, Volatility: 0.03, ATR14: 0.5}
+	}
+
+	// What the pair would score correlated with itself
+	selfCorrelated := pair()
+	a.applyCorrelation(&selfCorrelated, CorrelationMetrics{Correlation: 1}, nil, criteria)
+	a.scoreAnalysis(&selfCorrelated, criteria)
+
+	reference := pair()
+	reference.CorrelationSelf = true
+	if !a.applyCorrelation(&reference, CorrelationMetrics{}, nil, criteria) {
+		t.Fatal("applyCorrelation() dropped the reference pair")
+	}
+	a.scoreAnalysis(&reference, criteria)
+
+	if reference.CorrelationKnown || reference.CorrelationScore != 0 {
+		t.Errorf("correlation known/score = %v/%v, want it left out", reference.CorrelationKnown, reference.CorrelationScore)
+	}
+	others := criteria.VolumeWeight + criteria.VolatilityWeight + criteria.ATRWeight
+	want := (reference.VolumeScore*criteria.VolumeWeight + reference.VolatilityScore*criteria.VolatilityWeight +
+		reference.ATRScore*criteria.ATRWeight) / others
+	if math.Abs(reference.FinalScore-want) > 1e-9 {
+		t.Errorf("final score %v, want %v from the other components alone", reference.FinalScore, want)
+	}
+	if reference.FinalScore == selfCorrelated.FinalScore {
+		t.Errorf("final score %v matches the self-correlated score, want the self-correlation ignored", reference.FinalScore)
+	}
+	if reference.RiskLevel != "low" {
+		t.Errorf("risk = %s, want low from the in-range volatility alone", reference.RiskLevel)
+	}
+}
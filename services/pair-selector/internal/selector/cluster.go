@@ -0,0 +1,98 @@
+package selector
+
+import (
+	"context"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// clusterWindowHours is the history used for the watchlist correlation
+// matrix, matching the window of the per-pair analysis
+const clusterWindowHours = 24
+
+// DiversifyByCluster groups the analyzed pairs into clusters of positively
+// correlated pairs and keeps only the best scoring MaxPairsPerCluster of each,
+// so the active set is not several bets on the same move. Analyses must be
+// sorted by score. Clustering is disabled when the threshold is not positive,
+// and a failure to build the matrix leaves the analyses unchanged.
+func (a *Analyzer) DiversifyByCluster(ctx context.Context, analyses []models.PairAnalysis, criteria models.SelectionCriteria) []models.PairAnalysis {
+	if criteria.ClusterCorrelationThreshold <= 0 || len(analyses) < 2 {
+		return analyses
+	}
+
+	symbols := make([]string, len(analyses))
+	for i, analysis := range analyses {
+		symbols[i] = analysis.Symbol
+	}
+
+	matrix, err := a.correlationAnalyzer.ComputeCorrelationMatrix(ctx, symbols, clusterWindowHours)
+	if err != nil {
+		a.logger.WithError(err).Warn("Failed to compute correlation matrix, selecting without clustering")
+		return analyses
+	}
+
+	clusters := clusterSymbols(symbols, matrix, criteria.ClusterCorrelationThreshold)
+
+	perCluster := criteria.MaxPairsPerCluster
+	if perCluster < 1 {
+		perCluster = 1
+	}
+
+	kept := make(map[int]int)
+	var diversified []models.PairAnalysis
+	for _, analysis := range analyses {
+		cluster := clusters[analysis.Symbol]
+		if kept[cluster] >= perCluster {
+			a.logger.WithFields(logrus.Fields{
+				"symbol":  analysis.Symbol,
+				"cluster": cluster,
+			}).Debug("Dropping pair correlated with higher scoring pairs")
+			continue
+		}
+		kept[cluster]++
+		diversified = append(diversified, analysis)
+	}
+
+	a.logger.WithFields(logrus.Fields{
+		"candidates": len(analyses),
+		"clusters":   len(kept),
+		"kept":       len(diversified),
+		"threshold":  criteria.ClusterCorrelationThreshold,
+	}).Info("Diversified candidates by correlation cluster")
+
+	return diversified
+}
+
+// clusterSymbols assigns each symbol a cluster id, joining any two symbols
+// whose correlation is at least threshold (single linkage). Pairs missing
+// from the matrix are treated as unrelated.
+func clusterSymbols(symbols []string, matrix map[string]map[string]float64, threshold float64) map[string]int {
+	parent := make([]int, len(symbols))
+	for i := range parent {
+		parent[i] = i
+	}
+
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := 0; i < len(symbols); i++ {
+		for j := i + 1; j < len(symbols); j++ {
+			correlation, ok := matrix[symbols[i]][symbols[j]]
+			if ok && correlation >= threshold {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	clusters := make(map[string]int, len(symbols))
+	for i, symbol := range symbols {
+		clusters[symbol] = find(i)
+	}
+	return clusters
+}
@@ -2,7 +2,11 @@ package selector
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/internal/database"
 	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/pkg/models"
@@ -10,9 +14,34 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// minAlignedPoints is the number of common timestamps needed for a
+// meaningful correlation
+const minAlignedPoints = 10
+
+// ErrInsufficientCorrelationData is returned when the two series share too
+// few timestamps to correlate, as opposed to a failure loading the data
+var ErrInsufficientCorrelationData = errors.New("insufficient aligned data points for correlation")
+
+// priceHistorySource loads the closes correlations are computed from
+type priceHistorySource interface {
+	GetPriceHistory(ctx context.Context, symbol string, hours int) ([]models.PricePoint, error)
+}
+
 type CorrelationAnalyzer struct {
-	repo   *database.Repository
-	logger *logrus.Logger
+	repo      priceHistorySource
+	matrixTTL time.Duration // How long a computed pairwise correlation is reused
+	logger    *logrus.Logger
+
+	mu    sync.Mutex
+	cache map[string]cachedCorrelation
+}
+
+// cachedCorrelation is one matrix cell; ok is false when the two series
+// shared too few timestamps, so the gap is not re-queried every cycle either
+type cachedCorrelation struct {
+	value      float64
+	ok         bool
+	computedAt time.Time
 }
 
 type CorrelationMetrics struct {
@@ -20,10 +49,12 @@ type CorrelationMetrics struct {
 	Strength    string
 }
 
-func NewCorrelationAnalyzer(repo *database.Repository, logger *logrus.Logger) *CorrelationAnalyzer {
+func NewCorrelationAnalyzer(repo *database.Repository, matrixTTL time.Duration, logger *logrus.Logger) *CorrelationAnalyzer {
 	return &CorrelationAnalyzer{
-		repo:   repo,
-		logger: logger,
+		repo:      repo,
+		matrixTTL: matrixTTL,
+		logger:    logger,
+		cache:     make(map[string]cachedCorrelation),
 	}
 }
 
@@ -42,14 +73,14 @@ func (c *CorrelationAnalyzer) AnalyzeCorrelation(ctx context.Context, symbol1, s
 	// Align price data by timestamps
 	aligned1, aligned2 := c.alignPriceData(prices1, prices2)
 
-	if len(aligned1) < 10 || len(aligned2) < 10 {
+	if len(aligned1) < minAlignedPoints || len(aligned2) < minAlignedPoints {
 		c.logger.WithFields(logrus.Fields{
 			"symbol1": symbol1,
 			"symbol2": symbol2,
 			"points1": len(aligned1),
 			"points2": len(aligned2),
-		}).Warn("Insufficient data points for correlation analysis")
-		return CorrelationMetrics{}, fmt.Errorf("insufficient data points")
+		}).Debug("Insufficient data points for correlation analysis")
+		return CorrelationMetrics{}, fmt.Errorf("%s vs %s has %d points: %w", symbol1, symbol2, len(aligned1), ErrInsufficientCorrelationData)
 	}
 
 	// Calculate correlation coefficient
@@ -64,6 +95,46 @@ func (c *CorrelationAnalyzer) AnalyzeCorrelation(ctx context.Context, symbol1, s
 	}, nil
 }
 
+// AnalyzeReferenceCorrelation averages the symbol's correlation to each
+// reference. References that cannot be measured are left out of the average;
+// when none can, the error of the first is returned, so a shortage of aligned
+// data stays recognizable.
+func (c *CorrelationAnalyzer) AnalyzeReferenceCorrelation(ctx context.Context, symbol string, references []string, hours int) (CorrelationMetrics, error) {
+	total, measured := 0.0, 0
+	var firstErr error
+	for _, reference := range references {
+		metrics, err := c.AnalyzeCorrelation(ctx, symbol, reference, hours)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		total += metrics.Correlation
+		measured++
+	}
+
+	if measured == 0 {
+		if firstErr == nil {
+			firstErr = errors.New("no correlation reference to measure against")
+		}
+		return CorrelationMetrics{}, firstErr
+	}
+	if measured < len(references) {
+		c.logger.WithFields(logrus.Fields{
+			"symbol":     symbol,
+			"references": len(references),
+			"measured":   measured,
+		}).WithError(firstErr).Debug("Correlation averaged over the measurable references")
+	}
+
+	correlation := total / float64(measured)
+	return CorrelationMetrics{
+		Correlation: correlation,
+		Strength:    c.determineCorrelationStrength(correlation),
+	}, nil
+}
+
 func (c *CorrelationAnalyzer) alignPriceData(prices1, prices2 []models.PricePoint) ([]float64, []float64) {
 	// Create maps for quick lookup
 	priceMap1 := make(map[int64]float64)
@@ -92,6 +163,149 @@ func (c *CorrelationAnalyzer) alignPriceData(prices1, prices2 []models.PricePoin
 	return aligned1, aligned2
 }
 
+// ComputeCorrelationMatrix returns the pairwise correlation of returns for
+// every two symbols. Each symbol's history is loaded and turned into a return
+// series once, and cells computed within the matrix TTL are reused, so only
+// new or expired pairs are recomputed. Pairs with too few common timestamps
+// are left out of the matrix; every symbol correlates 1 with itself.
+func (c *CorrelationAnalyzer) ComputeCorrelationMatrix(ctx context.Context, symbols []string, hours int) (map[string]map[string]float64, error) {
+	matrix := make(map[string]map[string]float64, len(symbols))
+	for _, symbol := range symbols {
+		matrix[symbol] = map[string]float64{symbol: 1}
+	}
+
+	now := time.Now()
+	c.evictExpired(now)
+
+	returns := make(map[string]map[int64]float64)
+	computed := 0
+
+	for i := 0; i < len(symbols); i++ {
+		for j := i + 1; j < len(symbols); j++ {
+			a, b := symbols[i], symbols[j]
+			key := matrixKey(a, b, hours)
+
+			cell, ok := c.cachedCell(key, now)
+			if !ok {
+				for _, symbol := range []string{a, b} {
+					if _, loaded := returns[symbol]; loaded {
+						continue
+					}
+					prices, err := c.repo.GetPriceHistory(ctx, symbol, hours)
+					if err != nil {
+						return nil, fmt.Errorf("failed to get price history for %s: %w", symbol, err)
+					}
+					returns[symbol] = returnSeries(prices)
+				}
+
+				cell = correlateReturns(returns[a], returns[b])
+				cell.computedAt = now
+				c.storeCell(key, cell)
+				computed++
+			}
+
+			if cell.ok {
+				matrix[a][b] = cell.value
+				matrix[b][a] = cell.value
+			}
+		}
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"symbols":        len(symbols),
+		"computed_pairs": computed,
+		"loaded_series":  len(returns),
+	}).Debug("Computed correlation matrix")
+
+	return matrix, nil
+}
+
+func (c *CorrelationAnalyzer) cachedCell(key string, now time.Time) (cachedCorrelation, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cell, ok := c.cache[key]
+	if !ok || now.Sub(cell.computedAt) >= c.matrixTTL {
+		return cachedCorrelation{}, false
+	}
+	return cell, true
+}
+
+func (c *CorrelationAnalyzer) storeCell(key string, cell cachedCorrelation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cache[key] = cell
+}
+
+// evictExpired drops expired cells so pairs of symbols that left the
+// watchlist do not accumulate
+func (c *CorrelationAnalyzer) evictExpired(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, cell := range c.cache {
+		if now.Sub(cell.computedAt) >= c.matrixTTL {
+			delete(c.cache, key)
+		}
+	}
+}
+
+// matrixKey identifies a pair independent of argument order
+func matrixKey(a, b string, hours int) string {
+	if a > b {
+		a, b = b, a
+	}
+	return fmt.Sprintf("%s|%s|%d", a, b, hours)
+}
+
+// returnSeries converts closes into period returns keyed by the timestamp of
+// the later close. Returns rather than raw prices are correlated so two
+// trending assets are not reported as related merely for trending.
+func returnSeries(prices []models.PricePoint) map[int64]float64 {
+	sorted := append([]models.PricePoint(nil), prices...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	series := make(map[int64]float64, len(sorted))
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i-1].Close <= 0 {
+			continue
+		}
+		series[sorted[i].Timestamp.Unix()] = (sorted[i].Close - sorted[i-1].Close) / sorted[i-1].Close
+	}
+	return series
+}
+
+// correlateReturns correlates two return series on their common timestamps
+func correlateReturns(series1, series2 map[int64]float64) cachedCorrelation {
+	timestamps := make([]int64, 0, len(series1))
+	for timestamp := range series1 {
+		if _, exists := series2[timestamp]; exists {
+			timestamps = append(timestamps, timestamp)
+		}
+	}
+
+	if len(timestamps) < minAlignedPoints {
+		return cachedCorrelation{}
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	aligned1 := make([]float64, len(timestamps))
+	aligned2 := make([]float64, len(timestamps))
+	for i, timestamp := range timestamps {
+		aligned1[i] = series1[timestamp]
+		aligned2[i] = series2[timestamp]
+	}
+
+	return cachedCorrelation{
+		value: utils.CalculateCorrelation(aligned1, aligned2),
+		ok:    true,
+	}
+}
+
 func (c *CorrelationAnalyzer) determineCorrelationStrength(correlation float64) string {
 	absCorr := correlation
 	if correlation < 0 {
@@ -0,0 +1,235 @@
+package selector
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/pkg/models"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+)
+
+// fakeHistory serves fixed price series and counts the loads per symbol
+type fakeHistory struct {
+	mu     sync.Mutex
+	prices map[string][]models.PricePoint
+	loads  map[string]int
+}
+
+func (f *fakeHistory) GetPriceHistory(_ context.Context, symbol string, _ int) ([]models.PricePoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.loads[symbol]++
+	return f.prices[symbol], nil
+}
+
+func (f *fakeHistory) totalLoads() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	total := 0
+	for _, n := range f.loads {
+		total += n
+	}
+	return total
+}
+
+// pricesFromReturns compounds the returns onto a starting close of 100, one
+// point per hour
+func pricesFromReturns(start time.Time, returns []float64) []models.PricePoint {
+	prices := []models.PricePoint{{Timestamp: start, Close: 100}}
+	for i, r := range returns {
+		prices = append(prices, models.PricePoint{
+			Timestamp: start.Add(time.Duration(i+1) * time.Hour),
+			Close:     prices[i].Close * (1 + r),
+		})
+	}
+	return prices
+}
+
+func scaled(returns []float64, factor float64) []float64 {
+	out := make([]float64, len(returns))
+	for i, r := range returns {
+		out[i] = r * factor
+	}
+	return out
+}
+
+// knownHistory has BTC, ETH moving as twice BTC, XRP moving against BTC and
+// NEW with too little history to correlate
+func knownHistory() *fakeHistory {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	base := []float64{0.01, -0.02, 0.015, 0.005, -0.01, 0.02, -0.005, 0.012, -0.018, 0.007, 0.003, -0.009}
+
+	return &fakeHistory{
+		prices: map[string][]models.PricePoint{
+			"BTC-USDT": pricesFromReturns(start, base),
+			"ETH-USDT": pricesFromReturns(start, scaled(base, 2)),
+			"XRP-USDT": pricesFromReturns(start, scaled(base, -1)),
+			"NEW-USDT": pricesFromReturns(start, base[:4]),
+		},
+		loads: make(map[string]int),
+	}
+}
+
+func TestComputeCorrelationMatrixKnownSet(t *testing.T) {
+	history := knownHistory()
+	c := NewCorrelationAnalyzer(nil, time.Hour, utils.NewDiscardLogger())
+	c.repo = history
+
+	symbols := []string{"BTC-USDT", "ETH-USDT", "XRP-USDT", "NEW-USDT"}
+	matrix, err := c.ComputeCorrelationMatrix(context.Background(), symbols, 24)
+	if err != nil {
+		t.Fatalf("ComputeCorrelationMatrix() error = %v", err)
+	}
+
+	want := map[string]map[string]float64{
+		"BTC-USDT": {"BTC-USDT": 1, "ETH-USDT": 1, "XRP-USDT": -1},
+		"ETH-USDT": {"ETH-USDT": 1, "BTC-USDT": 1, "XRP-USDT": -1},
+		"XRP-USDT": {"XRP-USDT": 1, "BTC-USDT": -1, "ETH-USDT": -1},
+		"NEW-USDT": {"NEW-USDT": 1},
+	}
+	for symbol, row := range want {
+		if len(matrix[symbol]) != len(row) {
+			t.Errorf("row %s = %v, want %v", symbol, matrix[symbol], row)
+			continue
+		}
+		for other, value := range row {
+			got, ok := matrix[symbol][other]
+			if !ok || math.Abs(got-value) > 1e-9 {
+				t.Errorf("matrix[%s][%s] = %v (present %v), want %v", symbol, other, got, ok, value)
+			}
+		}
+	}
+
+	// Each series is loaded once however many pairs it is part of
+	for _, symbol := range symbols {
+		if n := history.loads[symbol]; n != 1 {
+			t.Errorf("%s loaded %d times, want 1", symbol, n)
+		}
+	}
+}
+
+func TestComputeCorrelationMatrixReusesCachedCells(t *testing.T) {
+	symbols := []string{"BTC-USDT", "ETH-USDT", "XRP-USDT"}
+
+	tests := []struct {
+		name            string
+		ttl             time.Duration
+		wantSecondLoads int
+	}{
+		{name: "within the TTL nothing is reloaded", ttl: time.Hour, wantSecondLoads: 0},
+		{name: "expired cells are recomputed", ttl: 0, wantSecondLoads: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := knownHistory()
+			c := NewCorrelationAnalyzer(nil, tt.ttl, utils.NewDiscardLogger())
+			c.repo = history
+
+			first, err := c.ComputeCorrelationMatrix(context.Background(), symbols, 24)
+			if err != nil {
+				t.Fatalf("first ComputeCorrelationMatrix() error = %v", err)
+			}
+			loaded := history.totalLoads()
+
+			second, err := c.ComputeCorrelationMatrix(context.Background(), symbols, 24)
+			if err != nil {
+				t.Fatalf("second ComputeCorrelationMatrix() error = %v", err)
+			}
+
+			if got := history.totalLoads() - loaded; got != tt.wantSecondLoads {
+				t.Errorf("second cycle loaded %d series, want %d", got, tt.wantSecondLoads)
+			}
+			if math.Abs(first["BTC-USDT"]["XRP-USDT"]-second["BTC-USDT"]["XRP-USDT"]) > 1e-12 {
+				t.Errorf("cached cell %v differs from computed %v", second["BTC-USDT"]["XRP-USDT"], first["BTC-USDT"]["XRP-USDT"])
+			}
+		})
+	}
+}
+
+func TestClusterSymbolsFromMatrix(t *testing.T) {
+	symbols := []string{"BTC-USDT", "ETH-USDT", "SOL-USDT", "XRP-USDT"}
+	matrix := map[string]map[string]float64{
+		"BTC-USDT": {"ETH-USDT": 0.9, "SOL-USDT": 0.3, "XRP-USDT": -0.8},
+		"ETH-USDT": {"BTC-USDT": 0.9, "SOL-USDT": 0.75},
+		"SOL-USDT": {"BTC-USDT": 0.3, "ETH-USDT": 0.75},
+		"XRP-USDT": {"BTC-USDT": -0.8},
+	}
+
+	clusters := clusterSymbols(symbols, matrix, 0.7)
+
+	// SOL joins through ETH; anti-correlation does not cluster
+	if clusters["BTC-USDT"] != clusters["ETH-USDT"] || clusters["ETH-USDT"] != clusters["SOL-USDT"] {
+		t.Errorf("clusters = %v, want BTC, ETH and SOL together", clusters)
+	}
+	if clusters["XRP-USDT"] == clusters["BTC-USDT"] {
+		t.Errorf("clusters = %v, want XRP on its own", clusters)
+	}
+}
+
+func TestAnalyzeReferenceCorrelation(t *testing.T) {
+	ctx := context.Background()
+	c := NewCorrelationAnalyzer(nil, time.Hour, utils.NewDiscardLogger())
+	c.repo = knownHistory()
+	single := make(map[string]float64)
+	for _, reference := range []string{"BTC-USDT", "XRP-USDT"} {
+		metrics, err := c.AnalyzeCorrelation(ctx, "ETH-USDT", reference, 24)
+		if err != nil {
+			t.Fatalf("AnalyzeCorrelation() against %s error = %v", reference, err)
+		}
+		single[reference] = metrics.Correlation
+	}
+	// ETH follows BTC and moves against XRP
+	if single["BTC-USDT"] < 0.9 || single["XRP-USDT"] > -0.9 {
+		t.Fatalf("single correlations = %v, want about 1 and -1", single)
+	}
+
+	tests := []struct {
+		name       string
+		references []string
+		want       float64
+		wantErr    error
+	}{
+		{name: "single reference", references: []string{"BTC-USDT"}, want: single["BTC-USDT"]},
+		{name: "averaged over references", references: []string{"BTC-USDT", "XRP-USDT"}, want: (single["BTC-USDT"] + single["XRP-USDT"]) / 2},
+		{name: "unmeasurable reference left out", references: []string{"NEW-USDT", "XRP-USDT"}, want: single["XRP-USDT"]},
+		{name: "no measurable reference", references: []string{"NEW-USDT"}, wantErr: ErrInsufficientCorrelationData},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := c.AnalyzeReferenceCorrelation(ctx, "ETH-USDT", tt.references, 24)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AnalyzeReferenceCorrelation() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && math.Abs(metrics.Correlation-tt.want) > 1e-9 {
+				t.Errorf("correlation = %v, want %v", metrics.Correlation, tt.want)
+			}
+		})
+	}
+}
+
+func TestCorrelationReferencesParsed(t *testing.T) {
+	tests := []struct {
+		reference string
+		want      []string
+	}{
+		{reference: "BTC-USDT", want: []string{"BTC-USDT"}},
+		{reference: " BTC-USDT, ETH-USDT ,,", want: []string{"BTC-USDT", "ETH-USDT"}},
+		{reference: " , ", want: nil},
+	}
+
+	for _, tt := range tests {
+		criteria := models.SelectionCriteria{CorrelationReference: tt.reference}
+		if got := criteria.CorrelationReferences(); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("CorrelationReferences() of %q = %v, want %v", tt.reference, got, tt.want)
+		}
+	}
+}
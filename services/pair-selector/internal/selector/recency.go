@@ -0,0 +1,87 @@
+package selector
+
+import (
+	"math"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/pkg/models"
+)
+
+// recencyWeights returns an exponentially decaying weight per price point,
+// halving every halfLife before the newest point, so recent activity counts
+// more than activity early in the window. The weights are scaled to average
+// one, which keeps weighted sums comparable to the unweighted thresholds. A
+// non-positive halfLife returns nil, meaning equal weights.
+func recencyWeights(priceData []models.PricePoint, halfLife time.Duration) []float64 {
+	if halfLife <= 0 || len(priceData) == 0 {
+		return nil
+	}
+
+	newest := priceData[len(priceData)-1].Timestamp
+	weights := make([]float64, len(priceData))
+	total := 0.0
+	for i, point := range priceData {
+		age := newest.Sub(point.Timestamp)
+		weights[i] = math.Pow(0.5, age.Hours()/halfLife.Hours())
+		total += weights[i]
+	}
+
+	scale := float64(len(weights)) / total
+	for i := range weights {
+		weights[i] *= scale
+	}
+	return weights
+}
+
+// weightedReturnVolatility is the weighted standard deviation of
+// close-to-close returns, each return weighted like the point it ends at
+func weightedReturnVolatility(closes, weights []float64) float64 {
+	var returns, returnWeights []float64
+	for i := 1; i < len(closes); i++ {
+		if closes[i-1] != 0 {
+			returns = append(returns, (closes[i]-closes[i-1])/closes[i-1])
+			returnWeights = append(returnWeights, weights[i])
+		}
+	}
+
+	return weightedStdDev(returns, returnWeights)
+}
+
+// weightedTrueRangeVolatility is the weighted mean true range relative to
+// the latest close
+func weightedTrueRangeVolatility(highs, lows, closes, weights []float64) float64 {
+	if len(closes) < 2 || closes[len(closes)-1] <= 0 {
+		return 0
+	}
+
+	total, weightSum := 0.0, 0.0
+	for i := 1; i < len(closes); i++ {
+		trueRange := math.Max(highs[i]-lows[i], math.Max(math.Abs(highs[i]-closes[i-1]), math.Abs(lows[i]-closes[i-1])))
+		total += weights[i] * trueRange
+		weightSum += weights[i]
+	}
+	if weightSum == 0 {
+		return 0
+	}
+
+	return total / weightSum / closes[len(closes)-1]
+}
+
+func weightedStdDev(values, weights []float64) float64 {
+	weightSum, mean := 0.0, 0.0
+	for i, value := range values {
+		mean += weights[i] * value
+		weightSum += weights[i]
+	}
+	if weightSum == 0 {
+		return 0
+	}
+	mean /= weightSum
+
+	variance := 0.0
+	for i, value := range values {
+		variance += weights[i] * (value - mean) * (value - mean)
+	}
+
+	return math.Sqrt(variance / weightSum)
+}
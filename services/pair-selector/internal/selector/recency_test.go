@@ -0,0 +1,116 @@
+package selector
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/pkg/models"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+)
+
+// burstPrices returns 24 hourly points trading 100 units a candle with 0.05%
+// moves, except for six hours of ten times the volume and 2% swings, placed
+// at the end of the window when recent and at its start otherwise
+func burstPrices(recent bool) []models.PricePoint {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	points := make([]models.PricePoint, 24)
+	for i := range points {
+		active := i < 6
+		if recent {
+			active = i >= 18
+		}
+
+		volume, swing := 100.0, 0.0005
+		if active {
+			volume, swing = 1000, 0.02
+		}
+		price := 100.0
+		if i%2 == 1 {
+			price *= 1 + swing
+		}
+
+		points[i] = models.PricePoint{
+			Timestamp: start.Add(time.Duration(i) * time.Hour),
+			Close:     price,
+			High:      price * (1 + swing/2),
+			Low:       price * (1 - swing/2),
+			Volume:    volume,
+		}
+	}
+	return points
+}
+
+func TestRecencyWeightingFavoursRecentActivity(t *testing.T) {
+	recent, early := burstPrices(true), burstPrices(false)
+	scorer := NewScorer(utils.NewDiscardLogger())
+	const minVolume = 100000
+
+	tests := []struct {
+		name     string
+		halfLife time.Duration
+		model    string
+	}{
+		{name: "close model", halfLife: 6 * time.Hour, model: VolatilityModelClose},
+		{name: "true range model", halfLife: 6 * time.Hour, model: VolatilityModelTrueRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			volume := NewVolumeAnalyzer(tt.halfLife, utils.NewDiscardLogger())
+			volatility := NewVolatilityAnalyzer(tt.model, tt.halfLife, utils.NewDiscardLogger())
+
+			recentVolume, earlyVolume := volume.AnalyzeVolume(recent), volume.AnalyzeVolume(early)
+			if recentVolume.Volume24hUSDT <= earlyVolume.Volume24hUSDT {
+				t.Errorf("weighted volume recent/early = %v/%v, want recent higher", recentVolume.Volume24hUSDT, earlyVolume.Volume24hUSDT)
+			}
+
+			recentScore := scorer.CalculateVolumeScore(recentVolume.Volume24hUSDT, minVolume, recentVolume.VolumeConsistency)
+			earlyScore := scorer.CalculateVolumeScore(earlyVolume.Volume24hUSDT, minVolume, earlyVolume.VolumeConsistency)
+			if recentScore <= earlyScore {
+				t.Errorf("volume score recent/early = %v/%v, want recent higher", recentScore, earlyScore)
+			}
+
+			recentVol := volatility.AnalyzeVolatility(recent).Volatility24h
+			earlyVol := volatility.AnalyzeVolatility(early).Volatility24h
+			if recentVol <= earlyVol {
+				t.Errorf("weighted volatility recent/early = %v/%v, want recent higher", recentVol, earlyVol)
+			}
+		})
+	}
+}
+
+func TestNoRecencyWeightingTreatsWindowEvenly(t *testing.T) {
+	recent, early := burstPrices(true), burstPrices(false)
+
+	volume := NewVolumeAnalyzer(0, utils.NewDiscardLogger())
+	recentVolume, earlyVolume := volume.AnalyzeVolume(recent).Volume24hUSDT, volume.AnalyzeVolume(early).Volume24hUSDT
+	if math.Abs(recentVolume-earlyVolume) > 1e-6 {
+		t.Errorf("unweighted volume recent/early = %v/%v, want equal", recentVolume, earlyVolume)
+	}
+
+	volatility := NewVolatilityAnalyzer(VolatilityModelTrueRange, 0, utils.NewDiscardLogger())
+	recentVol, earlyVol := volatility.AnalyzeVolatility(recent).Volatility24h, volatility.AnalyzeVolatility(early).Volatility24h
+	if math.Abs(recentVol-earlyVol) > 0.1*earlyVol {
+		t.Errorf("unweighted volatility recent/early = %v/%v, want about equal", recentVol, earlyVol)
+	}
+}
+
+func TestRecencyWeightsHalveEveryHalfLife(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	points := []models.PricePoint{{Timestamp: start}, {Timestamp: start.Add(6 * time.Hour)}, {Timestamp: start.Add(12 * time.Hour)}}
+
+	weights := recencyWeights(points, 6*time.Hour)
+	if len(weights) != 3 {
+		t.Fatalf("got %d weights, want 3", len(weights))
+	}
+	if math.Abs(weights[0]*4-weights[2]) > 1e-9 || math.Abs(weights[1]*2-weights[2]) > 1e-9 {
+		t.Errorf("weights = %v, want each half the next", weights)
+	}
+	if sum := weights[0] + weights[1] + weights[2]; math.Abs(sum-3) > 1e-9 {
+		t.Errorf("weights sum to %v, want an average of one", sum)
+	}
+	if recencyWeights(points, 0) != nil {
+		t.Error("zero half-life weighted the window, want nil for equal weights")
+	}
+}
@@ -15,7 +15,14 @@ func NewScorer(logger *logrus.Logger) *Scorer {
 	return &Scorer{logger: logger}
 }
 
-func (s *Scorer) CalculateVolumeScore(volumeUSDT, minVolumeUSDT float64) float64 {
+// volumeConsistencyWeight is the share of the volume score that depends on
+// how steady the volume is rather than on its size
+const volumeConsistencyWeight = 0.3
+
+// CalculateVolumeScore scores the volume above the minimum, discounted for
+// erratic volume: a pair trading the same total in bursts offers less
+// reliable liquidity than one trading it steadily
+func (s *Scorer) CalculateVolumeScore(volumeUSDT, minVolumeUSDT, consistency float64) float64 {
 	if volumeUSDT <= minVolumeUSDT {
 		return 0.0
 	}
@@ -28,7 +35,7 @@ func (s *Scorer) CalculateVolumeScore(volumeUSDT, minVolumeUSDT float64) float64
 		score = 1.0
 	}
 
-	return score
+	return score * (1 - volumeConsistencyWeight + volumeConsistencyWeight*consistency)
 }
 
 func (s *Scorer) CalculateVolatilityScore(volatility, minVol, maxVol float64) float64 {
@@ -93,12 +100,43 @@ func (s *Scorer) CalculateCorrelationScore(correlation float64) float64 {
 	return 0.2 // Very low correlation - potentially risky
 }
 
+// CalculateEdgeScore rates the share of a typical move (the ATR relative to
+// price) left after paying the round trip's spread and fees. Pairs whose moves
+// do not cover their costs score zero.
+func (s *Scorer) CalculateEdgeScore(atrPercent, roundTripCost float64) float64 {
+	if atrPercent <= 0 {
+		return 0.0
+	}
+
+	score := (atrPercent - roundTripCost) / atrPercent
+	if score < 0 {
+		score = 0
+	}
+
+	return score
+}
+
+// CalculateFinalScore returns the weighted average of the sub-scores. The
+// weights are divided by their sum, so weights that do not add up to one
+// change only the components' relative importance, not the score's scale.
 func (s *Scorer) CalculateFinalScore(analysis models.PairAnalysis, criteria models.SelectionCriteria) float64 {
-	// Weighted sum of all scores
-	finalScore := (analysis.VolumeScore * criteria.VolumeWeight) +
+	weighted := (analysis.VolumeScore * criteria.VolumeWeight) +
 		(analysis.VolatilityScore * criteria.VolatilityWeight) +
 		(analysis.ATRScore * criteria.ATRWeight) +
-		(analysis.CorrelationScore * criteria.CorrelationWeight)
+		(analysis.EdgeScore * criteria.EdgeWeight)
+	totalWeight := criteria.VolumeWeight + criteria.VolatilityWeight + criteria.ATRWeight + criteria.EdgeWeight
+
+	// Without a meaningful correlation its weight is spread proportionally
+	// over the other components instead of scoring it as zero
+	if !analysis.CorrelationExcluded() || totalWeight <= 0 {
+		weighted += analysis.CorrelationScore * criteria.CorrelationWeight
+		totalWeight += criteria.CorrelationWeight
+	}
+
+	finalScore := 0.0
+	if totalWeight > 0 {
+		finalScore = weighted / totalWeight
+	}
 
 	// Ensure score is between 0 and 1
 	if finalScore > 1.0 {
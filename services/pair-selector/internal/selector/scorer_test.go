@@ -0,0 +1,125 @@
+package selector
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/pkg/models"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+)
+
+func TestFinalScoreNormalizesWeights(t *testing.T) {
+	scorer := NewScorer(utils.NewDiscardLogger())
+	analysis := models.PairAnalysis{VolumeScore: 0.8, VolatilityScore: 0.6, ATRScore: 0.4, CorrelationScore: 0.2}
+	// 0.8*0.4 + 0.6*0.3 + 0.4*0.2 + 0.2*0.1 with weights summing to one
+	const want = 0.6
+
+	tests := []struct {
+		name     string
+		criteria models.SelectionCriteria
+	}{
+		{name: "weights summing to one", criteria: models.SelectionCriteria{VolumeWeight: 0.4, VolatilityWeight: 0.3, ATRWeight: 0.2, CorrelationWeight: 0.1}},
+		{name: "weights summing to less than one", criteria: models.SelectionCriteria{VolumeWeight: 0.04, VolatilityWeight: 0.03, ATRWeight: 0.02, CorrelationWeight: 0.01}},
+		{name: "weights summing to more than one", criteria: models.SelectionCriteria{VolumeWeight: 4, VolatilityWeight: 3, ATRWeight: 2, CorrelationWeight: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scorer.CalculateFinalScore(analysis, tt.criteria); math.Abs(got-want) > 1e-9 {
+				t.Errorf("CalculateFinalScore() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestFinalScoreSpreadsExcludedCorrelationWeight(t *testing.T) {
+	scorer := NewScorer(utils.NewDiscardLogger())
+	analysis := models.PairAnalysis{VolumeScore: 0.8, VolatilityScore: 0.6, ATRScore: 0.4, CorrelationScore: 0, CorrelationThin: true}
+	criteria := models.SelectionCriteria{VolumeWeight: 2, VolatilityWeight: 1, ATRWeight: 1, CorrelationWeight: 4}
+
+	// (0.8*2 + 0.6 + 0.4) / 4, the correlation weight left out
+	if got := scorer.CalculateFinalScore(analysis, criteria); math.Abs(got-0.65) > 1e-9 {
+		t.Errorf("CalculateFinalScore() = %v, want 0.65", got)
+	}
+	if got := scorer.CalculateFinalScore(models.PairAnalysis{VolumeScore: 1}, models.SelectionCriteria{}); got != 0 {
+		t.Errorf("CalculateFinalScore() with no weights = %v, want 0", got)
+	}
+}
+
+func TestCalculateEdgeScore(t *testing.T) {
+	scorer := NewScorer(utils.NewDiscardLogger())
+
+	tests := []struct {
+		name          string
+		atrPercent    float64
+		roundTripCost float64
+		want          float64
+	}{
+		{name: "costs take a quarter of the move", atrPercent: 0.02, roundTripCost: 0.005, want: 0.75},
+		{name: "free round trip", atrPercent: 0.02, want: 1},
+		{name: "costs exceed the move", atrPercent: 0.002, roundTripCost: 0.003, want: 0},
+		{name: "no measured move", roundTripCost: 0.002, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scorer.CalculateEdgeScore(tt.atrPercent, tt.roundTripCost); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("CalculateEdgeScore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpectedEdgeFavoursMovesThatCoverCosts(t *testing.T) {
+	a := &Analyzer{scorer: NewScorer(utils.NewDiscardLogger()), logger: utils.NewDiscardLogger()}
+	criteria := models.SelectionCriteria{VolumeWeight: 0.3, VolatilityWeight: 0.3, ATRWeight: 0.2, EdgeWeight: 0.2, FeeRate: 0.001}
+	pair := func(atr, spread float64) models.PairAnalysis {
+		return models.PairAnalysis{
+			Symbol:          "TEST-USDT",
+			ATR14:           atr,
+			AvgSpread:       spread,
+			CorrelationThin: true,
+			PriceData:       []models.PricePoint{{Close: 100}},
+		}
+	}
+
+	// 0.3% moves against 0.5% spread and 0.2% fees, 3% moves against 0.02%
+	// spread and the same fees
+	wide, tight := pair(0.3, 0.005), pair(3, 0.0002)
+	a.scoreAnalysis(&wide, criteria)
+	a.scoreAnalysis(&tight, criteria)
+
+	if wide.ExpectedEdge >= 0 || wide.EdgeScore != 0 {
+		t.Errorf("wide spread edge = %v scoring %v, want negative scoring 0", wide.ExpectedEdge, wide.EdgeScore)
+	}
+	if math.Abs(tight.ExpectedEdge-0.0278) > 1e-9 || tight.EdgeScore <= 0.9 {
+		t.Errorf("tight spread edge = %v scoring %v, want 0.0278 scoring above 0.9", tight.ExpectedEdge, tight.EdgeScore)
+	}
+	if tight.FinalScore <= wide.FinalScore {
+		t.Errorf("final score tight/wide = %v/%v, want tight higher", tight.FinalScore, wide.FinalScore)
+	}
+}
+
+func TestVolumeScoreFavoursSteadyVolume(t *testing.T) {
+	s := NewScorer(utils.NewDiscardLogger())
+
+	tests := []struct {
+		name        string
+		volume      float64
+		consistency float64
+		want        float64
+	}{
+		{name: "steady volume keeps the full score", volume: 1000, consistency: 1, want: 1},
+		{name: "erratic volume loses the consistency share", volume: 1000, consistency: 0, want: 0.7},
+		{name: "partly steady", volume: 1000, consistency: 0.5, want: 0.85},
+		{name: "volume at the minimum scores nothing", volume: 100, consistency: 1, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.CalculateVolumeScore(tt.volume, 100, tt.consistency); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("CalculateVolumeScore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
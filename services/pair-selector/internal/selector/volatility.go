@@ -2,14 +2,23 @@ package selector
 
 import (
 	"math"
+	"time"
 
 	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/pkg/models"
 	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
 
+// Volatility models for the selection volatility metric
+const (
+	VolatilityModelClose     = "close"      // Standard deviation of close-to-close returns
+	VolatilityModelTrueRange = "true_range" // Average true range relative to price
+)
+
 type VolatilityAnalyzer struct {
-	logger *logrus.Logger
+	model           string
+	recencyHalfLife time.Duration // Decay of older candles in the window, 0 weighs the window evenly
+	logger          *logrus.Logger
 }
 
 type VolatilityMetrics struct {
@@ -18,8 +27,8 @@ type VolatilityMetrics struct {
 	StdDev        float64
 }
 
-func NewVolatilityAnalyzer(logger *logrus.Logger) *VolatilityAnalyzer {
-	return &VolatilityAnalyzer{logger: logger}
+func NewVolatilityAnalyzer(model string, recencyHalfLife time.Duration, logger *logrus.Logger) *VolatilityAnalyzer {
+	return &VolatilityAnalyzer{model: model, recencyHalfLife: recencyHalfLife, logger: logger}
 }
 
 func (v *VolatilityAnalyzer) AnalyzeVolatility(priceData []models.PricePoint) VolatilityMetrics {
@@ -38,8 +47,21 @@ func (v *VolatilityAnalyzer) AnalyzeVolatility(priceData []models.PricePoint) Vo
 		lows[i] = point.Low
 	}
 
-	// Calculate 24h volatility (standard deviation of returns)
-	volatility := utils.CalculateVolatility(closes)
+	// Calculate 24h volatility, from close-to-close returns or from the true
+	// range of every candle in the window, optionally weighted toward recent
+	// candles
+	var volatility float64
+	weights := recencyWeights(priceData, v.recencyHalfLife)
+	switch {
+	case v.model == VolatilityModelTrueRange && weights != nil:
+		volatility = weightedTrueRangeVolatility(highs, lows, closes, weights)
+	case v.model == VolatilityModelTrueRange:
+		volatility = utils.CalculateTrueRangeVolatility(highs, lows, closes, len(closes)-1)
+	case weights != nil:
+		volatility = weightedReturnVolatility(closes, weights)
+	default:
+		volatility = utils.CalculateVolatility(closes)
+	}
 
 	// Calculate ATR (Average True Range) for last 14 periods or available data
 	atrPeriod := 14
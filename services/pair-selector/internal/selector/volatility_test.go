@@ -0,0 +1,47 @@
+package selector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/pkg/models"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+)
+
+// wickedPrices returns hourly points whose closes alternate by 0.1% while
+// every candle wicks 3% above and below its close
+func wickedPrices(n int) []models.PricePoint {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	points := make([]models.PricePoint, n)
+	for i := range points {
+		price := 100.0
+		if i%2 == 1 {
+			price = 100.1
+		}
+		points[i] = models.PricePoint{
+			Timestamp: start.Add(time.Duration(i) * time.Hour),
+			Close:     price,
+			High:      price * 1.03,
+			Low:       price * 0.97,
+			Volume:    1000,
+		}
+	}
+	return points
+}
+
+func TestVolatilityModelOnWickedSeries(t *testing.T) {
+	prices := wickedPrices(24)
+
+	closeBased := NewVolatilityAnalyzer(VolatilityModelClose, 0, utils.NewDiscardLogger()).AnalyzeVolatility(prices)
+	trueRange := NewVolatilityAnalyzer(VolatilityModelTrueRange, 0, utils.NewDiscardLogger()).AnalyzeVolatility(prices)
+
+	if closeBased.Volatility24h > 0.002 {
+		t.Errorf("close-based volatility = %v, want it blind to the wicks", closeBased.Volatility24h)
+	}
+	if trueRange.Volatility24h < 0.05 || trueRange.Volatility24h > 0.07 {
+		t.Errorf("true range volatility = %v, want about the 6%% bar range", trueRange.Volatility24h)
+	}
+	if closeBased.ATR14 != trueRange.ATR14 {
+		t.Errorf("ATR14 = %v/%v, want it independent of the model", closeBased.ATR14, trueRange.ATR14)
+	}
+}
@@ -1,22 +1,27 @@
 package selector
 
 import (
+	"math"
+	"time"
+
 	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/pkg/models"
 	"github.com/sirupsen/logrus"
 )
 
 type VolumeAnalyzer struct {
-	logger *logrus.Logger
+	recencyHalfLife time.Duration // Decay of older volume in the window, 0 weighs the window evenly
+	logger          *logrus.Logger
 }
 
 type VolumeMetrics struct {
 	Volume24hUSDT     float64
 	AverageVolume     float64
-	VolumeConsistency float64
+	VolumeConsistency float64 // 1 / (1 + coefficient of variation): 1 for flat volume, towards 0 for erratic
+	AverageSpread     float64 // Mean (ask - bid) / mid over points with a collected spread
 }
 
-func NewVolumeAnalyzer(logger *logrus.Logger) *VolumeAnalyzer {
-	return &VolumeAnalyzer{logger: logger}
+func NewVolumeAnalyzer(recencyHalfLife time.Duration, logger *logrus.Logger) *VolumeAnalyzer {
+	return &VolumeAnalyzer{recencyHalfLife: recencyHalfLife, logger: logger}
 }
 
 func (v *VolumeAnalyzer) AnalyzeVolume(priceData []models.PricePoint) VolumeMetrics {
@@ -26,24 +31,52 @@ func (v *VolumeAnalyzer) AnalyzeVolume(priceData []models.PricePoint) VolumeMetr
 
 	totalVolume := 0.0
 	volumes := make([]float64, len(priceData))
+	weights := recencyWeights(priceData, v.recencyHalfLife)
 
 	for i, point := range priceData {
-		totalVolume += point.Volume * point.Close // Convert to USDT value
-		volumes[i] = point.Volume * point.Close
+		volumes[i] = point.Volume * point.Close // Convert to USDT value
+		if weights != nil {
+			totalVolume += weights[i] * volumes[i]
+		} else {
+			totalVolume += volumes[i]
+		}
 	}
 
 	averageVolume := totalVolume / float64(len(priceData))
 
-	// Calculate volume consistency (inverse of coefficient of variation)
 	consistency := v.calculateVolumeConsistency(volumes, averageVolume)
 
 	return VolumeMetrics{
 		Volume24hUSDT:     totalVolume,
 		AverageVolume:     averageVolume,
 		VolumeConsistency: consistency,
+		AverageSpread:     v.calculateAverageSpread(priceData),
 	}
 }
 
+// calculateAverageSpread returns the mean relative spread, skipping points
+// collected without a bid and ask
+func (v *VolumeAnalyzer) calculateAverageSpread(priceData []models.PricePoint) float64 {
+	total := 0.0
+	count := 0
+	for _, point := range priceData {
+		if point.BestBid <= 0 || point.BestAsk < point.BestBid {
+			continue
+		}
+		mid := (point.BestBid + point.BestAsk) / 2
+		total += (point.BestAsk - point.BestBid) / mid
+		count++
+	}
+
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
+
+// calculateVolumeConsistency maps the coefficient of variation of the
+// volumes into (0, 1] as 1 / (1 + CV), so steady volume scores near 1 and a
+// perfectly flat series exactly 1
 func (v *VolumeAnalyzer) calculateVolumeConsistency(volumes []float64, average float64) float64 {
 	if len(volumes) == 0 || average == 0 {
 		return 0
@@ -55,16 +88,6 @@ func (v *VolumeAnalyzer) calculateVolumeConsistency(volumes []float64, average f
 	}
 	variance /= float64(len(volumes))
 
-	stdDev := variance
-	if variance > 0 {
-		stdDev = variance * variance // Simplified square root approximation
-	}
-
-	coefficientOfVariation := stdDev / average
-
-	// Return inverse of coefficient of variation (higher is more consistent)
-	if coefficientOfVariation > 0 {
-		return 1.0 / coefficientOfVariation
-	}
-	return 1.0
+	coefficientOfVariation := math.Sqrt(variance) / average
+	return 1.0 / (1.0 + coefficientOfVariation)
 }
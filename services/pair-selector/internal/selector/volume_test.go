@@ -0,0 +1,101 @@
+package selector
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/pair-selector/pkg/models"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+)
+
+func TestAverageSpread(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []models.PricePoint
+		want   float64
+	}{
+		{
+			name: "mean relative spread",
+			points: []models.PricePoint{
+				{Close: 100, BestBid: 99.9, BestAsk: 100.1}, // 0.2%
+				{Close: 100, BestBid: 99.8, BestAsk: 100.2}, // 0.4%
+			},
+			want: 0.003,
+		},
+		{
+			name: "points without a collected spread are skipped",
+			points: []models.PricePoint{
+				{Close: 100, BestBid: 99.9, BestAsk: 100.1},
+				{Close: 100},
+				{Close: 100, BestBid: 100.2, BestAsk: 100.1}, // Crossed
+			},
+			want: 0.002,
+		},
+		{
+			name:   "no spread collected",
+			points: []models.PricePoint{{Close: 100}, {Close: 101}},
+			want:   0,
+		},
+	}
+
+	v := NewVolumeAnalyzer(0, utils.NewDiscardLogger())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := v.AnalyzeVolume(tt.points).AverageSpread; math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("AverageSpread = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpreadRaisesRiskLevel(t *testing.T) {
+	a := &Analyzer{logger: utils.NewDiscardLogger()}
+	criteria := models.SelectionCriteria{HighRiskSpread: 0.004}
+
+	tests := []struct {
+		name   string
+		spread float64
+		want   string
+	}{
+		{name: "tight spread", spread: 0.001, want: "low"},
+		{name: "above half the limit", spread: 0.003, want: "medium"},
+		{name: "above the limit", spread: 0.005, want: "high"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis := models.PairAnalysis{Volatility: 0.02, CorrelationBTC: 0.8, CorrelationKnown: true, AvgSpread: tt.spread}
+			if got := a.determineRiskLevel(analysis, criteria); got != tt.want {
+				t.Errorf("determineRiskLevel() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVolumeConsistency(t *testing.T) {
+	tests := []struct {
+		name    string
+		volumes []float64
+		want    float64
+	}{
+		// Mean 25, standard deviation sqrt(125): a coefficient of
+		// variation of 0.4472
+		{name: "known series", volumes: []float64{10, 20, 30, 40}, want: 0.6909830056250525},
+		{name: "constant volume", volumes: []float64{50, 50, 50}, want: 1},
+		{name: "no volume", volumes: []float64{0, 0}, want: 0},
+		{name: "no candles", want: 0},
+	}
+
+	v := NewVolumeAnalyzer(0, utils.NewDiscardLogger())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			average := 0.0
+			for _, volume := range tt.volumes {
+				average += volume / float64(len(tt.volumes))
+			}
+			if got := v.calculateVolumeConsistency(tt.volumes, average); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("calculateVolumeConsistency() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -37,18 +40,25 @@ type SelectedPair struct {
 }
 
 type PairAnalysis struct {
-	Symbol           string
-	Volume24hUSDT    float64
-	Volatility       float64
-	ATR14            float64
-	CorrelationBTC   float64
-	VolumeScore      float64
-	VolatilityScore  float64
-	ATRScore         float64
-	CorrelationScore float64
-	FinalScore       float64
-	RiskLevel        string
-	PriceData        []PricePoint
+	Symbol            string
+	Volume24hUSDT     float64
+	VolumeConsistency float64 // 1 for flat volume over the window, towards 0 for erratic
+	Volatility        float64
+	ATR14             float64
+	CorrelationBTC    float64
+	CorrelationKnown  bool // False when correlation analysis failed and CorrelationBTC is not measured
+	CorrelationThin   bool // True when too few aligned points existed to measure correlation
+	CorrelationSelf   bool // True for the correlation reference symbol itself
+	VolumeScore       float64
+	VolatilityScore   float64
+	ATRScore          float64
+	CorrelationScore  float64
+	FinalScore        float64
+	RiskLevel         string
+	AvgSpread         float64 // Mean relative bid/ask spread, 0 when no spread data was collected
+	ExpectedEdge      float64 // Relative ATR left after the round trip's spread and fees
+	EdgeScore         float64
+	PriceData         []PricePoint
 }
 
 type PricePoint struct {
@@ -57,6 +67,15 @@ type PricePoint struct {
 	Volume    float64
 	High      float64
 	Low       float64
+	BestBid   float64 // 0 when the spread was not collected
+	BestAsk   float64
+}
+
+// CorrelationExcluded reports whether correlation is left out of the pair's
+// score and risk level: it was not measurable, or the pair is the reference
+// and would only be correlated against itself
+func (a PairAnalysis) CorrelationExcluded() bool {
+	return a.CorrelationThin || a.CorrelationSelf
 }
 
 type SelectionCriteria struct {
@@ -69,4 +88,84 @@ type SelectionCriteria struct {
 	VolatilityWeight  float64 // Weight for volatility score
 	ATRWeight         float64 // Weight for ATR score
 	CorrelationWeight float64 // Weight for correlation score
+	EdgeWeight        float64 // Weight for expected edge score
+
+	CorrelationReference        string  // Symbols every pair is correlated against, comma-separated, e.g. BTC-USDT,ETH-USDT
+	UnknownCorrelationDefault   float64 // Correlation assumed when it could not be measured
+	InsufficientCorrelationMode string  // How pairs with too little aligned data are handled
+
+	ClusterCorrelationThreshold float64 // Correlation joining two pairs into a cluster; 0 disables clustering
+	MaxPairsPerCluster          int     // Pairs kept from each correlation cluster
+
+	HighRiskSpread float64 // Average relative spread rated high risk (half of it medium); 0 ignores spread
+
+	FeeRate float64 // Fee rate paid on each side of a round trip, counted against the expected edge
+}
+
+// WeightSum returns the sum of the score weights. Scores are normalized by
+// it, so it need not be one.
+func (c SelectionCriteria) WeightSum() float64 {
+	return c.VolumeWeight + c.VolatilityWeight + c.ATRWeight + c.CorrelationWeight + c.EdgeWeight
 }
+
+// CorrelationReferences returns the symbols of the comma-separated
+// correlation reference
+func (c SelectionCriteria) CorrelationReferences() []string {
+	var references []string
+	for _, symbol := range strings.Split(c.CorrelationReference, ",") {
+		if symbol = strings.TrimSpace(symbol); symbol != "" {
+			references = append(references, symbol)
+		}
+	}
+	return references
+}
+
+// Validate rejects criteria that cannot produce a meaningful selection
+func (c SelectionCriteria) Validate() error {
+	switch {
+	case c.MinVolumeUSDT < 0:
+		return errors.New("min volume must not be negative")
+	case c.MinVolatility < 0 || c.MaxVolatility <= 0:
+		return errors.New("volatility bounds must be positive")
+	case c.MinVolatility > c.MaxVolatility:
+		return fmt.Errorf("min volatility %v exceeds max volatility %v", c.MinVolatility, c.MaxVolatility)
+	case c.MaxActivesPairs < 1:
+		return errors.New("max active pairs must be at least 1")
+	case c.WatchlistSize < c.MaxActivesPairs:
+		return fmt.Errorf("watchlist size %d is smaller than max active pairs %d", c.WatchlistSize, c.MaxActivesPairs)
+	case c.VolumeWeight < 0 || c.VolatilityWeight < 0 || c.ATRWeight < 0 || c.CorrelationWeight < 0 || c.EdgeWeight < 0:
+		return errors.New("score weights must not be negative")
+	case c.WeightSum() <= 0:
+		return errors.New("at least one score weight must be positive")
+	case c.ClusterCorrelationThreshold < 0 || c.ClusterCorrelationThreshold > 1:
+		return fmt.Errorf("cluster correlation threshold %v must be between 0 and 1", c.ClusterCorrelationThreshold)
+	case len(c.CorrelationReferences()) == 0:
+		return errors.New("correlation reference symbol must be set")
+	case c.HighRiskSpread < 0:
+		return errors.New("high risk spread must not be negative")
+	case c.FeeRate < 0:
+		return errors.New("fee rate must not be negative")
+	}
+
+	switch c.InsufficientCorrelationMode {
+	case InsufficientCorrelationNeutral, InsufficientCorrelationSkip, InsufficientCorrelationDefault:
+	default:
+		return fmt.Errorf("unknown insufficient correlation mode %q", c.InsufficientCorrelationMode)
+	}
+
+	return nil
+}
+
+// Handling of pairs whose BTC correlation cannot be measured for lack of
+// aligned price data
+const (
+	// InsufficientCorrelationNeutral leaves correlation out of the score and
+	// risk level, spreading its weight across the other components
+	InsufficientCorrelationNeutral = "neutral"
+	// InsufficientCorrelationSkip excludes the pair until enough data has
+	// been backfilled
+	InsufficientCorrelationSkip = "skip"
+	// InsufficientCorrelationDefault assumes UnknownCorrelationDefault, as for
+	// any other correlation failure
+	InsufficientCorrelationDefault = "default"
+)
@@ -43,9 +43,15 @@ func main() {
 
 	// Initialize repositories and services
 	repo := priceDB.NewRepository(db, logger)
-	fetcher := collector.NewFetcher(kucoinClient, logger)
-	processor := collector.NewProcessor(repo, logger, cfg.DataRetentionDays)
-	scheduler := collector.NewScheduler(fetcher, processor, cfg.CollectionInterval, logger)
+	fetcher := collector.NewFetcher(kucoinClient, collector.FetcherConfig{
+		UseExchangeTimestamp: cfg.UseExchangeTimestamp,
+		MaxClockSkew:         cfg.MaxClockSkew,
+		CollectSpread:        cfg.CollectSpread,
+		TradingSymbolsOnly:   cfg.TradingSymbolsOnly,
+		SymbolRefresh:        cfg.SymbolRefresh,
+	}, logger)
+	processor := collector.NewProcessor(repo, logger, cfg.DataRetentionDays, cfg.NormalizationFastPath)
+	scheduler := collector.NewScheduler(fetcher, processor, cfg.CollectionInterval, cfg.EmptyTickerAlertThreshold, logger)
 
 	// Initialize health checker
 	healthChecker := health.NewHealthChecker(db, logger)
@@ -3,6 +3,8 @@ package collector
 import (
 	"context"
 	"fmt"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/paaavkata/crypto-trading-bot-v4/price-collector/pkg/models"
@@ -11,26 +13,46 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// marketClient is the part of the KuCoin client the fetcher reads from
+type marketClient interface {
+	GetAllTickers() (*kucoin.AllTickersResponse, error)
+	GetSymbols() ([]kucoin.Symbol, error)
+}
+
 type Fetcher struct {
-	client      *kucoin.Client
-	rateLimiter *kucoin.RateLimiter
-	logger      *logrus.Logger
+	client marketClient
+	logger *logrus.Logger
+	config FetcherConfig
+
+	mu          sync.Mutex
+	tradeable   map[string]bool // Symbols with trading enabled, nil until first loaded
+	tradeableAt time.Time
 }
 
-func NewFetcher(client *kucoin.Client, logger *logrus.Logger) *Fetcher {
-	// KuCoin allows 1800 requests per minute for public endpoints (30 per second)
-	rateLimiter := kucoin.NewRateLimiter(25) // Conservative rate limiting
+type FetcherConfig struct {
+	// UseExchangeTimestamp labels candles with the snapshot time reported by
+	// KuCoin instead of the local collection time
+	UseExchangeTimestamp bool
+	// MaxClockSkew is the largest tolerated difference between the exchange
+	// snapshot time and the local clock before falling back to local time
+	MaxClockSkew time.Duration
+	// CollectSpread stores the best bid and ask reported with each ticker
+	CollectSpread bool
+	// TradingSymbolsOnly drops tickers of symbols that are not listed as
+	// trading-enabled spot symbols, refreshing that list every SymbolRefresh
+	TradingSymbolsOnly bool
+	SymbolRefresh      time.Duration
+}
 
+func NewFetcher(client *kucoin.Client, config FetcherConfig, logger *logrus.Logger) *Fetcher {
 	return &Fetcher{
-		client:      client,
-		rateLimiter: rateLimiter,
-		logger:      logger,
+		client: client,
+		logger: logger,
+		config: config,
 	}
 }
 
 func (f *Fetcher) FetchAllTickers(ctx context.Context) ([]models.TickerData, error) {
-	f.rateLimiter.Wait()
-
 	start := time.Now()
 	tickersResp, err := f.client.GetAllTickers()
 	if err != nil {
@@ -38,11 +60,22 @@ func (f *Fetcher) FetchAllTickers(ctx context.Context) ([]models.TickerData, err
 		return nil, fmt.Errorf("failed to fetch tickers: %w", err)
 	}
 
-	timestamp := time.Now().Truncate(time.Minute) // Round to nearest minute
+	timestamp := f.candleTimestamp(tickersResp.Time, time.Now())
 	tickers := make([]models.TickerData, 0, len(tickersResp.Ticker))
 	parseErrors := 0
+	untradeable := 0
+
+	var tradeable map[string]bool
+	if f.config.TradingSymbolsOnly {
+		tradeable = f.tradeableSymbols()
+	}
 
 	for _, ticker := range tickersResp.Ticker {
+		if tradeable != nil && !tradeable[ticker.Symbol] {
+			untradeable++
+			continue
+		}
+
 		tickerData, err := f.parseTickerData(ticker, timestamp)
 		if err != nil {
 			f.logger.WithFields(logrus.Fields{
@@ -61,6 +94,7 @@ func (f *Fetcher) FetchAllTickers(ctx context.Context) ([]models.TickerData, err
 		"total_tickers": len(tickersResp.Ticker),
 		"valid_tickers": len(tickers),
 		"parse_errors":  parseErrors,
+		"untradeable":   untradeable,
 		"duration_ms":   duration.Milliseconds(),
 		"timestamp":     timestamp,
 	}).Info("Successfully fetched and processed tickers")
@@ -68,9 +102,68 @@ func (f *Fetcher) FetchAllTickers(ctx context.Context) ([]models.TickerData, err
 	return tickers, nil
 }
 
-func (f *Fetcher) FetchSymbols(ctx context.Context) ([]string, error) {
-	f.rateLimiter.Wait()
+// tradeableSymbols returns the trading-enabled symbols, reloading them when
+// the cached set is older than the refresh interval. A failed reload keeps
+// the previous set; with none loaded yet it returns nil, so every ticker is
+// stored rather than none.
+func (f *Fetcher) tradeableSymbols() map[string]bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.tradeable != nil && time.Since(f.tradeableAt) < f.config.SymbolRefresh {
+		return f.tradeable
+	}
+
+	symbols, err := f.client.GetSymbols()
+	if err != nil {
+		f.logger.WithError(err).Warn("Failed to refresh trading symbols, keeping the previous set")
+		return f.tradeable
+	}
+
+	tradeable := make(map[string]bool, len(symbols))
+	for _, symbol := range symbols {
+		if symbol.EnableTrading {
+			tradeable[symbol.Symbol] = true
+		}
+	}
+	f.tradeable = tradeable
+	f.tradeableAt = time.Now()
 
+	f.logger.WithField("symbols_count", len(tradeable)).Debug("Refreshed trading symbols")
+	return tradeable
+}
+
+// candleTimestamp returns the open time of the one-minute candle the snapshot
+// belongs to. The exchange snapshot time is preferred over the collection time
+// so that a cycle started just before a minute boundary is not labelled with
+// the previous minute, falling back to the local clock when the exchange time
+// is missing or skewed beyond the configured tolerance.
+func (f *Fetcher) candleTimestamp(exchangeTimeMs int64, collectedAt time.Time) time.Time {
+	dataTime := collectedAt
+
+	if f.config.UseExchangeTimestamp && exchangeTimeMs > 0 {
+		exchangeTime := time.UnixMilli(exchangeTimeMs)
+		skew := exchangeTime.Sub(collectedAt)
+		if skew < 0 {
+			skew = -skew
+		}
+
+		if f.config.MaxClockSkew <= 0 || skew <= f.config.MaxClockSkew {
+			dataTime = exchangeTime
+		} else {
+			f.logger.WithFields(logrus.Fields{
+				"exchange_time": exchangeTime,
+				"collected_at":  collectedAt,
+				"skew_ms":       skew.Milliseconds(),
+				"max_skew_ms":   f.config.MaxClockSkew.Milliseconds(),
+			}).Warn("Exchange timestamp skew exceeds tolerance, using local time")
+		}
+	}
+
+	return dataTime.UTC().Truncate(time.Minute)
+}
+
+func (f *Fetcher) FetchSymbols(ctx context.Context) ([]string, error) {
 	symbols, err := f.client.GetSymbols()
 	if err != nil {
 		f.logger.WithError(err).Error("Failed to fetch symbols from KuCoin")
@@ -136,6 +229,11 @@ func (f *Fetcher) parseTickerData(ticker kucoin.Ticker, timestamp time.Time) (*m
 			open, high, low, close)
 	}
 
+	var bestBid, bestAsk float64
+	if f.config.CollectSpread {
+		bestBid, bestAsk = f.parseSpread(ticker)
+	}
+
 	return &models.TickerData{
 		Symbol:      ticker.Symbol,
 		Open:        open,
@@ -146,10 +244,31 @@ func (f *Fetcher) parseTickerData(ticker kucoin.Ticker, timestamp time.Time) (*m
 		QuoteVolume: quoteVolume,
 		ChangeRate:  changeRate,
 		ChangePrice: changePrice,
+		BestBid:     bestBid,
+		BestAsk:     bestAsk,
 		Timestamp:   timestamp,
 	}, nil
 }
 
+// parseSpread returns the ticker's best bid and ask. A missing, malformed or
+// crossed quote is recorded as absent rather than failing the whole ticker,
+// since the OHLCV data is still usable.
+func (f *Fetcher) parseSpread(ticker kucoin.Ticker) (float64, float64) {
+	bid, err := f.parseFloatSafe(ticker.Buy, "best_bid")
+	if err != nil {
+		return 0, 0
+	}
+	ask, err := f.parseFloatSafe(ticker.Sell, "best_ask")
+	if err != nil {
+		return 0, 0
+	}
+
+	if !(bid > 0 && ask >= bid) || math.IsInf(ask, 0) {
+		return 0, 0
+	}
+	return bid, ask
+}
+
 func (f *Fetcher) parseFloatSafe(value, fieldName string) (float64, error) {
 	if value == "" {
 		return 0, nil
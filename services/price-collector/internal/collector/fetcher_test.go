@@ -0,0 +1,195 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+)
+
+func TestCandleTimestampNearMinuteBoundary(t *testing.T) {
+	minute := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		config       FetcherConfig
+		exchangeTime time.Time
+		collectedAt  time.Time
+		want         time.Time
+	}{
+		{
+			name:         "snapshot just after the boundary lands in the new minute",
+			config:       FetcherConfig{UseExchangeTimestamp: true, MaxClockSkew: 5 * time.Second},
+			exchangeTime: minute.Add(time.Minute + 500*time.Millisecond),
+			collectedAt:  minute.Add(59 * time.Second),
+			want:         minute.Add(time.Minute),
+		},
+		{
+			name:         "snapshot just before the boundary stays in the old minute",
+			config:       FetcherConfig{UseExchangeTimestamp: true, MaxClockSkew: 5 * time.Second},
+			exchangeTime: minute.Add(59*time.Second + 900*time.Millisecond),
+			collectedAt:  minute.Add(time.Minute + 2*time.Second),
+			want:         minute,
+		},
+		{
+			name:         "skew beyond tolerance falls back to the local clock",
+			config:       FetcherConfig{UseExchangeTimestamp: true, MaxClockSkew: 5 * time.Second},
+			exchangeTime: minute.Add(10 * time.Minute),
+			collectedAt:  minute.Add(30 * time.Second),
+			want:         minute,
+		},
+		{
+			name:        "missing exchange time uses the local clock",
+			config:      FetcherConfig{UseExchangeTimestamp: true, MaxClockSkew: 5 * time.Second},
+			collectedAt: minute.Add(59 * time.Second),
+			want:        minute,
+		},
+		{
+			name:         "disabled uses the local clock",
+			config:       FetcherConfig{},
+			exchangeTime: minute.Add(time.Minute + time.Second),
+			collectedAt:  minute.Add(59 * time.Second),
+			want:         minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Fetcher{config: tt.config, logger: utils.NewDiscardLogger()}
+
+			var exchangeMs int64
+			if !tt.exchangeTime.IsZero() {
+				exchangeMs = tt.exchangeTime.UnixMilli()
+			}
+
+			if got := f.candleTimestamp(exchangeMs, tt.collectedAt); !got.Equal(tt.want) {
+				t.Fatalf("candleTimestamp() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTickerSpread(t *testing.T) {
+	tests := []struct {
+		name    string
+		collect bool
+		buy     string
+		sell    string
+		wantBid float64
+		wantAsk float64
+	}{
+		{name: "best bid and ask parsed", collect: true, buy: "64100.2", sell: "64100.3", wantBid: 64100.2, wantAsk: 64100.3},
+		{name: "locked book kept", collect: true, buy: "1.5", sell: "1.5", wantBid: 1.5, wantAsk: 1.5},
+		{name: "collection disabled", collect: false, buy: "64100.2", sell: "64100.3"},
+		{name: "missing quote", collect: true, buy: "", sell: ""},
+		{name: "malformed ask", collect: true, buy: "64100.2", sell: "n/a"},
+		{name: "crossed quote", collect: true, buy: "64100.3", sell: "64100.2"},
+		{name: "zero bid", collect: true, buy: "0", sell: "64100.3"},
+	}
+
+	timestamp := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Fetcher{config: FetcherConfig{CollectSpread: tt.collect}, logger: utils.NewDiscardLogger()}
+			ticker := kucoin.Ticker{Symbol: "BTC-USDT", Last: "64100.25", High: "64200", Low: "63900", Vol: "12.5", VolValue: "801253", Buy: tt.buy, Sell: tt.sell}
+
+			data, err := f.parseTickerData(ticker, timestamp)
+			if err != nil {
+				t.Fatalf("parseTickerData() error = %v, want the OHLCV kept whatever the quote", err)
+			}
+			if data.BestBid != tt.wantBid || data.BestAsk != tt.wantAsk {
+				t.Errorf("bid/ask = %v/%v, want %v/%v", data.BestBid, data.BestAsk, tt.wantBid, tt.wantAsk)
+			}
+			if data.Close != 64100.25 {
+				t.Errorf("close = %v, want 64100.25", data.Close)
+			}
+		})
+	}
+}
+
+// fakeMarket serves fixed tickers and symbols, counting symbol lookups
+type fakeMarket struct {
+	tickers    []kucoin.Ticker
+	symbols    []kucoin.Symbol
+	symbolsErr error
+	lookups    int
+}
+
+func (m *fakeMarket) GetAllTickers() (*kucoin.AllTickersResponse, error) {
+	return &kucoin.AllTickersResponse{Time: time.Now().UnixMilli(), Ticker: m.tickers}, nil
+}
+
+func (m *fakeMarket) GetSymbols() ([]kucoin.Symbol, error) {
+	m.lookups++
+	return m.symbols, m.symbolsErr
+}
+
+func testTicker(symbol string) kucoin.Ticker {
+	return kucoin.Ticker{Symbol: symbol, Last: "1.5", High: "1.6", Low: "1.4", Vol: "100", VolValue: "150"}
+}
+
+func TestFetchSkipsUntradeableSymbols(t *testing.T) {
+	tickers := []kucoin.Ticker{testTicker("BTC-USDT"), testTicker("DEAD-USDT"), testTicker("NEW-USDT")}
+	symbols := []kucoin.Symbol{{Symbol: "BTC-USDT", EnableTrading: true}, {Symbol: "DEAD-USDT", EnableTrading: false}}
+
+	tests := []struct {
+		name        string
+		tradingOnly bool
+		symbolsErr  error
+		want        []string
+	}{
+		{name: "trading symbols only", tradingOnly: true, want: []string{"BTC-USDT"}},
+		{name: "full market", want: []string{"BTC-USDT", "DEAD-USDT", "NEW-USDT"}},
+		{name: "symbols unavailable", tradingOnly: true, symbolsErr: errors.New("503"), want: []string{"BTC-USDT", "DEAD-USDT", "NEW-USDT"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			market := &fakeMarket{tickers: tickers, symbols: symbols, symbolsErr: tt.symbolsErr}
+			f := &Fetcher{client: market, config: FetcherConfig{TradingSymbolsOnly: tt.tradingOnly, SymbolRefresh: time.Hour}, logger: utils.NewDiscardLogger()}
+
+			data, err := f.FetchAllTickers(context.Background())
+			if err != nil {
+				t.Fatalf("FetchAllTickers() error = %v", err)
+			}
+
+			var got []string
+			for _, ticker := range data {
+				got = append(got, ticker.Symbol)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("stored %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTradeableSymbolsCachedUntilRefresh(t *testing.T) {
+	market := &fakeMarket{tickers: []kucoin.Ticker{testTicker("BTC-USDT")}, symbols: []kucoin.Symbol{{Symbol: "BTC-USDT", EnableTrading: true}}}
+	f := &Fetcher{client: market, config: FetcherConfig{TradingSymbolsOnly: true, SymbolRefresh: time.Hour}, logger: utils.NewDiscardLogger()}
+
+	for i := 0; i < 3; i++ {
+		if _, err := f.FetchAllTickers(context.Background()); err != nil {
+			t.Fatalf("FetchAllTickers() error = %v", err)
+		}
+	}
+	if market.lookups != 1 {
+		t.Errorf("looked up the symbols %d times within the refresh interval, want 1", market.lookups)
+	}
+
+	// A failed refresh keeps filtering by the last loaded set
+	f.tradeableAt = time.Now().Add(-2 * time.Hour)
+	market.symbolsErr = errors.New("503")
+	market.tickers = append(market.tickers, testTicker("DEAD-USDT"))
+	data, err := f.FetchAllTickers(context.Background())
+	if err != nil {
+		t.Fatalf("FetchAllTickers() error = %v", err)
+	}
+	if market.lookups != 2 || len(data) != 1 || data[0].Symbol != "BTC-USDT" {
+		t.Errorf("after a failed refresh stored %d tickers with %d lookups, want only BTC-USDT after a second lookup", len(data), market.lookups)
+	}
+}
@@ -8,20 +8,34 @@ import (
 
 	"github.com/paaavkata/crypto-trading-bot-v4/price-collector/internal/database"
 	"github.com/paaavkata/crypto-trading-bot-v4/price-collector/pkg/models"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
 	"github.com/sirupsen/logrus"
 )
 
+// Storage limits of the price_data columns and the tolerance used to decide
+// whether a value was changed by normalization
+const (
+	maxDecimal20_8   = 999999999999.0 // DECIMAL(20,8)
+	scaleDecimal20_8 = 1e8
+	maxDecimal10_6   = 9999.0 // DECIMAL(10,6)
+	scaleDecimal10_6 = 1e6
+
+	normalizationTolerance = 1e-12
+)
+
 type Processor struct {
 	repo              *database.Repository
 	logger            *logrus.Logger
 	dataRetentionDays int
+	fastPath          bool // Skip normalization for tickers already within range and precision
 }
 
-func NewProcessor(repo *database.Repository, logger *logrus.Logger, dataRetentionDays int) *Processor {
+func NewProcessor(repo *database.Repository, logger *logrus.Logger, dataRetentionDays int, fastPath bool) *Processor {
 	return &Processor{
 		repo:              repo,
 		logger:            logger,
 		dataRetentionDays: dataRetentionDays,
+		fastPath:          fastPath,
 	}
 }
 
@@ -33,14 +47,24 @@ func (p *Processor) ProcessTickers(ctx context.Context, tickers []models.TickerD
 
 	start := time.Now()
 
+	// Keep a single row per symbol per candle so the bulk upsert never
+	// touches the same (symbol, timestamp) twice in one statement
+	tickers = p.deduplicateTickers(tickers)
+
 	// Convert ticker data to price data with normalization
 	priceData := make([]models.PriceData, 0, len(tickers))
 	symbols := make([]string, 0, len(tickers))
 	normalizedCount := 0
 
 	for _, ticker := range tickers {
-		// Normalize data to fit database precision limits
-		normalizedTicker := p.normalizePriceData(ticker)
+		// Normalize data to fit database precision limits; most tickers are
+		// already clean and skip the full normalize and compare
+		normalizedTicker := ticker
+		normalized := false
+		if !p.fastPath || !p.isWithinStorageLimits(ticker) {
+			normalizedTicker = p.normalizePriceData(ticker)
+			normalized = p.wasNormalized(ticker, normalizedTicker)
+		}
 
 		// Basic validation (just check for completely invalid data)
 		if !p.isBasicDataValid(normalizedTicker) {
@@ -52,7 +76,7 @@ func (p *Processor) ProcessTickers(ctx context.Context, tickers []models.TickerD
 		}
 
 		// Track if normalization occurred
-		if p.wasNormalized(ticker, normalizedTicker) {
+		if normalized {
 			normalizedCount++
 			p.logger.WithFields(logrus.Fields{
 				"symbol":     ticker.Symbol,
@@ -72,6 +96,8 @@ func (p *Processor) ProcessTickers(ctx context.Context, tickers []models.TickerD
 			QuoteVolume: normalizedTicker.QuoteVolume,
 			ChangeRate:  normalizedTicker.ChangeRate,
 			ChangePrice: normalizedTicker.ChangePrice,
+			BestBid:     normalizedTicker.BestBid,
+			BestAsk:     normalizedTicker.BestAsk,
 		}
 
 		priceData = append(priceData, price)
@@ -88,6 +114,7 @@ func (p *Processor) ProcessTickers(ctx context.Context, tickers []models.TickerD
 			p.logger.WithError(err).Error("Failed to insert price data")
 			return err
 		}
+		metrics.PriceRowsInserted.Add(float64(len(priceData)))
 	}
 
 	duration := time.Since(start)
@@ -99,6 +126,35 @@ func (p *Processor) ProcessTickers(ctx context.Context, tickers []models.TickerD
 
 	return nil
 }
+
+// deduplicateTickers collapses tickers sharing a symbol and candle timestamp,
+// keeping the most recent occurrence while preserving the original ordering
+func (p *Processor) deduplicateTickers(tickers []models.TickerData) []models.TickerData {
+	type candleKey struct {
+		symbol    string
+		timestamp int64
+	}
+
+	index := make(map[candleKey]int, len(tickers))
+	unique := make([]models.TickerData, 0, len(tickers))
+
+	for _, ticker := range tickers {
+		key := candleKey{symbol: ticker.Symbol, timestamp: ticker.Timestamp.Truncate(time.Minute).Unix()}
+		if i, exists := index[key]; exists {
+			unique[i] = ticker
+			continue
+		}
+		index[key] = len(unique)
+		unique = append(unique, ticker)
+	}
+
+	if duplicates := len(tickers) - len(unique); duplicates > 0 {
+		p.logger.WithField("duplicates", duplicates).Debug("Dropped duplicate tickers for the same candle")
+	}
+
+	return unique
+}
+
 func (p *Processor) normalizePriceData(ticker models.TickerData) models.TickerData {
 	return models.TickerData{
 		Symbol:      ticker.Symbol,
@@ -111,6 +167,8 @@ func (p *Processor) normalizePriceData(ticker models.TickerData) models.TickerDa
 		QuoteVolume: p.normalizeVolumeField(ticker.QuoteVolume),
 		ChangeRate:  p.normalizeChangeRateField(ticker.ChangeRate),
 		ChangePrice: p.normalizePriceField(ticker.ChangePrice),
+		BestBid:     p.normalizeVolumeField(ticker.BestBid),
+		BestAsk:     p.normalizeVolumeField(ticker.BestAsk),
 	}
 }
 
@@ -200,6 +258,31 @@ func (p *Processor) normalizeChangeRateField(value float64) float64 {
 	return math.Round(value*multiplier) / multiplier * sign
 }
 
+// isWithinStorageLimits is a cheap check that every field is finite, in range
+// and already at column precision, i.e. normalization would not change it
+func (p *Processor) isWithinStorageLimits(ticker models.TickerData) bool {
+	return fitsDecimal(ticker.Open, maxDecimal20_8, scaleDecimal20_8) &&
+		fitsDecimal(ticker.High, maxDecimal20_8, scaleDecimal20_8) &&
+		fitsDecimal(ticker.Low, maxDecimal20_8, scaleDecimal20_8) &&
+		fitsDecimal(ticker.Close, maxDecimal20_8, scaleDecimal20_8) &&
+		fitsDecimal(ticker.ChangePrice, maxDecimal20_8, scaleDecimal20_8) &&
+		ticker.BestBid >= 0 && fitsDecimal(ticker.BestBid, maxDecimal20_8, scaleDecimal20_8) &&
+		ticker.BestAsk >= 0 && fitsDecimal(ticker.BestAsk, maxDecimal20_8, scaleDecimal20_8) &&
+		ticker.Volume >= 0 && fitsDecimal(ticker.Volume, maxDecimal20_8, scaleDecimal20_8) &&
+		ticker.QuoteVolume >= 0 && fitsDecimal(ticker.QuoteVolume, maxDecimal20_8, scaleDecimal20_8) &&
+		fitsDecimal(ticker.ChangeRate, maxDecimal10_6, scaleDecimal10_6)
+}
+
+func fitsDecimal(value, maxValue, scale float64) bool {
+	// NaN fails every comparison and infinities exceed the range
+	if !(value <= maxValue && value >= -maxValue) {
+		return false
+	}
+
+	scaled := value * scale
+	return math.Abs(scaled-math.Round(scaled)) <= normalizationTolerance*scale
+}
+
 // Basic validation after normalization - only reject completely invalid data
 func (p *Processor) isBasicDataValid(ticker models.TickerData) bool {
 	// Only reject data that's completely unusable
@@ -225,7 +308,7 @@ func (p *Processor) isBasicDataValid(ticker models.TickerData) bool {
 
 // Check if normalization occurred
 func (p *Processor) wasNormalized(original, normalized models.TickerData) bool {
-	tolerance := 1e-12 // Very small tolerance for floating point comparison
+	tolerance := normalizationTolerance // Very small tolerance for floating point comparison
 
 	return math.Abs(original.Open-normalized.Open) > tolerance ||
 		math.Abs(original.High-normalized.High) > tolerance ||
@@ -234,7 +317,9 @@ func (p *Processor) wasNormalized(original, normalized models.TickerData) bool {
 		math.Abs(original.Volume-normalized.Volume) > tolerance ||
 		math.Abs(original.QuoteVolume-normalized.QuoteVolume) > tolerance ||
 		math.Abs(original.ChangeRate-normalized.ChangeRate) > tolerance ||
-		math.Abs(original.ChangePrice-normalized.ChangePrice) > tolerance
+		math.Abs(original.ChangePrice-normalized.ChangePrice) > tolerance ||
+		math.Abs(original.BestBid-normalized.BestBid) > tolerance ||
+		math.Abs(original.BestAsk-normalized.BestAsk) > tolerance
 }
 
 // Helper functions for logging
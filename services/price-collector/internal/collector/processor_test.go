@@ -0,0 +1,148 @@
+package collector
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/price-collector/pkg/models"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+)
+
+func TestDeduplicateTickersKeepsOneRowPerCandle(t *testing.T) {
+	minute := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	p := &Processor{logger: utils.NewDiscardLogger()}
+
+	tickers := []models.TickerData{
+		{Symbol: "BTC-USDT", Close: 100, Timestamp: minute},
+		{Symbol: "ETH-USDT", Close: 10, Timestamp: minute},
+		{Symbol: "BTC-USDT", Close: 101, Timestamp: minute.Add(30 * time.Second)},
+		{Symbol: "BTC-USDT", Close: 102, Timestamp: minute.Add(time.Minute)},
+	}
+
+	got := p.deduplicateTickers(tickers)
+
+	if len(got) != 3 {
+		t.Fatalf("deduplicateTickers() returned %d rows, want 3", len(got))
+	}
+	if got[0].Symbol != "BTC-USDT" || got[0].Close != 101 {
+		t.Errorf("first row = %s %v, want the latest BTC-USDT ticker of the minute (101)", got[0].Symbol, got[0].Close)
+	}
+	if got[1].Symbol != "ETH-USDT" {
+		t.Errorf("second row = %s, want ETH-USDT", got[1].Symbol)
+	}
+	if got[2].Close != 102 {
+		t.Errorf("third row close = %v, want the next minute's ticker (102)", got[2].Close)
+	}
+}
+
+func cleanTicker() models.TickerData {
+	return models.TickerData{
+		Symbol:      "BTC-USDT",
+		Timestamp:   time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		Open:        64000.5,
+		High:        64210.12345678,
+		Low:         63890.1,
+		Close:       64100.25,
+		Volume:      1234.5678,
+		QuoteVolume: 79123456.12,
+		ChangeRate:  0.0123,
+		ChangePrice: -12.5,
+		BestBid:     64100.2,
+		BestAsk:     64100.3,
+	}
+}
+
+func TestCleanTickerTakesFastPath(t *testing.T) {
+	p := &Processor{logger: utils.NewDiscardLogger(), fastPath: true}
+	ticker := cleanTicker()
+
+	if !p.isWithinStorageLimits(ticker) {
+		t.Fatal("isWithinStorageLimits() = false for a clean ticker, want the fast path")
+	}
+	if p.wasNormalized(ticker, p.normalizePriceData(ticker)) {
+		t.Error("normalization changed a ticker the fast path skips")
+	}
+}
+
+func TestDirtyTickerIsNormalized(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*models.TickerData)
+	}{
+		{name: "price beyond 8 decimals", modify: func(t *models.TickerData) { t.Close = 0.000000123456 }},
+		{name: "price above column range", modify: func(t *models.TickerData) { t.High = 5e12 }},
+		{name: "NaN price", modify: func(t *models.TickerData) { t.Open = math.NaN() }},
+		{name: "infinite volume", modify: func(t *models.TickerData) { t.QuoteVolume = math.Inf(1) }},
+		{name: "negative volume", modify: func(t *models.TickerData) { t.Volume = -1 }},
+		{name: "negative best bid", modify: func(t *models.TickerData) { t.BestBid = -0.5 }},
+		{name: "change rate beyond 6 decimals", modify: func(t *models.TickerData) { t.ChangeRate = 0.0123456789 }},
+		{name: "change rate above column range", modify: func(t *models.TickerData) { t.ChangeRate = 12000 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Processor{logger: utils.NewDiscardLogger(), fastPath: true}
+			ticker := cleanTicker()
+			tt.modify(&ticker)
+
+			if p.isWithinStorageLimits(ticker) {
+				t.Fatal("isWithinStorageLimits() = true, want the full normalization path")
+			}
+
+			normalized := p.normalizePriceData(ticker)
+			if normalized == ticker {
+				t.Error("normalizePriceData() left the ticker unchanged")
+			}
+			if !p.isWithinStorageLimits(normalized) {
+				t.Errorf("normalized ticker %+v still outside storage limits", normalized)
+			}
+		})
+	}
+}
+
+func benchmarkTickers(n int) []models.TickerData {
+	tickers := make([]models.TickerData, n)
+	for i := range tickers {
+		tickers[i] = cleanTicker()
+		tickers[i].Close += float64(i) / 100
+	}
+	return tickers
+}
+
+func BenchmarkNormalizeCleanTickers(b *testing.B) {
+	tickers := benchmarkTickers(1000)
+
+	for _, fastPath := range []bool{false, true} {
+		name := "full"
+		if fastPath {
+			name = "fast_path"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			p := &Processor{logger: utils.NewDiscardLogger(), fastPath: fastPath}
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				for _, ticker := range tickers {
+					if !p.fastPath || !p.isWithinStorageLimits(ticker) {
+						p.wasNormalized(ticker, p.normalizePriceData(ticker))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizationKeepsSpread(t *testing.T) {
+	p := &Processor{logger: utils.NewDiscardLogger(), fastPath: true}
+	ticker := cleanTicker()
+	ticker.Close = 64100.123456789 // Forces the full normalization path
+	ticker.BestBid = 64100.123456781
+	ticker.BestAsk = 64100.2
+
+	normalized := p.normalizePriceData(ticker)
+	if math.Abs(normalized.BestBid-64100.12345678) > 1e-8 || normalized.BestAsk != 64100.2 {
+		t.Errorf("bid/ask = %v/%v, want 64100.12345678/64100.2 kept at column precision", normalized.BestBid, normalized.BestAsk)
+	}
+}
@@ -2,8 +2,10 @@ package collector
 
 import (
 	"context"
+	"sync"
 	"time"
 
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
 	"github.com/robfig/cron/v3"
 	"github.com/sirupsen/logrus"
 )
@@ -14,17 +16,24 @@ type Scheduler struct {
 	cron      *cron.Cron
 	logger    *logrus.Logger
 	interval  time.Duration
+
+	// An empty ticker list is an exchange anomaly, not a quiet market;
+	// emptyAlertThreshold consecutive empty cycles raise an alert
+	emptyAlertThreshold int
+	mu                  sync.Mutex
+	emptyStreak         int
 }
 
-func NewScheduler(fetcher *Fetcher, processor *Processor, interval time.Duration, logger *logrus.Logger) *Scheduler {
+func NewScheduler(fetcher *Fetcher, processor *Processor, interval time.Duration, emptyAlertThreshold int, logger *logrus.Logger) *Scheduler {
 	cronScheduler := cron.New(cron.WithSeconds())
 
 	return &Scheduler{
-		fetcher:   fetcher,
-		processor: processor,
-		cron:      cronScheduler,
-		logger:    logger,
-		interval:  interval,
+		fetcher:             fetcher,
+		processor:           processor,
+		cron:                cronScheduler,
+		logger:              logger,
+		interval:            interval,
+		emptyAlertThreshold: emptyAlertThreshold,
 	}
 }
 
@@ -72,6 +81,10 @@ func (s *Scheduler) collectPrices(ctx context.Context) {
 		return
 	}
 
+	if !s.recordTickerCount(len(tickers)) {
+		return
+	}
+
 	// Process and store tickers
 	if err := s.processor.ProcessTickers(ctx, tickers); err != nil {
 		s.logger.WithError(err).Error("Failed to process tickers")
@@ -85,6 +98,40 @@ func (s *Scheduler) collectPrices(ctx context.Context) {
 	}).Info("Price collection cycle completed successfully")
 }
 
+// recordTickerCount tracks runs of empty collection cycles and reports
+// whether the cycle has data to process. The alert fires when the run reaches
+// the threshold and again at every further multiple of it, so a long outage
+// keeps reminding without logging an alert every minute.
+func (s *Scheduler) recordTickerCount(count int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if count > 0 {
+		if s.emptyStreak > 0 {
+			s.logger.WithField("empty_cycles", s.emptyStreak).Info("Ticker feed recovered")
+		}
+		s.emptyStreak = 0
+		metrics.ConsecutiveEmptyTickerResponses.Set(0)
+		return true
+	}
+
+	s.emptyStreak++
+	metrics.EmptyTickerResponses.Inc()
+	metrics.ConsecutiveEmptyTickerResponses.Set(float64(s.emptyStreak))
+
+	fields := logrus.Fields{
+		"consecutive_empty": s.emptyStreak,
+		"alert_threshold":   s.emptyAlertThreshold,
+	}
+	if s.emptyAlertThreshold > 0 && s.emptyStreak%s.emptyAlertThreshold == 0 {
+		s.logger.WithFields(fields).Error("ALERT: ticker feed returned no data for consecutive cycles")
+	} else {
+		s.logger.WithFields(fields).Warn("Ticker feed returned no data, cycle skipped")
+	}
+
+	return false
+}
+
 func (s *Scheduler) cleanupData(ctx context.Context) {
 	s.logger.Info("Starting data cleanup cycle")
 
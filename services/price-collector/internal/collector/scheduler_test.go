@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"io"
+	"testing"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestRepeatedEmptyResponsesAlert(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	hook := test.NewLocal(logger)
+	s := &Scheduler{logger: logger, emptyAlertThreshold: 3}
+
+	alerts := func() int {
+		count := 0
+		for _, entry := range hook.AllEntries() {
+			if entry.Level == logrus.ErrorLevel {
+				count++
+			}
+		}
+		return count
+	}
+	emptyBefore := testutil.ToFloat64(metrics.EmptyTickerResponses)
+
+	// Below the threshold each empty cycle only warns
+	for i := 0; i < 2; i++ {
+		if s.recordTickerCount(0) {
+			t.Fatal("empty cycle reported data to process")
+		}
+	}
+	if got := alerts(); got != 0 {
+		t.Fatalf("%d alerts after 2 empty cycles, want none below the threshold of 3", got)
+	}
+
+	s.recordTickerCount(0)
+	if got := alerts(); got != 1 {
+		t.Fatalf("%d alerts after 3 empty cycles, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.ConsecutiveEmptyTickerResponses); got != 3 {
+		t.Errorf("consecutive empty gauge = %v, want 3", got)
+	}
+
+	// A long outage reminds at each further multiple of the threshold
+	for i := 0; i < 3; i++ {
+		s.recordTickerCount(0)
+	}
+	if got := alerts(); got != 2 {
+		t.Errorf("%d alerts after 6 empty cycles, want 2", got)
+	}
+	if got := testutil.ToFloat64(metrics.EmptyTickerResponses) - emptyBefore; got != 6 {
+		t.Errorf("empty response counter rose by %v, want 6", got)
+	}
+
+	// Data resets the streak
+	if !s.recordTickerCount(120) {
+		t.Fatal("cycle with tickers reported nothing to process")
+	}
+	if got := testutil.ToFloat64(metrics.ConsecutiveEmptyTickerResponses); got != 0 {
+		t.Errorf("consecutive empty gauge = %v after recovery, want 0", got)
+	}
+	s.recordTickerCount(0)
+	s.recordTickerCount(0)
+	if got := alerts(); got != 2 {
+		t.Errorf("%d alerts after recovery and 2 empty cycles, want the streak restarted", got)
+	}
+}
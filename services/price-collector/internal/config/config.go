@@ -16,6 +16,17 @@ type Config struct {
 	BatchSize          int
 	MetricsPort        string
 	DataRetentionDays  int
+	// Candle timestamp alignment
+	UseExchangeTimestamp bool
+	MaxClockSkew         time.Duration
+	CollectSpread        bool
+	// Store only symbols KuCoin lists as trading-enabled
+	TradingSymbolsOnly bool
+	SymbolRefresh      time.Duration
+	// Skip normalization for tickers already within column limits
+	NormalizationFastPath bool
+	// Consecutive empty ticker responses before alerting
+	EmptyTickerAlertThreshold int
 }
 
 func Load() *Config {
@@ -28,11 +39,24 @@ func Load() *Config {
 			APISecret:  getEnv("KUCOIN_API_SECRET", ""),
 			Passphrase: getEnv("KUCOIN_PASSPHRASE", ""),
 			Sandbox:    getEnvBool("KUCOIN_SANDBOX", false),
+
+			ThrottleThreshold: getEnvFloat("KUCOIN_THROTTLE_THRESHOLD", 0.2),
+			ErrorBodyLimit:    getEnvInt("KUCOIN_ERROR_BODY_LIMIT", kucoin.DefaultErrorBodyLimit),
 		},
-		CollectionInterval: time.Duration(getEnvInt("COLLECTION_INTERVAL_SECONDS", 60)) * time.Second,
-		BatchSize:          getEnvInt("BATCH_SIZE", 1000),
-		MetricsPort:        getEnv("METRICS_PORT", "8080"),
-		DataRetentionDays:  getEnvInt("PRICE_COLLECTOR_DATA_RETENTION_DAYS", 30),
+		CollectionInterval:   time.Duration(getEnvInt("COLLECTION_INTERVAL_SECONDS", 60)) * time.Second,
+		BatchSize:            getEnvInt("BATCH_SIZE", 1000),
+		MetricsPort:          getEnv("METRICS_PORT", "8080"),
+		DataRetentionDays:    getEnvInt("PRICE_COLLECTOR_DATA_RETENTION_DAYS", 30),
+		UseExchangeTimestamp: getEnvBool("USE_EXCHANGE_TIMESTAMP", true),
+		MaxClockSkew:         time.Duration(getEnvInt("MAX_CLOCK_SKEW_SECONDS", 30)) * time.Second,
+		CollectSpread:        getEnvBool("COLLECT_SPREAD", true),
+
+		TradingSymbolsOnly: getEnvBool("COLLECT_TRADING_SYMBOLS_ONLY", true),
+		SymbolRefresh:      time.Duration(getEnvInt("SYMBOL_REFRESH_MINUTES", 60)) * time.Minute,
+
+		NormalizationFastPath: getEnvBool("NORMALIZATION_FAST_PATH", true),
+
+		EmptyTickerAlertThreshold: getEnvInt("EMPTY_TICKER_ALERT_THRESHOLD", 3),
 	}
 }
 
@@ -52,6 +76,15 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
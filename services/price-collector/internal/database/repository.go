@@ -33,25 +33,27 @@ func (r *Repository) BulkInsertPriceData(ctx context.Context, data []models.Pric
 
 	// Build bulk insert query
 	query := `
-        INSERT INTO price_data (symbol, timestamp, open, high, low, close, volume, quote_volume, change_rate, change_price)
+        INSERT INTO price_data (symbol, timestamp, open, high, low, close, volume, quote_volume, change_rate, change_price, best_bid, best_ask)
         VALUES `
 
 	values := make([]string, 0, len(data))
-	args := make([]interface{}, 0, len(data)*10)
+	args := make([]interface{}, 0, len(data)*12)
 
 	for i, price := range data {
-		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
-			i*10+1, i*10+2, i*10+3, i*10+4, i*10+5, i*10+6, i*10+7, i*10+8, i*10+9, i*10+10))
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+			i*12+1, i*12+2, i*12+3, i*12+4, i*12+5, i*12+6, i*12+7, i*12+8, i*12+9, i*12+10, i*12+11, i*12+12))
 
 		args = append(args, price.Symbol, price.Timestamp, price.Open, price.High,
-			price.Low, price.Close, price.Volume, price.QuoteVolume, price.ChangeRate, price.ChangePrice)
+			price.Low, price.Close, price.Volume, price.QuoteVolume, price.ChangeRate, price.ChangePrice,
+			nullablePrice(price.BestBid), nullablePrice(price.BestAsk))
 	}
 
 	query += strings.Join(values, ", ")
 	query += " ON CONFLICT (symbol, timestamp) DO UPDATE SET " +
 		"open = EXCLUDED.open, high = EXCLUDED.high, low = EXCLUDED.low, " +
 		"close = EXCLUDED.close, volume = EXCLUDED.volume, quote_volume = EXCLUDED.quote_volume, " +
-		"change_rate = EXCLUDED.change_rate, change_price = EXCLUDED.change_price"
+		"change_rate = EXCLUDED.change_rate, change_price = EXCLUDED.change_price, " +
+		"best_bid = EXCLUDED.best_bid, best_ask = EXCLUDED.best_ask"
 
 	_, err := r.db.ExecContext(ctx, query, args...)
 	if err != nil {
@@ -68,6 +70,14 @@ func (r *Repository) BulkInsertPriceData(ctx context.Context, data []models.Pric
 	return nil
 }
 
+// nullablePrice stores an uncollected (zero) quote as NULL
+func nullablePrice(value float64) interface{} {
+	if value <= 0 {
+		return nil
+	}
+	return value
+}
+
 func (r *Repository) GetLatestPriceData(ctx context.Context, symbol string) (*models.PriceData, error) {
 	query := `
         SELECT id, symbol, timestamp, open, high, low, close, volume, quote_volume, change_rate, change_price, created_at
@@ -0,0 +1,23 @@
+package database
+
+import "testing"
+
+func TestNullablePriceStoresMissingSpreadAsNull(t *testing.T) {
+	tests := []struct {
+		name  string
+		value float64
+		want  interface{}
+	}{
+		{name: "collected price", value: 64100.2, want: 64100.2},
+		{name: "not collected", value: 0, want: nil},
+		{name: "invalid", value: -1, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nullablePrice(tt.value); got != tt.want {
+				t.Errorf("nullablePrice(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/database"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
 	"github.com/sirupsen/logrus"
 )
 
@@ -70,6 +71,7 @@ func (h *HealthChecker) StartServer(port string) *http.Server {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", h.Handler())
 	mux.HandleFunc("/ready", h.Handler()) // Kubernetes readiness probe
+	mux.Handle("/metrics", metrics.Handler())
 
 	server := &http.Server{
 		Addr:         ":" + port,
@@ -16,6 +16,8 @@ type PriceData struct {
 	QuoteVolume float64   `db:"quote_volume"`
 	ChangeRate  float64   `db:"change_rate"`
 	ChangePrice float64   `db:"change_price"`
+	BestBid     float64   `db:"best_bid"` // 0 when not collected
+	BestAsk     float64   `db:"best_ask"`
 	CreatedAt   time.Time `db:"created_at"`
 }
 
@@ -29,5 +31,7 @@ type TickerData struct {
 	QuoteVolume float64   `json:"quote_volume"`
 	ChangeRate  float64   `json:"change_rate"`
 	ChangePrice float64   `json:"change_price"`
+	BestBid     float64   `json:"best_bid"`
+	BestAsk     float64   `json:"best_ask"`
 	Timestamp   time.Time `json:"timestamp"`
 }
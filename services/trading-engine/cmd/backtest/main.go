@@ -0,0 +1,94 @@
+// Command backtest replays a symbol's stored minute candles through the
+// signal generator, configured from the same environment as the engine, and
+// reports the simulated trades and their metrics.
+//
+//	go run ./cmd/backtest -symbol BTC-USDT -from 2024-01-01 -to 2024-02-01
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	tradeDB "github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/database"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/backtest"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/config"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/database"
+)
+
+func main() {
+	cfg := config.Load()
+
+	symbol := flag.String("symbol", "", "symbol to backtest, e.g. BTC-USDT")
+	from := flag.String("from", "", "start of the range, as 2006-01-02 or RFC 3339")
+	to := flag.String("to", "", "end of the range, as 2006-01-02 or RFC 3339; defaults to now")
+	size := flag.Float64("size", cfg.DefaultPositionSize, "USDT committed to each trade")
+	slippage := flag.Float64("slippage", 0.001, "fraction of the price lost on every fill")
+	fee := flag.Float64("fee", 0.001, "fraction of the notional charged on every fill")
+	stopLoss := flag.Float64("stop-loss", cfg.StopLossPercent, "stop loss as a fraction of the entry price, 0 disables")
+	takeProfit := flag.Float64("take-profit", cfg.TakeProfitPercent, "take profit as a fraction of the entry price, 0 disables")
+	flag.Parse()
+
+	if *symbol == "" || *from == "" {
+		fmt.Fprintln(os.Stderr, "usage: backtest -symbol <symbol> -from <time> [-to <time>]")
+		os.Exit(2)
+	}
+	start, err := parseTime(*from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -from: %v\n", err)
+		os.Exit(2)
+	}
+	end := time.Now()
+	if *to != "" {
+		if end, err = parseTime(*to); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -to: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	logger := utils.NewLogger("backtest")
+
+	db, err := tradeDB.NewConnection(cfg.Database.DbUri, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to connect to database")
+	}
+	defer db.Close()
+
+	repo := database.NewRepository(db, cfg.MaxHistoryCandles, logger)
+	backtester := backtest.NewBacktester(repo, cfg.Signals.GeneratorConfig(), backtest.Config{
+		Symbol:            *symbol,
+		Start:             start,
+		End:               end,
+		Warmup:            time.Duration(cfg.Signals.BufferCandles(0)) * time.Minute,
+		PositionSize:      *size,
+		Slippage:          *slippage,
+		FeeRate:           *fee,
+		StopLossPercent:   *stopLoss,
+		TakeProfitPercent: *takeProfit,
+	}, logger)
+
+	result, err := backtester.Run(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for _, trade := range result.Trades {
+		fmt.Printf("%s -> %s: entry %v, exit %v (%s), pnl %.4f\n",
+			trade.EntryTime.Format(time.RFC3339), trade.ExitTime.Format(time.RFC3339),
+			trade.EntryPrice, trade.ExitPrice, trade.ExitReason, trade.PnL)
+	}
+	fmt.Printf("%d trades, total pnl %.4f USDT, win rate %.1f%%, max drawdown %.2f%%, sharpe %.2f\n",
+		len(result.Trades), result.TotalPnL, result.WinRate*100, result.MaxDrawdown*100, result.SharpeRatio)
+}
+
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
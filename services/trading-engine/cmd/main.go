@@ -4,22 +4,37 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"sort"
 	"syscall"
 	"time"
 
 	tradeDB "github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/database"
 	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/quotes"
 	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
 
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/api"
 	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/config"
 	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/database"
 	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/exchange"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/marketdata"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/pricing"
 	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/signals"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/sink"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/startup"
 	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/trader"
 
 	"github.com/sirupsen/logrus"
 )
 
+// tradingAccount is the engine trading one configured account and the
+// exchange holding the account's orders and balances
+type tradingAccount struct {
+	name     string
+	exchange *exchange.KuCoinExchange
+	engine   *trader.Engine
+}
+
 func main() {
 	// Initialize logger
 	logger := utils.NewLogger("trading-engine")
@@ -31,8 +46,19 @@ func main() {
 		"trading_interval":       cfg.TradingInterval,
 		"max_positions_per_pair": cfg.MaxPositionsPerPair,
 		"default_position_size":  cfg.DefaultPositionSize,
+		"accounts":               len(cfg.Accounts),
 	}).Info("Configuration loaded")
 
+	if err := cfg.Validate(); err != nil {
+		logger.WithError(err).Fatal("Invalid configuration")
+	}
+	if cfg.RiskReward() > 0 && cfg.RiskReward() < 1 {
+		logger.WithField("risk_reward", cfg.RiskReward()).Warn("Take profit is below stop loss, trading with a negative risk-reward")
+	}
+	if cfg.ObserveMode {
+		logger.Warn("Observe mode: decisions are recorded to would_trade, no orders are placed")
+	}
+
 	// Initialize database connection
 	db, err := tradeDB.NewConnection(cfg.Database.DbUri, logger)
 	if err != nil {
@@ -40,35 +66,401 @@ func main() {
 	}
 	defer db.Close()
 
-	// Initialize KuCoin client
+	// Initialize KuCoin client, used for market data shared by all accounts
 	kucoinClient := kucoin.NewClient(cfg.KuCoin, logger)
 
-	// Initialize services
-	repo := database.NewRepository(db, logger)
-	kucoinExchange := exchange.NewKuCoinExchange(kucoinClient, logger)
-	signalGenerator := signals.NewGenerator(logger)
+	// Initialize services. This repository sees every account and serves
+	// reporting; each engine gets one scoped to its account.
+	repo := database.NewRepository(db, cfg.MaxHistoryCandles, logger)
+	symbolCache := exchange.NewSymbolCache(kucoinClient, cfg.Symbols.RefreshInterval, logger)
+
+	// Windows older than the retained minute data can be filled from the
+	// downsampled hourly candles
+	var priceSource database.PriceHistorySource = repo
+	if cfg.MergeHourlyHistory {
+		priceSource = database.NewMergedPriceHistory(repo)
+	}
+
+	// Indicator windows are held in memory and only new candles are read
+	if cfg.CandleBuffer.Enabled {
+		priceSource = database.NewCandleBuffer(priceSource, cfg.Signals.BufferCandles(cfg.ExitConfirmation.IntervalMinutes),
+			cfg.CandleBuffer.Refresh, logger)
+	}
+
+	// Concurrent indicator and sizing reads for a symbol share one query
+	var priceHistory signals.PriceHistoryProvider = priceSource
+	if cfg.SharePriceHistory {
+		priceHistory = database.NewPriceHistoryGroup(priceSource, time.Minute, logger)
+	}
+
+	signalConfig := cfg.Signals.GeneratorConfig()
+	signalGenerator := signals.NewGenerator(priceHistory, signalConfig, logger)
+
+	// Signal exits of opted-in pairs are confirmed on a higher timeframe
+	var exitSignals *signals.Generator
+	if cfg.ExitConfirmation.IntervalMinutes > 0 {
+		exitConfig := signalConfig
+		exitConfig.PriceDataIntervalMinutes = cfg.ExitConfirmation.IntervalMinutes
+		exitSignals = signals.NewGenerator(priceHistory, exitConfig, logger)
+	}
 
 	// Initialize trading engine
 	engineConfig := trader.EngineConfig{
-		MaxPositionsPerPair: cfg.MaxPositionsPerPair,
-		DefaultPositionSize: cfg.DefaultPositionSize,
-		StopLossPercent:     cfg.StopLossPercent,
-		TakeProfitPercent:   cfg.TakeProfitPercent,
+		MaxPositionsPerPair:  cfg.MaxPositionsPerPair,
+		DefaultPositionSize:  cfg.DefaultPositionSize,
+		StopLossPercent:      cfg.StopLossPercent,
+		TakeProfitPercent:    cfg.TakeProfitPercent,
+		TakeProfitLevels:     cfg.TakeProfitLevels,
+		ExitTieBreak:         cfg.ExitTieBreak,
+		FlattenDisabledPairs: cfg.FlattenDisabledPairs,
+		MaxRiskPerTradeUSDT:  cfg.MaxRiskPerTradeUSDT,
+		MinRiskReward:        cfg.MinRiskReward,
+		ExposureMode:         cfg.ExposureMode,
+		SkipIdleHolds:        cfg.SkipIdleHolds,
+
+		MaxPortfolioBeta: cfg.Beta.MaxPortfolio,
+		BetaReference:    cfg.Beta.Reference,
+		BetaWindow:       cfg.Beta.Window,
+
+		GridRecenterMargin: cfg.GridRecenterMargin,
+
+		GridOrdersEnabled:    cfg.GridOrdersEnabled,
+		GridOrderCancelAfter: cfg.GridCancelAfter,
+
+		StrategyTag:   cfg.StrategyTag,
+		ConfigVersion: cfg.ConfigVersion,
+
+		TrailingStopPercent:    cfg.TrailingStop.Percent,
+		TrailingStopActivation: cfg.TrailingStop.Activation,
+
+		TrackExcursions: cfg.TrackExcursions,
+		RecordDecisions: cfg.RecordDecisions,
+
+		PnLWriteRetries:    cfg.PnLWriteRetries,
+		PnLWriteRetryDelay: cfg.PnLWriteRetryDelay,
+
+		PortfolioMetrics: cfg.PortfolioMetrics,
+
+		ExitFeeFloorEnabled: cfg.FeeFloor.Enabled,
+		ExitFeeRate:         cfg.FeeFloor.FeeRate,
+		ExitMinNetPnL:       cfg.FeeFloor.MinNetPnL,
+
+		SizingMode:                 cfg.Sizing.Mode,
+		DefaultPositionSizeBase:    cfg.Sizing.BaseQuantity,
+		DefaultPositionSizePercent: cfg.Sizing.BalancePercent,
+
+		ConfirmExitsDefault: cfg.ExitConfirmation.Default,
+
+		SizingVolatilityModel:  cfg.Sizing.VolatilityModel,
+		SizingEWMALambda:       cfg.Sizing.EWMALambda,
+		SizingTargetVolatility: cfg.Sizing.TargetVolatility,
+		SizingVolatilityWindow: cfg.Sizing.VolatilityWindow,
+
+		AdaptiveSizingEnabled:       cfg.Sizing.AdaptiveEnabled,
+		AdaptiveSizingLookback:      cfg.Sizing.AdaptiveLookback,
+		AdaptiveSizingMinTrades:     cfg.Sizing.AdaptiveMinTrades,
+		AdaptiveSizingMinMultiplier: cfg.Sizing.AdaptiveMinMultiplier,
+		AdaptiveSizingMaxMultiplier: cfg.Sizing.AdaptiveMaxMultiplier,
+
+		SizeRampEnabled:       cfg.Sizing.RampEnabled,
+		SizeRampStartFraction: cfg.Sizing.RampStartFraction,
+		SizeRampTrades:        cfg.Sizing.RampTrades,
+		SizeRampPnL:           cfg.Sizing.RampPnL,
+
+		LiquidityMaxDepthFraction: cfg.Liquidity.MaxDepthFraction,
+		LiquidityDepthBps:         cfg.Liquidity.DepthBps,
+
+		LossVelocityMaxLossUSDT: cfg.LossVelocity.MaxLossUSDT,
+		LossVelocityWindow:      cfg.LossVelocity.Window,
+		LossVelocityCooldown:    cfg.LossVelocity.Cooldown,
+
+		DailyMaxLossUSDT: cfg.DailyMaxLossUSDT,
+
+		FlashCrashDropPercent: cfg.FlashCrash.DropPercent,
+		FlashCrashWindow:      cfg.FlashCrash.Window,
+		FlashCrashCooldown:    cfg.FlashCrash.Cooldown,
+		FlashCrashAllowExits:  cfg.FlashCrash.AllowExits,
+
+		PersistHalts: cfg.PersistRiskHalts,
+
+		ObserveOnly: cfg.ObserveMode,
+
+		FlatlineCloses:   cfg.Flatline.Closes,
+		FlatlineLookback: cfg.Flatline.Lookback,
+
+		PauseOnPriceDivergence: cfg.ReferencePrice.PauseOnDivergence,
+
+		BracketOrdersEnabled:   cfg.Brackets.Enabled,
+		BracketStopLimitOffset: cfg.Brackets.StopLimitOffset,
+
+		FillReconciliationEnabled: cfg.ReconcileFills,
+		FillReconciliationWorkers: cfg.FillReconcileWorkers,
+
+		StrandedOrderTimeout: cfg.StrandedOrderTimeout,
+
+		MaxPriceAge: cfg.MaxPriceAge,
+
+		MaxOpenOrdersPerSymbol: cfg.MaxOpenOrders,
+		StaleOrderMaxAge:       cfg.StaleOrderMaxAge,
+
+		EntryAdverseBand: cfg.EntryAdverseBand,
+		EntryChaseBand:   cfg.EntryChaseBand,
+
+		BlockOnStaleQuoteRate: cfg.QuoteRates.BlockOnStale,
+
+		ConfigRetryDelay:      cfg.ConfigRetryDelay,
+		ConfigRetryMaxDelay:   cfg.ConfigRetryMax,
+		ConfigQuarantineAfter: cfg.QuarantineAfter,
+
+		DriftWindow:           cfg.Drift.Window,
+		DriftCheckInterval:    cfg.Drift.CheckInterval,
+		DriftMinTrades:        cfg.Drift.MinTrades,
+		DriftWinRateTolerance: cfg.Drift.WinRateTolerance,
+		DriftAvgPnLTolerance:  cfg.Drift.AvgPnLTolerance,
+	}
+
+	// Settled fills are checked against the account's fee tier
+	if cfg.FeeCheck.Enabled {
+		if !cfg.ReconcileFills {
+			logger.Warn("Fee reconciliation requires FILL_RECONCILIATION_ENABLED, check disabled")
+		}
+		engineConfig.FeeReconcileTolerance = cfg.FeeCheck.Tolerance
+	}
+
+	// Grid fills are only seen once fill reconciliation settles the orders
+	if cfg.GridOrdersEnabled && !cfg.ReconcileFills {
+		logger.Warn("Grid orders require FILL_RECONCILIATION_ENABLED to turn fills into positions")
+	}
+
+	// Initialize reference price sources
+	var referencePrices *pricing.ReferenceChecker
+	if cfg.ReferencePrice.Enabled {
+		var sources []pricing.PriceSource
+		for _, name := range cfg.ReferencePrice.Sources {
+			switch name {
+			case "binance":
+				sources = append(sources, pricing.NewBinanceSource())
+			default:
+				logger.WithField("source", name).Warn("Unknown reference price source, ignoring")
+			}
+		}
+		if len(sources) > 0 {
+			referencePrices = pricing.NewReferenceChecker(sources, cfg.ReferencePrice.MaxDivergence, logger)
+		}
+	}
+
+	// Initialize the order book feed, also used to cap sizes by liquidity
+	var orderBooks *marketdata.OrderBookManager
+	var dedup *marketdata.MessageDeduper
+	var depth trader.DepthProvider
+	if cfg.OrderBook.Enabled {
+		if cfg.OrderBook.DedupEnabled {
+			dedup = marketdata.NewMessageDeduper(repo, cfg.OrderBook.WatermarkFlushRate, logger)
+			if err := dedup.Load(context.Background()); err != nil {
+				logger.WithError(err).Warn("Failed to load websocket watermarks, starting without them")
+			}
+		}
+
+		orderBooks = marketdata.NewOrderBookManager(kucoinClient, func(ctx context.Context) ([]string, error) {
+			pairs, err := repo.GetActiveSelectedPairs(ctx)
+			if err != nil {
+				return nil, err
+			}
+			symbols := make([]string, 0, len(pairs))
+			for _, pair := range pairs {
+				symbols = append(symbols, pair.Symbol)
+			}
+			return symbols, nil
+		}, cfg.OrderBook.RefreshInterval, dedup, logger)
+		depth = orderBooks
+	} else if cfg.Liquidity.MaxDepthFraction > 0 {
+		logger.Warn("Liquidity sizing cap requires ORDER_BOOK_ENABLED, cap disabled")
 	}
 
-	engine := trader.NewEngine(repo, kucoinExchange, signalGenerator, engineConfig, logger)
+	// Orders can be priced from the live book instead of the stored close
+	var livePrices trader.LivePriceProvider
+	if cfg.LiveOrderPricing {
+		livePrices = marketdata.NewLivePrices(kucoinClient, orderBooks, cfg.LivePriceCacheTTL, logger)
+	}
+
+	// Closed trades can be pushed to external analytics sinks
+	var sinks []sink.Sink
+	if cfg.TradeSink.WebhookURL != "" {
+		sinks = append(sinks, sink.NewWebhookSink(cfg.TradeSink.WebhookURL))
+	}
+	if cfg.TradeSink.FilePath != "" {
+		sinks = append(sinks, sink.NewFileSink(cfg.TradeSink.FilePath))
+	}
+	var tradeSinks *sink.Dispatcher
+	if len(sinks) > 0 {
+		tradeSinks = sink.NewDispatcher(sinks, cfg.TradeSink.Buffer, cfg.TradeSink.SendTimeout, logger)
+	}
+
+	// Basic strategy decisions can be recorded and replayed against later
+	// code with cmd/replay
+	var decisionRecorder *trader.DecisionRecorder
+	if cfg.DecisionRecordFile != "" {
+		decisionRecorder, err = trader.NewDecisionRecorder(cfg.DecisionRecordFile, logger)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to open decision record file")
+		}
+		defer decisionRecorder.Close()
+	}
+
+	// Pairs quoted in other currencies are valued in USDT for exposure limits
+	var quoteRates *quotes.Converter
+	if cfg.QuoteRates.Enabled {
+		quoteRates = quotes.NewConverter(repo, cfg.QuoteRates.TTL, cfg.QuoteRates.MaxAge, logger)
+	}
+
+	// Each account trades with its own credentials, positions and risk limits
+	accounts := make([]tradingAccount, 0, len(cfg.Accounts))
+	for _, account := range cfg.Accounts {
+		accountRepo := repo.ForAccount(account.Name)
+
+		var failedOrders exchange.FailedOrderRecorder
+		if cfg.RecordFailedOrders {
+			failedOrders = accountRepo
+		}
+		// Fee tiers are per account, so each caches its own rates
+		accountClient := kucoin.NewClient(account.KuCoin, logger)
+		var feeRates *exchange.FeeRateCache
+		if cfg.FeeCheck.Enabled {
+			feeRates = exchange.NewFeeRateCache(accountClient, cfg.FeeCheck.RateTTL, logger)
+		}
+		accountExchange := exchange.NewKuCoinExchange(accountClient, symbolCache, failedOrders, feeRates, logger)
+
+		accountConfig := engineConfig
+		accountConfig.MaxPositionsPerPair = account.MaxPositionsPerPair
+		accountConfig.DefaultPositionSize = account.DefaultPositionSize
+		accountConfig.MaxRiskPerTradeUSDT = account.MaxRiskPerTradeUSDT
+		accountConfig.LossVelocityMaxLossUSDT = account.MaxLossUSDT
+		accountConfig.DailyMaxLossUSDT = account.DailyMaxLossUSDT
+
+		accounts = append(accounts, tradingAccount{
+			name:     account.Name,
+			exchange: accountExchange,
+			engine:   trader.NewEngine(accountRepo, accountExchange, priceHistory, signalGenerator, exitSignals, referencePrices, depth, livePrices, tradeSinks, decisionRecorder, quoteRates, accountConfig, logger),
+		})
+	}
+
+	// Reports can additionally be shown in a fiat display currency
+	var displayConverter *pricing.DisplayConverter
+	if cfg.Reporting.DisplayCurrency != "" {
+		var rateSource pricing.FiatRateSource
+		switch cfg.Reporting.RateSource {
+		case "static":
+			rateSource = pricing.NewStaticRateSource(cfg.Reporting.StaticRate)
+		case "exchangerate":
+			rateSource = pricing.NewExchangeRateSource()
+		default:
+			logger.WithField("source", cfg.Reporting.RateSource).Warn("Unknown fiat rate source, reporting in USDT")
+		}
+		if rateSource != nil {
+			displayConverter = pricing.NewDisplayConverter(rateSource, cfg.Reporting.DisplayCurrency, cfg.Reporting.RateTTL, logger)
+		}
+	}
+
+	// Reports flag near-simultaneous opposite fills that net to nothing
+	var offsetDetector *trader.OffsetDetector
+	if cfg.Reporting.OffsettingWindow > 0 {
+		offsetDetector = trader.NewOffsetDetector(cfg.Reporting.OffsettingWindow, cfg.Reporting.OffsettingTolerance)
+	}
+
+	// Live results can be compared against backtest baselines
+	var driftMonitor *trader.DriftMonitor
+	if cfg.Drift.Enabled {
+		driftMonitor = trader.NewDriftMonitor(repo, engineConfig, logger)
+	}
+
+	// Exposure reports include the correlation-adjusted net of hedged positions
+	exposureCalculator := trader.NewExposureCalculator(priceHistory, quoteRates, cfg.ExposureCorrelation, logger)
+
+	// Initialize API server (health checks and operator endpoints)
+	if cfg.APIToken == "" {
+		logger.Warn("API_TOKEN is not set, operator endpoints that change state will reject every request")
+	}
+	apiServer := api.NewServer(db, repo, displayConverter, offsetDetector, driftMonitor, exposureCalculator, cfg.MinRiskReward, cfg.APIToken, logger)
+	httpServer := apiServer.Start(cfg.MetricsPort)
 
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Start the trading engine
+	// Verify every dependency in order before trading; /ready stays unready
+	// until this succeeds and any failure stops the service
+	sequence := startup.NewSequence(cfg.StartupStepTimeout, logger).
+		Add("database", func(ctx context.Context) error { return db.HealthCheck() }).
+		Add("schema", repo.VerifySchema)
+	for _, account := range accounts {
+		if cfg.VerifyExchangeAuth {
+			sequence.Add("exchange_auth:"+account.name, func(ctx context.Context) error { return account.exchange.VerifyAuth() })
+		}
+		sequence.Add("reconcile:"+account.name, account.engine.Reconcile)
+	}
+
+	if err := sequence.Run(ctx); err != nil {
+		logger.WithError(err).Fatal("Startup sequence failed")
+	}
+
+	// Start one trading engine per account
+	for _, account := range accounts {
+		go func() {
+			if err := account.engine.Run(ctx); err != nil {
+				logger.WithError(err).WithField("account", account.name).Error("Trading engine stopped with error")
+			}
+		}()
+	}
+
+	// Keep symbol trading rules current
 	go func() {
-		if err := engine.Run(ctx); err != nil {
-			logger.WithError(err).Error("Trading engine stopped with error")
+		if err := symbolCache.Run(ctx); err != nil {
+			logger.WithError(err).Error("Symbol metadata refresh stopped with error")
 		}
 	}()
 
+	// Compare live results with backtest baselines
+	if driftMonitor != nil {
+		go func() {
+			if err := driftMonitor.Run(ctx); err != nil {
+				logger.WithError(err).Error("Drift monitor stopped with error")
+			}
+		}()
+	}
+
+	// Start the order book feed for active pairs
+	if orderBooks != nil {
+		go func() {
+			if err := orderBooks.Run(ctx); err != nil {
+				logger.WithError(err).Error("Order book manager stopped with error")
+			}
+		}()
+	}
+
+	// Deliver trade events; stopped only after the engines, so events of the
+	// final cycle are still delivered
+	sinkCtx, sinkCancel := context.WithCancel(context.Background())
+	sinkDone := make(chan struct{})
+	go func() {
+		defer close(sinkDone)
+		if err := tradeSinks.Run(sinkCtx); err != nil {
+			logger.WithError(err).Error("Trade event delivery stopped with error")
+		}
+	}()
+
+	// Persist processed websocket sequences
+	dedupDone := make(chan struct{})
+	go func() {
+		defer close(dedupDone)
+		if dedup == nil {
+			return
+		}
+		if err := dedup.Run(ctx); err != nil {
+			logger.WithError(err).Error("Failed to persist websocket watermarks on shutdown")
+		}
+	}()
+
+	apiServer.SetReady(true)
 	logger.Info("Trading engine service started successfully")
 
 	// Wait for interrupt signal to gracefully shutdown
@@ -81,8 +473,56 @@ func main() {
 	// Cancel context to stop trading engine
 	cancel()
 
-	// Give some time for graceful shutdown
-	time.Sleep(2 * time.Second)
+	// Shutdown API server
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logger.WithError(err).Error("Failed to shutdown API server gracefully")
+	}
+
+	// Wait for the trading cycles in progress to finish, all accounts
+	// sharing one deadline
+	done := make(map[string]<-chan struct{}, len(accounts))
+	for _, account := range accounts {
+		done[account.name] = account.engine.Done()
+	}
+	if running := waitStopped(done, cfg.ShutdownTimeout); len(running) > 0 {
+		logger.WithFields(logrus.Fields{
+			"accounts": running,
+			"timeout":  cfg.ShutdownTimeout,
+		}).Warn("Trading engines did not stop in time, exiting anyway")
+	}
+	sinkCancel()
+	<-sinkDone
+	<-dedupDone
 
 	logger.Info("Trading engine service stopped")
 }
+
+// waitStopped waits until every done channel is closed or the timeout
+// expires, and returns the accounts whose engines were still running at the
+// deadline, sorted by name
+func waitStopped(done map[string]<-chan struct{}, timeout time.Duration) []string {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for _, ch := range done {
+		select {
+		case <-ch:
+		case <-timer.C:
+			var running []string
+			for name, ch := range done {
+				select {
+				case <-ch:
+				default:
+					running = append(running, name)
+				}
+			}
+			sort.Strings(running)
+			return running
+		}
+	}
+
+	return nil
+}
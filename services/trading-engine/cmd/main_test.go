@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWaitStoppedReturnsOnceAllStopped(t *testing.T) {
+	a, b := make(chan struct{}), make(chan struct{})
+	close(a)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(b)
+	}()
+
+	running := waitStopped(map[string]<-chan struct{}{"a": a, "b": b}, time.Second)
+	if running != nil {
+		t.Fatalf("expected every engine stopped, got %v still running", running)
+	}
+}
+
+func TestWaitStoppedSharesOneDeadline(t *testing.T) {
+	stopped := make(chan struct{})
+	close(stopped)
+
+	// Two engines that never stop must not each get the full timeout, and
+	// the wait must not hang on the second once the deadline has passed
+	start := time.Now()
+	running := waitStopped(map[string]<-chan struct{}{
+		"main":    make(chan struct{}),
+		"second":  make(chan struct{}),
+		"stopped": stopped,
+	}, 50*time.Millisecond)
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("wait took %v, expected about the 50ms timeout", elapsed)
+	}
+	if want := []string{"main", "second"}; !reflect.DeepEqual(running, want) {
+		t.Fatalf("running = %v, want %v", running, want)
+	}
+}
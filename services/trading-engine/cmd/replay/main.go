@@ -0,0 +1,52 @@
+// Command replay decides the basic strategy decisions recorded by the engine
+// (DECISION_RECORD_FILE) again with the current code and reports every
+// decision that changed. It exits with status 1 when any did, so it can guard
+// strategy changes against unintended behaviour changes.
+//
+//	go run ./cmd/replay decisions.jsonl
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/trader"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: replay <decision record file>")
+		os.Exit(2)
+	}
+
+	file, err := os.Open(os.Args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open decision records: %v\n", err)
+		os.Exit(2)
+	}
+	defer file.Close()
+
+	diffs, replayed, err := trader.ReplayDecisions(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	for _, diff := range diffs {
+		fmt.Printf("line %d: %s at %s (signal %s, price %v): recorded %s, replayed %s\n",
+			diff.Line, diff.Record.Symbol, diff.Record.RecordedAt.Format("2006-01-02T15:04:05Z07:00"),
+			diff.Record.Signal.Action, diff.Record.Price, describe(diff.Record.Decision), describe(diff.Replayed))
+	}
+	fmt.Printf("%d decisions replayed, %d changed\n", replayed, len(diffs))
+
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+}
+
+func describe(decision trader.BasicDecision) string {
+	if decision.PositionID != "" {
+		return decision.Action + " " + decision.PositionID
+	}
+	return decision.Action
+}
@@ -3,14 +3,27 @@ module github.com/paaavkata/crypto-trading-bot-v4/trading-engine
 go 1.23.3
 
 require (
+	github.com/go-resty/resty/v2 v2.16.5
 	github.com/google/uuid v1.4.0
+	github.com/markcheno/go-talib v0.0.0-20250114000313-ec55a20c902f
 	github.com/paaavkata/crypto-trading-bot-v4/shared v0.0.0-20250528155433-b5b9ac4e36cc
+	github.com/prometheus/client_golang v1.19.1
 	github.com/sirupsen/logrus v1.9.3
+	golang.org/x/sync v0.10.0
 )
 
 require (
-	github.com/go-resty/resty/v2 v2.16.5 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/gorilla/websocket v1.5.3 // indirect
 	github.com/lib/pq v1.10.9 // indirect
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.48.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
 	golang.org/x/net v0.33.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
 )
+
+replace github.com/paaavkata/crypto-trading-bot-v4/shared => ../../shared
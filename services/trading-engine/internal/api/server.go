@@ -0,0 +1,738 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	sharedDB "github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/database"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/database"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/pricing"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/trader"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// configStore reads and overrides the active trading config of a pair
+type configStore interface {
+	GetTradingConfig(ctx context.Context, pairID int64) (*models.TradingConfig, error)
+	UpdateTradingConfig(ctx context.Context, config models.TradingConfig) error
+}
+
+type Server struct {
+	db         *sharedDB.DB
+	repo       *database.Repository
+	configs    configStore
+	display    *pricing.DisplayConverter  // nil reports in USDT only
+	offsetting *trader.OffsetDetector     // nil disables offsetting fill detection
+	drift      *trader.DriftMonitor       // nil when drift monitoring is disabled
+	exposure   *trader.ExposureCalculator // Gross and correlation-adjusted net exposure
+	ready      atomic.Bool                // Set once the startup sequence has completed
+	logger     *logrus.Logger
+
+	minRiskReward float64 // Least risk-reward a trading config update may set
+	apiToken      string  // Bearer token state-changing requests must carry
+}
+
+type HealthStatus struct {
+	Status    string            `json:"status"`
+	Timestamp time.Time         `json:"timestamp"`
+	Services  map[string]string `json:"services"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewServer(db *sharedDB.DB, repo *database.Repository, display *pricing.DisplayConverter,
+	offsetting *trader.OffsetDetector, drift *trader.DriftMonitor, exposure *trader.ExposureCalculator,
+	minRiskReward float64, apiToken string, logger *logrus.Logger) *Server {
+
+	return &Server{
+		db:            db,
+		repo:          repo,
+		configs:       repo,
+		display:       display,
+		offsetting:    offsetting,
+		drift:         drift,
+		exposure:      exposure,
+		logger:        logger,
+		minRiskReward: minRiskReward,
+		apiToken:      apiToken,
+	}
+}
+
+func (s *Server) Start(port string) *http.Server {
+	server := &http.Server{
+		Addr:         ":" + port,
+		Handler:      s.routes(),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		s.logger.WithField("port", port).Info("Starting API server")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			s.logger.WithError(err).Error("API server failed")
+		}
+	}()
+
+	return server
+}
+
+// routes returns the API's handler, with every state-changing route behind
+// the bearer token
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/ready", s.handleReady) // Kubernetes readiness probe
+	mux.HandleFunc("POST /pairs/{symbol}/trading", s.handleSetPairTrading)
+	mux.HandleFunc("PUT /configs/{pairId}", s.handleUpdateTradingConfig)
+	mux.HandleFunc("GET /trades", s.handleTradesExport)
+	mux.HandleFunc("GET /exposure", s.handleExposure)
+	mux.HandleFunc("GET /orders/failed", s.handleFailedOrders)
+	mux.HandleFunc("PUT /baselines", s.handleSetBaseline)
+	mux.HandleFunc("GET /drift", s.handleDrift)
+	mux.HandleFunc("GET /decisions/{id}", s.handleTradeDecision)
+	mux.Handle("/metrics", metrics.Handler())
+
+	return s.requireToken(mux)
+}
+
+// requireToken rejects any request other than a read that does not carry the
+// configured bearer token. Without a configured token no such request is
+// accepted.
+func (s *Server) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.apiToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.apiToken)) != 1 {
+			s.logger.WithFields(logrus.Fields{
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"remote_addr": r.RemoteAddr,
+			}).Warn("Rejected unauthenticated API request")
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "a valid bearer token is required"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SetReady marks the service ready to receive traffic once startup has
+// completed
+func (s *Server) SetReady(ready bool) {
+	s.ready.Store(ready)
+}
+
+// handleReady reports unready until the startup sequence has completed, and
+// then follows the health check
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !s.ready.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, HealthStatus{
+			Status:    "starting",
+			Timestamp: time.Now(),
+			Services:  map[string]string{},
+		})
+		return
+	}
+	s.handleHealth(w, r)
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	services := make(map[string]string)
+	status := HealthStatus{Status: "healthy", Timestamp: time.Now(), Services: services}
+
+	if err := s.db.HealthCheck(); err != nil {
+		services["database"] = "unhealthy: " + err.Error()
+		status.Status = "unhealthy"
+		s.logger.WithError(err).Error("Database health check failed")
+	} else {
+		services["database"] = "healthy"
+	}
+
+	code := http.StatusOK
+	if status.Status != "healthy" {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
+
+type setPairTradingRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+func (s *Server) handleSetPairTrading(w http.ResponseWriter, r *http.Request) {
+	symbol := r.PathValue("symbol")
+
+	var req setPairTradingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: `request body must be {"enabled": true|false}`})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := s.repo.SetPairTradingEnabled(ctx, symbol, *req.Enabled); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "pair not found: " + symbol})
+			return
+		}
+		s.logger.WithError(err).WithField("symbol", symbol).Error("Failed to update pair trading flag")
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "failed to update pair"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"symbol":          symbol,
+		"trading_enabled": *req.Enabled,
+	})
+}
+
+// TradingConfigUpdate overrides settings of a pair's trading config; fields
+// left out keep their current value
+type TradingConfigUpdate struct {
+	StopLossPercent     *float64 `json:"stop_loss_percent"`
+	TakeProfitPercent   *float64 `json:"take_profit_percent"`
+	GridLevels          *int     `json:"grid_levels"`
+	PriceRangeMin       *float64 `json:"price_range_min"`
+	PriceRangeMax       *float64 `json:"price_range_max"`
+	MaxPositions        *int     `json:"max_positions"`
+	PositionSizeUSDT    *float64 `json:"position_size_usdt"`
+	TrailingStopPercent *float64 `json:"trailing_stop_percent"`
+}
+
+// TradingConfigResponse is a pair's trading config after an update
+type TradingConfigResponse struct {
+	ID                  string  `json:"id"`
+	PairID              int64   `json:"pair_id"`
+	StrategyType        string  `json:"strategy_type"`
+	StopLossPercent     float64 `json:"stop_loss_percent"`
+	TakeProfitPercent   float64 `json:"take_profit_percent"`
+	GridLevels          int     `json:"grid_levels"`
+	PriceRangeMin       float64 `json:"price_range_min"`
+	PriceRangeMax       float64 `json:"price_range_max"`
+	MaxPositions        int     `json:"max_positions"`
+	PositionSizeUSDT    float64 `json:"position_size_usdt"`
+	TrailingStopPercent float64 `json:"trailing_stop_percent"`
+}
+
+// handleUpdateTradingConfig overrides the SL/TP, grid and sizing settings of
+// a pair's active trading config after validating the result. The previous
+// and new values are logged, and the engine trades on them from the pair's
+// next cycle.
+func (s *Server) handleUpdateTradingConfig(w http.ResponseWriter, r *http.Request) {
+	pairID, err := strconv.ParseInt(r.PathValue("pairId"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "pair ID must be an integer"})
+		return
+	}
+
+	var req TradingConfigUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "invalid trading config body: " + err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	current, err := s.configs.GetTradingConfig(ctx, pairID)
+	if err != nil {
+		s.logger.WithError(err).WithField("pair_id", pairID).Error("Failed to load trading config")
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "failed to load trading config"})
+		return
+	}
+	if current == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "no active trading config for pair " + r.PathValue("pairId")})
+		return
+	}
+
+	updated := *current
+	if req.StopLossPercent != nil {
+		updated.StopLossPercent = *req.StopLossPercent
+	}
+	if req.TakeProfitPercent != nil {
+		updated.TakeProfitPercent = *req.TakeProfitPercent
+	}
+	if req.GridLevels != nil {
+		updated.GridLevels = *req.GridLevels
+	}
+	if req.PriceRangeMin != nil {
+		updated.PriceRangeMin = *req.PriceRangeMin
+	}
+	if req.PriceRangeMax != nil {
+		updated.PriceRangeMax = *req.PriceRangeMax
+	}
+	if req.MaxPositions != nil {
+		updated.MaxPositions = *req.MaxPositions
+	}
+	if req.PositionSizeUSDT != nil {
+		updated.PositionSizeUSDT = *req.PositionSizeUSDT
+	}
+	if req.TrailingStopPercent != nil {
+		updated.TrailingStopPercent = *req.TrailingStopPercent
+	}
+
+	if err := updated.Validate(s.minRiskReward); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := s.configs.UpdateTradingConfig(ctx, updated); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "trading config no longer exists"})
+			return
+		}
+		s.logger.WithError(err).WithField("pair_id", pairID).Error("Failed to update trading config")
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "failed to update trading config"})
+		return
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"pair_id":     pairID,
+		"config_id":   updated.ID,
+		"remote_addr": r.RemoteAddr,
+		"old_sl":      current.StopLossPercent,
+		"new_sl":      updated.StopLossPercent,
+		"old_tp":      current.TakeProfitPercent,
+		"new_tp":      updated.TakeProfitPercent,
+		"old_grid":    current.GridLevels,
+		"new_grid":    updated.GridLevels,
+		"old_range":   []float64{current.PriceRangeMin, current.PriceRangeMax},
+		"new_range":   []float64{updated.PriceRangeMin, updated.PriceRangeMax},
+		"old_max_pos": current.MaxPositions,
+		"new_max_pos": updated.MaxPositions,
+		"old_size":    current.PositionSizeUSDT,
+		"new_size":    updated.PositionSizeUSDT,
+		"old_trail":   current.TrailingStopPercent,
+		"new_trail":   updated.TrailingStopPercent,
+	}).Info("Updated trading config")
+
+	writeJSON(w, http.StatusOK, TradingConfigResponse{
+		ID:                  updated.ID,
+		PairID:              updated.PairID,
+		StrategyType:        updated.StrategyType,
+		StopLossPercent:     updated.StopLossPercent,
+		TakeProfitPercent:   updated.TakeProfitPercent,
+		GridLevels:          updated.GridLevels,
+		PriceRangeMin:       updated.PriceRangeMin,
+		PriceRangeMax:       updated.PriceRangeMax,
+		MaxPositions:        updated.MaxPositions,
+		PositionSizeUSDT:    updated.PositionSizeUSDT,
+		TrailingStopPercent: updated.TrailingStopPercent,
+	})
+}
+
+// TradeExport is a closed position as exposed by the trades export
+type TradeExport struct {
+	PositionID    string     `json:"position_id"`
+	PairID        int64      `json:"pair_id"`
+	Side          string     `json:"side"`
+	Quantity      float64    `json:"quantity"`
+	EntryPrice    float64    `json:"entry_price"`
+	ExitPrice     float64    `json:"exit_price"`
+	RealizedPnL   float64    `json:"realized_pnl"` // Net of TotalFees
+	TotalFees     float64    `json:"total_fees"`
+	StrategyTag   string     `json:"strategy_tag"`
+	ConfigVersion string     `json:"config_version"`
+	OpenedAt      time.Time  `json:"opened_at"`
+	ClosedAt      *time.Time `json:"closed_at"`
+
+	// Furthest the price moved in favour of and against the trade, as
+	// fractions of the entry price
+	MaxFavorableExcursion float64 `json:"max_favorable_excursion"`
+	MaxAdverseExcursion   float64 `json:"max_adverse_excursion"`
+
+	// Realized PnL converted to the display currency; the figures above stay
+	// in USDT
+	DisplayCurrency    string  `json:"display_currency"`
+	DisplayRate        float64 `json:"display_rate"`
+	DisplayFallback    bool    `json:"display_fallback"`
+	RealizedPnLDisplay float64 `json:"realized_pnl_display"`
+
+	// Set when the position's entry or exit was offset by a near-simultaneous
+	// opposite fill of another position on the same pair
+	Offsetting bool `json:"offsetting"`
+}
+
+// ExposureReport summarizes open positions in USDT and the display currency
+type ExposureReport struct {
+	OpenPositions     int       `json:"open_positions"`
+	ExposureUSDT      float64   `json:"exposure_usdt"`
+	NetExposureUSDT   float64   `json:"net_exposure_usdt"` // After offsetting longs against correlated shorts
+	UnrealizedPnLUSDT float64   `json:"unrealized_pnl_usdt"`
+	StaleQuoteRates   bool      `json:"stale_quote_rates"` // Some positions were valued with a stale or missing quote rate
+	DisplayCurrency   string    `json:"display_currency"`
+	DisplayRate       float64   `json:"display_rate"`
+	DisplayFallback   bool      `json:"display_fallback"`
+	Exposure          float64   `json:"exposure"`
+	UnrealizedPnL     float64   `json:"unrealized_pnl"`
+	Timestamp         time.Time `json:"timestamp"`
+}
+
+type FailedOrderResponse struct {
+	ID           string    `json:"id"`
+	Symbol       string    `json:"symbol"`
+	ClientOid    string    `json:"client_oid"`
+	Side         string    `json:"side"`
+	Type         string    `json:"type"`
+	Quantity     float64   `json:"quantity"`
+	Price        float64   `json:"price"`
+	ErrorCode    string    `json:"error_code"`
+	ErrorMessage string    `json:"error_message"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// handleTradesExport lists closed positions with their strategy attribution.
+// Accepts an RFC3339 "since" (default 30 days ago), "format=csv", and
+// "exclude_offsetting=true" to net out positions involved in offsetting fills.
+func (s *Server) handleTradesExport(w http.ResponseWriter, r *http.Request) {
+	since := time.Now().AddDate(0, 0, -30)
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "since must be an RFC3339 timestamp"})
+			return
+		}
+		since = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	positions, err := s.repo.GetClosedPositions(ctx, since)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to export trades")
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "failed to load trades"})
+		return
+	}
+
+	offsetting, err := s.offsettingPositions(ctx, since)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to detect offsetting fills, exporting without annotation")
+	}
+	excludeOffsetting := r.URL.Query().Get("exclude_offsetting") == "true"
+
+	conversion := s.display.Conversion(ctx)
+
+	trades := make([]TradeExport, 0, len(positions))
+	for _, position := range positions {
+		if excludeOffsetting && offsetting[position.ID] {
+			continue
+		}
+
+		trades = append(trades, newTradeExport(position, conversion, offsetting[position.ID]))
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		writeTradesCSV(w, trades)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, trades)
+}
+
+// newTradeExport describes a closed position for the trades export
+func newTradeExport(position models.Position, conversion pricing.Conversion, offsetting bool) TradeExport {
+	return TradeExport{
+		PositionID:    position.ID,
+		PairID:        position.PairID,
+		Side:          position.Side,
+		Quantity:      position.Quantity,
+		EntryPrice:    position.EntryPrice,
+		ExitPrice:     position.CurrentPrice,
+		RealizedPnL:   position.RealizedPnL,
+		TotalFees:     position.TotalFees,
+		StrategyTag:   position.StrategyTag,
+		ConfigVersion: position.ConfigVersion,
+		OpenedAt:      position.CreatedAt,
+		ClosedAt:      position.ClosedAt,
+
+		MaxFavorableExcursion: position.MaxFavorableExcursion,
+		MaxAdverseExcursion:   position.MaxAdverseExcursion,
+
+		DisplayCurrency:    conversion.Currency,
+		DisplayRate:        conversion.Rate,
+		DisplayFallback:    conversion.Fallback,
+		RealizedPnLDisplay: conversion.Apply(position.RealizedPnL),
+
+		Offsetting: offsetting,
+	}
+}
+
+// offsettingPositions returns the IDs of positions with a fill offset by
+// another position's fill
+func (s *Server) offsettingPositions(ctx context.Context, since time.Time) (map[string]bool, error) {
+	if s.offsetting == nil {
+		return nil, nil
+	}
+
+	orders, err := s.repo.GetFilledOrders(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool)
+	for _, offset := range s.offsetting.Detect(orders) {
+		if offset.BuyPositionID != "" {
+			ids[offset.BuyPositionID] = true
+		}
+		if offset.SellPositionID != "" {
+			ids[offset.SellPositionID] = true
+		}
+	}
+
+	return ids, nil
+}
+
+// handleExposure reports the market value and unrealized PnL of all open
+// positions
+func (s *Server) handleExposure(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	positions, err := s.repo.GetAllOpenPositions(ctx)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to load open positions")
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "failed to load positions"})
+		return
+	}
+
+	report := ExposureReport{
+		OpenPositions: len(positions),
+		Timestamp:     time.Now(),
+	}
+
+	pairs, err := s.repo.GetActiveSelectedPairs(ctx)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to load selected pairs")
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "failed to load pairs"})
+		return
+	}
+	symbols := make(map[int64]string, len(pairs))
+	for _, pair := range pairs {
+		symbols[pair.ID] = pair.Symbol
+	}
+
+	exposure, err := s.exposure.Calculate(ctx, positions, symbols)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to calculate exposure")
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "failed to calculate exposure"})
+		return
+	}
+	report.ExposureUSDT = exposure.Gross
+	report.NetExposureUSDT = exposure.Net
+	report.UnrealizedPnLUSDT = exposure.UnrealizedPnL
+	report.StaleQuoteRates = exposure.StaleRates
+
+	conversion := s.display.Conversion(ctx)
+	report.DisplayCurrency = conversion.Currency
+	report.DisplayRate = conversion.Rate
+	report.DisplayFallback = conversion.Fallback
+	report.Exposure = conversion.Apply(report.ExposureUSDT)
+	report.UnrealizedPnL = conversion.Apply(report.UnrealizedPnLUSDT)
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// BaselineRequest stores the backtest expectations of a strategy
+// configuration
+type BaselineRequest struct {
+	StrategyTag    string  `json:"strategy_tag"`
+	ConfigVersion  string  `json:"config_version"`
+	WinRate        float64 `json:"win_rate"`
+	AvgPnLPerTrade float64 `json:"avg_pnl_per_trade"`
+	Trades         int     `json:"trades"`
+}
+
+// handleSetBaseline stores a backtest baseline, replacing the previous one
+// for the same strategy tag and config version
+func (s *Server) handleSetBaseline(w http.ResponseWriter, r *http.Request) {
+	var req BaselineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "invalid baseline body: " + err.Error()})
+		return
+	}
+	if req.StrategyTag == "" || req.ConfigVersion == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "strategy_tag and config_version are required"})
+		return
+	}
+	if req.WinRate < 0 || req.WinRate > 1 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "win_rate must be between 0 and 1"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	baseline := models.BacktestBaseline{
+		StrategyTag:    req.StrategyTag,
+		ConfigVersion:  req.ConfigVersion,
+		WinRate:        req.WinRate,
+		AvgPnLPerTrade: req.AvgPnLPerTrade,
+		Trades:         req.Trades,
+	}
+	if err := s.repo.UpsertBacktestBaseline(ctx, baseline); err != nil {
+		s.logger.WithError(err).Error("Failed to store backtest baseline")
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "failed to store baseline"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, req)
+}
+
+// handleDrift reports the latest comparison of live results with the stored
+// backtest baselines
+func (s *Server) handleDrift(w http.ResponseWriter, r *http.Request) {
+	if s.drift == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "drift monitoring is disabled"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.drift.Reports())
+}
+
+// handleTradeDecision returns the decision snapshot of the entry that opened
+// a position, looked up by position ID or exchange order ID
+func (s *Server) handleTradeDecision(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	decision, err := s.repo.GetTradeDecision(ctx, r.PathValue("id"))
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to load trade decision")
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "failed to load trade decision"})
+		return
+	}
+	if decision == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "no decision recorded for " + r.PathValue("id")})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":              decision.ID,
+		"position_id":     decision.PositionID,
+		"kucoin_order_id": decision.KuCoinOrderID,
+		"symbol":          decision.Symbol,
+		"context":         json.RawMessage(decision.Context),
+		"created_at":      decision.CreatedAt,
+	})
+}
+
+// handleFailedOrders lists recent rejected order placements. Accepts an
+// RFC3339 "since" (default 24 hours ago) and "limit" (default 100).
+func (s *Server) handleFailedOrders(w http.ResponseWriter, r *http.Request) {
+	since := time.Now().Add(-24 * time.Hour)
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "since must be an RFC3339 timestamp"})
+			return
+		}
+		since = parsed
+	}
+
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "limit must be a positive integer"})
+			return
+		}
+		limit = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	orders, err := s.repo.GetFailedOrders(ctx, since, limit)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to load failed orders")
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "failed to load failed orders"})
+		return
+	}
+
+	response := make([]FailedOrderResponse, 0, len(orders))
+	for _, order := range orders {
+		response = append(response, FailedOrderResponse{
+			ID:           order.ID,
+			Symbol:       order.Symbol,
+			ClientOid:    order.ClientOid,
+			Side:         order.Side,
+			Type:         order.Type,
+			Quantity:     order.Quantity,
+			Price:        order.Price,
+			ErrorCode:    order.ErrorCode,
+			ErrorMessage: order.ErrorMessage,
+			CreatedAt:    order.CreatedAt,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func writeTradesCSV(w http.ResponseWriter, trades []TradeExport) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="trades.csv"`)
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{
+		"position_id", "pair_id", "side", "quantity", "entry_price", "exit_price",
+		"realized_pnl", "strategy_tag", "config_version", "opened_at", "closed_at",
+		"max_favorable_excursion", "max_adverse_excursion",
+		"display_currency", "display_rate", "display_fallback", "realized_pnl_display",
+		"offsetting", "total_fees",
+	})
+
+	for _, trade := range trades {
+		closedAt := ""
+		if trade.ClosedAt != nil {
+			closedAt = trade.ClosedAt.Format(time.RFC3339)
+		}
+		writer.Write([]string{
+			trade.PositionID,
+			strconv.FormatInt(trade.PairID, 10),
+			trade.Side,
+			strconv.FormatFloat(trade.Quantity, 'f', -1, 64),
+			strconv.FormatFloat(trade.EntryPrice, 'f', -1, 64),
+			strconv.FormatFloat(trade.ExitPrice, 'f', -1, 64),
+			strconv.FormatFloat(trade.RealizedPnL, 'f', -1, 64),
+			trade.StrategyTag,
+			trade.ConfigVersion,
+			trade.OpenedAt.Format(time.RFC3339),
+			closedAt,
+			strconv.FormatFloat(trade.MaxFavorableExcursion, 'f', -1, 64),
+			strconv.FormatFloat(trade.MaxAdverseExcursion, 'f', -1, 64),
+			trade.DisplayCurrency,
+			strconv.FormatFloat(trade.DisplayRate, 'f', -1, 64),
+			strconv.FormatBool(trade.DisplayFallback),
+			strconv.FormatFloat(trade.RealizedPnLDisplay, 'f', -1, 64),
+			strconv.FormatBool(trade.Offsetting),
+			strconv.FormatFloat(trade.TotalFees, 'f', -1, 64),
+		})
+	}
+
+	writer.Flush()
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/pricing"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestTradesExportCarriesStrategyAttribution(t *testing.T) {
+	closedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	position := models.Position{
+		ID:            "position-1",
+		PairID:        7,
+		Side:          "buy",
+		Quantity:      2,
+		EntryPrice:    100,
+		CurrentPrice:  110,
+		RealizedPnL:   19.6,
+		TotalFees:     0.4,
+		Status:        "closed",
+		StrategyTag:   "grid",
+		ConfigVersion: "v3",
+		CreatedAt:     closedAt.Add(-time.Hour),
+		ClosedAt:      &closedAt,
+	}
+
+	trade := newTradeExport(position, pricing.Conversion{Currency: pricing.AccountingCurrency, Rate: 1}, false)
+	if trade.StrategyTag != "grid" || trade.ConfigVersion != "v3" {
+		t.Fatalf("export attribution = %q/%q, want grid/v3", trade.StrategyTag, trade.ConfigVersion)
+	}
+
+	recorder := httptest.NewRecorder()
+	writeTradesCSV(recorder, []TradeExport{trade})
+
+	rows, err := csv.NewReader(recorder.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to parse the CSV export: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("CSV export has %d rows, want a header and one trade", len(rows))
+	}
+
+	row := make(map[string]string, len(rows[0]))
+	for i, column := range rows[0] {
+		row[column] = rows[1][i]
+	}
+	if row["strategy_tag"] != "grid" || row["config_version"] != "v3" {
+		t.Errorf("CSV attribution = %q/%q, want grid/v3", row["strategy_tag"], row["config_version"])
+	}
+	if row["position_id"] != "position-1" || row["total_fees"] != "0.4" {
+		t.Errorf("CSV row = %v, want position-1 with total_fees 0.4", row)
+	}
+}
+
+func TestTradesExportConvertsRealizedPnL(t *testing.T) {
+	position := models.Position{ID: "position-1", Side: "buy", Quantity: 1, EntryPrice: 100, CurrentPrice: 130, RealizedPnL: 25, Status: "closed"}
+
+	trade := newTradeExport(position, pricing.Conversion{Currency: "EUR", Rate: 0.9}, false)
+	if trade.RealizedPnL != 25 {
+		t.Errorf("realized PnL = %v, want the 25 USDT left unconverted", trade.RealizedPnL)
+	}
+	if trade.DisplayCurrency != "EUR" || trade.RealizedPnLDisplay != 22.5 {
+		t.Errorf("display PnL = %v %s, want 22.5 EUR", trade.RealizedPnLDisplay, trade.DisplayCurrency)
+	}
+
+	recorder := httptest.NewRecorder()
+	writeTradesCSV(recorder, []TradeExport{trade})
+
+	rows, err := csv.NewReader(recorder.Body).ReadAll()
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("CSV export = %v rows, %v; want a header and one trade", len(rows), err)
+	}
+	row := make(map[string]string, len(rows[0]))
+	for i, column := range rows[0] {
+		row[column] = rows[1][i]
+	}
+	if row["realized_pnl"] != "25" || row["realized_pnl_display"] != "22.5" || row["display_currency"] != "EUR" || row["display_fallback"] != "false" {
+		t.Errorf("CSV row = %v, want 25 USDT shown as 22.5 EUR", row)
+	}
+}
+
+func TestTradesExportCarriesExcursions(t *testing.T) {
+	position := models.Position{
+		ID: "position-1", Side: "buy", Quantity: 1, EntryPrice: 100, CurrentPrice: 104, Status: "closed",
+		MaxFavorableExcursion: 0.08, MaxAdverseExcursion: 0.05,
+	}
+
+	trade := newTradeExport(position, pricing.Conversion{Currency: pricing.AccountingCurrency, Rate: 1}, false)
+	if trade.MaxFavorableExcursion != 0.08 || trade.MaxAdverseExcursion != 0.05 {
+		t.Errorf("export MFE/MAE = %v/%v, want 0.08/0.05", trade.MaxFavorableExcursion, trade.MaxAdverseExcursion)
+	}
+
+	recorder := httptest.NewRecorder()
+	writeTradesCSV(recorder, []TradeExport{trade})
+
+	rows, err := csv.NewReader(recorder.Body).ReadAll()
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("CSV export = %v rows, %v; want a header and one trade", len(rows), err)
+	}
+	row := make(map[string]string, len(rows[0]))
+	for i, column := range rows[0] {
+		row[column] = rows[1][i]
+	}
+	if row["max_favorable_excursion"] != "0.08" || row["max_adverse_excursion"] != "0.05" {
+		t.Errorf("CSV MFE/MAE = %q/%q, want 0.08/0.05", row["max_favorable_excursion"], row["max_adverse_excursion"])
+	}
+}
+
+// fakeConfigs holds one trading config per pair and keeps the overrides
+// stored by the handler
+type fakeConfigs struct {
+	configs map[int64]models.TradingConfig
+	updates int
+}
+
+func (f *fakeConfigs) GetTradingConfig(_ context.Context, pairID int64) (*models.TradingConfig, error) {
+	config, ok := f.configs[pairID]
+	if !ok {
+		return nil, nil
+	}
+	return &config, nil
+}
+
+func (f *fakeConfigs) UpdateTradingConfig(_ context.Context, config models.TradingConfig) error {
+	f.updates++
+	f.configs[config.PairID] = config
+	return nil
+}
+
+func TestUpdateTradingConfig(t *testing.T) {
+	current := models.TradingConfig{
+		ID: "config-1", PairID: 7, StrategyType: "grid", StopLossPercent: 0.02, TakeProfitPercent: 0.05,
+		GridLevels: 10, MaxPositions: 3, PositionSizeUSDT: 50,
+	}
+
+	tests := []struct {
+		name       string
+		pairID     string
+		body       string
+		wantStatus int
+		want       models.TradingConfig // Stored config when the update is accepted
+	}{
+		{
+			name:       "valid override keeps the other settings",
+			pairID:     "7",
+			body:       `{"stop_loss_percent": 0.03, "take_profit_percent": 0.09, "price_range_min": 90, "price_range_max": 110}`,
+			wantStatus: http.StatusOK,
+			want: models.TradingConfig{
+				ID: "config-1", PairID: 7, StrategyType: "grid", StopLossPercent: 0.03, TakeProfitPercent: 0.09,
+				GridLevels: 10, PriceRangeMin: 90, PriceRangeMax: 110, MaxPositions: 3, PositionSizeUSDT: 50,
+			},
+		},
+		{name: "zero stop loss", pairID: "7", body: `{"stop_loss_percent": 0}`, wantStatus: http.StatusBadRequest},
+		{name: "stop loss beyond the maximum", pairID: "7", body: `{"stop_loss_percent": 0.6}`, wantStatus: http.StatusBadRequest},
+		{name: "risk-reward below the minimum", pairID: "7", body: `{"take_profit_percent": 0.025}`, wantStatus: http.StatusBadRequest},
+		{name: "single grid level", pairID: "7", body: `{"grid_levels": 1}`, wantStatus: http.StatusBadRequest},
+		{name: "inverted price range", pairID: "7", body: `{"price_range_min": 110, "price_range_max": 90}`, wantStatus: http.StatusBadRequest},
+		{name: "malformed body", pairID: "7", body: `{"stop_loss_percent": "high"}`, wantStatus: http.StatusBadRequest},
+		{name: "non-integer pair", pairID: "btc", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "pair without a config", pairID: "8", body: `{"stop_loss_percent": 0.03}`, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeConfigs{configs: map[int64]models.TradingConfig{7: current}}
+			logger, _ := test.NewNullLogger()
+			server := &Server{configs: store, minRiskReward: 1.5, logger: logger}
+			mux := http.NewServeMux()
+			mux.HandleFunc("PUT /configs/{pairId}", server.handleUpdateTradingConfig)
+
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/configs/"+tt.pairID, strings.NewReader(tt.body)))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d (%s), want %d", recorder.Code, recorder.Body.String(), tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if store.updates != 0 || store.configs[7] != current {
+					t.Errorf("rejected update stored %+v, want the config unchanged", store.configs[7])
+				}
+				return
+			}
+
+			if store.updates != 1 || store.configs[7] != tt.want {
+				t.Errorf("stored %+v after %d updates, want %+v", store.configs[7], store.updates, tt.want)
+			}
+			var response TradingConfigResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatalf("response is not a trading config: %v", err)
+			}
+			if response.StopLossPercent != tt.want.StopLossPercent || response.TakeProfitPercent != tt.want.TakeProfitPercent || response.GridLevels != tt.want.GridLevels {
+				t.Errorf("response = %+v, want the stored config", response)
+			}
+		})
+	}
+}
+
+func TestStateChangingRoutesRequireToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string // Configured token
+		header     string // Authorization header sent
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{name: "missing token", token: "secret", method: http.MethodPut, path: "/configs/7", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", token: "secret", header: "Bearer guess", method: http.MethodPut, path: "/configs/7", wantStatus: http.StatusUnauthorized},
+		{name: "no token configured", header: "Bearer ", method: http.MethodPut, path: "/configs/7", wantStatus: http.StatusUnauthorized},
+		{name: "valid token", token: "secret", header: "Bearer secret", method: http.MethodPut, path: "/configs/7", wantStatus: http.StatusOK},
+		// Drift monitoring is disabled, so the read is answered by its handler
+		{name: "reads stay open", token: "secret", method: http.MethodGet, path: "/drift", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := models.TradingConfig{ID: "config-1", PairID: 7, StrategyType: "grid", StopLossPercent: 0.05, TakeProfitPercent: 0.1, GridLevels: 10, MaxPositions: 3, PositionSizeUSDT: 50}
+			store := &fakeConfigs{configs: map[int64]models.TradingConfig{7: current}}
+			logger, _ := test.NewNullLogger()
+			server := &Server{configs: store, apiToken: tt.token, logger: logger}
+
+			request := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"stop_loss_percent": 0.03}`))
+			if tt.header != "" {
+				request.Header.Set("Authorization", tt.header)
+			}
+			recorder := httptest.NewRecorder()
+			server.routes().ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d (%s), want %d", recorder.Code, recorder.Body.String(), tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && store.updates != 0 {
+				t.Errorf("rejected request stored %d updates, want none", store.updates)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/signals"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// Exit reasons of backtested trades
+const (
+	ExitSignal     = "signal"
+	ExitStopLoss   = "stop_loss"
+	ExitTakeProfit = "take_profit"
+	ExitEnd        = "end_of_backtest"
+)
+
+// CandleSource supplies the stored minute candles a backtest replays
+type CandleSource interface {
+	GetPriceHistoryBetween(ctx context.Context, symbol string, since, until time.Time) ([]models.Candle, error)
+}
+
+type Config struct {
+	Symbol string
+	Start  time.Time
+	End    time.Time
+	Warmup time.Duration // History loaded before Start so indicators are primed at the first step
+	Step   time.Duration // Time between signal evaluations; 0 uses the signal interval
+
+	PositionSize      float64 // USDT committed to each trade, also the starting capital
+	Slippage          float64 // Fraction of the price lost on every fill
+	FeeRate           float64 // Fraction of the notional charged on every fill
+	StopLossPercent   float64 // 0 disables
+	TakeProfitPercent float64 // 0 disables
+}
+
+// Trade is one simulated round trip. Prices are the fill prices after
+// slippage and the PnL is net of both fills' fees.
+type Trade struct {
+	EntryTime  time.Time
+	ExitTime   time.Time
+	EntryPrice float64
+	ExitPrice  float64
+	Quantity   float64
+	Fees       float64
+	PnL        float64
+	ExitReason string
+}
+
+type BacktestResult struct {
+	TotalPnL    float64
+	WinRate     float64 // Fraction of trades closed with a positive PnL
+	MaxDrawdown float64 // Largest fall of equity from a previous peak, as a fraction of the peak
+	SharpeRatio float64 // Annualized, from the equity returns between steps
+	Trades      []Trade
+}
+
+// Backtester replays a symbol's stored candles through the signal generator
+// on a simulated clock and trades its signals the way the basic strategy
+// does: one long at a time, entered on BUY, closed on a SELL while in profit
+// or at the stop loss or take profit
+type Backtester struct {
+	source       CandleSource
+	signalConfig signals.Config
+	config       Config
+	logger       *logrus.Logger
+}
+
+// NewBacktester builds a backtester running a generator of the given signal
+// configuration; its clock and price history are replaced by the replay
+func NewBacktester(source CandleSource, signalConfig signals.Config, config Config, logger *logrus.Logger) *Backtester {
+	if config.Step <= 0 {
+		interval := signalConfig.PriceDataIntervalMinutes
+		if interval <= 0 {
+			interval = 60
+		}
+		config.Step = time.Duration(interval) * time.Minute
+	}
+
+	return &Backtester{
+		source:       source,
+		signalConfig: signalConfig,
+		config:       config,
+		logger:       logger,
+	}
+}
+
+func (b *Backtester) Run(ctx context.Context) (*BacktestResult, error) {
+	if !b.config.End.After(b.config.Start) {
+		return nil, fmt.Errorf("backtest end %s is not after its start %s", b.config.End, b.config.Start)
+	}
+	if b.config.PositionSize <= 0 {
+		return nil, fmt.Errorf("backtest position size must be positive, got %v", b.config.PositionSize)
+	}
+
+	candles, err := b.source.GetPriceHistoryBetween(ctx, b.config.Symbol, b.config.Start.Add(-b.config.Warmup), b.config.End)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load candles: %w", err)
+	}
+	if len(candles) == 0 {
+		return nil, fmt.Errorf("no candles for %s between %s and %s", b.config.Symbol, b.config.Start, b.config.End)
+	}
+
+	history := newReplayHistory(candles)
+	signalConfig := b.signalConfig
+	signalConfig.Clock = history
+	generator := signals.NewGenerator(history, signalConfig, b.logger)
+
+	sim := &simulation{config: b.config, equity: []float64{b.config.PositionSize}}
+	var lastPrice float64
+	var lastTime time.Time
+	for now := b.config.Start.Add(b.config.Step); !now.After(b.config.End); now = now.Add(b.config.Step) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		price, ok := history.advance(now)
+		if !ok {
+			continue
+		}
+
+		sim.step(now, price, generator.GenerateSignal(ctx, b.config.Symbol, price))
+		lastPrice, lastTime = price, now
+	}
+
+	// A position still open at the end is closed at the last price so the
+	// result covers every entry
+	if sim.position != nil {
+		sim.exit(lastTime, lastPrice, ExitEnd)
+		sim.equity[len(sim.equity)-1] = sim.mark(lastPrice)
+	}
+
+	result := sim.result()
+	b.logger.WithFields(logrus.Fields{
+		"symbol":       b.config.Symbol,
+		"trades":       len(result.Trades),
+		"total_pnl":    result.TotalPnL,
+		"win_rate":     result.WinRate,
+		"max_drawdown": result.MaxDrawdown,
+		"sharpe_ratio": result.SharpeRatio,
+	}).Info("Backtest completed")
+
+	return result, nil
+}
+
+// simulation is the account state of a running backtest
+type simulation struct {
+	config   Config
+	position *Trade // Open long, nil when flat
+	trades   []Trade
+	realized float64
+	equity   []float64 // Equity after every step, starting with the capital
+}
+
+// step applies the protective exits and then the signal at the price, and
+// records the resulting equity
+func (s *simulation) step(now time.Time, price float64, signal models.Signal) {
+	if s.position != nil {
+		entry := s.position.EntryPrice
+		switch {
+		case s.config.StopLossPercent > 0 && price <= entry*(1-s.config.StopLossPercent):
+			s.exit(now, price, ExitStopLoss)
+		case s.config.TakeProfitPercent > 0 && price >= entry*(1+s.config.TakeProfitPercent):
+			s.exit(now, price, ExitTakeProfit)
+		}
+	}
+
+	switch {
+	case signal.Action == "BUY" && s.position == nil:
+		s.enter(now, price)
+	case signal.Action == "SELL" && s.position != nil && price > s.position.EntryPrice:
+		s.exit(now, price, ExitSignal)
+	}
+
+	s.equity = append(s.equity, s.mark(price))
+}
+
+func (s *simulation) enter(now time.Time, price float64) {
+	fill := price * (1 + s.config.Slippage)
+	quantity := s.config.PositionSize / fill
+	s.position = &Trade{
+		EntryTime:  now,
+		EntryPrice: fill,
+		Quantity:   quantity,
+		Fees:       fill * quantity * s.config.FeeRate,
+	}
+}
+
+func (s *simulation) exit(now time.Time, price float64, reason string) {
+	trade := *s.position
+	fill := price * (1 - s.config.Slippage)
+	trade.ExitTime = now
+	trade.ExitPrice = fill
+	trade.ExitReason = reason
+	trade.Fees += fill * trade.Quantity * s.config.FeeRate
+	trade.PnL = (trade.ExitPrice-trade.EntryPrice)*trade.Quantity - trade.Fees
+
+	s.trades = append(s.trades, trade)
+	s.realized += trade.PnL
+	s.position = nil
+}
+
+// mark is the equity with an open position valued at the price, net of the
+// fees paid so far
+func (s *simulation) mark(price float64) float64 {
+	equity := s.config.PositionSize + s.realized
+	if s.position != nil {
+		equity += (price-s.position.EntryPrice)*s.position.Quantity - s.position.Fees
+	}
+	return equity
+}
+
+func (s *simulation) result() *BacktestResult {
+	result := &BacktestResult{
+		Trades:      s.trades,
+		TotalPnL:    s.realized,
+		MaxDrawdown: maxDrawdown(s.equity),
+		SharpeRatio: sharpeRatio(s.equity, s.config.Step),
+	}
+
+	wins := 0
+	for _, trade := range s.trades {
+		if trade.PnL > 0 {
+			wins++
+		}
+	}
+	if len(s.trades) > 0 {
+		result.WinRate = float64(wins) / float64(len(s.trades))
+	}
+
+	return result
+}
+
+// maxDrawdown is the largest fall of the equity curve from a running peak,
+// relative to that peak
+func maxDrawdown(equity []float64) float64 {
+	peak, drawdown := 0.0, 0.0
+	for _, value := range equity {
+		if value > peak {
+			peak = value
+		}
+		if peak > 0 && (peak-value)/peak > drawdown {
+			drawdown = (peak - value) / peak
+		}
+	}
+	return drawdown
+}
+
+// sharpeRatio is the mean over the standard deviation of the returns between
+// equity points, annualized by the number of steps in a year, with a zero
+// risk-free rate. Flat or too short curves have a ratio of zero.
+func sharpeRatio(equity []float64, step time.Duration) float64 {
+	var returns []float64
+	for i := 1; i < len(equity); i++ {
+		if equity[i-1] > 0 {
+			returns = append(returns, equity[i]/equity[i-1]-1)
+		}
+	}
+	if len(returns) < 2 {
+		return 0
+	}
+
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(returns)-1))
+	if stddev == 0 {
+		return 0
+	}
+
+	stepsPerYear := float64(365*24*time.Hour) / float64(step)
+	return mean / stddev * math.Sqrt(stepsPerYear)
+}
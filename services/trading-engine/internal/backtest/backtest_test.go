@@ -0,0 +1,249 @@
+package backtest
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/signals"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+// candleSource serves stored minute candles between two times, oldest first
+type candleSource []models.Candle
+
+func (s candleSource) GetPriceHistoryBetween(_ context.Context, _ string, since, until time.Time) ([]models.Candle, error) {
+	var candles []models.Candle
+	for _, candle := range s {
+		if !candle.Timestamp.Before(since) && candle.Timestamp.Before(until) {
+			candles = append(candles, candle)
+		}
+	}
+	return candles, nil
+}
+
+// waveCandles builds minute candles from start whose closes swing 15% around
+// 100 every three days
+func waveCandles(start time.Time, minutes int) candleSource {
+	candles := make(candleSource, minutes)
+	for i := range candles {
+		price := 100 + 15*math.Sin(2*math.Pi*float64(i)/(3*24*60))
+		candles[i] = models.Candle{
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+			Open:      price,
+			High:      price * 1.001,
+			Low:       price * 0.999,
+			Close:     price,
+			Volume:    1000,
+		}
+	}
+	return candles
+}
+
+func TestSimulationTradesScriptedSignals(t *testing.T) {
+	sim := &simulation{
+		config: Config{PositionSize: 1000, Slippage: 0.01, FeeRate: 0.001, StopLossPercent: 0.05, TakeProfitPercent: 0.1, Step: time.Hour},
+		equity: []float64{1000},
+	}
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		price  float64
+		action string
+	}{
+		{100, "BUY"},  // Filled at 101 after slippage
+		{120, "HOLD"}, // Take profit at 111.1 and above
+		{100, "BUY"},
+		{95, "HOLD"}, // Stop loss at 95.95 and below
+		{100, "BUY"},
+		{104, "SELL"}, // Signal exit in profit
+	}
+	for i, step := range steps {
+		sim.step(start.Add(time.Duration(i)*time.Hour), step.price, models.Signal{Action: step.action})
+	}
+
+	result := sim.result()
+	want := []struct {
+		exitPrice float64
+		fees      float64
+		pnl       float64
+		reason    string
+	}{
+		{exitPrice: 118.8, fees: 2.176238, pnl: 174.061386, reason: ExitTakeProfit},
+		{exitPrice: 94.05, fees: 1.931188, pnl: -70.743069, reason: ExitStopLoss},
+		{exitPrice: 102.96, fees: 2.019406, pnl: 17.386535, reason: ExitSignal},
+	}
+	if len(result.Trades) != len(want) {
+		t.Fatalf("simulated %d trades, want %d", len(result.Trades), len(want))
+	}
+	for i, w := range want {
+		trade := result.Trades[i]
+		if trade.EntryPrice != 101 || !approxEqual(trade.ExitPrice, w.exitPrice) || !approxEqual(trade.Fees, w.fees) || !approxEqual(trade.PnL, w.pnl) || trade.ExitReason != w.reason {
+			t.Errorf("trade %d = %+v, want 101 to %v, fees %v, PnL %v by %s", i, trade, w.exitPrice, w.fees, w.pnl, w.reason)
+		}
+	}
+
+	if !approxEqual(result.TotalPnL, 120.704851) {
+		t.Errorf("total PnL = %v, want 120.704851", result.TotalPnL)
+	}
+	if !approxEqual(result.WinRate, 2.0/3) {
+		t.Errorf("win rate = %v, want 2/3", result.WinRate)
+	}
+	// From the 1174.06 peak after the take profit down to 1092.42 on the
+	// third entry
+	if !approxEqual(result.MaxDrawdown, 0.069540) {
+		t.Errorf("max drawdown = %v, want 0.069540", result.MaxDrawdown)
+	}
+}
+
+func TestSellAtALossHolds(t *testing.T) {
+	sim := &simulation{config: Config{PositionSize: 1000}, equity: []float64{1000}}
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	sim.step(now, 100, models.Signal{Action: "BUY"})
+	sim.step(now.Add(time.Hour), 99, models.Signal{Action: "SELL"})
+
+	if sim.position == nil || len(sim.trades) != 0 {
+		t.Errorf("position closed on a SELL below entry, want it held")
+	}
+}
+
+func TestMaxDrawdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		equity []float64
+		want   float64
+	}{
+		{name: "rising curve", equity: []float64{100, 110, 120}, want: 0},
+		{name: "deepest fall from the running peak", equity: []float64{100, 120, 90, 130, 110}, want: 0.25},
+		{name: "empty curve", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := maxDrawdown(tt.equity); !approxEqual(got, tt.want) {
+				t.Errorf("maxDrawdown() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSharpeRatio(t *testing.T) {
+	tests := []struct {
+		name   string
+		equity []float64
+		step   time.Duration
+		want   float64
+	}{
+		{name: "flat curve", equity: []float64{100, 100, 100}, step: time.Hour, want: 0},
+		{name: "single return", equity: []float64{100, 110}, step: time.Hour, want: 0},
+		// Returns of +10% and -10%: zero mean
+		{name: "returns cancelling out", equity: []float64{100, 110, 99}, step: time.Hour, want: 0},
+		// Daily returns of 2% and 1%: mean 0.015, sample deviation 0.00707
+		{name: "daily returns annualized", equity: []float64{100, 102, 103.02}, step: 24 * time.Hour, want: 0.015 / (0.01 / math.Sqrt2) * math.Sqrt(365)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sharpeRatio(tt.equity, tt.step); math.Abs(got-tt.want) > 1e-6*math.Max(1, math.Abs(tt.want)) {
+				t.Errorf("sharpeRatio() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayHistoryHidesOpenCandles(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	history := newReplayHistory(waveCandles(start, 10))
+
+	if _, ok := history.advance(start.Add(30 * time.Second)); ok {
+		t.Error("price available before the first candle closed")
+	}
+
+	price, ok := history.advance(start.Add(3 * time.Minute))
+	candles, _ := history.GetPriceHistory(context.Background(), "BTC-USDT", start)
+	if !ok || len(candles) != 3 || price != candles[2].Close {
+		t.Errorf("at 3 minutes got %d candles and price %v, want the 3 closed ones and the last close", len(candles), price)
+	}
+	if !history.Now().Equal(start.Add(3 * time.Minute)) {
+		t.Errorf("clock = %v, want the simulated time", history.Now())
+	}
+}
+
+func TestBacktestRunIsDeterministic(t *testing.T) {
+	first := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	source := waveCandles(first, 15*24*60)
+	config := Config{
+		Symbol:            "BTC-USDT",
+		Start:             first.Add(5 * 24 * time.Hour),
+		End:               first.Add(15 * 24 * time.Hour),
+		Warmup:            5 * 24 * time.Hour,
+		PositionSize:      1000,
+		Slippage:          0.001,
+		FeeRate:           0.001,
+		StopLossPercent:   0.1,
+		TakeProfitPercent: 0.2,
+	}
+
+	run := func() *BacktestResult {
+		result, err := NewBacktester(source, signals.Config{}, config, utils.NewDiscardLogger()).Run(context.Background())
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return result
+	}
+	result := run()
+
+	if len(result.Trades) == 0 {
+		t.Fatal("no trades over five swings, want the generator to trade them")
+	}
+	total, wins := 0.0, 0
+	for i, trade := range result.Trades {
+		if trade.EntryTime.Before(config.Start) || trade.ExitTime.After(config.End) || !trade.ExitTime.After(trade.EntryTime) {
+			t.Errorf("trade %d from %v to %v outside the backtest window", i, trade.EntryTime, trade.ExitTime)
+		}
+		total += trade.PnL
+		if trade.PnL > 0 {
+			wins++
+		}
+	}
+	if !approxEqual(result.TotalPnL, total) || !approxEqual(result.WinRate, float64(wins)/float64(len(result.Trades))) {
+		t.Errorf("result = PnL %v, win rate %v; want %v and %v from the trades", result.TotalPnL, result.WinRate, total, float64(wins)/float64(len(result.Trades)))
+	}
+	if result.MaxDrawdown < 0 || result.MaxDrawdown >= 1 {
+		t.Errorf("max drawdown = %v, want a fraction of the peak", result.MaxDrawdown)
+	}
+
+	again := run()
+	if len(again.Trades) != len(result.Trades) || again.TotalPnL != result.TotalPnL || again.SharpeRatio != result.SharpeRatio {
+		t.Errorf("second run = %d trades, PnL %v; want the first run's %d and %v", len(again.Trades), again.TotalPnL, len(result.Trades), result.TotalPnL)
+	}
+}
+
+func TestBacktestRejectsInvalidConfig(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		source candleSource
+		config Config
+	}{
+		{name: "end before start", source: waveCandles(start, 60), config: Config{Start: start.Add(time.Hour), End: start, PositionSize: 1000}},
+		{name: "no position size", source: waveCandles(start, 60), config: Config{Start: start, End: start.Add(time.Hour)}},
+		{name: "no candles", config: Config{Start: start, End: start.Add(time.Hour), PositionSize: 1000}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewBacktester(tt.source, signals.Config{}, tt.config, utils.NewDiscardLogger()).Run(context.Background()); err == nil {
+				t.Error("Run() error = nil, want the backtest rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package backtest
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// replayHistory is the simulated market a backtest runs the generator in. It
+// is both the generator's clock and its price history, and only shows the
+// candles that had closed by the simulated time, so no signal can look ahead.
+// It holds a single symbol's candles, oldest first.
+type replayHistory struct {
+	candles []models.Candle
+	now     time.Time
+	visible int // Candles closed by now
+}
+
+func newReplayHistory(candles []models.Candle) *replayHistory {
+	return &replayHistory{candles: candles}
+}
+
+func (h *replayHistory) Now() time.Time {
+	return h.now
+}
+
+// advance moves the simulated time forward and returns the close of the
+// newest candle closed by then; ok is false while none has
+func (h *replayHistory) advance(now time.Time) (float64, bool) {
+	h.now = now
+	for h.visible < len(h.candles) && !h.candles[h.visible].Timestamp.Add(time.Minute).After(now) {
+		h.visible++
+	}
+	if h.visible == 0 {
+		return 0, false
+	}
+	return h.candles[h.visible-1].Close, true
+}
+
+// GetPriceHistory returns the closed candles since the given time. The symbol
+// is ignored, the history holding only the backtested one.
+func (h *replayHistory) GetPriceHistory(_ context.Context, _ string, since time.Time) ([]models.Candle, error) {
+	visible := h.candles[:h.visible]
+	start := sort.Search(len(visible), func(i int) bool {
+		return !visible[i].Timestamp.Before(since)
+	})
+	return append([]models.Candle(nil), visible[start:]...), nil
+}
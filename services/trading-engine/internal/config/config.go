@@ -1,27 +1,296 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/database"
 	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/signals"
 )
 
 type Config struct {
-	Database            database.Config
+	Database             database.Config
+	KuCoin               kucoin.Config
+	TradingInterval      time.Duration
+	MaxPositionsPerPair  int
+	DefaultPositionSize  float64
+	StopLossPercent      float64
+	TakeProfitPercent    float64
+	TakeProfitLevels     int
+	ExitTieBreak         string
+	AllowNegativeRR      bool
+	MinRiskReward        float64
+	GridRecenterMargin   float64
+	GridOrdersEnabled    bool
+	GridCancelAfter      time.Duration
+	FlattenDisabledPairs bool
+	MaxRiskPerTradeUSDT  float64
+	DailyMaxLossUSDT     float64
+	ExposureMode         string
+	ExposureCorrelation  time.Duration
+	SkipIdleHolds        bool
+	StrategyTag          string
+	ConfigVersion        string
+	RecordFailedOrders   bool
+	ReconcileFills       bool
+	FillReconcileWorkers int
+	StrandedOrderTimeout time.Duration
+	MaxOpenOrders        int
+	StaleOrderMaxAge     time.Duration
+	MaxPriceAge          time.Duration
+	EntryAdverseBand     float64
+	EntryChaseBand       float64
+	ConfigRetryDelay     time.Duration
+	ConfigRetryMax       time.Duration
+	QuarantineAfter      int
+	SharePriceHistory    bool
+	MergeHourlyHistory   bool
+	PersistRiskHalts     bool
+	ObserveMode          bool
+	LiveOrderPricing     bool
+	LivePriceCacheTTL    time.Duration
+	MaxHistoryCandles    int
+	TrackExcursions      bool
+	PnLWriteRetries      int
+	PnLWriteRetryDelay   time.Duration
+	RecordDecisions      bool
+	DecisionRecordFile   string
+	PortfolioMetrics     bool
+	VerifyExchangeAuth   bool
+	StartupStepTimeout   time.Duration
+	ShutdownTimeout      time.Duration
+	MetricsPort          string
+	APIToken             string
+	Sizing               SizingConfig
+	LossVelocity         LossVelocityConfig
+	FlashCrash           FlashCrashConfig
+	Flatline             FlatlineConfig
+	Signals              SignalConfig
+	CandleBuffer         CandleBufferConfig
+	Beta                 BetaConfig
+	ExitConfirmation     ExitConfirmationConfig
+	ReferencePrice       ReferencePriceConfig
+	OrderBook            OrderBookConfig
+	Brackets             BracketConfig
+	TrailingStop         TrailingStopConfig
+	Symbols              SymbolConfig
+	Liquidity            LiquidityConfig
+	Reporting            ReportingConfig
+	FeeFloor             FeeFloorConfig
+	FeeCheck             FeeCheckConfig
+	Drift                DriftConfig
+	TradeSink            TradeSinkConfig
+	QuoteRates           QuoteRateConfig
+	Accounts             []AccountConfig
+}
+
+// AccountConfig is one trading account, typically an exchange sub-account.
+// Orders, balances and positions are kept per account; risk limits default
+// to the global settings unless overridden for the account.
+type AccountConfig struct {
+	Name                string
 	KuCoin              kucoin.Config
-	TradingInterval     time.Duration
 	MaxPositionsPerPair int
 	DefaultPositionSize float64
-	StopLossPercent     float64
-	TakeProfitPercent   float64
-	MetricsPort         string
+	MaxRiskPerTradeUSDT float64
+	MaxLossUSDT         float64 // Loss velocity limit
+	DailyMaxLossUSDT    float64
+}
+
+type SizingConfig struct {
+	Mode             string  // "quote", "base" or "balance_percent"
+	BaseQuantity     float64 // Base quantity per position in base mode
+	BalancePercent   float64 // Share of the available quote balance in balance_percent mode
+	VolatilityModel  string
+	EWMALambda       float64
+	TargetVolatility float64
+	VolatilityWindow time.Duration
+
+	AdaptiveEnabled       bool
+	AdaptiveLookback      int // Closed positions the rolling win rate and PnL cover
+	AdaptiveMinTrades     int
+	AdaptiveMinMultiplier float64
+	AdaptiveMaxMultiplier float64
+
+	RampEnabled       bool
+	RampStartFraction float64
+	RampTrades        int
+	RampPnL           float64
+}
+
+type LossVelocityConfig struct {
+	MaxLossUSDT float64
+	Window      time.Duration
+	Cooldown    time.Duration
+}
+
+type FlashCrashConfig struct {
+	DropPercent float64
+	Window      time.Duration
+	Cooldown    time.Duration
+	AllowExits  bool
+}
+
+type FlatlineConfig struct {
+	Closes   int // Identical consecutive closes treated as a stuck feed, 0 disables
+	Lookback time.Duration
+}
+
+type SignalConfig struct {
+	PriceDataIntervalMinutes int
+	LookbackPeriods          int
+	ResampleCandles          bool
+	RSIPeriod                int
+	RSIOversold              float64
+	RSIOverbought            float64
+	AdaptiveRSI              bool
+	AdaptiveRSIShift         float64
+	VolatilityModel          string
+	MaxDataAge               time.Duration
+	MaxVolumeRatio           float64
+	MinConfirmationVolume    float64
+	BollingerWeight          float64
+}
+
+// BetaConfig limits the portfolio's exposure-weighted beta to a reference
+// symbol, so a book of high-beta alts cannot become a leveraged BTC bet
+type BetaConfig struct {
+	MaxPortfolio float64 // 0 disables
+	Reference    string
+	Window       time.Duration
+}
+
+// CandleBufferConfig keeps each symbol's indicator window in memory, topped
+// up with new candles instead of re-read every cycle
+type CandleBufferConfig struct {
+	Enabled bool
+	Refresh time.Duration // Least time between reads of a symbol's new candles
+}
+
+// ExitConfirmationConfig sets the higher timeframe a signal exit must also
+// sell on, for pairs whose trading config enables confirm_exits
+type ExitConfirmationConfig struct {
+	IntervalMinutes int  // Candle interval of the confirmation signal, 0 disables
+	Default         bool // confirm_exits of newly created trading configs
+}
+
+// BufferCandles is the number of minute candles the longest signal window
+// spans, that of the exit confirmation timeframe when it is longer
+func (s SignalConfig) BufferCandles(exitIntervalMinutes int) int {
+	interval := s.PriceDataIntervalMinutes
+	if exitIntervalMinutes > interval {
+		interval = exitIntervalMinutes
+	}
+	return s.LookbackPeriods * interval
+}
+
+// GeneratorConfig is the signal generator configuration of these settings,
+// shared by the engine and the backtester
+func (s SignalConfig) GeneratorConfig() signals.Config {
+	return signals.Config{
+		PriceDataIntervalMinutes: s.PriceDataIntervalMinutes,
+		LookbackPeriods:          s.LookbackPeriods,
+		ResampleCandles:          s.ResampleCandles,
+		RSIPeriod:                s.RSIPeriod,
+		RSIOversold:              s.RSIOversold,
+		RSIOverbought:            s.RSIOverbought,
+		AdaptiveRSI:              s.AdaptiveRSI,
+		AdaptiveRSIShift:         s.AdaptiveRSIShift,
+		VolatilityModel:          s.VolatilityModel,
+		MaxDataAge:               s.MaxDataAge,
+		MaxVolumeRatio:           s.MaxVolumeRatio,
+		MinConfirmationVolume:    s.MinConfirmationVolume,
+		BollingerWeight:          s.BollingerWeight,
+	}
+}
+
+type ReferencePriceConfig struct {
+	Enabled           bool
+	Sources           []string
+	MaxDivergence     float64
+	PauseOnDivergence bool
+}
+
+type OrderBookConfig struct {
+	Enabled         bool
+	RefreshInterval time.Duration // How often the active symbol set is re-checked
+
+	DedupEnabled       bool          // Discard replayed messages by sequence
+	WatermarkFlushRate time.Duration // How often processed sequences are persisted
+}
+
+type LiquidityConfig struct {
+	MaxDepthFraction float64 // Largest share of nearby order book depth a position may take
+	DepthBps         float64 // Distance from the mid price counted as nearby depth
+}
+
+type ReportingConfig struct {
+	DisplayCurrency string        // Fiat currency reports are also shown in; empty reports in USDT only
+	RateSource      string        // "exchangerate" or "static"
+	StaticRate      float64       // Units of the display currency per USDT for the static source
+	RateTTL         time.Duration // How long a fetched rate is reused
+
+	OffsettingWindow    time.Duration // Fill gap within which opposite fills of different positions offset; 0 disables
+	OffsettingTolerance float64       // Relative quantity difference still treated as offsetting
+}
+
+type SymbolConfig struct {
+	RefreshInterval time.Duration // How often symbol increments and minimum sizes are reloaded
+}
+
+type DriftConfig struct {
+	Enabled          bool
+	Window           time.Duration
+	CheckInterval    time.Duration
+	MinTrades        int
+	WinRateTolerance float64
+	AvgPnLTolerance  float64
+}
+
+type TradeSinkConfig struct {
+	WebhookURL  string        // Endpoint closed trades are posted to; empty disables
+	FilePath    string        // File closed trades are appended to as JSON lines; empty disables
+	Buffer      int           // Events queued for delivery before new ones are dropped
+	SendTimeout time.Duration // Limit on delivering one event to one sink
+}
+
+// QuoteRateConfig values exposure of pairs quoted in currencies other than
+// USDT at the latest <QUOTE>-USDT price, so it adds up with USDT pairs
+type QuoteRateConfig struct {
+	Enabled      bool
+	TTL          time.Duration // How long a fetched rate is reused
+	MaxAge       time.Duration // Age of the underlying price at which a rate is stale, 0 never
+	BlockOnStale bool          // Block entries on a pair whose quote rate is stale or missing
+}
+
+type FeeFloorConfig struct {
+	Enabled   bool
+	FeeRate   float64 // Taker fee charged on each side of a round trip
+	MinNetPnL float64 // Least net-of-fees PnL, in USDT, a discretionary close must realize
+}
+
+type FeeCheckConfig struct {
+	Enabled   bool
+	Tolerance float64       // Relative deviation of the charged fee from the expected one that is flagged
+	RateTTL   time.Duration // How long fetched fee rates are reused
+}
+
+type TrailingStopConfig struct {
+	Percent    float64
+	Activation float64
+}
+
+type BracketConfig struct {
+	Enabled         bool
+	StopLimitOffset float64
 }
 
 func Load() *Config {
-	return &Config{
+	cfg := &Config{
 		Database: database.Config{
 			DbUri: getEnv("DB_URI", "localhost"),
 		},
@@ -30,14 +299,283 @@ func Load() *Config {
 			APISecret:  getEnv("KUCOIN_API_SECRET", ""),
 			Passphrase: getEnv("KUCOIN_PASSPHRASE", ""),
 			Sandbox:    getEnvBool("KUCOIN_SANDBOX", false),
+
+			ThrottleThreshold: getEnvFloat("KUCOIN_THROTTLE_THRESHOLD", 0.2),
+			ErrorBodyLimit:    getEnvInt("KUCOIN_ERROR_BODY_LIMIT", kucoin.DefaultErrorBodyLimit),
+		},
+		TradingInterval:      time.Duration(getEnvInt("TRADING_INTERVAL_SECONDS", 30)) * time.Second,
+		MaxPositionsPerPair:  getEnvInt("MAX_POSITIONS_PER_PAIR", 5),
+		DefaultPositionSize:  getEnvFloat("DEFAULT_POSITION_SIZE_USDT", 100.0),
+		StopLossPercent:      getEnvFloat("STOP_LOSS_PERCENT", 0.05),   // 5%
+		TakeProfitPercent:    getEnvFloat("TAKE_PROFIT_PERCENT", 0.10), // 10%, 2:1 reward to risk
+		TakeProfitLevels:     getEnvInt("TAKE_PROFIT_LEVELS", 1),
+		ExitTieBreak:         getEnv("EXIT_TIE_BREAK", "close"),
+		AllowNegativeRR:      getEnvBool("ALLOW_NEGATIVE_RISK_REWARD", false),
+		MinRiskReward:        getEnvFloat("MIN_RISK_REWARD", 1),
+		GridRecenterMargin:   getEnvFloat("GRID_RECENTER_MARGIN", 0.02), // 2% beyond the range
+		GridOrdersEnabled:    getEnvBool("GRID_ORDERS_ENABLED", false),
+		GridCancelAfter:      time.Duration(getEnvInt("GRID_ORDER_CANCEL_AFTER_MINUTES", 60)) * time.Minute,
+		FlattenDisabledPairs: getEnvBool("FLATTEN_DISABLED_PAIRS", false),
+		MaxRiskPerTradeUSDT:  getEnvFloat("MAX_RISK_PER_TRADE_USDT", 0),
+		DailyMaxLossUSDT:     getEnvFloat("DAILY_MAX_LOSS_USDT", 0),
+		ExposureMode:         getEnv("EXPOSURE_MODE", "gross"),
+		ExposureCorrelation:  time.Duration(getEnvInt("EXPOSURE_CORRELATION_HOURS", 24)) * time.Hour,
+		SkipIdleHolds:        getEnvBool("SKIP_IDLE_HOLD_PAIRS", true),
+		StrategyTag:          getEnv("STRATEGY_TAG", ""),
+		ConfigVersion:        getEnv("CONFIG_VERSION", "v1"),
+		RecordFailedOrders:   getEnvBool("RECORD_FAILED_ORDERS", true),
+		ReconcileFills:       getEnvBool("FILL_RECONCILIATION_ENABLED", false),
+		FillReconcileWorkers: getEnvInt("FILL_RECONCILIATION_WORKERS", 4),
+		StrandedOrderTimeout: time.Duration(getEnvInt("STRANDED_ORDER_TIMEOUT_MINUTES", 10)) * time.Minute,
+		MaxOpenOrders:        getEnvInt("MAX_OPEN_ORDERS_PER_SYMBOL", 0), // KuCoin allows 200 per symbol
+		StaleOrderMaxAge:     time.Duration(getEnvInt("STALE_ORDER_MAX_AGE_MINUTES", 0)) * time.Minute,
+		MaxPriceAge:          time.Duration(getEnvInt("MAX_PRICE_AGE_MINUTES", 10)) * time.Minute,
+		EntryAdverseBand:     getEnvFloat("ENTRY_CANCEL_ADVERSE_PERCENT", 0),
+		EntryChaseBand:       getEnvFloat("ENTRY_REPRICE_CHASE_PERCENT", 0),
+		ConfigRetryDelay:     time.Duration(getEnvInt("CONFIG_CREATE_RETRY_SECONDS", 60)) * time.Second,
+		ConfigRetryMax:       time.Duration(getEnvInt("CONFIG_CREATE_MAX_RETRY_MINUTES", 60)) * time.Minute,
+		QuarantineAfter:      getEnvInt("CONFIG_CREATE_QUARANTINE_AFTER", 5),
+		SharePriceHistory:    getEnvBool("SHARE_PRICE_HISTORY_READS", true),
+		MergeHourlyHistory:   getEnvBool("MERGE_HOURLY_PRICE_HISTORY", false),
+		PersistRiskHalts:     getEnvBool("PERSIST_RISK_HALTS", true),
+		ObserveMode:          getEnvBool("OBSERVE_MODE", false),
+		LiveOrderPricing:     getEnvBool("LIVE_ORDER_PRICING_ENABLED", false),
+		LivePriceCacheTTL:    time.Duration(getEnvInt("LIVE_PRICE_CACHE_MS", 2000)) * time.Millisecond,
+		MaxHistoryCandles:    getEnvInt("PRICE_HISTORY_MAX_CANDLES", 20000),
+		TrackExcursions:      getEnvBool("EXCURSION_TRACKING_ENABLED", false),
+		PnLWriteRetries:      getEnvInt("PNL_WRITE_RETRIES", 2),
+		PnLWriteRetryDelay:   time.Duration(getEnvInt("PNL_WRITE_RETRY_MS", 100)) * time.Millisecond,
+		RecordDecisions:      getEnvBool("TRADE_DECISIONS_ENABLED", false),
+		DecisionRecordFile:   getEnv("DECISION_RECORD_FILE", ""),
+		PortfolioMetrics:     getEnvBool("PORTFOLIO_METRICS_ENABLED", true),
+		VerifyExchangeAuth:   getEnvBool("STARTUP_VERIFY_EXCHANGE_AUTH", true),
+		StartupStepTimeout:   time.Duration(getEnvInt("STARTUP_STEP_TIMEOUT_SECONDS", 30)) * time.Second,
+		ShutdownTimeout:      time.Duration(getEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 30)) * time.Second,
+		MetricsPort:          getEnv("METRICS_PORT", "8082"),
+		APIToken:             getEnv("API_TOKEN", ""),
+		Sizing: SizingConfig{
+			Mode:             getEnv("SIZING_MODE", "quote"),
+			BaseQuantity:     getEnvFloat("POSITION_SIZE_BASE", 0),
+			BalancePercent:   getEnvFloat("POSITION_SIZE_BALANCE_PERCENT", 0.02), // 2%
+			VolatilityModel:  getEnv("SIZING_VOLATILITY_MODEL", "ewma"),
+			EWMALambda:       getEnvFloat("SIZING_EWMA_LAMBDA", 0.94),
+			TargetVolatility: getEnvFloat("SIZING_TARGET_VOLATILITY", 0.005),
+			VolatilityWindow: time.Duration(getEnvInt("SIZING_VOLATILITY_WINDOW_HOURS", 24)) * time.Hour,
+
+			AdaptiveEnabled:       getEnvBool("ADAPTIVE_SIZING_ENABLED", false),
+			AdaptiveLookback:      getEnvInt("ADAPTIVE_SIZING_LOOKBACK_TRADES", 20),
+			AdaptiveMinTrades:     getEnvInt("ADAPTIVE_SIZING_MIN_TRADES", 5),
+			AdaptiveMinMultiplier: getEnvFloat("ADAPTIVE_SIZING_MIN_MULTIPLIER", 0.5),
+			AdaptiveMaxMultiplier: getEnvFloat("ADAPTIVE_SIZING_MAX_MULTIPLIER", 1.5),
+
+			RampEnabled:       getEnvBool("SIZE_RAMP_ENABLED", false),
+			RampStartFraction: getEnvFloat("SIZE_RAMP_START_FRACTION", 0.25),
+			RampTrades:        getEnvInt("SIZE_RAMP_TRADES", 20),
+			RampPnL:           getEnvFloat("SIZE_RAMP_PNL_USDT", 0),
+		},
+		LossVelocity: LossVelocityConfig{
+			MaxLossUSDT: getEnvFloat("LOSS_VELOCITY_MAX_LOSS_USDT", 0),
+			Window:      time.Duration(getEnvInt("LOSS_VELOCITY_WINDOW_MINUTES", 10)) * time.Minute,
+			Cooldown:    time.Duration(getEnvInt("LOSS_VELOCITY_COOLDOWN_MINUTES", 30)) * time.Minute,
+		},
+		FlashCrash: FlashCrashConfig{
+			DropPercent: getEnvFloat("FLASH_CRASH_DROP_PERCENT", 0), // 0 disables
+			Window:      time.Duration(getEnvInt("FLASH_CRASH_WINDOW_MINUTES", 5)) * time.Minute,
+			Cooldown:    time.Duration(getEnvInt("FLASH_CRASH_COOLDOWN_MINUTES", 60)) * time.Minute,
+			AllowExits:  getEnvBool("FLASH_CRASH_ALLOW_EXITS", true),
+		},
+		Flatline: FlatlineConfig{
+			Closes:   getEnvInt("FLATLINE_IDENTICAL_CLOSES", 0),
+			Lookback: time.Duration(getEnvInt("FLATLINE_LOOKBACK_MINUTES", 60)) * time.Minute,
+		},
+		Signals: SignalConfig{
+			PriceDataIntervalMinutes: getEnvInt("SIGNAL_INTERVAL_MINUTES", 60),
+			LookbackPeriods:          getEnvInt("SIGNAL_LOOKBACK_PERIODS", 100),
+			ResampleCandles:          getEnvBool("SIGNAL_RESAMPLE_ENABLED", true),
+			RSIPeriod:                getEnvInt("RSI_PERIOD", 14),
+			RSIOversold:              getEnvFloat("RSI_OVERSOLD", 30),
+			RSIOverbought:            getEnvFloat("RSI_OVERBOUGHT", 70),
+			AdaptiveRSI:              getEnvBool("ADAPTIVE_RSI_ENABLED", false),
+			AdaptiveRSIShift:         getEnvFloat("ADAPTIVE_RSI_SHIFT", 10),
+			VolatilityModel:          getEnv("REGIME_VOLATILITY_MODEL", "close"),
+			MaxDataAge:               time.Duration(getEnvInt("SIGNAL_MAX_DATA_AGE_MINUTES", 10)) * time.Minute,
+			MaxVolumeRatio:           getEnvFloat("SIGNAL_MAX_VOLUME_RATIO", 3),
+			MinConfirmationVolume:    getEnvFloat("SIGNAL_MIN_CONFIRMATION_VOLUME_USDT", 0),
+			BollingerWeight:          getEnvFloat("SIGNAL_BOLLINGER_WEIGHT", 0),
+		},
+		Beta: BetaConfig{
+			MaxPortfolio: getEnvFloat("MAX_PORTFOLIO_BETA", 0),
+			Reference:    getEnv("BETA_REFERENCE_SYMBOL", "BTC-USDT"),
+			Window:       time.Duration(getEnvInt("BETA_WINDOW_HOURS", 24)) * time.Hour,
+		},
+		CandleBuffer: CandleBufferConfig{
+			Enabled: getEnvBool("CANDLE_BUFFER_ENABLED", false),
+			Refresh: time.Duration(getEnvInt("CANDLE_BUFFER_REFRESH_SECONDS", 60)) * time.Second,
+		},
+		ExitConfirmation: ExitConfirmationConfig{
+			IntervalMinutes: getEnvInt("EXIT_CONFIRMATION_INTERVAL_MINUTES", 0),
+			Default:         getEnvBool("EXIT_CONFIRMATION_DEFAULT", false),
+		},
+		ReferencePrice: ReferencePriceConfig{
+			Enabled:           getEnvBool("REFERENCE_PRICE_ENABLED", false),
+			Sources:           getEnvList("REFERENCE_PRICE_SOURCES", []string{"binance"}),
+			MaxDivergence:     getEnvFloat("REFERENCE_PRICE_MAX_DIVERGENCE", 0.02), // 2%
+			PauseOnDivergence: getEnvBool("REFERENCE_PRICE_PAUSE_ON_DIVERGENCE", true),
+		},
+		OrderBook: OrderBookConfig{
+			Enabled:         getEnvBool("ORDER_BOOK_ENABLED", false),
+			RefreshInterval: time.Duration(getEnvInt("ORDER_BOOK_REFRESH_MINUTES", 5)) * time.Minute,
+
+			DedupEnabled:       getEnvBool("WS_DEDUP_ENABLED", true),
+			WatermarkFlushRate: time.Duration(getEnvInt("WS_WATERMARK_FLUSH_SECONDS", 10)) * time.Second,
+		},
+		TrailingStop: TrailingStopConfig{
+			Percent:    getEnvFloat("TRAILING_STOP_PERCENT", 0),
+			Activation: getEnvFloat("TRAILING_STOP_ACTIVATION_PERCENT", 0.01), // 1%
+		},
+		Brackets: BracketConfig{
+			Enabled:         getEnvBool("BRACKET_ORDERS_ENABLED", false),
+			StopLimitOffset: getEnvFloat("BRACKET_STOP_LIMIT_OFFSET", 0.005), // 0.5%
+		},
+		Drift: DriftConfig{
+			Enabled:          getEnvBool("DRIFT_MONITOR_ENABLED", false),
+			Window:           time.Duration(getEnvInt("DRIFT_WINDOW_DAYS", 14)) * 24 * time.Hour,
+			CheckInterval:    time.Duration(getEnvInt("DRIFT_CHECK_INTERVAL_MINUTES", 60)) * time.Minute,
+			MinTrades:        getEnvInt("DRIFT_MIN_TRADES", 20),
+			WinRateTolerance: getEnvFloat("DRIFT_WIN_RATE_TOLERANCE", 0.15),
+			AvgPnLTolerance:  getEnvFloat("DRIFT_AVG_PNL_TOLERANCE", 0.5), // 50% of the baseline
+		},
+		FeeFloor: FeeFloorConfig{
+			Enabled:   getEnvBool("EXIT_FEE_FLOOR_ENABLED", false),
+			FeeRate:   getEnvFloat("EXIT_FEE_RATE", 0.001), // 0.1%
+			MinNetPnL: getEnvFloat("EXIT_MIN_NET_PNL_USDT", 0),
+		},
+		TradeSink: TradeSinkConfig{
+			WebhookURL:  getEnv("TRADE_SINK_WEBHOOK_URL", ""),
+			FilePath:    getEnv("TRADE_SINK_FILE", ""),
+			Buffer:      getEnvInt("TRADE_SINK_BUFFER", 1000),
+			SendTimeout: time.Duration(getEnvInt("TRADE_SINK_TIMEOUT_SECONDS", 10)) * time.Second,
+		},
+		QuoteRates: QuoteRateConfig{
+			Enabled:      getEnvBool("QUOTE_CONVERSION_ENABLED", true),
+			TTL:          time.Duration(getEnvInt("QUOTE_RATE_TTL_SECONDS", 60)) * time.Second,
+			MaxAge:       time.Duration(getEnvInt("QUOTE_RATE_MAX_AGE_MINUTES", 15)) * time.Minute,
+			BlockOnStale: getEnvBool("QUOTE_RATE_BLOCK_ON_STALE", true),
+		},
+		FeeCheck: FeeCheckConfig{
+			Enabled:   getEnvBool("FEE_RECONCILIATION_ENABLED", false),
+			Tolerance: getEnvFloat("FEE_RECONCILIATION_TOLERANCE", 0.1), // 10%
+			RateTTL:   time.Duration(getEnvInt("FEE_RATE_CACHE_MINUTES", 60)) * time.Minute,
+		},
+		Liquidity: LiquidityConfig{
+			MaxDepthFraction: getEnvFloat("LIQUIDITY_MAX_DEPTH_FRACTION", 0),
+			DepthBps:         getEnvFloat("LIQUIDITY_DEPTH_BPS", 50),
+		},
+		Symbols: SymbolConfig{
+			RefreshInterval: time.Duration(getEnvInt("SYMBOL_METADATA_REFRESH_MINUTES", 60)) * time.Minute,
+		},
+		Reporting: ReportingConfig{
+			DisplayCurrency: getEnv("DISPLAY_CURRENCY", ""),
+			RateSource:      getEnv("FIAT_RATE_SOURCE", "exchangerate"),
+			StaticRate:      getEnvFloat("FIAT_STATIC_RATE", 0),
+			RateTTL:         time.Duration(getEnvInt("FIAT_RATE_TTL_MINUTES", 60)) * time.Minute,
+
+			OffsettingWindow:    time.Duration(getEnvInt("OFFSETTING_FILL_WINDOW_SECONDS", 5)) * time.Second,
+			OffsettingTolerance: getEnvFloat("OFFSETTING_FILL_QUANTITY_TOLERANCE", 0.01),
 		},
-		TradingInterval:     time.Duration(getEnvInt("TRADING_INTERVAL_SECONDS", 30)) * time.Second,
-		MaxPositionsPerPair: getEnvInt("MAX_POSITIONS_PER_PAIR", 5),
-		DefaultPositionSize: getEnvFloat("DEFAULT_POSITION_SIZE_USDT", 100.0),
-		StopLossPercent:     getEnvFloat("STOP_LOSS_PERCENT", 0.05),   // 5%
-		TakeProfitPercent:   getEnvFloat("TAKE_PROFIT_PERCENT", 0.03), // 3%
-		MetricsPort:         getEnv("METRICS_PORT", "8082"),
 	}
+	cfg.Accounts = loadAccounts(cfg)
+	return cfg
+}
+
+// loadAccounts reads the accounts named in ACCOUNTS. Each takes its
+// credentials from ACCOUNT_<NAME>_KUCOIN_API_KEY, _API_SECRET and
+// _PASSPHRASE and may override the global MAX_POSITIONS_PER_PAIR,
+// DEFAULT_POSITION_SIZE_USDT, MAX_RISK_PER_TRADE_USDT,
+// LOSS_VELOCITY_MAX_LOSS_USDT and DAILY_MAX_LOSS_USDT the same way. Without ACCOUNTS the service
+// trades a single default account with the KUCOIN_* credentials.
+func loadAccounts(c *Config) []AccountConfig {
+	names := getEnvList("ACCOUNTS", nil)
+	if len(names) == 0 {
+		return []AccountConfig{{
+			Name:                "default",
+			KuCoin:              c.KuCoin,
+			MaxPositionsPerPair: c.MaxPositionsPerPair,
+			DefaultPositionSize: c.DefaultPositionSize,
+			MaxRiskPerTradeUSDT: c.MaxRiskPerTradeUSDT,
+			MaxLossUSDT:         c.LossVelocity.MaxLossUSDT,
+			DailyMaxLossUSDT:    c.DailyMaxLossUSDT,
+		}}
+	}
+
+	accounts := make([]AccountConfig, 0, len(names))
+	for _, name := range names {
+		prefix := "ACCOUNT_" + strings.ToUpper(name) + "_"
+
+		credentials := c.KuCoin
+		credentials.APIKey = getEnv(prefix+"KUCOIN_API_KEY", "")
+		credentials.APISecret = getEnv(prefix+"KUCOIN_API_SECRET", "")
+		credentials.Passphrase = getEnv(prefix+"KUCOIN_PASSPHRASE", "")
+
+		accounts = append(accounts, AccountConfig{
+			Name:                name,
+			KuCoin:              credentials,
+			MaxPositionsPerPair: getEnvInt(prefix+"MAX_POSITIONS_PER_PAIR", c.MaxPositionsPerPair),
+			DefaultPositionSize: getEnvFloat(prefix+"DEFAULT_POSITION_SIZE_USDT", c.DefaultPositionSize),
+			MaxRiskPerTradeUSDT: getEnvFloat(prefix+"MAX_RISK_PER_TRADE_USDT", c.MaxRiskPerTradeUSDT),
+			MaxLossUSDT:         getEnvFloat(prefix+"LOSS_VELOCITY_MAX_LOSS_USDT", c.LossVelocity.MaxLossUSDT),
+			DailyMaxLossUSDT:    getEnvFloat(prefix+"DAILY_MAX_LOSS_USDT", c.DailyMaxLossUSDT),
+		})
+	}
+	return accounts
+}
+
+// Validate rejects settings that lose money by design. A take profit smaller
+// than the stop loss risks more per trade than it can make, so it needs an
+// explicit ALLOW_NEGATIVE_RISK_REWARD override, and a MIN_RISK_REWARD low
+// enough to admit it. Unknown policy names are rejected too.
+func (c *Config) Validate() error {
+	if c.StopLossPercent > 0 && c.TakeProfitPercent > 0 &&
+		c.TakeProfitPercent < c.StopLossPercent && !c.AllowNegativeRR {
+		return fmt.Errorf("TAKE_PROFIT_PERCENT (%v) is below STOP_LOSS_PERCENT (%v), giving a negative risk-reward; "+
+			"raise it or set ALLOW_NEGATIVE_RISK_REWARD=true", c.TakeProfitPercent, c.StopLossPercent)
+	}
+	if c.MinRiskReward > 0 && c.RiskReward() < c.MinRiskReward {
+		return fmt.Errorf("default risk-reward %.2f is below MIN_RISK_REWARD (%v), every entry would be skipped; "+
+			"widen the take profit or lower MIN_RISK_REWARD", c.RiskReward(), c.MinRiskReward)
+	}
+	switch c.ExitTieBreak {
+	case "close", "stop_first", "candle_open":
+	default:
+		return fmt.Errorf("EXIT_TIE_BREAK must be close, stop_first or candle_open, got %q", c.ExitTieBreak)
+	}
+	if c.ExposureMode != "gross" && c.ExposureMode != "net" {
+		return fmt.Errorf("EXPOSURE_MODE must be gross or net, got %q", c.ExposureMode)
+	}
+	if c.ExitConfirmation.IntervalMinutes > 0 &&
+		c.ExitConfirmation.IntervalMinutes <= c.Signals.PriceDataIntervalMinutes {
+		return fmt.Errorf("EXIT_CONFIRMATION_INTERVAL_MINUTES (%d) must be above SIGNAL_INTERVAL_MINUTES (%d)",
+			c.ExitConfirmation.IntervalMinutes, c.Signals.PriceDataIntervalMinutes)
+	}
+	seen := make(map[string]bool, len(c.Accounts))
+	for _, account := range c.Accounts {
+		if len(account.Name) > 50 {
+			return fmt.Errorf("account name %q is longer than 50 characters", account.Name)
+		}
+		if seen[account.Name] {
+			return fmt.Errorf("account %q is listed more than once in ACCOUNTS", account.Name)
+		}
+		seen[account.Name] = true
+	}
+	return nil
+}
+
+// RiskReward returns the default take profit relative to the stop loss
+func (c *Config) RiskReward() float64 {
+	if c.StopLossPercent <= 0 {
+		return 0
+	}
+	return c.TakeProfitPercent / c.StopLossPercent
 }
 
 func getEnv(key, defaultValue string) string {
@@ -73,3 +611,16 @@ func getEnvBool(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+func getEnvList(key string, defaultValue []string) []string {
+	if value := os.Getenv(key); value != "" {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+	return defaultValue
+}
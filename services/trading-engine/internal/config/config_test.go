@@ -0,0 +1,72 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultConfigValidates(t *testing.T) {
+	cfg := Load()
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() on the defaults = %v, want nil", err)
+	}
+	if cfg.TakeProfitPercent < cfg.StopLossPercent {
+		t.Errorf("default take profit %v below the default stop loss %v", cfg.TakeProfitPercent, cfg.StopLossPercent)
+	}
+}
+
+func TestValidateRiskReward(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name: "take profit above stop loss",
+			env:  map[string]string{"STOP_LOSS_PERCENT": "0.04", "TAKE_PROFIT_PERCENT": "0.08"},
+		},
+		{
+			name:    "take profit below stop loss",
+			env:     map[string]string{"STOP_LOSS_PERCENT": "0.05", "TAKE_PROFIT_PERCENT": "0.03"},
+			wantErr: "negative risk-reward",
+		},
+		{
+			name: "explicit override admits a negative risk-reward",
+			env: map[string]string{
+				"STOP_LOSS_PERCENT": "0.05", "TAKE_PROFIT_PERCENT": "0.03", "ALLOW_NEGATIVE_RISK_REWARD": "true",
+				"MIN_RISK_REWARD": "0.5",
+			},
+		},
+		{
+			name: "override still bounded by the minimum risk-reward",
+			env: map[string]string{
+				"STOP_LOSS_PERCENT": "0.05", "TAKE_PROFIT_PERCENT": "0.03", "ALLOW_NEGATIVE_RISK_REWARD": "true",
+			},
+			wantErr: "MIN_RISK_REWARD",
+		},
+		{
+			name: "disabled take profit is not compared",
+			env:  map[string]string{"STOP_LOSS_PERCENT": "0.05", "TAKE_PROFIT_PERCENT": "0", "MIN_RISK_REWARD": "0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			err := Load().Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() = %v, want an error mentioning %s", err, tt.wantErr)
+			}
+		})
+	}
+}
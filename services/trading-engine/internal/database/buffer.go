@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// CandleBuffer keeps the most recent minute candles of each symbol in memory
+// so indicator reads stop re-querying the whole window every cycle. A
+// symbol's buffer is seeded from the source on first use with the full
+// window, then topped up at most once per refresh interval with only the
+// candles newer than the last one held; reads in between touch no database.
+// Windows reaching back past the buffer are passed through to the source.
+// It is safe for concurrent use.
+type CandleBuffer struct {
+	source   PriceHistorySource
+	capacity int           // Minute candles kept per symbol
+	refresh  time.Duration // Least time between top-ups of a symbol
+	logger   *logrus.Logger
+
+	mu      sync.Mutex
+	symbols map[string]*symbolCandles
+}
+
+// symbolCandles is one symbol's buffered window, oldest first
+type symbolCandles struct {
+	mu          sync.Mutex
+	candles     []models.Candle
+	coveredFrom time.Time // Start of the window the buffer answers for
+	refreshedAt time.Time // Zero until seeded
+}
+
+func NewCandleBuffer(source PriceHistorySource, capacity int, refresh time.Duration, logger *logrus.Logger) *CandleBuffer {
+	return &CandleBuffer{
+		source:   source,
+		capacity: capacity,
+		refresh:  refresh,
+		logger:   logger,
+		symbols:  make(map[string]*symbolCandles),
+	}
+}
+
+// GetPriceHistory returns the buffered candles since the given time, reading
+// from the source only to seed or top up the symbol's buffer
+func (b *CandleBuffer) GetPriceHistory(ctx context.Context, symbol string, since time.Time) ([]models.Candle, error) {
+	entry := b.entry(symbol)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	now := time.Now()
+	if err := b.update(ctx, symbol, entry, now); err != nil {
+		return nil, err
+	}
+
+	if since.Before(entry.coveredFrom) {
+		return b.source.GetPriceHistory(ctx, symbol, since)
+	}
+
+	result := make([]models.Candle, 0, len(entry.candles))
+	for _, candle := range entry.candles {
+		if !candle.Timestamp.Before(since) {
+			result = append(result, candle)
+		}
+	}
+	return result, nil
+}
+
+func (b *CandleBuffer) entry(symbol string) *symbolCandles {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry, ok := b.symbols[symbol]
+	if !ok {
+		entry = &symbolCandles{}
+		b.symbols[symbol] = entry
+	}
+	return entry
+}
+
+// update seeds an empty buffer with the whole window or, once the refresh
+// interval has passed, appends the candles stored since the newest buffered
+// one. Candles older than the window or beyond the capacity are evicted.
+func (b *CandleBuffer) update(ctx context.Context, symbol string, entry *symbolCandles, now time.Time) error {
+	if !entry.refreshedAt.IsZero() && now.Sub(entry.refreshedAt) < b.refresh {
+		return nil
+	}
+
+	// The window is held with a margin of a refresh interval, so callers that
+	// computed "now minus window" before the last top-up are still covered
+	margin := b.refresh + time.Minute
+	span := time.Duration(b.capacity)*time.Minute + margin
+	since := now.Add(-span)
+	seeding := len(entry.candles) == 0
+	if !seeding {
+		since = entry.candles[len(entry.candles)-1].Timestamp
+	}
+
+	fresh, err := b.source.GetPriceHistory(ctx, symbol, since)
+	if err != nil {
+		return err
+	}
+
+	entry.candles = appendCandles(entry.candles, fresh)
+	entry.coveredFrom = now.Add(-span)
+	entry.refreshedAt = now
+	entry.candles = evictCandles(entry.candles, entry.coveredFrom, b.capacity+int(margin/time.Minute))
+
+	if seeding {
+		b.logger.WithFields(logrus.Fields{
+			"symbol":  symbol,
+			"candles": len(entry.candles),
+		}).Debug("Seeded candle buffer")
+	}
+	return nil
+}
+
+// appendCandles adds the candles newer than the last buffered one. A candle
+// with the same timestamp as the last replaces it, picking up a late update.
+func appendCandles(buffered, fresh []models.Candle) []models.Candle {
+	for _, candle := range fresh {
+		if n := len(buffered); n > 0 {
+			last := buffered[n-1].Timestamp
+			if candle.Timestamp.Before(last) {
+				continue
+			}
+			if candle.Timestamp.Equal(last) {
+				buffered[n-1] = candle
+				continue
+			}
+		}
+		buffered = append(buffered, candle)
+	}
+	return buffered
+}
+
+// evictCandles drops the candles before the window start and the oldest ones
+// beyond the capacity
+func evictCandles(candles []models.Candle, from time.Time, capacity int) []models.Candle {
+	start := 0
+	for start < len(candles) && candles[start].Timestamp.Before(from) {
+		start++
+	}
+	if capacity > 0 && len(candles)-start > capacity {
+		start = len(candles) - capacity
+	}
+	if start == 0 {
+		return candles
+	}
+
+	// Copy so the evicted candles' backing array can be released
+	return append([]models.Candle(nil), candles[start:]...)
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/signals"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// minuteSource serves its minute candles from the requested time on,
+// counting the reads and keeping the last one's start
+type minuteSource struct {
+	mu        sync.Mutex
+	candles   []models.Candle
+	reads     int
+	lastSince time.Time
+}
+
+func (s *minuteSource) GetPriceHistory(_ context.Context, _ string, since time.Time) ([]models.Candle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reads++
+	s.lastSince = since
+	var candles []models.Candle
+	for _, candle := range s.candles {
+		if !candle.Timestamp.Before(since) {
+			candles = append(candles, candle)
+		}
+	}
+	return candles, nil
+}
+
+// add appends a minute candle after the last one
+func (s *minuteSource) add(price float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	timestamp := time.Now().Truncate(time.Minute)
+	if n := len(s.candles); n > 0 {
+		timestamp = s.candles[n-1].Timestamp.Add(time.Minute)
+	}
+	s.candles = append(s.candles, models.Candle{Timestamp: timestamp, Open: price, High: price * 1.001, Low: price * 0.999, Close: price, Volume: 10})
+}
+
+// newMinuteSource holds n minute candles ending ten minutes ago, leaving room
+// to add newer ones that are not in the future, with closes swinging around a
+// slow rise
+func newMinuteSource(n int) *minuteSource {
+	end := time.Now().Truncate(time.Minute).Add(-10 * time.Minute)
+	s := &minuteSource{}
+	for i := 0; i < n; i++ {
+		price := 100 + float64(i)*0.05 + 2*math.Sin(float64(i)/5)
+		s.candles = append(s.candles, models.Candle{
+			Timestamp: end.Add(-time.Duration(n-1-i) * time.Minute),
+			Open:      price, High: price * 1.001, Low: price * 0.999, Close: price, Volume: 10,
+		})
+	}
+	return s
+}
+
+func TestCandleBufferServesReadsFromMemory(t *testing.T) {
+	source := newMinuteSource(120)
+	buffer := NewCandleBuffer(source, 60, time.Hour, utils.NewDiscardLogger())
+	since := time.Now().Add(-30 * time.Minute)
+
+	want, _ := source.GetPriceHistory(context.Background(), "BTC-USDT", since)
+	source.reads = 0
+	for i := 0; i < 3; i++ {
+		got, err := buffer.GetPriceHistory(context.Background(), "BTC-USDT", since)
+		if err != nil {
+			t.Fatalf("GetPriceHistory() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("read %d returned %d candles, want the source's %d", i, len(got), len(want))
+		}
+	}
+	if source.reads != 1 {
+		t.Errorf("source read %d times, want 1 to seed the buffer", source.reads)
+	}
+
+	// A window reaching back past the buffer goes to the source
+	if _, err := buffer.GetPriceHistory(context.Background(), "BTC-USDT", time.Now().Add(-3*time.Hour)); err != nil {
+		t.Fatalf("GetPriceHistory() error = %v", err)
+	}
+	if source.reads != 2 {
+		t.Errorf("source read %d times, want a pass-through for the longer window", source.reads)
+	}
+}
+
+func TestCandleBufferAppendsIncrementally(t *testing.T) {
+	source := newMinuteSource(30)
+	buffer := NewCandleBuffer(source, 60, 0, utils.NewDiscardLogger())
+	since := time.Now().Add(-20 * time.Minute)
+
+	if _, err := buffer.GetPriceHistory(context.Background(), "BTC-USDT", since); err != nil {
+		t.Fatalf("GetPriceHistory() error = %v", err)
+	}
+	last := source.candles[len(source.candles)-1]
+	source.add(123)
+
+	got, err := buffer.GetPriceHistory(context.Background(), "BTC-USDT", since)
+	if err != nil {
+		t.Fatalf("GetPriceHistory() error = %v", err)
+	}
+	if !source.lastSince.Equal(last.Timestamp) {
+		t.Errorf("top-up read from %v, want only candles from the last buffered %v", source.lastSince, last.Timestamp)
+	}
+	if n := len(got); n == 0 || got[n-1].Close != 123 {
+		t.Errorf("buffer ends with %+v, want the appended candle", got[len(got)-1])
+	}
+	for i := 1; i < len(got); i++ {
+		if !got[i].Timestamp.After(got[i-1].Timestamp) {
+			t.Fatalf("candle %d at %v does not follow %v", i, got[i].Timestamp, got[i-1].Timestamp)
+		}
+	}
+}
+
+func TestAppendCandles(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minute int, price float64) models.Candle {
+		return models.Candle{Timestamp: start.Add(time.Duration(minute) * time.Minute), Close: price}
+	}
+
+	buffered := []models.Candle{at(0, 1), at(1, 2)}
+	got := appendCandles(buffered, []models.Candle{at(0, 9), at(1, 3), at(2, 4)})
+
+	want := []models.Candle{at(0, 1), at(1, 3), at(2, 4)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("appendCandles() = %+v, want older candles skipped and the last replaced", got)
+	}
+}
+
+func TestEvictCandles(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	candles := make([]models.Candle, 10)
+	for i := range candles {
+		candles[i] = models.Candle{Timestamp: start.Add(time.Duration(i) * time.Minute)}
+	}
+
+	tests := []struct {
+		name      string
+		from      time.Time
+		capacity  int
+		wantFirst int
+	}{
+		{name: "within window and capacity", from: start, capacity: 10, wantFirst: 0},
+		{name: "before the window", from: start.Add(3 * time.Minute), capacity: 10, wantFirst: 3},
+		{name: "beyond capacity", from: start, capacity: 4, wantFirst: 6},
+		{name: "window and capacity", from: start.Add(2 * time.Minute), capacity: 5, wantFirst: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := evictCandles(candles, tt.from, tt.capacity)
+			if len(got) != len(candles)-tt.wantFirst || !got[0].Timestamp.Equal(candles[tt.wantFirst].Timestamp) {
+				t.Errorf("kept %d candles from %v, want those from candle %d", len(got), got[0].Timestamp, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestCandleBufferIndicatorsMatchFullRecompute(t *testing.T) {
+	source := newMinuteSource(150)
+	buffer := NewCandleBuffer(source, 100, 0, utils.NewDiscardLogger())
+	config := signals.Config{PriceDataIntervalMinutes: 1, LookbackPeriods: 100}
+	buffered := signals.NewGenerator(buffer, config, utils.NewDiscardLogger())
+	direct := signals.NewGenerator(source, config, utils.NewDiscardLogger())
+
+	// Seeded, then topped up with a candle at a time
+	for i, price := range []float64{0, 104, 101, 107} {
+		if i > 0 {
+			source.add(price)
+		}
+		current := source.candles[len(source.candles)-1].Close
+
+		want := direct.GenerateSignal(context.Background(), "BTC-USDT", current)
+		got := buffered.GenerateSignal(context.Background(), "BTC-USDT", current)
+		if got.Action != want.Action || !reflect.DeepEqual(got.Metadata, want.Metadata) {
+			t.Errorf("step %d: buffered signal %s %v, want the full recompute's %s %v", i, got.Action, got.Metadata, want.Action, want.Metadata)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+
+	sharedDB "github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/database"
+)
+
+// fakeQuery is one statement the repository sent
+type fakeQuery struct {
+	query string
+	args  []driver.Value
+}
+
+// fakeResult is what the fake database answers to a query
+type fakeResult struct {
+	columns    []string
+	rows       [][]driver.Value
+	unaffected bool // An exec statement changed no rows
+}
+
+// fakeDB is a database/sql driver answering every query through respond and
+// recording the statements, so the SQL a repository sends and how it reads
+// the answer can be checked without PostgreSQL
+type fakeDB struct {
+	respond func(query string, args []driver.Value) (fakeResult, error)
+
+	mu      sync.Mutex
+	queries []fakeQuery
+}
+
+func newFakeDB(respond func(query string, args []driver.Value) (fakeResult, error)) (*fakeDB, *sharedDB.DB) {
+	fake := &fakeDB{respond: respond}
+	return fake, &sharedDB.DB{DB: sql.OpenDB(fake)}
+}
+
+func (f *fakeDB) Queries() []fakeQuery {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]fakeQuery(nil), f.queries...)
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{db: f}, nil
+}
+
+func (f *fakeDB) Driver() driver.Driver {
+	return nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, named []driver.NamedValue) (driver.Rows, error) {
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+
+	c.db.mu.Lock()
+	c.db.queries = append(c.db.queries, fakeQuery{query: query, args: args})
+	c.db.mu.Unlock()
+
+	result, err := c.db.respond(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{result: result}, nil
+}
+
+// ExecContext records the statement and answers it through respond, whose
+// rows are ignored
+func (c *fakeConn) ExecContext(_ context.Context, query string, named []driver.NamedValue) (driver.Result, error) {
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+
+	c.db.mu.Lock()
+	c.db.queries = append(c.db.queries, fakeQuery{query: query, args: args})
+	c.db.mu.Unlock()
+
+	result, err := c.db.respond(query, args)
+	if err != nil {
+		return nil, err
+	}
+	if result.unaffected {
+		return driver.RowsAffected(0), nil
+	}
+	return driver.RowsAffected(1), nil
+}
+
+type fakeRows struct {
+	result fakeResult
+	next   int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.result.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.result.rows) {
+		return io.EOF
+	}
+	copy(dest, r.result.rows[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// RepositoryInterface is the storage the engine and the components it builds
+// read and write: pairs and configs, positions, orders, brackets, risk halts
+// and the trade history sizing and risk checks look back on.
+type RepositoryInterface interface {
+	Account() string
+
+	GetActiveSelectedPairs(ctx context.Context) ([]models.SelectedPair, error)
+	GetTradingConfig(ctx context.Context, pairID int64) (*models.TradingConfig, error)
+	CreateTradingConfig(ctx context.Context, config models.TradingConfig) (*models.TradingConfig, error)
+	UpdateTradingConfigRange(ctx context.Context, configID string, rangeMin, rangeMax float64) error
+	CreateGridRecenterEvent(ctx context.Context, event models.GridRecenterEvent) error
+	GetLatestQuote(ctx context.Context, symbol string) (float64, time.Time, error)
+	GetPriceHistory(ctx context.Context, symbol string, since time.Time) ([]models.Candle, error)
+
+	GetOpenPositions(ctx context.Context, pairID int64) ([]models.Position, error)
+	GetAllOpenPositions(ctx context.Context) ([]models.Position, error)
+	GetOpenPositionsWithInvalidSide(ctx context.Context) ([]models.Position, error)
+	GetPositionByID(ctx context.Context, id string) (*models.Position, error)
+	CreatePosition(ctx context.Context, position *models.Position) error
+	UpdatePosition(ctx context.Context, position models.Position) error
+
+	CreateOrder(ctx context.Context, order models.Order) error
+	CountOpenLimitOrders(ctx context.Context, pairID int64) (int, error)
+	GetPendingOrders(ctx context.Context) ([]models.Order, error)
+	GetPendingEntryOrders(ctx context.Context, pairID int64) ([]models.Order, error)
+	GetStrandedOrders(ctx context.Context, createdBefore time.Time) ([]models.Order, error)
+	SetOrderExchangeID(ctx context.Context, orderID, kucoinOrderID string) error
+	UpdateOrderStatus(ctx context.Context, orderID, status string) error
+	UpdateOrderFill(ctx context.Context, order models.Order) error
+
+	GetRestingGridOrders(ctx context.Context, pairID int64) ([]models.Order, error)
+	GetUnsettledGridFills(ctx context.Context, pairID int64) ([]models.Order, error)
+	SettleGridOrder(ctx context.Context, orderID, positionID string) error
+
+	CreateBracketOrder(ctx context.Context, bracket models.BracketOrder) error
+	GetOpenBracketOrders(ctx context.Context) ([]models.BracketOrder, error)
+	GetOpenBracketOrderByPosition(ctx context.Context, positionID string) (*models.BracketOrder, error)
+	UpdateBracketOrder(ctx context.Context, bracket models.BracketOrder) error
+
+	GetActiveRiskHalts(ctx context.Context) ([]models.RiskHalt, error)
+	SaveRiskHalt(ctx context.Context, halt models.RiskHalt) error
+	GetRecentRealizedPnL(ctx context.Context, since time.Time) (float64, error)
+	GetRecentRealizedLoss(ctx context.Context, since time.Time) (float64, error)
+	GetRecentClosedPositions(ctx context.Context, limit int) ([]models.Position, error)
+	GetStrategyTrackRecord(ctx context.Context, strategyTag string) (int, float64, error)
+
+	CreateTradeDecision(ctx context.Context, decision models.TradeDecision) error
+	CreateWouldTrade(ctx context.Context, trade models.WouldTrade) error
+}
+
+var _ RepositoryInterface = (*Repository)(nil)
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// PriceHistorySource reads the candles of a symbol since a time, oldest first
+type PriceHistorySource interface {
+	GetPriceHistory(ctx context.Context, symbol string, since time.Time) ([]models.Candle, error)
+}
+
+// MergedPriceHistory serves windows reaching back past the retained minute
+// data by stitching downsampled hourly candles in front of the minute
+// candles. The boundary is the first whole hour at or after the oldest minute
+// candle: hourly candles cover the window up to it and minute candles from it
+// on, so no period is counted twice. It keeps no state and is safe for
+// concurrent use.
+type MergedPriceHistory struct {
+	repo *Repository
+}
+
+func NewMergedPriceHistory(repo *Repository) *MergedPriceHistory {
+	return &MergedPriceHistory{repo: repo}
+}
+
+// GetPriceHistory returns the candles since the given time. Windows within
+// the minute data are read from it alone.
+func (m *MergedPriceHistory) GetPriceHistory(ctx context.Context, symbol string, since time.Time) ([]models.Candle, error) {
+	oldest, ok, err := m.repo.GetOldestPriceTime(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	if ok && !since.Before(oldest) {
+		return m.repo.GetPriceHistory(ctx, symbol, since)
+	}
+
+	// Without minute data everything comes from the hourly table
+	boundary := time.Now()
+	if ok {
+		boundary = oldest.Truncate(time.Hour)
+		if boundary.Before(oldest) {
+			boundary = boundary.Add(time.Hour)
+		}
+	}
+
+	hourly, err := m.repo.GetHourlyPriceHistory(ctx, symbol, since.Truncate(time.Hour), boundary)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return hourly, nil
+	}
+
+	minute, err := m.repo.GetPriceHistory(ctx, symbol, boundary)
+	if err != nil {
+		return nil, err
+	}
+
+	return MergeCandles(hourly, time.Hour, minute), nil
+}
+
+// MergeCandles joins coarse candles of the given period in front of fine
+// ones, dropping any coarse candle whose period reaches into the first fine
+// candle
+func MergeCandles(coarse []models.Candle, period time.Duration, fine []models.Candle) []models.Candle {
+	if len(fine) == 0 {
+		return coarse
+	}
+
+	first := fine[0].Timestamp
+	merged := make([]models.Candle, 0, len(coarse)+len(fine))
+	for _, candle := range coarse {
+		if candle.Timestamp.Add(period).After(first) {
+			break
+		}
+		merged = append(merged, candle)
+	}
+
+	return append(merged, fine...)
+}
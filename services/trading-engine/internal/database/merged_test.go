@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// priceTables answers reads of price_data from minute candles starting at
+// firstMinute, none when it is zero, and reads of price_data_hourly from
+// hourly candles starting at firstHour; closes are 1 for hourly candles and
+// 2 for minute ones so the source of each candle shows
+func priceTables(firstMinute time.Time, minutes int, firstHour time.Time, hours int) func(string, []driver.Value) (fakeResult, error) {
+	columns := []string{"timestamp", "open", "high", "low", "close", "volume"}
+	candle := func(timestamp time.Time, price float64) []driver.Value {
+		return []driver.Value{timestamp, price, price, price, price, 1.0}
+	}
+
+	return func(query string, args []driver.Value) (fakeResult, error) {
+		switch {
+		case strings.Contains(query, "MIN(timestamp)"):
+			if firstMinute.IsZero() {
+				return fakeResult{columns: []string{"min"}, rows: [][]driver.Value{{nil}}}, nil
+			}
+			return fakeResult{columns: []string{"min"}, rows: [][]driver.Value{{firstMinute}}}, nil
+
+		case strings.Contains(query, "price_data_hourly"):
+			since, until := args[1].(time.Time), args[2].(time.Time)
+			result := fakeResult{columns: columns}
+			for i := 0; i < hours; i++ {
+				timestamp := firstHour.Add(time.Duration(i) * time.Hour)
+				if !timestamp.Before(since) && timestamp.Before(until) {
+					result.rows = append(result.rows, candle(timestamp, 1))
+				}
+			}
+			return result, nil
+
+		default:
+			since := args[1].(time.Time)
+			result := fakeResult{columns: columns}
+			for i := 0; i < minutes && !firstMinute.IsZero(); i++ {
+				timestamp := firstMinute.Add(time.Duration(i) * time.Minute)
+				if !timestamp.Before(since) {
+					result.rows = append(result.rows, candle(timestamp, 2))
+				}
+			}
+			return result, nil
+		}
+	}
+}
+
+func TestMergedPriceHistorySpansBothTables(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	// Minute data from 12:30 for three hours; hourly data for the whole day,
+	// overlapping it
+	firstMinute := day.Add(12*time.Hour + 30*time.Minute)
+
+	tests := []struct {
+		name        string
+		firstMinute time.Time
+		since       time.Time
+		wantHourly  int
+		wantMinute  int
+		wantFirst   time.Time
+	}{
+		{
+			// Hourly 03:00 to 12:00, minute candles from the 13:00 boundary
+			name:        "window reaching past the minute data",
+			firstMinute: firstMinute,
+			since:       day.Add(3 * time.Hour),
+			wantHourly:  10,
+			wantMinute:  150,
+			wantFirst:   day.Add(3 * time.Hour),
+		},
+		{
+			name:        "window within the minute data",
+			firstMinute: firstMinute,
+			since:       day.Add(14 * time.Hour),
+			wantMinute:  90,
+			wantFirst:   day.Add(14 * time.Hour),
+		},
+		{
+			name:       "no minute data",
+			since:      day.Add(20 * time.Hour),
+			wantHourly: 4,
+			wantFirst:  day.Add(20 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, db := newFakeDB(priceTables(tt.firstMinute, 180, day, 24))
+			merged := NewMergedPriceHistory(NewRepository(db, 0, utils.NewDiscardLogger()))
+
+			candles, err := merged.GetPriceHistory(context.Background(), "BTC-USDT", tt.since)
+			if err != nil {
+				t.Fatalf("GetPriceHistory() error = %v", err)
+			}
+
+			hourly, minute := 0, 0
+			for i, candle := range candles {
+				if i > 0 && !candle.Timestamp.After(candles[i-1].Timestamp) {
+					t.Fatalf("candle %d at %v does not follow %v", i, candle.Timestamp, candles[i-1].Timestamp)
+				}
+				if candle.Close == 1 {
+					hourly++
+					if minute > 0 {
+						t.Fatalf("hourly candle at %v after minute candles", candle.Timestamp)
+					}
+				} else {
+					minute++
+				}
+			}
+			if hourly != tt.wantHourly || minute != tt.wantMinute {
+				t.Errorf("got %d hourly and %d minute candles, want %d and %d", hourly, minute, tt.wantHourly, tt.wantMinute)
+			}
+			if len(candles) > 0 && !candles[0].Timestamp.Equal(tt.wantFirst) {
+				t.Errorf("first candle at %v, want %v", candles[0].Timestamp, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestMergeCandlesDropsOverlap(t *testing.T) {
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	coarse := []models.Candle{{Timestamp: start}, {Timestamp: start.Add(time.Hour)}, {Timestamp: start.Add(2 * time.Hour)}}
+	// Minute data starting halfway through the second hour
+	fine := []models.Candle{{Timestamp: start.Add(90 * time.Minute)}, {Timestamp: start.Add(91 * time.Minute)}}
+
+	merged := MergeCandles(coarse, time.Hour, fine)
+
+	want := []time.Time{start, start.Add(90 * time.Minute), start.Add(91 * time.Minute)}
+	if len(merged) != len(want) {
+		t.Fatalf("merged %d candles, want %d", len(merged), len(want))
+	}
+	for i := range want {
+		if !merged[i].Timestamp.Equal(want[i]) {
+			t.Errorf("candle %d at %v, want %v", i, merged[i].Timestamp, want[i])
+		}
+	}
+
+	if got := MergeCandles(coarse, time.Hour, nil); len(got) != len(coarse) {
+		t.Errorf("merged %d candles without fine data, want the %d coarse", len(got), len(coarse))
+	}
+}
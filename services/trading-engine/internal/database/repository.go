@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
@@ -12,15 +13,62 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// ErrNotFound is returned when an update targets a row that does not exist
+var ErrNotFound = errors.New("not found")
+
+// DefaultAccount owns positions and orders created by a repository that is
+// not scoped to an account
+const DefaultAccount = "default"
+
 type Repository struct {
-	db     *database.DB
-	logger *logrus.Logger
+	db         *database.DB
+	maxCandles int    // Most recent candles a price history read returns, 0 for no limit
+	account    string // Account position and order queries are limited to, empty for all
+	logger     *logrus.Logger
 }
 
-func NewRepository(db *database.DB, logger *logrus.Logger) *Repository {
+func NewRepository(db *database.DB, maxCandles int, logger *logrus.Logger) *Repository {
 	return &Repository{
-		db:     db,
-		logger: logger,
+		db:         db,
+		maxCandles: maxCandles,
+		logger:     logger,
+	}
+}
+
+// ForAccount returns a repository whose position, order and bracket queries
+// only see the account's rows and which creates them under the account.
+// Pair, price and trading config data stay shared between accounts.
+func (r *Repository) ForAccount(account string) *Repository {
+	scoped := *r
+	scoped.account = account
+	return &scoped
+}
+
+// Account returns the account new positions and orders are created under
+func (r *Repository) Account() string {
+	if r.account == "" {
+		return DefaultAccount
+	}
+	return r.account
+}
+
+// candleLimit is the LIMIT argument for price history reads; NULL means no
+// limit in PostgreSQL
+func (r *Repository) candleLimit() interface{} {
+	if r.maxCandles <= 0 {
+		return nil
+	}
+	return r.maxCandles
+}
+
+// warnIfCapped logs when a price history read hit the candle cap, meaning
+// the requested window was truncated to its most recent candles
+func (r *Repository) warnIfCapped(symbol string, count int) {
+	if r.maxCandles > 0 && count >= r.maxCandles {
+		r.logger.WithFields(logrus.Fields{
+			"symbol":      symbol,
+			"max_candles": r.maxCandles,
+		}).Warn("Price history window exceeds the candle cap, older candles dropped")
 	}
 }
 
@@ -28,7 +76,7 @@ func (r *Repository) GetActiveSelectedPairs(ctx context.Context) ([]models.Selec
 	query := `
         SELECT id, symbol, selection_score, volatility_24h, volume_24h_usdt,
                atr_score, volume_score, correlation_score, risk_level,
-               status, selected_at, last_evaluated
+               status, trading_enabled, selected_at, last_evaluated
         FROM selected_pairs
         WHERE status = 'active'
         ORDER BY selection_score DESC
@@ -47,7 +95,7 @@ func (r *Repository) GetActiveSelectedPairs(ctx context.Context) ([]models.Selec
 			&pair.ID, &pair.Symbol, &pair.SelectionScore, &pair.Volatility24h,
 			&pair.Volume24hUSDT, &pair.ATRScore, &pair.VolumeScore,
 			&pair.CorrelationScore, &pair.RiskLevel, &pair.Status,
-			&pair.SelectedAt, &pair.LastEvaluated,
+			&pair.TradingEnabled, &pair.SelectedAt, &pair.LastEvaluated,
 		)
 		if err != nil {
 			r.logger.WithError(err).Error("Failed to scan selected pair")
@@ -59,11 +107,38 @@ func (r *Repository) GetActiveSelectedPairs(ctx context.Context) ([]models.Selec
 	return pairs, nil
 }
 
+// SetPairTradingEnabled toggles whether the engine may open positions on a
+// selected pair. The pair stays selected so collection and analysis continue.
+func (r *Repository) SetPairTradingEnabled(ctx context.Context, symbol string, enabled bool) error {
+	query := `UPDATE selected_pairs SET trading_enabled = $2 WHERE symbol = $1`
+
+	result, err := r.db.ExecContext(ctx, query, symbol, enabled)
+	if err != nil {
+		return fmt.Errorf("failed to update trading flag for %s: %w", symbol, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update trading flag for %s: %w", symbol, err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	r.logger.WithFields(logrus.Fields{
+		"symbol":          symbol,
+		"trading_enabled": enabled,
+	}).Info("Updated pair trading flag")
+
+	return nil
+}
+
 func (r *Repository) GetTradingConfig(ctx context.Context, pairID int64) (*models.TradingConfig, error) {
 	query := `
         SELECT id, pair_id, strategy_type, grid_levels, price_range_min, price_range_max,
                position_size_usdt, stop_loss_percent, take_profit_percent, max_positions,
-               is_active, created_at, updated_at
+               is_active, created_at, updated_at, sizing_mode, position_size_base, position_size_percent,
+               confirm_exits, trailing_stop_percent
         FROM trading_configs
         WHERE pair_id = $1 AND is_active = true
         LIMIT 1
@@ -75,6 +150,8 @@ func (r *Repository) GetTradingConfig(ctx context.Context, pairID int64) (*model
 		&config.PriceRangeMin, &config.PriceRangeMax, &config.PositionSizeUSDT,
 		&config.StopLossPercent, &config.TakeProfitPercent, &config.MaxPositions,
 		&config.IsActive, &config.CreatedAt, &config.UpdatedAt,
+		&config.SizingMode, &config.PositionSizeBase, &config.PositionSizePercent,
+		&config.ConfirmExits, &config.TrailingStopPercent,
 	)
 
 	if err != nil {
@@ -87,7 +164,10 @@ func (r *Repository) GetTradingConfig(ctx context.Context, pairID int64) (*model
 	return &config, nil
 }
 
-func (r *Repository) CreateTradingConfig(ctx context.Context, config models.TradingConfig) error {
+// CreateTradingConfig inserts the config unless the pair already has an
+// active one, then returns whichever config is active. Concurrent callers for
+// the same pair therefore all end up with the same config.
+func (r *Repository) CreateTradingConfig(ctx context.Context, config models.TradingConfig) (*models.TradingConfig, error) {
 	config.ID = uuid.New().String()
 	config.CreatedAt = time.Now()
 	config.UpdatedAt = time.Now()
@@ -96,40 +176,148 @@ func (r *Repository) CreateTradingConfig(ctx context.Context, config models.Trad
         INSERT INTO trading_configs 
         (id, pair_id, strategy_type, grid_levels, price_range_min, price_range_max,
          position_size_usdt, stop_loss_percent, take_profit_percent, max_positions,
-         is_active, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+         is_active, created_at, updated_at, sizing_mode, position_size_base, position_size_percent,
+         confirm_exits, trailing_stop_percent)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+        ON CONFLICT (pair_id) WHERE is_active = true DO NOTHING
     `
 
-	_, err := r.db.ExecContext(ctx, query,
+	result, err := r.db.ExecContext(ctx, query,
 		config.ID, config.PairID, config.StrategyType, config.GridLevels,
 		config.PriceRangeMin, config.PriceRangeMax, config.PositionSizeUSDT,
 		config.StopLossPercent, config.TakeProfitPercent, config.MaxPositions,
 		config.IsActive, config.CreatedAt, config.UpdatedAt,
+		config.SizingMode, config.PositionSizeBase, config.PositionSizePercent,
+		config.ConfirmExits, config.TrailingStopPercent,
 	)
 
 	if err != nil {
-		return fmt.Errorf("failed to create trading config: %w", err)
+		return nil, fmt.Errorf("failed to create trading config: %w", err)
 	}
 
-	r.logger.WithFields(logrus.Fields{
-		"config_id": config.ID,
-		"pair_id":   config.PairID,
-		"strategy":  config.StrategyType,
-	}).Info("Created new trading config")
+	if inserted, err := result.RowsAffected(); err == nil && inserted > 0 {
+		r.logger.WithFields(logrus.Fields{
+			"config_id": config.ID,
+			"pair_id":   config.PairID,
+			"strategy":  config.StrategyType,
+		}).Info("Created new trading config")
+	} else {
+		r.logger.WithField("pair_id", config.PairID).Debug("Trading config already exists, using existing")
+	}
+
+	active, err := r.GetTradingConfig(ctx, config.PairID)
+	if err != nil {
+		return nil, err
+	}
+	if active == nil {
+		return nil, fmt.Errorf("no active trading config for pair %d after create", config.PairID)
+	}
+
+	return active, nil
+}
+
+// UpdateTradingConfig stores the editable settings of an existing trading
+// config. The engine reads configs every cycle, so the change takes effect
+// on the pair's next cycle.
+func (r *Repository) UpdateTradingConfig(ctx context.Context, config models.TradingConfig) error {
+	query := `
+        UPDATE trading_configs
+        SET stop_loss_percent = $2, take_profit_percent = $3, grid_levels = $4,
+            price_range_min = $5, price_range_max = $6, max_positions = $7,
+            position_size_usdt = $8, trailing_stop_percent = $9, updated_at = NOW()
+        WHERE id = $1
+    `
+
+	result, err := r.db.ExecContext(ctx, query, config.ID,
+		config.StopLossPercent, config.TakeProfitPercent, config.GridLevels,
+		config.PriceRangeMin, config.PriceRangeMax, config.MaxPositions,
+		config.PositionSizeUSDT, config.TrailingStopPercent,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update trading config: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update trading config: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateTradingConfigRange stores the price range a grid is built over
+func (r *Repository) UpdateTradingConfigRange(ctx context.Context, configID string, rangeMin, rangeMax float64) error {
+	query := `
+        UPDATE trading_configs
+        SET price_range_min = $2, price_range_max = $3, updated_at = NOW()
+        WHERE id = $1
+    `
+
+	if _, err := r.db.ExecContext(ctx, query, configID, rangeMin, rangeMax); err != nil {
+		return fmt.Errorf("failed to update trading config range: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) CreateGridRecenterEvent(ctx context.Context, event models.GridRecenterEvent) error {
+	event.ID = uuid.New().String()
+	event.CreatedAt = time.Now()
+
+	query := `
+        INSERT INTO grid_recenter_events
+        (id, pair_id, config_id, price, old_range_min, old_range_max, new_range_min, new_range_max,
+         cancelled_orders, buy_levels, funded_buy_levels, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+    `
+
+	_, err := r.db.ExecContext(ctx, query,
+		event.ID, event.PairID, event.ConfigID, event.Price,
+		event.OldRangeMin, event.OldRangeMax, event.NewRangeMin, event.NewRangeMax,
+		event.CancelledOrders, event.BuyLevels, event.FundedBuyLevels, event.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create grid recenter event: %w", err)
+	}
 
 	return nil
 }
 
+const positionColumns = `id, account_id, pair_id, config_id, side, quantity, entry_price, current_price,
+               unrealized_pnl, realized_pnl, total_fees, status, order_id, strategy_tag, config_version,
+               COALESCE(high_water_mark, 0), COALESCE(trailing_stop_price, 0), take_profit_levels_hit, closed_fraction,
+               max_favorable_excursion, max_adverse_excursion,
+               created_at, updated_at, closed_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPosition(row rowScanner) (models.Position, error) {
+	var pos models.Position
+	err := row.Scan(
+		&pos.ID, &pos.AccountID, &pos.PairID, &pos.ConfigID, &pos.Side, &pos.Quantity,
+		&pos.EntryPrice, &pos.CurrentPrice, &pos.UnrealizedPnL, &pos.RealizedPnL, &pos.TotalFees,
+		&pos.Status, &pos.OrderID, &pos.StrategyTag, &pos.ConfigVersion,
+		&pos.HighWaterMark, &pos.TrailingStopPrice, &pos.TakeProfitLevelsHit, &pos.ClosedFraction,
+		&pos.MaxFavorableExcursion, &pos.MaxAdverseExcursion,
+		&pos.CreatedAt, &pos.UpdatedAt, &pos.ClosedAt,
+	)
+	return pos, err
+}
+
 func (r *Repository) GetOpenPositions(ctx context.Context, pairID int64) ([]models.Position, error) {
 	query := `
-        SELECT id, pair_id, config_id, side, quantity, entry_price, current_price,
-               unrealized_pnl, realized_pnl, status, order_id, created_at, updated_at, closed_at
+        SELECT ` + positionColumns + `
         FROM positions
-        WHERE pair_id = $1 AND status IN ('open', 'partial')
+        WHERE pair_id = $1 AND status IN ('open', 'partial') AND ($2 = '' OR account_id = $2)
         ORDER BY created_at DESC
     `
 
-	rows, err := r.db.QueryContext(ctx, query, pairID)
+	rows, err := r.db.QueryContext(ctx, query, pairID, r.account)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query open positions: %w", err)
 	}
@@ -137,12 +325,122 @@ func (r *Repository) GetOpenPositions(ctx context.Context, pairID int64) ([]mode
 
 	var positions []models.Position
 	for rows.Next() {
-		var pos models.Position
-		err := rows.Scan(
-			&pos.ID, &pos.PairID, &pos.ConfigID, &pos.Side, &pos.Quantity,
-			&pos.EntryPrice, &pos.CurrentPrice, &pos.UnrealizedPnL, &pos.RealizedPnL,
-			&pos.Status, &pos.OrderID, &pos.CreatedAt, &pos.UpdatedAt, &pos.ClosedAt,
-		)
+		pos, err := scanPosition(rows)
+		if err != nil {
+			r.logger.WithError(err).Error("Failed to scan position")
+			continue
+		}
+		positions = append(positions, pos)
+	}
+
+	return positions, nil
+}
+
+// GetAllOpenPositions returns the open positions across every pair, for
+// exposure reporting
+func (r *Repository) GetAllOpenPositions(ctx context.Context) ([]models.Position, error) {
+	query := `
+        SELECT ` + positionColumns + `
+        FROM positions
+        WHERE status IN ('open', 'partial') AND ($1 = '' OR account_id = $1)
+        ORDER BY created_at DESC
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, r.account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query open positions: %w", err)
+	}
+	defer rows.Close()
+
+	var positions []models.Position
+	for rows.Next() {
+		pos, err := scanPosition(rows)
+		if err != nil {
+			r.logger.WithError(err).Error("Failed to scan position")
+			continue
+		}
+		positions = append(positions, pos)
+	}
+
+	return positions, nil
+}
+
+// GetOpenPositionsWithInvalidSide returns open positions whose side is
+// neither buy nor sell
+func (r *Repository) GetOpenPositionsWithInvalidSide(ctx context.Context) ([]models.Position, error) {
+	query := `
+        SELECT ` + positionColumns + `
+        FROM positions
+        WHERE status IN ('open', 'partial') AND side NOT IN ('buy', 'sell') AND ($1 = '' OR account_id = $1)
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, r.account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query positions with invalid side: %w", err)
+	}
+	defer rows.Close()
+
+	var positions []models.Position
+	for rows.Next() {
+		pos, err := scanPosition(rows)
+		if err != nil {
+			r.logger.WithError(err).Error("Failed to scan position")
+			continue
+		}
+		positions = append(positions, pos)
+	}
+
+	return positions, nil
+}
+
+// GetClosedPositions returns positions closed since the given time, oldest
+// first, for trade export and performance attribution
+func (r *Repository) GetClosedPositions(ctx context.Context, since time.Time) ([]models.Position, error) {
+	query := `
+        SELECT ` + positionColumns + `
+        FROM positions
+        WHERE status = 'closed' AND closed_at >= $1 AND ($2 = '' OR account_id = $2)
+        ORDER BY closed_at ASC
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, since, r.account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query closed positions: %w", err)
+	}
+	defer rows.Close()
+
+	var positions []models.Position
+	for rows.Next() {
+		pos, err := scanPosition(rows)
+		if err != nil {
+			r.logger.WithError(err).Error("Failed to scan position")
+			continue
+		}
+		positions = append(positions, pos)
+	}
+
+	return positions, nil
+}
+
+// GetRecentClosedPositions returns the most recently closed positions, newest first
+func (r *Repository) GetRecentClosedPositions(ctx context.Context, limit int) ([]models.Position, error) {
+	query := `
+        SELECT ` + positionColumns + `
+        FROM positions
+        WHERE status = 'closed' AND closed_at IS NOT NULL AND ($2 = '' OR account_id = $2)
+        ORDER BY closed_at DESC
+        LIMIT $1
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, limit, r.account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recent closed positions: %w", err)
+	}
+	defer rows.Close()
+
+	var positions []models.Position
+	for rows.Next() {
+		pos, err := scanPosition(rows)
 		if err != nil {
 			r.logger.WithError(err).Error("Failed to scan position")
 			continue
@@ -153,23 +451,45 @@ func (r *Repository) GetOpenPositions(ctx context.Context, pairID int64) ([]mode
 	return positions, nil
 }
 
-func (r *Repository) CreatePosition(ctx context.Context, position models.Position) error {
+// GetStrategyTrackRecord returns the number of closed positions opened under
+// the strategy tag and their net realized PnL
+func (r *Repository) GetStrategyTrackRecord(ctx context.Context, strategyTag string) (int, float64, error) {
+	query := `
+        SELECT COUNT(*), COALESCE(SUM(realized_pnl), 0)
+        FROM positions
+        WHERE status = 'closed' AND strategy_tag = $1 AND ($2 = '' OR account_id = $2)
+    `
+
+	var trades int
+	var pnl float64
+	if err := r.db.QueryRowContext(ctx, query, strategyTag, r.account).Scan(&trades, &pnl); err != nil {
+		return 0, 0, fmt.Errorf("failed to get track record of strategy %s: %w", strategyTag, err)
+	}
+
+	return trades, pnl, nil
+}
+
+// CreatePosition inserts the position and sets its generated ID and timestamps
+func (r *Repository) CreatePosition(ctx context.Context, position *models.Position) error {
 	position.ID = uuid.New().String()
+	position.AccountID = r.Account()
 	position.CreatedAt = time.Now()
 	position.UpdatedAt = time.Now()
 
 	query := `
         INSERT INTO positions
         (id, pair_id, config_id, side, quantity, entry_price, current_price,
-         unrealized_pnl, realized_pnl, status, order_id, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+         unrealized_pnl, realized_pnl, status, order_id, strategy_tag, config_version,
+         created_at, updated_at, account_id, total_fees)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
     `
 
 	_, err := r.db.ExecContext(ctx, query,
 		position.ID, position.PairID, position.ConfigID, position.Side,
 		position.Quantity, position.EntryPrice, position.CurrentPrice,
 		position.UnrealizedPnL, position.RealizedPnL, position.Status,
-		position.OrderID, position.CreatedAt, position.UpdatedAt,
+		position.OrderID, position.StrategyTag, position.ConfigVersion,
+		position.CreatedAt, position.UpdatedAt, position.AccountID, position.TotalFees,
 	)
 
 	if err != nil {
@@ -182,24 +502,49 @@ func (r *Repository) CreatePosition(ctx context.Context, position models.Positio
 		"side":        position.Side,
 		"quantity":    position.Quantity,
 		"entry_price": position.EntryPrice,
+		"strategy":    position.StrategyTag,
 	}).Info("Created new position")
 
 	return nil
 }
 
+func (r *Repository) GetPositionByID(ctx context.Context, id string) (*models.Position, error) {
+	query := `
+        SELECT ` + positionColumns + `
+        FROM positions
+        WHERE id = $1
+    `
+
+	pos, err := scanPosition(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get position: %w", err)
+	}
+
+	return &pos, nil
+}
+
 func (r *Repository) UpdatePosition(ctx context.Context, position models.Position) error {
 	position.UpdatedAt = time.Now()
 
 	query := `
         UPDATE positions
         SET current_price = $2, unrealized_pnl = $3, realized_pnl = $4,
-            status = $5, updated_at = $6, closed_at = $7
+            status = $5, updated_at = $6, closed_at = $7, quantity = $8,
+            high_water_mark = NULLIF($9, 0), take_profit_levels_hit = $10, closed_fraction = $11,
+            entry_price = $12, max_favorable_excursion = $13, max_adverse_excursion = $14,
+            trailing_stop_price = NULLIF($15, 0), total_fees = $16
         WHERE id = $1
     `
 
 	_, err := r.db.ExecContext(ctx, query,
 		position.ID, position.CurrentPrice, position.UnrealizedPnL,
 		position.RealizedPnL, position.Status, position.UpdatedAt, position.ClosedAt,
+		position.Quantity, position.HighWaterMark, position.TakeProfitLevelsHit, position.ClosedFraction,
+		position.EntryPrice, position.MaxFavorableExcursion, position.MaxAdverseExcursion,
+		position.TrailingStopPrice, position.TotalFees,
 	)
 
 	if err != nil {
@@ -217,15 +562,20 @@ func (r *Repository) CreateOrder(ctx context.Context, order models.Order) error
 	query := `
         INSERT INTO orders
         (id, position_id, pair_id, kucoin_order_id, side, type, quantity, price,
-         filled_quantity, status, fee, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+         filled_quantity, status, fee, strategy_tag, config_version, created_at, updated_at, client_oid, account_id,
+         grid_unsettled, grid_position_id)
+        VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NULLIF($16, ''), $17, $18, $19)
     `
 
+	// A missing exchange ID is stored as NULL so the unique index does not
+	// reject a second such order
 	_, err := r.db.ExecContext(ctx, query,
 		order.ID, order.PositionID, order.PairID, order.KuCoinOrderID,
 		order.Side, order.Type, order.Quantity, order.Price,
 		order.FilledQuantity, order.Status, order.Fee,
-		order.CreatedAt, order.UpdatedAt,
+		order.StrategyTag, order.ConfigVersion,
+		order.CreatedAt, order.UpdatedAt, order.ClientOid, r.Account(),
+		order.GridUnsettled, order.GridPositionID,
 	)
 
 	if err != nil {
@@ -235,6 +585,7 @@ func (r *Repository) CreateOrder(ctx context.Context, order models.Order) error
 	r.logger.WithFields(logrus.Fields{
 		"order_id":        order.ID,
 		"kucoin_order_id": order.KuCoinOrderID,
+		"client_oid":      order.ClientOid,
 		"pair_id":         order.PairID,
 		"side":            order.Side,
 		"quantity":        order.Quantity,
@@ -244,23 +595,871 @@ func (r *Repository) CreateOrder(ctx context.Context, order models.Order) error
 	return nil
 }
 
-func (r *Repository) GetLatestPrice(ctx context.Context, symbol string) (float64, error) {
+// GetPendingOrders returns exchange orders whose fills have not been
+// reconciled yet
+func (r *Repository) GetPendingOrders(ctx context.Context) ([]models.Order, error) {
 	query := `
-        SELECT close
-        FROM price_data
-        WHERE symbol = $1
-        ORDER BY timestamp DESC
-        LIMIT 1
+        SELECT id, position_id, pair_id, kucoin_order_id, side, type, quantity,
+               COALESCE(price, 0), COALESCE(filled_quantity, 0), status, COALESCE(fee, 0),
+               strategy_tag, config_version, created_at, updated_at, filled_at
+        FROM orders
+        WHERE status = 'pending' AND kucoin_order_id IS NOT NULL AND kucoin_order_id <> ''
+          AND ($1 = '' OR account_id = $1)
+        ORDER BY created_at ASC
     `
 
-	var price float64
-	err := r.db.QueryRowContext(ctx, query, symbol).Scan(&price)
+	rows, err := r.db.QueryContext(ctx, query, r.account)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return 0, fmt.Errorf("no price data found for symbol %s", symbol)
+		return nil, fmt.Errorf("failed to query pending orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		var order models.Order
+		err := rows.Scan(
+			&order.ID, &order.PositionID, &order.PairID, &order.KuCoinOrderID,
+			&order.Side, &order.Type, &order.Quantity,
+			&order.Price, &order.FilledQuantity, &order.Status, &order.Fee,
+			&order.StrategyTag, &order.ConfigVersion, &order.CreatedAt, &order.UpdatedAt, &order.FilledAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
 		}
-		return 0, fmt.Errorf("failed to get latest price: %w", err)
+		orders = append(orders, order)
 	}
 
-	return price, nil
+	return orders, rows.Err()
+}
+
+// GetPendingEntryOrders returns the pair's unfilled limit orders that belong
+// to a position. Exit orders are among them; callers tell them apart by
+// comparing the order's side with its position's.
+func (r *Repository) GetPendingEntryOrders(ctx context.Context, pairID int64) ([]models.Order, error) {
+	query := `
+        SELECT id, position_id, kucoin_order_id, side, quantity, COALESCE(price, 0),
+               COALESCE(filled_quantity, 0), created_at
+        FROM orders
+        WHERE pair_id = $1 AND status = 'pending' AND type = 'limit' AND position_id IS NOT NULL
+          AND kucoin_order_id IS NOT NULL AND kucoin_order_id <> ''
+          AND ($2 = '' OR account_id = $2)
+        ORDER BY created_at ASC
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, pairID, r.account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending entry orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		order := models.Order{PairID: pairID, Type: "limit", Status: "pending"}
+		err := rows.Scan(
+			&order.ID, &order.PositionID, &order.KuCoinOrderID, &order.Side, &order.Quantity,
+			&order.Price, &order.FilledQuantity, &order.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+// GetStrandedOrders returns pending orders created before the cutoff that
+// never had their exchange order ID recorded
+func (r *Repository) GetStrandedOrders(ctx context.Context, createdBefore time.Time) ([]models.Order, error) {
+	query := `
+        SELECT id, position_id, pair_id, COALESCE(client_oid, ''), side, type, quantity,
+               COALESCE(price, 0), status, strategy_tag, config_version, created_at, updated_at
+        FROM orders
+        WHERE status = 'pending' AND (kucoin_order_id IS NULL OR kucoin_order_id = '') AND created_at < $1
+          AND ($2 = '' OR account_id = $2)
+        ORDER BY created_at ASC
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, createdBefore, r.account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stranded orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		var order models.Order
+		err := rows.Scan(
+			&order.ID, &order.PositionID, &order.PairID, &order.ClientOid,
+			&order.Side, &order.Type, &order.Quantity, &order.Price, &order.Status,
+			&order.StrategyTag, &order.ConfigVersion, &order.CreatedAt, &order.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+// SetOrderExchangeID records the exchange order ID of an order found by its
+// client order ID
+func (r *Repository) SetOrderExchangeID(ctx context.Context, orderID, kucoinOrderID string) error {
+	query := `UPDATE orders SET kucoin_order_id = $2, updated_at = NOW() WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, orderID, kucoinOrderID); err != nil {
+		return fmt.Errorf("failed to set exchange id of order %s: %w", orderID, err)
+	}
+
+	return nil
+}
+
+// GetFilledOrders returns orders with fills settled since the given time
+func (r *Repository) GetFilledOrders(ctx context.Context, since time.Time) ([]models.Order, error) {
+	query := `
+        SELECT id, position_id, pair_id, COALESCE(kucoin_order_id, ''), side, type, quantity,
+               COALESCE(price, 0), COALESCE(filled_quantity, 0), status, COALESCE(fee, 0),
+               strategy_tag, config_version, created_at, updated_at, filled_at
+        FROM orders
+        WHERE status = 'filled' AND filled_at >= $1 AND ($2 = '' OR account_id = $2)
+        ORDER BY filled_at ASC
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, since, r.account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query filled orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		var order models.Order
+		err := rows.Scan(
+			&order.ID, &order.PositionID, &order.PairID, &order.KuCoinOrderID,
+			&order.Side, &order.Type, &order.Quantity,
+			&order.Price, &order.FilledQuantity, &order.Status, &order.Fee,
+			&order.StrategyTag, &order.ConfigVersion, &order.CreatedAt, &order.UpdatedAt, &order.FilledAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+// CountOpenLimitOrders returns how many of the pair's limit orders are still
+// pending, i.e. potentially resting on the exchange's book
+func (r *Repository) CountOpenLimitOrders(ctx context.Context, pairID int64) (int, error) {
+	query := `
+        SELECT COUNT(*)
+        FROM orders
+        WHERE pair_id = $1 AND status = 'pending' AND type = 'limit'
+          AND ($2 = '' OR account_id = $2)
+    `
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, pairID, r.account).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count open orders: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetRestingGridOrders returns the pair's unfilled limit orders that are not
+// tied to a position, i.e. orders resting on the grid
+func (r *Repository) GetRestingGridOrders(ctx context.Context, pairID int64) ([]models.Order, error) {
+	query := `
+        SELECT id, COALESCE(kucoin_order_id, ''), side, quantity, COALESCE(price, 0), grid_position_id
+        FROM orders
+        WHERE pair_id = $1 AND status = 'pending' AND type = 'limit' AND position_id IS NULL
+          AND ($2 = '' OR account_id = $2)
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, pairID, r.account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query grid orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		order := models.Order{PairID: pairID, Type: "limit", Status: "pending"}
+		if err := rows.Scan(&order.ID, &order.KuCoinOrderID, &order.Side, &order.Quantity, &order.Price, &order.GridPositionID); err != nil {
+			return nil, fmt.Errorf("failed to scan grid order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+// GetUnsettledGridFills returns the pair's filled grid orders whose fills
+// have not been applied to a position yet, oldest fill first
+func (r *Repository) GetUnsettledGridFills(ctx context.Context, pairID int64) ([]models.Order, error) {
+	query := `
+        SELECT id, COALESCE(kucoin_order_id, ''), side, quantity, COALESCE(price, 0),
+               COALESCE(filled_quantity, 0), COALESCE(fee, 0), strategy_tag, config_version, grid_position_id
+        FROM orders
+        WHERE pair_id = $1 AND status = 'filled' AND grid_unsettled
+          AND ($2 = '' OR account_id = $2)
+        ORDER BY filled_at ASC
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, pairID, r.account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query grid fills: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		order := models.Order{PairID: pairID, Type: "limit", Status: "filled", GridUnsettled: true}
+		err := rows.Scan(
+			&order.ID, &order.KuCoinOrderID, &order.Side, &order.Quantity, &order.Price,
+			&order.FilledQuantity, &order.Fee, &order.StrategyTag, &order.ConfigVersion, &order.GridPositionID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan grid fill: %w", err)
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+// SettleGridOrder marks a grid order's fill as applied and links the order to
+// the position it opened or closed
+func (r *Repository) SettleGridOrder(ctx context.Context, orderID, positionID string) error {
+	query := `
+        UPDATE orders
+        SET grid_unsettled = false, position_id = NULLIF($2, '')::uuid, updated_at = NOW()
+        WHERE id = $1
+    `
+
+	if _, err := r.db.ExecContext(ctx, query, orderID, positionID); err != nil {
+		return fmt.Errorf("failed to settle grid order: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) UpdateOrderStatus(ctx context.Context, orderID, status string) error {
+	query := `UPDATE orders SET status = $2, updated_at = NOW() WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, orderID, status); err != nil {
+		return fmt.Errorf("failed to update order status: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateOrderFill records the executed quantity, average price, fees and
+// final status of an order
+func (r *Repository) UpdateOrderFill(ctx context.Context, order models.Order) error {
+	query := `
+        UPDATE orders
+        SET filled_quantity = $2, price = $3, fee = $4, status = $5,
+            filled_at = $6, updated_at = NOW()
+        WHERE id = $1
+    `
+
+	_, err := r.db.ExecContext(ctx, query,
+		order.ID, order.FilledQuantity, order.Price, order.Fee, order.Status, order.FilledAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update order fill: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) CreateBracketOrder(ctx context.Context, bracket models.BracketOrder) error {
+	bracket.ID = uuid.New().String()
+	bracket.CreatedAt = time.Now()
+	bracket.UpdatedAt = time.Now()
+
+	query := `
+        INSERT INTO bracket_orders
+        (id, position_id, pair_id, symbol, entry_order_id, oco_order_id, side, quantity,
+         stop_price, stop_limit_price, take_profit_price, status, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, $10, $11, $12, $13, $14)
+    `
+
+	_, err := r.db.ExecContext(ctx, query,
+		bracket.ID, bracket.PositionID, bracket.PairID, bracket.Symbol,
+		bracket.EntryOrderID, bracket.OCOOrderID, bracket.Side, bracket.Quantity,
+		bracket.StopPrice, bracket.StopLimitPrice, bracket.TakeProfitPrice,
+		bracket.Status, bracket.CreatedAt, bracket.UpdatedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to create bracket order: %w", err)
+	}
+
+	return nil
+}
+
+// GetOpenBracketOrders returns brackets still waiting for their entry to fill
+// or protecting a position on the exchange
+func (r *Repository) GetOpenBracketOrders(ctx context.Context) ([]models.BracketOrder, error) {
+	query := `
+        SELECT id, position_id, pair_id, symbol, entry_order_id, COALESCE(oco_order_id, ''),
+               side, quantity, stop_price, stop_limit_price, take_profit_price, status,
+               created_at, updated_at, closed_at
+        FROM bracket_orders
+        WHERE status IN ('pending', 'active')
+          AND ($1 = '' OR position_id IN (SELECT id FROM positions WHERE account_id = $1))
+        ORDER BY created_at ASC
+    `
+
+	return r.queryBracketOrders(ctx, query, r.account)
+}
+
+func (r *Repository) GetOpenBracketOrderByPosition(ctx context.Context, positionID string) (*models.BracketOrder, error) {
+	query := `
+        SELECT id, position_id, pair_id, symbol, entry_order_id, COALESCE(oco_order_id, ''),
+               side, quantity, stop_price, stop_limit_price, take_profit_price, status,
+               created_at, updated_at, closed_at
+        FROM bracket_orders
+        WHERE position_id = $1 AND status IN ('pending', 'active')
+    `
+
+	brackets, err := r.queryBracketOrders(ctx, query, positionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(brackets) == 0 {
+		return nil, nil
+	}
+
+	return &brackets[0], nil
+}
+
+func (r *Repository) queryBracketOrders(ctx context.Context, query string, args ...interface{}) ([]models.BracketOrder, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bracket orders: %w", err)
+	}
+	defer rows.Close()
+
+	var brackets []models.BracketOrder
+	for rows.Next() {
+		var bracket models.BracketOrder
+		err := rows.Scan(
+			&bracket.ID, &bracket.PositionID, &bracket.PairID, &bracket.Symbol,
+			&bracket.EntryOrderID, &bracket.OCOOrderID, &bracket.Side, &bracket.Quantity,
+			&bracket.StopPrice, &bracket.StopLimitPrice, &bracket.TakeProfitPrice, &bracket.Status,
+			&bracket.CreatedAt, &bracket.UpdatedAt, &bracket.ClosedAt,
+		)
+		if err != nil {
+			r.logger.WithError(err).Error("Failed to scan bracket order")
+			continue
+		}
+		brackets = append(brackets, bracket)
+	}
+
+	return brackets, nil
+}
+
+func (r *Repository) UpdateBracketOrder(ctx context.Context, bracket models.BracketOrder) error {
+	bracket.UpdatedAt = time.Now()
+
+	query := `
+        UPDATE bracket_orders
+        SET oco_order_id = NULLIF($2, ''), quantity = $3, status = $4,
+            updated_at = $5, closed_at = $6
+        WHERE id = $1
+    `
+
+	_, err := r.db.ExecContext(ctx, query,
+		bracket.ID, bracket.OCOOrderID, bracket.Quantity, bracket.Status,
+		bracket.UpdatedAt, bracket.ClosedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to update bracket order: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) CreateFailedOrder(ctx context.Context, order models.FailedOrder) error {
+	order.ID = uuid.New().String()
+	order.CreatedAt = time.Now()
+
+	query := `
+        INSERT INTO failed_orders
+        (id, symbol, client_oid, side, type, quantity, price, error_code, error_message, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+    `
+
+	_, err := r.db.ExecContext(ctx, query,
+		order.ID, order.Symbol, order.ClientOid, order.Side, order.Type,
+		order.Quantity, order.Price, order.ErrorCode, order.ErrorMessage, order.CreatedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to record failed order: %w", err)
+	}
+
+	return nil
+}
+
+// GetFailedOrders returns the most recent failed order attempts since the
+// given time, newest first
+func (r *Repository) GetFailedOrders(ctx context.Context, since time.Time, limit int) ([]models.FailedOrder, error) {
+	query := `
+        SELECT id, symbol, client_oid, side, type, quantity, COALESCE(price, 0),
+               error_code, error_message, created_at
+        FROM failed_orders
+        WHERE created_at >= $1
+        ORDER BY created_at DESC
+        LIMIT $2
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query failed orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []models.FailedOrder
+	for rows.Next() {
+		var order models.FailedOrder
+		err := rows.Scan(
+			&order.ID, &order.Symbol, &order.ClientOid, &order.Side, &order.Type,
+			&order.Quantity, &order.Price, &order.ErrorCode, &order.ErrorMessage, &order.CreatedAt,
+		)
+		if err != nil {
+			r.logger.WithError(err).Error("Failed to scan failed order")
+			continue
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+func (r *Repository) GetLatestPrice(ctx context.Context, symbol string) (float64, error) {
+	query := `
+        SELECT close
+        FROM price_data
+        WHERE symbol = $1
+        ORDER BY timestamp DESC
+        LIMIT 1
+    `
+
+	var price float64
+	err := r.db.QueryRowContext(ctx, query, symbol).Scan(&price)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("no price data found for symbol %s", symbol)
+		}
+		return 0, fmt.Errorf("failed to get latest price: %w", err)
+	}
+
+	return price, nil
+}
+
+// GetLatestQuote returns the newest close of the symbol with its timestamp,
+// letting callers judge how fresh the price is
+func (r *Repository) GetLatestQuote(ctx context.Context, symbol string) (float64, time.Time, error) {
+	query := `
+        SELECT close, timestamp
+        FROM price_data
+        WHERE symbol = $1
+        ORDER BY timestamp DESC
+        LIMIT 1
+    `
+
+	var price float64
+	var observedAt time.Time
+	err := r.db.QueryRowContext(ctx, query, symbol).Scan(&price, &observedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, time.Time{}, fmt.Errorf("no price data found for symbol %s", symbol)
+		}
+		return 0, time.Time{}, fmt.Errorf("failed to get latest quote: %w", err)
+	}
+
+	return price, observedAt, nil
+}
+
+func (r *Repository) GetPriceHistory(ctx context.Context, symbol string, since time.Time) ([]models.Candle, error) {
+	// The newest candles are kept when the window exceeds the cap, then
+	// returned oldest first
+	query := `
+        SELECT timestamp, open, high, low, close, volume
+        FROM (
+            SELECT timestamp, open, high, low, close, volume
+            FROM price_data
+            WHERE symbol = $1 AND timestamp >= $2
+            ORDER BY timestamp DESC
+            LIMIT $3
+        ) recent
+        ORDER BY timestamp ASC
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, symbol, since, r.candleLimit())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query price history for %s: %w", symbol, err)
+	}
+	defer rows.Close()
+
+	var candles []models.Candle
+	for rows.Next() {
+		var candle models.Candle
+		err := rows.Scan(&candle.Timestamp, &candle.Open, &candle.High, &candle.Low, &candle.Close, &candle.Volume)
+		if err != nil {
+			r.logger.WithError(err).WithField("symbol", symbol).Error("Failed to scan candle")
+			continue
+		}
+		candles = append(candles, candle)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating price history for %s: %w", symbol, err)
+	}
+
+	r.warnIfCapped(symbol, len(candles))
+
+	return candles, nil
+}
+
+// GetPriceHistoryBetween returns the minute candles of the symbol starting in
+// [since, until), oldest first and without the candle cap, for replays over a
+// fixed historical range
+func (r *Repository) GetPriceHistoryBetween(ctx context.Context, symbol string, since, until time.Time) ([]models.Candle, error) {
+	query := `
+        SELECT timestamp, open, high, low, close, volume
+        FROM price_data
+        WHERE symbol = $1 AND timestamp >= $2 AND timestamp < $3
+        ORDER BY timestamp ASC
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, symbol, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query price history for %s: %w", symbol, err)
+	}
+	defer rows.Close()
+
+	var candles []models.Candle
+	for rows.Next() {
+		var candle models.Candle
+		if err := rows.Scan(&candle.Timestamp, &candle.Open, &candle.High, &candle.Low, &candle.Close, &candle.Volume); err != nil {
+			return nil, fmt.Errorf("failed to scan candle: %w", err)
+		}
+		candles = append(candles, candle)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating price history for %s: %w", symbol, err)
+	}
+
+	return candles, nil
+}
+
+// GetOldestPriceTime returns the timestamp of the oldest minute candle of the
+// symbol; ok is false when there is none
+func (r *Repository) GetOldestPriceTime(ctx context.Context, symbol string) (time.Time, bool, error) {
+	var oldest sql.NullTime
+	err := r.db.QueryRowContext(ctx, `SELECT MIN(timestamp) FROM price_data WHERE symbol = $1`, symbol).Scan(&oldest)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to get oldest price for %s: %w", symbol, err)
+	}
+	return oldest.Time, oldest.Valid, nil
+}
+
+// GetHourlyPriceHistory returns the downsampled hourly candles of the symbol
+// starting in [since, until), oldest first
+func (r *Repository) GetHourlyPriceHistory(ctx context.Context, symbol string, since, until time.Time) ([]models.Candle, error) {
+	query := `
+        SELECT timestamp, open, high, low, close, volume
+        FROM price_data_hourly
+        WHERE symbol = $1 AND timestamp >= $2 AND timestamp < $3
+        ORDER BY timestamp ASC
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, symbol, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query hourly price history for %s: %w", symbol, err)
+	}
+	defer rows.Close()
+
+	var candles []models.Candle
+	for rows.Next() {
+		var candle models.Candle
+		if err := rows.Scan(&candle.Timestamp, &candle.Open, &candle.High, &candle.Low, &candle.Close, &candle.Volume); err != nil {
+			return nil, fmt.Errorf("failed to scan hourly candle: %w", err)
+		}
+		candles = append(candles, candle)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating hourly price history for %s: %w", symbol, err)
+	}
+
+	return candles, nil
+}
+
+// GetRecentRealizedPnL returns the net realized PnL of positions closed since the given time
+func (r *Repository) GetRecentRealizedPnL(ctx context.Context, since time.Time) (float64, error) {
+	query := `
+        SELECT COALESCE(SUM(realized_pnl), 0)
+        FROM positions
+        WHERE status = 'closed' AND closed_at >= $1 AND ($2 = '' OR account_id = $2)
+    `
+
+	var pnl float64
+	if err := r.db.QueryRowContext(ctx, query, since, r.account).Scan(&pnl); err != nil {
+		return 0, fmt.Errorf("failed to get recent realized pnl: %w", err)
+	}
+
+	return pnl, nil
+}
+
+// GetRecentRealizedLoss returns the gross realized loss, as a positive
+// amount, of losing positions closed since the given time. Winning closes in
+// the window do not offset it.
+func (r *Repository) GetRecentRealizedLoss(ctx context.Context, since time.Time) (float64, error) {
+	query := `
+        SELECT COALESCE(SUM(-realized_pnl), 0)
+        FROM positions
+        WHERE status = 'closed' AND closed_at >= $1 AND realized_pnl < 0 AND ($2 = '' OR account_id = $2)
+    `
+
+	var loss float64
+	if err := r.db.QueryRowContext(ctx, query, since, r.account).Scan(&loss); err != nil {
+		return 0, fmt.Errorf("failed to get recent realized loss: %w", err)
+	}
+
+	return loss, nil
+}
+
+// GetWSWatermarks returns the last processed sequence of every websocket topic
+func (r *Repository) GetWSWatermarks(ctx context.Context) (map[string]int64, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT topic, sequence FROM ws_watermarks`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query websocket watermarks: %w", err)
+	}
+	defer rows.Close()
+
+	watermarks := make(map[string]int64)
+	for rows.Next() {
+		var topic string
+		var sequence int64
+		if err := rows.Scan(&topic, &sequence); err != nil {
+			return nil, fmt.Errorf("failed to scan websocket watermark: %w", err)
+		}
+		watermarks[topic] = sequence
+	}
+
+	return watermarks, rows.Err()
+}
+
+// SaveWSWatermarks upserts the given topic watermarks. A stored sequence is
+// never moved backwards.
+func (r *Repository) SaveWSWatermarks(ctx context.Context, watermarks map[string]int64) error {
+	query := `
+        INSERT INTO ws_watermarks (topic, sequence, updated_at)
+        VALUES ($1, $2, NOW())
+        ON CONFLICT (topic) DO UPDATE
+        SET sequence = GREATEST(ws_watermarks.sequence, EXCLUDED.sequence), updated_at = NOW()
+    `
+
+	for topic, sequence := range watermarks {
+		if _, err := r.db.ExecContext(ctx, query, topic, sequence); err != nil {
+			return fmt.Errorf("failed to save websocket watermark for %s: %w", topic, err)
+		}
+	}
+
+	return nil
+}
+
+// UpsertBacktestBaseline stores the baseline, replacing any earlier one for
+// the same strategy tag and config version
+func (r *Repository) UpsertBacktestBaseline(ctx context.Context, baseline models.BacktestBaseline) error {
+	query := `
+        INSERT INTO backtest_baselines
+        (strategy_tag, config_version, win_rate, avg_pnl_per_trade, trades, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+        ON CONFLICT (strategy_tag, config_version) DO UPDATE
+        SET win_rate = EXCLUDED.win_rate, avg_pnl_per_trade = EXCLUDED.avg_pnl_per_trade,
+            trades = EXCLUDED.trades, updated_at = NOW()
+    `
+
+	_, err := r.db.ExecContext(ctx, query,
+		baseline.StrategyTag, baseline.ConfigVersion, baseline.WinRate, baseline.AvgPnLPerTrade, baseline.Trades,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store backtest baseline: %w", err)
+	}
+
+	return nil
+}
+
+// GetBacktestBaselines returns every stored baseline
+// SaveRiskHalt records a halt for the account. An existing halt of the same
+// scope and pair is only ever extended.
+func (r *Repository) SaveRiskHalt(ctx context.Context, halt models.RiskHalt) error {
+	query := `
+        INSERT INTO risk_halts (account_id, scope, pair_id, reason, halted_until, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+        ON CONFLICT (account_id, scope, pair_id) DO UPDATE
+        SET reason = CASE WHEN EXCLUDED.halted_until > risk_halts.halted_until
+                          THEN EXCLUDED.reason ELSE risk_halts.reason END,
+            halted_until = GREATEST(risk_halts.halted_until, EXCLUDED.halted_until),
+            updated_at = NOW()
+    `
+
+	_, err := r.db.ExecContext(ctx, query, r.Account(), halt.Scope, halt.PairID, halt.Reason, halt.HaltedUntil)
+	if err != nil {
+		return fmt.Errorf("failed to save risk halt: %w", err)
+	}
+	return nil
+}
+
+// GetActiveRiskHalts returns the account's halts that have not yet expired
+func (r *Repository) GetActiveRiskHalts(ctx context.Context) ([]models.RiskHalt, error) {
+	query := `
+        SELECT scope, pair_id, reason, halted_until
+        FROM risk_halts
+        WHERE account_id = $1 AND halted_until > $2
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, r.Account(), time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query risk halts: %w", err)
+	}
+	defer rows.Close()
+
+	var halts []models.RiskHalt
+	for rows.Next() {
+		var halt models.RiskHalt
+		if err := rows.Scan(&halt.Scope, &halt.PairID, &halt.Reason, &halt.HaltedUntil); err != nil {
+			return nil, fmt.Errorf("failed to scan risk halt: %w", err)
+		}
+		halts = append(halts, halt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating risk halts: %w", err)
+	}
+
+	return halts, nil
+}
+
+func (r *Repository) GetBacktestBaselines(ctx context.Context) ([]models.BacktestBaseline, error) {
+	query := `
+        SELECT strategy_tag, config_version, win_rate, avg_pnl_per_trade, trades, created_at, updated_at
+        FROM backtest_baselines
+        ORDER BY strategy_tag, config_version
+    `
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query backtest baselines: %w", err)
+	}
+	defer rows.Close()
+
+	var baselines []models.BacktestBaseline
+	for rows.Next() {
+		var baseline models.BacktestBaseline
+		err := rows.Scan(
+			&baseline.StrategyTag, &baseline.ConfigVersion, &baseline.WinRate, &baseline.AvgPnLPerTrade,
+			&baseline.Trades, &baseline.CreatedAt, &baseline.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan backtest baseline: %w", err)
+		}
+		baselines = append(baselines, baseline)
+	}
+
+	return baselines, rows.Err()
+}
+
+// GetLiveTradeStats returns the number of positions of a strategy
+// configuration closed since the given time, how many of them were
+// profitable, and their net realized PnL
+func (r *Repository) GetLiveTradeStats(ctx context.Context, strategyTag, configVersion string, since time.Time) (int, int, float64, error) {
+	query := `
+        SELECT COUNT(*), COUNT(*) FILTER (WHERE realized_pnl > 0), COALESCE(SUM(realized_pnl), 0)
+        FROM positions
+        WHERE status = 'closed' AND strategy_tag = $1 AND config_version = $2 AND closed_at >= $3
+          AND ($4 = '' OR account_id = $4)
+    `
+
+	var trades, wins int
+	var pnl float64
+	if err := r.db.QueryRowContext(ctx, query, strategyTag, configVersion, since, r.account).Scan(&trades, &wins, &pnl); err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to get live trade stats: %w", err)
+	}
+
+	return trades, wins, pnl, nil
+}
+
+// CreateTradeDecision stores the decision snapshot of an entry
+func (r *Repository) CreateTradeDecision(ctx context.Context, decision models.TradeDecision) error {
+	query := `
+        INSERT INTO trade_decisions (position_id, kucoin_order_id, symbol, context, created_at)
+        VALUES ($1, NULLIF($2, ''), $3, $4, NOW())
+    `
+
+	_, err := r.db.ExecContext(ctx, query,
+		decision.PositionID, decision.KuCoinOrderID, decision.Symbol, decision.Context,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create trade decision: %w", err)
+	}
+
+	return nil
+}
+
+// CreateWouldTrade records an order observe mode decided on without placing
+func (r *Repository) CreateWouldTrade(ctx context.Context, trade models.WouldTrade) error {
+	query := `
+        INSERT INTO would_trade
+        (account_id, pair_id, symbol, position_id, action, side, order_type, quantity, price,
+         reason, strategy_tag, context, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), NULLIF($11, ''), $12, NOW())
+    `
+
+	_, err := r.db.ExecContext(ctx, query,
+		r.Account(), trade.PairID, trade.Symbol, trade.PositionID, trade.Action, trade.Side, trade.OrderType,
+		trade.Quantity, trade.Price, trade.Reason, trade.StrategyTag, trade.Context,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create would-trade record: %w", err)
+	}
+
+	return nil
+}
+
+// GetTradeDecision returns the decision snapshot recorded for a position ID
+// or exchange order ID, or nil when there is none
+func (r *Repository) GetTradeDecision(ctx context.Context, id string) (*models.TradeDecision, error) {
+	query := `
+        SELECT id, position_id, COALESCE(kucoin_order_id, ''), symbol, context, created_at
+        FROM trade_decisions
+        WHERE position_id::text = $1 OR kucoin_order_id = $1
+        ORDER BY created_at DESC
+        LIMIT 1
+    `
+
+	var decision models.TradeDecision
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&decision.ID, &decision.PositionID, &decision.KuCoinOrderID,
+		&decision.Symbol, &decision.Context, &decision.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trade decision: %w", err)
+	}
+
+	return &decision, nil
 }
@@ -0,0 +1,281 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// minuteCandles answers a price history read from 100 stored minute candles,
+// honouring the LIMIT argument the way PostgreSQL runs the query: the newest
+// rows within the limit, returned oldest first
+func minuteCandles(start time.Time) func(string, []driver.Value) (fakeResult, error) {
+	return func(_ string, args []driver.Value) (fakeResult, error) {
+		stored := make([][]driver.Value, 100)
+		for i := range stored {
+			price := 100 + float64(i)
+			stored[i] = []driver.Value{start.Add(time.Duration(i) * time.Minute), price, price, price, price, 1.0}
+		}
+		if limit, ok := args[2].(int64); ok && int(limit) < len(stored) {
+			stored = stored[len(stored)-int(limit):]
+		}
+		return fakeResult{columns: []string{"timestamp", "open", "high", "low", "close", "volume"}, rows: stored}, nil
+	}
+}
+
+func TestPriceHistoryCap(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		maxCandles int
+		wantLimit  driver.Value
+		wantFirst  float64
+		wantCount  int
+		wantWarned bool
+	}{
+		{name: "cap hit keeps the newest candles", maxCandles: 30, wantLimit: int64(30), wantFirst: 170, wantCount: 30, wantWarned: true},
+		{name: "window within the cap", maxCandles: 500, wantLimit: int64(500), wantFirst: 100, wantCount: 100},
+		{name: "no cap", maxCandles: 0, wantLimit: nil, wantFirst: 100, wantCount: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, db := newFakeDB(minuteCandles(start))
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+			hook := test.NewLocal(logger)
+			repo := NewRepository(db, tt.maxCandles, logger)
+
+			candles, err := repo.GetPriceHistory(context.Background(), "BTC-USDT", start)
+			if err != nil {
+				t.Fatalf("GetPriceHistory() error = %v", err)
+			}
+
+			queries := fake.Queries()
+			if len(queries) != 1 || queries[0].args[2] != tt.wantLimit {
+				t.Fatalf("queries = %+v, want one read with LIMIT %v", queries, tt.wantLimit)
+			}
+			query := queries[0].query
+			newest := strings.Index(query, "ORDER BY timestamp DESC")
+			limit := strings.Index(query, "LIMIT $3")
+			oldest := strings.LastIndex(query, "ORDER BY timestamp ASC")
+			if newest < 0 || limit < newest || oldest < limit {
+				t.Errorf("query does not limit the newest rows and return them oldest first:\n%s", query)
+			}
+
+			if len(candles) != tt.wantCount || candles[0].Close != tt.wantFirst {
+				t.Fatalf("got %d candles from %v, want %d from %v", len(candles), candles[0].Close, tt.wantCount, tt.wantFirst)
+			}
+			for i := 1; i < len(candles); i++ {
+				if !candles[i].Timestamp.After(candles[i-1].Timestamp) {
+					t.Fatalf("candle %d at %v not after %v, want ascending order", i, candles[i].Timestamp, candles[i-1].Timestamp)
+				}
+			}
+
+			warned := false
+			for _, entry := range hook.AllEntries() {
+				warned = warned || entry.Level == logrus.WarnLevel
+			}
+			if warned != tt.wantWarned {
+				t.Errorf("warned = %v, want %v", warned, tt.wantWarned)
+			}
+		})
+	}
+}
+
+// decisionTable stores inserted trade decisions and answers lookups by
+// position or order ID the way the trade_decisions query does
+func decisionTable(createdAt time.Time) func(string, []driver.Value) (fakeResult, error) {
+	var stored [][]driver.Value
+	return func(query string, args []driver.Value) (fakeResult, error) {
+		if strings.Contains(query, "INSERT INTO trade_decisions") {
+			id := fmt.Sprintf("decision-%d", len(stored)+1)
+			stored = append(stored, []driver.Value{id, args[0], args[1], args[2], args[3], createdAt})
+			return fakeResult{}, nil
+		}
+
+		result := fakeResult{columns: []string{"id", "position_id", "kucoin_order_id", "symbol", "context", "created_at"}}
+		for _, row := range stored {
+			if row[1] == args[0] || row[2] == args[0] {
+				result.rows = append(result.rows, row)
+			}
+		}
+		return result, nil
+	}
+}
+
+func TestTradeDecisionRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	_, db := newFakeDB(decisionTable(createdAt))
+	repo := NewRepository(db, 0, utils.NewDiscardLogger())
+
+	snapshot := []byte(`{"symbol":"BTC-USDT","signal":{"action":"BUY","strength":0.7},"position_size":100}`)
+	err := repo.CreateTradeDecision(ctx, models.TradeDecision{
+		PositionID: "position-1", KuCoinOrderID: "kucoin-1", Symbol: "BTC-USDT", Context: snapshot,
+	})
+	if err != nil {
+		t.Fatalf("CreateTradeDecision() error = %v", err)
+	}
+
+	for _, id := range []string{"position-1", "kucoin-1"} {
+		decision, err := repo.GetTradeDecision(ctx, id)
+		if err != nil {
+			t.Fatalf("GetTradeDecision(%s) error = %v", id, err)
+		}
+		if decision == nil {
+			t.Fatalf("GetTradeDecision(%s) = nil, want the stored snapshot", id)
+		}
+		if decision.PositionID != "position-1" || decision.KuCoinOrderID != "kucoin-1" || string(decision.Context) != string(snapshot) {
+			t.Errorf("GetTradeDecision(%s) = %+v, want the stored snapshot", id, decision)
+		}
+		if !decision.CreatedAt.Equal(createdAt) {
+			t.Errorf("created at = %v, want %v", decision.CreatedAt, createdAt)
+		}
+	}
+
+	decision, err := repo.GetTradeDecision(ctx, "position-unknown")
+	if err != nil || decision != nil {
+		t.Errorf("GetTradeDecision(unknown) = %+v, %v; want nil, nil", decision, err)
+	}
+}
+
+// positionTable stores inserted positions and answers open position queries
+// filtered by the account argument the way the SQL does
+func positionTable() func(string, []driver.Value) (fakeResult, error) {
+	var stored [][]driver.Value
+	return func(query string, args []driver.Value) (fakeResult, error) {
+		if strings.Contains(query, "INSERT INTO positions") {
+			stored = append(stored, []driver.Value{
+				args[0], args[15], args[1], args[2], args[3], args[4], args[5], args[6],
+				args[7], args[8], args[16], args[9], args[10], args[11], args[12],
+				0.0, 0.0, int64(0), 0.0, 0.0, 0.0,
+				args[13], args[14], nil,
+			})
+			return fakeResult{}, nil
+		}
+
+		result := fakeResult{columns: []string{
+			"id", "account_id", "pair_id", "config_id", "side", "quantity", "entry_price", "current_price",
+			"unrealized_pnl", "realized_pnl", "total_fees", "status", "order_id", "strategy_tag", "config_version",
+			"high_water_mark", "trailing_stop_price", "take_profit_levels_hit", "closed_fraction",
+			"max_favorable_excursion", "max_adverse_excursion", "created_at", "updated_at", "closed_at",
+		}}
+		account := args[len(args)-1]
+		for _, row := range stored {
+			if account == "" || row[1] == account {
+				result.rows = append(result.rows, row)
+			}
+		}
+		return result, nil
+	}
+}
+
+func TestAccountScopedPositions(t *testing.T) {
+	ctx := context.Background()
+	fake, db := newFakeDB(positionTable())
+	shared := NewRepository(db, 0, utils.NewDiscardLogger())
+	alpha := shared.ForAccount("alpha")
+	beta := shared.ForAccount("beta")
+
+	for _, create := range []struct {
+		repo     *Repository
+		quantity float64
+	}{{alpha, 1}, {alpha, 2}, {beta, 5}} {
+		position := &models.Position{PairID: 1, Side: "buy", Quantity: create.quantity, EntryPrice: 100, Status: "open"}
+		if err := create.repo.CreatePosition(ctx, position); err != nil {
+			t.Fatalf("CreatePosition() error = %v", err)
+		}
+		if position.AccountID != create.repo.Account() {
+			t.Errorf("position created under account %q, want %q", position.AccountID, create.repo.Account())
+		}
+	}
+
+	tests := []struct {
+		name         string
+		repo         *Repository
+		wantQuantity float64
+		wantAccounts []string
+	}{
+		{name: "alpha sees only its own", repo: alpha, wantQuantity: 3, wantAccounts: []string{"alpha"}},
+		{name: "beta sees only its own", repo: beta, wantQuantity: 5, wantAccounts: []string{"beta"}},
+		{name: "unscoped sees every account", repo: shared, wantQuantity: 8, wantAccounts: []string{"alpha", "beta"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			positions, err := tt.repo.GetAllOpenPositions(ctx)
+			if err != nil {
+				t.Fatalf("GetAllOpenPositions() error = %v", err)
+			}
+
+			quantity := 0.0
+			accounts := make(map[string]bool)
+			for _, position := range positions {
+				quantity += position.Quantity
+				accounts[position.AccountID] = true
+			}
+			if quantity != tt.wantQuantity {
+				t.Errorf("open quantity = %v, want %v", quantity, tt.wantQuantity)
+			}
+			if len(accounts) != len(tt.wantAccounts) {
+				t.Errorf("positions of accounts %v, want %v", accounts, tt.wantAccounts)
+			}
+			for _, account := range tt.wantAccounts {
+				if !accounts[account] {
+					t.Errorf("no positions of account %s, want them visible", account)
+				}
+			}
+		})
+	}
+
+	if got := shared.Account(); got != DefaultAccount {
+		t.Errorf("unscoped repository creates under %q, want %q", got, DefaultAccount)
+	}
+	if len(fake.Queries()) != 6 {
+		t.Errorf("sent %d statements, want 3 inserts and 3 queries", len(fake.Queries()))
+	}
+}
+
+func TestUpdateTradingConfig(t *testing.T) {
+	config := models.TradingConfig{
+		ID: "config-1", StopLossPercent: 0.02, TakeProfitPercent: 0.05, GridLevels: 10,
+		PriceRangeMin: 90, PriceRangeMax: 110, MaxPositions: 3, PositionSizeUSDT: 50, TrailingStopPercent: 0.01,
+	}
+
+	fake, db := newFakeDB(func(string, []driver.Value) (fakeResult, error) { return fakeResult{}, nil })
+	if err := NewRepository(db, 0, utils.NewDiscardLogger()).UpdateTradingConfig(context.Background(), config); err != nil {
+		t.Fatalf("UpdateTradingConfig() error = %v", err)
+	}
+
+	queries := fake.Queries()
+	if len(queries) != 1 || !strings.Contains(queries[0].query, "UPDATE trading_configs") {
+		t.Fatalf("ran %d queries, want one update of trading_configs", len(queries))
+	}
+	want := []driver.Value{"config-1", 0.02, 0.05, int64(10), 90.0, 110.0, int64(3), 50.0, 0.01}
+	args := queries[0].args
+	if len(args) != len(want) {
+		t.Fatalf("update has %d args, want %d", len(args), len(want))
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Errorf("arg $%d = %v, want %v", i+1, args[i], want[i])
+		}
+	}
+
+	_, db = newFakeDB(func(string, []driver.Value) (fakeResult, error) { return fakeResult{unaffected: true}, nil })
+	if err := NewRepository(db, 0, utils.NewDiscardLogger()).UpdateTradingConfig(context.Background(), config); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateTradingConfig() of a missing config error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// requiredColumns lists, per table, columns the engine reads or writes that
+// were added by later migrations, so a database that missed one is caught at
+// startup instead of by the first failing query
+var requiredColumns = map[string][]string{
+	"selected_pairs":     {"id", "symbol", "trading_enabled"},
+	"trading_configs":    {"id", "sizing_mode", "position_size_base", "position_size_percent", "confirm_exits", "trailing_stop_percent"},
+	"positions":          {"id", "account_id", "strategy_tag", "config_version", "total_fees", "high_water_mark", "trailing_stop_price", "take_profit_levels_hit", "closed_fraction", "max_favorable_excursion", "max_adverse_excursion"},
+	"orders":             {"id", "account_id", "strategy_tag", "config_version", "client_oid", "grid_unsettled", "grid_position_id"},
+	"price_data":         {"symbol", "timestamp"},
+	"price_data_hourly":  {"symbol", "timestamp"},
+	"failed_orders":      {"id", "client_oid"},
+	"bracket_orders":     {"id", "oco_order_id"},
+	"ws_watermarks":      {"topic", "sequence"},
+	"backtest_baselines": {"strategy_tag", "win_rate"},
+	"trade_decisions":    {"position_id", "kucoin_order_id", "context"},
+	"risk_halts":         {"account_id", "scope", "pair_id", "halted_until"},
+	"would_trade":        {"account_id", "action", "context"},
+}
+
+// VerifySchema checks that every table and column the engine depends on
+// exists, naming the missing ones
+func (r *Repository) VerifySchema(ctx context.Context) error {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT table_name, column_name
+        FROM information_schema.columns
+        WHERE table_schema = current_schema()
+    `)
+	if err != nil {
+		return fmt.Errorf("failed to query schema: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return fmt.Errorf("failed to scan schema column: %w", err)
+		}
+		existing[table+"."+column] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read schema: %w", err)
+	}
+
+	var missing []string
+	for table, columns := range requiredColumns {
+		for _, column := range columns {
+			if !existing[table+"."+column] {
+				missing = append(missing, table+"."+column)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("database schema is missing %s; apply pending migrations", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
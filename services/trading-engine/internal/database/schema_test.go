@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+)
+
+// schemaColumns answers the information_schema query with every required
+// column except the skipped ones
+func schemaColumns(skip ...string) func(string, []driver.Value) (fakeResult, error) {
+	skipped := make(map[string]bool)
+	for _, column := range skip {
+		skipped[column] = true
+	}
+
+	return func(string, []driver.Value) (fakeResult, error) {
+		result := fakeResult{columns: []string{"table_name", "column_name"}}
+		for table, columns := range requiredColumns {
+			for _, column := range columns {
+				if !skipped[table+"."+column] {
+					result.rows = append(result.rows, []driver.Value{table, column})
+				}
+			}
+		}
+		return result, nil
+	}
+}
+
+func TestVerifySchema(t *testing.T) {
+	_, db := newFakeDB(schemaColumns())
+	if err := NewRepository(db, 0, utils.NewDiscardLogger()).VerifySchema(context.Background()); err != nil {
+		t.Fatalf("VerifySchema() error = %v on a complete schema", err)
+	}
+}
+
+func TestVerifySchemaNamesMissingColumns(t *testing.T) {
+	_, db := newFakeDB(schemaColumns("positions.max_adverse_excursion", "orders.client_oid"))
+
+	err := NewRepository(db, 0, utils.NewDiscardLogger()).VerifySchema(context.Background())
+	if err == nil {
+		t.Fatal("VerifySchema() error = nil, want the missing columns")
+	}
+	if !strings.Contains(err.Error(), "orders.client_oid, positions.max_adverse_excursion") {
+		t.Errorf("VerifySchema() error = %q, want both missing columns named in order", err)
+	}
+}
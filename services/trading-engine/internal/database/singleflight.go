@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+// sharedFetchTimeout bounds a price history read that is no longer tied to
+// the context of the caller that started it
+const sharedFetchTimeout = 30 * time.Second
+
+// PriceHistoryGroup collapses concurrent price history reads for the same
+// symbol and window into a single query. Windows are aligned to the given
+// granularity so callers computing "now minus N" a moment apart still share
+// a read.
+type PriceHistoryGroup struct {
+	source      PriceHistorySource
+	granularity time.Duration
+	logger      *logrus.Logger
+
+	group singleflight.Group
+}
+
+func NewPriceHistoryGroup(source PriceHistorySource, granularity time.Duration, logger *logrus.Logger) *PriceHistoryGroup {
+	return &PriceHistoryGroup{
+		source:      source,
+		granularity: granularity,
+		logger:      logger,
+	}
+}
+
+// GetPriceHistory returns the candles since the aligned start time. The
+// shared query runs detached from any single caller's context, so one caller
+// giving up neither cancels the read for the others nor waits for it.
+func (g *PriceHistoryGroup) GetPriceHistory(ctx context.Context, symbol string, since time.Time) ([]models.Candle, error) {
+	if g.granularity > 0 {
+		since = since.Truncate(g.granularity)
+	}
+	key := fmt.Sprintf("%s|%d", symbol, since.UnixNano())
+
+	ch := g.group.DoChan(key, func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sharedFetchTimeout)
+		defer cancel()
+
+		return g.source.GetPriceHistory(fetchCtx, symbol, since)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-ch:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		if result.Shared {
+			g.logger.WithField("symbol", symbol).Debug("Shared concurrent price history read")
+		}
+
+		// Callers receive the same slice, so each gets its own copy
+		candles := result.Val.([]models.Candle)
+		return append([]models.Candle(nil), candles...), nil
+	}
+}
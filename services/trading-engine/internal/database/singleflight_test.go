@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// blockingSource counts reads and holds each one until released
+type blockingSource struct {
+	calls   int32
+	started chan struct{}
+	release chan struct{}
+	fetchOK chan bool // Whether the read's context was still live when released
+}
+
+func newBlockingSource() *blockingSource {
+	return &blockingSource{
+		started: make(chan struct{}, 10),
+		release: make(chan struct{}),
+		fetchOK: make(chan bool, 10),
+	}
+}
+
+func (s *blockingSource) GetPriceHistory(ctx context.Context, _ string, since time.Time) ([]models.Candle, error) {
+	atomic.AddInt32(&s.calls, 1)
+	s.started <- struct{}{}
+	<-s.release
+
+	s.fetchOK <- ctx.Err() == nil
+	return []models.Candle{{Timestamp: since, Close: 100}, {Timestamp: since.Add(time.Minute), Close: 101}}, nil
+}
+
+func TestPriceHistoryGroupSharesConcurrentReads(t *testing.T) {
+	source := newBlockingSource()
+	group := NewPriceHistoryGroup(source, time.Minute, utils.NewDiscardLogger())
+	since := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	const callers = 8
+	results := make([][]models.Candle, callers)
+	errs := make([]error, callers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Starts a few seconds apart still fall in the same minute
+			results[i], errs[i] = group.GetPriceHistory(context.Background(), "BTC-USDT", since.Add(time.Duration(i)*time.Second))
+		}(i)
+	}
+
+	<-source.started
+	time.Sleep(50 * time.Millisecond) // Let the other callers join the read
+	close(source.release)
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&source.calls); calls != 1 {
+		t.Fatalf("source read %d times for %d concurrent callers, want 1", calls, callers)
+	}
+	for i := range results {
+		if errs[i] != nil {
+			t.Fatalf("caller %d error = %v", i, errs[i])
+		}
+		if len(results[i]) != 2 || !results[i][0].Timestamp.Equal(since) {
+			t.Fatalf("caller %d got %+v, want the two candles since the aligned start", i, results[i])
+		}
+	}
+
+	// Each caller owns its slice
+	results[0][0].Close = 0
+	if results[1][0].Close != 100 {
+		t.Error("callers share one candle slice, want a copy each")
+	}
+}
+
+func TestPriceHistoryGroupSurvivesCancelledCaller(t *testing.T) {
+	source := newBlockingSource()
+	group := NewPriceHistoryGroup(source, time.Minute, utils.NewDiscardLogger())
+	since := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := group.GetPriceHistory(ctx, "BTC-USDT", since)
+		firstErr <- err
+	}()
+	<-source.started
+
+	secondDone := make(chan []models.Candle, 1)
+	go func() {
+		candles, err := group.GetPriceHistory(context.Background(), "BTC-USDT", since)
+		if err != nil {
+			t.Errorf("second caller error = %v", err)
+		}
+		secondDone <- candles
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// The caller that started the read gives up without waiting for it
+	cancel()
+	select {
+	case err := <-firstErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("cancelled caller error = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancelled caller still waiting on the shared read")
+	}
+
+	close(source.release)
+
+	if live := <-source.fetchOK; !live {
+		t.Error("shared read was cancelled with its first caller")
+	}
+	if candles := <-secondDone; len(candles) != 2 {
+		t.Errorf("second caller got %d candles, want 2", len(candles))
+	}
+	if calls := atomic.LoadInt32(&source.calls); calls != 1 {
+		t.Errorf("source read %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,33 @@
+package exchange
+
+import (
+	"context"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+)
+
+// Exchange is the trading venue as the engine and the components it builds
+// use it: order placement and cancellation, order and fill lookups, balances
+// and fee rates. KuCoinExchange is the live implementation.
+type Exchange interface {
+	PlaceBuyOrder(symbol string, quantity, price float64) (*kucoin.OrderResponse, error)
+	PlaceSellOrder(symbol string, quantity, price float64) (*kucoin.OrderResponse, error)
+	PlaceExpiringOrder(symbol, side string, quantity, price float64, cancelAfter time.Duration) (*kucoin.OrderResponse, error)
+	PlaceMarketOrder(symbol, side string, quantity float64) (*kucoin.OrderResponse, error)
+	CancelOrder(orderID string) error
+
+	GetOrder(orderID string) (*kucoin.Order, error)
+	GetOrderStatus(orderID string) (string, error)
+	GetOrderByClientOid(clientOid string) (*kucoin.Order, error)
+	GetFills(ctx context.Context, orderID string) ([]kucoin.Fill, error)
+
+	PlaceBracketOrder(symbol, side string, quantity, takeProfitPrice, stopPrice, stopLimitPrice float64) (*kucoin.OrderResponse, error)
+	GetBracketOrder(ocoOrderID string) (*kucoin.OCOOrderDetails, error)
+	CancelBracketOrder(ocoOrderID string) error
+
+	GetAvailableBalance(currency string) (float64, error)
+	GetFeeRates(symbol string) (FeeRates, bool, error)
+}
+
+var _ Exchange = (*KuCoinExchange)(nil)
@@ -0,0 +1,90 @@
+package exchange
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/sirupsen/logrus"
+)
+
+// FeeRates are the maker and taker fee rates of one symbol
+type FeeRates struct {
+	Maker     float64
+	Taker     float64
+	FetchedAt time.Time
+}
+
+// FeeRateCache keeps the account's fee tier per symbol. Tiers change rarely,
+// with trading volume or a KCS balance, so rates are refetched only once they
+// are older than the TTL.
+type FeeRateCache struct {
+	client *kucoin.Client
+	ttl    time.Duration
+	logger *logrus.Logger
+
+	mu    sync.Mutex
+	rates map[string]FeeRates
+}
+
+func NewFeeRateCache(client *kucoin.Client, ttl time.Duration, logger *logrus.Logger) *FeeRateCache {
+	return &FeeRateCache{
+		client: client,
+		ttl:    ttl,
+		logger: logger,
+		rates:  make(map[string]FeeRates),
+	}
+}
+
+// Get returns the symbol's fee rates, fetching them when missing or expired.
+// A failed fetch falls back to expired rates when there are any.
+func (c *FeeRateCache) Get(symbol string) (FeeRates, error) {
+	c.mu.Lock()
+	cached, ok := c.rates[symbol]
+	c.mu.Unlock()
+
+	if ok && time.Since(cached.FetchedAt) < c.ttl {
+		return cached, nil
+	}
+
+	rates, err := c.fetch(symbol)
+	if err != nil {
+		if ok {
+			c.logger.WithError(err).WithField("symbol", symbol).Warn("Failed to refresh fee rates, using cached rates")
+			return cached, nil
+		}
+		return FeeRates{}, err
+	}
+
+	c.mu.Lock()
+	c.rates[symbol] = rates
+	c.mu.Unlock()
+
+	return rates, nil
+}
+
+func (c *FeeRateCache) fetch(symbol string) (FeeRates, error) {
+	fees, err := c.client.GetTradeFees([]string{symbol})
+	if err != nil {
+		return FeeRates{}, err
+	}
+
+	for _, fee := range fees {
+		if fee.Symbol != symbol {
+			continue
+		}
+		maker, err := strconv.ParseFloat(fee.MakerFeeRate, 64)
+		if err != nil {
+			return FeeRates{}, fmt.Errorf("invalid maker fee rate %q for %s: %w", fee.MakerFeeRate, symbol, err)
+		}
+		taker, err := strconv.ParseFloat(fee.TakerFeeRate, 64)
+		if err != nil {
+			return FeeRates{}, fmt.Errorf("invalid taker fee rate %q for %s: %w", fee.TakerFeeRate, symbol, err)
+		}
+		return FeeRates{Maker: maker, Taker: taker, FetchedAt: time.Now()}, nil
+	}
+
+	return FeeRates{}, fmt.Errorf("no fee rates returned for %s", symbol)
+}
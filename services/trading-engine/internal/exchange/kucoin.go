@@ -1,74 +1,124 @@
 package exchange
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
 	"github.com/sirupsen/logrus"
 )
 
+// ErrOrderNotFound is returned when the exchange has no order with the
+// requested ID
+var ErrOrderNotFound = errors.New("order not found on exchange")
+
+// Codes KuCoin answers an order lookup with when no such order exists
+var orderNotFoundCodes = map[string]bool{
+	kucoin.CodeOrderNotExist: true,
+	"404":                    true,
+}
+
+// ErrInvalidOrder is returned for an order whose quantity or price could
+// never be valid, before any request is sent to the exchange
+var ErrInvalidOrder = errors.New("invalid order parameters")
+
+// FailedOrderRecorder persists order placements that did not succeed
+type FailedOrderRecorder interface {
+	CreateFailedOrder(ctx context.Context, order models.FailedOrder) error
+}
+
 type KuCoinExchange struct {
-	client *kucoin.Client
-	logger *logrus.Logger
+	client       *kucoin.Client
+	symbols      *SymbolCache        // nil formats sizes and prices with eight decimals
+	failedOrders FailedOrderRecorder // nil disables persistence of failed placements
+	feeRates     *FeeRateCache       // nil leaves the account's fee rates unknown
+	logger       *logrus.Logger
 }
 
-func NewKuCoinExchange(client *kucoin.Client, logger *logrus.Logger) *KuCoinExchange {
+func NewKuCoinExchange(client *kucoin.Client, symbols *SymbolCache, failedOrders FailedOrderRecorder, feeRates *FeeRateCache, logger *logrus.Logger) *KuCoinExchange {
 	return &KuCoinExchange{
-		client: client,
-		logger: logger,
+		client:       client,
+		symbols:      symbols,
+		failedOrders: failedOrders,
+		feeRates:     feeRates,
+		logger:       logger,
 	}
 }
 
 func (k *KuCoinExchange) PlaceBuyOrder(symbol string, quantity, price float64) (*kucoin.OrderResponse, error) {
-	clientOid := uuid.New().String()
+	return k.placeLimitOrder(symbol, "buy", quantity, price, 0)
+}
 
-	order := kucoin.OrderRequest{
-		ClientOid:   clientOid,
-		Side:        "buy",
-		Symbol:      symbol,
-		Type:        "limit",
-		Size:        strconv.FormatFloat(quantity, 'f', 8, 64),
-		Price:       strconv.FormatFloat(price, 'f', 8, 64),
-		TimeInForce: "GTC",
+func (k *KuCoinExchange) PlaceSellOrder(symbol string, quantity, price float64) (*kucoin.OrderResponse, error) {
+	return k.placeLimitOrder(symbol, "sell", quantity, price, 0)
+}
+
+// PlaceExpiringOrder places a limit order the exchange cancels by itself
+// once cancelAfter has passed. A cancelAfter under one second places a
+// regular good-till-cancelled order.
+func (k *KuCoinExchange) PlaceExpiringOrder(symbol, side string, quantity, price float64, cancelAfter time.Duration) (*kucoin.OrderResponse, error) {
+	return k.placeLimitOrder(symbol, side, quantity, price, cancelAfter)
+}
+
+func (k *KuCoinExchange) placeLimitOrder(symbol, side string, quantity, price float64, cancelAfter time.Duration) (*kucoin.OrderResponse, error) {
+	if err := k.validateOrder(symbol, quantity, price); err != nil {
+		return nil, err
 	}
 
+	order := LimitOrderRequest(symbol, side, k.formatSize(symbol, quantity), k.formatPrice(symbol, price), cancelAfter)
+
 	k.logger.WithFields(logrus.Fields{
-		"symbol":     symbol,
-		"side":       "buy",
-		"quantity":   quantity,
-		"price":      price,
-		"client_oid": clientOid,
-	}).Info("Placing buy order")
+		"symbol":        symbol,
+		"side":          side,
+		"quantity":      quantity,
+		"price":         price,
+		"time_in_force": order.TimeInForce,
+		"cancel_after":  order.CancelAfter,
+		"client_oid":    order.ClientOid,
+	}).Infof("Placing %s order", side)
 
-	return k.client.PlaceOrder(order)
+	return k.placeOrder(order, quantity, price)
 }
 
-func (k *KuCoinExchange) PlaceSellOrder(symbol string, quantity, price float64) (*kucoin.OrderResponse, error) {
-	clientOid := uuid.New().String()
-
+// LimitOrderRequest builds a limit order with a fresh client OID. It is GTT
+// with cancelAfter in whole seconds when cancelAfter is at least a second,
+// GTC otherwise.
+func LimitOrderRequest(symbol, side, size, price string, cancelAfter time.Duration) kucoin.OrderRequest {
 	order := kucoin.OrderRequest{
-		ClientOid:   clientOid,
-		Side:        "sell",
+		ClientOid:   uuid.New().String(),
+		Side:        side,
 		Symbol:      symbol,
 		Type:        "limit",
-		Size:        strconv.FormatFloat(quantity, 'f', 8, 64),
-		Price:       strconv.FormatFloat(price, 'f', 8, 64),
+		Size:        size,
+		Price:       price,
 		TimeInForce: "GTC",
 	}
+	if seconds := int64(cancelAfter / time.Second); seconds > 0 {
+		order.TimeInForce = "GTT"
+		order.CancelAfter = seconds
+	}
+	return order
+}
 
-	k.logger.WithFields(logrus.Fields{
-		"symbol":     symbol,
-		"side":       "sell",
-		"quantity":   quantity,
-		"price":      price,
-		"client_oid": clientOid,
-	}).Info("Placing sell order")
-
-	return k.client.PlaceOrder(order)
+// IsExpired reports whether a GTT order was cancelled by the exchange when
+// its time ran out. Whatever it filled before expiring still counts.
+func IsExpired(order *kucoin.Order) bool {
+	return !order.IsActive && order.CancelExist && order.TimeInForce == "GTT"
 }
 
 func (k *KuCoinExchange) PlaceMarketOrder(symbol, side string, quantity float64) (*kucoin.OrderResponse, error) {
+	if err := k.validateOrder(symbol, quantity); err != nil {
+		return nil, err
+	}
+
 	clientOid := uuid.New().String()
 
 	order := kucoin.OrderRequest{
@@ -76,7 +126,7 @@ func (k *KuCoinExchange) PlaceMarketOrder(symbol, side string, quantity float64)
 		Side:      side,
 		Symbol:    symbol,
 		Type:      "market",
-		Size:      strconv.FormatFloat(quantity, 'f', 8, 64),
+		Size:      k.formatSize(symbol, quantity),
 	}
 
 	k.logger.WithFields(logrus.Fields{
@@ -87,5 +137,282 @@ func (k *KuCoinExchange) PlaceMarketOrder(symbol, side string, quantity float64)
 		"client_oid": clientOid,
 	}).Info("Placing market order")
 
-	return k.client.PlaceOrder(order)
+	return k.placeOrder(order, quantity, 0)
+}
+
+// placeOrder submits the order, counting it when accepted and recording the
+// attempt when placement fails
+func (k *KuCoinExchange) placeOrder(order kucoin.OrderRequest, quantity, price float64) (*kucoin.OrderResponse, error) {
+	resp, err := k.client.PlaceOrder(order)
+	if err != nil {
+		k.recordFailure(order.Symbol, order.ClientOid, order.Side, order.Type, quantity, price, err)
+		return nil, err
+	}
+	metrics.OrdersPlaced.WithLabelValues(order.Symbol, order.Side, order.Type).Inc()
+	if resp.ClientOid == "" {
+		resp.ClientOid = order.ClientOid
+	}
+
+	return resp, nil
+}
+
+// validateOrder rejects a non-positive or non-finite quantity or price, and a
+// quantity that rounds down to zero at the symbol's size increment. Upstream
+// sizing can produce these through float edge cases; sent as "0.00000000" or
+// a negative string they would only come back as an exchange rejection.
+func (k *KuCoinExchange) validateOrder(symbol string, quantity float64, prices ...float64) error {
+	if !isPositiveFinite(quantity) {
+		return fmt.Errorf("%w: quantity %v for %s must be positive", ErrInvalidOrder, quantity, symbol)
+	}
+	for _, price := range prices {
+		if !isPositiveFinite(price) {
+			return fmt.Errorf("%w: price %v for %s must be positive", ErrInvalidOrder, price, symbol)
+		}
+	}
+
+	if size, err := strconv.ParseFloat(k.formatSize(symbol, quantity), 64); err != nil || size <= 0 {
+		return fmt.Errorf("%w: quantity %v for %s rounds to zero at the size increment", ErrInvalidOrder, quantity, symbol)
+	}
+
+	return nil
+}
+
+func isPositiveFinite(value float64) bool {
+	return value > 0 && !math.IsInf(value, 1)
+}
+
+func (k *KuCoinExchange) formatSize(symbol string, quantity float64) string {
+	if k.symbols != nil {
+		if info, ok := k.symbols.Get(symbol); ok {
+			return formatIncrement(quantity, info.BaseIncrement)
+		}
+	}
+	return strconv.FormatFloat(quantity, 'f', 8, 64)
+}
+
+func (k *KuCoinExchange) formatPrice(symbol string, price float64) string {
+	if k.symbols != nil {
+		if info, ok := k.symbols.Get(symbol); ok {
+			return formatIncrement(price, info.PriceIncrement)
+		}
+	}
+	return strconv.FormatFloat(price, 'f', 8, 64)
+}
+
+// PlaceBracketOrder places an OCO exit for a position: a take profit limit
+// leg and a stop leg that becomes a limit order at stopLimitPrice once
+// stopPrice trades. Whichever leg executes first cancels the other.
+func (k *KuCoinExchange) PlaceBracketOrder(symbol, side string, quantity, takeProfitPrice, stopPrice, stopLimitPrice float64) (*kucoin.OrderResponse, error) {
+	if err := k.validateOrder(symbol, quantity, takeProfitPrice, stopPrice, stopLimitPrice); err != nil {
+		return nil, err
+	}
+
+	clientOid := uuid.New().String()
+
+	order := kucoin.OCOOrderRequest{
+		ClientOid:  clientOid,
+		Side:       side,
+		Symbol:     symbol,
+		Price:      k.formatPrice(symbol, takeProfitPrice),
+		Size:       k.formatSize(symbol, quantity),
+		StopPrice:  k.formatPrice(symbol, stopPrice),
+		LimitPrice: k.formatPrice(symbol, stopLimitPrice),
+		TradeType:  "TRADE",
+	}
+
+	k.logger.WithFields(logrus.Fields{
+		"symbol":            symbol,
+		"side":              side,
+		"quantity":          quantity,
+		"take_profit_price": takeProfitPrice,
+		"stop_price":        stopPrice,
+		"client_oid":        clientOid,
+	}).Info("Placing bracket order")
+
+	resp, err := k.client.PlaceOCOOrder(order)
+	if err != nil {
+		k.recordFailure(symbol, clientOid, side, "oco", quantity, takeProfitPrice, err)
+		return nil, err
+	}
+	metrics.OrdersPlaced.WithLabelValues(symbol, side, "oco").Inc()
+
+	return resp, nil
+}
+
+func (k *KuCoinExchange) GetOrder(orderID string) (*kucoin.Order, error) {
+	return k.client.GetOrder(orderID)
+}
+
+// GetOrderStatus returns the order's status as orders are recorded: pending
+// while it is active, filled once anything executed, otherwise expired for a
+// GTT order that ran out its time or cancelled
+func (k *KuCoinExchange) GetOrderStatus(orderID string) (string, error) {
+	order, err := k.client.GetOrder(orderID)
+	if err != nil {
+		return "", err
+	}
+	if order.IsActive {
+		return "pending", nil
+	}
+
+	fill, err := ParseOrderFill(order)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case fill.DealSize > 0:
+		return "filled", nil
+	case IsExpired(order):
+		return "expired", nil
+	}
+	return "cancelled", nil
+}
+
+// GetOrderByClientOid looks up an order by the client order ID it was placed
+// with, returning ErrOrderNotFound when the exchange never accepted it
+func (k *KuCoinExchange) GetOrderByClientOid(clientOid string) (*kucoin.Order, error) {
+	order, err := k.client.GetOrderByClientOid(clientOid)
+	if err != nil {
+		var apiErr *kucoin.APIError
+		if errors.As(err, &apiErr) && orderNotFoundCodes[apiErr.Code] {
+			return nil, fmt.Errorf("client oid %s: %w", clientOid, ErrOrderNotFound)
+		}
+		return nil, err
+	}
+	return order, nil
+}
+
+// CancelOrder cancels an open order, returning ErrOrderNotFound when the
+// order had already filled, been cancelled or never existed
+func (k *KuCoinExchange) CancelOrder(orderID string) error {
+	k.logger.WithField("order_id", orderID).Info("Cancelling order")
+
+	response, err := k.client.CancelOrder(context.Background(), orderID)
+	if err != nil {
+		return err
+	}
+	if response.AlreadyGone {
+		return fmt.Errorf("cancel of %s: %w", orderID, ErrOrderNotFound)
+	}
+	return nil
+}
+
+// VerifyAuth checks that the API credentials are accepted by making an
+// authenticated request
+func (k *KuCoinExchange) VerifyAuth() error {
+	if _, err := k.client.GetAccounts("", "trade"); err != nil {
+		return fmt.Errorf("exchange rejected credentials: %w", err)
+	}
+	return nil
+}
+
+// GetAvailableBalance returns the amount of a currency available for trading
+func (k *KuCoinExchange) GetAvailableBalance(currency string) (float64, error) {
+	accounts, err := k.client.GetAccounts(currency, "trade")
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0.0
+	for _, account := range accounts {
+		available, err := utils.ParseFloat(account.Available)
+		if err != nil {
+			return 0, fmt.Errorf("invalid available balance %q for %s: %w", account.Available, currency, err)
+		}
+		total += available
+	}
+
+	return total, nil
+}
+
+// OrderFill is the executed part of an order as reported by the exchange
+type OrderFill struct {
+	DealSize  float64
+	DealFunds float64
+	Fee       float64
+}
+
+// ParseOrderFill parses the deal fields of an order. An empty field means
+// nothing executed, but a malformed one is an error so callers skip the
+// update instead of mistaking it for an unfilled order.
+func ParseOrderFill(order *kucoin.Order) (OrderFill, error) {
+	var fill OrderFill
+	var err error
+
+	if fill.DealSize, err = utils.ParseFloat(order.DealSize); err != nil {
+		return OrderFill{}, fmt.Errorf("invalid dealSize %q for order %s: %w", order.DealSize, order.ID, err)
+	}
+	if fill.DealFunds, err = utils.ParseFloat(order.DealFunds); err != nil {
+		return OrderFill{}, fmt.Errorf("invalid dealFunds %q for order %s: %w", order.DealFunds, order.ID, err)
+	}
+	if fill.Fee, err = utils.ParseFloat(order.Fee); err != nil {
+		return OrderFill{}, fmt.Errorf("invalid fee %q for order %s: %w", order.Fee, order.ID, err)
+	}
+
+	return fill, nil
+}
+
+// GetFills returns the individual trades executed for an order
+func (k *KuCoinExchange) GetFills(ctx context.Context, orderID string) ([]kucoin.Fill, error) {
+	return k.client.GetFills(ctx, orderID)
+}
+
+// GetFeeRates returns the account's cached fee rates for a symbol. ok is
+// false when fee rates are not tracked.
+func (k *KuCoinExchange) GetFeeRates(symbol string) (FeeRates, bool, error) {
+	if k.feeRates == nil {
+		return FeeRates{}, false, nil
+	}
+	rates, err := k.feeRates.Get(symbol)
+	return rates, true, err
+}
+
+func (k *KuCoinExchange) GetBracketOrder(ocoOrderID string) (*kucoin.OCOOrderDetails, error) {
+	return k.client.GetOCOOrderDetails(ocoOrderID)
+}
+
+func (k *KuCoinExchange) CancelBracketOrder(ocoOrderID string) error {
+	k.logger.WithField("oco_order_id", ocoOrderID).Info("Cancelling bracket order")
+	return k.client.CancelOCOOrder(ocoOrderID)
+}
+
+// recordFailure counts a failed placement by reason and keeps a durable
+// record of the attempt for later debugging
+func (k *KuCoinExchange) recordFailure(symbol, clientOid, side, orderType string, quantity, price float64, err error) {
+	errorCode := "request_failed"
+	var apiErr *kucoin.APIError
+	if errors.As(err, &apiErr) {
+		errorCode = apiErr.Code
+	}
+
+	metrics.FailedOrders.WithLabelValues(symbol, errorCode).Inc()
+
+	// The exchange may have changed the symbol's increments since they were
+	// cached; reload them before the next order is formatted
+	if k.symbols != nil && isPrecisionError(err) {
+		k.logger.WithField("symbol", symbol).Warn("Order rejected for precision, invalidating symbol metadata")
+		k.symbols.Invalidate()
+	}
+
+	if k.failedOrders == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	failed := models.FailedOrder{
+		Symbol:       symbol,
+		ClientOid:    clientOid,
+		Side:         side,
+		Type:         orderType,
+		Quantity:     quantity,
+		Price:        price,
+		ErrorCode:    errorCode,
+		ErrorMessage: err.Error(),
+	}
+	if recordErr := k.failedOrders.CreateFailedOrder(ctx, failed); recordErr != nil {
+		k.logger.WithError(recordErr).WithField("client_oid", clientOid).Error("Failed to record failed order")
+	}
 }
@@ -0,0 +1,278 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type recordingFailedOrders struct {
+	orders []models.FailedOrder
+	err    error
+}
+
+func (r *recordingFailedOrders) CreateFailedOrder(_ context.Context, order models.FailedOrder) error {
+	r.orders = append(r.orders, order)
+	return r.err
+}
+
+func TestRecordFailureRecordsRejectedOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode string
+	}{
+		{
+			name:     "exchange rejection keeps the API error code",
+			err:      &kucoin.APIError{Code: "200004", Msg: "Balance insufficient"},
+			wantCode: "200004",
+		},
+		{
+			name:     "wrapped exchange rejection keeps the API error code",
+			err:      errors.Join(errors.New("place order"), &kucoin.APIError{Code: "400100", Msg: "Parameter error"}),
+			wantCode: "400100",
+		},
+		{
+			name:     "transport failure is counted as request_failed",
+			err:      errors.New("connection reset by peer"),
+			wantCode: "request_failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &recordingFailedOrders{}
+			k := NewKuCoinExchange(nil, nil, recorder, nil, utils.NewDiscardLogger())
+
+			counter := metrics.FailedOrders.WithLabelValues("BTC-USDT", tt.wantCode)
+			before := testutil.ToFloat64(counter)
+
+			k.recordFailure("BTC-USDT", "oid-1", "buy", "limit", 0.5, 42000, tt.err)
+
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("failed_orders{reason=%s} increased by %v, want 1", tt.wantCode, got)
+			}
+			if len(recorder.orders) != 1 {
+				t.Fatalf("recorded %d failed orders, want 1", len(recorder.orders))
+			}
+
+			got := recorder.orders[0]
+			want := models.FailedOrder{
+				Symbol:       "BTC-USDT",
+				ClientOid:    "oid-1",
+				Side:         "buy",
+				Type:         "limit",
+				Quantity:     0.5,
+				Price:        42000,
+				ErrorCode:    tt.wantCode,
+				ErrorMessage: tt.err.Error(),
+			}
+			if got != want {
+				t.Errorf("recorded %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestRecordFailureWithoutRecorder(t *testing.T) {
+	k := NewKuCoinExchange(nil, nil, nil, nil, utils.NewDiscardLogger())
+
+	counter := metrics.FailedOrders.WithLabelValues("ETH-USDT", "200004")
+	before := testutil.ToFloat64(counter)
+
+	k.recordFailure("ETH-USDT", "oid-2", "sell", "market", 1, 0, &kucoin.APIError{Code: "200004"})
+
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("failed_orders increased by %v with persistence disabled, want 1", got)
+	}
+}
+
+func TestRecordFailureSurvivesRecorderError(t *testing.T) {
+	recorder := &recordingFailedOrders{err: errors.New("database unavailable")}
+	k := NewKuCoinExchange(nil, nil, recorder, nil, utils.NewDiscardLogger())
+
+	k.recordFailure("BTC-USDT", "oid-3", "buy", "limit", 1, 100, errors.New("timeout"))
+
+	if len(recorder.orders) != 1 {
+		t.Fatalf("recorded %d failed orders, want 1 attempt", len(recorder.orders))
+	}
+}
+
+func TestParseOrderFill(t *testing.T) {
+	tests := []struct {
+		name    string
+		order   kucoin.Order
+		want    OrderFill
+		wantErr string
+	}{
+		{
+			name:  "filled order",
+			order: kucoin.Order{ID: "o1", DealSize: "0.5", DealFunds: "21000.25", Fee: "21.00025"},
+			want:  OrderFill{DealSize: 0.5, DealFunds: 21000.25, Fee: 21.00025},
+		},
+		{
+			name:  "empty fields mean nothing executed",
+			order: kucoin.Order{ID: "o2"},
+			want:  OrderFill{},
+		},
+		{
+			name:    "malformed deal size",
+			order:   kucoin.Order{ID: "o3", DealSize: "0.5.1", DealFunds: "100", Fee: "0.1"},
+			wantErr: "dealSize",
+		},
+		{
+			name:    "malformed deal funds",
+			order:   kucoin.Order{ID: "o4", DealSize: "1", DealFunds: "n/a", Fee: "0.1"},
+			wantErr: "dealFunds",
+		},
+		{
+			name:    "malformed fee",
+			order:   kucoin.Order{ID: "o5", DealSize: "1", DealFunds: "100", Fee: "1e"},
+			wantErr: "fee",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOrderFill(&tt.order)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), tt.order.ID) {
+					t.Fatalf("ParseOrderFill() error = %v, want one naming %s and the order", err, tt.wantErr)
+				}
+				if got != (OrderFill{}) {
+					t.Errorf("ParseOrderFill() = %+v alongside an error, want the zero value", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseOrderFill() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseOrderFill() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNonPositiveOrdersRejectedBeforePlacement(t *testing.T) {
+	source := &fakeSymbols{}
+	source.set("0.01", "0.1")
+	symbols := newTestSymbolCache(source)
+	if err := symbols.Refresh(); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		place func(k *KuCoinExchange) error
+	}{
+		{name: "zero buy quantity", place: func(k *KuCoinExchange) error {
+			_, err := k.PlaceBuyOrder("BTC-USDT", 0, 100)
+			return err
+		}},
+		{name: "negative buy quantity", place: func(k *KuCoinExchange) error {
+			_, err := k.PlaceBuyOrder("BTC-USDT", -0.5, 100)
+			return err
+		}},
+		{name: "zero buy price", place: func(k *KuCoinExchange) error {
+			_, err := k.PlaceBuyOrder("BTC-USDT", 1, 0)
+			return err
+		}},
+		{name: "negative sell price", place: func(k *KuCoinExchange) error {
+			_, err := k.PlaceSellOrder("BTC-USDT", 1, -100)
+			return err
+		}},
+		{name: "NaN market quantity", place: func(k *KuCoinExchange) error {
+			_, err := k.PlaceMarketOrder("BTC-USDT", "sell", math.NaN())
+			return err
+		}},
+		{name: "infinite market quantity", place: func(k *KuCoinExchange) error {
+			_, err := k.PlaceMarketOrder("BTC-USDT", "buy", math.Inf(1))
+			return err
+		}},
+		{name: "quantity rounding to zero at the increment", place: func(k *KuCoinExchange) error {
+			_, err := k.PlaceBuyOrder("BTC-USDT", 0.004, 100)
+			return err
+		}},
+		{name: "negative bracket stop", place: func(k *KuCoinExchange) error {
+			_, err := k.PlaceBracketOrder("BTC-USDT", "sell", 1, 110, -95, 94)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// No client: any request reaching the exchange would panic
+			recorder := &recordingFailedOrders{}
+			k := NewKuCoinExchange(nil, symbols, recorder, nil, utils.NewDiscardLogger())
+
+			if err := tt.place(k); !errors.Is(err, ErrInvalidOrder) {
+				t.Fatalf("error = %v, want ErrInvalidOrder", err)
+			}
+			if len(recorder.orders) != 0 {
+				t.Errorf("recorded %d failed orders, want a rejection before placement", len(recorder.orders))
+			}
+		})
+	}
+}
+
+func TestLimitOrderRequest(t *testing.T) {
+	tests := []struct {
+		name            string
+		cancelAfter     time.Duration
+		wantTimeInForce string
+		wantCancelAfter int64
+	}{
+		{name: "no cancel-after", wantTimeInForce: "GTC"},
+		{name: "under a second", cancelAfter: 500 * time.Millisecond, wantTimeInForce: "GTC"},
+		{name: "whole minutes", cancelAfter: 30 * time.Minute, wantTimeInForce: "GTT", wantCancelAfter: 1800},
+		{name: "fractional seconds truncated", cancelAfter: 90*time.Second + 700*time.Millisecond, wantTimeInForce: "GTT", wantCancelAfter: 90},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := LimitOrderRequest("BTC-USDT", "sell", "0.5", "60000", tt.cancelAfter)
+
+			if order.TimeInForce != tt.wantTimeInForce || order.CancelAfter != tt.wantCancelAfter {
+				t.Errorf("time in force = %s with cancel-after %d, want %s with %d", order.TimeInForce, order.CancelAfter, tt.wantTimeInForce, tt.wantCancelAfter)
+			}
+			if order.Type != "limit" || order.Side != "sell" || order.Size != "0.5" || order.Price != "60000" || order.ClientOid == "" {
+				t.Errorf("order = %+v, want a sell limit of 0.5 at 60000 with a client OID", order)
+			}
+		})
+	}
+
+	if a, b := LimitOrderRequest("BTC-USDT", "buy", "1", "1", 0), LimitOrderRequest("BTC-USDT", "buy", "1", "1", 0); a.ClientOid == b.ClientOid {
+		t.Error("two requests share a client OID, want a fresh one each")
+	}
+}
+
+func TestIsExpired(t *testing.T) {
+	tests := []struct {
+		name  string
+		order kucoin.Order
+		want  bool
+	}{
+		{name: "GTT cancelled by the exchange", order: kucoin.Order{TimeInForce: "GTT", CancelExist: true}, want: true},
+		{name: "GTT still resting", order: kucoin.Order{TimeInForce: "GTT", IsActive: true}},
+		{name: "GTT filled", order: kucoin.Order{TimeInForce: "GTT"}},
+		{name: "GTC cancelled", order: kucoin.Order{TimeInForce: "GTC", CancelExist: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsExpired(&tt.order); got != tt.want {
+				t.Errorf("IsExpired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/sirupsen/logrus"
+)
+
+// Rejection codes KuCoin returns for invalid order parameters; combined with
+// the message they identify increments that no longer match the exchange
+var precisionErrorCodes = map[string]bool{
+	"400100": true, // Parameter error
+	"900001": true, // Symbol/parameter invalid
+}
+
+// symbolSource lists the exchange's symbols; *kucoin.Client implements it
+type symbolSource interface {
+	GetSymbols() ([]kucoin.Symbol, error)
+}
+
+// SymbolCache keeps symbol trading rules (size and price increments, minimum
+// sizes) in memory. The rules change occasionally when KuCoin adjusts a pair,
+// so the cache is reloaded periodically and whenever an order is rejected for
+// a precision reason.
+type SymbolCache struct {
+	client          symbolSource
+	refreshInterval time.Duration
+	logger          *logrus.Logger
+
+	mu       sync.RWMutex
+	symbols  map[string]kucoin.Symbol
+	loadedAt time.Time
+	stale    bool
+}
+
+func NewSymbolCache(client *kucoin.Client, refreshInterval time.Duration, logger *logrus.Logger) *SymbolCache {
+	return &SymbolCache{
+		client:          client,
+		refreshInterval: refreshInterval,
+		logger:          logger,
+		symbols:         make(map[string]kucoin.Symbol),
+	}
+}
+
+// Run reloads the cache on the configured interval until the context is
+// cancelled
+func (c *SymbolCache) Run(ctx context.Context) error {
+	if err := c.Refresh(); err != nil {
+		c.logger.WithError(err).Warn("Failed to load symbol metadata")
+	}
+
+	if c.refreshInterval <= 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(c.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := c.Refresh(); err != nil {
+				c.logger.WithError(err).Warn("Failed to refresh symbol metadata, keeping cached rules")
+			}
+		}
+	}
+}
+
+// Refresh reloads all symbols and logs any whose increments changed
+func (c *SymbolCache) Refresh() error {
+	symbols, err := c.client.GetSymbols()
+	if err != nil {
+		return fmt.Errorf("failed to get symbols: %w", err)
+	}
+
+	loaded := make(map[string]kucoin.Symbol, len(symbols))
+	for _, symbol := range symbols {
+		loaded[symbol.Symbol] = symbol
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, symbol := range loaded {
+		previous, ok := c.symbols[name]
+		if !ok {
+			continue
+		}
+		if previous.BaseIncrement != symbol.BaseIncrement || previous.PriceIncrement != symbol.PriceIncrement ||
+			previous.BaseMinSize != symbol.BaseMinSize {
+			c.logger.WithFields(logrus.Fields{
+				"symbol":              name,
+				"old_base_increment":  previous.BaseIncrement,
+				"new_base_increment":  symbol.BaseIncrement,
+				"old_price_increment": previous.PriceIncrement,
+				"new_price_increment": symbol.PriceIncrement,
+				"old_base_min_size":   previous.BaseMinSize,
+				"new_base_min_size":   symbol.BaseMinSize,
+			}).Info("Symbol trading rules changed")
+		}
+	}
+
+	c.symbols = loaded
+	c.loadedAt = time.Now()
+	c.stale = false
+
+	c.logger.WithField("symbol_count", len(loaded)).Debug("Symbol metadata refreshed")
+
+	return nil
+}
+
+// Invalidate marks the cache stale so the next lookup reloads it
+func (c *SymbolCache) Invalidate() {
+	c.mu.Lock()
+	c.stale = true
+	c.mu.Unlock()
+}
+
+// Get returns the trading rules for a symbol, reloading first when the cache
+// is empty or has been invalidated. A failed reload falls back to the cached
+// rules.
+func (c *SymbolCache) Get(symbol string) (kucoin.Symbol, bool) {
+	c.mu.RLock()
+	needsLoad := c.stale || c.loadedAt.IsZero()
+	c.mu.RUnlock()
+
+	if needsLoad {
+		if err := c.Refresh(); err != nil {
+			c.logger.WithError(err).Warn("Failed to reload symbol metadata, using cached rules")
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	info, ok := c.symbols[symbol]
+	return info, ok
+}
+
+// isPrecisionError reports whether an order rejection indicates the size or
+// price did not match the symbol's current increments
+func isPrecisionError(err error) bool {
+	var apiErr *kucoin.APIError
+	if !errors.As(err, &apiErr) || !precisionErrorCodes[apiErr.Code] {
+		return false
+	}
+
+	msg := strings.ToLower(apiErr.Msg)
+	return strings.Contains(msg, "increment") || strings.Contains(msg, "precision") ||
+		strings.Contains(msg, "min size") || strings.Contains(msg, "minimum")
+}
+
+// formatIncrement rounds value down to a multiple of increment and formats it
+// with the increment's number of decimals. An unusable increment falls back
+// to eight decimals.
+func formatIncrement(value float64, increment string) string {
+	step, err := strconv.ParseFloat(increment, 64)
+	if err != nil || step <= 0 {
+		return strconv.FormatFloat(value, 'f', 8, 64)
+	}
+
+	decimals := 0
+	if dot := strings.IndexByte(increment, '.'); dot >= 0 {
+		decimals = len(strings.TrimRight(increment[dot+1:], "0"))
+	}
+
+	// The small epsilon keeps values that are already on the grid from being
+	// pushed down a step by floating point error
+	steps := math.Floor(value/step + 1e-9)
+	return strconv.FormatFloat(steps*step, 'f', decimals, 64)
+}
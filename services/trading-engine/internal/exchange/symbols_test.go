@@ -0,0 +1,176 @@
+package exchange
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+)
+
+// fakeSymbols serves a symbol list tests can change between loads
+type fakeSymbols struct {
+	mu      sync.Mutex
+	symbols []kucoin.Symbol
+	err     error
+	loads   int
+}
+
+func (f *fakeSymbols) GetSymbols() ([]kucoin.Symbol, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.loads++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return append([]kucoin.Symbol(nil), f.symbols...), nil
+}
+
+func (f *fakeSymbols) set(baseIncrement, priceIncrement string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.symbols = []kucoin.Symbol{{Symbol: "BTC-USDT", BaseIncrement: baseIncrement, PriceIncrement: priceIncrement}}
+}
+
+func (f *fakeSymbols) loadCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.loads
+}
+
+func newTestSymbolCache(source *fakeSymbols) *SymbolCache {
+	cache := NewSymbolCache(nil, time.Hour, utils.NewDiscardLogger())
+	cache.client = source
+	return cache
+}
+
+func TestSymbolRefreshUpdatesChangedIncrement(t *testing.T) {
+	source := &fakeSymbols{}
+	source.set("0.0001", "0.1")
+	k := NewKuCoinExchange(nil, newTestSymbolCache(source), nil, nil, utils.NewDiscardLogger())
+
+	if got := k.formatSize("BTC-USDT", 0.123456); got != "0.1234" {
+		t.Fatalf("formatSize() = %s, want 0.1234", got)
+	}
+	if got := k.formatPrice("BTC-USDT", 64000.27); got != "64000.2" {
+		t.Fatalf("formatPrice() = %s, want 64000.2", got)
+	}
+
+	source.set("0.001", "1")
+	if err := k.symbols.Refresh(); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	if got := k.formatSize("BTC-USDT", 0.123456); got != "0.123" {
+		t.Errorf("formatSize() after refresh = %s, want 0.123", got)
+	}
+	if got := k.formatPrice("BTC-USDT", 64000.27); got != "64000" {
+		t.Errorf("formatPrice() after refresh = %s, want 64000", got)
+	}
+}
+
+func TestSymbolRefreshFailureKeepsCachedRules(t *testing.T) {
+	source := &fakeSymbols{}
+	source.set("0.0001", "0.1")
+	cache := newTestSymbolCache(source)
+
+	if _, ok := cache.Get("BTC-USDT"); !ok {
+		t.Fatal("Get() found no rules after the first load")
+	}
+
+	source.err = errors.New("exchange unavailable")
+	if err := cache.Refresh(); err == nil {
+		t.Fatal("Refresh() error = nil, want the source error")
+	}
+
+	info, ok := cache.Get("BTC-USDT")
+	if !ok || info.BaseIncrement != "0.0001" {
+		t.Errorf("Get() = %+v, %v after a failed refresh, want the cached rules", info, ok)
+	}
+}
+
+func TestPrecisionRejectionInvalidatesSymbols(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantReloads int
+	}{
+		{
+			name:        "increment rejection reloads the rules",
+			err:         &kucoin.APIError{Code: "400100", Msg: "Order size increment invalid."},
+			wantReloads: 1,
+		},
+		{
+			name:        "precision rejection reloads the rules",
+			err:         &kucoin.APIError{Code: "900001", Msg: "Price precision exceeds the limit"},
+			wantReloads: 1,
+		},
+		{
+			name:        "other parameter error keeps the rules",
+			err:         &kucoin.APIError{Code: "400100", Msg: "Invalid clientOid"},
+			wantReloads: 0,
+		},
+		{
+			name:        "balance rejection keeps the rules",
+			err:         &kucoin.APIError{Code: "200004", Msg: "Balance insufficient"},
+			wantReloads: 0,
+		},
+		{
+			name:        "transport failure keeps the rules",
+			err:         errors.New("connection reset by peer"),
+			wantReloads: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &fakeSymbols{}
+			source.set("0.0001", "0.1")
+			k := NewKuCoinExchange(nil, newTestSymbolCache(source), nil, nil, utils.NewDiscardLogger())
+
+			k.formatSize("BTC-USDT", 1)
+			loaded := source.loadCount()
+
+			source.set("0.01", "1")
+			k.recordFailure("BTC-USDT", "oid-1", "buy", "limit", 0.1234, 64000.1, tt.err)
+			got := k.formatSize("BTC-USDT", 0.1234)
+
+			if reloads := source.loadCount() - loaded; reloads != tt.wantReloads {
+				t.Fatalf("reloaded symbols %d times, want %d", reloads, tt.wantReloads)
+			}
+			want := "0.1234"
+			if tt.wantReloads > 0 {
+				want = "0.12"
+			}
+			if got != want {
+				t.Errorf("formatSize() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestFormatIncrement(t *testing.T) {
+	tests := []struct {
+		value     float64
+		increment string
+		want      string
+	}{
+		{value: 0.123456, increment: "0.0001", want: "0.1234"},
+		{value: 0.3, increment: "0.1", want: "0.3"},
+		{value: 64000.99, increment: "1", want: "64000"},
+		{value: 1.5, increment: "0.50", want: "1.5"},
+		{value: 0.12345678912, increment: "", want: "0.12345679"},
+		{value: 2, increment: "0", want: "2.00000000"},
+	}
+
+	for _, tt := range tests {
+		if got := formatIncrement(tt.value, tt.increment); got != tt.want {
+			t.Errorf("formatIncrement(%v, %q) = %s, want %s", tt.value, tt.increment, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package marketdata
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WatermarkStore persists the last processed sequence of each topic
+type WatermarkStore interface {
+	GetWSWatermarks(ctx context.Context) (map[string]int64, error)
+	SaveWSWatermarks(ctx context.Context, watermarks map[string]int64) error
+}
+
+// MessageDeduper discards websocket messages that were already processed or
+// arrive out of order. It keeps the highest accepted sequence per topic and
+// flushes changed watermarks to the store periodically and on shutdown, so a
+// restart followed by a reconnect does not reprocess replayed messages.
+type MessageDeduper struct {
+	store         WatermarkStore // nil keeps watermarks in memory only
+	flushInterval time.Duration
+	logger        *logrus.Logger
+
+	mu         sync.Mutex
+	watermarks map[string]int64
+	dirty      map[string]bool
+}
+
+func NewMessageDeduper(store WatermarkStore, flushInterval time.Duration, logger *logrus.Logger) *MessageDeduper {
+	return &MessageDeduper{
+		store:         store,
+		flushInterval: flushInterval,
+		logger:        logger,
+		watermarks:    make(map[string]int64),
+		dirty:         make(map[string]bool),
+	}
+}
+
+// Load restores the persisted watermarks
+func (d *MessageDeduper) Load(ctx context.Context) error {
+	if d.store == nil {
+		return nil
+	}
+
+	watermarks, err := d.store.GetWSWatermarks(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load websocket watermarks: %w", err)
+	}
+
+	d.mu.Lock()
+	for topic, sequence := range watermarks {
+		if sequence > d.watermarks[topic] {
+			d.watermarks[topic] = sequence
+		}
+	}
+	d.mu.Unlock()
+
+	d.logger.WithField("topics", len(watermarks)).Debug("Loaded websocket watermarks")
+	return nil
+}
+
+// Accept reports whether a message with the given sequence should be
+// processed, advancing the topic's watermark when it is
+func (d *MessageDeduper) Accept(topic string, sequence int64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if last, ok := d.watermarks[topic]; ok && sequence <= last {
+		return false
+	}
+
+	d.watermarks[topic] = sequence
+	d.dirty[topic] = true
+	return true
+}
+
+// Run flushes watermarks on the configured interval until the context is
+// cancelled, then flushes once more
+func (d *MessageDeduper) Run(ctx context.Context) error {
+	if d.store == nil || d.flushInterval <= 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(d.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			defer cancel()
+			return d.Flush(flushCtx)
+		case <-ticker.C:
+			if err := d.Flush(ctx); err != nil {
+				d.logger.WithError(err).Warn("Failed to persist websocket watermarks")
+			}
+		}
+	}
+}
+
+// Flush persists the watermarks that changed since the last flush. On failure
+// they stay marked and are retried on the next flush.
+func (d *MessageDeduper) Flush(ctx context.Context) error {
+	if d.store == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	pending := make(map[string]int64, len(d.dirty))
+	for topic := range d.dirty {
+		pending[topic] = d.watermarks[topic]
+	}
+	d.dirty = make(map[string]bool)
+	d.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if err := d.store.SaveWSWatermarks(ctx, pending); err != nil {
+		d.mu.Lock()
+		for topic := range pending {
+			d.dirty[topic] = true
+		}
+		d.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
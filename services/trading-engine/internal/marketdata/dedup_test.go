@@ -0,0 +1,103 @@
+package marketdata
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+)
+
+// memoryWatermarks stands in for the database across a restart
+type memoryWatermarks struct {
+	saved   map[string]int64
+	saveErr error
+}
+
+func (s *memoryWatermarks) GetWSWatermarks(context.Context) (map[string]int64, error) {
+	loaded := make(map[string]int64, len(s.saved))
+	for topic, sequence := range s.saved {
+		loaded[topic] = sequence
+	}
+	return loaded, nil
+}
+
+func (s *memoryWatermarks) SaveWSWatermarks(_ context.Context, watermarks map[string]int64) error {
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	if s.saved == nil {
+		s.saved = make(map[string]int64)
+	}
+	for topic, sequence := range watermarks {
+		s.saved[topic] = sequence
+	}
+	return nil
+}
+
+func TestDeduperSuppressesDuplicateAndOutOfOrder(t *testing.T) {
+	d := NewMessageDeduper(nil, 0, utils.NewDiscardLogger())
+
+	steps := []struct {
+		topic    string
+		sequence int64
+		want     bool
+	}{
+		{topic: "ticker", sequence: 10, want: true},
+		{topic: "ticker", sequence: 11, want: true},
+		{topic: "ticker", sequence: 11, want: false}, // Duplicate
+		{topic: "ticker", sequence: 9, want: false},  // Out of order
+		{topic: "ticker", sequence: 15, want: true},  // Gaps are accepted
+		{topic: "fills", sequence: 3, want: true},    // Topics are independent
+		{topic: "fills", sequence: 3, want: false},
+	}
+
+	for i, step := range steps {
+		if got := d.Accept(step.topic, step.sequence); got != step.want {
+			t.Errorf("step %d: Accept(%s, %d) = %v, want %v", i, step.topic, step.sequence, got, step.want)
+		}
+	}
+}
+
+func TestDeduperWatermarkSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryWatermarks{}
+
+	first := NewMessageDeduper(store, 0, utils.NewDiscardLogger())
+	first.Accept("ticker", 40)
+	first.Accept("ticker", 41)
+	if err := first.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	// After the restart the reconnect replays 40 and 41 before new messages
+	second := NewMessageDeduper(store, 0, utils.NewDiscardLogger())
+	if err := second.Load(ctx); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if second.Accept("ticker", 40) || second.Accept("ticker", 41) {
+		t.Error("replayed messages accepted after a restart")
+	}
+	if !second.Accept("ticker", 42) {
+		t.Error("next message rejected after a restart")
+	}
+}
+
+func TestDeduperRetriesFailedFlush(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryWatermarks{saveErr: errors.New("database unavailable")}
+	d := NewMessageDeduper(store, 0, utils.NewDiscardLogger())
+
+	d.Accept("ticker", 7)
+	if err := d.Flush(ctx); err == nil {
+		t.Fatal("Flush() error = nil, want the store failure")
+	}
+
+	store.saveErr = nil
+	if err := d.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if got := store.saved["ticker"]; got != 7 {
+		t.Errorf("saved watermark = %d, want 7 persisted on the retry", got)
+	}
+}
@@ -0,0 +1,451 @@
+package marketdata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	level2Topic = "/market/level2:"
+
+	maxBufferedUpdates = 1000
+	resyncRetryDelay   = 2 * time.Second
+)
+
+var errSequenceGap = errors.New("level2 sequence gap")
+
+// SymbolProvider returns the symbols whose order books should be maintained
+type SymbolProvider func(ctx context.Context) ([]string, error)
+
+type orderBook struct {
+	sequence int64
+	bids     map[float64]float64 // price -> size
+	asks     map[float64]float64
+	ready    bool                  // Snapshot applied and diffs in sequence
+	buffered []kucoin.Level2Update // Diffs received while waiting for a snapshot
+}
+
+// OrderBookManager maintains in-memory order books from the KuCoin level2
+// feed. Each book is bootstrapped the way KuCoin requires: diffs are buffered
+// from subscription, a REST snapshot is fetched, then buffered diffs newer
+// than the snapshot are replayed. A gap in sequence numbers triggers a resync.
+type OrderBookManager struct {
+	client          *kucoin.Client
+	symbols         SymbolProvider
+	refreshInterval time.Duration
+	dedup           *MessageDeduper // nil processes every message
+	logger          *logrus.Logger
+
+	mu     sync.RWMutex
+	books  map[string]*orderBook
+	resync chan string
+}
+
+func NewOrderBookManager(client *kucoin.Client, symbols SymbolProvider, refreshInterval time.Duration,
+	dedup *MessageDeduper, logger *logrus.Logger) *OrderBookManager {
+
+	return &OrderBookManager{
+		client:          client,
+		symbols:         symbols,
+		refreshInterval: refreshInterval,
+		dedup:           dedup,
+		logger:          logger,
+		books:           make(map[string]*orderBook),
+		resync:          make(chan string, 100),
+	}
+}
+
+// Run keeps the feed connected until the context is cancelled, reconnecting
+// on errors and whenever the set of symbols changes
+func (m *OrderBookManager) Run(ctx context.Context) error {
+	m.logger.Info("Starting order book manager")
+
+	for {
+		err := m.runSession(ctx)
+		if ctx.Err() != nil {
+			m.logger.Info("Order book manager stopped")
+			return nil
+		}
+		if err != nil {
+			m.logger.WithError(err).Warn("Order book feed disconnected, reconnecting")
+		}
+
+		select {
+		case <-ctx.Done():
+			m.logger.Info("Order book manager stopped")
+			return nil
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (m *OrderBookManager) runSession(ctx context.Context) error {
+	symbols, err := m.symbols(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get symbols: %w", err)
+	}
+	if len(symbols) == 0 {
+		return nil
+	}
+	sort.Strings(symbols)
+
+	sessionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	conn, err := m.client.DialPublicWS(sessionCtx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	m.resetBooks(symbols)
+
+	if err := conn.Subscribe(level2Topic + strings.Join(symbols, ",")); err != nil {
+		return fmt.Errorf("failed to subscribe to level2: %w", err)
+	}
+
+	go m.bootstrapLoop(sessionCtx, symbols)
+	go m.watchSymbols(sessionCtx, cancel, symbols)
+
+	// Close the connection when the session ends so the blocked read returns
+	go func() {
+		<-sessionCtx.Done()
+		conn.Close()
+	}()
+
+	m.logger.WithField("symbols", len(symbols)).Info("Subscribed to level2 order book feed")
+
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			if sessionCtx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if msg.Type != "message" || !strings.HasPrefix(msg.Topic, level2Topic) {
+			continue
+		}
+
+		var update kucoin.Level2Update
+		if err := json.Unmarshal(msg.Data, &update); err != nil {
+			m.logger.WithError(err).Warn("Failed to decode level2 update")
+			continue
+		}
+
+		// A reconnect can replay diffs that were already applied
+		if m.dedup != nil && !m.dedup.Accept(level2Topic+update.Symbol, update.SequenceEnd) {
+			m.logger.WithFields(logrus.Fields{
+				"symbol":       update.Symbol,
+				"sequence_end": update.SequenceEnd,
+			}).Debug("Discarded duplicate or out of order level2 update")
+			continue
+		}
+
+		m.handleUpdate(update)
+	}
+}
+
+// bootstrapLoop fetches snapshots for every symbol at session start and for
+// any symbol flagged for resync afterwards
+func (m *OrderBookManager) bootstrapLoop(ctx context.Context, symbols []string) {
+	for _, symbol := range symbols {
+		m.bootstrap(symbol)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case symbol := <-m.resync:
+			m.bootstrap(symbol)
+		}
+	}
+}
+
+// watchSymbols ends the session when the symbol set changes so the next
+// session subscribes to the new set
+func (m *OrderBookManager) watchSymbols(ctx context.Context, cancel context.CancelFunc, current []string) {
+	if m.refreshInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(m.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			symbols, err := m.symbols(ctx)
+			if err != nil {
+				m.logger.WithError(err).Warn("Failed to refresh order book symbols")
+				continue
+			}
+			sort.Strings(symbols)
+			if strings.Join(symbols, ",") != strings.Join(current, ",") {
+				m.logger.Info("Order book symbols changed, resubscribing")
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+func (m *OrderBookManager) resetBooks(symbols []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.books = make(map[string]*orderBook, len(symbols))
+	for _, symbol := range symbols {
+		m.books[symbol] = &orderBook{}
+	}
+}
+
+func (m *OrderBookManager) bootstrap(symbol string) {
+	snapshot, err := m.client.GetOrderBookSnapshot(symbol)
+	if err != nil {
+		m.logger.WithError(err).WithField("symbol", symbol).Warn("Failed to fetch order book snapshot")
+		m.retryBootstrap(symbol)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	book, ok := m.books[symbol]
+	if !ok {
+		return
+	}
+
+	if err := book.loadSnapshot(snapshot); err != nil {
+		m.logger.WithError(err).WithField("symbol", symbol).Warn("Failed to load order book snapshot")
+		m.retryBootstrap(symbol)
+		return
+	}
+
+	buffered := book.buffered
+	book.buffered = nil
+	for _, update := range buffered {
+		if err := book.apply(update); err != nil {
+			m.logger.WithError(err).WithField("symbol", symbol).Warn("Buffered level2 diffs do not continue the snapshot, resyncing")
+			book.ready = false
+			m.retryBootstrap(symbol)
+			return
+		}
+	}
+
+	book.ready = true
+	m.logger.WithFields(logrus.Fields{
+		"symbol":   symbol,
+		"sequence": book.sequence,
+		"replayed": len(buffered),
+	}).Debug("Order book synchronized")
+}
+
+func (m *OrderBookManager) handleUpdate(update kucoin.Level2Update) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	book, ok := m.books[update.Symbol]
+	if !ok {
+		return
+	}
+
+	if !book.ready {
+		// Diffs older than the eventual snapshot are discarded on replay, so
+		// only the most recent ones need to be kept while waiting
+		if len(book.buffered) >= maxBufferedUpdates {
+			book.buffered = book.buffered[1:]
+		}
+		book.buffered = append(book.buffered, update)
+		return
+	}
+
+	if err := book.apply(update); err != nil {
+		m.logger.WithFields(logrus.Fields{
+			"symbol":         update.Symbol,
+			"sequence":       book.sequence,
+			"sequence_start": update.SequenceStart,
+		}).Warn("Level2 sequence gap detected, resyncing order book")
+		book.ready = false
+		book.buffered = []kucoin.Level2Update{update}
+		m.requestResync(update.Symbol)
+	}
+}
+
+func (m *OrderBookManager) requestResync(symbol string) {
+	select {
+	case m.resync <- symbol:
+	default:
+		// A resync is already queued for plenty of symbols
+	}
+}
+
+// retryBootstrap schedules another snapshot attempt after a short delay so a
+// failing snapshot endpoint is not hammered
+func (m *OrderBookManager) retryBootstrap(symbol string) {
+	time.AfterFunc(resyncRetryDelay, func() { m.requestResync(symbol) })
+}
+
+// BestBidAsk returns the highest bid and lowest ask for a synchronized book
+func (m *OrderBookManager) BestBidAsk(symbol string) (float64, float64, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	book, ok := m.books[symbol]
+	if !ok || !book.ready {
+		return 0, 0, false
+	}
+
+	bid, ask := book.bestBidAsk()
+	return bid, ask, bid > 0 && ask > 0
+}
+
+// DepthWithin returns the quote notional resting on each side within the
+// given number of basis points of the mid price
+func (m *OrderBookManager) DepthWithin(symbol string, bps float64) (float64, float64, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	book, ok := m.books[symbol]
+	if !ok || !book.ready {
+		return 0, 0, false
+	}
+
+	bid, ask := book.bestBidAsk()
+	if bid <= 0 || ask <= 0 {
+		return 0, 0, false
+	}
+
+	mid := (bid + ask) / 2
+	band := mid * bps / 10000
+
+	bidDepth := 0.0
+	for price, size := range book.bids {
+		if price >= mid-band {
+			bidDepth += price * size
+		}
+	}
+
+	askDepth := 0.0
+	for price, size := range book.asks {
+		if price <= mid+band {
+			askDepth += price * size
+		}
+	}
+
+	return bidDepth, askDepth, true
+}
+
+func (b *orderBook) loadSnapshot(snapshot *kucoin.OrderBookSnapshot) error {
+	sequence, err := strconv.ParseInt(snapshot.Sequence, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid snapshot sequence %q: %w", snapshot.Sequence, err)
+	}
+
+	b.sequence = sequence
+	b.bids = make(map[float64]float64, len(snapshot.Bids))
+	b.asks = make(map[float64]float64, len(snapshot.Asks))
+
+	for _, level := range snapshot.Bids {
+		if price, size, ok := parseLevel(level); ok && size > 0 {
+			b.bids[price] = size
+		}
+	}
+	for _, level := range snapshot.Asks {
+		if price, size, ok := parseLevel(level); ok && size > 0 {
+			b.asks[price] = size
+		}
+	}
+
+	return nil
+}
+
+// apply applies a diff on top of the book. Diffs entirely at or below the
+// book's sequence are stale and ignored; a diff starting beyond the next
+// sequence means updates were missed.
+func (b *orderBook) apply(update kucoin.Level2Update) error {
+	if update.SequenceEnd <= b.sequence {
+		return nil
+	}
+	if update.SequenceStart > b.sequence+1 {
+		return errSequenceGap
+	}
+
+	applyChanges(b.bids, update.Changes.Bids, b.sequence)
+	applyChanges(b.asks, update.Changes.Asks, b.sequence)
+	b.sequence = update.SequenceEnd
+
+	return nil
+}
+
+func (b *orderBook) bestBidAsk() (float64, float64) {
+	bid := 0.0
+	for price := range b.bids {
+		if price > bid {
+			bid = price
+		}
+	}
+
+	ask := 0.0
+	for price := range b.asks {
+		if ask == 0 || price < ask {
+			ask = price
+		}
+	}
+
+	return bid, ask
+}
+
+// applyChanges sets or removes price levels; a zero size removes the level.
+// Changes already reflected in the book are skipped by their own sequence.
+func applyChanges(levels map[float64]float64, changes [][]string, bookSequence int64) {
+	for _, change := range changes {
+		if len(change) >= 3 {
+			if sequence, err := strconv.ParseInt(change[2], 10, 64); err == nil && sequence <= bookSequence {
+				continue
+			}
+		}
+
+		price, size, ok := parseLevel(change)
+		if !ok || price == 0 {
+			continue
+		}
+
+		if size == 0 {
+			delete(levels, price)
+		} else {
+			levels[price] = size
+		}
+	}
+}
+
+func parseLevel(level []string) (float64, float64, bool) {
+	if len(level) < 2 {
+		return 0, 0, false
+	}
+
+	price, err := strconv.ParseFloat(level[0], 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	size, err := strconv.ParseFloat(level[1], 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return price, size, true
+}
@@ -0,0 +1,122 @@
+package marketdata
+
+import (
+	"testing"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+)
+
+func snapshotAt(sequence string) *kucoin.OrderBookSnapshot {
+	return &kucoin.OrderBookSnapshot{
+		Sequence: sequence,
+		Bids:     [][]string{{"99", "1"}, {"98", "2"}},
+		Asks:     [][]string{{"101", "1"}, {"102", "3"}},
+	}
+}
+
+func diff(start, end int64, bids, asks [][]string) kucoin.Level2Update {
+	return kucoin.Level2Update{
+		Symbol:        "BTC-USDT",
+		SequenceStart: start,
+		SequenceEnd:   end,
+		Changes:       kucoin.Level2Changes{Bids: bids, Asks: asks},
+	}
+}
+
+// newSyncedManager returns a manager holding a BTC-USDT book synchronized at
+// sequence 100
+func newSyncedManager(t *testing.T) *OrderBookManager {
+	t.Helper()
+
+	m := NewOrderBookManager(nil, nil, 0, nil, utils.NewDiscardLogger())
+	m.resetBooks([]string{"BTC-USDT"})
+
+	book := m.books["BTC-USDT"]
+	if err := book.loadSnapshot(snapshotAt("100")); err != nil {
+		t.Fatalf("loadSnapshot() error = %v", err)
+	}
+	book.ready = true
+	return m
+}
+
+func TestOrderBookAppliesDiffs(t *testing.T) {
+	m := newSyncedManager(t)
+
+	// A better bid, the best ask removed and a diff already in the snapshot
+	m.handleUpdate(diff(101, 101, [][]string{{"100", "2", "101"}}, nil))
+	m.handleUpdate(diff(102, 102, nil, [][]string{{"101", "0", "102"}}))
+	m.handleUpdate(diff(90, 95, [][]string{{"150", "5", "95"}}, nil))
+
+	bid, ask, ok := m.BestBidAsk("BTC-USDT")
+	if !ok {
+		t.Fatal("BestBidAsk() not ok for a synchronized book")
+	}
+	if bid != 100 || ask != 102 {
+		t.Fatalf("BestBidAsk() = %v/%v, want 100/102", bid, ask)
+	}
+	if got := m.books["BTC-USDT"].sequence; got != 102 {
+		t.Errorf("sequence = %d, want 102", got)
+	}
+
+	// Within 100 bps of the 101 mid: bids at 100 (200) and asks at 102 (306)
+	bidDepth, askDepth, ok := m.DepthWithin("BTC-USDT", 100)
+	if !ok || bidDepth != 200 || askDepth != 306 {
+		t.Errorf("DepthWithin() = %v/%v/%v, want 200/306/true", bidDepth, askDepth, ok)
+	}
+}
+
+func TestOrderBookGapTriggersResync(t *testing.T) {
+	m := newSyncedManager(t)
+
+	gapped := diff(105, 106, [][]string{{"100", "1", "105"}}, nil)
+	m.handleUpdate(gapped)
+
+	if _, _, ok := m.BestBidAsk("BTC-USDT"); ok {
+		t.Fatal("BestBidAsk() ok after a sequence gap, want the book marked unsynchronized")
+	}
+
+	select {
+	case symbol := <-m.resync:
+		if symbol != "BTC-USDT" {
+			t.Fatalf("resync requested for %s, want BTC-USDT", symbol)
+		}
+	default:
+		t.Fatal("no resync requested after a sequence gap")
+	}
+
+	book := m.books["BTC-USDT"]
+	if len(book.buffered) != 1 || book.buffered[0].SequenceStart != 105 {
+		t.Fatalf("buffered = %+v, want the gapped diff kept for replay", book.buffered)
+	}
+
+	// The resync snapshot covers the gap; the buffered diff continues it
+	if err := book.loadSnapshot(snapshotAt("104")); err != nil {
+		t.Fatalf("loadSnapshot() error = %v", err)
+	}
+	for _, update := range book.buffered {
+		if err := book.apply(update); err != nil {
+			t.Fatalf("replaying buffered diff: %v", err)
+		}
+	}
+	book.ready = true
+
+	bid, _, ok := m.BestBidAsk("BTC-USDT")
+	if !ok || bid != 100 {
+		t.Fatalf("BestBidAsk() bid = %v ok = %v after resync, want 100 true", bid, ok)
+	}
+}
+
+func TestOrderBookBuffersUntilSnapshot(t *testing.T) {
+	m := NewOrderBookManager(nil, nil, 0, nil, utils.NewDiscardLogger())
+	m.resetBooks([]string{"BTC-USDT"})
+
+	m.handleUpdate(diff(101, 101, [][]string{{"100", "1", "101"}}, nil))
+
+	if _, _, ok := m.BestBidAsk("BTC-USDT"); ok {
+		t.Fatal("BestBidAsk() ok before a snapshot was loaded")
+	}
+	if got := len(m.books["BTC-USDT"].buffered); got != 1 {
+		t.Fatalf("buffered %d diffs, want 1", got)
+	}
+}
@@ -0,0 +1,80 @@
+package marketdata
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/sirupsen/logrus"
+)
+
+// LivePrices quotes the current best bid and ask for pricing orders. A
+// synchronized streamed order book answers without a request; otherwise the
+// REST level 1 ticker is fetched and cached briefly, so several orders placed
+// for a symbol within one cycle share a single request.
+type LivePrices struct {
+	client *kucoin.Client
+	books  *OrderBookManager // nil uses the REST ticker only
+	ttl    time.Duration
+	logger *logrus.Logger
+
+	mu     sync.Mutex
+	quotes map[string]liveQuote
+}
+
+type liveQuote struct {
+	bid       float64
+	ask       float64
+	fetchedAt time.Time
+}
+
+func NewLivePrices(client *kucoin.Client, books *OrderBookManager, ttl time.Duration, logger *logrus.Logger) *LivePrices {
+	return &LivePrices{
+		client: client,
+		books:  books,
+		ttl:    ttl,
+		logger: logger,
+		quotes: make(map[string]liveQuote),
+	}
+}
+
+// Quote returns the best bid and ask for the symbol
+func (p *LivePrices) Quote(symbol string) (float64, float64, error) {
+	if p.books != nil {
+		if bid, ask, ok := p.books.BestBidAsk(symbol); ok {
+			return bid, ask, nil
+		}
+	}
+
+	p.mu.Lock()
+	quote, ok := p.quotes[symbol]
+	p.mu.Unlock()
+	if ok && time.Since(quote.fetchedAt) < p.ttl {
+		return quote.bid, quote.ask, nil
+	}
+
+	ticker, err := p.client.GetLevel1Ticker(symbol)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get ticker for %s: %w", symbol, err)
+	}
+
+	bid, err := strconv.ParseFloat(ticker.BestBid, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid best bid %q for %s: %w", ticker.BestBid, symbol, err)
+	}
+	ask, err := strconv.ParseFloat(ticker.BestAsk, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid best ask %q for %s: %w", ticker.BestAsk, symbol, err)
+	}
+	if bid <= 0 || ask <= 0 {
+		return 0, 0, fmt.Errorf("empty book for %s", symbol)
+	}
+
+	p.mu.Lock()
+	p.quotes[symbol] = liveQuote{bid: bid, ask: ask, fetchedAt: time.Now()}
+	p.mu.Unlock()
+
+	return bid, ask, nil
+}
@@ -0,0 +1,64 @@
+package pricing
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const BinanceBaseURL = "https://api.binance.com"
+
+// BinanceSource reads last trade prices from Binance's public ticker endpoint
+type BinanceSource struct {
+	client *resty.Client
+}
+
+type binanceTicker struct {
+	Symbol string `json:"symbol"`
+	Price  string `json:"price"`
+}
+
+func NewBinanceSource() *BinanceSource {
+	client := resty.New()
+	client.SetBaseURL(BinanceBaseURL)
+	client.SetTimeout(5 * time.Second)
+
+	return &BinanceSource{client: client}
+}
+
+func (b *BinanceSource) Name() string {
+	return "binance"
+}
+
+func (b *BinanceSource) GetPrice(ctx context.Context, symbol string) (float64, error) {
+	var ticker binanceTicker
+
+	resp, err := b.client.R().
+		SetContext(ctx).
+		SetQueryParam("symbol", binanceSymbol(symbol)).
+		SetResult(&ticker).
+		Get("/api/v3/ticker/price")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get binance ticker: %w", err)
+	}
+
+	if resp.StatusCode() != 200 {
+		return 0, fmt.Errorf("binance ticker returned status %d", resp.StatusCode())
+	}
+
+	price, err := strconv.ParseFloat(ticker.Price, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse binance price %q: %w", ticker.Price, err)
+	}
+
+	return price, nil
+}
+
+// binanceSymbol converts a KuCoin symbol (BTC-USDT) to Binance form (BTCUSDT)
+func binanceSymbol(symbol string) string {
+	return strings.ReplaceAll(symbol, "-", "")
+}
@@ -0,0 +1,158 @@
+package pricing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// AccountingCurrency is the currency positions and PnL are recorded in
+const AccountingCurrency = "USDT"
+
+const ExchangeRateBaseURL = "https://open.er-api.com"
+
+// FiatRateSource quotes how many units of a fiat currency one USDT is worth
+type FiatRateSource interface {
+	Name() string
+	GetRate(ctx context.Context, currency string) (float64, error)
+}
+
+// StaticRateSource returns a fixed, operator-configured rate
+type StaticRateSource struct {
+	rate float64
+}
+
+func NewStaticRateSource(rate float64) *StaticRateSource {
+	return &StaticRateSource{rate: rate}
+}
+
+func (s *StaticRateSource) Name() string {
+	return "static"
+}
+
+func (s *StaticRateSource) GetRate(ctx context.Context, currency string) (float64, error) {
+	if s.rate <= 0 {
+		return 0, fmt.Errorf("static rate for %s is not configured", currency)
+	}
+	return s.rate, nil
+}
+
+// ExchangeRateSource reads daily USD rates from the public open.er-api.com
+// endpoint. USDT is treated as trading at par with USD.
+type ExchangeRateSource struct {
+	client *resty.Client
+}
+
+type exchangeRateResponse struct {
+	Result string             `json:"result"`
+	Rates  map[string]float64 `json:"rates"`
+}
+
+func NewExchangeRateSource() *ExchangeRateSource {
+	client := resty.New()
+	client.SetBaseURL(ExchangeRateBaseURL)
+	client.SetTimeout(5 * time.Second)
+
+	return &ExchangeRateSource{client: client}
+}
+
+func (e *ExchangeRateSource) Name() string {
+	return "exchangerate"
+}
+
+func (e *ExchangeRateSource) GetRate(ctx context.Context, currency string) (float64, error) {
+	var body exchangeRateResponse
+
+	resp, err := e.client.R().
+		SetContext(ctx).
+		SetResult(&body).
+		Get("/v6/latest/USD")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get exchange rates: %w", err)
+	}
+
+	if resp.StatusCode() != 200 || body.Result != "success" {
+		return 0, fmt.Errorf("exchange rates returned status %d (%s)", resp.StatusCode(), body.Result)
+	}
+
+	rate, ok := body.Rates[strings.ToUpper(currency)]
+	if !ok || rate <= 0 {
+		return 0, fmt.Errorf("no exchange rate for %s", currency)
+	}
+
+	return rate, nil
+}
+
+// Conversion describes how the amounts in a report were converted for
+// display. Fallback is set when the rate could not be obtained and amounts
+// were left in the accounting currency.
+type Conversion struct {
+	Currency string
+	Rate     float64
+	Fallback bool
+}
+
+// Apply converts an amount in the accounting currency for display
+func (c Conversion) Apply(amount float64) float64 {
+	return amount * c.Rate
+}
+
+// DisplayConverter converts reported amounts into the operator's display
+// currency. Only reports are converted; positions, orders and risk limits
+// stay in the accounting currency. Rates are cached for the TTL so report
+// requests do not each hit the rate source.
+type DisplayConverter struct {
+	source   FiatRateSource
+	currency string
+	ttl      time.Duration
+	logger   *logrus.Logger
+
+	mu        sync.Mutex
+	rate      float64
+	fetchedAt time.Time
+}
+
+func NewDisplayConverter(source FiatRateSource, currency string, ttl time.Duration, logger *logrus.Logger) *DisplayConverter {
+	return &DisplayConverter{
+		source:   source,
+		currency: strings.ToUpper(currency),
+		ttl:      ttl,
+		logger:   logger,
+	}
+}
+
+// Conversion returns the rate to apply to the current report. A nil
+// converter, or one configured for the accounting currency, converts at 1.
+func (c *DisplayConverter) Conversion(ctx context.Context) Conversion {
+	identity := Conversion{Currency: AccountingCurrency, Rate: 1}
+	if c == nil || c.currency == "" || c.currency == AccountingCurrency {
+		return identity
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.rate > 0 && time.Since(c.fetchedAt) < c.ttl {
+		return Conversion{Currency: c.currency, Rate: c.rate}
+	}
+
+	rate, err := c.source.GetRate(ctx, c.currency)
+	if err != nil {
+		c.logger.WithError(err).WithFields(logrus.Fields{
+			"currency": c.currency,
+			"source":   c.source.Name(),
+		}).Warn("Failed to get display currency rate, reporting in USDT")
+		identity.Fallback = true
+		return identity
+	}
+
+	c.rate = rate
+	c.fetchedAt = time.Now()
+
+	return Conversion{Currency: c.currency, Rate: rate}
+}
@@ -0,0 +1,80 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+)
+
+// fakeRates quotes a fixed rate, or fails with err, and counts the requests
+type fakeRates struct {
+	rate  float64
+	err   error
+	calls int
+}
+
+func (f *fakeRates) Name() string {
+	return "fake"
+}
+
+func (f *fakeRates) GetRate(_ context.Context, _ string) (float64, error) {
+	f.calls++
+	return f.rate, f.err
+}
+
+func TestDisplayConversionOfKnownPnL(t *testing.T) {
+	const pnl = 250.0 // USDT
+
+	tests := []struct {
+		name         string
+		currency     string
+		source       *fakeRates
+		wantCurrency string
+		wantFallback bool
+		wantPnL      float64
+	}{
+		{name: "converted at the quoted rate", currency: "eur", source: &fakeRates{rate: 0.92}, wantCurrency: "EUR", wantPnL: 230},
+		{name: "failed rate falls back to USDT", currency: "EUR", source: &fakeRates{err: errors.New("rate source down")}, wantCurrency: AccountingCurrency, wantFallback: true, wantPnL: 250},
+		{name: "accounting currency is not converted", currency: "USDT", source: &fakeRates{rate: 0.92}, wantCurrency: AccountingCurrency, wantPnL: 250},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converter := NewDisplayConverter(tt.source, tt.currency, time.Hour, utils.NewDiscardLogger())
+			conversion := converter.Conversion(context.Background())
+
+			if conversion.Currency != tt.wantCurrency || conversion.Fallback != tt.wantFallback {
+				t.Errorf("conversion = %+v, want %s with fallback %v", conversion, tt.wantCurrency, tt.wantFallback)
+			}
+			if got := conversion.Apply(pnl); math.Abs(got-tt.wantPnL) > 1e-9 {
+				t.Errorf("converted PnL = %v, want %v", got, tt.wantPnL)
+			}
+		})
+	}
+}
+
+func TestDisplayConverterCachesRate(t *testing.T) {
+	source := &fakeRates{rate: 0.92}
+	converter := NewDisplayConverter(source, "EUR", time.Hour, utils.NewDiscardLogger())
+
+	converter.Conversion(context.Background())
+	source.rate = 0.95
+	conversion := converter.Conversion(context.Background())
+
+	if source.calls != 1 || conversion.Rate != 0.92 {
+		t.Errorf("rate = %v after %d requests, want the cached 0.92 from one request", conversion.Rate, source.calls)
+	}
+}
+
+func TestNilDisplayConverterReportsUSDT(t *testing.T) {
+	var converter *DisplayConverter
+
+	conversion := converter.Conversion(context.Background())
+	if conversion.Currency != AccountingCurrency || conversion.Rate != 1 || conversion.Fallback {
+		t.Errorf("conversion = %+v, want USDT at 1", conversion)
+	}
+}
@@ -0,0 +1,100 @@
+package pricing
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// PriceSource provides an independent quote for a symbol that KuCoin prices
+// can be compared against
+type PriceSource interface {
+	Name() string
+	GetPrice(ctx context.Context, symbol string) (float64, error)
+}
+
+type DivergenceResult struct {
+	Symbol         string
+	Price          float64
+	ReferencePrice float64
+	Divergence     float64 // Relative difference between price and reference
+	Sources        int     // Number of sources that contributed to the reference
+	Diverged       bool
+}
+
+type ReferenceChecker struct {
+	sources       []PriceSource
+	maxDivergence float64
+	logger        *logrus.Logger
+}
+
+func NewReferenceChecker(sources []PriceSource, maxDivergence float64, logger *logrus.Logger) *ReferenceChecker {
+	return &ReferenceChecker{
+		sources:       sources,
+		maxDivergence: maxDivergence,
+		logger:        logger,
+	}
+}
+
+// Check compares the price against the median quote of the reference sources.
+// Sources that fail are skipped; an error is returned only when none of them
+// produced a usable quote.
+func (c *ReferenceChecker) Check(ctx context.Context, symbol string, price float64) (DivergenceResult, error) {
+	result := DivergenceResult{
+		Symbol: symbol,
+		Price:  price,
+	}
+
+	var quotes []float64
+	for _, source := range c.sources {
+		quote, err := source.GetPrice(ctx, symbol)
+		if err != nil {
+			c.logger.WithError(err).WithFields(logrus.Fields{
+				"symbol": symbol,
+				"source": source.Name(),
+			}).Debug("Reference price source failed")
+			continue
+		}
+		if quote <= 0 {
+			continue
+		}
+		quotes = append(quotes, quote)
+	}
+
+	if len(quotes) == 0 {
+		return result, fmt.Errorf("no reference price available for %s", symbol)
+	}
+
+	result.ReferencePrice = median(quotes)
+	result.Sources = len(quotes)
+	result.Divergence = math.Abs(price-result.ReferencePrice) / result.ReferencePrice
+	result.Diverged = result.Divergence > c.maxDivergence
+
+	if result.Diverged {
+		c.logger.WithFields(logrus.Fields{
+			"symbol":          symbol,
+			"price":           price,
+			"reference_price": result.ReferencePrice,
+			"divergence":      result.Divergence,
+			"max_divergence":  c.maxDivergence,
+			"sources":         result.Sources,
+		}).Warn("Price diverges from reference sources")
+	}
+
+	return result, nil
+}
+
+func median(values []float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,94 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+)
+
+// fakeSource quotes a fixed price, or fails with err
+type fakeSource struct {
+	name  string
+	price float64
+	err   error
+}
+
+func (s fakeSource) Name() string {
+	return s.name
+}
+
+func (s fakeSource) GetPrice(_ context.Context, _ string) (float64, error) {
+	return s.price, s.err
+}
+
+func TestReferenceCheckerDivergence(t *testing.T) {
+	failing := errors.New("source down")
+
+	tests := []struct {
+		name          string
+		sources       []PriceSource
+		price         float64
+		wantReference float64
+		wantSources   int
+		wantDiverged  bool
+		wantErr       bool
+	}{
+		{
+			name:          "agreeing sources",
+			sources:       []PriceSource{fakeSource{name: "a", price: 100}, fakeSource{name: "b", price: 100.4}},
+			price:         100.5,
+			wantReference: 100.2,
+			wantSources:   2,
+		},
+		{
+			name:          "price diverges from both sources",
+			sources:       []PriceSource{fakeSource{name: "a", price: 100}, fakeSource{name: "b", price: 100}},
+			price:         103,
+			wantReference: 100,
+			wantSources:   2,
+			wantDiverged:  true,
+		},
+		{
+			name:          "failed source is skipped",
+			sources:       []PriceSource{fakeSource{name: "a", err: failing}, fakeSource{name: "b", price: 100}},
+			price:         99.5,
+			wantReference: 100,
+			wantSources:   1,
+		},
+		{
+			name:    "no usable source",
+			sources: []PriceSource{fakeSource{name: "a", err: failing}, fakeSource{name: "b", price: 0}},
+			price:   100,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewReferenceChecker(tt.sources, 0.01, utils.NewDiscardLogger())
+
+			result, err := checker.Check(context.Background(), "BTC-USDT", tt.price)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Check() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+
+			if result.ReferencePrice != tt.wantReference {
+				t.Errorf("ReferencePrice = %v, want %v", result.ReferencePrice, tt.wantReference)
+			}
+			if result.Sources != tt.wantSources {
+				t.Errorf("Sources = %d, want %d", result.Sources, tt.wantSources)
+			}
+			if result.Diverged != tt.wantDiverged {
+				t.Errorf("Diverged = %v (divergence %v), want %v", result.Diverged, result.Divergence, tt.wantDiverged)
+			}
+		})
+	}
+}
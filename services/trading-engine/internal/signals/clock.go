@@ -0,0 +1,17 @@
+package signals
+
+import "time"
+
+// Clock supplies the current time. Signals are timestamped and price history
+// windows are measured from it, so a historical replay can run the generator
+// on simulated time.
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock is the wall clock
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
@@ -2,60 +2,339 @@ package signals
 
 import (
 	"context"
-	"math/rand"
+	"fmt"
+	"math"
 	"time"
 
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
 	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
 	"github.com/sirupsen/logrus"
 )
 
-type Generator struct {
-	logger *logrus.Logger
+// PriceHistoryProvider supplies the candles indicators are calculated from
+type PriceHistoryProvider interface {
+	GetPriceHistory(ctx context.Context, symbol string, since time.Time) ([]models.Candle, error)
 }
 
-func NewGenerator(logger *logrus.Logger) *Generator {
-	return &Generator{logger: logger}
+type Config struct {
+	PriceDataIntervalMinutes int
+	LookbackPeriods          int
+	ResampleCandles          bool // Aggregate stored candles into PriceDataIntervalMinutes candles before calculating indicators
+	RSIPeriod                int
+	RSIOversold              float64
+	RSIOverbought            float64
+	AdaptiveRSI              bool    // Shift RSI thresholds with the detected market regime
+	AdaptiveRSIShift         float64 // RSI points the thresholds move by in trending/volatile regimes
+	VolatilityModel          string  // VolatilityModelClose or VolatilityModelTrueRange for regime detection
+
+	MaxDataAge time.Duration // Newest candle age beyond which no signal is generated; 0 disables
+
+	MaxVolumeRatio        float64 // Cap on current over average volume in the confirmation; 0 leaves it uncapped
+	MinConfirmationVolume float64 // Quote volume the current candle needs before it can confirm; 0 disables
+
+	BollingerWeight float64 // Weight of the Bollinger Band component in the score; 0 disables
+
+	Clock Clock // Source of the current time; nil uses RealClock
 }
 
-func (g *Generator) GenerateSignal(ctx context.Context, symbol string, currentPrice float64) models.Signal {
-	// Simple signal generation logic - in practice, this would use technical indicators
-	// For now, we'll use a basic random walk with bias towards mean reversion
+type Generator struct {
+	priceHistory PriceHistoryProvider
+	clock        Clock
+	logger       *logrus.Logger
+
+	priceDataIntervalMinutes int
+	lookbackPeriods          int
+	resampleCandles          bool
+
+	rsiPeriod        int
+	rsiOversold      float64
+	rsiOverbought    float64
+	adaptiveRSI      bool
+	adaptiveRSIShift float64
+	volatilityModel  string
 
-	action := "HOLD"
-	strength := 0.5
-	reason := "neutral market conditions"
+	maxDataAge time.Duration
 
-	// Simple random signal for demonstration
-	// In production, this would analyze price patterns, volume, etc.
-	randomValue := rand.Float64()
+	maxVolumeRatio        float64
+	minConfirmationVolume float64
 
-	if randomValue < 0.3 {
-		action = "BUY"
-		strength = randomValue + 0.5
-		reason = "price below moving average"
-	} else if randomValue > 0.7 {
-		action = "SELL"
-		strength = (1.0 - randomValue) + 0.3
-		reason = "price above moving average"
+	smaShortPeriod int
+	smaLongPeriod  int
+	atrPeriod      int
+	volumePeriod   int
+	bbandsPeriod   int
+
+	rsiWeight      float64
+	trendWeight    float64
+	volumeWeight   float64
+	bbandsWeight   float64
+	trendThreshold float64 // Relative SMA separation treated as a full-strength trend
+	highVolatility float64 // Per-candle return volatility treated as a volatile regime
+	buyThreshold   float64
+	sellThreshold  float64
+}
+
+func NewGenerator(priceHistory PriceHistoryProvider, config Config, logger *logrus.Logger) *Generator {
+	g := &Generator{
+		priceHistory:             priceHistory,
+		clock:                    config.Clock,
+		logger:                   logger,
+		priceDataIntervalMinutes: config.PriceDataIntervalMinutes,
+		lookbackPeriods:          config.LookbackPeriods,
+		resampleCandles:          config.ResampleCandles,
+		rsiPeriod:                config.RSIPeriod,
+		rsiOversold:              config.RSIOversold,
+		rsiOverbought:            config.RSIOverbought,
+		adaptiveRSI:              config.AdaptiveRSI,
+		adaptiveRSIShift:         config.AdaptiveRSIShift,
+		volatilityModel:          config.VolatilityModel,
+		maxDataAge:               config.MaxDataAge,
+		maxVolumeRatio:           config.MaxVolumeRatio,
+		minConfirmationVolume:    config.MinConfirmationVolume,
+		smaShortPeriod:           20,
+		smaLongPeriod:            50,
+		atrPeriod:                14,
+		volumePeriod:             20,
+		bbandsPeriod:             20,
+		rsiWeight:                0.7,
+		trendWeight:              0.3,
+		volumeWeight:             0.2,
+		bbandsWeight:             config.BollingerWeight,
+		trendThreshold:           0.02,
+		highVolatility:           0.03,
+		buyThreshold:             0.3,
+		sellThreshold:            0.3,
+	}
+
+	// Fall back to conventional defaults for anything left unset
+	if g.clock == nil {
+		g.clock = RealClock{}
+	}
+	if g.priceDataIntervalMinutes <= 0 {
+		g.priceDataIntervalMinutes = 60
+	}
+	if g.lookbackPeriods <= 0 {
+		g.lookbackPeriods = 100
+	}
+	if g.rsiPeriod <= 0 {
+		g.rsiPeriod = 14
+	}
+	if g.rsiOversold <= 0 {
+		g.rsiOversold = 30
+	}
+	if g.rsiOverbought <= 0 {
+		g.rsiOverbought = 70
 	}
 
+	return g
+}
+
+func (g *Generator) GenerateSignal(ctx context.Context, symbol string, currentPrice float64) models.Signal {
 	signal := models.Signal{
 		Symbol:    symbol,
-		Action:    action,
+		Action:    "HOLD",
 		Price:     currentPrice,
-		Strength:  strength,
-		Timestamp: time.Now(),
-		Reason:    reason,
+		Strength:  0.0,
+		Timestamp: g.getCurrentTime(),
+		Reason:    "neutral market conditions",
+		Metadata:  map[string]interface{}{},
+	}
+
+	since := g.getCurrentTime().Add(-time.Duration(g.lookbackPeriods*g.priceDataIntervalMinutes) * time.Minute)
+	candles, err := g.priceHistory.GetPriceHistory(ctx, symbol, since)
+	if err != nil {
+		g.logger.WithError(err).WithField("symbol", symbol).Warn("Failed to get price history for signal generation")
+		signal.Reason = "price history unavailable"
+		return signal
+	}
+
+	if len(candles) == 0 {
+		signal.Reason = "insufficient price history"
+		signal.Metadata["candles"] = 0
+		return signal
+	}
+
+	// A stalled collector leaves the window ending in the past; indicators
+	// computed from it would describe a market that has since moved. Checked
+	// before resampling, which moves timestamps back to the interval start.
+	if newest := newestCandle(candles); g.maxDataAge > 0 && signal.Timestamp.Sub(newest) > g.maxDataAge {
+		g.logger.WithFields(logrus.Fields{
+			"symbol":        symbol,
+			"newest_candle": newest,
+			"max_data_age":  g.maxDataAge,
+		}).Warn("Price data is stale, holding")
+		metrics.StaleSignals.WithLabelValues(symbol).Inc()
+		signal.Reason = "stale data"
+		signal.Metadata["newest_candle"] = newest
+		return signal
+	}
+
+	// The collector stores minute candles; indicator periods are counted in
+	// the configured interval
+	if g.resampleCandles {
+		candles = ResampleCandles(candles, time.Duration(g.priceDataIntervalMinutes)*time.Minute)
+	}
+
+	if len(candles) < g.minimumCandles() {
+		signal.Reason = "insufficient price history"
+		signal.Metadata["candles"] = len(candles)
+		return signal
+	}
+
+	indicators := g.CalculateTechnicalIndicators(candles)
+	regime := g.detectRegime(indicators)
+	oversold, overbought := g.rsiThresholds(regime)
+
+	// Mean-reversion component from RSI
+	rsiComponent := 0.0
+	if indicators.RSI <= oversold {
+		rsiComponent = 0.5 + 0.5*(oversold-indicators.RSI)/oversold
+	} else if indicators.RSI >= overbought {
+		rsiComponent = -(0.5 + 0.5*(indicators.RSI-overbought)/(100-overbought))
+	}
+
+	// Trend component from short/long moving average separation
+	trendComponent := 0.0
+	if indicators.SMALong > 0 {
+		trendComponent = clamp((indicators.SMAShort-indicators.SMALong)/indicators.SMALong/g.trendThreshold, -1, 1)
+	}
+
+	// Mean-reversion component from the price's position outside the bands,
+	// growing to full strength a whole band width beyond them
+	bandComponent := 0.0
+	if width := indicators.BollingerUp - indicators.BollingerLow; g.bbandsWeight > 0 && width > 0 {
+		if currentPrice < indicators.BollingerLow {
+			bandComponent = 0.5 + 0.5*clamp((indicators.BollingerLow-currentPrice)/width, 0, 1)
+		} else if currentPrice > indicators.BollingerUp {
+			bandComponent = -(0.5 + 0.5*clamp((currentPrice-indicators.BollingerUp)/width, 0, 1))
+		}
 	}
 
+	score := g.rsiWeight*rsiComponent + g.trendWeight*trendComponent + g.bbandsWeight*bandComponent
+
+	// Volume confirmation amplifies the score when activity is above average
+	volumeRatio, volumeFactor := g.volumeConfirmation(indicators)
+	score *= volumeFactor
+
+	score = clamp(score, -1, 1)
+
+	switch {
+	case score >= g.buyThreshold:
+		signal.Action = "BUY"
+		signal.Reason = fmt.Sprintf("RSI %.1f vs oversold %.1f in %s regime", indicators.RSI, oversold, regime)
+	case score <= -g.sellThreshold:
+		signal.Action = "SELL"
+		signal.Reason = fmt.Sprintf("RSI %.1f vs overbought %.1f in %s regime", indicators.RSI, overbought, regime)
+	}
+	signal.Strength = math.Abs(score)
+
+	signal.Metadata["rsi"] = indicators.RSI
+	signal.Metadata["rsi_oversold"] = oversold
+	signal.Metadata["rsi_overbought"] = overbought
+	signal.Metadata["adaptive_rsi"] = g.adaptiveRSI
+	signal.Metadata["regime"] = regime
+	signal.Metadata["sma_short"] = indicators.SMAShort
+	signal.Metadata["sma_long"] = indicators.SMALong
+	signal.Metadata["bollinger_up"] = indicators.BollingerUp
+	signal.Metadata["bollinger_low"] = indicators.BollingerLow
+	signal.Metadata["volume_ratio"] = volumeRatio
+	signal.Metadata["score"] = score
+
 	g.logger.WithFields(logrus.Fields{
-		"symbol":   symbol,
-		"action":   action,
-		"strength": strength,
-		"price":    currentPrice,
-		"reason":   reason,
+		"symbol":         symbol,
+		"action":         signal.Action,
+		"strength":       signal.Strength,
+		"price":          currentPrice,
+		"rsi":            indicators.RSI,
+		"rsi_oversold":   oversold,
+		"rsi_overbought": overbought,
+		"regime":         regime,
+		"reason":         signal.Reason,
 	}).Debug("Generated trading signal")
 
 	return signal
+}
+
+// volumeConfirmation returns the current over average volume ratio and the
+// factor it scales the score by. The ratio is capped and the candle must
+// trade a minimum quote volume, so one spike on an otherwise idle pair cannot
+// dominate the score.
+func (g *Generator) volumeConfirmation(indicators TechnicalIndicators) (float64, float64) {
+	if indicators.AvgVolume <= 0 {
+		return 0, 1
+	}
+
+	volumeRatio := indicators.CurrentVolume / indicators.AvgVolume
+	if g.maxVolumeRatio > 0 && volumeRatio > g.maxVolumeRatio {
+		volumeRatio = g.maxVolumeRatio
+	}
+	if volumeRatio > 1 && indicators.CurrentVolume*indicators.LastClose >= g.minConfirmationVolume {
+		return volumeRatio, 1 + g.volumeWeight*(volumeRatio-1)
+	}
+	return volumeRatio, 1
+}
+
+// rsiThresholds returns the oversold/overbought levels for the given regime.
+// In a trend RSI tends to stay pinned near one extreme, so both levels move in
+// the trend direction; volatile markets widen the band and quiet ranges
+// tighten it. With adaptive RSI disabled the static thresholds are returned.
+func (g *Generator) rsiThresholds(regime string) (float64, float64) {
+	oversold, overbought := g.rsiOversold, g.rsiOverbought
+	if !g.adaptiveRSI {
+		return oversold, overbought
+	}
+
+	shift := g.adaptiveRSIShift
+	switch regime {
+	case RegimeTrendingUp:
+		oversold += shift
+		overbought += shift
+	case RegimeTrendingDown:
+		oversold -= shift
+		overbought -= shift
+	case RegimeVolatile:
+		oversold -= shift / 2
+		overbought += shift / 2
+	case RegimeRanging:
+		oversold += shift / 2
+		overbought -= shift / 2
+	}
 
+	return clamp(oversold, 5, 50), clamp(overbought, 50, 95)
+}
+
+func (g *Generator) minimumCandles() int {
+	minimum := g.smaLongPeriod
+	if g.rsiPeriod+1 > minimum {
+		minimum = g.rsiPeriod + 1
+	}
+	return minimum
+}
+
+// getCurrentTime reads the configured clock, which a historical replay
+// replaces with simulated time
+func (g *Generator) getCurrentTime() time.Time {
+	return g.clock.Now()
+}
+
+// newestCandle returns the latest candle timestamp without assuming the
+// candles are ordered
+func newestCandle(candles []models.Candle) time.Time {
+	var newest time.Time
+	for _, candle := range candles {
+		if candle.Timestamp.After(newest) {
+			newest = candle.Timestamp
+		}
+	}
+	return newest
+}
+
+func clamp(value, min, max float64) float64 {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
 }
@@ -0,0 +1,348 @@
+package signals
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// staticHistory serves the same candles for every symbol
+type staticHistory []models.Candle
+
+func (h staticHistory) GetPriceHistory(_ context.Context, _ string, since time.Time) ([]models.Candle, error) {
+	var candles []models.Candle
+	for _, candle := range h {
+		if !candle.Timestamp.Before(since) {
+			candles = append(candles, candle)
+		}
+	}
+	return candles, nil
+}
+
+// candleSeries builds hourly candles ending an hour before now, one per
+// close, with a constant volume
+func candleSeries(now time.Time, closes []float64) staticHistory {
+	candles := make(staticHistory, len(closes))
+	start := now.Add(-time.Duration(len(closes)) * time.Hour)
+	for i, price := range closes {
+		candles[i] = models.Candle{
+			Timestamp: start.Add(time.Duration(i) * time.Hour),
+			Open:      price,
+			High:      price * 1.001,
+			Low:       price * 0.999,
+			Close:     price,
+			Volume:    1000,
+		}
+	}
+	return candles
+}
+
+// trendingCloses rises by up on odd steps and falls by down on even ones,
+// ending on a rise
+func trendingCloses(n int, start, up, down float64) []float64 {
+	closes := make([]float64, n)
+	price := start
+	for i := range closes {
+		if (n-i)%2 == 1 {
+			price += up
+		} else {
+			price -= down
+		}
+		closes[i] = price
+	}
+	return closes
+}
+
+func TestAdaptiveRSIOnTrendingSeries(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	history := candleSeries(now, trendingCloses(90, 100, 1, 0.06))
+	price := history[len(history)-1].Close
+
+	static := NewGenerator(history, Config{Clock: fixedClock(now)}, utils.NewDiscardLogger())
+	adaptive := NewGenerator(history, Config{AdaptiveRSI: true, AdaptiveRSIShift: 20, Clock: fixedClock(now)}, utils.NewDiscardLogger())
+
+	staticSignal := static.GenerateSignal(context.Background(), "BTC-USDT", price)
+	adaptiveSignal := adaptive.GenerateSignal(context.Background(), "BTC-USDT", price)
+
+	if regime := adaptiveSignal.Metadata["regime"]; regime != RegimeTrendingUp {
+		t.Fatalf("regime = %v, want %s", regime, RegimeTrendingUp)
+	}
+
+	// The static band reads the trend's persistently high RSI as overbought
+	// and sells into it; the adaptive band moves with the trend and holds
+	if staticSignal.Action != "SELL" {
+		t.Errorf("static action = %s, want SELL", staticSignal.Action)
+	}
+	if adaptiveSignal.Action != "HOLD" {
+		t.Errorf("adaptive action = %s, want HOLD", adaptiveSignal.Action)
+	}
+
+	if got := staticSignal.Metadata["rsi_overbought"]; got != 70.0 {
+		t.Errorf("static rsi_overbought = %v, want 70", got)
+	}
+	if got := adaptiveSignal.Metadata["rsi_overbought"]; got != 90.0 {
+		t.Errorf("adaptive rsi_overbought = %v, want 90", got)
+	}
+}
+
+func TestRSIThresholds(t *testing.T) {
+	tests := []struct {
+		name           string
+		adaptive       bool
+		regime         string
+		wantOversold   float64
+		wantOverbought float64
+	}{
+		{name: "static ignores regime", adaptive: false, regime: RegimeTrendingUp, wantOversold: 30, wantOverbought: 70},
+		{name: "trending up shifts both up", adaptive: true, regime: RegimeTrendingUp, wantOversold: 40, wantOverbought: 80},
+		{name: "trending down shifts both down", adaptive: true, regime: RegimeTrendingDown, wantOversold: 20, wantOverbought: 60},
+		{name: "volatile widens", adaptive: true, regime: RegimeVolatile, wantOversold: 25, wantOverbought: 75},
+		{name: "ranging tightens", adaptive: true, regime: RegimeRanging, wantOversold: 35, wantOverbought: 65},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGenerator(staticHistory(nil), Config{AdaptiveRSI: tt.adaptive, AdaptiveRSIShift: 10}, utils.NewDiscardLogger())
+
+			oversold, overbought := g.rsiThresholds(tt.regime)
+			if oversold != tt.wantOversold || overbought != tt.wantOverbought {
+				t.Fatalf("rsiThresholds(%s) = %v/%v, want %v/%v", tt.regime, oversold, overbought, tt.wantOversold, tt.wantOverbought)
+			}
+		})
+	}
+}
+
+func TestStaleNewestCandleHolds(t *testing.T) {
+	end := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	history := candleSeries(end, trendingCloses(90, 100, 1, 0.06)) // Newest candle at 11:00
+	price := history[len(history)-1].Close
+
+	tests := []struct {
+		name      string
+		symbol    string
+		now       time.Time
+		wantStale bool
+	}{
+		{name: "fresh newest candle trades", symbol: "FRESH-USDT", now: end, wantStale: false},
+		{name: "newest candle at the limit trades", symbol: "EDGE-USDT", now: end.Add(time.Hour), wantStale: false},
+		{name: "stale newest candle holds", symbol: "STALE-USDT", now: end.Add(3 * time.Hour), wantStale: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator := NewGenerator(history, Config{MaxDataAge: 2 * time.Hour, Clock: fixedClock(tt.now)}, utils.NewDiscardLogger())
+			before := testutil.ToFloat64(metrics.StaleSignals.WithLabelValues(tt.symbol))
+
+			signal := generator.GenerateSignal(context.Background(), tt.symbol, price)
+
+			stale := testutil.ToFloat64(metrics.StaleSignals.WithLabelValues(tt.symbol)) - before
+			if tt.wantStale {
+				if signal.Action != "HOLD" || signal.Reason != "stale data" {
+					t.Errorf("signal = %s (%s), want HOLD for stale data", signal.Action, signal.Reason)
+				}
+				if stale != 1 {
+					t.Errorf("stale signal metric rose by %v, want 1", stale)
+				}
+				return
+			}
+
+			// The series reads as overbought, so fresh data yields a trade
+			if signal.Action != "SELL" {
+				t.Errorf("signal = %s (%s), want SELL from fresh data", signal.Action, signal.Reason)
+			}
+			if stale != 0 {
+				t.Errorf("stale signal metric rose by %v for fresh data, want 0", stale)
+			}
+		})
+	}
+}
+
+func TestRegimeVolatilityModelOnWickedCandles(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	candles := candleSeries(now, trendingCloses(60, 100, 0.1, 0.1))
+	for i := range candles {
+		candles[i].High = candles[i].Close * 1.03
+		candles[i].Low = candles[i].Close * 0.97
+	}
+
+	closeBased := NewGenerator(candles, Config{VolatilityModel: VolatilityModelClose}, utils.NewDiscardLogger()).
+		CalculateTechnicalIndicators(candles)
+	trueRange := NewGenerator(candles, Config{VolatilityModel: VolatilityModelTrueRange}, utils.NewDiscardLogger()).
+		CalculateTechnicalIndicators(candles)
+
+	if closeBased.Volatility > 0.002 {
+		t.Errorf("close-based volatility = %v, want it blind to the wicks", closeBased.Volatility)
+	}
+	if trueRange.Volatility < 0.05 || trueRange.Volatility > 0.07 {
+		t.Errorf("true range volatility = %v, want about the 6%% bar range", trueRange.Volatility)
+	}
+}
+
+func TestVolumeSpikeContributionIsClamped(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     Config
+		indicators TechnicalIndicators
+		wantRatio  float64
+		wantFactor float64
+	}{
+		{
+			name:       "uncapped spike runs away",
+			indicators: TechnicalIndicators{CurrentVolume: 5000, AvgVolume: 10, LastClose: 100},
+			wantRatio:  500,
+			wantFactor: 1 + 0.2*499,
+		},
+		{
+			name:       "spike on an idle pair is capped",
+			config:     Config{MaxVolumeRatio: 3},
+			indicators: TechnicalIndicators{CurrentVolume: 5000, AvgVolume: 10, LastClose: 100},
+			wantRatio:  3,
+			wantFactor: 1.4,
+		},
+		{
+			name:       "ratio under the cap is kept",
+			config:     Config{MaxVolumeRatio: 3},
+			indicators: TechnicalIndicators{CurrentVolume: 20, AvgVolume: 10, LastClose: 100},
+			wantRatio:  2,
+			wantFactor: 1.2,
+		},
+		{
+			name:       "candle below the minimum volume does not confirm",
+			config:     Config{MaxVolumeRatio: 3, MinConfirmationVolume: 10_000},
+			indicators: TechnicalIndicators{CurrentVolume: 50, AvgVolume: 0.1, LastClose: 100},
+			wantRatio:  3,
+			wantFactor: 1,
+		},
+		{
+			name:       "no average volume",
+			config:     Config{MaxVolumeRatio: 3},
+			indicators: TechnicalIndicators{CurrentVolume: 50, LastClose: 100},
+			wantRatio:  0,
+			wantFactor: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGenerator(staticHistory(nil), tt.config, utils.NewDiscardLogger())
+
+			ratio, factor := g.volumeConfirmation(tt.indicators)
+			if math.Abs(ratio-tt.wantRatio) > 1e-9 || math.Abs(factor-tt.wantFactor) > 1e-9 {
+				t.Fatalf("volumeConfirmation() = %v/%v, want %v/%v", ratio, factor, tt.wantRatio, tt.wantFactor)
+			}
+		})
+	}
+}
+
+func TestSignalTimestampFromClock(t *testing.T) {
+	// A replay of March 2020, years before the wall clock
+	replayTime := time.Date(2020, 3, 12, 14, 0, 0, 0, time.UTC)
+	history := candleSeries(replayTime, trendingCloses(100, 100, 1.2, 1))
+
+	replay := NewGenerator(history, Config{Clock: fixedClock(replayTime)}, utils.NewDiscardLogger())
+	signal := replay.GenerateSignal(context.Background(), "BTC-USDT", 110)
+	if !signal.Timestamp.Equal(replayTime) {
+		t.Errorf("signal timestamp = %v, want the simulated %v", signal.Timestamp, replayTime)
+	}
+	if signal.Reason == "insufficient price history" {
+		t.Error("history window not measured from the simulated time")
+	}
+
+	// The wall clock finds nothing in its window for the same history
+	live := NewGenerator(history, Config{}, utils.NewDiscardLogger())
+	before := time.Now()
+	signal = live.GenerateSignal(context.Background(), "BTC-USDT", 110)
+	if signal.Timestamp.Before(before) || signal.Timestamp.After(time.Now()) {
+		t.Errorf("signal timestamp = %v, want the wall clock by default", signal.Timestamp)
+	}
+	if signal.Reason != "insufficient price history" {
+		t.Errorf("reason = %q, want the 2020 history outside the live window", signal.Reason)
+	}
+}
+
+// alternatingCloses swings between mid-1 and mid+1, ending on mid+1
+func alternatingCloses(n int, mid float64) []float64 {
+	closes := make([]float64, n)
+	for i := range closes {
+		closes[i] = mid - 1
+		if (n-i)%2 == 1 {
+			closes[i] = mid + 1
+		}
+	}
+	return closes
+}
+
+func TestBollingerBandExtraction(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	flat := make([]float64, 30)
+	for i := range flat {
+		flat[i] = 50
+	}
+	// A rally the band period has already left behind
+	rallied := append(trendingCloses(40, 10, 3, 1), alternatingCloses(20, 100)...)
+
+	tests := []struct {
+		name    string
+		closes  []float64
+		wantUp  float64
+		wantLow float64
+	}{
+		{name: "flat closes collapse the bands", closes: flat, wantUp: 50, wantLow: 50},
+		{name: "two standard deviations around the mean", closes: alternatingCloses(30, 100), wantUp: 102, wantLow: 98},
+		{name: "only the last period counts", closes: rallied, wantUp: 102, wantLow: 98},
+		{name: "shorter than the period", closes: alternatingCloses(19, 100), wantUp: 0, wantLow: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGenerator(staticHistory(nil), Config{}, utils.NewDiscardLogger())
+
+			indicators := g.CalculateTechnicalIndicators(candleSeries(now, tt.closes))
+			if math.Abs(indicators.BollingerUp-tt.wantUp) > 1e-6 || math.Abs(indicators.BollingerLow-tt.wantLow) > 1e-6 {
+				t.Errorf("bands = %v/%v, want %v/%v", indicators.BollingerUp, indicators.BollingerLow, tt.wantUp, tt.wantLow)
+			}
+		})
+	}
+}
+
+func TestBollingerBandsNudgeScore(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	// Bands of 98 to 102 with a neutral RSI and no trend
+	history := candleSeries(now, alternatingCloses(100, 100))
+
+	tests := []struct {
+		name      string
+		price     float64
+		wantNudge float64
+	}{
+		{name: "a band width below the lower band buys", price: 94, wantNudge: 0.4},
+		{name: "half a width below the lower band", price: 96, wantNudge: 0.4 * 0.75},
+		{name: "inside the bands", price: 100, wantNudge: 0},
+		{name: "a band width above the upper band sells", price: 106, wantNudge: -0.4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := NewGenerator(history, Config{Clock: fixedClock(now)}, utils.NewDiscardLogger())
+			banded := NewGenerator(history, Config{Clock: fixedClock(now), BollingerWeight: 0.4}, utils.NewDiscardLogger())
+
+			without := base.GenerateSignal(context.Background(), "BTC-USDT", tt.price).Metadata["score"].(float64)
+			with := banded.GenerateSignal(context.Background(), "BTC-USDT", tt.price).Metadata["score"].(float64)
+			if nudge := with - without; math.Abs(nudge-tt.wantNudge) > 1e-6 {
+				t.Errorf("bands moved the score by %v, want %v", nudge, tt.wantNudge)
+			}
+		})
+	}
+}
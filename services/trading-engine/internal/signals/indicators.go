@@ -0,0 +1,125 @@
+package signals
+
+import (
+	"math"
+
+	"github.com/markcheno/go-talib"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+const (
+	RegimeTrendingUp   = "trending_up"
+	RegimeTrendingDown = "trending_down"
+	RegimeVolatile     = "volatile"
+	RegimeRanging      = "ranging"
+)
+
+// Volatility models for regime detection
+const (
+	VolatilityModelClose     = "close"      // Standard deviation of close-to-close returns
+	VolatilityModelTrueRange = "true_range" // Average true range relative to the last close
+)
+
+type TechnicalIndicators struct {
+	RSI           float64
+	SMAShort      float64
+	SMALong       float64
+	ATR           float64
+	BollingerUp   float64 // Upper band, two standard deviations above the SMA
+	BollingerLow  float64 // Lower band, two standard deviations below the SMA
+	Volatility    float64 // Per-candle volatility under the generator's volatility model
+	CurrentVolume float64
+	AvgVolume     float64
+	LastClose     float64
+}
+
+func (g *Generator) CalculateTechnicalIndicators(candles []models.Candle) TechnicalIndicators {
+	closes := make([]float64, len(candles))
+	highs := make([]float64, len(candles))
+	lows := make([]float64, len(candles))
+	volumes := make([]float64, len(candles))
+
+	for i, candle := range candles {
+		closes[i] = candle.Close
+		highs[i] = candle.High
+		lows[i] = candle.Low
+		volumes[i] = candle.Volume
+	}
+
+	var indicators TechnicalIndicators
+	if g.volatilityModel == VolatilityModelTrueRange {
+		indicators.Volatility = utils.CalculateTrueRangeVolatility(highs, lows, closes, g.atrPeriod)
+	} else {
+		indicators.Volatility = utils.CalculateVolatility(closes)
+	}
+
+	if len(candles) == 0 {
+		return indicators
+	}
+
+	indicators.LastClose = closes[len(closes)-1]
+	indicators.CurrentVolume = volumes[len(volumes)-1]
+
+	if len(closes) > g.rsiPeriod {
+		indicators.RSI = lastNonNaN(talib.Rsi(closes, g.rsiPeriod))
+	}
+	if len(closes) >= g.smaShortPeriod {
+		indicators.SMAShort = lastNonNaN(talib.Sma(closes, g.smaShortPeriod))
+	}
+	if len(closes) >= g.smaLongPeriod {
+		indicators.SMALong = lastNonNaN(talib.Sma(closes, g.smaLongPeriod))
+	}
+	if len(closes) > g.atrPeriod {
+		indicators.ATR = lastNonNaN(talib.Atr(highs, lows, closes, g.atrPeriod))
+	}
+
+	if len(closes) >= g.bbandsPeriod {
+		upper, _, lower := talib.BBands(closes, g.bbandsPeriod, 2.0, 2.0, talib.SMA)
+		indicators.BollingerUp = lastNonNaN(upper)
+		indicators.BollingerLow = lastNonNaN(lower)
+	}
+
+	// Average volume excludes the current candle so a spike is measured
+	// against the preceding activity
+	if len(volumes) > g.volumePeriod {
+		previous := volumes[len(volumes)-1-g.volumePeriod : len(volumes)-1]
+		total := 0.0
+		for _, volume := range previous {
+			total += volume
+		}
+		indicators.AvgVolume = total / float64(len(previous))
+	}
+
+	return indicators
+}
+
+// detectRegime classifies the market from the moving average separation and
+// the recent volatility
+func (g *Generator) detectRegime(indicators TechnicalIndicators) string {
+	if indicators.SMALong > 0 {
+		separation := (indicators.SMAShort - indicators.SMALong) / indicators.SMALong
+		if separation >= g.trendThreshold {
+			return RegimeTrendingUp
+		}
+		if separation <= -g.trendThreshold {
+			return RegimeTrendingDown
+		}
+	}
+
+	if indicators.Volatility >= g.highVolatility {
+		return RegimeVolatile
+	}
+
+	return RegimeRanging
+}
+
+// lastNonNaN returns the most recent finite value of an indicator series
+func lastNonNaN(values []float64) float64 {
+	for i := len(values) - 1; i >= 0; i-- {
+		if !math.IsNaN(values[i]) && !math.IsInf(values[i], 0) {
+			return values[i]
+		}
+	}
+	return 0
+}
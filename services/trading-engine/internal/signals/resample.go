@@ -0,0 +1,43 @@
+package signals
+
+import (
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// ResampleCandles aggregates candles, oldest first, into OHLCV candles of the
+// given interval aligned to interval boundaries. Each output candle opens at
+// its first input's open, closes at its last input's close, spans their
+// highs and lows and sums their volume. The newest candle is usually still
+// forming and covers only part of the interval. Input already at or above
+// the interval passes through unchanged.
+func ResampleCandles(candles []models.Candle, interval time.Duration) []models.Candle {
+	if interval <= 0 || len(candles) < 2 {
+		return candles
+	}
+
+	resampled := make([]models.Candle, 0, len(candles))
+	for _, candle := range candles {
+		bucket := candle.Timestamp.Truncate(interval)
+
+		last := len(resampled) - 1
+		if last >= 0 && resampled[last].Timestamp.Equal(bucket) {
+			current := &resampled[last]
+			if candle.High > current.High {
+				current.High = candle.High
+			}
+			if candle.Low < current.Low {
+				current.Low = candle.Low
+			}
+			current.Close = candle.Close
+			current.Volume += candle.Volume
+			continue
+		}
+
+		candle.Timestamp = bucket
+		resampled = append(resampled, candle)
+	}
+
+	return resampled
+}
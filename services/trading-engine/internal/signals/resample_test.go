@@ -0,0 +1,67 @@
+package signals
+
+import (
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// minuteCandles returns n minute candles from start whose close rises by one
+// each minute, with a one point wick either side and a volume of one
+func minuteCandles(start time.Time, n int) []models.Candle {
+	candles := make([]models.Candle, n)
+	for i := range candles {
+		price := 100 + float64(i)
+		candles[i] = models.Candle{
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+			Open:      price - 0.5,
+			High:      price + 1,
+			Low:       price - 1,
+			Close:     price,
+			Volume:    1,
+		}
+	}
+	return candles
+}
+
+func TestResampleMinutesIntoHours(t *testing.T) {
+	// Two and a half hours starting mid-hour
+	start := time.Date(2024, 3, 1, 11, 30, 0, 0, time.UTC)
+	candles := minuteCandles(start, 150)
+
+	hourly := ResampleCandles(candles, time.Hour)
+
+	want := []models.Candle{
+		{Timestamp: start.Truncate(time.Hour), Open: 99.5, High: 130, Low: 99, Close: 129, Volume: 30},
+		{Timestamp: start.Truncate(time.Hour).Add(time.Hour), Open: 129.5, High: 190, Low: 129, Close: 189, Volume: 60},
+		{Timestamp: start.Truncate(time.Hour).Add(2 * time.Hour), Open: 189.5, High: 250, Low: 189, Close: 249, Volume: 60},
+	}
+	if len(hourly) != len(want) {
+		t.Fatalf("resampled into %d candles, want %d", len(hourly), len(want))
+	}
+	for i := range want {
+		if hourly[i] != want[i] {
+			t.Errorf("candle %d = %+v, want %+v", i, hourly[i], want[i])
+		}
+	}
+}
+
+func TestResamplePassesThroughCoarserInput(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	hourly := ResampleCandles(minuteCandles(start, 180), time.Hour)
+
+	again := ResampleCandles(hourly, time.Hour)
+	if len(again) != len(hourly) {
+		t.Fatalf("resampling hourly candles gave %d candles, want the %d unchanged", len(again), len(hourly))
+	}
+	for i := range hourly {
+		if again[i] != hourly[i] {
+			t.Errorf("candle %d = %+v, want %+v unchanged", i, again[i], hourly[i])
+		}
+	}
+
+	if got := ResampleCandles(hourly, 0); len(got) != len(hourly) {
+		t.Errorf("zero interval gave %d candles, want the input", len(got))
+	}
+}
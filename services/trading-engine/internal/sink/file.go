@@ -0,0 +1,47 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileSink appends each trade event as a JSON line to a file, for shipping
+// to object storage or a warehouse loader by an external agent
+type FileSink struct {
+	path string
+
+	mu sync.Mutex
+}
+
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+func (f *FileSink) Name() string {
+	return "file"
+}
+
+func (f *FileSink) Send(ctx context.Context, event TradeEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trade event: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open trade event file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write trade event: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package sink
+
+import (
+	"context"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// TradeEvent describes a position that was closed by a trade
+type TradeEvent struct {
+	Type          string    `json:"type"`
+	PositionID    string    `json:"position_id"`
+	AccountID     string    `json:"account_id"`
+	Symbol        string    `json:"symbol"`
+	Side          string    `json:"side"`
+	Quantity      float64   `json:"quantity"`
+	EntryPrice    float64   `json:"entry_price"`
+	ExitPrice     float64   `json:"exit_price"`
+	RealizedPnL   float64   `json:"realized_pnl"`
+	StrategyTag   string    `json:"strategy_tag"`
+	ConfigVersion string    `json:"config_version"`
+	Reason        string    `json:"reason"`
+	OpenedAt      time.Time `json:"opened_at"`
+	ClosedAt      time.Time `json:"closed_at"`
+}
+
+// EventPositionClosed is the type of a TradeEvent for a closed position
+const EventPositionClosed = "position_closed"
+
+// Sink receives trade events for an external system such as a dashboard or
+// warehouse
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, event TradeEvent) error
+}
+
+// Dispatcher hands trade events to the sinks from a background goroutine, so
+// a slow or unavailable sink never holds up trading. Events beyond the buffer
+// are dropped and counted. A nil Dispatcher discards everything, which is how
+// an unconfigured export behaves.
+type Dispatcher struct {
+	sinks       []Sink
+	events      chan TradeEvent
+	sendTimeout time.Duration
+	logger      *logrus.Logger
+}
+
+func NewDispatcher(sinks []Sink, buffer int, sendTimeout time.Duration, logger *logrus.Logger) *Dispatcher {
+	if buffer < 1 {
+		buffer = 1
+	}
+
+	return &Dispatcher{
+		sinks:       sinks,
+		events:      make(chan TradeEvent, buffer),
+		sendTimeout: sendTimeout,
+		logger:      logger,
+	}
+}
+
+// Publish queues an event without blocking
+func (d *Dispatcher) Publish(event TradeEvent) {
+	if d == nil {
+		return
+	}
+
+	select {
+	case d.events <- event:
+	default:
+		metrics.TradeSinkFailures.WithLabelValues("all", "dropped").Inc()
+		d.logger.WithField("position_id", event.PositionID).Warn("Trade event buffer full, dropping event")
+	}
+}
+
+// Run delivers queued events until the context is cancelled, then delivers
+// what is still queued before returning
+func (d *Dispatcher) Run(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+
+	for {
+		select {
+		case event := <-d.events:
+			d.deliver(ctx, event)
+		case <-ctx.Done():
+			drainCtx := context.WithoutCancel(ctx)
+			for {
+				select {
+				case event := <-d.events:
+					d.deliver(drainCtx, event)
+				default:
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// deliver sends one event to every sink; a failing sink does not keep the
+// event from the others
+func (d *Dispatcher) deliver(ctx context.Context, event TradeEvent) {
+	for _, sink := range d.sinks {
+		sendCtx, cancel := context.WithTimeout(ctx, d.sendTimeout)
+		err := sink.Send(sendCtx, event)
+		cancel()
+
+		if err != nil {
+			metrics.TradeSinkFailures.WithLabelValues(sink.Name(), "send").Inc()
+			d.logger.WithError(err).WithFields(logrus.Fields{
+				"sink":        sink.Name(),
+				"position_id": event.PositionID,
+			}).Warn("Failed to send trade event")
+		}
+	}
+}
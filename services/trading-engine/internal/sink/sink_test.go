@@ -0,0 +1,165 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// recordingSink keeps the events it receives, failing every send when err is
+// set
+type recordingSink struct {
+	name string
+	err  error
+
+	mu     sync.Mutex
+	events []TradeEvent
+}
+
+func (s *recordingSink) Name() string {
+	return s.name
+}
+
+func (s *recordingSink) Send(_ context.Context, event TradeEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, event)
+	return s.err
+}
+
+func (s *recordingSink) Events() []TradeEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]TradeEvent(nil), s.events...)
+}
+
+func TestDispatcherDeliversToEverySink(t *testing.T) {
+	failing := &recordingSink{name: "failing-test-sink", err: errors.New("endpoint down")}
+	working := &recordingSink{name: "working-test-sink"}
+	d := NewDispatcher([]Sink{failing, working}, 10, time.Second, utils.NewDiscardLogger())
+	failures := metrics.TradeSinkFailures.WithLabelValues("failing-test-sink", "send")
+	before := testutil.ToFloat64(failures)
+
+	d.Publish(TradeEvent{Type: EventPositionClosed, PositionID: "position-1"})
+	d.Publish(TradeEvent{Type: EventPositionClosed, PositionID: "position-2"})
+
+	// Queued events are still delivered when the dispatcher stops
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := d.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	for _, sink := range []*recordingSink{failing, working} {
+		events := sink.Events()
+		if len(events) != 2 || events[0].PositionID != "position-1" || events[1].PositionID != "position-2" {
+			t.Errorf("%s received %+v, want both events in order", sink.name, events)
+		}
+	}
+	if got := testutil.ToFloat64(failures) - before; got != 2 {
+		t.Errorf("send failure metric rose by %v, want 2", got)
+	}
+}
+
+func TestPublishDoesNotBlockOnFullBuffer(t *testing.T) {
+	d := NewDispatcher([]Sink{&recordingSink{name: "slow"}}, 1, time.Second, utils.NewDiscardLogger())
+	dropped := metrics.TradeSinkFailures.WithLabelValues("all", "dropped")
+	before := testutil.ToFloat64(dropped)
+
+	done := make(chan struct{})
+	go func() {
+		d.Publish(TradeEvent{PositionID: "position-1"})
+		d.Publish(TradeEvent{PositionID: "position-2"})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish() blocked with no dispatcher running")
+	}
+	if got := testutil.ToFloat64(dropped) - before; got != 1 {
+		t.Errorf("dropped metric rose by %v, want 1", got)
+	}
+}
+
+func TestUnconfiguredDispatcherIsNoop(t *testing.T) {
+	var d *Dispatcher
+
+	d.Publish(TradeEvent{PositionID: "position-1"})
+	if err := d.Run(context.Background()); err != nil {
+		t.Errorf("Run() error = %v, want nil", err)
+	}
+}
+
+func TestWebhookSinkPostsEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "accepted", status: http.StatusOK},
+		{name: "rejected", status: http.StatusInternalServerError, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received TradeEvent
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+					t.Errorf("webhook body is not a trade event: %v", err)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			err := NewWebhookSink(server.URL).Send(context.Background(), TradeEvent{Type: EventPositionClosed, PositionID: "position-1", RealizedPnL: 4.2})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, want error %v", err, tt.wantErr)
+			}
+			if received.PositionID != "position-1" || received.RealizedPnL != 4.2 {
+				t.Errorf("webhook received %+v, want the event", received)
+			}
+		})
+	}
+}
+
+func TestFileSinkAppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trades.jsonl")
+	f := NewFileSink(path)
+
+	for _, id := range []string{"position-1", "position-2"} {
+		if err := f.Send(context.Background(), TradeEvent{Type: EventPositionClosed, PositionID: id}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read the sink file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("file has %d lines, want 2", len(lines))
+	}
+	for i, want := range []string{"position-1", "position-2"} {
+		var event TradeEvent
+		if err := json.Unmarshal([]byte(lines[i]), &event); err != nil || event.PositionID != want {
+			t.Errorf("line %d = %s, want the event of %s", i, lines[i], want)
+		}
+	}
+}
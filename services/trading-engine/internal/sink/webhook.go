@@ -0,0 +1,42 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// WebhookSink posts each trade event as JSON to an HTTP endpoint
+type WebhookSink struct {
+	url    string
+	client *resty.Client
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{
+		url:    url,
+		client: resty.New(),
+	}
+}
+
+func (w *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (w *WebhookSink) Send(ctx context.Context, event TradeEvent) error {
+	resp, err := w.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(event).
+		Post(w.url)
+	if err != nil {
+		return fmt.Errorf("failed to post trade event: %w", err)
+	}
+
+	if resp.IsError() {
+		return fmt.Errorf("trade event webhook returned status %d", resp.StatusCode())
+	}
+
+	return nil
+}
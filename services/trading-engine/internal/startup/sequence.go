@@ -0,0 +1,66 @@
+package startup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Step is one prerequisite of the startup sequence
+type Step struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Sequence runs startup prerequisites strictly in order, stopping at the
+// first failure so nothing downstream runs against an unverified dependency
+type Sequence struct {
+	steps       []Step
+	stepTimeout time.Duration // 0 leaves steps bounded only by the caller's context
+	logger      *logrus.Logger
+}
+
+func NewSequence(stepTimeout time.Duration, logger *logrus.Logger) *Sequence {
+	return &Sequence{
+		stepTimeout: stepTimeout,
+		logger:      logger,
+	}
+}
+
+// Add appends a step run after all previously added ones
+func (s *Sequence) Add(name string, run func(ctx context.Context) error) *Sequence {
+	s.steps = append(s.steps, Step{Name: name, Run: run})
+	return s
+}
+
+// Run executes the steps in order and returns the first failure, wrapped
+// with the name of the step that failed
+func (s *Sequence) Run(ctx context.Context) error {
+	for i, step := range s.steps {
+		started := time.Now()
+
+		if err := s.runStep(ctx, step); err != nil {
+			s.logger.WithError(err).WithField("step", step.Name).Error("Startup step failed")
+			return fmt.Errorf("startup step %q failed: %w", step.Name, err)
+		}
+
+		s.logger.WithFields(logrus.Fields{
+			"step":     step.Name,
+			"position": fmt.Sprintf("%d/%d", i+1, len(s.steps)),
+			"duration": time.Since(started),
+		}).Info("Startup step completed")
+	}
+
+	return nil
+}
+
+func (s *Sequence) runStep(ctx context.Context, step Step) error {
+	if s.stepTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.stepTimeout)
+		defer cancel()
+	}
+	return step.Run(ctx)
+}
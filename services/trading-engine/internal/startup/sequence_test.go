@@ -0,0 +1,77 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+)
+
+// recordingStep appends its name to ran and fails with err when set
+func recordingStep(ran *[]string, name string, err error) func(context.Context) error {
+	return func(context.Context) error {
+		*ran = append(*ran, name)
+		return err
+	}
+}
+
+func TestSequenceRunsStepsInOrder(t *testing.T) {
+	var ran []string
+	sequence := NewSequence(0, utils.NewDiscardLogger()).
+		Add("connect database", recordingStep(&ran, "database", nil)).
+		Add("verify schema", recordingStep(&ran, "schema", nil)).
+		Add("verify exchange auth", recordingStep(&ran, "auth", nil)).
+		Add("reconcile", recordingStep(&ran, "reconcile", nil))
+
+	if err := sequence.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if got, want := strings.Join(ran, ","), "database,schema,auth,reconcile"; got != want {
+		t.Errorf("ran %s, want %s", got, want)
+	}
+}
+
+func TestSequenceAbortsOnFailedPrerequisite(t *testing.T) {
+	authErr := errors.New("invalid API key")
+
+	var ran []string
+	sequence := NewSequence(0, utils.NewDiscardLogger()).
+		Add("verify schema", recordingStep(&ran, "schema", nil)).
+		Add("verify exchange auth", recordingStep(&ran, "auth", authErr)).
+		Add("reconcile", recordingStep(&ran, "reconcile", nil))
+
+	err := sequence.Run(context.Background())
+	if !errors.Is(err, authErr) {
+		t.Fatalf("Run() error = %v, want the auth failure", err)
+	}
+	if !strings.Contains(err.Error(), "verify exchange auth") {
+		t.Errorf("Run() error = %q, want it to name the failed step", err)
+	}
+	if got := strings.Join(ran, ","); got != "schema,auth" {
+		t.Errorf("ran %s, want nothing after the failed step", got)
+	}
+}
+
+func TestSequenceStepTimeout(t *testing.T) {
+	sequence := NewSequence(20*time.Millisecond, utils.NewDiscardLogger()).
+		Add("reconcile", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+	done := make(chan error, 1)
+	go func() { done <- sequence.Run(context.Background()) }()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Run() error = %v, want the step deadline", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run() still waiting on a step past its timeout")
+	}
+}
@@ -0,0 +1,94 @@
+package trader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// tradingAccount is one engine trading its own repository view and exchange, the
+// way main wires each configured account
+type tradingAccount struct {
+	repo   *MockDatabaseRepository
+	ex     *MockExchange
+	engine *Engine
+}
+
+func newAccount(name string, config EngineConfig) tradingAccount {
+	repo, ex := NewMockDatabaseRepository(name), NewMockExchange()
+	repo.pairs = []models.SelectedPair{testPair}
+	seedSellOff(repo)
+	return tradingAccount{repo: repo, ex: ex, engine: newTestEngine(repo, ex, config)}
+}
+
+func accountConfig(maxPositions int, maxLoss float64) EngineConfig {
+	config := testEngineConfig()
+	config.MaxPositionsPerPair = maxPositions
+	config.LossVelocityMaxLossUSDT = maxLoss
+	config.LossVelocityWindow = 10 * time.Minute
+	config.LossVelocityCooldown = time.Hour
+	return config
+}
+
+func TestAccountsTradeIndependently(t *testing.T) {
+	tests := []struct {
+		name  string
+		alpha EngineConfig
+		beta  EngineConfig
+		setup func(alpha, beta tradingAccount)
+	}{
+		{
+			name:  "one account's losses halt only that account",
+			alpha: accountConfig(3, 50),
+			beta:  accountConfig(3, 50),
+			setup: func(alpha, _ tradingAccount) {
+				alpha.repo.AddPosition(closedPosition(-60, time.Now().Add(-time.Minute)))
+			},
+		},
+		{
+			name:  "one account's open positions count against only its limit",
+			alpha: accountConfig(1, 50),
+			beta:  accountConfig(1, 50),
+			setup: func(alpha, _ tradingAccount) {
+				alpha.repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", Quantity: 1, EntryPrice: 95, CurrentPrice: 95, Status: "open"})
+			},
+		},
+		{
+			name:  "limits are per account",
+			alpha: accountConfig(3, 50),
+			beta:  accountConfig(3, 100),
+			setup: func(alpha, beta tradingAccount) {
+				alpha.repo.AddPosition(closedPosition(-60, time.Now().Add(-time.Minute)))
+				beta.repo.AddPosition(closedPosition(-60, time.Now().Add(-time.Minute)))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			alpha, beta := newAccount("alpha", tt.alpha), newAccount("beta", tt.beta)
+			tt.setup(alpha, beta)
+
+			for _, a := range []tradingAccount{alpha, beta} {
+				if err := a.engine.processTradingCycle(ctx); err != nil {
+					t.Fatalf("processTradingCycle() error = %v", err)
+				}
+			}
+
+			if placed := alpha.ex.Placed(); len(placed) != 0 {
+				t.Errorf("alpha placed %d orders, want its own limit to block the entry", len(placed))
+			}
+			if placed := beta.ex.Placed(); len(placed) != 1 {
+				t.Fatalf("beta placed %d orders, want 1 unaffected by alpha", len(placed))
+			}
+			for _, position := range beta.repo.Positions() {
+				if position.AccountID != "beta" {
+					t.Errorf("beta's position created under account %q", position.AccountID)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package trader
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// unknownBeta is assumed for a pair whose beta could not be estimated: it
+// moves one for one with the reference, which for altcoins is rarely an
+// overstatement
+const unknownBeta = 1.0
+
+// betaBook is the state the portfolio beta limit is checked against,
+// refreshed once per trading cycle
+type betaBook struct {
+	betas  map[int64]float64 // Beta of each active pair to the reference
+	values map[int64]float64 // Signed USDT value held in each pair
+	rates  map[int64]float64 // USDT rate of each pair's quote currency
+}
+
+// UpdatePortfolioBeta estimates each active pair's beta to the reference
+// symbol over the configured window and stores it with the account's open
+// exposure, against which CanTrade checks the beta limit during the cycle
+func (r *RiskManager) UpdatePortfolioBeta(ctx context.Context, pairs []models.SelectedPair) error {
+	if r.config.MaxPortfolioBeta <= 0 {
+		return nil
+	}
+
+	positions, err := r.repo.GetAllOpenPositions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get open positions: %w", err)
+	}
+
+	since := time.Now().Add(-r.config.BetaWindow)
+	reference, err := r.repo.GetPriceHistory(ctx, r.config.BetaReference, since)
+	if err != nil {
+		return fmt.Errorf("failed to get %s price history: %w", r.config.BetaReference, err)
+	}
+	referenceReturns := returnSeries(reference)
+
+	symbols := make(map[int64]string, len(pairs))
+	book := betaBook{betas: make(map[int64]float64, len(pairs)), values: make(map[int64]float64)}
+	for _, pair := range pairs {
+		symbols[pair.ID] = pair.Symbol
+
+		candles, err := r.repo.GetPriceHistory(ctx, pair.Symbol, since)
+		if err != nil {
+			return fmt.Errorf("failed to get %s price history: %w", pair.Symbol, err)
+		}
+		beta, ok := alignedBeta(returnSeries(candles), referenceReturns)
+		if !ok {
+			beta = unknownBeta
+		}
+		book.betas[pair.ID] = beta
+	}
+
+	book.rates, _ = usdtRates(ctx, r.quoteRates, symbols)
+	for _, position := range positions {
+		book.values[position.PairID] += signedValue(position, position.CurrentPrice) * rateFor(book.rates, position.PairID)
+	}
+
+	r.mu.Lock()
+	r.betas = book
+	r.mu.Unlock()
+
+	beta := portfolioBeta(book.values, book.betas)
+	metrics.PortfolioBeta.WithLabelValues(r.repo.Account()).Set(beta)
+	r.logger.WithFields(logrus.Fields{
+		"portfolio_beta": beta,
+		"max_beta":       r.config.MaxPortfolioBeta,
+		"reference":      r.config.BetaReference,
+	}).Debug("Updated portfolio beta")
+
+	return nil
+}
+
+// withinBetaLimit reports whether a default-sized long entry on the pair
+// leaves the portfolio beta at or below the cap, or at least does not raise
+// it. Before the first update every entry passes.
+func (r *RiskManager) withinBetaLimit(pair models.SelectedPair) bool {
+	if r.config.MaxPortfolioBeta <= 0 {
+		return true
+	}
+
+	r.mu.RLock()
+	book := r.betas
+	r.mu.RUnlock()
+	if book.betas == nil {
+		return true
+	}
+
+	before := portfolioBeta(book.values, book.betas)
+	after := portfolioBetaWith(book.values, book.betas, pair.ID, r.config.DefaultPositionSize*rateFor(book.rates, pair.ID))
+	if after <= r.config.MaxPortfolioBeta || after <= before {
+		return true
+	}
+
+	r.logger.WithFields(logrus.Fields{
+		"symbol":           pair.Symbol,
+		"pair_beta":        betaOf(book.betas, pair.ID),
+		"portfolio_beta":   before,
+		"beta_after_entry": after,
+		"max_beta":         r.config.MaxPortfolioBeta,
+	}).Info("Entry would raise portfolio beta above the limit")
+
+	return false
+}
+
+// portfolioBeta is the exposure-weighted beta of the signed pair values:
+// sum(v*beta) / sum(|v|). Shorts subtract their beta, and an empty book has
+// a beta of zero.
+func portfolioBeta(values, betas map[int64]float64) float64 {
+	weighted, gross := 0.0, 0.0
+	for pairID, value := range values {
+		weighted += value * betaOf(betas, pairID)
+		gross += math.Abs(value)
+	}
+	if gross == 0 {
+		return 0
+	}
+	return weighted / gross
+}
+
+// portfolioBetaWith is the portfolio beta after adding value to the pair
+func portfolioBetaWith(values, betas map[int64]float64, pairID int64, value float64) float64 {
+	with := make(map[int64]float64, len(values)+1)
+	for id, v := range values {
+		with[id] = v
+	}
+	with[pairID] += value
+	return portfolioBeta(with, betas)
+}
+
+func betaOf(betas map[int64]float64, pairID int64) float64 {
+	if beta, ok := betas[pairID]; ok {
+		return beta
+	}
+	return unknownBeta
+}
+
+// alignedBeta regresses the pair's returns on the reference's over their
+// common timestamps: cov(pair, reference) / var(reference)
+func alignedBeta(pair, reference map[int64]float64) (float64, bool) {
+	var x, y []float64
+	for timestamp, value := range pair {
+		if other, ok := reference[timestamp]; ok {
+			x = append(x, value)
+			y = append(y, other)
+		}
+	}
+	if len(x) < minCorrelationSamples {
+		return 0, false
+	}
+
+	n := float64(len(x))
+	meanX, meanY := 0.0, 0.0
+	for i := range x {
+		meanX += x[i]
+		meanY += y[i]
+	}
+	meanX /= n
+	meanY /= n
+
+	covariance, variance := 0.0, 0.0
+	for i := range x {
+		covariance += (x[i] - meanX) * (y[i] - meanY)
+		variance += (y[i] - meanY) * (y[i] - meanY)
+	}
+	if variance == 0 {
+		return 0, false
+	}
+	return covariance / variance, true
+}
@@ -0,0 +1,106 @@
+package trader
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// betaCloses compounds 30 hourly returns of the reference's alternating
+// swings scaled by beta
+func betaCloses(beta float64) []float64 {
+	closes := []float64{100}
+	for i := 0; i < 30; i++ {
+		swing := 0.01 + 0.002*float64(i%3)
+		if i%2 == 1 {
+			swing = -swing
+		}
+		closes = append(closes, closes[len(closes)-1]*(1+beta*swing))
+	}
+	return closes
+}
+
+func TestAlignedBeta(t *testing.T) {
+	reference := returnSeries(hourlyCandles(betaCloses(1)))
+
+	for _, want := range []float64{2, 0.5, -1} {
+		beta, ok := alignedBeta(returnSeries(hourlyCandles(betaCloses(want))), reference)
+		if !ok || math.Abs(beta-want) > 1e-9 {
+			t.Errorf("alignedBeta() = %v, %v; want %v", beta, ok, want)
+		}
+	}
+
+	short := returnSeries(hourlyCandles(betaCloses(2)[:5]))
+	if _, ok := alignedBeta(short, reference); ok {
+		t.Error("alignedBeta() estimated from four returns, want too few samples")
+	}
+}
+
+func TestPortfolioBeta(t *testing.T) {
+	betas := map[int64]float64{1: 2, 2: 0.5}
+
+	tests := []struct {
+		name   string
+		values map[int64]float64
+		want   float64
+	}{
+		{name: "empty book", want: 0},
+		{name: "single pair", values: map[int64]float64{1: 100}, want: 2},
+		{name: "exposure weighted", values: map[int64]float64{1: 100, 2: 300}, want: 0.875},
+		{name: "short subtracts its beta", values: map[int64]float64{1: 100, 2: -100}, want: 0.75},
+		{name: "unknown pair moves with the reference", values: map[int64]float64{3: 100}, want: unknownBeta},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := portfolioBeta(tt.values, betas); !approxEqual(got, tt.want) {
+				t.Errorf("portfolioBeta() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBetaLimitBlocksBetaIncreasingEntry(t *testing.T) {
+	ctx := context.Background()
+	alt := models.SelectedPair{ID: 2, Symbol: "ALT-USDT", Status: "active", TradingEnabled: true}
+	low := models.SelectedPair{ID: 3, Symbol: "LOW-USDT", Status: "active", TradingEnabled: true}
+
+	repo := NewMockDatabaseRepository("main")
+	repo.history["BTC-USDT"] = hourlyCandles(betaCloses(1))
+	repo.history[alt.Symbol] = hourlyCandles(betaCloses(2))
+	repo.history[low.Symbol] = hourlyCandles(betaCloses(0.5))
+	// 100 USDT each of the beta-2 and beta-0.5 pairs: a portfolio beta of 1.25
+	repo.AddPosition(models.Position{PairID: alt.ID, Side: "buy", EntryPrice: 100, CurrentPrice: 100, Quantity: 1, Status: "open"})
+	repo.AddPosition(models.Position{PairID: low.ID, Side: "buy", EntryPrice: 100, CurrentPrice: 100, Quantity: 1, Status: "open"})
+
+	config := testEngineConfig()
+	config.MaxPortfolioBeta = 1.4
+	config.BetaReference = "BTC-USDT"
+	config.BetaWindow = 48 * time.Hour
+	risk := NewRiskManager(repo, nil, config, utils.NewDiscardLogger())
+
+	// Before the first update every entry passes
+	if !risk.withinBetaLimit(alt) {
+		t.Error("withinBetaLimit() = false before any beta estimate, want true")
+	}
+
+	if err := risk.UpdatePortfolioBeta(ctx, []models.SelectedPair{alt, low}); err != nil {
+		t.Fatalf("UpdatePortfolioBeta() error = %v", err)
+	}
+	if got := portfolioBeta(risk.betas.values, risk.betas.betas); math.Abs(got-1.25) > 1e-6 {
+		t.Errorf("portfolio beta = %v, want 1.25", got)
+	}
+
+	// Another 100 USDT of the beta-2 pair takes the portfolio to 1.5
+	if risk.CanTrade(ctx, alt, nil, 100) {
+		t.Error("CanTrade() = true for an entry raising beta above the limit, want false")
+	}
+	// Another 100 USDT of the beta-0.5 pair lowers it to 1
+	if !risk.CanTrade(ctx, low, nil, 100) {
+		t.Error("CanTrade() = false for a beta-lowering entry, want true")
+	}
+}
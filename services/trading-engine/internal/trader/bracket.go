@@ -0,0 +1,297 @@
+package trader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/database"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/exchange"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/sink"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	BracketPending    = "pending"
+	BracketActive     = "active"
+	BracketStopLoss   = "stop_loss"
+	BracketTakeProfit = "take_profit"
+	BracketCancelled  = "cancelled"
+)
+
+// BracketManager protects positions with exchange-side OCO stop loss / take
+// profit orders so they stay protected while the engine is down. A bracket is
+// recorded as pending when the position opens and placed once the entry order
+// has filled; reconciliation then closes the position locally when either leg
+// executes on the exchange.
+type BracketManager struct {
+	repo     database.RepositoryInterface
+	exchange exchange.Exchange
+	trades   *sink.Dispatcher // nil when trade events are not exported
+	config   EngineConfig
+	logger   *logrus.Logger
+}
+
+func NewBracketManager(repo database.RepositoryInterface, exchange exchange.Exchange, trades *sink.Dispatcher, config EngineConfig, logger *logrus.Logger) *BracketManager {
+	return &BracketManager{
+		repo:     repo,
+		exchange: exchange,
+		trades:   trades,
+		config:   config,
+		logger:   logger,
+	}
+}
+
+// Open records a pending bracket for a newly opened position
+func (b *BracketManager) Open(ctx context.Context, pair models.SelectedPair, config models.TradingConfig, position models.Position) error {
+	exitSide := "sell"
+	stopPrice := position.EntryPrice * (1 - config.StopLossPercent)
+	takeProfitPrice := position.EntryPrice * (1 + config.TakeProfitPercent)
+	stopLimitPrice := stopPrice * (1 - b.config.BracketStopLimitOffset)
+
+	if position.Side == "sell" {
+		exitSide = "buy"
+		stopPrice = position.EntryPrice * (1 + config.StopLossPercent)
+		takeProfitPrice = position.EntryPrice * (1 - config.TakeProfitPercent)
+		stopLimitPrice = stopPrice * (1 + b.config.BracketStopLimitOffset)
+	}
+
+	bracket := models.BracketOrder{
+		PositionID:      position.ID,
+		PairID:          pair.ID,
+		Symbol:          pair.Symbol,
+		EntryOrderID:    position.OrderID,
+		Side:            exitSide,
+		Quantity:        position.Quantity,
+		StopPrice:       stopPrice,
+		StopLimitPrice:  stopLimitPrice,
+		TakeProfitPrice: takeProfitPrice,
+		Status:          BracketPending,
+	}
+
+	return b.repo.CreateBracketOrder(ctx, bracket)
+}
+
+// Reconcile advances every open bracket: pending brackets are placed once
+// their entry fills and active brackets are checked for an executed leg
+func (b *BracketManager) Reconcile(ctx context.Context) error {
+	brackets, err := b.repo.GetOpenBracketOrders(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get open bracket orders: %w", err)
+	}
+
+	for _, bracket := range brackets {
+		var err error
+		switch bracket.Status {
+		case BracketPending:
+			err = b.activate(ctx, bracket)
+		case BracketActive:
+			err = b.checkFill(ctx, bracket)
+		}
+		if err != nil {
+			b.logger.WithError(err).WithFields(logrus.Fields{
+				"symbol":      bracket.Symbol,
+				"position_id": bracket.PositionID,
+				"bracket_id":  bracket.ID,
+			}).Error("Failed to reconcile bracket order")
+		}
+	}
+
+	return nil
+}
+
+// Cancel cancels the open bracket of a position before the engine closes it
+// itself, so the exchange legs cannot execute against a flat position
+func (b *BracketManager) Cancel(ctx context.Context, positionID string) error {
+	bracket, err := b.repo.GetOpenBracketOrderByPosition(ctx, positionID)
+	if err != nil {
+		return fmt.Errorf("failed to get bracket order: %w", err)
+	}
+	if bracket == nil {
+		return nil
+	}
+
+	if bracket.Status == BracketActive {
+		if err := b.exchange.CancelBracketOrder(bracket.OCOOrderID); err != nil {
+			return err
+		}
+	}
+
+	return b.finish(ctx, *bracket, BracketCancelled)
+}
+
+func (b *BracketManager) activate(ctx context.Context, bracket models.BracketOrder) error {
+	entry, err := b.exchange.GetOrder(bracket.EntryOrderID)
+	if err != nil {
+		return err
+	}
+
+	if entry.IsActive {
+		return nil // Entry still resting on the book
+	}
+
+	// A malformed fill leaves the bracket pending so it is retried next cycle
+	fill, err := exchange.ParseOrderFill(entry)
+	if err != nil {
+		return err
+	}
+
+	filled := fill.DealSize
+	if filled <= 0 {
+		b.logger.WithFields(logrus.Fields{
+			"symbol":      bracket.Symbol,
+			"position_id": bracket.PositionID,
+		}).Warn("Entry order closed without a fill, dropping bracket")
+		return b.finish(ctx, bracket, BracketCancelled)
+	}
+
+	resp, err := b.exchange.PlaceBracketOrder(bracket.Symbol, bracket.Side, filled,
+		bracket.TakeProfitPrice, bracket.StopPrice, bracket.StopLimitPrice)
+	if err != nil {
+		return err
+	}
+
+	bracket.OCOOrderID = resp.OrderId
+	bracket.Quantity = filled
+	bracket.Status = BracketActive
+
+	b.logger.WithFields(logrus.Fields{
+		"symbol":            bracket.Symbol,
+		"position_id":       bracket.PositionID,
+		"oco_order_id":      bracket.OCOOrderID,
+		"stop_price":        bracket.StopPrice,
+		"take_profit_price": bracket.TakeProfitPrice,
+	}).Info("Bracket order placed")
+
+	return b.repo.UpdateBracketOrder(ctx, bracket)
+}
+
+func (b *BracketManager) checkFill(ctx context.Context, bracket models.BracketOrder) error {
+	details, err := b.exchange.GetBracketOrder(bracket.OCOOrderID)
+	if err != nil {
+		return err
+	}
+
+	switch details.Status {
+	case "NEW":
+		return nil
+	case "CANCELLED":
+		b.logger.WithFields(logrus.Fields{
+			"symbol":       bracket.Symbol,
+			"position_id":  bracket.PositionID,
+			"oco_order_id": bracket.OCOOrderID,
+		}).Warn("Bracket order cancelled outside the engine, position is no longer protected")
+		return b.finish(ctx, bracket, BracketCancelled)
+	}
+
+	leg, ok := executedLeg(details)
+	if !ok {
+		return nil
+	}
+
+	stopPrice, err := utils.ParseFloat(leg.StopPrice)
+	if err != nil {
+		return fmt.Errorf("invalid stop price %q on leg %s: %w", leg.StopPrice, leg.ID, err)
+	}
+	exitPrice, err := utils.ParseFloat(leg.Price)
+	if err != nil {
+		return fmt.Errorf("invalid price %q on leg %s: %w", leg.Price, leg.ID, err)
+	}
+
+	status := BracketTakeProfit
+	if stopPrice > 0 {
+		status = BracketStopLoss
+	}
+
+	if exitPrice <= 0 {
+		exitPrice = bracket.TakeProfitPrice
+		if status == BracketStopLoss {
+			exitPrice = bracket.StopLimitPrice
+		}
+	}
+
+	if err := b.closePosition(ctx, bracket, leg, exitPrice, status); err != nil {
+		return err
+	}
+
+	return b.finish(ctx, bracket, status)
+}
+
+// closePosition records the exit executed by a bracket leg; the sibling leg
+// has already been cancelled by the exchange
+func (b *BracketManager) closePosition(ctx context.Context, bracket models.BracketOrder, leg kucoin.OCOLeg, exitPrice float64, status string) error {
+	position, err := b.repo.GetPositionByID(ctx, bracket.PositionID)
+	if err != nil {
+		return err
+	}
+
+	if position.Status == "closed" {
+		return nil
+	}
+
+	// The leg's order is recorded as filled and never reconciled, so its fee
+	// is always estimated. PnL is added to, not overwritten: the entry fee
+	// may already have been deducted.
+	now := time.Now()
+	fees := closingFees(b.exchange, b.config, bracket.Symbol, position.EntryPrice, exitPrice, bracket.Quantity, false, b.logger)
+	realized := computeRealizedPnL(position.Side, position.EntryPrice, exitPrice, bracket.Quantity, fees)
+	position.RealizedPnL += realized
+	position.TotalFees += fees
+	position.CurrentPrice = exitPrice
+	position.UnrealizedPnL = 0
+	position.Status = "closed"
+	position.ClosedAt = &now
+
+	if err := b.repo.UpdatePosition(ctx, *position); err != nil {
+		return fmt.Errorf("failed to update position: %w", err)
+	}
+	metrics.OrdersFilled.WithLabelValues(bracket.Symbol, bracket.Side).Inc()
+	metrics.RealizedPnL.WithLabelValues(b.repo.Account()).Add(realized)
+
+	b.logger.WithFields(logrus.Fields{
+		"symbol":       bracket.Symbol,
+		"position_id":  position.ID,
+		"exit_price":   exitPrice,
+		"realized_pnl": position.RealizedPnL,
+		"leg":          status,
+	}).Info("Bracket leg executed, position closed")
+	b.trades.Publish(closedEvent(bracket.Symbol, *position, exitPrice, status))
+
+	order := models.Order{
+		PositionID:     &position.ID,
+		PairID:         bracket.PairID,
+		KuCoinOrderID:  leg.ID,
+		Side:           bracket.Side,
+		Type:           "limit",
+		Quantity:       bracket.Quantity,
+		Price:          exitPrice,
+		FilledQuantity: bracket.Quantity,
+		Status:         "filled",
+		StrategyTag:    position.StrategyTag,
+		ConfigVersion:  position.ConfigVersion,
+	}
+
+	return b.repo.CreateOrder(ctx, order)
+}
+
+func (b *BracketManager) finish(ctx context.Context, bracket models.BracketOrder, status string) error {
+	now := time.Now()
+	bracket.Status = status
+	bracket.ClosedAt = &now
+
+	return b.repo.UpdateBracketOrder(ctx, bracket)
+}
+
+// executedLeg returns the leg of a triggered OCO that executed
+func executedLeg(details *kucoin.OCOOrderDetails) (kucoin.OCOLeg, bool) {
+	for _, leg := range details.Orders {
+		if leg.Status == "DONE" || leg.Status == "TRIGGERED" {
+			return leg, true
+		}
+	}
+	return kucoin.OCOLeg{}, false
+}
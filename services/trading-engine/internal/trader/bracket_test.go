@@ -0,0 +1,266 @@
+package trader
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+func bracketTestConfig() EngineConfig {
+	return EngineConfig{BracketOrdersEnabled: true, BracketStopLimitOffset: 0.01, ExitFeeRate: 0.001}
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestBracketPlacement(t *testing.T) {
+	tests := []struct {
+		name           string
+		side           string
+		wantExitSide   string
+		wantStop       float64
+		wantStopLimit  float64
+		wantTakeProfit float64
+	}{
+		{name: "long", side: "buy", wantExitSide: "sell", wantStop: 95, wantStopLimit: 94.05, wantTakeProfit: 110},
+		{name: "short", side: "sell", wantExitSide: "buy", wantStop: 105, wantStopLimit: 106.05, wantTakeProfit: 90},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := NewMockDatabaseRepository("main")
+			ex := NewMockExchange()
+			brackets := NewBracketManager(repo, ex, nil, bracketTestConfig(), utils.NewDiscardLogger())
+
+			position := repo.AddPosition(models.Position{
+				PairID: testPair.ID, OrderID: "entry-1", Side: tt.side,
+				EntryPrice: 100, Quantity: 1, Status: "open",
+			})
+			config := models.TradingConfig{StopLossPercent: 0.05, TakeProfitPercent: 0.1}
+			if err := brackets.Open(ctx, testPair, config, position); err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+
+			// The entry is still resting: the bracket waits
+			ex.orders["entry-1"] = &kucoin.Order{ID: "entry-1", IsActive: true}
+			if err := brackets.Reconcile(ctx); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if placed := ex.Placed(); len(placed) != 0 {
+				t.Fatalf("placed %+v before the entry filled, want nothing", placed)
+			}
+
+			// A partial fill protects only what was bought
+			ex.orders["entry-1"] = &kucoin.Order{ID: "entry-1", DealSize: "0.8", DealFunds: "80", Fee: "0.08"}
+			if err := brackets.Reconcile(ctx); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			placed := ex.Placed()
+			if len(placed) != 1 {
+				t.Fatalf("placed %d orders, want one bracket", len(placed))
+			}
+			if got := placed[0]; got.Type != "bracket" || got.Side != tt.wantExitSide || got.Quantity != 0.8 || !approxEqual(got.Price, tt.wantTakeProfit) {
+				t.Errorf("placed %+v, want a %s bracket for 0.8 with take profit %v", got, tt.wantExitSide, tt.wantTakeProfit)
+			}
+
+			stored := repo.Brackets()
+			if len(stored) != 1 {
+				t.Fatalf("stored %d brackets, want 1", len(stored))
+			}
+			bracket := stored[0]
+			if bracket.Status != BracketActive || bracket.OCOOrderID != placed[0].ID || bracket.Quantity != 0.8 {
+				t.Errorf("bracket = %+v, want active with OCO %s for 0.8", bracket, placed[0].ID)
+			}
+			if !approxEqual(bracket.StopPrice, tt.wantStop) || !approxEqual(bracket.StopLimitPrice, tt.wantStopLimit) {
+				t.Errorf("stop = %v/%v, want %v/%v", bracket.StopPrice, bracket.StopLimitPrice, tt.wantStop, tt.wantStopLimit)
+			}
+		})
+	}
+}
+
+func TestBracketEntryWithoutFillIsDropped(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockDatabaseRepository("main")
+	ex := NewMockExchange()
+	brackets := NewBracketManager(repo, ex, nil, bracketTestConfig(), utils.NewDiscardLogger())
+
+	repo.AddBracketOrder(models.BracketOrder{PositionID: "position-1", Symbol: testSymbol, EntryOrderID: "entry-1", Status: BracketPending})
+	ex.orders["entry-1"] = &kucoin.Order{ID: "entry-1", DealSize: "0"}
+
+	if err := brackets.Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if placed := ex.Placed(); len(placed) != 0 {
+		t.Errorf("placed %+v for an unfilled entry, want nothing", placed)
+	}
+	if got := repo.Brackets()[0].Status; got != BracketCancelled {
+		t.Errorf("bracket status = %s, want %s", got, BracketCancelled)
+	}
+}
+
+func TestBracketReconcileOnLegFill(t *testing.T) {
+	tests := []struct {
+		name          string
+		legs          []kucoin.OCOLeg
+		wantStatus    string
+		wantExitPrice float64
+	}{
+		{
+			name: "take profit fills, stop cancelled by the exchange",
+			legs: []kucoin.OCOLeg{
+				{ID: "leg-tp", Price: "110", Status: "DONE"},
+				{ID: "leg-sl", Price: "94.05", StopPrice: "95", Status: "CANCELLED"},
+			},
+			wantStatus:    BracketTakeProfit,
+			wantExitPrice: 110,
+		},
+		{
+			name: "stop triggers, take profit cancelled by the exchange",
+			legs: []kucoin.OCOLeg{
+				{ID: "leg-tp", Price: "110", Status: "CANCELLED"},
+				{ID: "leg-sl", Price: "94.05", StopPrice: "95", Status: "TRIGGERED"},
+			},
+			wantStatus:    BracketStopLoss,
+			wantExitPrice: 94.05,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := NewMockDatabaseRepository("main")
+			ex := NewMockExchange()
+			brackets := NewBracketManager(repo, ex, nil, bracketTestConfig(), utils.NewDiscardLogger())
+
+			position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 100, Quantity: 1, Status: "open"})
+			repo.AddBracketOrder(models.BracketOrder{
+				PositionID: position.ID, PairID: testPair.ID, Symbol: testSymbol, OCOOrderID: "oco-1",
+				Side: "sell", Quantity: 1, StopPrice: 95, StopLimitPrice: 94.05, TakeProfitPrice: 110,
+				Status: BracketActive,
+			})
+			ex.brackets["oco-1"] = &kucoin.OCOOrderDetails{OrderID: "oco-1", Status: "DONE", Orders: tt.legs}
+
+			if err := brackets.Reconcile(ctx); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			closed := repo.Positions()[0]
+			if closed.Status != "closed" || closed.ClosedAt == nil || closed.CurrentPrice != tt.wantExitPrice {
+				t.Fatalf("position = %+v, want closed at %v", closed, tt.wantExitPrice)
+			}
+			fees := (100 + tt.wantExitPrice) * 0.001
+			if want := tt.wantExitPrice - 100 - fees; !approxEqual(closed.RealizedPnL, want) {
+				t.Errorf("realized PnL = %v, want %v", closed.RealizedPnL, want)
+			}
+
+			if got := repo.Brackets()[0].Status; got != tt.wantStatus {
+				t.Errorf("bracket status = %s, want %s", got, tt.wantStatus)
+			}
+
+			orders := repo.Orders()
+			if len(orders) != 1 || orders[0].Status != "filled" || orders[0].Price != tt.wantExitPrice {
+				t.Fatalf("orders = %+v, want one filled exit at %v", orders, tt.wantExitPrice)
+			}
+
+			// The exchange cancelled the sibling; the engine must not cancel
+			// again, and a later cycle must not close the position twice
+			if cancelled := ex.Cancelled(); len(cancelled) != 0 {
+				t.Errorf("cancelled %v, want the sibling left to the exchange", cancelled)
+			}
+			if err := brackets.Reconcile(ctx); err != nil {
+				t.Fatalf("second Reconcile() error = %v", err)
+			}
+			if got := len(repo.Orders()); got != 1 {
+				t.Errorf("recorded %d exit orders after a second cycle, want 1", got)
+			}
+		})
+	}
+}
+
+func TestBracketCancelledOnExchangeLeavesPositionOpen(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockDatabaseRepository("main")
+	ex := NewMockExchange()
+	brackets := NewBracketManager(repo, ex, nil, bracketTestConfig(), utils.NewDiscardLogger())
+
+	position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 100, Quantity: 1, Status: "open"})
+	repo.AddBracketOrder(models.BracketOrder{PositionID: position.ID, Symbol: testSymbol, OCOOrderID: "oco-1", Status: BracketActive})
+	ex.brackets["oco-1"] = &kucoin.OCOOrderDetails{OrderID: "oco-1", Status: "CANCELLED"}
+
+	if err := brackets.Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if got := repo.Positions()[0].Status; got != "open" {
+		t.Errorf("position status = %s, want open", got)
+	}
+	if got := repo.Brackets()[0].Status; got != BracketCancelled {
+		t.Errorf("bracket status = %s, want %s", got, BracketCancelled)
+	}
+}
+
+func TestBracketCancelBeforeEngineClose(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockDatabaseRepository("main")
+	ex := NewMockExchange()
+	brackets := NewBracketManager(repo, ex, nil, bracketTestConfig(), utils.NewDiscardLogger())
+
+	repo.AddBracketOrder(models.BracketOrder{PositionID: "position-1", Symbol: testSymbol, OCOOrderID: "oco-1", Status: BracketActive})
+
+	if err := brackets.Cancel(ctx, "position-1"); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+
+	if cancelled := ex.Cancelled(); len(cancelled) != 1 || cancelled[0] != "oco-1" {
+		t.Errorf("cancelled %v, want [oco-1]", cancelled)
+	}
+	if got := repo.Brackets()[0].Status; got != BracketCancelled {
+		t.Errorf("bracket status = %s, want %s", got, BracketCancelled)
+	}
+}
+
+func TestBracketMalformedFieldsAreRetried(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockDatabaseRepository("main")
+	ex := NewMockExchange()
+	brackets := NewBracketManager(repo, ex, nil, bracketTestConfig(), utils.NewDiscardLogger())
+
+	position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 100, Quantity: 1, Status: "open"})
+	repo.AddBracketOrder(models.BracketOrder{PositionID: "position-pending", Symbol: testSymbol, EntryOrderID: "entry-1", Status: BracketPending})
+	repo.AddBracketOrder(models.BracketOrder{PositionID: position.ID, Symbol: testSymbol, OCOOrderID: "oco-1", Side: "sell", Quantity: 1, Status: BracketActive})
+
+	// A malformed deal size is not a zero fill, and a malformed leg price is
+	// not an execution at the planned price
+	ex.orders["entry-1"] = &kucoin.Order{ID: "entry-1", DealSize: "0,8"}
+	ex.brackets["oco-1"] = &kucoin.OCOOrderDetails{OrderID: "oco-1", Status: "DONE", Orders: []kucoin.OCOLeg{
+		{ID: "leg-tp", Price: "1l0", Status: "DONE"},
+	}}
+
+	if err := brackets.Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if placed := ex.Placed(); len(placed) != 0 {
+		t.Errorf("placed %+v on a malformed entry fill, want nothing", placed)
+	}
+	for _, bracket := range repo.Brackets() {
+		want := BracketActive
+		if bracket.EntryOrderID == "entry-1" {
+			want = BracketPending
+		}
+		if bracket.Status != want {
+			t.Errorf("bracket %s status = %s, want %s kept for the next cycle", bracket.ID, bracket.Status, want)
+		}
+	}
+	if got := repo.Positions()[0].Status; got != "open" {
+		t.Errorf("position status = %s, want open", got)
+	}
+}
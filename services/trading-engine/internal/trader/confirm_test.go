@@ -0,0 +1,92 @@
+package trader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/signals"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// candleHistory serves the same candles for every symbol
+type candleHistory []models.Candle
+
+func (h candleHistory) GetPriceHistory(context.Context, string, time.Time) ([]models.Candle, error) {
+	return h, nil
+}
+
+// rallyCloses mirrors sellOffCloses, leaving RSI deeply overbought: the basic
+// strategy reads it as a SELL
+func rallyCloses(start float64) []float64 {
+	closes := sellOffCloses(start)
+	for i, price := range closes {
+		closes[i] = 2*start - price
+	}
+	return closes
+}
+
+func TestSignalExitWaitsForHigherTimeframe(t *testing.T) {
+	tests := []struct {
+		name         string
+		confirmExits bool
+		higher       []float64 // Closes of the confirmation timeframe, nil for no confirmation generator
+		wantExit     bool
+	}{
+		{name: "confirmation not required", higher: sellOffCloses(100), wantExit: true},
+		{name: "higher timeframe still buying", confirmExits: true, higher: sellOffCloses(100)},
+		{name: "higher timeframe confirms", confirmExits: true, higher: rallyCloses(100), wantExit: true},
+		{name: "no confirmation timeframe configured", confirmExits: true, wantExit: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+			seedSellOff(repo)
+			candles := hourlyCandles(rallyCloses(100))
+			price := candles[len(candles)-1].Close
+			repo.history[testSymbol] = candles
+			repo.quotes[testSymbol] = price
+			repo.configs[testPair.ID].ConfirmExits = tt.confirmExits
+			repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", Quantity: 1, EntryPrice: 100, Status: "open"})
+
+			engine := newTestEngine(repo, ex, testEngineConfig())
+			if tt.higher != nil {
+				engine.exitSignals = signals.NewGenerator(candleHistory(hourlyCandles(tt.higher)), signals.Config{}, utils.NewDiscardLogger())
+			}
+
+			if err := engine.processPair(context.Background(), testPair); err != nil {
+				t.Fatalf("processPair() error = %v", err)
+			}
+
+			exited := false
+			for _, order := range ex.Placed() {
+				exited = exited || order.Side == "sell"
+			}
+			if exited != tt.wantExit {
+				t.Errorf("placed a sell = %v, want %v", exited, tt.wantExit)
+			}
+		})
+	}
+}
+
+func TestStopLossIgnoresExitConfirmation(t *testing.T) {
+	repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+	seedSellOff(repo)
+	repo.configs[testPair.ID].ConfirmExits = true
+	// Entered above the 5% stop loss of the current price
+	repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", Quantity: 1, EntryPrice: 101, Status: "open"})
+
+	engine := newTestEngine(repo, ex, testEngineConfig())
+	engine.exitSignals = signals.NewGenerator(candleHistory(hourlyCandles(sellOffCloses(100))), signals.Config{}, utils.NewDiscardLogger())
+
+	if err := engine.processPair(context.Background(), testPair); err != nil {
+		t.Fatalf("processPair() error = %v", err)
+	}
+
+	placed := ex.Placed()
+	if len(placed) == 0 || placed[0].Side != "sell" || placed[0].Type != "market" {
+		t.Fatalf("placed %+v, want the stop loss market sell despite no confirmation", placed)
+	}
+}
@@ -0,0 +1,112 @@
+package trader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// DecisionContext is the snapshot of everything an entry was decided on,
+// stored as JSON with the resulting position so the trade can be explained
+// after the fact
+type DecisionContext struct {
+	Symbol    string    `json:"symbol"`
+	DecidedAt time.Time `json:"decided_at"`
+
+	Signal DecisionSignal `json:"signal"`
+
+	StoredPrice  float64 `json:"stored_price"` // Latest stored close the signal was generated at
+	OrderPrice   float64 `json:"order_price"`  // Price the order was placed at
+	PositionSize float64 `json:"position_size"`
+	Quantity     float64 `json:"quantity"`
+
+	StrategyTag   string `json:"strategy_tag"`
+	ConfigVersion string `json:"config_version"`
+	ConfigID      string `json:"config_id"`
+	SizingMode    string `json:"sizing_mode"`
+
+	OpenPositions []DecisionPosition `json:"open_positions"`
+	Risk          DecisionRisk       `json:"risk"`
+}
+
+// DecisionSignal is the signal behind an entry, including its indicator values
+type DecisionSignal struct {
+	Action     string                 `json:"action"`
+	Strength   float64                `json:"strength"`
+	Reason     string                 `json:"reason"`
+	Indicators map[string]interface{} `json:"indicators"`
+}
+
+// DecisionPosition is an open position on the pair at decision time
+type DecisionPosition struct {
+	ID            string  `json:"id"`
+	Side          string  `json:"side"`
+	Quantity      float64 `json:"quantity"`
+	EntryPrice    float64 `json:"entry_price"`
+	UnrealizedPnL float64 `json:"unrealized_pnl"`
+}
+
+// DecisionRisk is the risk state at decision time
+type DecisionRisk struct {
+	PortfolioHalted bool `json:"portfolio_halted"`
+	PairHalted      bool `json:"pair_halted"`
+}
+
+// newDecisionContext captures the inputs of an entry on the pair
+func (e *Engine) newDecisionContext(pair models.SelectedPair, config models.TradingConfig, signal models.Signal,
+	positions []models.Position, storedPrice, orderPrice, positionSize, quantity float64) DecisionContext {
+
+	decision := DecisionContext{
+		Symbol:    pair.Symbol,
+		DecidedAt: time.Now(),
+		Signal: DecisionSignal{
+			Action:     signal.Action,
+			Strength:   signal.Strength,
+			Reason:     signal.Reason,
+			Indicators: signal.Metadata,
+		},
+		StoredPrice:   storedPrice,
+		OrderPrice:    orderPrice,
+		PositionSize:  positionSize,
+		Quantity:      quantity,
+		StrategyTag:   e.strategyTag(config),
+		ConfigVersion: e.config.ConfigVersion,
+		ConfigID:      config.ID,
+		SizingMode:    config.SizingMode,
+		OpenPositions: make([]DecisionPosition, 0, len(positions)),
+		Risk: DecisionRisk{
+			PortfolioHalted: e.riskManager.IsPortfolioHalted(),
+			PairHalted:      e.riskManager.IsPairHalted(pair.ID),
+		},
+	}
+
+	for _, position := range positions {
+		decision.OpenPositions = append(decision.OpenPositions, DecisionPosition{
+			ID:            position.ID,
+			Side:          position.Side,
+			Quantity:      position.Quantity,
+			EntryPrice:    position.EntryPrice,
+			UnrealizedPnL: position.UnrealizedPnL,
+		})
+	}
+
+	return decision
+}
+
+// recordDecision stores the decision snapshot of a placed entry
+func (e *Engine) recordDecision(ctx context.Context, position models.Position, decision DecisionContext) error {
+	encoded, err := json.Marshal(decision)
+	if err != nil {
+		return fmt.Errorf("failed to encode trade decision: %w", err)
+	}
+
+	return e.repo.CreateTradeDecision(ctx, models.TradeDecision{
+		PositionID:    position.ID,
+		KuCoinOrderID: position.OrderID,
+		Symbol:        decision.Symbol,
+		Context:       encoded,
+	})
+}
@@ -0,0 +1,173 @@
+package trader
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/database"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// DriftReport compares one strategy configuration's live results over the
+// drift window with its backtest baseline
+type DriftReport struct {
+	StrategyTag   string    `json:"strategy_tag"`
+	ConfigVersion string    `json:"config_version"`
+	LiveTrades    int       `json:"live_trades"`
+	LiveWinRate   float64   `json:"live_win_rate"`
+	LiveAvgPnL    float64   `json:"live_avg_pnl"`
+	BaseWinRate   float64   `json:"baseline_win_rate"`
+	BaseAvgPnL    float64   `json:"baseline_avg_pnl"`
+	WinRateDrift  float64   `json:"win_rate_drift"` // Live minus baseline win rate
+	AvgPnLDrift   float64   `json:"avg_pnl_drift"`  // Live minus baseline average PnL, relative to the baseline
+	Sufficient    bool      `json:"sufficient"`     // Enough live trades to judge drift
+	Drifted       bool      `json:"drifted"`
+	EvaluatedAt   time.Time `json:"evaluated_at"`
+}
+
+// DriftMonitor periodically compares live realized results of every strategy
+// configuration that has a backtest baseline against that baseline, and
+// alerts when they diverge beyond the configured tolerances. Sustained drift
+// points at a regime change the backtest did not cover, or at a bug.
+type DriftMonitor struct {
+	repo   *database.Repository
+	config EngineConfig
+	logger *logrus.Logger
+
+	mu      sync.RWMutex
+	reports []DriftReport
+	drifted map[string]bool // Alerted configurations, so an alert fires once per episode
+}
+
+func NewDriftMonitor(repo *database.Repository, config EngineConfig, logger *logrus.Logger) *DriftMonitor {
+	return &DriftMonitor{
+		repo:    repo,
+		config:  config,
+		logger:  logger,
+		drifted: make(map[string]bool),
+	}
+}
+
+// Run evaluates drift on the configured interval until the context is
+// cancelled
+func (d *DriftMonitor) Run(ctx context.Context) error {
+	if d.config.DriftCheckInterval <= 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(d.config.DriftCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Evaluate(ctx); err != nil {
+			d.logger.WithError(err).Warn("Failed to evaluate backtest drift")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Evaluate recomputes the drift of every baselined strategy configuration
+func (d *DriftMonitor) Evaluate(ctx context.Context) error {
+	baselines, err := d.repo.GetBacktestBaselines(ctx)
+	if err != nil {
+		return err
+	}
+
+	since := time.Now().Add(-d.config.DriftWindow)
+	reports := make([]DriftReport, 0, len(baselines))
+
+	for _, baseline := range baselines {
+		trades, wins, pnl, err := d.repo.GetLiveTradeStats(ctx, baseline.StrategyTag, baseline.ConfigVersion, since)
+		if err != nil {
+			return err
+		}
+
+		report := d.compare(baseline, trades, wins, pnl)
+		d.alert(report)
+		reports = append(reports, report)
+	}
+
+	d.mu.Lock()
+	d.reports = reports
+	d.mu.Unlock()
+
+	return nil
+}
+
+// Reports returns the most recent evaluation
+func (d *DriftMonitor) Reports() []DriftReport {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return append([]DriftReport(nil), d.reports...)
+}
+
+// compare measures live results against the baseline. The win rate drift is
+// an absolute difference; the average PnL drift is relative to the baseline
+// and left at zero when the baseline broke even.
+func (d *DriftMonitor) compare(baseline models.BacktestBaseline, trades, wins int, pnl float64) DriftReport {
+	report := DriftReport{
+		StrategyTag:   baseline.StrategyTag,
+		ConfigVersion: baseline.ConfigVersion,
+		LiveTrades:    trades,
+		BaseWinRate:   baseline.WinRate,
+		BaseAvgPnL:    baseline.AvgPnLPerTrade,
+		EvaluatedAt:   time.Now(),
+	}
+
+	if trades > 0 {
+		report.LiveWinRate = float64(wins) / float64(trades)
+		report.LiveAvgPnL = pnl / float64(trades)
+	}
+
+	report.Sufficient = trades >= d.config.DriftMinTrades && trades > 0
+	if !report.Sufficient {
+		return report
+	}
+
+	report.WinRateDrift = report.LiveWinRate - baseline.WinRate
+	if baseline.AvgPnLPerTrade != 0 {
+		report.AvgPnLDrift = (report.LiveAvgPnL - baseline.AvgPnLPerTrade) / math.Abs(baseline.AvgPnLPerTrade)
+	}
+
+	report.Drifted = (d.config.DriftWinRateTolerance > 0 && math.Abs(report.WinRateDrift) > d.config.DriftWinRateTolerance) ||
+		(d.config.DriftAvgPnLTolerance > 0 && math.Abs(report.AvgPnLDrift) > d.config.DriftAvgPnLTolerance)
+
+	return report
+}
+
+// alert publishes the drift metrics and logs when a configuration starts or
+// stops drifting
+func (d *DriftMonitor) alert(report DriftReport) {
+	metrics.StrategyDrift.WithLabelValues(report.StrategyTag, report.ConfigVersion, "win_rate").Set(report.WinRateDrift)
+	metrics.StrategyDrift.WithLabelValues(report.StrategyTag, report.ConfigVersion, "avg_pnl").Set(report.AvgPnLDrift)
+
+	key := report.StrategyTag + "|" + report.ConfigVersion
+	fields := logrus.Fields{
+		"strategy_tag":      report.StrategyTag,
+		"config_version":    report.ConfigVersion,
+		"live_trades":       report.LiveTrades,
+		"live_win_rate":     report.LiveWinRate,
+		"baseline_win_rate": report.BaseWinRate,
+		"live_avg_pnl":      report.LiveAvgPnL,
+		"baseline_avg_pnl":  report.BaseAvgPnL,
+	}
+
+	switch {
+	case report.Drifted && !d.drifted[key]:
+		d.drifted[key] = true
+		d.logger.WithFields(fields).Warn("Live results drifted from backtest baseline")
+	case !report.Drifted && d.drifted[key] && report.Sufficient:
+		delete(d.drifted, key)
+		d.logger.WithFields(fields).Info("Live results back in line with backtest baseline")
+	}
+}
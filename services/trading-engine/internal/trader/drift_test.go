@@ -0,0 +1,88 @@
+package trader
+
+import (
+	"testing"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func driftTestConfig() EngineConfig {
+	return EngineConfig{DriftMinTrades: 20, DriftWinRateTolerance: 0.15, DriftAvgPnLTolerance: 0.5}
+}
+
+func TestDriftDetection(t *testing.T) {
+	// The backtest won 60% of its trades at 2 USDT on average
+	baseline := models.BacktestBaseline{StrategyTag: "momentum", ConfigVersion: "v3", WinRate: 0.6, AvgPnLPerTrade: 2}
+
+	tests := []struct {
+		name           string
+		trades, wins   int
+		pnl            float64
+		wantSufficient bool
+		wantDrifted    bool
+	}{
+		{name: "tracking the backtest", trades: 40, wins: 23, pnl: 76, wantSufficient: true},
+		{name: "win rate collapsed", trades: 40, wins: 14, pnl: 80, wantSufficient: true, wantDrifted: true},
+		{name: "average PnL halved and more", trades: 40, wins: 24, pnl: 30, wantSufficient: true, wantDrifted: true},
+		{name: "losing where the backtest won", trades: 40, wins: 24, pnl: -40, wantSufficient: true, wantDrifted: true},
+		{name: "too few trades to judge", trades: 5, wins: 0, pnl: -50},
+		{name: "no live trades", trades: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := NewDriftMonitor(nil, driftTestConfig(), utils.NewDiscardLogger())
+
+			report := monitor.compare(baseline, tt.trades, tt.wins, tt.pnl)
+			if report.Sufficient != tt.wantSufficient || report.Drifted != tt.wantDrifted {
+				t.Fatalf("sufficient/drifted = %v/%v, want %v/%v (report %+v)",
+					report.Sufficient, report.Drifted, tt.wantSufficient, tt.wantDrifted, report)
+			}
+			if !tt.wantSufficient && (report.WinRateDrift != 0 || report.AvgPnLDrift != 0) {
+				t.Errorf("drift = %v/%v on too few trades, want none", report.WinRateDrift, report.AvgPnLDrift)
+			}
+		})
+	}
+}
+
+func TestDriftAlertsOncePerEpisode(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	monitor := NewDriftMonitor(nil, driftTestConfig(), logger)
+	baseline := models.BacktestBaseline{StrategyTag: "momentum", ConfigVersion: "v3", WinRate: 0.6, AvgPnLPerTrade: 2}
+
+	countLevel := func(level logrus.Level) int {
+		count := 0
+		for _, entry := range hook.AllEntries() {
+			if entry.Level == level {
+				count++
+			}
+		}
+		return count
+	}
+
+	// Drifting across two evaluations warns once
+	monitor.alert(monitor.compare(baseline, 40, 10, 0))
+	monitor.alert(monitor.compare(baseline, 40, 10, 0))
+	if got := countLevel(logrus.WarnLevel); got != 1 {
+		t.Fatalf("logged %d drift warnings over two evaluations, want 1", got)
+	}
+
+	// Too few trades does not end the episode
+	monitor.alert(monitor.compare(baseline, 3, 2, 6))
+	if got := countLevel(logrus.InfoLevel); got != 0 {
+		t.Fatalf("logged %d recoveries on too few trades, want 0", got)
+	}
+
+	// Back in line, then drifting again alerts afresh
+	monitor.alert(monitor.compare(baseline, 40, 24, 80))
+	monitor.alert(monitor.compare(baseline, 40, 10, 0))
+	if got := countLevel(logrus.InfoLevel); got != 1 {
+		t.Errorf("logged %d recoveries, want 1", got)
+	}
+	if got := countLevel(logrus.WarnLevel); got != 2 {
+		t.Errorf("logged %d drift warnings, want 2 for two episodes", got)
+	}
+}
@@ -5,45 +5,270 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/quotes"
 	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/database"
 	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/exchange"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/pricing"
 	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/signals"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/sink"
 	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
 	"github.com/sirupsen/logrus"
 )
 
 type Engine struct {
-	repo            *database.Repository
-	exchange        *exchange.KuCoinExchange
+	repo            database.RepositoryInterface
+	exchange        exchange.Exchange
 	signalGenerator *signals.Generator
+	exitSignals     *signals.Generator // nil when signal exits need no confirmation
 	gridStrategy    *GridStrategy
 	riskManager     *RiskManager
+	priceHistory    signals.PriceHistoryProvider
+	positionSizer   *PositionSizer
+	brackets        *BracketManager
+	fills           *FillReconciler
+	stranded        *StrandedOrderRecovery
+	staleOrders     *StaleOrderCanceller
+	configs         *ConfigQuarantine
+	flatlines       *FlatlineDetector
+	referencePrices *pricing.ReferenceChecker // nil when reference pricing is disabled
+	livePrices      LivePriceProvider         // nil prices orders from the stored close
+	trades          *sink.Dispatcher          // nil when trade events are not exported
+	decisions       *DecisionRecorder         // nil when basic strategy decisions are not recorded
+	quoteRates      *quotes.Converter         // nil values every quote currency 1:1 with USDT
 	logger          *logrus.Logger
 	config          EngineConfig
+
+	done chan struct{} // Closed when Run returns
+
+	stalePricePairs int // Pairs of the current cycle whose stored price was stale
+}
+
+// LivePriceProvider quotes a symbol's current best bid and ask
+type LivePriceProvider interface {
+	Quote(symbol string) (float64, float64, error)
 }
 
 type EngineConfig struct {
-	MaxPositionsPerPair int
-	DefaultPositionSize float64
-	StopLossPercent     float64
-	TakeProfitPercent   float64
+	MaxPositionsPerPair  int
+	DefaultPositionSize  float64
+	StopLossPercent      float64
+	TakeProfitPercent    float64
+	TakeProfitLevels     int     // Take profit ladder levels, each closing an equal share of the position
+	ExitTieBreak         string  // ExitTieBreakClose, ExitTieBreakStopFirst or ExitTieBreakCandleOpen
+	FlattenDisabledPairs bool    // Close open positions on pairs whose trading has been disabled
+	MaxRiskPerTradeUSDT  float64 // Largest loss a single position may incur at its stop loss, 0 disables
+	MinRiskReward        float64 // Take profit distance over stop loss distance an entry needs, 0 disables
+	ExposureMode         string  // ExposureGross or ExposureNet, applied to the per-pair exposure limit
+	SkipIdleHolds        bool    // Stop processing a non-grid pair early on a HOLD signal with no open positions
+
+	// Portfolio beta limit
+	MaxPortfolioBeta float64       // Exposure-weighted beta to BetaReference entries may not raise beyond, 0 disables
+	BetaReference    string        // Symbol betas are measured against, e.g. BTC-USDT
+	BetaWindow       time.Duration // Returns the betas are estimated from
+
+	// Grid recentering
+	GridRecenterMargin float64 // How far beyond its range price must move before the grid is rebuilt, 0 disables
+
+	// Grid level orders
+	GridOrdersEnabled    bool          // Place orders at the grid levels rather than only logging them
+	GridOrderCancelAfter time.Duration // Lifetime of a level order before the exchange expires it (GTT), 0 keeps it until cancelled
+
+	// Strategy attribution recorded on new positions and orders
+	StrategyTag   string // Overrides the trading config's strategy type when set
+	ConfigVersion string
+
+	// Trailing stop
+	TrailingStopPercent    float64 // Distance behind the high-water mark for pairs without their own; 0 trails only those that set one
+	TrailingStopActivation float64 // Favourable move from entry required before the trail is armed
+
+	// Record each position's maximum favorable and adverse excursion
+	TrackExcursions bool
+
+	// Retries of a failed mark-to-market write; exits use the fresh price either way
+	PnLWriteRetries    int
+	PnLWriteRetryDelay time.Duration // Delay before the first retry, doubling after each
+
+	// Store the inputs behind each entry for post-mortems
+	RecordDecisions bool
+
+	// Publish portfolio-level gauges at the end of each cycle
+	PortfolioMetrics bool
+
+	// Fee floor on discretionary closes; stops always execute
+	ExitFeeFloorEnabled bool
+	ExitFeeRate         float64 // Fee rate assumed on both the entry and the exit; also estimates booked fees when the account's rates are not cached
+	ExitMinNetPnL       float64 // Least net-of-fees PnL a discretionary close must realize
+
+	// Unit of the default position size for newly created trading configs
+	SizingMode                 string // models.SizingQuoteFunds, SizingBaseQuantity or SizingBalancePercent
+	DefaultPositionSizeBase    float64
+	DefaultPositionSizePercent float64
+
+	// Signal exits of pairs with confirm_exits wait for the higher timeframe
+	ConfirmExitsDefault bool // confirm_exits of newly created trading configs
+
+	// Volatility-adjusted sizing
+	SizingVolatilityModel  string // "ewma" or "simple"
+	SizingEWMALambda       float64
+	SizingTargetVolatility float64
+	SizingVolatilityWindow time.Duration
+
+	// Performance-adaptive sizing
+	AdaptiveSizingEnabled       bool
+	AdaptiveSizingLookback      int     // Most recent closed positions the win rate and PnL are measured over
+	AdaptiveSizingMinTrades     int     // Closed positions required before the multiplier departs from 1
+	AdaptiveSizingMinMultiplier float64 // Multiplier after a lookback of only losses
+	AdaptiveSizingMaxMultiplier float64 // Multiplier after a lookback of only wins
+
+	// Size ramp for strategies without a track record
+	SizeRampEnabled       bool
+	SizeRampStartFraction float64 // Share of the target size the first position of a strategy gets
+	SizeRampTrades        int     // Closed positions after which a strategy trades full size
+	SizeRampPnL           float64 // Net realized PnL that graduates a strategy early, 0 disables
+
+	// Liquidity cap on position size
+	LiquidityMaxDepthFraction float64 // Largest share of the ask depth within LiquidityDepthBps a position may take, 0 disables
+	LiquidityDepthBps         float64
+
+	// Loss velocity breaker
+	LossVelocityMaxLossUSDT float64 // Realized loss of losing closes within the window that halts trading, 0 disables
+	LossVelocityWindow      time.Duration
+	LossVelocityCooldown    time.Duration
+
+	// Daily loss breaker
+	DailyMaxLossUSDT float64 // Net realized loss since UTC midnight that halts entries until the next midnight, 0 disables
+
+	// Flash crash breaker
+	FlashCrashDropPercent float64 // Drop from the window's high that halts entries on the pair, 0 disables
+	FlashCrashWindow      time.Duration
+	FlashCrashCooldown    time.Duration
+	FlashCrashAllowExits  bool // Keep signal closes and flattening running during the halt; stop loss, trailing stop and take profit always run
+
+	// Breaker halts are stored so they outlast a restart
+	PersistHalts bool
+
+	// Observe mode runs every decision but records the orders it would place
+	// in would_trade instead of sending them, opening no positions
+	ObserveOnly bool
+
+	// Price feed flatline detection
+	FlatlineCloses   int // Identical consecutive closes that pause trading on the pair, 0 disables
+	FlatlineLookback time.Duration
+
+	// Reference price sanity check
+	PauseOnPriceDivergence bool // Skip entries on a symbol whose price diverges from the reference
+
+	// Exchange-side OCO stop loss / take profit
+	BracketOrdersEnabled   bool
+	BracketStopLimitOffset float64 // How far below (above for shorts) the stop trigger the stop leg's limit sits
+
+	// Settle orders from the exchange's individual fills
+	FillReconciliationEnabled bool
+	FillReconciliationWorkers int     // Orders looked up on the exchange concurrently
+	FeeReconcileTolerance     float64 // Relative deviation from the expected fee that is flagged, 0 disables
+
+	// Backoff and quarantine of pairs whose trading config cannot be created
+	ConfigRetryDelay      time.Duration // Wait after the first failure, doubling with each further one
+	ConfigRetryMaxDelay   time.Duration
+	ConfigQuarantineAfter int // Consecutive failures that quarantine the pair and raise an alert, 0 never quarantines
+
+	// Recovery of pending orders whose exchange ID was never recorded
+	StrandedOrderTimeout time.Duration // 0 disables
+
+	// Entries stop on pairs whose stored price is older than this, 0 disables
+	MaxPriceAge time.Duration
+
+	// Open limit orders per symbol, kept below the exchange's own cap
+	MaxOpenOrdersPerSymbol int           // Pending limit orders beyond which no more are placed, 0 disables
+	StaleOrderMaxAge       time.Duration // Age at which an unfilled limit entry is cancelled, 0 disables
+
+	// Resting entries cancelled once the price leaves a band around their limit
+	EntryAdverseBand float64 // Move through the limit that abandons the entry, 0 disables
+	EntryChaseBand   float64 // Move away from the limit that reprices the entry, 0 disables
+
+	// Exposure of pairs quoted in other currencies is valued in USDT
+	BlockOnStaleQuoteRate bool // Block entries on a pair whose quote rate is stale or missing
+
+	// Drift of live results from backtest baselines
+	DriftWindow           time.Duration // Closed positions measured against the baseline
+	DriftCheckInterval    time.Duration
+	DriftMinTrades        int     // Live trades required before drift is judged
+	DriftWinRateTolerance float64 // Absolute win rate difference treated as drift, 0 ignores win rate
+	DriftAvgPnLTolerance  float64 // Relative average PnL difference treated as drift, 0 ignores PnL
 }
 
-func NewEngine(repo *database.Repository, exchange *exchange.KuCoinExchange,
-	signalGen *signals.Generator, config EngineConfig, logger *logrus.Logger) *Engine {
+func NewEngine(repo database.RepositoryInterface, exchange exchange.Exchange,
+	priceHistory signals.PriceHistoryProvider, signalGen, exitSignals *signals.Generator, referencePrices *pricing.ReferenceChecker,
+	depth DepthProvider, livePrices LivePriceProvider, trades *sink.Dispatcher, decisions *DecisionRecorder,
+	quoteRates *quotes.Converter, config EngineConfig, logger *logrus.Logger) *Engine {
 
 	return &Engine{
 		repo:            repo,
 		exchange:        exchange,
 		signalGenerator: signalGen,
-		gridStrategy:    NewGridStrategy(logger),
-		riskManager:     NewRiskManager(config, logger),
+		exitSignals:     exitSignals,
+		gridStrategy:    NewGridStrategy(repo, exchange, config, logger),
+		riskManager:     NewRiskManager(repo, quoteRates, config, logger),
+		priceHistory:    priceHistory,
+		positionSizer:   NewPositionSizer(priceHistory, depth, exchange, repo, config, logger),
+		brackets:        NewBracketManager(repo, exchange, trades, config, logger),
+		fills:           NewFillReconciler(repo, exchange, config.FillReconciliationWorkers, config.FeeReconcileTolerance, logger),
+		stranded:        NewStrandedOrderRecovery(repo, exchange, config.StrandedOrderTimeout, logger),
+		staleOrders:     NewStaleOrderCanceller(repo, exchange, config.StaleOrderMaxAge, config.EntryAdverseBand, config.EntryChaseBand, config.FillReconciliationEnabled, logger),
+		configs:         NewConfigQuarantine(config.ConfigRetryDelay, config.ConfigRetryMaxDelay, config.ConfigQuarantineAfter, logger),
+		flatlines:       NewFlatlineDetector(priceHistory, config.FlatlineCloses, config.FlatlineLookback, logger),
+		referencePrices: referencePrices,
+		livePrices:      livePrices,
+		trades:          trades,
+		decisions:       decisions,
+		quoteRates:      quoteRates,
 		logger:          logger,
 		config:          config,
+		done:            make(chan struct{}),
+	}
+}
+
+// Reconcile brings recorded positions and orders in line with the exchange
+// before trading starts, so the first cycle does not act on stale state. Any
+// failure is returned rather than logged, letting startup abort.
+func (e *Engine) Reconcile(ctx context.Context) error {
+	if err := e.riskManager.LoadHalts(ctx); err != nil {
+		return fmt.Errorf("failed to restore risk halts: %w", err)
+	}
+
+	if err := e.checkPositionConsistency(ctx); err != nil {
+		return fmt.Errorf("failed to check open position consistency: %w", err)
+	}
+
+	if e.config.BracketOrdersEnabled && !e.config.ObserveOnly {
+		if err := e.brackets.Reconcile(ctx); err != nil {
+			return fmt.Errorf("failed to reconcile bracket orders: %w", err)
+		}
+	}
+
+	if e.config.StrandedOrderTimeout > 0 {
+		if err := e.stranded.Recover(ctx); err != nil {
+			return fmt.Errorf("failed to recover stranded orders: %w", err)
+		}
+	}
+
+	if e.config.FillReconciliationEnabled {
+		if err := e.fills.Reconcile(ctx); err != nil {
+			return fmt.Errorf("failed to reconcile order fills: %w", err)
+		}
 	}
+
+	return nil
 }
 
+// Run processes trading cycles until the context is cancelled. A cycle in
+// progress when that happens finishes its current pair, so an order is never
+// left placed on the exchange without its position recorded. Call Reconcile
+// first.
 func (e *Engine) Run(ctx context.Context) error {
+	defer close(e.done)
+
 	e.logger.Info("Starting trading engine")
 
 	ticker := time.NewTicker(30 * time.Second) // Run every 30 seconds
@@ -62,7 +287,17 @@ func (e *Engine) Run(ctx context.Context) error {
 	}
 }
 
+// Done is closed once Run has returned and no trading cycle is running
+func (e *Engine) Done() <-chan struct{} {
+	return e.done
+}
+
 func (e *Engine) processTradingCycle(ctx context.Context) error {
+	// The cycle's own work runs detached from cancellation; shutdown is only
+	// honoured between pairs
+	stop := ctx
+	ctx = context.WithoutCancel(ctx)
+
 	// Get active selected pairs
 	pairs, err := e.repo.GetActiveSelectedPairs(ctx)
 	if err != nil {
@@ -71,12 +306,63 @@ func (e *Engine) processTradingCycle(ctx context.Context) error {
 
 	e.logger.WithField("active_pairs", len(pairs)).Debug("Processing trading cycle")
 
+	if err := e.riskManager.CheckLossVelocity(ctx); err != nil {
+		e.logger.WithError(err).Error("Failed to evaluate loss velocity breaker")
+	}
+	if err := e.riskManager.CheckDailyLossLimit(ctx); err != nil {
+		e.logger.WithError(err).Error("Failed to evaluate daily loss breaker")
+	}
+
+	if err := e.riskManager.UpdatePortfolioBeta(ctx, pairs); err != nil {
+		e.logger.WithError(err).Error("Failed to update portfolio beta")
+	}
+
+	// Observe mode never touches the exchange's orders
+	if e.config.BracketOrdersEnabled && !e.config.ObserveOnly {
+		if err := e.brackets.Reconcile(ctx); err != nil {
+			e.logger.WithError(err).Error("Failed to reconcile bracket orders")
+		}
+	}
+
+	if e.config.StrandedOrderTimeout > 0 {
+		if err := e.stranded.Recover(ctx); err != nil {
+			e.logger.WithError(err).Error("Failed to recover stranded orders")
+		}
+	}
+
+	if e.config.StaleOrderMaxAge > 0 && !e.config.ObserveOnly {
+		if err := e.staleOrders.Cancel(ctx); err != nil {
+			e.logger.WithError(err).Error("Failed to cancel stale orders")
+		}
+	}
+
+	if e.config.FillReconciliationEnabled {
+		if err := e.fills.Reconcile(ctx); err != nil {
+			e.logger.WithError(err).Error("Failed to reconcile order fills")
+		}
+	}
+
+	e.stalePricePairs = 0
 	for _, pair := range pairs {
+		if stop.Err() != nil {
+			e.logger.Info("Shutdown requested, ending trading cycle early")
+			return nil
+		}
 		if err := e.processPair(ctx, pair); err != nil {
 			e.logger.WithError(err).WithField("symbol", pair.Symbol).Error("Failed to process pair")
 			continue
 		}
 	}
+	if len(pairs) > 0 && e.stalePricePairs == len(pairs) {
+		e.logger.WithField("max_price_age", e.config.MaxPriceAge).
+			Warn("Price data of every pair is stale, the price collector may be down; trading close-only")
+	}
+
+	if e.config.PortfolioMetrics {
+		if err := e.publishPortfolioMetrics(ctx); err != nil {
+			e.logger.WithError(err).Warn("Failed to publish portfolio metrics")
+		}
+	}
 
 	return nil
 }
@@ -89,20 +375,74 @@ func (e *Engine) processPair(ctx context.Context, pair models.SelectedPair) erro
 	}
 
 	if config == nil {
-		// Create default config
-		config = e.createDefaultConfig(pair)
-		if err := e.repo.CreateTradingConfig(ctx, *config); err != nil {
-			e.logger.WithError(err).WithField("symbol", pair.Symbol).Error("Failed to create trading config")
-			return err
+		// Create default config, backing off pairs where that keeps failing
+		if !e.configs.Ready(pair.ID) {
+			e.logger.WithField("symbol", pair.Symbol).Debug("Trading config creation backing off, skipping pair")
+			return nil
 		}
+		config, err = e.repo.CreateTradingConfig(ctx, *e.createDefaultConfig(pair))
+		if err != nil {
+			e.configs.Failed(pair, err)
+			return nil
+		}
+		e.configs.Succeeded(pair)
 	}
 
 	// Get current price
-	currentPrice, err := e.repo.GetLatestPrice(ctx, pair.Symbol)
+	currentPrice, observedAt, err := e.repo.GetLatestQuote(ctx, pair.Symbol)
 	if err != nil {
 		return fmt.Errorf("failed to get current price: %w", err)
 	}
 
+	// A stale stored price means the price collector is behind or down. The
+	// pair takes no entries, and its positions are managed on the live price
+	// or, without one, left alone until fresh data arrives.
+	priceStale := e.config.MaxPriceAge > 0 && time.Since(observedAt) > e.config.MaxPriceAge
+	if priceStale {
+		e.stalePricePairs++
+		live, ok := e.livePrice(pair.Symbol)
+		if !ok {
+			e.logger.WithFields(logrus.Fields{
+				"symbol":      pair.Symbol,
+				"observed_at": observedAt,
+			}).Warn("Stored price is stale and no live price is available, skipping pair")
+			return nil
+		}
+		e.logger.WithFields(logrus.Fields{
+			"symbol":       pair.Symbol,
+			"observed_at":  observedAt,
+			"stored_price": currentPrice,
+			"live_price":   live,
+		}).Warn("Stored price is stale, managing positions on the live price")
+		currentPrice = live
+	}
+
+	// A flatlined feed reports a price the market has likely left behind;
+	// neither entries nor exits can be trusted to it
+	flatlined, err := e.flatlines.Check(ctx, pair.Symbol)
+	if err != nil {
+		e.logger.WithError(err).WithField("symbol", pair.Symbol).Warn("Failed to check price feed flatline")
+	} else if flatlined {
+		e.logger.WithField("symbol", pair.Symbol).Debug("Price feed flatlined, skipping pair")
+		return nil
+	}
+
+	// Resting entries the price has moved away from are cancelled before the
+	// open positions are read, so a repriced entry can be placed this cycle
+	if (e.config.EntryAdverseBand > 0 || e.config.EntryChaseBand > 0) && !e.config.ObserveOnly {
+		if err := e.staleOrders.CancelDrifted(ctx, pair, currentPrice); err != nil {
+			e.logger.WithError(err).WithField("symbol", pair.Symbol).Warn("Failed to check resting entries for drift")
+		}
+	}
+
+	// Grid fills become positions before the open positions are read, so
+	// this cycle re-seeds the opposite side of every filled level
+	if config.StrategyType == "grid" && e.config.GridOrdersEnabled {
+		if err := e.gridStrategy.SettleFills(ctx, pair, *config); err != nil {
+			return fmt.Errorf("failed to settle grid fills: %w", err)
+		}
+	}
+
 	// Generate trading signal
 	signal := e.signalGenerator.GenerateSignal(ctx, pair.Symbol, currentPrice)
 
@@ -112,16 +452,88 @@ func (e *Engine) processPair(ctx context.Context, pair models.SelectedPair) erro
 		return fmt.Errorf("failed to get open positions: %w", err)
 	}
 
-	// Update position PnL
+	// Nothing to manage and no entry to make: the rest of the pipeline would
+	// only repeat risk and exposure queries to reach the same conclusion. Grid
+	// pairs trade on price levels rather than signals, so they always continue.
+	if e.config.SkipIdleHolds && signal.Action == "HOLD" && len(positions) == 0 && config.StrategyType != "grid" {
+		e.logger.WithField("symbol", pair.Symbol).Debug("Holding with no open positions, skipping pair")
+		return nil
+	}
+
+	// Mark positions to market in memory before persisting, so exits and
+	// everything downstream see the current price even when the write fails
+	for i := range positions {
+		e.markToMarket(&positions[i], currentPrice)
+	}
 	for _, position := range positions {
-		if err := e.updatePositionPnL(ctx, &position, currentPrice); err != nil {
+		if err := e.persistPositionPnL(ctx, position); err != nil {
 			e.logger.WithError(err).WithField("position_id", position.ID).Error("Failed to update position PnL")
 		}
 	}
 
-	// Risk management checks
-	if !e.riskManager.CanTrade(pair, positions, currentPrice) {
-		e.logger.WithField("symbol", pair.Symbol).Debug("Risk management blocked trading")
+	// Flash crash breaker. Checked before exits so that, when configured, the
+	// halt also holds back discretionary closes that would sell into the
+	// crash. Protective exits always run.
+	if err := e.riskManager.CheckFlashCrash(ctx, pair, currentPrice); err != nil {
+		e.logger.WithError(err).WithField("symbol", pair.Symbol).Warn("Failed to check flash crash")
+	}
+	discretionaryExits := e.config.FlashCrashAllowExits || !e.riskManager.IsPairHalted(pair.ID)
+	if !discretionaryExits {
+		e.logger.WithField("symbol", pair.Symbol).Debug("Flash crash halt in effect, holding discretionary exits")
+	}
+
+	// Stop loss / take profit, unless the exchange-side brackets handle exits
+	if !e.config.BracketOrdersEnabled {
+		candle := e.latestCandle(ctx, pair.Symbol, len(positions))
+		stillOpen := positions[:0]
+		for i := range positions {
+			closed, err := e.checkAndExecuteSLTP(ctx, pair, *config, &positions[i], currentPrice, candle)
+			if err != nil {
+				e.logger.WithError(err).WithField("position_id", positions[i].ID).Error("Failed to execute stop loss / take profit")
+			}
+			if !closed {
+				stillOpen = append(stillOpen, positions[i])
+			}
+		}
+		positions = stillOpen
+	}
+
+	// Pairs with trading disabled keep their data flowing but take no new entries
+	if !pair.TradingEnabled {
+		e.logger.WithField("symbol", pair.Symbol).Debug("Trading disabled for pair, skipping entries")
+		if e.config.FlattenDisabledPairs && discretionaryExits {
+			for _, position := range positions {
+				if err := e.executeMarketCloseOrder(ctx, pair, position, currentPrice, "trading disabled"); err != nil {
+					e.logger.WithError(err).WithField("position_id", position.ID).Error("Failed to flatten position on disabled pair")
+				}
+			}
+		}
+		return nil
+	}
+
+	if priceStale {
+		e.logger.WithField("symbol", pair.Symbol).Debug("Stored price is stale, skipping entries")
+		return nil
+	}
+
+	// Sanity check KuCoin's price against independent sources
+	if e.referencePrices != nil {
+		result, err := e.referencePrices.Check(ctx, pair.Symbol, currentPrice)
+		if err != nil {
+			e.logger.WithError(err).WithField("symbol", pair.Symbol).Warn("Failed to check reference price")
+		} else if result.Diverged && e.config.PauseOnPriceDivergence {
+			e.logger.WithField("symbol", pair.Symbol).Info("Price diverges from reference, skipping entries")
+			return nil
+		}
+	}
+
+	// Risk management checks. They block entries only: a sell signal still
+	// closes positions under the basic strategy.
+	if !e.riskManager.CanTrade(ctx, pair, positions, currentPrice) {
+		e.logger.WithField("symbol", pair.Symbol).Debug("Risk management blocked new entries")
+		if discretionaryExits && config.StrategyType != "grid" && signal.Action == "SELL" {
+			return e.executeBasicStrategy(ctx, pair, *config, signal, positions, currentPrice)
+		}
 		return nil
 	}
 
@@ -134,6 +546,24 @@ func (e *Engine) processPair(ctx context.Context, pair models.SelectedPair) erro
 	}
 }
 
+// latestCandle returns the newest stored candle of the symbol when exits are
+// checked against candle ranges, or nil
+func (e *Engine) latestCandle(ctx context.Context, symbol string, openPositions int) *models.Candle {
+	if openPositions == 0 || e.config.ExitTieBreak == ExitTieBreakClose || e.config.ExitTieBreak == "" {
+		return nil
+	}
+
+	candles, err := e.priceHistory.GetPriceHistory(ctx, symbol, time.Now().Add(-5*time.Minute))
+	if err != nil {
+		e.logger.WithError(err).WithField("symbol", symbol).Warn("Failed to get latest candle, checking exits against the current price")
+		return nil
+	}
+	if len(candles) == 0 {
+		return nil
+	}
+	return &candles[len(candles)-1]
+}
+
 func (e *Engine) createDefaultConfig(pair models.SelectedPair) *models.TradingConfig {
 	// Calculate price range based on volatility
 	priceRangePercent := pair.Volatility24h * 2 // 2x volatility for grid range
@@ -155,10 +585,18 @@ func (e *Engine) createDefaultConfig(pair models.SelectedPair) *models.TradingCo
 		TakeProfitPercent: e.config.TakeProfitPercent,
 		MaxPositions:      e.config.MaxPositionsPerPair,
 		IsActive:          true,
+
+		SizingMode:          e.config.SizingMode,
+		PositionSizeBase:    e.config.DefaultPositionSizeBase,
+		PositionSizePercent: e.config.DefaultPositionSizePercent,
+
+		ConfirmExits: e.config.ConfirmExitsDefault,
 	}
 }
 
-func (e *Engine) updatePositionPnL(ctx context.Context, position *models.Position, currentPrice float64) error {
+// markToMarket sets the position's current price, unrealized PnL and, when
+// tracked, excursions from the price
+func (e *Engine) markToMarket(position *models.Position, currentPrice float64) {
 	position.CurrentPrice = currentPrice
 
 	// Calculate unrealized PnL
@@ -168,7 +606,37 @@ func (e *Engine) updatePositionPnL(ctx context.Context, position *models.Positio
 		position.UnrealizedPnL = (position.EntryPrice - currentPrice) * position.Quantity
 	}
 
-	return e.repo.UpdatePosition(ctx, *position)
+	if e.config.TrackExcursions {
+		updateExcursions(position, currentPrice)
+	}
+}
+
+// persistPositionPnL writes a marked position, retrying failed writes with a
+// doubling delay. Each attempt is a full rewrite, so a retry cannot apply
+// anything twice.
+func (e *Engine) persistPositionPnL(ctx context.Context, position models.Position) error {
+	delay := e.config.PnLWriteRetryDelay
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = e.repo.UpdatePosition(ctx, position); err == nil || attempt >= e.config.PnLWriteRetries {
+			break
+		}
+
+		e.logger.WithError(err).WithFields(logrus.Fields{
+			"position_id": position.ID,
+			"attempt":     attempt + 1,
+		}).Warn("Failed to persist position PnL, retrying")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+
+	return err
 }
 
 func (e *Engine) executeBasicStrategy(ctx context.Context, pair models.SelectedPair, config models.TradingConfig,
@@ -180,25 +648,83 @@ func (e *Engine) executeBasicStrategy(ctx context.Context, pair models.SelectedP
 		"price":  currentPrice,
 	}).Debug("Executing basic strategy")
 
-	switch signal.Action {
-	case "BUY":
-		if len(positions) < config.MaxPositions {
-			return e.executeBuyOrder(ctx, pair, config, currentPrice)
-		}
-	case "SELL":
-		// Close profitable positions
+	decision := decideBasic(config, signal, positions)
+	e.decisions.Record(DecisionRecord{
+		Account:    e.repo.Account(),
+		Symbol:     pair.Symbol,
+		RecordedAt: time.Now(),
+		Price:      currentPrice,
+		Config:     config,
+		Signal:     signal,
+		Positions:  positions,
+		Decision:   decision,
+	})
+
+	switch decision.Action {
+	case DecisionEnter:
+		return e.executeBuyOrder(ctx, pair, config, signal, positions, currentPrice)
+	case DecisionExit:
+		// Close the profitable position
 		for _, position := range positions {
-			if position.Side == "buy" && position.UnrealizedPnL > 0 {
-				return e.executeSellOrder(ctx, pair, position, currentPrice)
+			if position.ID != decision.PositionID {
+				continue
 			}
+			if config.ConfirmExits && !e.exitConfirmed(ctx, pair, currentPrice) {
+				return nil
+			}
+			return e.executeSellOrder(ctx, pair, position, currentPrice)
 		}
 	}
 
 	return nil
 }
 
-func (e *Engine) executeBuyOrder(ctx context.Context, pair models.SelectedPair, config models.TradingConfig, price float64) error {
-	quantity := config.PositionSizeUSDT / price
+// exitConfirmed reports whether the higher confirmation timeframe agrees
+// with a sell signal, so a dip on the signal timeframe alone does not close a
+// position in an intact trend. Only signal exits ask; stop losses never wait.
+func (e *Engine) exitConfirmed(ctx context.Context, pair models.SelectedPair, currentPrice float64) bool {
+	if e.exitSignals == nil {
+		return true
+	}
+
+	confirmation := e.exitSignals.GenerateSignal(ctx, pair.Symbol, currentPrice)
+	if confirmation.Action == "SELL" {
+		return true
+	}
+
+	e.logger.WithFields(logrus.Fields{
+		"symbol":              pair.Symbol,
+		"confirmation_action": confirmation.Action,
+		"confirmation_reason": confirmation.Reason,
+	}).Info("Sell signal not confirmed on the higher timeframe, holding position")
+
+	return false
+}
+
+func (e *Engine) executeBuyOrder(ctx context.Context, pair models.SelectedPair, config models.TradingConfig,
+	signal models.Signal, positions []models.Position, storedPrice float64) error {
+
+	if !e.riskManager.MeetsRiskReward(pair, config) {
+		return nil
+	}
+	if ok, err := e.orderSlotAvailable(ctx, pair); err != nil || !ok {
+		return err
+	}
+
+	price := e.orderPrice(pair.Symbol, "buy", storedPrice)
+
+	positionSize := e.positionSizer.CalculatePositionSize(ctx, pair, config, price)
+	if positionSize <= 0 {
+		e.logger.WithField("symbol", pair.Symbol).Warn("Position size is zero, skipping entry")
+		return nil
+	}
+	quantity := positionSize / price
+
+	if e.config.ObserveOnly {
+		decision := e.newDecisionContext(pair, config, signal, positions, storedPrice, price, positionSize, quantity)
+		e.observeEntry(ctx, pair, config, decision, quantity, price)
+		return nil
+	}
 
 	orderResp, err := e.exchange.PlaceBuyOrder(pair.Symbol, quantity, price)
 	if err != nil {
@@ -207,35 +733,163 @@ func (e *Engine) executeBuyOrder(ctx context.Context, pair models.SelectedPair,
 
 	// Create position record
 	position := models.Position{
-		PairID:       pair.ID,
-		ConfigID:     config.ID,
-		Side:         "buy",
-		Quantity:     quantity,
-		EntryPrice:   price,
-		CurrentPrice: price,
-		Status:       "open",
-		OrderID:      orderResp.OrderId,
+		PairID:        pair.ID,
+		ConfigID:      config.ID,
+		Side:          "buy",
+		Quantity:      quantity,
+		EntryPrice:    price,
+		CurrentPrice:  price,
+		Status:        "open",
+		OrderID:       orderResp.OrderId,
+		StrategyTag:   e.strategyTag(config),
+		ConfigVersion: e.config.ConfigVersion,
 	}
 
-	if err := e.repo.CreatePosition(ctx, position); err != nil {
+	if err := e.repo.CreatePosition(ctx, &position); err != nil {
 		return fmt.Errorf("failed to create position record: %w", err)
 	}
 
+	if e.config.RecordDecisions {
+		decision := e.newDecisionContext(pair, config, signal, positions, storedPrice, price, positionSize, quantity)
+		if err := e.recordDecision(ctx, position, decision); err != nil {
+			e.logger.WithError(err).WithField("position_id", position.ID).Error("Failed to record trade decision")
+		}
+	}
+
+	if e.config.BracketOrdersEnabled {
+		if err := e.brackets.Open(ctx, pair, config, position); err != nil {
+			e.logger.WithError(err).WithField("position_id", position.ID).Error("Failed to record bracket order")
+		}
+	}
+
 	// Create order record
 	order := models.Order{
+		PositionID:    &position.ID,
 		PairID:        pair.ID,
 		KuCoinOrderID: orderResp.OrderId,
+		ClientOid:     orderResp.ClientOid,
 		Side:          "buy",
 		Type:          "limit",
 		Quantity:      quantity,
 		Price:         price,
 		Status:        "pending",
+		StrategyTag:   position.StrategyTag,
+		ConfigVersion: position.ConfigVersion,
 	}
 
 	return e.repo.CreateOrder(ctx, order)
 }
 
+// orderSlotAvailable reports whether another limit order may be placed on
+// the symbol under the open order cap. Slots free up as orders fill or the
+// stale order cancellation removes them.
+func (e *Engine) orderSlotAvailable(ctx context.Context, pair models.SelectedPair) (bool, error) {
+	return orderSlotAvailable(ctx, e.repo, e.config, pair, e.logger)
+}
+
+func orderSlotAvailable(ctx context.Context, repo database.RepositoryInterface, config EngineConfig, pair models.SelectedPair, logger *logrus.Logger) (bool, error) {
+	if config.MaxOpenOrdersPerSymbol <= 0 {
+		return true, nil
+	}
+
+	open, err := repo.CountOpenLimitOrders(ctx, pair.ID)
+	if err != nil {
+		return false, err
+	}
+	if open < config.MaxOpenOrdersPerSymbol {
+		return true, nil
+	}
+
+	metrics.OrderCapThrottles.WithLabelValues(pair.Symbol).Inc()
+	logger.WithFields(logrus.Fields{
+		"symbol":      pair.Symbol,
+		"open_orders": open,
+		"max_orders":  config.MaxOpenOrdersPerSymbol,
+	}).Warn("Open order cap reached for symbol, not placing order")
+
+	return false, nil
+}
+
+// livePrice returns the midpoint of the symbol's live quote, reporting false
+// without live pricing or when the quote fails
+func (e *Engine) livePrice(symbol string) (float64, bool) {
+	if e.livePrices == nil {
+		return 0, false
+	}
+
+	bid, ask, err := e.livePrices.Quote(symbol)
+	if err != nil || bid <= 0 || ask <= 0 {
+		e.logger.WithError(err).WithField("symbol", symbol).Debug("Live price unavailable")
+		return 0, false
+	}
+	return (bid + ask) / 2, true
+}
+
+// orderPrice returns the price a limit order is placed at. With live pricing
+// it is the touch the order trades against (the ask for a buy, the bid for a
+// sell) rather than the stored close, which can be a minute old; a failed
+// live quote falls back to the stored price.
+func (e *Engine) orderPrice(symbol, side string, stored float64) float64 {
+	if e.livePrices == nil {
+		return stored
+	}
+
+	bid, ask, err := e.livePrices.Quote(symbol)
+	if err != nil {
+		e.logger.WithError(err).WithField("symbol", symbol).Warn("Failed to get live price, pricing order from stored close")
+		return stored
+	}
+
+	price := ask
+	if side == "sell" {
+		price = bid
+	}
+
+	e.logger.WithFields(logrus.Fields{
+		"symbol":       symbol,
+		"side":         side,
+		"live_price":   price,
+		"stored_price": stored,
+	}).Debug("Pricing order from live quote")
+
+	return price
+}
+
+// strategyTag identifies the strategy that opens a position, so trades can be
+// attributed after strategies or their configuration change
+func (e *Engine) strategyTag(config models.TradingConfig) string {
+	return strategyTag(e.config, config)
+}
+
+func strategyTag(engine EngineConfig, config models.TradingConfig) string {
+	if engine.StrategyTag != "" {
+		return engine.StrategyTag
+	}
+	return config.StrategyType
+}
+
 func (e *Engine) executeSellOrder(ctx context.Context, pair models.SelectedPair, position models.Position, price float64) error {
+	if !e.clearsFeeFloor(pair, position, position.Quantity, price, "sell signal") {
+		return nil
+	}
+	if ok, err := e.orderSlotAvailable(ctx, pair); err != nil || !ok {
+		return err
+	}
+
+	price = e.orderPrice(pair.Symbol, "sell", price)
+
+	if e.config.ObserveOnly {
+		e.observeExit(ctx, pair, position, WouldExit, "limit", position.Quantity, price, "sell signal")
+		return nil
+	}
+
+	if err := e.brackets.Cancel(ctx, position.ID); err != nil {
+		return fmt.Errorf("failed to cancel bracket order: %w", err)
+	}
+	if err := e.gridStrategy.CancelExit(ctx, position); err != nil {
+		return err
+	}
+
 	orderResp, err := e.exchange.PlaceSellOrder(pair.Symbol, position.Quantity, price)
 	if err != nil {
 		return fmt.Errorf("failed to place sell order: %w", err)
@@ -243,24 +897,103 @@ func (e *Engine) executeSellOrder(ctx context.Context, pair models.SelectedPair,
 
 	// Update position status
 	now := time.Now()
+	fees := closingFees(e.exchange, e.config, pair.Symbol, position.EntryPrice, price, position.Quantity, true, e.logger)
+	realized := computeRealizedPnL(position.Side, position.EntryPrice, price, position.Quantity, fees)
 	position.Status = "closed"
 	position.ClosedAt = &now
-	position.RealizedPnL = position.UnrealizedPnL
+	position.RealizedPnL += realized
+	position.TotalFees += fees
+	position.CurrentPrice = price
+	position.UnrealizedPnL = 0
+	position.ClosedFraction = 1
 
 	if err := e.repo.UpdatePosition(ctx, position); err != nil {
 		return fmt.Errorf("failed to update position: %w", err)
 	}
+	metrics.RealizedPnL.WithLabelValues(e.repo.Account()).Add(realized)
+	e.trades.Publish(closedEvent(pair.Symbol, position, price, "sell signal"))
 
 	// Create order record
 	order := models.Order{
 		PositionID:    &position.ID,
 		PairID:        pair.ID,
 		KuCoinOrderID: orderResp.OrderId,
+		ClientOid:     orderResp.ClientOid,
 		Side:          "sell",
 		Type:          "limit",
 		Quantity:      position.Quantity,
 		Price:         price,
 		Status:        "pending",
+		StrategyTag:   position.StrategyTag,
+		ConfigVersion: position.ConfigVersion,
+	}
+
+	return e.repo.CreateOrder(ctx, order)
+}
+
+// executeMarketCloseOrder closes a position immediately with a market order
+// on the opposite side, realizing the PnL at the given exit price
+func (e *Engine) executeMarketCloseOrder(ctx context.Context, pair models.SelectedPair, position models.Position, exitPrice float64, reason string) error {
+	if e.config.ObserveOnly {
+		e.observeExit(ctx, pair, position, WouldExit, "market", position.Quantity, exitPrice, reason)
+		return nil
+	}
+
+	if err := e.brackets.Cancel(ctx, position.ID); err != nil {
+		return fmt.Errorf("failed to cancel bracket order: %w", err)
+	}
+	if err := e.gridStrategy.CancelExit(ctx, position); err != nil {
+		return err
+	}
+
+	closeSide := "sell"
+	if position.Side == "sell" {
+		closeSide = "buy"
+	}
+
+	orderResp, err := e.exchange.PlaceMarketOrder(pair.Symbol, closeSide, position.Quantity)
+	if err != nil {
+		return fmt.Errorf("failed to place market close order: %w", err)
+	}
+
+	now := time.Now()
+	fees := closingFees(e.exchange, e.config, pair.Symbol, position.EntryPrice, exitPrice, position.Quantity, true, e.logger)
+	realized := computeRealizedPnL(position.Side, position.EntryPrice, exitPrice, position.Quantity, fees)
+	position.RealizedPnL += realized
+	position.TotalFees += fees
+	position.CurrentPrice = exitPrice
+	position.UnrealizedPnL = 0
+	position.ClosedFraction = 1
+	position.Status = "closed"
+	position.ClosedAt = &now
+
+	if err := e.repo.UpdatePosition(ctx, position); err != nil {
+		return fmt.Errorf("failed to update position: %w", err)
+	}
+	metrics.RealizedPnL.WithLabelValues(e.repo.Account()).Add(realized)
+
+	e.logger.WithFields(logrus.Fields{
+		"symbol":       pair.Symbol,
+		"position_id":  position.ID,
+		"side":         position.Side,
+		"exit_price":   exitPrice,
+		"realized_pnl": position.RealizedPnL,
+		"reason":       reason,
+	}).Info("Closed position with market order")
+	e.trades.Publish(closedEvent(pair.Symbol, position, exitPrice, reason))
+
+	order := models.Order{
+		PositionID:    &position.ID,
+		PairID:        pair.ID,
+		KuCoinOrderID: orderResp.OrderId,
+		ClientOid:     orderResp.ClientOid,
+		Side:          closeSide,
+		Type:          "market",
+		Quantity:      position.Quantity,
+		Price:         exitPrice,
+		Status:        "pending",
+		StrategyTag:   position.StrategyTag,
+		ConfigVersion: position.ConfigVersion,
 	}
 
 	return e.repo.CreateOrder(ctx, order)
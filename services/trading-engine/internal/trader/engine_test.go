@@ -0,0 +1,567 @@
+package trader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/pricing"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/signals"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+const testSymbol = "BTC-USDT"
+
+var testPair = models.SelectedPair{ID: 1, Symbol: testSymbol, Status: "active", TradingEnabled: true}
+
+// hourlyCandles returns hourly candles of the closes ending at the current
+// hour, with a constant volume
+func hourlyCandles(closes []float64) []models.Candle {
+	now := time.Now().Truncate(time.Hour)
+	candles := make([]models.Candle, len(closes))
+	for i, price := range closes {
+		candles[i] = models.Candle{
+			Timestamp: now.Add(-time.Duration(len(closes)-1-i) * time.Hour),
+			Open:      price,
+			High:      price * 1.001,
+			Low:       price * 0.999,
+			Close:     price,
+			Volume:    1000,
+		}
+	}
+	return candles
+}
+
+// sellOffCloses drifts sideways around start and then falls steadily, leaving
+// RSI deeply oversold: the basic strategy reads it as a BUY
+func sellOffCloses(start float64) []float64 {
+	closes := make([]float64, 0, 90)
+	price := start
+	for i := 0; i < 80; i++ {
+		if i%2 == 0 {
+			price += 0.1
+		} else {
+			price -= 0.1
+		}
+		closes = append(closes, price)
+	}
+	for i := 0; i < 10; i++ {
+		price -= 0.5
+		closes = append(closes, price)
+	}
+	return closes
+}
+
+// testEngineConfig is the engine configuration tests start from: room for a
+// few positions of 100 USDT with a 5% stop and a 10% take profit
+func testEngineConfig() EngineConfig {
+	return EngineConfig{
+		MaxPositionsPerPair: 3,
+		DefaultPositionSize: 100,
+		StopLossPercent:     0.05,
+		TakeProfitPercent:   0.1,
+	}
+}
+
+// newTestEngine builds an engine on the mocks with the repository as its
+// price history and a generator using the default indicator settings
+func newTestEngine(repo *MockDatabaseRepository, ex *MockExchange, config EngineConfig) *Engine {
+	generator := signals.NewGenerator(repo, signals.Config{}, utils.NewDiscardLogger())
+	return NewEngine(repo, ex, repo, generator, nil, nil, nil, nil, nil, nil, nil, config, utils.NewDiscardLogger())
+}
+
+// seedSellOff stores a basic strategy config for testPair and a price history
+// the generator reads as a BUY, returning the current price
+func seedSellOff(repo *MockDatabaseRepository) float64 {
+	candles := hourlyCandles(sellOffCloses(100))
+	price := candles[len(candles)-1].Close
+
+	repo.history[testSymbol] = candles
+	repo.quotes[testSymbol] = price
+	repo.configs[testPair.ID] = &models.TradingConfig{
+		ID:                "config-1",
+		PairID:            testPair.ID,
+		StrategyType:      "basic",
+		PositionSizeUSDT:  100,
+		StopLossPercent:   0.05,
+		TakeProfitPercent: 0.1,
+		MaxPositions:      2,
+		IsActive:          true,
+	}
+	return price
+}
+
+func TestTradingEnabledGatesEntries(t *testing.T) {
+	tests := []struct {
+		name        string
+		enabled     bool
+		wantEntries int
+	}{
+		{name: "enabled pair enters", enabled: true, wantEntries: 1},
+		{name: "disabled pair takes no entries", enabled: false, wantEntries: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+			seedSellOff(repo)
+			engine := newTestEngine(repo, ex, testEngineConfig())
+
+			pair := testPair
+			pair.TradingEnabled = tt.enabled
+			if err := engine.processPair(context.Background(), pair); err != nil {
+				t.Fatalf("processPair() error = %v", err)
+			}
+
+			if got := len(ex.Placed()); got != tt.wantEntries {
+				t.Fatalf("placed %d orders, want %d", got, tt.wantEntries)
+			}
+			if got := len(repo.Positions()); got != tt.wantEntries {
+				t.Fatalf("opened %d positions, want %d", got, tt.wantEntries)
+			}
+		})
+	}
+}
+
+func TestTradingDisabledFlattensWhenConfigured(t *testing.T) {
+	for _, flatten := range []bool{false, true} {
+		repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+		price := seedSellOff(repo)
+		repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", Quantity: 1, EntryPrice: price, Status: "open"})
+		config := testEngineConfig()
+		config.FlattenDisabledPairs = flatten
+		engine := newTestEngine(repo, ex, config)
+
+		pair := testPair
+		pair.TradingEnabled = false
+		if err := engine.processPair(context.Background(), pair); err != nil {
+			t.Fatalf("processPair() error = %v", err)
+		}
+
+		placed := ex.Placed()
+		if !flatten {
+			if len(placed) != 0 {
+				t.Errorf("without flattening placed %d orders, want none", len(placed))
+			}
+			continue
+		}
+		if len(placed) != 1 || placed[0].Type != "market" || placed[0].Side != "sell" {
+			t.Fatalf("with flattening placed %+v, want one market sell", placed)
+		}
+		if open, _ := repo.GetAllOpenPositions(context.Background()); len(open) != 0 {
+			t.Errorf("%d positions still open after flattening, want 0", len(open))
+		}
+	}
+}
+
+// fixedPriceSource quotes the same reference price for every symbol
+type fixedPriceSource float64
+
+func (s fixedPriceSource) Name() string {
+	return "fixed"
+}
+
+func (s fixedPriceSource) GetPrice(_ context.Context, _ string) (float64, error) {
+	return float64(s), nil
+}
+
+func TestPriceDivergencePausesEntries(t *testing.T) {
+	for _, pause := range []bool{false, true} {
+		repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+		price := seedSellOff(repo)
+
+		config := testEngineConfig()
+		config.PauseOnPriceDivergence = pause
+		engine := newTestEngine(repo, ex, config)
+		engine.referencePrices = pricing.NewReferenceChecker([]pricing.PriceSource{fixedPriceSource(price * 1.1)}, 0.02, utils.NewDiscardLogger())
+
+		if err := engine.processPair(context.Background(), testPair); err != nil {
+			t.Fatalf("processPair() error = %v", err)
+		}
+
+		wantEntries := 1
+		if pause {
+			wantEntries = 0
+		}
+		if got := len(ex.Placed()); got != wantEntries {
+			t.Errorf("pause %v: placed %d orders on a diverged price, want %d", pause, got, wantEntries)
+		}
+	}
+}
+
+func TestEntryRecordsStrategyAttribution(t *testing.T) {
+	repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+	seedSellOff(repo)
+
+	config := testEngineConfig()
+	config.StrategyTag = "mean-reversion"
+	config.ConfigVersion = "v7"
+	engine := newTestEngine(repo, ex, config)
+
+	if err := engine.processPair(context.Background(), testPair); err != nil {
+		t.Fatalf("processPair() error = %v", err)
+	}
+
+	positions := repo.Positions()
+	if len(positions) != 1 {
+		t.Fatalf("opened %d positions, want 1", len(positions))
+	}
+	if positions[0].StrategyTag != "mean-reversion" || positions[0].ConfigVersion != "v7" {
+		t.Errorf("position attribution = %q/%q, want mean-reversion/v7", positions[0].StrategyTag, positions[0].ConfigVersion)
+	}
+
+	orders := repo.Orders()
+	if len(orders) != 1 {
+		t.Fatalf("recorded %d orders, want 1", len(orders))
+	}
+	if orders[0].StrategyTag != "mean-reversion" || orders[0].ConfigVersion != "v7" {
+		t.Errorf("order attribution = %q/%q, want mean-reversion/v7", orders[0].StrategyTag, orders[0].ConfigVersion)
+	}
+}
+
+func TestConcurrentConfigCreationYieldsOneConfig(t *testing.T) {
+	repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+	seedSellOff(repo)
+	delete(repo.configs, testPair.ID) // The pair has no config yet
+	engine := newTestEngine(repo, ex, testEngineConfig())
+
+	// Overlapping cycles for the same pair all see no config and create one
+	pair := testPair
+	pair.TradingEnabled = false
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := engine.processPair(context.Background(), pair); err != nil {
+				t.Errorf("processPair() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(repo.configs) != 1 {
+		t.Fatalf("stored %d configs for the pair, want 1", len(repo.configs))
+	}
+
+	config, err := repo.GetTradingConfig(context.Background(), testPair.ID)
+	if err != nil || config == nil {
+		t.Fatalf("GetTradingConfig() = %v, %v; want the created config", config, err)
+	}
+	again, err := repo.CreateTradingConfig(context.Background(), *engine.createDefaultConfig(testPair))
+	if err != nil || again.ID != config.ID {
+		t.Errorf("another create returned %+v, %v; want the existing config %s", again, err, config.ID)
+	}
+}
+
+// fakeQuotes quotes a fixed best bid and ask, or fails with err
+type fakeQuotes struct {
+	bid, ask float64
+	err      error
+}
+
+func (q fakeQuotes) Quote(string) (float64, float64, error) {
+	return q.bid, q.ask, q.err
+}
+
+func TestOrderPriceFromLiveOrStoredSource(t *testing.T) {
+	const stored = 100.0
+
+	tests := []struct {
+		name   string
+		live   LivePriceProvider
+		side   string
+		wantPx float64
+	}{
+		{name: "no live pricing uses the stored close", live: nil, side: "buy", wantPx: stored},
+		{name: "live buy pays the ask", live: fakeQuotes{bid: 100.8, ask: 101.2}, side: "buy", wantPx: 101.2},
+		{name: "live sell hits the bid", live: fakeQuotes{bid: 100.8, ask: 101.2}, side: "sell", wantPx: 100.8},
+		{name: "failed live quote falls back to the stored close", live: fakeQuotes{err: errors.New("ticker timeout")}, side: "buy", wantPx: stored},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockDatabaseRepository("main")
+			ex := NewMockExchange()
+			ex.balances["USDT"] = 1000
+			generator := signals.NewGenerator(repo, signals.Config{}, utils.NewDiscardLogger())
+			engine := NewEngine(repo, ex, repo, generator, nil, nil, nil, tt.live, nil, nil, nil, testEngineConfig(), utils.NewDiscardLogger())
+
+			if got := engine.orderPrice(testSymbol, tt.side, stored); got != tt.wantPx {
+				t.Fatalf("orderPrice() = %v, want %v", got, tt.wantPx)
+			}
+			if tt.side != "buy" {
+				return
+			}
+
+			// The entry is placed at the chosen price and sized from it
+			config := models.TradingConfig{StopLossPercent: 0.05, TakeProfitPercent: 0.1, PositionSizeUSDT: 100, MaxPositions: 2}
+			if err := engine.executeBuyOrder(context.Background(), testPair, config, models.Signal{Action: "BUY"}, nil, stored); err != nil {
+				t.Fatalf("executeBuyOrder() error = %v", err)
+			}
+			placed := ex.Placed()
+			if len(placed) != 1 || placed[0].Price != tt.wantPx {
+				t.Fatalf("placed %+v, want one buy at %v", placed, tt.wantPx)
+			}
+			if !approxEqual(placed[0].Quantity*placed[0].Price, 100) {
+				t.Errorf("placed %v notional, want the 100 USDT position size", placed[0].Quantity*placed[0].Price)
+			}
+		})
+	}
+}
+
+func TestRunReturnsPromptlyOnCancel(t *testing.T) {
+	engine := newTestEngine(NewMockDatabaseRepository("main"), NewMockExchange(), testEngineConfig())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- engine.Run(ctx)
+	}()
+
+	select {
+	case <-engine.Done():
+		t.Fatal("Done() closed while Run is still looping")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("Run() error = %v, want nil on shutdown", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run() did not return within a second of cancellation")
+	}
+
+	select {
+	case <-engine.Done():
+	default:
+		t.Error("Done() still open after Run returned")
+	}
+}
+
+func TestCancelledCycleStopsBetweenPairs(t *testing.T) {
+	repo := NewMockDatabaseRepository("main")
+	repo.pairs = []models.SelectedPair{testPair}
+	engine := newTestEngine(repo, NewMockExchange(), testEngineConfig())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := engine.processTradingCycle(ctx); err != nil {
+		t.Fatalf("processTradingCycle() error = %v", err)
+	}
+	if config, _ := repo.GetTradingConfig(context.Background(), testPair.ID); config != nil {
+		t.Error("pair processed after shutdown was requested, want the cycle ended before it")
+	}
+}
+
+func TestEntryRecordsDecisionSnapshot(t *testing.T) {
+	repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+	price := seedSellOff(repo)
+
+	config := testEngineConfig()
+	config.RecordDecisions = true
+	config.StrategyTag = "mean-reversion"
+	engine := newTestEngine(repo, ex, config)
+
+	if err := engine.processPair(context.Background(), testPair); err != nil {
+		t.Fatalf("processPair() error = %v", err)
+	}
+
+	positions := repo.Positions()
+	decisions := repo.Decisions()
+	if len(positions) != 1 || len(decisions) != 1 {
+		t.Fatalf("recorded %d decisions for %d positions, want one each", len(decisions), len(positions))
+	}
+	if decisions[0].PositionID != positions[0].ID || decisions[0].KuCoinOrderID != positions[0].OrderID {
+		t.Errorf("decision linked to %s/%s, want position %s and order %s",
+			decisions[0].PositionID, decisions[0].KuCoinOrderID, positions[0].ID, positions[0].OrderID)
+	}
+
+	var snapshot DecisionContext
+	if err := json.Unmarshal(decisions[0].Context, &snapshot); err != nil {
+		t.Fatalf("decision context is not valid JSON: %v", err)
+	}
+	if snapshot.Symbol != testSymbol || snapshot.Signal.Action != "BUY" || snapshot.StrategyTag != "mean-reversion" {
+		t.Errorf("snapshot = %s %s %s, want %s BUY mean-reversion", snapshot.Symbol, snapshot.Signal.Action, snapshot.StrategyTag, testSymbol)
+	}
+	if snapshot.Signal.Indicators["rsi"] == nil || snapshot.Signal.Indicators["score"] == nil {
+		t.Errorf("snapshot indicators = %v, want the signal's RSI and score", snapshot.Signal.Indicators)
+	}
+	if snapshot.StoredPrice != price || snapshot.PositionSize <= 0 || !approxEqual(snapshot.Quantity, positions[0].Quantity) {
+		t.Errorf("snapshot price/size/quantity = %v/%v/%v, want %v, a positive size and %v",
+			snapshot.StoredPrice, snapshot.PositionSize, snapshot.Quantity, price, positions[0].Quantity)
+	}
+	if snapshot.Risk.PortfolioHalted || snapshot.Risk.PairHalted || len(snapshot.OpenPositions) != 0 {
+		t.Errorf("snapshot risk/open positions = %+v/%v, want no halts and no prior positions", snapshot.Risk, snapshot.OpenPositions)
+	}
+}
+
+func TestFailedPnLWriteKeepsExitDecision(t *testing.T) {
+	tests := []struct {
+		name       string
+		entry      float64
+		failWrites int
+		wantSells  int
+	}{
+		// The sell-off ends at 95, through a 5% stop from 101
+		{name: "stop loss taken despite the failed write", entry: 101, failWrites: 1, wantSells: 1},
+		{name: "no exit within the stop despite the failed write", entry: 96, failWrites: 1},
+		{name: "stop loss taken when the write succeeds", entry: 101, wantSells: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+			seedSellOff(repo)
+			repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", Quantity: 1, EntryPrice: tt.entry, CurrentPrice: tt.entry, Status: "open"})
+			repo.failUpdates = tt.failWrites
+
+			config := testEngineConfig()
+			config.MaxPositionsPerPair = 1
+			engine := newTestEngine(repo, ex, config)
+
+			if err := engine.processPair(context.Background(), testPair); err != nil {
+				t.Fatalf("processPair() error = %v", err)
+			}
+
+			sells := 0
+			for _, order := range ex.Placed() {
+				if order.Side == "sell" {
+					sells++
+				}
+			}
+			if sells != tt.wantSells {
+				t.Errorf("placed %d exits, want %d", sells, tt.wantSells)
+			}
+		})
+	}
+}
+
+func TestFailedPnLWriteIsRetried(t *testing.T) {
+	repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+	price := seedSellOff(repo)
+	position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", Quantity: 2, EntryPrice: 96, CurrentPrice: 96, Status: "open"})
+	repo.failUpdates = 2
+
+	config := testEngineConfig()
+	config.MaxPositionsPerPair = 1
+	config.PnLWriteRetries = 2
+	config.PnLWriteRetryDelay = time.Millisecond
+	engine := newTestEngine(repo, ex, config)
+
+	if err := engine.processPair(context.Background(), testPair); err != nil {
+		t.Fatalf("processPair() error = %v", err)
+	}
+
+	if repo.updatePositionCalls < 3 {
+		t.Errorf("UpdatePosition called %d times, want two failures and a successful retry", repo.updatePositionCalls)
+	}
+	for _, stored := range repo.Positions() {
+		if stored.ID != position.ID {
+			continue
+		}
+		if !approxEqual(stored.CurrentPrice, price) || !approxEqual(stored.UnrealizedPnL, 2*(price-96)) {
+			t.Errorf("persisted price/PnL = %v/%v, want %v/%v", stored.CurrentPrice, stored.UnrealizedPnL, price, 2*(price-96))
+		}
+	}
+}
+
+func TestIdleHoldSkipsRemainingQueries(t *testing.T) {
+	// Sideways around 100: the basic strategy holds
+	sideways := make([]float64, 90)
+	for i := range sideways {
+		sideways[i] = 100 + 0.1*float64(i%2)
+	}
+
+	tests := []struct {
+		name         string
+		skip         bool
+		position     bool
+		wantSkipped  bool
+		wantReprices bool
+	}{
+		{name: "hold with no positions is skipped", skip: true, wantSkipped: true},
+		{name: "hold with a position is still managed", skip: true, position: true, wantReprices: true},
+		{name: "disabled runs the full pipeline", skip: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockDatabaseRepository("main")
+			seedSellOff(repo)
+			repo.history[testSymbol] = hourlyCandles(sideways)
+			repo.quotes[testSymbol] = sideways[len(sideways)-1]
+			if tt.position {
+				repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", Quantity: 1, EntryPrice: 99, CurrentPrice: 99, Status: "open"})
+			}
+
+			config := testEngineConfig()
+			config.SkipIdleHolds = tt.skip
+			config.FlashCrashDropPercent = 0.1
+			config.FlashCrashWindow = time.Hour
+			engine := newTestEngine(repo, NewMockExchange(), config)
+
+			if err := engine.processPair(context.Background(), testPair); err != nil {
+				t.Fatalf("processPair() error = %v", err)
+			}
+
+			// The signal reads the history once; the flash crash check would again
+			if skipped := repo.historyReads == 1; skipped != tt.wantSkipped {
+				t.Errorf("read price history %d times, want skipped = %v", repo.historyReads, tt.wantSkipped)
+			}
+			if tt.wantReprices {
+				if got := repo.Positions()[0].CurrentPrice; got != repo.quotes[testSymbol] {
+					t.Errorf("position price = %v, want it marked to %v", got, repo.quotes[testSymbol])
+				}
+			}
+		})
+	}
+}
+
+// unavailableRepository is a MockDatabaseRepository whose pair and position
+// writes fail, as with the database down
+type unavailableRepository struct {
+	*MockDatabaseRepository
+}
+
+var errDatabaseDown = errors.New("connection refused")
+
+func (unavailableRepository) GetActiveSelectedPairs(context.Context) ([]models.SelectedPair, error) {
+	return nil, errDatabaseDown
+}
+
+func (unavailableRepository) UpdatePosition(context.Context, models.Position) error {
+	return errDatabaseDown
+}
+
+func TestRepositoryErrorsSurface(t *testing.T) {
+	mock := NewMockDatabaseRepository("main")
+	repo := unavailableRepository{mock}
+	ex := NewMockExchange()
+	generator := signals.NewGenerator(mock, signals.Config{}, utils.NewDiscardLogger())
+	engine := NewEngine(repo, ex, mock, generator, nil, nil, nil, nil, nil, nil, nil, testEngineConfig(), utils.NewDiscardLogger())
+
+	if err := engine.processTradingCycle(context.Background()); !errors.Is(err, errDatabaseDown) {
+		t.Errorf("processTradingCycle() error = %v, want the pairs lookup failure", err)
+	}
+
+	// The stop loss is placed but its close cannot be stored
+	position := mock.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 100, Quantity: 1, Status: "open"})
+	_, err := engine.checkAndExecuteSLTP(context.Background(), testPair, models.TradingConfig{StopLossPercent: 0.05, TakeProfitPercent: 0.1}, &position, 94, nil)
+	if !errors.Is(err, errDatabaseDown) {
+		t.Errorf("checkAndExecuteSLTP() error = %v, want the position update failure", err)
+	}
+	if stored := mock.Positions()[0]; stored.Status != "open" {
+		t.Errorf("stored position %s, want it left open", stored.Status)
+	}
+}
@@ -0,0 +1,420 @@
+package trader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrUnknownPositionSide is returned for a position whose side is neither buy
+// nor sell; its exits cannot be evaluated, so it is left unprotected until an
+// operator repairs it
+var ErrUnknownPositionSide = errors.New("position has an unrecognized side")
+
+// Policies for a candle whose range crosses both the stop loss and the take
+// profit. The candle does not say which was reached first, so each policy
+// encodes an assumption.
+const (
+	// ExitTieBreakClose evaluates exits against the current price only, so
+	// levels crossed and left again between cycles are missed
+	ExitTieBreakClose = "close"
+	// ExitTieBreakStopFirst assumes the stop loss was reached first, the
+	// conservative choice that never overstates results
+	ExitTieBreakStopFirst = "stop_first"
+	// ExitTieBreakCandleOpen assumes the level nearer the candle's open was
+	// reached first, so a candle that gaps open beyond one level takes it
+	ExitTieBreakCandleOpen = "candle_open"
+)
+
+// checkAndExecuteSLTP applies the stop loss, trailing stop and take profit
+// ladder to an open position and reports whether it was fully closed. The
+// trailing high-water mark and stop price, executed ladder levels and closed
+// fraction live on the position row, so after a restart exits continue from the persisted state
+// instead of re-arming from the current price. Unless the tie-break policy is
+// ExitTieBreakClose, the stop loss and take profit are also checked against
+// the range of the latest candle, which may be nil.
+func (e *Engine) checkAndExecuteSLTP(ctx context.Context, pair models.SelectedPair, config models.TradingConfig,
+	position *models.Position, currentPrice float64, candle *models.Candle) (bool, error) {
+
+	if position.Status == "closed" || position.Quantity <= 0 {
+		return true, nil
+	}
+
+	if !validPositionSide(position.Side) {
+		metrics.PositionIntegrityErrors.WithLabelValues("unknown_side").Inc()
+		return false, fmt.Errorf("%w: %q on %s, stop loss and take profit not applied", ErrUnknownPositionSide, position.Side, pair.Symbol)
+	}
+
+	stateChanged := e.updateHighWaterMark(position, currentPrice)
+	trailPercent := e.trailingStopPercent(config)
+	if trailPercent > 0 && e.updateTrailingStop(position, trailPercent) {
+		stateChanged = true
+	}
+	profit := profitPercent(*position, currentPrice)
+
+	// Worst and best return reached, over the candle's range when it is used
+	worst, best := profit, profit
+	if candle != nil && e.config.ExitTieBreak != ExitTieBreakClose && e.config.ExitTieBreak != "" {
+		worst, best = candleExcursion(*position, *candle, currentPrice)
+	}
+
+	stopHit := config.StopLossPercent > 0 && -worst >= config.StopLossPercent
+	takeHit := config.TakeProfitPercent > 0 && best >= config.TakeProfitPercent*float64(position.TakeProfitLevelsHit+1)
+	if stopHit && takeHit {
+		stopFirst := e.stopReachedFirst(*position, config, *candle)
+		e.logger.WithFields(logrus.Fields{
+			"position_id": position.ID,
+			"symbol":      pair.Symbol,
+			"candle_low":  candle.Low,
+			"candle_high": candle.High,
+			"policy":      e.config.ExitTieBreak,
+			"stop_first":  stopFirst,
+		}).Warn("Candle crossed both stop loss and take profit")
+		if stopFirst {
+			takeHit = false
+		} else {
+			stopHit = false
+		}
+	}
+
+	// Hard stop loss
+	if stopHit {
+		return e.closeRemaining(ctx, pair, *position, currentPrice, "stop loss")
+	}
+	if takeHit {
+		profit = math.Max(profit, best)
+	}
+
+	// Trailing stop, armed once the position has moved far enough in our favour
+	if trailPercent > 0 && trailingStopHit(*position, currentPrice) {
+		return e.closeRemaining(ctx, pair, *position, currentPrice, "trailing stop")
+	}
+
+	// Take profit ladder: level n fires at n x the take profit percent and
+	// closes an equal share of the original quantity, the last level closing
+	// whatever remains
+	levels := e.config.TakeProfitLevels
+	if levels < 1 {
+		levels = 1
+	}
+	for next := position.TakeProfitLevelsHit + 1; next <= levels && config.TakeProfitPercent > 0; next++ {
+		if profit < config.TakeProfitPercent*float64(next) {
+			break
+		}
+
+		fraction := 1 / float64(levels)
+		quantity := position.Quantity
+		if next < levels {
+			quantity = partialCloseQuantity(*position, fraction)
+		}
+		if !e.clearsFeeFloor(pair, *position, quantity, currentPrice, "take profit") {
+			break
+		}
+
+		if next == levels {
+			position.TakeProfitLevelsHit = next
+			return e.closeRemaining(ctx, pair, *position, currentPrice, "take profit")
+		}
+
+		closed, err := e.executePartialClose(ctx, pair, position, fraction, currentPrice, "take profit level")
+		if err != nil {
+			return false, err
+		}
+		if closed {
+			return true, nil
+		}
+		position.TakeProfitLevelsHit = next
+		stateChanged = true
+	}
+
+	if stateChanged {
+		if err := e.repo.UpdatePosition(ctx, *position); err != nil {
+			return false, fmt.Errorf("failed to persist exit state: %w", err)
+		}
+	}
+
+	return false, nil
+}
+
+// candleExcursion returns the position's worst and best return over the
+// candle's range, extended by the current price
+func candleExcursion(position models.Position, candle models.Candle, currentPrice float64) (float64, float64) {
+	low := math.Min(candle.Low, currentPrice)
+	high := math.Max(candle.High, currentPrice)
+
+	worst, best := profitPercent(position, low), profitPercent(position, high)
+	if position.Side == "sell" {
+		worst, best = best, worst
+	}
+	return worst, best
+}
+
+// stopReachedFirst applies the tie-break policy to a candle that crossed both
+// the stop loss and the next take profit level
+func (e *Engine) stopReachedFirst(position models.Position, config models.TradingConfig, candle models.Candle) bool {
+	if e.config.ExitTieBreak != ExitTieBreakCandleOpen {
+		return true
+	}
+
+	open := profitPercent(position, candle.Open)
+	toStop := open + config.StopLossPercent
+	toTake := config.TakeProfitPercent*float64(position.TakeProfitLevelsHit+1) - open
+	return toStop <= toTake
+}
+
+func (e *Engine) closeRemaining(ctx context.Context, pair models.SelectedPair, position models.Position, price float64, reason string) (bool, error) {
+	if err := e.executeMarketCloseOrder(ctx, pair, position, price, reason); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// updateHighWaterMark tracks the best price since entry and reports whether
+// it moved
+func (e *Engine) updateHighWaterMark(position *models.Position, currentPrice float64) bool {
+	if position.HighWaterMark <= 0 {
+		position.HighWaterMark = position.EntryPrice
+	}
+
+	if position.Side == "sell" {
+		if currentPrice < position.HighWaterMark {
+			position.HighWaterMark = currentPrice
+			return true
+		}
+		return false
+	}
+
+	if currentPrice > position.HighWaterMark {
+		position.HighWaterMark = currentPrice
+		return true
+	}
+	return false
+}
+
+// trailingStopPercent is the pair's trail distance, falling back to the
+// engine default
+func (e *Engine) trailingStopPercent(config models.TradingConfig) float64 {
+	if config.TrailingStopPercent > 0 {
+		return config.TrailingStopPercent
+	}
+	return e.config.TrailingStopPercent
+}
+
+// updateTrailingStop arms the trailing stop once the high-water mark is far
+// enough from entry and ratchets it behind the mark. The stop only ever moves
+// in the position's favour, so narrowing or widening the trail later never
+// gives back protection already locked in. It reports whether the stop moved.
+func (e *Engine) updateTrailingStop(position *models.Position, percent float64) bool {
+	if position.EntryPrice <= 0 {
+		return false
+	}
+
+	if position.Side == "sell" {
+		if (position.EntryPrice-position.HighWaterMark)/position.EntryPrice < e.config.TrailingStopActivation {
+			return false
+		}
+		stop := position.HighWaterMark * (1 + percent)
+		if position.TrailingStopPrice > 0 && stop >= position.TrailingStopPrice {
+			return false
+		}
+		position.TrailingStopPrice = stop
+		return true
+	}
+
+	if (position.HighWaterMark-position.EntryPrice)/position.EntryPrice < e.config.TrailingStopActivation {
+		return false
+	}
+	stop := position.HighWaterMark * (1 - percent)
+	if stop <= position.TrailingStopPrice {
+		return false
+	}
+	position.TrailingStopPrice = stop
+	return true
+}
+
+// trailingStopHit reports whether the price retraced to the armed stop
+func trailingStopHit(position models.Position, currentPrice float64) bool {
+	if position.TrailingStopPrice <= 0 {
+		return false
+	}
+	if position.Side == "sell" {
+		return currentPrice >= position.TrailingStopPrice
+	}
+	return currentPrice <= position.TrailingStopPrice
+}
+
+// executePartialClose closes the given fraction of the position's original
+// quantity with a market order, leaving the remainder open. A fraction
+// covering all that remains closes the position, which it reports.
+func (e *Engine) executePartialClose(ctx context.Context, pair models.SelectedPair, position *models.Position,
+	fraction, price float64, reason string) (bool, error) {
+
+	original := originalQuantity(*position)
+	quantity := original * fraction
+	if quantity >= position.Quantity {
+		return e.closeRemaining(ctx, pair, *position, price, reason)
+	}
+
+	if e.config.ObserveOnly {
+		e.observeExit(ctx, pair, *position, WouldPartialExit, "market", quantity, price, reason)
+		return false, nil
+	}
+
+	if err := e.gridStrategy.CancelExit(ctx, *position); err != nil {
+		return false, err
+	}
+
+	closeSide := "sell"
+	if position.Side == "sell" {
+		closeSide = "buy"
+	}
+
+	orderResp, err := e.exchange.PlaceMarketOrder(pair.Symbol, closeSide, quantity)
+	if err != nil {
+		return false, fmt.Errorf("failed to place partial close order: %w", err)
+	}
+
+	fees := closingFees(e.exchange, e.config, pair.Symbol, position.EntryPrice, price, quantity, true, e.logger)
+	realized := computeRealizedPnL(position.Side, position.EntryPrice, price, quantity, fees)
+
+	position.RealizedPnL += realized
+	position.TotalFees += fees
+	position.Quantity -= quantity
+	position.ClosedFraction += quantity / original
+	position.Status = "partial"
+	position.CurrentPrice = price
+	position.UnrealizedPnL = profitPercent(*position, price) * position.EntryPrice * position.Quantity
+
+	if err := e.repo.UpdatePosition(ctx, *position); err != nil {
+		return false, fmt.Errorf("failed to update position: %w", err)
+	}
+	metrics.RealizedPnL.WithLabelValues(e.repo.Account()).Add(realized)
+
+	e.logger.WithFields(logrus.Fields{
+		"symbol":          pair.Symbol,
+		"position_id":     position.ID,
+		"closed_quantity": quantity,
+		"remaining":       position.Quantity,
+		"closed_fraction": position.ClosedFraction,
+		"realized_pnl":    realized,
+		"reason":          reason,
+	}).Info("Partially closed position")
+
+	order := models.Order{
+		PositionID:    &position.ID,
+		PairID:        pair.ID,
+		KuCoinOrderID: orderResp.OrderId,
+		ClientOid:     orderResp.ClientOid,
+		Side:          closeSide,
+		Type:          "market",
+		Quantity:      quantity,
+		Price:         price,
+		Status:        "pending",
+		StrategyTag:   position.StrategyTag,
+		ConfigVersion: position.ConfigVersion,
+	}
+
+	return false, e.repo.CreateOrder(ctx, order)
+}
+
+// originalQuantity returns the quantity the position was opened with, before
+// any partial closes
+func originalQuantity(position models.Position) float64 {
+	if position.ClosedFraction < 1 {
+		return position.Quantity / (1 - position.ClosedFraction)
+	}
+	return position.Quantity
+}
+
+// partialCloseQuantity returns the quantity a partial close of the given
+// fraction of the original position executes
+func partialCloseQuantity(position models.Position, fraction float64) float64 {
+	return math.Min(originalQuantity(position)*fraction, position.Quantity)
+}
+
+// clearsFeeFloor reports whether closing the given quantity at price realizes
+// at least the configured minimum PnL once the round trip's fees are paid.
+// Only discretionary closes consult it; stop losses, trailing stops and
+// flattening disabled pairs always execute.
+func (e *Engine) clearsFeeFloor(pair models.SelectedPair, position models.Position, quantity, price float64, reason string) bool {
+	if !e.config.ExitFeeFloorEnabled {
+		return true
+	}
+
+	fees := (position.EntryPrice + price) * quantity * e.config.ExitFeeRate
+	net := computeRealizedPnL(position.Side, position.EntryPrice, price, quantity, fees)
+
+	if net >= e.config.ExitMinNetPnL {
+		return true
+	}
+
+	e.logger.WithFields(logrus.Fields{
+		"symbol":      pair.Symbol,
+		"position_id": position.ID,
+		"quantity":    quantity,
+		"gross_pnl":   net + fees,
+		"fees":        fees,
+		"net_pnl":     net,
+		"min_net_pnl": e.config.ExitMinNetPnL,
+		"reason":      reason,
+	}).Info("Close skipped, net PnL after fees below the floor")
+
+	return false
+}
+
+// validPositionSide reports whether the exit logic understands the side
+func validPositionSide(side string) bool {
+	return side == "buy" || side == "sell"
+}
+
+// checkPositionConsistency flags open positions the exit logic cannot
+// manage, so corrupted rows surface at startup rather than sitting silently
+// unprotected
+func (e *Engine) checkPositionConsistency(ctx context.Context) error {
+	positions, err := e.repo.GetOpenPositionsWithInvalidSide(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, position := range positions {
+		metrics.PositionIntegrityErrors.WithLabelValues("unknown_side").Inc()
+		e.logger.WithFields(logrus.Fields{
+			"position_id": position.ID,
+			"pair_id":     position.PairID,
+			"side":        position.Side,
+			"quantity":    position.Quantity,
+		}).Error("Open position has an unrecognized side and will not get stop loss or take profit")
+	}
+
+	return nil
+}
+
+// updateExcursions widens the position's maximum favorable and adverse
+// excursion to include the given price. Sampled once per cycle, they miss
+// extremes reached between cycles.
+func updateExcursions(position *models.Position, price float64) {
+	profit := profitPercent(*position, price)
+	if profit > position.MaxFavorableExcursion {
+		position.MaxFavorableExcursion = profit
+	}
+	if -profit > position.MaxAdverseExcursion {
+		position.MaxAdverseExcursion = -profit
+	}
+}
+
+// profitPercent returns the position's return relative to its entry price,
+// negative when losing
+func profitPercent(position models.Position, price float64) float64 {
+	if position.EntryPrice <= 0 {
+		return 0
+	}
+	if position.Side == "sell" {
+		return (position.EntryPrice - price) / position.EntryPrice
+	}
+	return (price - position.EntryPrice) / position.EntryPrice
+}
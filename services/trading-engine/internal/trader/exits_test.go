@@ -0,0 +1,468 @@
+package trader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/signals"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/sink"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// trailingConfig trails 5% behind the high-water mark once the position is
+// 2% in profit, with a two level take profit ladder at 10% and 20%
+func trailingConfig() (EngineConfig, models.TradingConfig) {
+	config := testEngineConfig()
+	config.TrailingStopPercent = 0.05
+	config.TrailingStopActivation = 0.02
+	config.TakeProfitLevels = 2
+
+	return config, models.TradingConfig{StopLossPercent: 0.05, TakeProfitPercent: 0.1}
+}
+
+// restartAndCheck builds a fresh engine on the same storage, reloads the open
+// position as the engine does after a restart and applies exits at the price
+func restartAndCheck(t *testing.T, repo *MockDatabaseRepository, ex *MockExchange, price float64) bool {
+	t.Helper()
+
+	config, pairConfig := trailingConfig()
+	engine := newTestEngine(repo, ex, config)
+
+	positions, err := repo.GetOpenPositions(context.Background(), testPair.ID)
+	if err != nil || len(positions) != 1 {
+		t.Fatalf("GetOpenPositions() = %d positions, %v; want 1", len(positions), err)
+	}
+
+	closed, err := engine.checkAndExecuteSLTP(context.Background(), testPair, pairConfig, &positions[0], price, nil)
+	if err != nil {
+		t.Fatalf("checkAndExecuteSLTP() error = %v", err)
+	}
+	return closed
+}
+
+func TestTrailingStopResumesAfterRestart(t *testing.T) {
+	repo := NewMockDatabaseRepository("main")
+	ex := NewMockExchange()
+	position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 100, Quantity: 1, Status: "open"})
+
+	// The first take profit level fires at 112 and the trail arms behind it
+	if restartAndCheck(t, repo, ex, 112) {
+		t.Fatal("position closed at 112, want the first ladder level only")
+	}
+
+	// After a restart the mark keeps rising from the persisted 112
+	if restartAndCheck(t, repo, ex, 115) {
+		t.Fatal("position closed at 115, want the trail ratcheted")
+	}
+
+	persisted, _ := repo.GetPositionByID(context.Background(), position.ID)
+	if persisted.HighWaterMark != 115 || !approxEqual(persisted.TrailingStopPrice, 109.25) {
+		t.Fatalf("persisted mark/stop = %v/%v, want 115/109.25", persisted.HighWaterMark, persisted.TrailingStopPrice)
+	}
+	if persisted.TakeProfitLevelsHit != 1 || !approxEqual(persisted.ClosedFraction, 0.5) || !approxEqual(persisted.Quantity, 0.5) {
+		t.Fatalf("persisted ladder = %d levels, %v closed, %v left; want 1, 0.5, 0.5",
+			persisted.TakeProfitLevelsHit, persisted.ClosedFraction, persisted.Quantity)
+	}
+	if placed := ex.Placed(); len(placed) != 1 {
+		t.Fatalf("placed %d orders, want the first ladder level not repeated after the restart", len(placed))
+	}
+
+	// A retrace to 109 hits the trail from the persisted mark, though it
+	// is still 9% above entry and far from a freshly armed trail
+	if !restartAndCheck(t, repo, ex, 109) {
+		t.Fatal("position still open at 109, want the persisted trailing stop hit")
+	}
+
+	placed := ex.Placed()
+	if len(placed) != 2 || placed[1].Side != "sell" || !approxEqual(placed[1].Quantity, 0.5) {
+		t.Fatalf("placed %+v, want the remaining 0.5 sold", placed)
+	}
+}
+
+func TestTrailingStopWithoutPersistedStateRearms(t *testing.T) {
+	repo := NewMockDatabaseRepository("main")
+	ex := NewMockExchange()
+	repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 100, Quantity: 1, Status: "open"})
+
+	// With no mark on the row the trail arms from the current price
+	if restartAndCheck(t, repo, ex, 109) {
+		t.Fatal("position closed at 109 with no persisted trail, want it armed instead")
+	}
+
+	positions, _ := repo.GetOpenPositions(context.Background(), testPair.ID)
+	if positions[0].HighWaterMark != 109 || !approxEqual(positions[0].TrailingStopPrice, 103.55) {
+		t.Errorf("mark/stop = %v/%v, want 109/103.55", positions[0].HighWaterMark, positions[0].TrailingStopPrice)
+	}
+}
+
+func TestTrailingStopRatchetsAndTriggers(t *testing.T) {
+	// A 5% trail from the pair's config, armed 2% in profit, with the take
+	// profit disabled so only the trail can close
+	pairConfig := models.TradingConfig{StopLossPercent: 0.1, TrailingStopPercent: 0.05}
+
+	tests := []struct {
+		name       string
+		side       string
+		path       []float64
+		wantClosed bool
+		wantMark   float64
+		wantStop   float64
+	}{
+		{name: "long ratchets up and holds on a pullback", side: "buy", path: []float64{101, 104, 110, 107}, wantMark: 110, wantStop: 104.5},
+		{name: "long retraces past the stop", side: "buy", path: []float64{104, 110, 104}, wantClosed: true},
+		{name: "long below the activation stays unarmed", side: "buy", path: []float64{101, 99, 101.5}, wantMark: 101.5, wantStop: 0},
+		{name: "short ratchets down and holds on a bounce", side: "sell", path: []float64{96, 90, 93}, wantMark: 90, wantStop: 94.5},
+		{name: "short retraces past the stop", side: "sell", path: []float64{96, 90, 95}, wantClosed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+			config := testEngineConfig()
+			config.TrailingStopActivation = 0.02
+			engine := newTestEngine(repo, ex, config)
+			logger, hook := test.NewNullLogger()
+			engine.logger = logger
+			repo.AddPosition(models.Position{PairID: testPair.ID, Side: tt.side, EntryPrice: 100, Quantity: 1, Status: "open"})
+
+			closed := false
+			for _, price := range tt.path {
+				// Every step starts from the stored row, so the stop only
+				// carries over when it was persisted
+				positions, _ := repo.GetOpenPositions(context.Background(), testPair.ID)
+				if len(positions) != 1 {
+					t.Fatalf("%d open positions before the step to %v, want 1", len(positions), price)
+				}
+				var err error
+				if closed, err = engine.checkAndExecuteSLTP(context.Background(), testPair, pairConfig, &positions[0], price, nil); err != nil {
+					t.Fatalf("checkAndExecuteSLTP() error = %v", err)
+				}
+			}
+
+			if closed != tt.wantClosed {
+				t.Fatalf("closed = %v, want %v", closed, tt.wantClosed)
+			}
+			if tt.wantClosed {
+				if reason := closeReason(hook); reason != "trailing stop" {
+					t.Errorf("closed for %q, want the trailing stop", reason)
+				}
+				return
+			}
+			if placed := ex.Placed(); len(placed) != 0 {
+				t.Errorf("placed %+v, want the position held", placed)
+			}
+			persisted := repo.Positions()[0]
+			if persisted.HighWaterMark != tt.wantMark || !approxEqual(persisted.TrailingStopPrice, tt.wantStop) {
+				t.Errorf("persisted mark/stop = %v/%v, want %v/%v", persisted.HighWaterMark, persisted.TrailingStopPrice, tt.wantMark, tt.wantStop)
+			}
+		})
+	}
+}
+
+func TestUnknownSidePositionIsFlagged(t *testing.T) {
+	repo := NewMockDatabaseRepository("main")
+	ex := NewMockExchange()
+	engine := newTestEngine(repo, ex, testEngineConfig())
+	integrityErrors := metrics.PositionIntegrityErrors.WithLabelValues("unknown_side")
+
+	position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: "long", EntryPrice: 100, Quantity: 1, Status: "open"})
+	before := testutil.ToFloat64(integrityErrors)
+
+	// Far through any stop a buy or sell position would have
+	closed, err := engine.checkAndExecuteSLTP(context.Background(), testPair,
+		models.TradingConfig{StopLossPercent: 0.05, TakeProfitPercent: 0.1}, &position, 50, nil)
+	if !errors.Is(err, ErrUnknownPositionSide) {
+		t.Fatalf("checkAndExecuteSLTP() error = %v, want ErrUnknownPositionSide", err)
+	}
+	if closed {
+		t.Error("reported closed, want the position left for an operator")
+	}
+	if placed := ex.Placed(); len(placed) != 0 {
+		t.Errorf("placed %+v guessing at the side, want nothing", placed)
+	}
+	if got := testutil.ToFloat64(integrityErrors) - before; got != 1 {
+		t.Errorf("integrity error metric rose by %v, want 1", got)
+	}
+}
+
+func TestPositionConsistencyCheckFlagsUnknownSides(t *testing.T) {
+	repo := NewMockDatabaseRepository("main")
+	engine := newTestEngine(repo, NewMockExchange(), testEngineConfig())
+	integrityErrors := metrics.PositionIntegrityErrors.WithLabelValues("unknown_side")
+
+	repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 100, Quantity: 1, Status: "open"})
+	repo.AddPosition(models.Position{PairID: testPair.ID, Side: "", EntryPrice: 100, Quantity: 1, Status: "open"})
+	repo.AddPosition(models.Position{PairID: testPair.ID, Side: "BUY", EntryPrice: 100, Quantity: 1, Status: "open"})
+	before := testutil.ToFloat64(integrityErrors)
+
+	if err := engine.checkPositionConsistency(context.Background()); err != nil {
+		t.Fatalf("checkPositionConsistency() error = %v", err)
+	}
+
+	if got := testutil.ToFloat64(integrityErrors) - before; got != 2 {
+		t.Errorf("integrity error metric rose by %v, want 2 for the empty and upper-case sides", got)
+	}
+}
+
+func TestFeeFloorBlocksDiscretionaryCloseOnly(t *testing.T) {
+	feeFloorConfig := func() EngineConfig {
+		config := testEngineConfig()
+		config.ExitFeeFloorEnabled = true
+		config.ExitFeeRate = 0.001
+		config.ExitMinNetPnL = 0.05
+		return config
+	}
+	pairConfig := models.TradingConfig{StopLossPercent: 0.05, TakeProfitPercent: 0.1}
+
+	tests := []struct {
+		name       string
+		price      float64
+		stop       bool // Close through the stop-loss path rather than a sell signal
+		wantClosed bool
+	}{
+		// 0.1 gross against 0.2001 of round trip fees
+		{name: "sell signal below the floor", price: 100.1, wantClosed: false},
+		{name: "sell signal above the floor", price: 101, wantClosed: true},
+		{name: "stop loss at a net loss", price: 94, stop: true, wantClosed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := NewMockDatabaseRepository("main")
+			ex := NewMockExchange()
+			engine := newTestEngine(repo, ex, feeFloorConfig())
+			position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 100, Quantity: 1, Status: "open"})
+
+			if tt.stop {
+				closed, err := engine.checkAndExecuteSLTP(ctx, testPair, pairConfig, &position, tt.price, nil)
+				if err != nil {
+					t.Fatalf("checkAndExecuteSLTP() error = %v", err)
+				}
+				if !closed {
+					t.Error("stop loss reported open, want it closed whatever the fees")
+				}
+			} else if err := engine.executeSellOrder(ctx, testPair, position, tt.price); err != nil {
+				t.Fatalf("executeSellOrder() error = %v", err)
+			}
+
+			placed := ex.Placed()
+			if tt.wantClosed && (len(placed) != 1 || placed[0].Side != "sell") {
+				t.Fatalf("placed %+v, want one sell", placed)
+			}
+			if !tt.wantClosed && len(placed) != 0 {
+				t.Fatalf("placed %+v, want the close skipped", placed)
+			}
+			if got := repo.Positions()[0].Status; (got == "closed") != tt.wantClosed {
+				t.Errorf("position status = %s, want closed %v", got, tt.wantClosed)
+			}
+		})
+	}
+}
+
+func TestExcursionsTrackedAcrossPricePath(t *testing.T) {
+	path := []float64{102, 97, 108, 104, 95, 101}
+
+	tests := []struct {
+		name          string
+		side          string
+		track         bool
+		wantFavorable float64
+		wantAdverse   float64
+	}{
+		{name: "long", side: "buy", track: true, wantFavorable: 0.08, wantAdverse: 0.05},
+		{name: "short", side: "sell", track: true, wantFavorable: 0.05, wantAdverse: 0.08},
+		{name: "tracking disabled", side: "buy", track: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testEngineConfig()
+			config.TrackExcursions = tt.track
+			engine := newTestEngine(NewMockDatabaseRepository("main"), NewMockExchange(), config)
+
+			position := models.Position{PairID: testPair.ID, Side: tt.side, EntryPrice: 100, Quantity: 1, Status: "open"}
+			for _, price := range path {
+				engine.markToMarket(&position, price)
+			}
+
+			if !approxEqual(position.MaxFavorableExcursion, tt.wantFavorable) || !approxEqual(position.MaxAdverseExcursion, tt.wantAdverse) {
+				t.Errorf("MFE/MAE = %v/%v, want %v/%v", position.MaxFavorableExcursion, position.MaxAdverseExcursion,
+					tt.wantFavorable, tt.wantAdverse)
+			}
+		})
+	}
+}
+
+// closeReason returns the reason of the logged market close, or "" when the
+// position was not closed
+func closeReason(hook *test.Hook) string {
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == "Closed position with market order" {
+			reason, _ := entry.Data["reason"].(string)
+			return reason
+		}
+	}
+	return ""
+}
+
+func TestGapCandleTieBreak(t *testing.T) {
+	pairConfig := models.TradingConfig{StopLossPercent: 0.05, TakeProfitPercent: 0.1}
+
+	tests := []struct {
+		name       string
+		policy     string
+		side       string
+		open       float64
+		wantReason string
+	}{
+		// The long's candle spans 94 to 111 around an entry at 100 and is back at 100
+		{name: "close only sees the current price", policy: ExitTieBreakClose, side: "buy", open: 100, wantReason: ""},
+		{name: "stop first is conservative", policy: ExitTieBreakStopFirst, side: "buy", open: 109, wantReason: "stop loss"},
+		{name: "open near the take profit", policy: ExitTieBreakCandleOpen, side: "buy", open: 109, wantReason: "take profit"},
+		{name: "open near the stop", policy: ExitTieBreakCandleOpen, side: "buy", open: 97, wantReason: "stop loss"},
+		{name: "short with open near the take profit", policy: ExitTieBreakCandleOpen, side: "sell", open: 92, wantReason: "take profit"},
+		{name: "short stop first", policy: ExitTieBreakStopFirst, side: "sell", open: 92, wantReason: "stop loss"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+			config := testEngineConfig()
+			config.ExitTieBreak = tt.policy
+			engine := newTestEngine(repo, ex, config)
+			logger, hook := test.NewNullLogger()
+			engine.logger = logger
+
+			low, high := 94.0, 111.0
+			if tt.side == "sell" {
+				low, high = 89.0, 106.0 // Mirrored around the entry for the short
+			}
+			candle := &models.Candle{Open: tt.open, High: high, Low: low, Close: 100}
+			position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: tt.side, EntryPrice: 100, Quantity: 1, Status: "open"})
+
+			closed, err := engine.checkAndExecuteSLTP(context.Background(), testPair, pairConfig, &position, 100, candle)
+			if err != nil {
+				t.Fatalf("checkAndExecuteSLTP() error = %v", err)
+			}
+			if closed != (tt.wantReason != "") {
+				t.Fatalf("closed = %v, want %v", closed, tt.wantReason != "")
+			}
+			if got := closeReason(hook); got != tt.wantReason {
+				t.Errorf("closed for %q, want %q", got, tt.wantReason)
+			}
+		})
+	}
+}
+
+// eventRecorder is a trade sink keeping what it receives
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []sink.TradeEvent
+}
+
+func (r *eventRecorder) Name() string {
+	return "recorder"
+}
+
+func (r *eventRecorder) Send(_ context.Context, event sink.TradeEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestStopLossPublishesTradeEvent(t *testing.T) {
+	repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+	price := seedSellOff(repo)
+	position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", Quantity: 1, EntryPrice: 101, CurrentPrice: 101, Status: "open"})
+
+	config := testEngineConfig()
+	config.MaxPositionsPerPair = 1
+	engine := newTestEngine(repo, ex, config)
+	recorder := &eventRecorder{}
+	engine.trades = sink.NewDispatcher([]sink.Sink{recorder}, 10, time.Second, utils.NewDiscardLogger())
+
+	if err := engine.processPair(context.Background(), testPair); err != nil {
+		t.Fatalf("processPair() error = %v", err)
+	}
+
+	// Stopping the dispatcher delivers what was queued
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := engine.trades.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if len(recorder.events) != 1 {
+		t.Fatalf("published %d trade events, want 1 for the stop loss", len(recorder.events))
+	}
+	event := recorder.events[0]
+	if event.Type != sink.EventPositionClosed || event.PositionID != position.ID || event.Symbol != testSymbol {
+		t.Errorf("event = %+v, want the close of %s", event, position.ID)
+	}
+	if !approxEqual(event.ExitPrice, price) || event.AccountID != "main" {
+		t.Errorf("exit price/account = %v/%s, want %v/main", event.ExitPrice, event.AccountID, price)
+	}
+}
+
+// rejectingExchange is a MockExchange whose market orders the venue rejects
+type rejectingExchange struct {
+	*MockExchange
+}
+
+func (rejectingExchange) PlaceMarketOrder(string, string, float64) (*kucoin.OrderResponse, error) {
+	return nil, errors.New("400100: order rejected")
+}
+
+func TestStopLossRejectedByExchangeKeepsPosition(t *testing.T) {
+	repo := NewMockDatabaseRepository("main")
+	ex := rejectingExchange{NewMockExchange()}
+	generator := signals.NewGenerator(repo, signals.Config{}, utils.NewDiscardLogger())
+	engine := NewEngine(repo, ex, repo, generator, nil, nil, nil, nil, nil, nil, nil, testEngineConfig(), utils.NewDiscardLogger())
+	position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 100, Quantity: 1, Status: "open"})
+
+	closed, err := engine.checkAndExecuteSLTP(context.Background(), testPair, models.TradingConfig{StopLossPercent: 0.05, TakeProfitPercent: 0.1}, &position, 94, nil)
+	if err == nil || closed {
+		t.Fatalf("checkAndExecuteSLTP() = %v, %v; want the rejection returned", closed, err)
+	}
+
+	if stored := repo.Positions()[0]; stored.Status != "open" || stored.Quantity != 1 || stored.RealizedPnL != 0 {
+		t.Errorf("position %s with quantity %v and PnL %v, want it untouched", stored.Status, stored.Quantity, stored.RealizedPnL)
+	}
+	if orders := repo.Orders(); len(orders) != 0 {
+		t.Errorf("recorded %d orders, want none for the rejected close", len(orders))
+	}
+}
+
+func TestLadderLevelCoveringRemainderClosesPosition(t *testing.T) {
+	repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+	config := testEngineConfig()
+	config.TakeProfitLevels = 3
+	engine := newTestEngine(repo, ex, config)
+
+	// A third of the original 1 is more than the 0.3 left after the first level
+	position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 100, Quantity: 0.3,
+		ClosedFraction: 0.7, TakeProfitLevelsHit: 1, Status: "partial"})
+
+	closed, err := engine.checkAndExecuteSLTP(context.Background(), testPair, models.TradingConfig{StopLossPercent: 0.05, TakeProfitPercent: 0.1}, &position, 125, nil)
+	if err != nil || !closed {
+		t.Fatalf("checkAndExecuteSLTP() = %v, %v; want the position closed", closed, err)
+	}
+
+	if stored := repo.Positions()[0]; stored.Status != "closed" {
+		t.Errorf("stored position %s, want the close kept", stored.Status)
+	}
+	if placed := ex.Placed(); len(placed) != 1 || placed[0].Quantity != 0.3 {
+		t.Errorf("placed %+v, want one close of the remaining 0.3", placed)
+	}
+}
@@ -0,0 +1,193 @@
+package trader
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/quotes"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/signals"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// Exposure limit modes
+const (
+	// ExposureGross sums the market value of every position regardless of side
+	ExposureGross = "gross"
+	// ExposureNet lets long and short positions offset each other
+	ExposureNet = "net"
+)
+
+// minCorrelationSamples is the fewest aligned returns a pair correlation is
+// estimated from; with fewer the correlation counts as unknown
+const minCorrelationSamples = 10
+
+// Exposure is the market value of a set of open positions in USDT
+type Exposure struct {
+	Gross         float64 // Sum of absolute position values
+	Net           float64 // Correlation-adjusted value after offsetting longs against shorts
+	UnrealizedPnL float64
+	StaleRates    bool // Some values were converted with a stale or missing quote rate
+}
+
+// ExposureCalculator measures open exposure gross and net of offsetting
+// positions. Net exposure treats each pair as one unit of risk and combines
+// them like portfolio volatility, sqrt(sum of vi*vj*corr(i,j)) over the signed
+// pair values v: positions on the same pair net fully, positions on
+// different pairs net to the extent their returns are correlated over the
+// window. An unknown correlation is taken as 1 between same-side exposures
+// and 0 between opposite ones, so missing data never shrinks the figure.
+type ExposureCalculator struct {
+	priceHistory signals.PriceHistoryProvider
+	quoteRates   *quotes.Converter
+	window       time.Duration // Returns the correlations are estimated from
+	logger       *logrus.Logger
+}
+
+func NewExposureCalculator(priceHistory signals.PriceHistoryProvider, quoteRates *quotes.Converter, window time.Duration, logger *logrus.Logger) *ExposureCalculator {
+	return &ExposureCalculator{
+		priceHistory: priceHistory,
+		quoteRates:   quoteRates,
+		window:       window,
+		logger:       logger,
+	}
+}
+
+// Calculate returns the gross and net exposure of the positions, valued at
+// their current prices. symbols maps pair IDs to symbols; pairs missing from
+// it are treated as uncorrelated with everything else and as quoted in USDT.
+func (c *ExposureCalculator) Calculate(ctx context.Context, positions []models.Position, symbols map[int64]string) (Exposure, error) {
+	var exposure Exposure
+
+	rates, stale := usdtRates(ctx, c.quoteRates, symbols)
+	exposure.StaleRates = stale
+
+	byPair := make(map[int64]float64)
+	for _, position := range positions {
+		rate := rateFor(rates, position.PairID)
+		value := signedValue(position, position.CurrentPrice) * rate
+		exposure.UnrealizedPnL += position.UnrealizedPnL * rate
+		exposure.Gross += math.Abs(value)
+		byPair[position.PairID] += value
+	}
+
+	pairIDs := make([]int64, 0, len(byPair))
+	for pairID := range byPair {
+		pairIDs = append(pairIDs, pairID)
+	}
+	sort.Slice(pairIDs, func(i, j int) bool { return pairIDs[i] < pairIDs[j] })
+
+	since := time.Now().Add(-c.window)
+	returns := make([]map[int64]float64, len(pairIDs))
+	values := make([]float64, len(pairIDs))
+	for i, pairID := range pairIDs {
+		values[i] = byPair[pairID]
+
+		symbol, ok := symbols[pairID]
+		if !ok || len(pairIDs) < 2 {
+			continue
+		}
+		candles, err := c.priceHistory.GetPriceHistory(ctx, symbol, since)
+		if err != nil {
+			return Exposure{}, err
+		}
+		returns[i] = returnSeries(candles)
+	}
+
+	exposure.Net = netExposure(values, func(i, j int) (float64, bool) {
+		if returns[i] == nil || returns[j] == nil {
+			return 0, false
+		}
+		return alignedCorrelation(returns[i], returns[j])
+	})
+
+	return exposure, nil
+}
+
+// usdtRates returns the USDT rate of each pair's quote currency. A stale rate
+// is still used, and a missing one leaves the pair's values unconverted; the
+// second result reports whether either happened.
+func usdtRates(ctx context.Context, converter *quotes.Converter, symbols map[int64]string) (map[int64]float64, bool) {
+	rates := make(map[int64]float64, len(symbols))
+	stale := false
+	for pairID, symbol := range symbols {
+		rate := converter.Rate(ctx, quotes.QuoteCurrency(symbol))
+		if rate.Stale {
+			stale = true
+		}
+		if !rate.Missing {
+			rates[pairID] = rate.Value
+		}
+	}
+	return rates, stale
+}
+
+// rateFor returns the pair's USDT rate, 1 when it is unknown
+func rateFor(rates map[int64]float64, pairID int64) float64 {
+	if rate, ok := rates[pairID]; ok {
+		return rate
+	}
+	return 1
+}
+
+// signedValue returns the position's market value at the price, negative for
+// short positions
+func signedValue(position models.Position, price float64) float64 {
+	value := position.Quantity * price
+	if position.Side == "sell" {
+		return -value
+	}
+	return value
+}
+
+// netExposure combines signed values given the correlation between any two
+// of them. correlation reports false when it is unknown.
+func netExposure(values []float64, correlation func(i, j int) (float64, bool)) float64 {
+	variance := 0.0
+	for i := range values {
+		variance += values[i] * values[i]
+		for j := i + 1; j < len(values); j++ {
+			corr, ok := correlation(i, j)
+			if !ok {
+				corr = 0
+				if values[i]*values[j] > 0 {
+					corr = 1
+				}
+			}
+			variance += 2 * values[i] * values[j] * corr
+		}
+	}
+
+	return math.Sqrt(math.Max(variance, 0))
+}
+
+// returnSeries maps each candle's timestamp to its close-to-close return
+func returnSeries(candles []models.Candle) map[int64]float64 {
+	series := make(map[int64]float64, len(candles))
+	for i := 1; i < len(candles); i++ {
+		if candles[i-1].Close > 0 {
+			series[candles[i].Timestamp.Unix()] = candles[i].Close/candles[i-1].Close - 1
+		}
+	}
+	return series
+}
+
+// alignedCorrelation correlates two return series over their common
+// timestamps
+func alignedCorrelation(a, b map[int64]float64) (float64, bool) {
+	var x, y []float64
+	for timestamp, value := range a {
+		if other, ok := b[timestamp]; ok {
+			x = append(x, value)
+			y = append(y, other)
+		}
+	}
+
+	if len(x) < minCorrelationSamples {
+		return 0, false
+	}
+	return utils.CalculateCorrelation(x, y), true
+}
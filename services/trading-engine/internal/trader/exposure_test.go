@@ -0,0 +1,97 @@
+package trader
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// closesFromReturns compounds the repeating return pattern from 100 into n+1
+// closes
+func closesFromReturns(n int, pattern ...float64) []float64 {
+	closes := []float64{100}
+	for i := 0; i < n; i++ {
+		closes = append(closes, closes[i]*(1+pattern[i%len(pattern)]))
+	}
+	return closes
+}
+
+func TestGrossVersusNetExposureForHedgedBook(t *testing.T) {
+	// A 100 USDT long on BTC against a 100 USDT short on ETH
+	hedged := []models.Position{
+		{PairID: 1, Side: "buy", Quantity: 1, CurrentPrice: 100, Status: "open"},
+		{PairID: 2, Side: "sell", Quantity: 2, CurrentPrice: 50, Status: "open"},
+	}
+	symbols := map[int64]string{1: "BTC-USDT", 2: "ETH-USDT"}
+	alternating := closesFromReturns(48, 0.01, -0.01)
+
+	tests := []struct {
+		name      string
+		positions []models.Position
+		ethCloses []float64 // nil leaves ETH without history
+		wantNet   float64
+	}{
+		{name: "perfectly correlated hedge nets out", positions: hedged, ethCloses: alternating, wantNet: 0},
+		{name: "uncorrelated hedge", positions: hedged, ethCloses: closesFromReturns(48, 0.01, 0.01, -0.01, -0.01), wantNet: 100 * math.Sqrt2},
+		{name: "unknown correlation does not offset", positions: hedged, wantNet: 100 * math.Sqrt2},
+		{
+			name: "same side with unknown correlation adds up",
+			positions: []models.Position{
+				{PairID: 1, Side: "buy", Quantity: 1, CurrentPrice: 100, Status: "open"},
+				{PairID: 2, Side: "buy", Quantity: 2, CurrentPrice: 50, Status: "open"},
+			},
+			wantNet: 200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockDatabaseRepository("main")
+			repo.history["BTC-USDT"] = hourlyCandles(alternating)
+			if tt.ethCloses != nil {
+				repo.history["ETH-USDT"] = hourlyCandles(tt.ethCloses)
+			}
+			calculator := NewExposureCalculator(repo, nil, 72*time.Hour, utils.NewDiscardLogger())
+
+			exposure, err := calculator.Calculate(context.Background(), tt.positions, symbols)
+			if err != nil {
+				t.Fatalf("Calculate() error = %v", err)
+			}
+			if exposure.Gross != 200 {
+				t.Errorf("gross = %v, want 200", exposure.Gross)
+			}
+			if math.Abs(exposure.Net-tt.wantNet) > 1e-6 {
+				t.Errorf("net = %v, want %v", exposure.Net, tt.wantNet)
+			}
+		})
+	}
+}
+
+func TestPairExposureModes(t *testing.T) {
+	positions := []models.Position{
+		{PairID: testPair.ID, Side: "buy", Quantity: 3, Status: "open"},
+		{PairID: testPair.ID, Side: "sell", Quantity: 2, Status: "open"},
+		{PairID: testPair.ID, Side: "sell", Quantity: 5, Status: "closed"},
+	}
+
+	tests := []struct {
+		mode string
+		want float64
+	}{
+		{mode: ExposureGross, want: 500},
+		{mode: ExposureNet, want: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			risk := NewRiskManager(NewMockDatabaseRepository("main"), nil, EngineConfig{ExposureMode: tt.mode}, utils.NewDiscardLogger())
+			if got := risk.calculateTotalExposure(positions, 100); got != tt.want {
+				t.Errorf("calculateTotalExposure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package trader
+
+import (
+	"math"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/exchange"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// Reasons an order's fees are flagged
+const (
+	// FeeAnomalyRate flags quote fees outside the tolerance of the fee tier
+	FeeAnomalyRate = "rate"
+	// FeeAnomalyCurrency flags fees charged in a currency other than the
+	// quote, which are not deducted from PnL
+	FeeAnomalyCurrency = "currency"
+)
+
+// FeeCheck compares the fees charged for an order with those the account's
+// fee tier implies
+type FeeCheck struct {
+	Expected  float64 // Quote fees implied by the fee rates
+	Actual    float64 // Quote fees charged
+	Deviation float64 // Actual relative to expected, minus one
+	Anomaly   string  // Empty when the fees are in line
+}
+
+// CheckFees computes the expected fee of the fills, maker and taker volume at
+// their own rates, and flags the charged fee when it deviates by more than the
+// tolerance. A fee charged where none was expected counts as a full deviation.
+func CheckFees(summary FillSummary, rates exchange.FeeRates, tolerance float64) FeeCheck {
+	check := FeeCheck{
+		Expected: summary.MakerFunds*rates.Maker + (summary.Funds-summary.MakerFunds)*rates.Taker,
+		Actual:   summary.QuoteFee,
+	}
+
+	switch {
+	case check.Expected > 0:
+		check.Deviation = check.Actual/check.Expected - 1
+	case check.Actual > 0:
+		check.Deviation = 1
+	}
+
+	switch {
+	case summary.OtherFee > 0:
+		check.Anomaly = FeeAnomalyCurrency
+	case math.Abs(check.Deviation) > tolerance:
+		check.Anomaly = FeeAnomalyRate
+	}
+
+	return check
+}
+
+// reconcileFees checks a settled order's fees against the cached fee rates
+// and raises an alert for a deviation, which usually means a fee tier change,
+// a misconfigured rebate or fees taken in an unexpected currency
+func (f *FillReconciler) reconcileFees(order models.Order, symbol string, summary FillSummary) {
+	rates, ok, err := f.exchange.GetFeeRates(symbol)
+	if err != nil {
+		f.logger.WithError(err).WithField("symbol", symbol).Warn("Failed to get fee rates, skipping fee reconciliation")
+		return
+	}
+	if !ok {
+		return
+	}
+
+	check := CheckFees(summary, rates, f.feeTolerance)
+	if check.Anomaly == "" {
+		return
+	}
+
+	metrics.FeeAnomalies.WithLabelValues(symbol, check.Anomaly).Inc()
+	f.logger.WithFields(logrus.Fields{
+		"order_id":        order.ID,
+		"kucoin_order_id": order.KuCoinOrderID,
+		"symbol":          symbol,
+		"anomaly":         check.Anomaly,
+		"expected_fee":    check.Expected,
+		"actual_fee":      check.Actual,
+		"other_fee":       summary.OtherFee,
+		"deviation":       check.Deviation,
+		"maker_rate":      rates.Maker,
+		"taker_rate":      rates.Taker,
+	}).Warn("Order fees deviate from the expected fee rate")
+}
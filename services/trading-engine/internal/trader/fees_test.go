@@ -0,0 +1,122 @@
+package trader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/exchange"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestCheckFees(t *testing.T) {
+	rates := exchange.FeeRates{Maker: 0.0008, Taker: 0.001}
+
+	tests := []struct {
+		name         string
+		summary      FillSummary
+		wantExpected float64
+		wantAnomaly  string
+	}{
+		{
+			name:         "taker fee at the tier rate",
+			summary:      FillSummary{Funds: 1000, QuoteFee: 1},
+			wantExpected: 1,
+		},
+		{
+			name:         "maker and taker volume at their own rates",
+			summary:      FillSummary{Funds: 1000, MakerFunds: 500, QuoteFee: 0.9},
+			wantExpected: 0.9,
+		},
+		{
+			name:         "small rounding deviation within tolerance",
+			summary:      FillSummary{Funds: 1000, QuoteFee: 1.04},
+			wantExpected: 1,
+		},
+		{
+			name:         "fee tier doubled",
+			summary:      FillSummary{Funds: 1000, QuoteFee: 2},
+			wantExpected: 1,
+			wantAnomaly:  FeeAnomalyRate,
+		},
+		{
+			name:         "missing maker rebate",
+			summary:      FillSummary{Funds: 1000, MakerFunds: 1000, QuoteFee: 1},
+			wantExpected: 0.8,
+			wantAnomaly:  FeeAnomalyRate,
+		},
+		{
+			name:         "fee taken in KCS",
+			summary:      FillSummary{Funds: 1000, OtherFee: 0.05},
+			wantExpected: 1,
+			wantAnomaly:  FeeAnomalyCurrency,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := CheckFees(tt.summary, rates, 0.1)
+			if !approxEqual(check.Expected, tt.wantExpected) {
+				t.Errorf("expected fee = %v, want %v", check.Expected, tt.wantExpected)
+			}
+			if check.Anomaly != tt.wantAnomaly {
+				t.Errorf("anomaly = %q, want %q (deviation %v)", check.Anomaly, tt.wantAnomaly, check.Deviation)
+			}
+		})
+	}
+}
+
+func TestReconcileFlagsAnomalousFee(t *testing.T) {
+	tests := []struct {
+		name     string
+		fee      string
+		wantFlag bool
+	}{
+		{name: "fee within tolerance", fee: "0.1"},
+		{name: "fee three times the rate", fee: "0.3", wantFlag: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+			logger, hook := test.NewNullLogger()
+			reconciler := NewFillReconciler(repo, ex, 1, 0.2, logger)
+			anomalies := metrics.FeeAnomalies.WithLabelValues(testSymbol, FeeAnomalyRate)
+			before := testutil.ToFloat64(anomalies)
+
+			ex.fees[testSymbol] = exchange.FeeRates{Maker: 0.001, Taker: 0.001, FetchedAt: time.Now()}
+			repo.AddOrder(models.Order{PairID: testPair.ID, KuCoinOrderID: "fee-1", Side: "buy", Type: "limit", Quantity: 1, Price: 100, Status: "pending"})
+			ex.orders["fee-1"] = &kucoin.Order{ID: "fee-1", Symbol: testSymbol, DealSize: "1", DealFunds: "100"}
+			ex.fills["fee-1"] = []kucoin.Fill{
+				{TradeID: "t1", Price: "100", Size: "1", Fee: tt.fee, FeeCurrency: "USDT", Liquidity: "taker", CreatedAt: time.Now().UnixMilli()},
+			}
+
+			if err := reconciler.Reconcile(ctx); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			flagged := 0
+			for _, entry := range hook.AllEntries() {
+				if entry.Level == logrus.WarnLevel && entry.Data["anomaly"] == FeeAnomalyRate {
+					flagged++
+				}
+			}
+			wantFlags := 0
+			if tt.wantFlag {
+				wantFlags = 1
+			}
+			if flagged != wantFlags {
+				t.Errorf("logged %d fee anomalies, want %d", flagged, wantFlags)
+			}
+			if got := testutil.ToFloat64(anomalies) - before; got != float64(wantFlags) {
+				t.Errorf("fee anomaly metric rose by %v, want %d", got, wantFlags)
+			}
+		})
+	}
+}
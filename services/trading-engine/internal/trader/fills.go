@@ -0,0 +1,305 @@
+package trader
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/database"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/exchange"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// FillSummary aggregates the trades executed for one order
+type FillSummary struct {
+	Size       float64   // Base quantity executed
+	Funds      float64   // Quote amount executed
+	MakerFunds float64   // Part of Funds executed as maker
+	AvgPrice   float64   // Volume-weighted average execution price
+	QuoteFee   float64   // Fees charged in the quote currency
+	OtherFee   float64   // Fees charged in any other currency (e.g. KCS), not deducted from PnL
+	LastFill   time.Time // Time of the most recent fill
+}
+
+// FillReconciler replaces the estimated prices recorded when orders were
+// placed with the exchange's actual fills. Orders filled across several
+// trades get their volume-weighted average price, and per-fill fees are
+// deducted from the owning position's realized PnL. With a fee tolerance the
+// fees charged are also checked against the account's fee rates.
+type FillReconciler struct {
+	repo         database.RepositoryInterface
+	exchange     exchange.Exchange
+	workers      int     // Order lookups run concurrently; the client's rate limiter paces them
+	feeTolerance float64 // Relative fee deviation that is flagged, 0 disables the check
+	logger       *logrus.Logger
+}
+
+func NewFillReconciler(repo database.RepositoryInterface, exchange exchange.Exchange, workers int, feeTolerance float64, logger *logrus.Logger) *FillReconciler {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &FillReconciler{
+		repo:         repo,
+		exchange:     exchange,
+		workers:      workers,
+		feeTolerance: feeTolerance,
+		logger:       logger,
+	}
+}
+
+// Reconcile settles every pending order that is no longer active on the
+// exchange. Orders are looked up concurrently, but all orders of one position
+// go to the same worker in sequence: settling an order rewrites its position,
+// and two concurrent read-modify-writes of the same row would lose an update.
+func (f *FillReconciler) Reconcile(ctx context.Context) error {
+	orders, err := f.repo.GetPendingOrders(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get pending orders: %w", err)
+	}
+	if len(orders) == 0 {
+		return nil
+	}
+
+	groups := groupByPosition(orders)
+	jobs := make(chan []models.Order)
+
+	var mu sync.Mutex
+	var failed int
+
+	var wg sync.WaitGroup
+	for w := 0; w < f.workers && w < len(groups); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range jobs {
+				for _, order := range group {
+					if err := f.reconcileOrder(ctx, order); err != nil {
+						f.logger.WithError(err).WithFields(logrus.Fields{
+							"order_id":        order.ID,
+							"kucoin_order_id": order.KuCoinOrderID,
+						}).Error("Failed to reconcile order fills")
+
+						mu.Lock()
+						failed++
+						mu.Unlock()
+					}
+				}
+			}
+		}()
+	}
+
+	for _, group := range groups {
+		select {
+		case jobs <- group:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	f.logger.WithFields(logrus.Fields{
+		"pending_orders": len(orders),
+		"failed":         failed,
+		"workers":        f.workers,
+	}).Debug("Completed fill reconciliation")
+
+	return ctx.Err()
+}
+
+// groupByPosition splits orders into groups that must be settled in sequence:
+// the orders of each position together, and every order without a position
+// on its own
+func groupByPosition(orders []models.Order) [][]models.Order {
+	var groups [][]models.Order
+	byPosition := make(map[string]int)
+
+	for _, order := range orders {
+		if order.PositionID == nil {
+			groups = append(groups, []models.Order{order})
+			continue
+		}
+
+		i, ok := byPosition[*order.PositionID]
+		if !ok {
+			i = len(groups)
+			byPosition[*order.PositionID] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], order)
+	}
+
+	return groups
+}
+
+func (f *FillReconciler) reconcileOrder(ctx context.Context, order models.Order) error {
+	exchangeOrder, err := f.exchange.GetOrder(order.KuCoinOrderID)
+	if err != nil {
+		return err
+	}
+	if exchangeOrder.IsActive {
+		return nil // Still working on the book, more fills may follow
+	}
+
+	fills, err := f.exchange.GetFills(ctx, order.KuCoinOrderID)
+	if err != nil {
+		return err
+	}
+
+	summary, err := summarizeFills(fills, quoteCurrency(exchangeOrder.Symbol))
+	if err != nil {
+		return err
+	}
+
+	// Fills can lag the order's deal aggregates; wait until they add up
+	dealt, err := exchange.ParseOrderFill(exchangeOrder)
+	if err != nil {
+		return err
+	}
+	if summary.Size < dealt.DealSize*(1-1e-9) {
+		f.logger.WithFields(logrus.Fields{
+			"kucoin_order_id": order.KuCoinOrderID,
+			"fill_size":       summary.Size,
+			"deal_size":       dealt.DealSize,
+		}).Debug("Fills incomplete, retrying next cycle")
+		return nil
+	}
+
+	estimatedPrice := order.Price
+
+	order.FilledQuantity = summary.Size
+	order.Fee = summary.QuoteFee + summary.OtherFee
+	order.Status = "cancelled"
+	if exchange.IsExpired(exchangeOrder) {
+		order.Status = "expired" // Ran out its GTT time without a fill
+	}
+	if summary.Size > 0 {
+		order.Price = summary.AvgPrice
+		order.Status = "filled"
+		order.FilledAt = &summary.LastFill
+	}
+
+	// The order is settled before the position so a retry after a partial
+	// failure cannot apply the same fills twice
+	if err := f.repo.UpdateOrderFill(ctx, order); err != nil {
+		return err
+	}
+
+	f.logger.WithFields(logrus.Fields{
+		"kucoin_order_id": order.KuCoinOrderID,
+		"fills":           len(fills),
+		"filled_quantity": summary.Size,
+		"avg_price":       summary.AvgPrice,
+		"estimated_price": estimatedPrice,
+		"fee":             order.Fee,
+	}).Info("Reconciled order fills")
+
+	if summary.Size > 0 {
+		metrics.OrdersFilled.WithLabelValues(exchangeOrder.Symbol, order.Side).Inc()
+	}
+	if f.feeTolerance > 0 && summary.Size > 0 {
+		f.reconcileFees(order, exchangeOrder.Symbol, summary)
+	}
+
+	if order.PositionID == nil || summary.Size == 0 {
+		return nil
+	}
+
+	return f.applyToPosition(ctx, *order.PositionID, order, estimatedPrice, summary)
+}
+
+// applyToPosition corrects the position's entry price or realized PnL with
+// the actual execution price and deducts the fees paid. An entry that filled
+// short shrinks the position to the quantity actually bought, and PnL already
+// realized on it is rebooked against the actual entry price.
+func (f *FillReconciler) applyToPosition(ctx context.Context, positionID string, order models.Order, estimatedPrice float64, summary FillSummary) error {
+	position, err := f.repo.GetPositionByID(ctx, positionID)
+	if err != nil {
+		return err
+	}
+
+	if position.OrderID == order.KuCoinOrderID {
+		// Closes so far realized PnL from the estimated entry price
+		closedQuantity := summary.Size
+		if position.Status != "closed" {
+			closedQuantity = originalQuantity(*position) - position.Quantity
+			if remaining := summary.Size - closedQuantity; remaining < position.Quantity {
+				position.Quantity = remaining
+			}
+		}
+		position.RealizedPnL += computeRealizedPnL(position.Side, summary.AvgPrice, estimatedPrice, closedQuantity, 0)
+		position.EntryPrice = summary.AvgPrice
+	} else {
+		// Exit order: realized PnL was booked at the estimated price
+		position.RealizedPnL += computeRealizedPnL(position.Side, estimatedPrice, summary.AvgPrice, summary.Size, 0)
+	}
+	position.RealizedPnL -= summary.QuoteFee
+	position.TotalFees += summary.QuoteFee
+
+	if err := f.repo.UpdatePosition(ctx, *position); err != nil {
+		return fmt.Errorf("failed to update position: %w", err)
+	}
+
+	return nil
+}
+
+// summarizeFills computes the volume-weighted average price and total fees
+// of a set of fills. A malformed numeric field is an error rather than a
+// zero, so a bad response cannot masquerade as an unfilled order.
+func summarizeFills(fills []kucoin.Fill, quote string) (FillSummary, error) {
+	var summary FillSummary
+
+	for _, fill := range fills {
+		price, err := strconv.ParseFloat(fill.Price, 64)
+		if err != nil {
+			return FillSummary{}, fmt.Errorf("invalid price %q in fill %s: %w", fill.Price, fill.TradeID, err)
+		}
+		size, err := strconv.ParseFloat(fill.Size, 64)
+		if err != nil {
+			return FillSummary{}, fmt.Errorf("invalid size %q in fill %s: %w", fill.Size, fill.TradeID, err)
+		}
+
+		fee := 0.0
+		if fill.Fee != "" {
+			fee, err = strconv.ParseFloat(fill.Fee, 64)
+			if err != nil {
+				return FillSummary{}, fmt.Errorf("invalid fee %q in fill %s: %w", fill.Fee, fill.TradeID, err)
+			}
+		}
+
+		summary.Size += size
+		summary.Funds += price * size
+		if fill.Liquidity == "maker" {
+			summary.MakerFunds += price * size
+		}
+		if fill.FeeCurrency == quote {
+			summary.QuoteFee += fee
+		} else {
+			summary.OtherFee += fee
+		}
+
+		if filledAt := time.UnixMilli(fill.CreatedAt); filledAt.After(summary.LastFill) {
+			summary.LastFill = filledAt
+		}
+	}
+
+	if summary.Size > 0 {
+		summary.AvgPrice = summary.Funds / summary.Size
+	}
+
+	return summary, nil
+}
+
+// quoteCurrency returns the quote asset of a symbol such as BTC-USDT
+func quoteCurrency(symbol string) string {
+	if i := strings.LastIndex(symbol, "-"); i >= 0 {
+		return symbol[i+1:]
+	}
+	return ""
+}
@@ -0,0 +1,375 @@
+package trader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+func TestSummarizeFillsVWAP(t *testing.T) {
+	first := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		fills        []kucoin.Fill
+		wantSize     float64
+		wantAvgPrice float64
+		wantQuoteFee float64
+		wantOtherFee float64
+		wantLastFill time.Time
+	}{
+		{
+			name:  "no fills",
+			fills: nil,
+		},
+		{
+			name: "single fill",
+			fills: []kucoin.Fill{
+				{TradeID: "t1", Price: "100", Size: "2", Fee: "0.2", FeeCurrency: "USDT", CreatedAt: first.UnixMilli()},
+			},
+			wantSize:     2,
+			wantAvgPrice: 100,
+			wantQuoteFee: 0.2,
+			wantLastFill: first,
+		},
+		{
+			name: "fills at different prices are volume weighted",
+			fills: []kucoin.Fill{
+				{TradeID: "t1", Price: "100", Size: "1", Fee: "0.1", FeeCurrency: "USDT", CreatedAt: first.UnixMilli()},
+				{TradeID: "t2", Price: "102", Size: "3", Fee: "0.306", FeeCurrency: "USDT", CreatedAt: first.Add(2 * time.Second).UnixMilli()},
+				{TradeID: "t3", Price: "101", Size: "0.5", Fee: "0.0505", FeeCurrency: "USDT", CreatedAt: first.Add(time.Second).UnixMilli()},
+			},
+			wantSize:     4.5,
+			wantAvgPrice: (100*1 + 102*3 + 101*0.5) / 4.5,
+			wantQuoteFee: 0.4565,
+			wantLastFill: first.Add(2 * time.Second),
+		},
+		{
+			name: "fees in another currency are kept apart",
+			fills: []kucoin.Fill{
+				{TradeID: "t1", Price: "100", Size: "1", Fee: "0.1", FeeCurrency: "USDT", CreatedAt: first.UnixMilli()},
+				{TradeID: "t2", Price: "110", Size: "1", Fee: "0.01", FeeCurrency: "KCS", CreatedAt: first.UnixMilli()},
+				{TradeID: "t3", Price: "120", Size: "2", CreatedAt: first.UnixMilli()},
+			},
+			wantSize:     4,
+			wantAvgPrice: 112.5,
+			wantQuoteFee: 0.1,
+			wantOtherFee: 0.01,
+			wantLastFill: first,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := summarizeFills(tt.fills, "USDT")
+			if err != nil {
+				t.Fatalf("summarizeFills() error = %v", err)
+			}
+
+			if !approxEqual(got.Size, tt.wantSize) || !approxEqual(got.AvgPrice, tt.wantAvgPrice) {
+				t.Errorf("size/avg price = %v/%v, want %v/%v", got.Size, got.AvgPrice, tt.wantSize, tt.wantAvgPrice)
+			}
+			if !approxEqual(got.QuoteFee, tt.wantQuoteFee) || !approxEqual(got.OtherFee, tt.wantOtherFee) {
+				t.Errorf("quote/other fee = %v/%v, want %v/%v", got.QuoteFee, got.OtherFee, tt.wantQuoteFee, tt.wantOtherFee)
+			}
+			if !tt.wantLastFill.IsZero() && !got.LastFill.Equal(tt.wantLastFill) {
+				t.Errorf("last fill = %v, want %v", got.LastFill, tt.wantLastFill)
+			}
+		})
+	}
+}
+
+func TestReconcileAppliesVWAPToEntry(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockDatabaseRepository("main")
+	ex := NewMockExchange()
+	reconciler := NewFillReconciler(repo, ex, 2, 0, utils.NewDiscardLogger())
+
+	// Recorded at the 100 limit price, filled in three trades
+	position := repo.AddPosition(models.Position{PairID: testPair.ID, OrderID: "entry-1", Side: "buy", EntryPrice: 100, Quantity: 3, Status: "open"})
+	order := repo.AddOrder(models.Order{PositionID: &position.ID, PairID: testPair.ID, KuCoinOrderID: "entry-1", Side: "buy", Type: "limit", Quantity: 3, Price: 100, Status: "pending"})
+
+	ex.orders["entry-1"] = &kucoin.Order{ID: "entry-1", Symbol: testSymbol, DealSize: "3", DealFunds: "298.5"}
+	ex.fills["entry-1"] = []kucoin.Fill{
+		{TradeID: "t1", Price: "99", Size: "1", Fee: "0.099", FeeCurrency: "USDT", CreatedAt: time.Now().UnixMilli()},
+		{TradeID: "t2", Price: "99.5", Size: "1", Fee: "0.0995", FeeCurrency: "USDT", CreatedAt: time.Now().UnixMilli()},
+		{TradeID: "t3", Price: "100", Size: "1", Fee: "0.1", FeeCurrency: "USDT", CreatedAt: time.Now().UnixMilli()},
+	}
+
+	if err := reconciler.Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	settled := repo.Orders()[0]
+	if settled.ID != order.ID || settled.Status != "filled" || !approxEqual(settled.Price, 99.5) || settled.FilledQuantity != 3 {
+		t.Errorf("order = %+v, want filled 3 at the 99.5 VWAP", settled)
+	}
+	if !approxEqual(settled.Fee, 0.2985) {
+		t.Errorf("order fee = %v, want 0.2985", settled.Fee)
+	}
+
+	updated := repo.Positions()[0]
+	if !approxEqual(updated.EntryPrice, 99.5) {
+		t.Errorf("entry price = %v, want the 99.5 VWAP", updated.EntryPrice)
+	}
+	if !approxEqual(updated.RealizedPnL, -0.2985) || !approxEqual(updated.TotalFees, 0.2985) {
+		t.Errorf("realized PnL/fees = %v/%v, want the fills' fees deducted", updated.RealizedPnL, updated.TotalFees)
+	}
+}
+
+func TestReconcileShortEntryFill(t *testing.T) {
+	tests := []struct {
+		name         string
+		position     models.Position
+		wantQuantity float64
+		wantPnL      float64
+	}{
+		{
+			name:         "open position shrinks to the filled quantity",
+			position:     models.Position{Quantity: 3, Status: "open"},
+			wantQuantity: 2,
+		},
+		{
+			name:         "partially closed position keeps the unclosed share",
+			position:     models.Position{Quantity: 2, ClosedFraction: 1.0 / 3, RealizedPnL: 10, Status: "partial"},
+			wantQuantity: 1,
+			wantPnL:      11, // 10 booked over 1 from 100, 1 more from the actual 99
+		},
+		{
+			name:         "closed position rebooks its PnL from the actual entry",
+			position:     models.Position{Quantity: 2, ClosedFraction: 1, RealizedPnL: 20, Status: "closed"},
+			wantQuantity: 2,
+			wantPnL:      22, // 20 booked over 2 from 100, 2 more from the actual 99
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockDatabaseRepository("main")
+			ex := NewMockExchange()
+			reconciler := NewFillReconciler(repo, ex, 1, 0, utils.NewDiscardLogger())
+
+			// A buy of 3 at 100, of which only 2 filled, at 99
+			tt.position.PairID, tt.position.OrderID, tt.position.Side, tt.position.EntryPrice = testPair.ID, "entry-1", "buy", 100
+			position := repo.AddPosition(tt.position)
+			repo.AddOrder(models.Order{PositionID: &position.ID, PairID: testPair.ID, KuCoinOrderID: "entry-1", Side: "buy", Type: "limit", Quantity: 3, Price: 100, Status: "pending"})
+			ex.orders["entry-1"] = &kucoin.Order{ID: "entry-1", Symbol: testSymbol, DealSize: "2", DealFunds: "198"}
+			ex.fills["entry-1"] = []kucoin.Fill{{TradeID: "t1", Price: "99", Size: "2", FeeCurrency: "USDT", CreatedAt: time.Now().UnixMilli()}}
+
+			if err := reconciler.Reconcile(context.Background()); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			updated := repo.Positions()[0]
+			if !approxEqual(updated.EntryPrice, 99) || !approxEqual(updated.Quantity, tt.wantQuantity) {
+				t.Errorf("entry price/quantity = %v/%v, want 99/%v", updated.EntryPrice, updated.Quantity, tt.wantQuantity)
+			}
+			if !approxEqual(updated.RealizedPnL, tt.wantPnL) {
+				t.Errorf("realized PnL = %v, want %v", updated.RealizedPnL, tt.wantPnL)
+			}
+		})
+	}
+}
+
+func TestReconcileWaitsForLaggingFills(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockDatabaseRepository("main")
+	ex := NewMockExchange()
+	reconciler := NewFillReconciler(repo, ex, 1, 0, utils.NewDiscardLogger())
+
+	repo.AddOrder(models.Order{PairID: testPair.ID, KuCoinOrderID: "order-1", Side: "buy", Quantity: 2, Price: 100, Status: "pending"})
+	ex.orders["order-1"] = &kucoin.Order{ID: "order-1", Symbol: testSymbol, DealSize: "2", DealFunds: "200"}
+	ex.fills["order-1"] = []kucoin.Fill{{TradeID: "t1", Price: "100", Size: "1", FeeCurrency: "USDT"}}
+
+	if err := reconciler.Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if got := repo.Orders()[0].Status; got != "pending" {
+		t.Errorf("order status = %s with half the fills reported, want pending", got)
+	}
+}
+
+func TestReconcileSkipsMalformedOrderDetail(t *testing.T) {
+	tests := []struct {
+		name  string
+		order kucoin.Order
+		fills []kucoin.Fill
+	}{
+		{
+			name:  "malformed deal size",
+			order: kucoin.Order{ID: "order-1", Symbol: testSymbol, DealSize: "two", DealFunds: "200"},
+			fills: []kucoin.Fill{{TradeID: "t1", Price: "100", Size: "2", FeeCurrency: "USDT"}},
+		},
+		{
+			name:  "malformed fill price",
+			order: kucoin.Order{ID: "order-1", Symbol: testSymbol, DealSize: "2", DealFunds: "200"},
+			fills: []kucoin.Fill{{TradeID: "t1", Price: "", Size: "2", FeeCurrency: "USDT"}},
+		},
+		{
+			name:  "malformed fill fee",
+			order: kucoin.Order{ID: "order-1", Symbol: testSymbol, DealSize: "2", DealFunds: "200"},
+			fills: []kucoin.Fill{{TradeID: "t1", Price: "100", Size: "2", Fee: "0.2 USDT", FeeCurrency: "USDT"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockDatabaseRepository("main")
+			ex := NewMockExchange()
+			reconciler := NewFillReconciler(repo, ex, 1, 0, utils.NewDiscardLogger())
+
+			repo.AddOrder(models.Order{PairID: testPair.ID, KuCoinOrderID: "order-1", Side: "buy", Quantity: 2, Price: 100, Status: "pending"})
+			ex.orders["order-1"] = &tt.order
+			ex.fills["order-1"] = tt.fills
+
+			if err := reconciler.Reconcile(context.Background()); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			// Left pending to retry, not settled as an unfilled cancel
+			if got := repo.Orders()[0]; got.Status != "pending" || got.FilledQuantity != 0 {
+				t.Errorf("order = %s with %v filled, want pending and untouched", got.Status, got.FilledQuantity)
+			}
+		})
+	}
+}
+
+// concurrentLookups wraps the mock exchange to measure how many order
+// lookups run at once, overall and per position
+type concurrentLookups struct {
+	*MockExchange
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	position    map[string]string // Exchange order ID to position ID
+	perPosition map[string]int
+	overlapped  bool // Two lookups of one position ran at once
+}
+
+func (c *concurrentLookups) GetOrder(orderID string) (*kucoin.Order, error) {
+	c.mu.Lock()
+	c.inFlight++
+	if c.inFlight > c.maxInFlight {
+		c.maxInFlight = c.inFlight
+	}
+	position, linked := c.position[orderID]
+	if linked {
+		c.perPosition[position]++
+		if c.perPosition[position] > 1 {
+			c.overlapped = true
+		}
+	}
+	c.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	c.mu.Lock()
+	c.inFlight--
+	if linked {
+		c.perPosition[position]--
+	}
+	c.mu.Unlock()
+
+	return c.MockExchange.GetOrder(orderID)
+}
+
+func TestReconcileRespectsConcurrencyBound(t *testing.T) {
+	const workers = 3
+
+	repo := NewMockDatabaseRepository("main")
+	ex := &concurrentLookups{MockExchange: NewMockExchange(), position: make(map[string]string), perPosition: make(map[string]int)}
+	reconciler := NewFillReconciler(repo, ex, workers, 0, utils.NewDiscardLogger())
+
+	for i := 0; i < 9; i++ {
+		id := fmt.Sprintf("order-%d", i)
+		repo.AddOrder(models.Order{PairID: testPair.ID, KuCoinOrderID: id, Side: "buy", Quantity: 1, Price: 100, Status: "pending"})
+		ex.orders[id] = &kucoin.Order{ID: id, Symbol: testSymbol, DealSize: "1", DealFunds: "100"}
+		ex.fills[id] = []kucoin.Fill{{TradeID: "t-" + id, Price: "100", Size: "1", FeeCurrency: "USDT"}}
+	}
+
+	// Orders of one position are settled in sequence by a single worker
+	position := repo.AddPosition(models.Position{PairID: testPair.ID, OrderID: "entry-a", Side: "buy", EntryPrice: 100, Quantity: 2, Status: "open"})
+	for _, id := range []string{"entry-a", "entry-b"} {
+		repo.AddOrder(models.Order{PositionID: &position.ID, PairID: testPair.ID, KuCoinOrderID: id, Side: "buy", Quantity: 1, Price: 100, Status: "pending"})
+		ex.orders[id] = &kucoin.Order{ID: id, Symbol: testSymbol, IsActive: true}
+		ex.position[id] = position.ID
+	}
+
+	if err := reconciler.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if ex.maxInFlight > workers {
+		t.Errorf("%d lookups ran at once, want at most %d", ex.maxInFlight, workers)
+	}
+	if ex.maxInFlight < 2 {
+		t.Errorf("at most %d lookup ran at once, want them spread over the workers", ex.maxInFlight)
+	}
+	if ex.overlapped {
+		t.Error("two orders of one position were looked up at once, want them in sequence")
+	}
+
+	filled := 0
+	for _, order := range repo.Orders() {
+		if order.Status == "filled" {
+			filled++
+		}
+	}
+	if filled != 9 {
+		t.Errorf("%d orders filled, want every inactive order settled", filled)
+	}
+}
+
+func TestReconcileSettlesExpiredOrders(t *testing.T) {
+	tests := []struct {
+		name       string
+		order      kucoin.Order
+		fills      []kucoin.Fill
+		wantStatus string
+	}{
+		{
+			name:       "GTT expired without a fill",
+			order:      kucoin.Order{ID: "order-1", Symbol: testSymbol, TimeInForce: "GTT", CancelAfter: 1800, CancelExist: true},
+			wantStatus: "expired",
+		},
+		{
+			name:       "GTT expired after a partial fill",
+			order:      kucoin.Order{ID: "order-1", Symbol: testSymbol, TimeInForce: "GTT", CancelAfter: 1800, CancelExist: true, DealSize: "1", DealFunds: "100"},
+			fills:      []kucoin.Fill{{TradeID: "t1", Price: "100", Size: "1", FeeCurrency: "USDT"}},
+			wantStatus: "filled",
+		},
+		{
+			name:       "GTC cancelled without a fill",
+			order:      kucoin.Order{ID: "order-1", Symbol: testSymbol, TimeInForce: "GTC", CancelExist: true},
+			wantStatus: "cancelled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockDatabaseRepository("main")
+			ex := NewMockExchange()
+			reconciler := NewFillReconciler(repo, ex, 1, 0, utils.NewDiscardLogger())
+
+			repo.AddOrder(models.Order{PairID: testPair.ID, KuCoinOrderID: "order-1", Side: "buy", Type: "limit", Quantity: 2, Price: 100, Status: "pending"})
+			ex.orders["order-1"] = &tt.order
+			ex.fills["order-1"] = tt.fills
+
+			if err := reconciler.Reconcile(context.Background()); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			if got := repo.Orders()[0].Status; got != tt.wantStatus {
+				t.Errorf("order status = %s, want %s", got, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package trader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/signals"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// FlatlineDetector flags symbols whose price feed stopped updating but keeps
+// producing candles with the same close. Volatility and ATR collapse to zero
+// on such a series, which maximizes volatility-scaled sizes and makes stops
+// trivially tight, so the engine pauses trading on a flagged symbol until
+// distinct prices resume. Only used from the trading cycle, so it is not
+// synchronized.
+type FlatlineDetector struct {
+	priceHistory signals.PriceHistoryProvider
+	closes       int           // Identical consecutive closes that count as a flatline
+	lookback     time.Duration // History searched for them
+	logger       *logrus.Logger
+
+	flagged map[string]bool
+}
+
+func NewFlatlineDetector(priceHistory signals.PriceHistoryProvider, closes int, lookback time.Duration, logger *logrus.Logger) *FlatlineDetector {
+	return &FlatlineDetector{
+		priceHistory: priceHistory,
+		closes:       closes,
+		lookback:     lookback,
+		logger:       logger,
+		flagged:      make(map[string]bool),
+	}
+}
+
+// Check reports whether the symbol's feed is flatlined, flagging or clearing
+// the symbol as its state changes. Too little history counts as not
+// flatlined; the staleness checks cover a feed that stopped altogether.
+func (d *FlatlineDetector) Check(ctx context.Context, symbol string) (bool, error) {
+	if d.closes < 2 {
+		return false, nil
+	}
+
+	candles, err := d.priceHistory.GetPriceHistory(ctx, symbol, time.Now().Add(-d.lookback))
+	if err != nil {
+		return false, fmt.Errorf("failed to get price history: %w", err)
+	}
+
+	flatlined := IsFlatlined(candles, d.closes)
+	fields := logrus.Fields{
+		"symbol":           symbol,
+		"identical_closes": d.closes,
+	}
+
+	switch {
+	case flatlined && !d.flagged[symbol]:
+		d.flagged[symbol] = true
+		metrics.FlatlinedFeeds.WithLabelValues(symbol).Set(1)
+		d.logger.WithFields(fields).WithField("close", candles[len(candles)-1].Close).Warn("Price feed flatlined, pausing trading on symbol")
+	case !flatlined && d.flagged[symbol]:
+		delete(d.flagged, symbol)
+		metrics.FlatlinedFeeds.WithLabelValues(symbol).Set(0)
+		d.logger.WithFields(fields).Info("Price feed moving again, resuming trading on symbol")
+	}
+
+	return flatlined, nil
+}
+
+// IsFlatlined reports whether the last n candles all closed at the same price
+func IsFlatlined(candles []models.Candle, n int) bool {
+	if n < 2 || len(candles) < n {
+		return false
+	}
+
+	last := candles[len(candles)-1].Close
+	for _, candle := range candles[len(candles)-n:] {
+		if candle.Close != last {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package trader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestIsFlatlined(t *testing.T) {
+	tests := []struct {
+		name   string
+		closes []float64
+		n      int
+		want   bool
+	}{
+		{name: "repeated close", closes: []float64{100, 101, 99, 99, 99, 99, 99}, n: 5, want: true},
+		{name: "normal series", closes: []float64{100, 100.2, 99.9, 100.1, 100.3, 100.2}, n: 5},
+		{name: "single tick breaks the run", closes: []float64{99, 99, 99, 99.01, 99}, n: 5},
+		{name: "run shorter than n", closes: []float64{100, 99, 99, 99, 99}, n: 5},
+		{name: "too little history", closes: []float64{99, 99, 99}, n: 5},
+		{name: "disabled", closes: []float64{99, 99, 99, 99, 99}, n: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsFlatlined(hourlyCandles(tt.closes), tt.n); got != tt.want {
+				t.Errorf("IsFlatlined() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlatlinedFeedPausesPair(t *testing.T) {
+	ctx := context.Background()
+	repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+	seedSellOff(repo)
+	moving := repo.history[testSymbol]
+
+	config := testEngineConfig()
+	config.FlatlineCloses = 5
+	config.FlatlineLookback = 100 * time.Hour
+	engine := newTestEngine(repo, ex, config)
+	flagged := metrics.FlatlinedFeeds.WithLabelValues(testSymbol)
+
+	// The feed froze on its last price for the final five candles
+	frozen := append(moving[:0:0], moving...)
+	last := frozen[len(frozen)-1].Close
+	for i := len(frozen) - 5; i < len(frozen); i++ {
+		frozen[i].Close = last
+	}
+	repo.history[testSymbol] = frozen
+
+	if err := engine.processPair(ctx, testPair); err != nil {
+		t.Fatalf("processPair() error = %v", err)
+	}
+	if placed := ex.Placed(); len(placed) != 0 {
+		t.Fatalf("placed %d orders on a flatlined feed, want none", len(placed))
+	}
+	if got := testutil.ToFloat64(flagged); got != 1 {
+		t.Errorf("flatline gauge = %v, want 1", got)
+	}
+
+	// Distinct prices resume trading
+	repo.history[testSymbol] = moving
+	if err := engine.processPair(ctx, testPair); err != nil {
+		t.Fatalf("processPair() error = %v", err)
+	}
+	if placed := ex.Placed(); len(placed) != 1 {
+		t.Errorf("placed %d orders once prices moved again, want 1", len(placed))
+	}
+	if got := testutil.ToFloat64(flagged); got != 0 {
+		t.Errorf("flatline gauge = %v, want cleared", got)
+	}
+}
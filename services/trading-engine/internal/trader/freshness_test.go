@@ -0,0 +1,93 @@
+package trader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/signals"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestStalePriceGatesEntries(t *testing.T) {
+	tests := []struct {
+		name        string
+		age         time.Duration
+		live        LivePriceProvider
+		wantEntries int
+		wantClosed  bool
+	}{
+		{name: "fresh price trades", age: time.Minute, wantEntries: 1},
+		{name: "stale price without a live quote leaves the pair alone", age: time.Hour},
+		// The stale stored 100 is above the stop, the live 95 below it
+		{name: "stale price manages positions on the live quote", age: time.Hour, live: fakeQuotes{bid: 94.9, ask: 95.1}, wantClosed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+			seedSellOff(repo)
+			repo.quotes[testSymbol] = 100
+			repo.quotedAt[testSymbol] = time.Now().Add(-tt.age)
+			// Entered at 101: stopped out at 95 but not at 100
+			repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", Quantity: 1, EntryPrice: 101, Status: "open"})
+
+			config := testEngineConfig()
+			config.MaxPriceAge = 10 * time.Minute
+			generator := signals.NewGenerator(repo, signals.Config{}, utils.NewDiscardLogger())
+			engine := NewEngine(repo, ex, repo, generator, nil, nil, nil, tt.live, nil, nil, nil, config, utils.NewDiscardLogger())
+
+			if err := engine.processPair(context.Background(), testPair); err != nil {
+				t.Fatalf("processPair() error = %v", err)
+			}
+
+			entries, closed := 0, false
+			for _, order := range ex.Placed() {
+				switch order.Side {
+				case "buy":
+					entries++
+				case "sell":
+					closed = true
+				}
+			}
+			if entries != tt.wantEntries {
+				t.Errorf("placed %d entries, want %d", entries, tt.wantEntries)
+			}
+			if closed != tt.wantClosed {
+				t.Errorf("closed the position = %v, want %v", closed, tt.wantClosed)
+			}
+		})
+	}
+}
+
+func TestAllStalePricesWarnOfCloseOnly(t *testing.T) {
+	for _, stale := range []bool{false, true} {
+		repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+		repo.pairs = []models.SelectedPair{testPair}
+		seedSellOff(repo)
+		if stale {
+			repo.quotedAt[testSymbol] = time.Now().Add(-time.Hour)
+		}
+
+		logger, hook := test.NewNullLogger()
+		config := testEngineConfig()
+		config.MaxPriceAge = 10 * time.Minute
+		generator := signals.NewGenerator(repo, signals.Config{}, utils.NewDiscardLogger())
+		engine := NewEngine(repo, ex, repo, generator, nil, nil, nil, nil, nil, nil, nil, config, logger)
+
+		if err := engine.processTradingCycle(context.Background()); err != nil {
+			t.Fatalf("processTradingCycle() error = %v", err)
+		}
+
+		warned := false
+		for _, entry := range hook.AllEntries() {
+			warned = warned || entry.Level == logrus.WarnLevel && entry.Message == "Price data of every pair is stale, the price collector may be down; trading close-only"
+		}
+		if warned != stale {
+			t.Errorf("with stale prices %v warned close-only = %v", stale, warned)
+		}
+	}
+}
@@ -2,18 +2,37 @@ package trader
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math"
+	"sort"
+	"time"
 
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/database"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/exchange"
 	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
 	"github.com/sirupsen/logrus"
 )
 
+// gridLevelTolerance is the relative price distance within which a position
+// or order counts as sitting at a grid level
+const gridLevelTolerance = 0.001 // 0.1%
+
 type GridStrategy struct {
-	logger *logrus.Logger
+	repo     database.RepositoryInterface
+	exchange exchange.Exchange
+	config   EngineConfig
+	logger   *logrus.Logger
 }
 
-func NewGridStrategy(logger *logrus.Logger) *GridStrategy {
-	return &GridStrategy{logger: logger}
+func NewGridStrategy(repo database.RepositoryInterface, exchange exchange.Exchange, config EngineConfig, logger *logrus.Logger) *GridStrategy {
+	return &GridStrategy{
+		repo:     repo,
+		exchange: exchange,
+		config:   config,
+		logger:   logger,
+	}
 }
 
 func (g *GridStrategy) Execute(ctx context.Context, pair models.SelectedPair, config models.TradingConfig,
@@ -30,41 +49,480 @@ func (g *GridStrategy) Execute(ctx context.Context, pair models.SelectedPair, co
 	if config.PriceRangeMin == 0 || config.PriceRangeMax == 0 {
 		config.PriceRangeMin = currentPrice * 0.95 // 5% below
 		config.PriceRangeMax = currentPrice * 1.05 // 5% above
+		if err := g.repo.UpdateTradingConfigRange(ctx, config.ID, config.PriceRangeMin, config.PriceRangeMax); err != nil {
+			return err
+		}
+	} else if g.rangeBreached(config, currentPrice) {
+		if err := g.recenter(ctx, pair, &config, positions, currentPrice); err != nil {
+			return fmt.Errorf("failed to recenter grid: %w", err)
+		}
 	}
 
 	gridLevels := g.calculateGridLevels(config, currentPrice)
+	g.limitToCapital(pair, config, positions, gridLevels, currentPrice)
+
+	var resting []models.Order
+	if g.config.GridOrdersEnabled {
+		var err error
+		if resting, err = g.repo.GetRestingGridOrders(ctx, pair.ID); err != nil {
+			return err
+		}
+	}
+
+	// Every filled level is sold one grid step above its entry. Exits go
+	// first: they need no capital and free a position slot once filled.
+	step := gridStep(config)
+	for _, position := range positions {
+		if position.Side != "buy" || hasExitOrder(resting, position.ID) {
+			continue
+		}
+
+		exit := models.GridLevel{
+			Price:    position.EntryPrice + step,
+			Quantity: position.Quantity,
+			Type:     "sell",
+			IsActive: true,
+		}
+		g.logger.WithFields(logrus.Fields{
+			"symbol":      pair.Symbol,
+			"position_id": position.ID,
+			"price":       exit.Price,
+			"type":        "sell",
+		}).Info("Placing grid sell order")
+
+		if !g.config.GridOrdersEnabled {
+			continue
+		}
+		if ok, err := orderSlotAvailable(ctx, g.repo, g.config, pair, g.logger); err != nil || !ok {
+			return err
+		}
+		positionID := position.ID
+		if err := g.placeLevelOrder(ctx, pair, config, exit, &positionID); err != nil {
+			return err
+		}
+	}
+
+	// Buys rest at the funded levels below the price, nearest first. A resting
+	// buy becomes a position once filled, so it takes a position slot already.
+	slots := config.MaxPositions - len(positions) - restingBuys(resting)
+	for _, level := range buyLevelsNearestFirst(gridLevels) {
+		if slots <= 0 {
+			break
+		}
+		if !level.IsActive || !g.shouldPlaceOrder(level, currentPrice, positions) || hasRestingOrder(resting, level) {
+			continue
+		}
+
+		g.logger.WithFields(logrus.Fields{
+			"symbol": pair.Symbol,
+			"price":  level.Price,
+			"type":   "buy",
+		}).Info("Placing grid buy order")
+		slots--
+
+		if !g.config.GridOrdersEnabled {
+			continue
+		}
+		if ok, err := orderSlotAvailable(ctx, g.repo, g.config, pair, g.logger); err != nil || !ok {
+			return err
+		}
+		if err := g.placeLevelOrder(ctx, pair, config, level, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SettleFills applies the grid orders filled since the last cycle to the
+// pair's positions: a filled buy opens a position at its fill price and a
+// filled exit closes, or for a partial fill reduces, the position it sells.
+// Execute then re-seeds the opposite side, an exit above a new position and
+// a buy at the level a closed position frees.
+func (g *GridStrategy) SettleFills(ctx context.Context, pair models.SelectedPair, config models.TradingConfig) error {
+	fills, err := g.repo.GetUnsettledGridFills(ctx, pair.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, order := range fills {
+		var positionID string
+		switch {
+		case order.Side == "buy":
+			position := models.Position{
+				PairID:        pair.ID,
+				ConfigID:      config.ID,
+				Side:          "buy",
+				Quantity:      order.FilledQuantity,
+				EntryPrice:    order.Price,
+				CurrentPrice:  order.Price,
+				RealizedPnL:   -order.Fee,
+				TotalFees:     order.Fee,
+				Status:        "open",
+				OrderID:       order.KuCoinOrderID,
+				StrategyTag:   order.StrategyTag,
+				ConfigVersion: order.ConfigVersion,
+			}
+			if err := g.repo.CreatePosition(ctx, &position); err != nil {
+				return fmt.Errorf("failed to create grid position: %w", err)
+			}
+			positionID = position.ID
+
+			g.logger.WithFields(logrus.Fields{
+				"symbol":      pair.Symbol,
+				"position_id": position.ID,
+				"price":       order.Price,
+				"quantity":    order.FilledQuantity,
+			}).Info("Opened position from grid buy fill")
+
+		case order.GridPositionID != nil:
+			positionID = *order.GridPositionID
+			if err := g.closeOnExitFill(ctx, pair, order); err != nil {
+				return err
+			}
+		}
+
+		if err := g.repo.SettleGridOrder(ctx, order.ID, positionID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// closeOnExitFill realizes a filled grid exit on the position it sells. A
+// position already closed by a stop or another exit is left as it is.
+func (g *GridStrategy) closeOnExitFill(ctx context.Context, pair models.SelectedPair, order models.Order) error {
+	position, err := g.repo.GetPositionByID(ctx, *order.GridPositionID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get grid position: %w", err)
+	}
+	if position.Status == "closed" {
+		return nil
+	}
+
+	quantity := math.Min(order.FilledQuantity, position.Quantity)
+	realized := computeRealizedPnL(position.Side, position.EntryPrice, order.Price, quantity, order.Fee)
+	position.RealizedPnL += realized
+	position.TotalFees += order.Fee
+	position.CurrentPrice = order.Price
+
+	if quantity < position.Quantity {
+		original := originalQuantity(*position)
+		position.Quantity -= quantity
+		position.ClosedFraction += quantity / original
+		position.Status = "partial"
+		position.UnrealizedPnL = profitPercent(*position, order.Price) * position.EntryPrice * position.Quantity
+	} else {
+		now := time.Now()
+		position.UnrealizedPnL = 0
+		position.ClosedFraction = 1
+		position.Status = "closed"
+		position.ClosedAt = &now
+	}
+
+	if err := g.repo.UpdatePosition(ctx, *position); err != nil {
+		return fmt.Errorf("failed to update position: %w", err)
+	}
+	metrics.RealizedPnL.WithLabelValues(g.repo.Account()).Add(realized)
+
+	g.logger.WithFields(logrus.Fields{
+		"symbol":       pair.Symbol,
+		"position_id":  position.ID,
+		"exit_price":   order.Price,
+		"quantity":     quantity,
+		"status":       position.Status,
+		"realized_pnl": position.RealizedPnL,
+	}).Info("Settled grid sell fill")
 
-	// Check for grid opportunities
-	for _, level := range gridLevels {
-		if g.shouldPlaceOrder(level, currentPrice, positions) {
-			if level.Type == "buy" && currentPrice <= level.Price {
-				// Place buy order at grid level
-				g.logger.WithFields(logrus.Fields{
-					"symbol": pair.Symbol,
-					"price":  level.Price,
-					"type":   "buy",
-				}).Info("Placing grid buy order")
-				// Implementation would go here
-			} else if level.Type == "sell" && currentPrice >= level.Price {
-				// Place sell order at grid level
-				g.logger.WithFields(logrus.Fields{
-					"symbol": pair.Symbol,
-					"price":  level.Price,
-					"type":   "sell",
-				}).Info("Placing grid sell order")
-				// Implementation would go here
+	return nil
+}
+
+// CancelExit cancels the resting grid exit of a position about to be closed
+// by other means, so the exit cannot sell quantity the position no longer
+// holds. A partially closed position gets a new exit for its remainder.
+func (g *GridStrategy) CancelExit(ctx context.Context, position models.Position) error {
+	if !g.config.GridOrdersEnabled {
+		return nil
+	}
+
+	resting, err := g.repo.GetRestingGridOrders(ctx, position.PairID)
+	if err != nil {
+		return err
+	}
+
+	for _, order := range resting {
+		if order.GridPositionID == nil || *order.GridPositionID != position.ID {
+			continue
+		}
+		if order.KuCoinOrderID != "" {
+			if err := g.exchange.CancelOrder(order.KuCoinOrderID); err != nil {
+				return fmt.Errorf("failed to cancel grid exit: %w", err)
 			}
 		}
+		if err := g.repo.UpdateOrderStatus(ctx, order.ID, "cancelled"); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// placeLevelOrder places and records the limit order of a grid level, or of
+// the exit of the given grid position. It is placed as GTT when a
+// cancel-after is configured, so a level the price never comes back to
+// expires on the exchange instead of resting indefinitely.
+func (g *GridStrategy) placeLevelOrder(ctx context.Context, pair models.SelectedPair, config models.TradingConfig,
+	level models.GridLevel, positionID *string) error {
+
+	if g.config.ObserveOnly {
+		recordWouldTrade(ctx, g.repo, models.WouldTrade{
+			PairID:      pair.ID,
+			Symbol:      pair.Symbol,
+			Action:      WouldPlaceGrid,
+			Side:        level.Type,
+			OrderType:   "limit",
+			Quantity:    level.Quantity,
+			Price:       level.Price,
+			Reason:      "grid level",
+			StrategyTag: strategyTag(g.config, config),
+		}, g.logger)
+		return nil
+	}
+
+	resp, err := g.exchange.PlaceExpiringOrder(pair.Symbol, level.Type, level.Quantity, level.Price, g.config.GridOrderCancelAfter)
+	if err != nil {
+		return fmt.Errorf("failed to place grid %s order: %w", level.Type, err)
+	}
+
+	return g.repo.CreateOrder(ctx, models.Order{
+		PairID:         pair.ID,
+		KuCoinOrderID:  resp.OrderId,
+		ClientOid:      resp.ClientOid,
+		Side:           level.Type,
+		Type:           "limit",
+		Quantity:       level.Quantity,
+		Price:          level.Price,
+		Status:         "pending",
+		StrategyTag:    strategyTag(g.config, config),
+		ConfigVersion:  g.config.ConfigVersion,
+		GridUnsettled:  true,
+		GridPositionID: positionID,
+	})
+}
+
+// hasRestingOrder reports whether a pending grid order already works the level
+func hasRestingOrder(resting []models.Order, level models.GridLevel) bool {
+	for _, order := range resting {
+		if order.GridPositionID == nil && order.Side == level.Type && math.Abs(order.Price-level.Price)/level.Price < gridLevelTolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// hasExitOrder reports whether a pending grid exit already sells the position
+func hasExitOrder(resting []models.Order, positionID string) bool {
+	for _, order := range resting {
+		if order.GridPositionID != nil && *order.GridPositionID == positionID {
+			return true
+		}
+	}
+	return false
+}
+
+// restingBuys counts the pending grid buys
+func restingBuys(resting []models.Order) int {
+	count := 0
+	for _, order := range resting {
+		if order.Side == "buy" {
+			count++
+		}
+	}
+	return count
+}
+
+// buyLevelsNearestFirst returns the buy levels ordered from the current
+// price downwards
+func buyLevelsNearestFirst(levels []models.GridLevel) []models.GridLevel {
+	var buys []models.GridLevel
+	for _, level := range levels {
+		if level.Type == "buy" {
+			buys = append(buys, level)
+		}
+	}
+	sort.Slice(buys, func(a, b int) bool {
+		return buys[a].Price > buys[b].Price
+	})
+	return buys
+}
+
+// rangeBreached reports whether price has left the grid's range by more than
+// the configured recenter margin
+func (g *GridStrategy) rangeBreached(config models.TradingConfig, currentPrice float64) bool {
+	if g.config.GridRecenterMargin <= 0 {
+		return false
+	}
+	return currentPrice > config.PriceRangeMax*(1+g.config.GridRecenterMargin) ||
+		currentPrice < config.PriceRangeMin*(1-g.config.GridRecenterMargin)
+}
+
+// recenter rebuilds the grid around the current price with the same width,
+// cancelling resting grid orders that fall outside the new range, and records
+// the event together with how many buy levels could be funded
+func (g *GridStrategy) recenter(ctx context.Context, pair models.SelectedPair, config *models.TradingConfig,
+	positions []models.Position, currentPrice float64) error {
+
+	oldMin, oldMax := config.PriceRangeMin, config.PriceRangeMax
+	halfWidth := (oldMax - oldMin) / 2
+	if halfWidth <= 0 {
+		halfWidth = currentPrice * 0.05
+	}
+
+	config.PriceRangeMin = currentPrice - halfWidth
+	config.PriceRangeMax = currentPrice + halfWidth
+	if config.PriceRangeMin <= 0 {
+		config.PriceRangeMin = currentPrice * 0.5
+	}
+
+	cancelled, err := g.cancelOutOfRange(ctx, pair, *config)
+	if err != nil {
+		return err
+	}
+
+	if err := g.repo.UpdateTradingConfigRange(ctx, config.ID, config.PriceRangeMin, config.PriceRangeMax); err != nil {
+		return err
+	}
+
+	levels := g.calculateGridLevels(*config, currentPrice)
+	buyLevels, funded := g.limitToCapital(pair, *config, positions, levels, currentPrice)
+
+	g.logger.WithFields(logrus.Fields{
+		"symbol":            pair.Symbol,
+		"price":             currentPrice,
+		"old_range_min":     oldMin,
+		"old_range_max":     oldMax,
+		"new_range_min":     config.PriceRangeMin,
+		"new_range_max":     config.PriceRangeMax,
+		"cancelled_orders":  cancelled,
+		"buy_levels":        buyLevels,
+		"funded_buy_levels": funded,
+	}).Info("Recentered grid after price left its range")
+
+	return g.repo.CreateGridRecenterEvent(ctx, models.GridRecenterEvent{
+		PairID:          pair.ID,
+		ConfigID:        config.ID,
+		Price:           currentPrice,
+		OldRangeMin:     oldMin,
+		OldRangeMax:     oldMax,
+		NewRangeMin:     config.PriceRangeMin,
+		NewRangeMax:     config.PriceRangeMax,
+		CancelledOrders: cancelled,
+		BuyLevels:       buyLevels,
+		FundedBuyLevels: funded,
+	})
+}
+
+// cancelOutOfRange cancels resting grid buys priced outside the range
+func (g *GridStrategy) cancelOutOfRange(ctx context.Context, pair models.SelectedPair, config models.TradingConfig) (int, error) {
+	orders, err := g.repo.GetRestingGridOrders(ctx, pair.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	cancelled := 0
+	for _, order := range orders {
+		// Exits follow their position's entry rather than the grid and stay
+		if order.GridPositionID != nil {
+			continue
+		}
+		if order.Price >= config.PriceRangeMin && order.Price <= config.PriceRangeMax {
+			continue
+		}
+
+		if order.KuCoinOrderID != "" {
+			if err := g.exchange.CancelOrder(order.KuCoinOrderID); err != nil {
+				g.logger.WithError(err).WithFields(logrus.Fields{
+					"symbol":   pair.Symbol,
+					"order_id": order.ID,
+				}).Warn("Failed to cancel out-of-range grid order")
+				continue
+			}
+		}
+
+		if err := g.repo.UpdateOrderStatus(ctx, order.ID, "cancelled"); err != nil {
+			return cancelled, err
+		}
+		cancelled++
+	}
+
+	return cancelled, nil
+}
+
+// limitToCapital deactivates the buy levels furthest from the price that the
+// available quote balance or the remaining position slots cannot cover. It
+// returns the number of buy levels and how many of them remain funded.
+func (g *GridStrategy) limitToCapital(pair models.SelectedPair, config models.TradingConfig,
+	positions []models.Position, levels []models.GridLevel, currentPrice float64) (int, int) {
+
+	var buys []int
+	for i, level := range levels {
+		if level.Type == "buy" {
+			buys = append(buys, i)
+		}
+	}
+	// Nearest to the current price first
+	sort.Slice(buys, func(a, b int) bool {
+		return levels[buys[a]].Price > levels[buys[b]].Price
+	})
+
+	affordable := config.MaxPositions - len(positions)
+	if affordable < 0 {
+		affordable = 0
+	}
+
+	if config.PositionSizeUSDT > 0 {
+		balance, err := g.exchange.GetAvailableBalance(quoteCurrency(pair.Symbol))
+		if err != nil {
+			g.logger.WithError(err).WithField("symbol", pair.Symbol).Warn("Failed to get balance for grid, funding no buy levels")
+			affordable = 0
+		} else if byCapital := int(balance / config.PositionSizeUSDT); byCapital < affordable {
+			affordable = byCapital
+		}
+	}
+
+	funded := 0
+	for _, i := range buys {
+		if funded < affordable {
+			funded++
+			continue
+		}
+		levels[i].IsActive = false
+	}
+
+	return len(buys), funded
+}
+
+// gridStep is the price distance between neighbouring levels, which spread
+// evenly from the bottom of the range to its top
+func gridStep(config models.TradingConfig) float64 {
+	if config.GridLevels < 2 {
+		return config.PriceRangeMax - config.PriceRangeMin
+	}
+	return (config.PriceRangeMax - config.PriceRangeMin) / float64(config.GridLevels-1)
+}
+
+// calculateGridLevels lays the levels from PriceRangeMin to PriceRangeMax,
+// both included. Levels below the current price are buys; those above are
+// where the exits of filled buys rest, since a spot grid only sells what it
+// bought.
 func (g *GridStrategy) calculateGridLevels(config models.TradingConfig, currentPrice float64) []models.GridLevel {
 	levels := make([]models.GridLevel, 0, config.GridLevels)
 
-	priceRange := config.PriceRangeMax - config.PriceRangeMin
-	stepSize := priceRange / float64(config.GridLevels)
+	stepSize := gridStep(config)
 
 	for i := 0; i < config.GridLevels; i++ {
 		price := config.PriceRangeMin + (float64(i) * stepSize)
@@ -90,10 +548,8 @@ func (g *GridStrategy) calculateGridLevels(config models.TradingConfig, currentP
 
 func (g *GridStrategy) shouldPlaceOrder(level models.GridLevel, currentPrice float64, positions []models.Position) bool {
 	// Check if we already have an order at this level
-	tolerance := 0.001 // 0.1% price tolerance
-
 	for _, position := range positions {
-		if math.Abs(position.EntryPrice-level.Price)/level.Price < tolerance {
+		if math.Abs(position.EntryPrice-level.Price)/level.Price < gridLevelTolerance {
 			return false // Already have position at this level
 		}
 	}
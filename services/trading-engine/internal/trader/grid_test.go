@@ -0,0 +1,279 @@
+package trader
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+func gridTestConfig() EngineConfig {
+	return EngineConfig{GridRecenterMargin: 0.05, GridOrdersEnabled: true}
+}
+
+// seedGrid stores a grid config over the range with the given levels
+func seedGrid(repo *MockDatabaseRepository, rangeMin, rangeMax float64, levels, maxPositions int) models.TradingConfig {
+	config := models.TradingConfig{
+		ID:               "config-1",
+		PairID:           testPair.ID,
+		StrategyType:     "grid",
+		GridLevels:       levels,
+		PriceRangeMin:    rangeMin,
+		PriceRangeMax:    rangeMax,
+		MaxPositions:     maxPositions,
+		PositionSizeUSDT: 100,
+	}
+	stored := config
+	repo.configs[testPair.ID] = &stored
+	return config
+}
+
+func TestGridBreakoutRecenters(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockDatabaseRepository("main")
+	ex := NewMockExchange()
+	ex.balances["USDT"] = 1000
+	grid := NewGridStrategy(repo, ex, gridTestConfig(), utils.NewDiscardLogger())
+
+	config := seedGrid(repo, 90, 110, 5, 5)
+	position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 100, Quantity: 1, Status: "open"})
+	stale := repo.AddOrder(models.Order{PairID: testPair.ID, KuCoinOrderID: "k-95", Side: "buy", Type: "limit", Price: 95, Status: "pending"})
+	exit := repo.AddOrder(models.Order{PairID: testPair.ID, KuCoinOrderID: "k-exit", Side: "sell", Type: "limit", Price: 105, Status: "pending", GridPositionID: &position.ID})
+
+	// 130 is beyond the 110 top by more than the 5% margin
+	if err := grid.Execute(ctx, testPair, config, models.Signal{}, repo.Positions(), 130); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if cancelled := ex.Cancelled(); len(cancelled) != 1 || cancelled[0] != "k-95" {
+		t.Errorf("cancelled %v, want only the out-of-range buy", cancelled)
+	}
+	for _, order := range repo.Orders() {
+		switch order.ID {
+		case stale.ID:
+			if order.Status != "cancelled" {
+				t.Errorf("out-of-range buy status = %s, want cancelled", order.Status)
+			}
+		case exit.ID:
+			if order.Status != "pending" {
+				t.Errorf("exit status = %s, want it left resting", order.Status)
+			}
+		}
+	}
+
+	if stored := repo.configs[testPair.ID]; stored.PriceRangeMin != 120 || stored.PriceRangeMax != 140 {
+		t.Errorf("stored range = [%v, %v], want [120, 140]", stored.PriceRangeMin, stored.PriceRangeMax)
+	}
+
+	recenters := repo.Recenters()
+	if len(recenters) != 1 {
+		t.Fatalf("recorded %d recenter events, want 1", len(recenters))
+	}
+	event := recenters[0]
+	if event.OldRangeMin != 90 || event.OldRangeMax != 110 || event.NewRangeMin != 120 || event.NewRangeMax != 140 {
+		t.Errorf("event range %v-%v -> %v-%v, want 90-110 -> 120-140", event.OldRangeMin, event.OldRangeMax, event.NewRangeMin, event.NewRangeMax)
+	}
+	if event.CancelledOrders != 1 || event.BuyLevels != 2 || event.FundedBuyLevels != 2 {
+		t.Errorf("event cancelled/buys/funded = %d/%d/%d, want 1/2/2", event.CancelledOrders, event.BuyLevels, event.FundedBuyLevels)
+	}
+
+	// The rebuilt grid rests buys at its levels below the new price
+	placed := ex.Placed()
+	if len(placed) != 2 || placed[0].Price != 125 || placed[1].Price != 120 {
+		t.Fatalf("placed %+v, want buys at 125 and 120", placed)
+	}
+	for _, order := range placed {
+		if order.Side != "buy" || !approxEqual(order.Quantity, 100/order.Price) {
+			t.Errorf("placed %+v, want a 100 USDT buy", order)
+		}
+	}
+}
+
+func TestGridWithinMarginKeepsRange(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockDatabaseRepository("main")
+	ex := NewMockExchange()
+	ex.balances["USDT"] = 1000
+	grid := NewGridStrategy(repo, ex, gridTestConfig(), utils.NewDiscardLogger())
+
+	config := seedGrid(repo, 90, 110, 5, 5)
+	repo.AddOrder(models.Order{PairID: testPair.ID, KuCoinOrderID: "k-95", Side: "buy", Type: "limit", Price: 95, Status: "pending"})
+
+	// Above the range but inside the margin
+	if err := grid.Execute(ctx, testPair, config, models.Signal{}, nil, 114); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if got := len(repo.Recenters()); got != 0 {
+		t.Errorf("recorded %d recenter events, want none", got)
+	}
+	if cancelled := ex.Cancelled(); len(cancelled) != 0 {
+		t.Errorf("cancelled %v, want nothing", cancelled)
+	}
+	if stored := repo.configs[testPair.ID]; stored.PriceRangeMin != 90 || stored.PriceRangeMax != 110 {
+		t.Errorf("stored range = [%v, %v], want it unchanged", stored.PriceRangeMin, stored.PriceRangeMax)
+	}
+}
+
+func TestGridRecenterLimitedByCapital(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockDatabaseRepository("main")
+	ex := NewMockExchange()
+	ex.balances["USDT"] = 250 // Funds two 100 USDT levels
+	grid := NewGridStrategy(repo, ex, gridTestConfig(), utils.NewDiscardLogger())
+
+	config := seedGrid(repo, 80, 120, 9, 10)
+
+	if err := grid.Execute(ctx, testPair, config, models.Signal{}, nil, 200); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	recenters := repo.Recenters()
+	if len(recenters) != 1 {
+		t.Fatalf("recorded %d recenter events, want 1", len(recenters))
+	}
+	if event := recenters[0]; event.NewRangeMin != 180 || event.NewRangeMax != 220 || event.BuyLevels != 4 || event.FundedBuyLevels != 2 {
+		t.Errorf("event = %+v, want range 180-220 with 2 of 4 buy levels funded", event)
+	}
+
+	// Only the levels nearest the price are rebuilt
+	placed := ex.Placed()
+	if len(placed) != 2 || placed[0].Price != 195 || placed[1].Price != 190 {
+		t.Fatalf("placed %+v, want buys at 195 and 190 only", placed)
+	}
+}
+
+func TestHasRestingOrder(t *testing.T) {
+	resting := []models.Order{{Side: "buy", Price: 100}, {Side: "sell", Price: 110}}
+
+	tests := []struct {
+		name  string
+		level models.GridLevel
+		want  bool
+	}{
+		{name: "same side and price", level: models.GridLevel{Type: "buy", Price: 100}, want: true},
+		{name: "within tolerance", level: models.GridLevel{Type: "sell", Price: 110.05}, want: true},
+		{name: "outside tolerance", level: models.GridLevel{Type: "buy", Price: 100.5}},
+		{name: "other side", level: models.GridLevel{Type: "sell", Price: 100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasRestingOrder(resting, tt.level); got != tt.want {
+				t.Errorf("hasRestingOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGridPlacesLadderedBuys(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxPositions int
+		balance      float64
+		positions    []models.Position
+		wantBuys     []float64
+		wantExits    []float64
+	}{
+		{name: "every level below the price", maxPositions: 5, balance: 1000, wantBuys: []float64{100, 95, 90}},
+		{name: "limited by the position slots", maxPositions: 2, balance: 1000, wantBuys: []float64{100, 95}},
+		{name: "limited by the balance", maxPositions: 5, balance: 150, wantBuys: []float64{100}},
+		{
+			name:         "filled level gets an exit instead of a buy",
+			maxPositions: 5,
+			balance:      1000,
+			positions:    []models.Position{{ID: "position-95", PairID: testPair.ID, Side: "buy", EntryPrice: 95, Quantity: 1, Status: "open"}},
+			wantBuys:     []float64{100, 90},
+			wantExits:    []float64{100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+			ex.balances["USDT"] = tt.balance
+			grid := NewGridStrategy(repo, ex, gridTestConfig(), utils.NewDiscardLogger())
+			// Levels at 90, 95, 100, 105 and 110
+			config := seedGrid(repo, 90, 110, 5, tt.maxPositions)
+
+			if err := grid.Execute(context.Background(), testPair, config, models.Signal{}, tt.positions, 102); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			var buys, exits []float64
+			for _, order := range ex.Placed() {
+				if order.Side == "buy" {
+					buys = append(buys, order.Price)
+					if !approxEqual(order.Quantity, 100/order.Price) {
+						t.Errorf("buy at %v for %v, want 100 USDT worth", order.Price, order.Quantity)
+					}
+				} else {
+					exits = append(exits, order.Price)
+				}
+			}
+			if fmt.Sprint(buys) != fmt.Sprint(tt.wantBuys) || fmt.Sprint(exits) != fmt.Sprint(tt.wantExits) {
+				t.Errorf("placed buys %v and exits %v, want %v and %v", buys, exits, tt.wantBuys, tt.wantExits)
+			}
+			if recorded := len(repo.Orders()); recorded != len(tt.wantBuys)+len(tt.wantExits) {
+				t.Errorf("recorded %d orders, want every placed order tracked", recorded)
+			}
+		})
+	}
+}
+
+func TestGridReseedsFilledLevels(t *testing.T) {
+	ctx := context.Background()
+	repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+	ex.balances["USDT"] = 1000
+	grid := NewGridStrategy(repo, ex, gridTestConfig(), utils.NewDiscardLogger())
+	config := seedGrid(repo, 90, 110, 5, 5)
+
+	execute := func(price float64) {
+		t.Helper()
+		if err := grid.SettleFills(ctx, testPair, config); err != nil {
+			t.Fatalf("SettleFills() error = %v", err)
+		}
+		positions, _ := repo.GetOpenPositions(ctx, testPair.ID)
+		if err := grid.Execute(ctx, testPair, config, models.Signal{}, positions, price); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+	}
+	fill := func(side string, price float64) {
+		t.Helper()
+		for _, order := range repo.Orders() {
+			if order.Status == "pending" && order.Side == side && order.Price == price {
+				order.Status, order.FilledQuantity = "filled", order.Quantity
+				repo.UpdateOrderFill(ctx, order)
+				return
+			}
+		}
+		t.Fatalf("no pending %s at %v to fill", side, price)
+	}
+
+	execute(102)
+	if placed := len(ex.Placed()); placed != 3 {
+		t.Fatalf("placed %d orders, want buys at 100, 95 and 90", placed)
+	}
+
+	// The buy at 100 fills: its exit rests a step above, and no new buy
+	// joins the others still resting
+	fill("buy", 100)
+	execute(101)
+	placed := ex.Placed()
+	if len(placed) != 4 || placed[3].Side != "sell" || placed[3].Price != 105 || !approxEqual(placed[3].Quantity, 1) {
+		t.Fatalf("placed %+v, want only the exit of the filled buy at 105", placed)
+	}
+
+	// The exit fills: the position closes and the freed level is bought again
+	fill("sell", 105)
+	execute(104)
+	if positions := repo.Positions(); len(positions) != 1 || positions[0].Status != "closed" {
+		t.Fatalf("positions = %+v, want the grid position closed by its exit", positions)
+	}
+	placed = ex.Placed()
+	if len(placed) != 5 || placed[4].Side != "buy" || placed[4].Price != 100 {
+		t.Fatalf("placed %+v, want the buy at 100 re-seeded", placed)
+	}
+}
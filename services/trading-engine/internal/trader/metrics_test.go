@@ -0,0 +1,82 @@
+package trader
+
+import (
+	"bufio"
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// scrape reads the registry through the /metrics handler, returning the value
+// of every series by its name and labels as exposed
+func scrape(t *testing.T) map[string]float64 {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 {
+		t.Fatalf("scrape returned %d, want 200", rec.Code)
+	}
+
+	series := make(map[string]float64)
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		split := strings.LastIndex(line, " ")
+		value, err := strconv.ParseFloat(line[split+1:], 64)
+		if err != nil {
+			t.Fatalf("unparseable sample %q: %v", line, err)
+		}
+		series[line[:split]] = value
+	}
+	return series
+}
+
+func TestCycleMetricsScraped(t *testing.T) {
+	repo, ex := NewMockDatabaseRepository("metrics"), NewMockExchange()
+	repo.pairs = []models.SelectedPair{testPair}
+	price := seedSellOff(repo)
+	// Well past its 10% take profit at the current price
+	repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 80, Quantity: 1, Status: "open"})
+
+	config := testEngineConfig()
+	config.ExitFeeRate = 0.001
+	config.PortfolioMetrics = true
+	engine := newTestEngine(repo, ex, config)
+
+	if err := engine.processTradingCycle(context.Background()); err != nil {
+		t.Fatalf("processTradingCycle() error = %v", err)
+	}
+
+	// The take profit closed the old position and the BUY opened a new one
+	series := scrape(t)
+	want := map[string]float64{
+		`crypto_bot_realized_pnl_usdt{account="metrics"}`:        price - 80 - 0.001*(80+price),
+		`crypto_bot_portfolio_open_positions{account="metrics"}`: 1,
+	}
+	for name, value := range want {
+		got, ok := series[name]
+		if !ok {
+			t.Errorf("%s not exposed", name)
+		} else if !approxEqual(got, value) {
+			t.Errorf("%s = %v, want %v", name, got, value)
+		}
+	}
+
+	for _, name := range []string{
+		`crypto_bot_portfolio_unrealized_pnl_usdt{account="metrics"}`,
+		`crypto_bot_portfolio_exposure_usdt{account="metrics"}`,
+	} {
+		if _, ok := series[name]; !ok {
+			t.Errorf("%s not exposed", name)
+		}
+	}
+}
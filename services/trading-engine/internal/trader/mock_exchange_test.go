@@ -0,0 +1,181 @@
+package trader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/exchange"
+)
+
+var _ exchange.Exchange = (*MockExchange)(nil)
+
+// placedOrder is one order a test exchange accepted
+type placedOrder struct {
+	ID       string
+	Symbol   string
+	Side     string
+	Type     string // limit, market or bracket
+	Quantity float64
+	Price    float64
+}
+
+// MockExchange is an in-memory exchange. Orders are accepted and recorded;
+// tests seed the order, bracket, fill and balance state lookups return.
+type MockExchange struct {
+	mu sync.Mutex
+
+	placed    []placedOrder
+	cancelled []string
+	nextID    int
+
+	orders   map[string]*kucoin.Order
+	statuses map[string]string
+	brackets map[string]*kucoin.OCOOrderDetails
+	fills    map[string][]kucoin.Fill
+	balances map[string]float64
+	fees     map[string]exchange.FeeRates
+
+	placeErr error // Returned by every placement when set
+}
+
+func NewMockExchange() *MockExchange {
+	return &MockExchange{
+		orders:   make(map[string]*kucoin.Order),
+		statuses: make(map[string]string),
+		brackets: make(map[string]*kucoin.OCOOrderDetails),
+		fills:    make(map[string][]kucoin.Fill),
+		balances: make(map[string]float64),
+		fees:     make(map[string]exchange.FeeRates),
+	}
+}
+
+func (m *MockExchange) place(symbol, side, orderType string, quantity, price float64) (*kucoin.OrderResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.placeErr != nil {
+		return nil, m.placeErr
+	}
+
+	m.nextID++
+	id := fmt.Sprintf("mock-%d", m.nextID)
+	m.placed = append(m.placed, placedOrder{ID: id, Symbol: symbol, Side: side, Type: orderType, Quantity: quantity, Price: price})
+	return &kucoin.OrderResponse{OrderId: id, ClientOid: "client-" + id}, nil
+}
+
+func (m *MockExchange) PlaceBuyOrder(symbol string, quantity, price float64) (*kucoin.OrderResponse, error) {
+	return m.place(symbol, "buy", "limit", quantity, price)
+}
+
+func (m *MockExchange) PlaceSellOrder(symbol string, quantity, price float64) (*kucoin.OrderResponse, error) {
+	return m.place(symbol, "sell", "limit", quantity, price)
+}
+
+func (m *MockExchange) PlaceExpiringOrder(symbol, side string, quantity, price float64, _ time.Duration) (*kucoin.OrderResponse, error) {
+	return m.place(symbol, side, "limit", quantity, price)
+}
+
+func (m *MockExchange) PlaceMarketOrder(symbol, side string, quantity float64) (*kucoin.OrderResponse, error) {
+	return m.place(symbol, side, "market", quantity, 0)
+}
+
+func (m *MockExchange) PlaceBracketOrder(symbol, side string, quantity, takeProfitPrice, _, _ float64) (*kucoin.OrderResponse, error) {
+	return m.place(symbol, side, "bracket", quantity, takeProfitPrice)
+}
+
+func (m *MockExchange) CancelOrder(orderID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cancelled = append(m.cancelled, orderID)
+	return nil
+}
+
+func (m *MockExchange) CancelBracketOrder(ocoOrderID string) error {
+	return m.CancelOrder(ocoOrderID)
+}
+
+func (m *MockExchange) GetOrder(orderID string) (*kucoin.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.orders[orderID]
+	if !ok {
+		return nil, exchange.ErrOrderNotFound
+	}
+	return order, nil
+}
+
+func (m *MockExchange) GetOrderStatus(orderID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if status, ok := m.statuses[orderID]; ok {
+		return status, nil
+	}
+	return "pending", nil
+}
+
+func (m *MockExchange) GetOrderByClientOid(clientOid string) (*kucoin.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, order := range m.orders {
+		if order.ClientOid == clientOid {
+			return order, nil
+		}
+	}
+	return nil, exchange.ErrOrderNotFound
+}
+
+func (m *MockExchange) GetFills(_ context.Context, orderID string) ([]kucoin.Fill, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.fills[orderID], nil
+}
+
+func (m *MockExchange) GetBracketOrder(ocoOrderID string) (*kucoin.OCOOrderDetails, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bracket, ok := m.brackets[ocoOrderID]
+	if !ok {
+		return nil, exchange.ErrOrderNotFound
+	}
+	return bracket, nil
+}
+
+func (m *MockExchange) GetAvailableBalance(currency string) (float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.balances[currency], nil
+}
+
+func (m *MockExchange) GetFeeRates(symbol string) (exchange.FeeRates, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rates, ok := m.fees[symbol]
+	return rates, ok, nil
+}
+
+// Placed returns the orders accepted so far
+func (m *MockExchange) Placed() []placedOrder {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]placedOrder(nil), m.placed...)
+}
+
+// Cancelled returns the IDs of orders and brackets cancelled so far
+func (m *MockExchange) Cancelled() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.cancelled...)
+}
@@ -0,0 +1,612 @@
+package trader
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/database"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+var _ database.RepositoryInterface = (*MockDatabaseRepository)(nil)
+
+// MockDatabaseRepository is an in-memory repository for one account. Its
+// queries filter the way the SQL of the real Repository does.
+type MockDatabaseRepository struct {
+	mu     sync.Mutex
+	nextID int
+
+	account   string
+	pairs     []models.SelectedPair
+	configs   map[int64]*models.TradingConfig
+	quotes    map[string]float64
+	quotedAt  map[string]time.Time // Observation time of a quote, now when unset
+	history   map[string][]models.Candle
+	positions []*models.Position
+	orders    []*models.Order
+	brackets  []*models.BracketOrder
+	halts     []models.RiskHalt
+	decisions []models.TradeDecision
+	would     []models.WouldTrade
+	recenters []models.GridRecenterEvent
+
+	createConfigErr   error // Returned by CreateTradingConfig when set
+	createConfigCalls int
+
+	failUpdates         int // UpdatePosition calls still to fail
+	updatePositionCalls int
+	historyReads        int // Calls of GetPriceHistory
+}
+
+func NewMockDatabaseRepository(account string) *MockDatabaseRepository {
+	return &MockDatabaseRepository{
+		account:  account,
+		configs:  make(map[int64]*models.TradingConfig),
+		quotes:   make(map[string]float64),
+		quotedAt: make(map[string]time.Time),
+		history:  make(map[string][]models.Candle),
+	}
+}
+
+func (m *MockDatabaseRepository) id(prefix string) string {
+	m.nextID++
+	return fmt.Sprintf("%s-%d", prefix, m.nextID)
+}
+
+func (m *MockDatabaseRepository) Account() string {
+	return m.account
+}
+
+func (m *MockDatabaseRepository) GetActiveSelectedPairs(_ context.Context) ([]models.SelectedPair, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.SelectedPair(nil), m.pairs...), nil
+}
+
+func (m *MockDatabaseRepository) GetTradingConfig(_ context.Context, pairID int64) (*models.TradingConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	config, ok := m.configs[pairID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *config
+	return &copied, nil
+}
+
+func (m *MockDatabaseRepository) CreateTradingConfig(_ context.Context, config models.TradingConfig) (*models.TradingConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.createConfigCalls++
+	if m.createConfigErr != nil {
+		return nil, m.createConfigErr
+	}
+	if existing, ok := m.configs[config.PairID]; ok {
+		copied := *existing
+		return &copied, nil
+	}
+	config.ID = m.id("config")
+	m.configs[config.PairID] = &config
+	copied := config
+	return &copied, nil
+}
+
+func (m *MockDatabaseRepository) UpdateTradingConfigRange(_ context.Context, configID string, rangeMin, rangeMax float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, config := range m.configs {
+		if config.ID == configID {
+			config.PriceRangeMin, config.PriceRangeMax = rangeMin, rangeMax
+		}
+	}
+	return nil
+}
+
+func (m *MockDatabaseRepository) CreateGridRecenterEvent(_ context.Context, event models.GridRecenterEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.recenters = append(m.recenters, event)
+	return nil
+}
+
+func (m *MockDatabaseRepository) GetLatestQuote(_ context.Context, symbol string) (float64, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	price, ok := m.quotes[symbol]
+	if !ok {
+		return 0, time.Time{}, fmt.Errorf("no price data found for symbol %s", symbol)
+	}
+	if observedAt, ok := m.quotedAt[symbol]; ok {
+		return price, observedAt, nil
+	}
+	return price, time.Now(), nil
+}
+
+func (m *MockDatabaseRepository) GetPriceHistory(_ context.Context, symbol string, since time.Time) ([]models.Candle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.historyReads++
+	var candles []models.Candle
+	for _, candle := range m.history[symbol] {
+		if !candle.Timestamp.Before(since) {
+			candles = append(candles, candle)
+		}
+	}
+	return candles, nil
+}
+
+func isOpenPosition(position *models.Position) bool {
+	return position.Status == "open" || position.Status == "partial"
+}
+
+func (m *MockDatabaseRepository) openPositions(match func(*models.Position) bool) []models.Position {
+	var positions []models.Position
+	for i := len(m.positions) - 1; i >= 0; i-- { // Newest first
+		if position := m.positions[i]; isOpenPosition(position) && match(position) {
+			positions = append(positions, *position)
+		}
+	}
+	return positions
+}
+
+func (m *MockDatabaseRepository) GetOpenPositions(_ context.Context, pairID int64) ([]models.Position, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.openPositions(func(p *models.Position) bool { return p.PairID == pairID }), nil
+}
+
+func (m *MockDatabaseRepository) GetAllOpenPositions(_ context.Context) ([]models.Position, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.openPositions(func(*models.Position) bool { return true }), nil
+}
+
+func (m *MockDatabaseRepository) GetOpenPositionsWithInvalidSide(_ context.Context) ([]models.Position, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.openPositions(func(p *models.Position) bool { return p.Side != "buy" && p.Side != "sell" }), nil
+}
+
+func (m *MockDatabaseRepository) GetPositionByID(_ context.Context, id string) (*models.Position, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, position := range m.positions {
+		if position.ID == id {
+			copied := *position
+			return &copied, nil
+		}
+	}
+	return nil, database.ErrNotFound
+}
+
+func (m *MockDatabaseRepository) CreatePosition(_ context.Context, position *models.Position) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	position.ID = m.id("position")
+	position.AccountID = m.account
+	position.CreatedAt = time.Now()
+	position.UpdatedAt = position.CreatedAt
+	copied := *position
+	m.positions = append(m.positions, &copied)
+	return nil
+}
+
+func (m *MockDatabaseRepository) UpdatePosition(_ context.Context, position models.Position) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.updatePositionCalls++
+	if m.failUpdates > 0 {
+		m.failUpdates--
+		return fmt.Errorf("update of position %s failed", position.ID)
+	}
+
+	for i, existing := range m.positions {
+		if existing.ID == position.ID {
+			position.UpdatedAt = time.Now()
+			m.positions[i] = &position
+			return nil
+		}
+	}
+	return fmt.Errorf("position %s not found", position.ID)
+}
+
+func (m *MockDatabaseRepository) CreateOrder(_ context.Context, order models.Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order.ID = m.id("order")
+	order.AccountID = m.account
+	order.CreatedAt = time.Now()
+	order.UpdatedAt = order.CreatedAt
+	m.orders = append(m.orders, &order)
+	return nil
+}
+
+func (m *MockDatabaseRepository) findOrders(match func(*models.Order) bool) []models.Order {
+	var orders []models.Order
+	for _, order := range m.orders {
+		if match(order) {
+			orders = append(orders, *order)
+		}
+	}
+	return orders
+}
+
+func (m *MockDatabaseRepository) CountOpenLimitOrders(_ context.Context, pairID int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.findOrders(func(o *models.Order) bool {
+		return o.PairID == pairID && o.Status == "pending" && o.Type == "limit"
+	})), nil
+}
+
+func (m *MockDatabaseRepository) GetPendingOrders(_ context.Context) ([]models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findOrders(func(o *models.Order) bool {
+		return o.Status == "pending" && o.KuCoinOrderID != ""
+	}), nil
+}
+
+func (m *MockDatabaseRepository) GetPendingEntryOrders(_ context.Context, pairID int64) ([]models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findOrders(func(o *models.Order) bool {
+		return o.PairID == pairID && o.Status == "pending" && o.Type == "limit" && o.PositionID != nil && o.KuCoinOrderID != ""
+	}), nil
+}
+
+func (m *MockDatabaseRepository) GetStrandedOrders(_ context.Context, createdBefore time.Time) ([]models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findOrders(func(o *models.Order) bool {
+		return o.Status == "pending" && o.KuCoinOrderID == "" && o.CreatedAt.Before(createdBefore)
+	}), nil
+}
+
+func (m *MockDatabaseRepository) updateOrder(orderID string, update func(*models.Order)) error {
+	for _, order := range m.orders {
+		if order.ID == orderID {
+			update(order)
+			order.UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return fmt.Errorf("order %s not found", orderID)
+}
+
+func (m *MockDatabaseRepository) SetOrderExchangeID(_ context.Context, orderID, kucoinOrderID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateOrder(orderID, func(o *models.Order) { o.KuCoinOrderID = kucoinOrderID })
+}
+
+func (m *MockDatabaseRepository) UpdateOrderStatus(_ context.Context, orderID, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateOrder(orderID, func(o *models.Order) { o.Status = status })
+}
+
+func (m *MockDatabaseRepository) UpdateOrderFill(_ context.Context, order models.Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateOrder(order.ID, func(o *models.Order) {
+		o.FilledQuantity, o.Price, o.Fee, o.Status, o.FilledAt = order.FilledQuantity, order.Price, order.Fee, order.Status, order.FilledAt
+		o.GridUnsettled = o.GridUnsettled || order.GridUnsettled
+	})
+}
+
+func (m *MockDatabaseRepository) GetRestingGridOrders(_ context.Context, pairID int64) ([]models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findOrders(func(o *models.Order) bool {
+		return o.PairID == pairID && o.Status == "pending" && o.Type == "limit" && o.PositionID == nil
+	}), nil
+}
+
+func (m *MockDatabaseRepository) GetUnsettledGridFills(_ context.Context, pairID int64) ([]models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findOrders(func(o *models.Order) bool {
+		return o.PairID == pairID && o.Status == "filled" && o.GridUnsettled
+	}), nil
+}
+
+func (m *MockDatabaseRepository) SettleGridOrder(_ context.Context, orderID, positionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateOrder(orderID, func(o *models.Order) {
+		o.GridUnsettled = false
+		o.PositionID = nil
+		if positionID != "" {
+			o.PositionID = &positionID
+		}
+	})
+}
+
+func (m *MockDatabaseRepository) CreateBracketOrder(_ context.Context, bracket models.BracketOrder) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bracket.ID = m.id("bracket")
+	bracket.CreatedAt = time.Now()
+	bracket.UpdatedAt = bracket.CreatedAt
+	m.brackets = append(m.brackets, &bracket)
+	return nil
+}
+
+func isOpenBracket(bracket *models.BracketOrder) bool {
+	return bracket.Status == "pending" || bracket.Status == "active"
+}
+
+func (m *MockDatabaseRepository) GetOpenBracketOrders(_ context.Context) ([]models.BracketOrder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var brackets []models.BracketOrder
+	for _, bracket := range m.brackets {
+		if isOpenBracket(bracket) {
+			brackets = append(brackets, *bracket)
+		}
+	}
+	return brackets, nil
+}
+
+func (m *MockDatabaseRepository) GetOpenBracketOrderByPosition(_ context.Context, positionID string) (*models.BracketOrder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, bracket := range m.brackets {
+		if bracket.PositionID == positionID && isOpenBracket(bracket) {
+			copied := *bracket
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MockDatabaseRepository) UpdateBracketOrder(_ context.Context, bracket models.BracketOrder) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, existing := range m.brackets {
+		if existing.ID == bracket.ID {
+			bracket.UpdatedAt = time.Now()
+			m.brackets[i] = &bracket
+			return nil
+		}
+	}
+	return fmt.Errorf("bracket order %s not found", bracket.ID)
+}
+
+func (m *MockDatabaseRepository) GetActiveRiskHalts(_ context.Context) ([]models.RiskHalt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var halts []models.RiskHalt
+	for _, halt := range m.halts {
+		if halt.HaltedUntil.After(time.Now()) {
+			halts = append(halts, halt)
+		}
+	}
+	return halts, nil
+}
+
+func (m *MockDatabaseRepository) SaveRiskHalt(_ context.Context, halt models.RiskHalt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, existing := range m.halts {
+		if existing.Scope == halt.Scope && existing.PairID == halt.PairID {
+			if halt.HaltedUntil.After(existing.HaltedUntil) {
+				m.halts[i] = halt
+			}
+			return nil
+		}
+	}
+	m.halts = append(m.halts, halt)
+	return nil
+}
+
+func (m *MockDatabaseRepository) closedSince(since time.Time) []*models.Position {
+	var positions []*models.Position
+	for _, position := range m.positions {
+		if position.Status == "closed" && position.ClosedAt != nil && !position.ClosedAt.Before(since) {
+			positions = append(positions, position)
+		}
+	}
+	return positions
+}
+
+func (m *MockDatabaseRepository) GetRecentRealizedPnL(_ context.Context, since time.Time) (float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pnl float64
+	for _, position := range m.closedSince(since) {
+		pnl += position.RealizedPnL
+	}
+	return pnl, nil
+}
+
+func (m *MockDatabaseRepository) GetRecentRealizedLoss(_ context.Context, since time.Time) (float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var loss float64
+	for _, position := range m.closedSince(since) {
+		if position.RealizedPnL < 0 {
+			loss -= position.RealizedPnL
+		}
+	}
+	return loss, nil
+}
+
+func (m *MockDatabaseRepository) GetRecentClosedPositions(_ context.Context, limit int) ([]models.Position, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	closed := m.closedSince(time.Time{})
+	sort.Slice(closed, func(i, j int) bool { return closed[i].ClosedAt.After(*closed[j].ClosedAt) })
+
+	var positions []models.Position
+	for _, position := range closed {
+		if len(positions) == limit {
+			break
+		}
+		positions = append(positions, *position)
+	}
+	return positions, nil
+}
+
+func (m *MockDatabaseRepository) GetStrategyTrackRecord(_ context.Context, strategyTag string) (int, float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var trades int
+	var pnl float64
+	for _, position := range m.positions {
+		if position.Status == "closed" && position.StrategyTag == strategyTag {
+			trades++
+			pnl += position.RealizedPnL
+		}
+	}
+	return trades, pnl, nil
+}
+
+func (m *MockDatabaseRepository) CreateTradeDecision(_ context.Context, decision models.TradeDecision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.decisions = append(m.decisions, decision)
+	return nil
+}
+
+func (m *MockDatabaseRepository) CreateWouldTrade(_ context.Context, trade models.WouldTrade) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.would = append(m.would, trade)
+	return nil
+}
+
+// AddPosition stores a position as it is, keeping its ID when set
+func (m *MockDatabaseRepository) AddPosition(position models.Position) models.Position {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if position.ID == "" {
+		position.ID = m.id("position")
+	}
+	if position.AccountID == "" {
+		position.AccountID = m.account
+	}
+	m.positions = append(m.positions, &position)
+	return position
+}
+
+// AddOrder stores an order as it is, keeping its ID when set
+func (m *MockDatabaseRepository) AddOrder(order models.Order) models.Order {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if order.ID == "" {
+		order.ID = m.id("order")
+	}
+	m.orders = append(m.orders, &order)
+	return order
+}
+
+// AddBracketOrder stores a bracket order as it is, keeping its ID when set
+func (m *MockDatabaseRepository) AddBracketOrder(bracket models.BracketOrder) models.BracketOrder {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if bracket.ID == "" {
+		bracket.ID = m.id("bracket")
+	}
+	m.brackets = append(m.brackets, &bracket)
+	return bracket
+}
+
+// Positions returns every stored position, open or closed
+func (m *MockDatabaseRepository) Positions() []models.Position {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	positions := make([]models.Position, 0, len(m.positions))
+	for _, position := range m.positions {
+		positions = append(positions, *position)
+	}
+	return positions
+}
+
+// Orders returns every stored order
+func (m *MockDatabaseRepository) Orders() []models.Order {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findOrders(func(*models.Order) bool { return true })
+}
+
+// Brackets returns every stored bracket order
+func (m *MockDatabaseRepository) Brackets() []models.BracketOrder {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	brackets := make([]models.BracketOrder, 0, len(m.brackets))
+	for _, bracket := range m.brackets {
+		brackets = append(brackets, *bracket)
+	}
+	return brackets
+}
+
+// Recenters returns every recorded grid recenter event
+func (m *MockDatabaseRepository) Recenters() []models.GridRecenterEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.GridRecenterEvent(nil), m.recenters...)
+}
+
+// Decisions returns every recorded trade decision
+func (m *MockDatabaseRepository) Decisions() []models.TradeDecision {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.TradeDecision(nil), m.decisions...)
+}
+
+// WouldTrades returns every order recorded in observe mode
+func (m *MockDatabaseRepository) WouldTrades() []models.WouldTrade {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.WouldTrade(nil), m.would...)
+}
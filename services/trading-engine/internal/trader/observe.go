@@ -0,0 +1,85 @@
+package trader
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/database"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// Would-trade actions recorded in observe mode
+const (
+	WouldEnter       = "entry"
+	WouldExit        = "exit"
+	WouldPartialExit = "partial_exit"
+	WouldPlaceGrid   = "grid"
+)
+
+// recordWouldTrade logs and stores an order observe mode decided on in place
+// of sending it. A failed write is only logged, since observe mode has no
+// state that depends on it.
+func recordWouldTrade(ctx context.Context, repo database.RepositoryInterface, trade models.WouldTrade, logger *logrus.Logger) {
+	logger.WithFields(logrus.Fields{
+		"symbol":   trade.Symbol,
+		"action":   trade.Action,
+		"side":     trade.Side,
+		"type":     trade.OrderType,
+		"quantity": trade.Quantity,
+		"price":    trade.Price,
+		"reason":   trade.Reason,
+	}).Info("Observe mode, order not placed")
+
+	if err := repo.CreateWouldTrade(ctx, trade); err != nil {
+		logger.WithError(err).WithField("symbol", trade.Symbol).Error("Failed to record would-trade")
+	}
+}
+
+// observeEntry records the entry observe mode would have opened, with the
+// decision context it was based on
+func (e *Engine) observeEntry(ctx context.Context, pair models.SelectedPair, config models.TradingConfig,
+	decision DecisionContext, quantity, price float64) {
+
+	encoded, err := json.Marshal(decision)
+	if err != nil {
+		e.logger.WithError(err).WithField("symbol", pair.Symbol).Warn("Failed to encode decision context")
+	}
+
+	recordWouldTrade(ctx, e.repo, models.WouldTrade{
+		PairID:      pair.ID,
+		Symbol:      pair.Symbol,
+		Action:      WouldEnter,
+		Side:        "buy",
+		OrderType:   "limit",
+		Quantity:    quantity,
+		Price:       price,
+		Reason:      decision.Signal.Reason,
+		StrategyTag: e.strategyTag(config),
+		Context:     encoded,
+	}, e.logger)
+}
+
+// observeExit records the close of an existing position observe mode would
+// have placed
+func (e *Engine) observeExit(ctx context.Context, pair models.SelectedPair, position models.Position,
+	action, orderType string, quantity, price float64, reason string) {
+
+	side := "sell"
+	if position.Side == "sell" {
+		side = "buy"
+	}
+
+	recordWouldTrade(ctx, e.repo, models.WouldTrade{
+		PairID:      pair.ID,
+		Symbol:      pair.Symbol,
+		PositionID:  &position.ID,
+		Action:      action,
+		Side:        side,
+		OrderType:   orderType,
+		Quantity:    quantity,
+		Price:       price,
+		Reason:      reason,
+		StrategyTag: position.StrategyTag,
+	}, e.logger)
+}
@@ -0,0 +1,79 @@
+package trader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// wouldTradesOf returns the recorded would-trades of one action
+func wouldTradesOf(repo *MockDatabaseRepository, action string) []models.WouldTrade {
+	var trades []models.WouldTrade
+	for _, trade := range repo.WouldTrades() {
+		if trade.Action == action {
+			trades = append(trades, trade)
+		}
+	}
+	return trades
+}
+
+func TestObserveModeRecordsEntryWithoutTrading(t *testing.T) {
+	repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+	price := seedSellOff(repo)
+	config := testEngineConfig()
+	config.ObserveOnly = true
+	engine := newTestEngine(repo, ex, config)
+
+	if err := engine.processPair(context.Background(), testPair); err != nil {
+		t.Fatalf("processPair() error = %v", err)
+	}
+
+	if placed := ex.Placed(); len(placed) != 0 {
+		t.Errorf("placed %d orders in observe mode, want none", len(placed))
+	}
+	if positions := repo.Positions(); len(positions) != 0 {
+		t.Errorf("opened %d positions in observe mode, want none", len(positions))
+	}
+
+	entries := wouldTradesOf(repo, WouldEnter)
+	if len(entries) != 1 {
+		t.Fatalf("recorded %d would-entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.Symbol != testSymbol || entry.Side != "buy" || entry.OrderType != "limit" || entry.Quantity <= 0 || !approxEqual(entry.Price, price) {
+		t.Errorf("would-entry = %+v, want a limit buy of %s near %v", entry, testSymbol, price)
+	}
+	if len(entry.Context) == 0 {
+		t.Error("would-entry has no decision context")
+	}
+}
+
+func TestObserveModeRecordsExitWithoutTrading(t *testing.T) {
+	repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+	seedSellOff(repo)
+	// Entered above the 5% stop loss of the current price
+	position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", Quantity: 1, EntryPrice: 101, Status: "open"})
+	config := testEngineConfig()
+	config.ObserveOnly = true
+	engine := newTestEngine(repo, ex, config)
+
+	if err := engine.processPair(context.Background(), testPair); err != nil {
+		t.Fatalf("processPair() error = %v", err)
+	}
+
+	if placed := ex.Placed(); len(placed) != 0 {
+		t.Errorf("placed %d orders in observe mode, want none", len(placed))
+	}
+	if positions := repo.Positions(); len(positions) != 1 || positions[0].Status != "open" {
+		t.Errorf("positions = %+v, want the one position left open", positions)
+	}
+
+	exits := wouldTradesOf(repo, WouldExit)
+	if len(exits) != 1 {
+		t.Fatalf("recorded %d would-exits, want 1", len(exits))
+	}
+	if exit := exits[0]; exit.PositionID == nil || *exit.PositionID != position.ID || exit.Side != "sell" || exit.Quantity != 1 {
+		t.Errorf("would-exit = %+v, want a sell of the whole position %s", exit, position.ID)
+	}
+}
@@ -0,0 +1,104 @@
+package trader
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// OffsettingFill is a buy and a sell on the same pair, filled within the
+// detection window for about the same quantity, by different positions.
+// Together they have almost no economic effect but still book PnL and fees.
+type OffsettingFill struct {
+	PairID         int64
+	BuyOrderID     string
+	SellOrderID    string
+	BuyPositionID  string
+	SellPositionID string
+	Quantity       float64
+	Fees           float64
+}
+
+// OffsetDetector finds offsetting fills so reports can flag or net them
+type OffsetDetector struct {
+	window    time.Duration
+	tolerance float64 // Largest relative quantity difference still treated as offsetting
+}
+
+func NewOffsetDetector(window time.Duration, tolerance float64) *OffsetDetector {
+	return &OffsetDetector{
+		window:    window,
+		tolerance: tolerance,
+	}
+}
+
+// Detect pairs each filled buy with the earliest unmatched sell on the same
+// pair that filled within the window and matches its quantity. An order is
+// matched at most once, and the entry and exit of one position never offset
+// each other.
+func (d *OffsetDetector) Detect(orders []models.Order) []OffsettingFill {
+	byPair := make(map[int64][]models.Order)
+	for _, order := range orders {
+		if order.FilledAt == nil || order.FilledQuantity <= 0 {
+			continue
+		}
+		byPair[order.PairID] = append(byPair[order.PairID], order)
+	}
+
+	var offsets []OffsettingFill
+	for pairID, fills := range byPair {
+		sort.Slice(fills, func(i, j int) bool {
+			return fills[i].FilledAt.Before(*fills[j].FilledAt)
+		})
+
+		matched := make([]bool, len(fills))
+		for i, buy := range fills {
+			if buy.Side != "buy" || matched[i] {
+				continue
+			}
+
+			for j, sell := range fills {
+				if sell.Side != "sell" || matched[j] {
+					continue
+				}
+				if gap := sell.FilledAt.Sub(*buy.FilledAt); gap < -d.window || gap > d.window {
+					continue
+				}
+				if samePosition(buy, sell) || !d.quantitiesMatch(buy.FilledQuantity, sell.FilledQuantity) {
+					continue
+				}
+
+				matched[i], matched[j] = true, true
+				offsets = append(offsets, OffsettingFill{
+					PairID:         pairID,
+					BuyOrderID:     buy.ID,
+					SellOrderID:    sell.ID,
+					BuyPositionID:  positionID(buy),
+					SellPositionID: positionID(sell),
+					Quantity:       math.Min(buy.FilledQuantity, sell.FilledQuantity),
+					Fees:           buy.Fee + sell.Fee,
+				})
+				break
+			}
+		}
+	}
+
+	return offsets
+}
+
+func (d *OffsetDetector) quantitiesMatch(a, b float64) bool {
+	return math.Abs(a-b) <= d.tolerance*math.Max(a, b)
+}
+
+func samePosition(a, b models.Order) bool {
+	return a.PositionID != nil && b.PositionID != nil && *a.PositionID == *b.PositionID
+}
+
+func positionID(order models.Order) string {
+	if order.PositionID == nil {
+		return ""
+	}
+	return *order.PositionID
+}
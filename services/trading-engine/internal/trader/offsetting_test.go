@@ -0,0 +1,106 @@
+package trader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// filledOrder is a fill of the quantity at the time, for the position
+func filledOrder(id string, pairID int64, side, position string, quantity float64, at time.Time) models.Order {
+	order := models.Order{ID: id, PairID: pairID, Side: side, FilledQuantity: quantity, Fee: 0.1, Status: "filled", FilledAt: &at}
+	if position != "" {
+		order.PositionID = &position
+	}
+	return order
+}
+
+func TestDetectOffsettingFills(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		orders []models.Order
+		want   []OffsettingFill
+	}{
+		{
+			name: "buy and sell of different positions within the window",
+			orders: []models.Order{
+				filledOrder("buy-1", 1, "buy", "position-a", 1, at),
+				filledOrder("sell-1", 1, "sell", "position-b", 0.995, at.Add(20*time.Second)),
+			},
+			want: []OffsettingFill{{PairID: 1, BuyOrderID: "buy-1", SellOrderID: "sell-1", BuyPositionID: "position-a", SellPositionID: "position-b", Quantity: 0.995, Fees: 0.2}},
+		},
+		{
+			name: "sell just before the buy still offsets",
+			orders: []models.Order{
+				filledOrder("sell-1", 1, "sell", "position-b", 1, at),
+				filledOrder("buy-1", 1, "buy", "position-a", 1, at.Add(30*time.Second)),
+			},
+			want: []OffsettingFill{{PairID: 1, BuyOrderID: "buy-1", SellOrderID: "sell-1", BuyPositionID: "position-a", SellPositionID: "position-b", Quantity: 1, Fees: 0.2}},
+		},
+		{
+			name: "fills further apart than the window",
+			orders: []models.Order{
+				filledOrder("buy-1", 1, "buy", "position-a", 1, at),
+				filledOrder("sell-1", 1, "sell", "position-b", 1, at.Add(2*time.Minute)),
+			},
+		},
+		{
+			name: "entry and exit of one position",
+			orders: []models.Order{
+				filledOrder("buy-1", 1, "buy", "position-a", 1, at),
+				filledOrder("sell-1", 1, "sell", "position-a", 1, at.Add(10*time.Second)),
+			},
+		},
+		{
+			name: "quantities too different",
+			orders: []models.Order{
+				filledOrder("buy-1", 1, "buy", "position-a", 1, at),
+				filledOrder("sell-1", 1, "sell", "position-b", 0.5, at.Add(10*time.Second)),
+			},
+		},
+		{
+			name: "different pairs",
+			orders: []models.Order{
+				filledOrder("buy-1", 1, "buy", "position-a", 1, at),
+				filledOrder("sell-1", 2, "sell", "position-b", 1, at.Add(10*time.Second)),
+			},
+		},
+		{
+			name: "each fill offsets at most once",
+			orders: []models.Order{
+				filledOrder("buy-1", 1, "buy", "position-a", 1, at),
+				filledOrder("buy-2", 1, "buy", "position-c", 1, at.Add(5*time.Second)),
+				filledOrder("sell-1", 1, "sell", "position-b", 1, at.Add(10*time.Second)),
+			},
+			want: []OffsettingFill{{PairID: 1, BuyOrderID: "buy-1", SellOrderID: "sell-1", BuyPositionID: "position-a", SellPositionID: "position-b", Quantity: 1, Fees: 0.2}},
+		},
+		{
+			name: "unfilled orders are ignored",
+			orders: []models.Order{
+				filledOrder("buy-1", 1, "buy", "position-a", 1, at),
+				{ID: "sell-1", PairID: 1, Side: "sell", Quantity: 1, Status: "cancelled"},
+			},
+		},
+	}
+
+	detector := NewOffsetDetector(time.Minute, 0.01)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := detector.Detect(tt.orders)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Detect() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				want := tt.want[i]
+				if got[i].BuyOrderID != want.BuyOrderID || got[i].SellOrderID != want.SellOrderID ||
+					got[i].BuyPositionID != want.BuyPositionID || got[i].SellPositionID != want.SellPositionID ||
+					got[i].PairID != want.PairID || !approxEqual(got[i].Quantity, want.Quantity) || !approxEqual(got[i].Fees, want.Fees) {
+					t.Errorf("offset %d = %+v, want %+v", i, got[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package trader
+
+import (
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/exchange"
+	"github.com/sirupsen/logrus"
+)
+
+// computeRealizedPnL is the PnL of closing quantity of a position opened on
+// side at entry by trading at exit, net of fees. A short ("sell") gains when
+// the exit is below the entry. Every close path books PnL through it so the
+// sign convention cannot drift between them.
+func computeRealizedPnL(side string, entry, exit, quantity, fees float64) float64 {
+	gross := (exit - entry) * quantity
+	if side == "sell" {
+		gross = -gross
+	}
+	return gross - fees
+}
+
+// closingFees is the fee booked when quantity of a position is closed at
+// exitPrice. With fill reconciliation the actual fees of reconciled orders
+// are deducted as they settle, so only an exit that is not reconciled is
+// estimated here. Without it both legs are estimated at the taker rate.
+func closingFees(ex exchange.Exchange, config EngineConfig, symbol string, entryPrice, exitPrice, quantity float64,
+	exitReconciled bool, logger *logrus.Logger) float64 {
+
+	var notional float64
+	if !config.FillReconciliationEnabled {
+		notional += entryPrice * quantity
+	}
+	if !config.FillReconciliationEnabled || !exitReconciled {
+		notional += exitPrice * quantity
+	}
+	if notional == 0 {
+		return 0
+	}
+
+	return notional * takerFeeRate(ex, config, symbol, logger)
+}
+
+// takerFeeRate is the account's cached taker rate for the symbol, or the
+// configured fee rate when the rates are not cached
+func takerFeeRate(ex exchange.Exchange, config EngineConfig, symbol string, logger *logrus.Logger) float64 {
+	rates, ok, err := ex.GetFeeRates(symbol)
+	if err != nil {
+		logger.WithError(err).WithField("symbol", symbol).Debug("Failed to get fee rates, estimating fees at the configured rate")
+		return config.ExitFeeRate
+	}
+	if !ok {
+		return config.ExitFeeRate
+	}
+	return rates.Taker
+}
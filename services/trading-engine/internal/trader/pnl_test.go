@@ -0,0 +1,137 @@
+package trader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/exchange"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+func TestComputeRealizedPnL(t *testing.T) {
+	tests := []struct {
+		name     string
+		side     string
+		entry    float64
+		exit     float64
+		quantity float64
+		fees     float64
+		want     float64
+	}{
+		{name: "long closed higher", side: "buy", entry: 100, exit: 110, quantity: 2, want: 20},
+		{name: "long closed lower", side: "buy", entry: 100, exit: 95, quantity: 2, want: -10},
+		{name: "short closed lower", side: "sell", entry: 100, exit: 90, quantity: 2, want: 20},
+		{name: "short closed higher", side: "sell", entry: 100, exit: 105, quantity: 2, want: -10},
+		{name: "fees deducted from a gain", side: "buy", entry: 100, exit: 110, quantity: 1, fees: 0.21, want: 9.79},
+		{name: "fees deepen a short's loss", side: "sell", entry: 100, exit: 105, quantity: 1, fees: 0.205, want: -5.205},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := computeRealizedPnL(tt.side, tt.entry, tt.exit, tt.quantity, tt.fees); !approxEqual(got, tt.want) {
+				t.Errorf("computeRealizedPnL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStopLossClosesBookUnifiedPnL(t *testing.T) {
+	config := testEngineConfig()
+	config.ExitFeeRate = 0.001
+	pairConfig := models.TradingConfig{StopLossPercent: 0.05, TakeProfitPercent: 0.1}
+
+	tests := []struct {
+		side  string
+		price float64 // Through the 5% stop of an entry at 100
+		want  float64 // A 12 loss and both legs' fees at the 0.1% rate
+	}{
+		{side: "buy", price: 94, want: -12.388},
+		{side: "sell", price: 106, want: -12.412},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.side, func(t *testing.T) {
+			repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+			engine := newTestEngine(repo, ex, config)
+			position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: tt.side, EntryPrice: 100, Quantity: 2, Status: "open"})
+
+			closed, err := engine.checkAndExecuteSLTP(context.Background(), testPair, pairConfig, &position, tt.price, nil)
+			if err != nil || !closed {
+				t.Fatalf("checkAndExecuteSLTP() = %v, %v; want the stop loss closing", closed, err)
+			}
+
+			if got := repo.Positions()[0].RealizedPnL; !approxEqual(got, tt.want) {
+				t.Errorf("realized PnL = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitsBookPnLNetOfFees(t *testing.T) {
+	tests := []struct {
+		name       string
+		pairConfig models.TradingConfig
+		takerRate  float64 // Cached exchange taker rate; 0 estimates at the configured 0.1%
+		price      float64
+		signal     bool // Close on a sell signal rather than through the exits
+		wantPnL    float64
+		wantFees   float64
+	}{
+		{
+			name:       "take profit",
+			pairConfig: models.TradingConfig{StopLossPercent: 0.05, TakeProfitPercent: 0.1},
+			price:      110,
+			wantPnL:    19.58, // 20 gross less 0.2 entry and 0.22 exit fees
+			wantFees:   0.42,
+		},
+		{
+			name:       "take profit at the exchange's taker rate",
+			pairConfig: models.TradingConfig{StopLossPercent: 0.05, TakeProfitPercent: 0.1},
+			takerRate:  0.002,
+			price:      110,
+			wantPnL:    19.16,
+			wantFees:   0.84,
+		},
+		{
+			name:       "fees flip a marginal take profit into a loss",
+			pairConfig: models.TradingConfig{StopLossPercent: 0.05, TakeProfitPercent: 0.001},
+			price:      100.12,
+			wantPnL:    -0.16024, // 0.24 gross against 0.40024 of fees
+			wantFees:   0.40024,
+		},
+		{
+			name:     "fees flip a marginal sell signal into a loss",
+			signal:   true,
+			price:    100.15,
+			wantPnL:  -0.1003, // 0.3 gross against 0.4003 of fees
+			wantFees: 0.4003,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			config := testEngineConfig()
+			config.ExitFeeRate = 0.001
+			repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+			if tt.takerRate > 0 {
+				ex.fees[testSymbol] = exchange.FeeRates{Maker: tt.takerRate, Taker: tt.takerRate}
+			}
+			engine := newTestEngine(repo, ex, config)
+			position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 100, Quantity: 2, Status: "open"})
+
+			if tt.signal {
+				if err := engine.executeSellOrder(ctx, testPair, position, tt.price); err != nil {
+					t.Fatalf("executeSellOrder() error = %v", err)
+				}
+			} else if closed, err := engine.checkAndExecuteSLTP(ctx, testPair, tt.pairConfig, &position, tt.price, nil); err != nil || !closed {
+				t.Fatalf("checkAndExecuteSLTP() = %v, %v; want the take profit closing", closed, err)
+			}
+
+			closed := repo.Positions()[0]
+			if closed.Status != "closed" || !approxEqual(closed.RealizedPnL, tt.wantPnL) || !approxEqual(closed.TotalFees, tt.wantFees) {
+				t.Errorf("position %s with PnL %v and fees %v, want closed with %v and %v", closed.Status, closed.RealizedPnL, closed.TotalFees, tt.wantPnL, tt.wantFees)
+			}
+		})
+	}
+}
@@ -1 +1,67 @@
 package trader
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// PortfolioSnapshot aggregates all open positions in USDT
+type PortfolioSnapshot struct {
+	OpenPositions int
+	UnrealizedPnL float64
+	Exposure      float64 // Gross market value at the positions' current prices
+}
+
+// AggregatePortfolio sums the open positions into one snapshot. rates maps
+// pair IDs to the USDT rate of their quote currency; pairs missing from it
+// are taken as quoted in USDT.
+func AggregatePortfolio(positions []models.Position, rates map[int64]float64) PortfolioSnapshot {
+	var snapshot PortfolioSnapshot
+	for _, position := range positions {
+		rate := rateFor(rates, position.PairID)
+		snapshot.OpenPositions++
+		snapshot.UnrealizedPnL += position.UnrealizedPnL * rate
+		snapshot.Exposure += math.Abs(signedValue(position, position.CurrentPrice)) * rate
+	}
+	return snapshot
+}
+
+// portfolioGauges serializes updates of the portfolio gauges, so a reader
+// never sees values from two different snapshots mixed
+var portfolioGauges sync.Mutex
+
+// publishPortfolioMetrics sets the account's portfolio gauges from its stored
+// open positions, the same state every other reader of positions sees
+func (e *Engine) publishPortfolioMetrics(ctx context.Context) error {
+	positions, err := e.repo.GetAllOpenPositions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get open positions: %w", err)
+	}
+
+	pairs, err := e.repo.GetActiveSelectedPairs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get selected pairs: %w", err)
+	}
+	symbols := make(map[int64]string, len(pairs))
+	for _, pair := range pairs {
+		symbols[pair.ID] = pair.Symbol
+	}
+	rates, _ := usdtRates(ctx, e.quoteRates, symbols)
+
+	snapshot := AggregatePortfolio(positions, rates)
+
+	portfolioGauges.Lock()
+	defer portfolioGauges.Unlock()
+
+	account := e.repo.Account()
+	metrics.PortfolioOpenPositions.WithLabelValues(account).Set(float64(snapshot.OpenPositions))
+	metrics.PortfolioUnrealizedPnL.WithLabelValues(account).Set(snapshot.UnrealizedPnL)
+	metrics.PortfolioExposure.WithLabelValues(account).Set(snapshot.Exposure)
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package trader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAggregatePortfolio(t *testing.T) {
+	positions := []models.Position{
+		{PairID: 1, Side: "buy", Quantity: 2, EntryPrice: 100, CurrentPrice: 110, UnrealizedPnL: 20},
+		{PairID: 2, Side: "sell", Quantity: 1, EntryPrice: 60, CurrentPrice: 50, UnrealizedPnL: 10},
+		// Quoted in a currency worth half a USDT
+		{PairID: 3, Side: "buy", Quantity: 10, EntryPrice: 10, CurrentPrice: 8, UnrealizedPnL: -20},
+	}
+
+	snapshot := AggregatePortfolio(positions, map[int64]float64{3: 0.5})
+
+	if snapshot.OpenPositions != 3 {
+		t.Errorf("open positions = %d, want 3", snapshot.OpenPositions)
+	}
+	if !approxEqual(snapshot.UnrealizedPnL, 20) {
+		t.Errorf("unrealized PnL = %v, want 20", snapshot.UnrealizedPnL)
+	}
+	// 220 long, 50 short counted gross and 80 converted to 40
+	if !approxEqual(snapshot.Exposure, 310) {
+		t.Errorf("exposure = %v, want 310", snapshot.Exposure)
+	}
+}
+
+func TestPortfolioGaugesMatchOpenPositions(t *testing.T) {
+	ctx := context.Background()
+	const account = "portfolio-gauges"
+	repo := NewMockDatabaseRepository(account)
+	config := testEngineConfig()
+	config.PortfolioMetrics = true
+	engine := newTestEngine(repo, NewMockExchange(), config)
+
+	repo.AddPosition(models.Position{PairID: 1, Side: "buy", Quantity: 2, EntryPrice: 100, CurrentPrice: 110, UnrealizedPnL: 20, Status: "open"})
+	short := repo.AddPosition(models.Position{PairID: 2, Side: "sell", Quantity: 1, EntryPrice: 60, CurrentPrice: 50, UnrealizedPnL: 10, Status: "open"})
+	repo.AddPosition(models.Position{PairID: 3, Side: "buy", Quantity: 5, EntryPrice: 10, CurrentPrice: 12, RealizedPnL: 10, Status: "closed"})
+
+	assertGauges := func(stage string, open, pnl, exposure float64) {
+		t.Helper()
+		if got := testutil.ToFloat64(metrics.PortfolioOpenPositions.WithLabelValues(account)); got != open {
+			t.Errorf("%s: open positions gauge = %v, want %v", stage, got, open)
+		}
+		if got := testutil.ToFloat64(metrics.PortfolioUnrealizedPnL.WithLabelValues(account)); !approxEqual(got, pnl) {
+			t.Errorf("%s: unrealized PnL gauge = %v, want %v", stage, got, pnl)
+		}
+		if got := testutil.ToFloat64(metrics.PortfolioExposure.WithLabelValues(account)); !approxEqual(got, exposure) {
+			t.Errorf("%s: exposure gauge = %v, want %v", stage, got, exposure)
+		}
+	}
+
+	if err := engine.processTradingCycle(ctx); err != nil {
+		t.Fatalf("processTradingCycle() error = %v", err)
+	}
+	assertGauges("two open positions", 2, 30, 270)
+
+	// Closing a position is reflected on the next cycle, not left behind
+	repo.mu.Lock()
+	for _, position := range repo.positions {
+		if position.ID == short.ID {
+			position.Status = "closed"
+		}
+	}
+	repo.mu.Unlock()
+
+	if err := engine.processTradingCycle(ctx); err != nil {
+		t.Fatalf("processTradingCycle() error = %v", err)
+	}
+	assertGauges("after closing the short", 1, 20, 220)
+}
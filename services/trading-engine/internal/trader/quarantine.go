@@ -0,0 +1,102 @@
+package trader
+
+import (
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// configFailure is the creation failure history of one pair
+type configFailure struct {
+	count       int
+	retryAt     time.Time
+	quarantined bool
+}
+
+// ConfigQuarantine backs off pairs whose trading config cannot be created.
+// Repeated failures usually mean bad pair data or a schema problem that
+// retrying every cycle will not fix, so each failure doubles the wait before
+// the next attempt and, past a threshold, the pair is quarantined: an alert
+// is raised once and attempts continue at the longest delay until one
+// succeeds. Only used from the trading cycle, so it is not synchronized.
+type ConfigQuarantine struct {
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	threshold int // Consecutive failures that quarantine the pair
+	logger    *logrus.Logger
+
+	failures map[int64]*configFailure
+}
+
+func NewConfigQuarantine(baseDelay, maxDelay time.Duration, threshold int, logger *logrus.Logger) *ConfigQuarantine {
+	if maxDelay < baseDelay {
+		maxDelay = baseDelay
+	}
+
+	return &ConfigQuarantine{
+		baseDelay: baseDelay,
+		maxDelay:  maxDelay,
+		threshold: threshold,
+		logger:    logger,
+		failures:  make(map[int64]*configFailure),
+	}
+}
+
+// Ready reports whether config creation may be attempted for the pair
+func (q *ConfigQuarantine) Ready(pairID int64) bool {
+	failure, ok := q.failures[pairID]
+	return !ok || !time.Now().Before(failure.retryAt)
+}
+
+// Failed records a creation failure and schedules the next attempt
+func (q *ConfigQuarantine) Failed(pair models.SelectedPair, err error) {
+	failure, ok := q.failures[pair.ID]
+	if !ok {
+		failure = &configFailure{}
+		q.failures[pair.ID] = failure
+	}
+	failure.count++
+
+	delay := q.baseDelay
+	for i := 1; i < failure.count && delay < q.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > q.maxDelay {
+		delay = q.maxDelay
+	}
+	failure.retryAt = time.Now().Add(delay)
+
+	fields := logrus.Fields{
+		"symbol":   pair.Symbol,
+		"failures": failure.count,
+		"retry_at": failure.retryAt,
+	}
+
+	if q.threshold > 0 && failure.count >= q.threshold && !failure.quarantined {
+		failure.quarantined = true
+		metrics.QuarantinedPairs.WithLabelValues(pair.Symbol).Set(1)
+		q.logger.WithError(err).WithFields(fields).Error("Trading config creation keeps failing, pair quarantined")
+		return
+	}
+
+	q.logger.WithError(err).WithFields(fields).Warn("Failed to create trading config, backing off")
+}
+
+// Succeeded clears the pair's failure history and lifts any quarantine
+func (q *ConfigQuarantine) Succeeded(pair models.SelectedPair) {
+	failure, ok := q.failures[pair.ID]
+	if !ok {
+		return
+	}
+	delete(q.failures, pair.ID)
+
+	if failure.quarantined {
+		metrics.QuarantinedPairs.WithLabelValues(pair.Symbol).Set(0)
+		q.logger.WithFields(logrus.Fields{
+			"symbol":   pair.Symbol,
+			"failures": failure.count,
+		}).Info("Trading config created, pair released from quarantine")
+	}
+}
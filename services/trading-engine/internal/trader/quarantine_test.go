@@ -0,0 +1,111 @@
+package trader
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestConfigQuarantineBackoffDoublesToMax(t *testing.T) {
+	quarantine := NewConfigQuarantine(time.Minute, 4*time.Minute, 0, utils.NewDiscardLogger())
+	pair := testPair
+	pair.Symbol = "BACKOFF-USDT"
+
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute} {
+		quarantine.Failed(pair, errors.New("insert failed"))
+
+		delay := time.Until(quarantine.failures[pair.ID].retryAt)
+		if delay > want || delay < want-time.Second {
+			t.Errorf("failure %d: retry in %v, want %v", i+1, delay, want)
+		}
+		if quarantine.Ready(pair.ID) {
+			t.Errorf("failure %d: ready before the backoff elapsed", i+1)
+		}
+	}
+
+	quarantine.Succeeded(pair)
+	if !quarantine.Ready(pair.ID) {
+		t.Error("not ready after a success, want the history cleared")
+	}
+}
+
+func TestRepeatedConfigCreationFailuresQuarantine(t *testing.T) {
+	repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+	repo.createConfigErr = errors.New(`column "sizing_mode" does not exist`)
+
+	pair := testPair
+	pair.Symbol = "QUARANTINE-USDT"
+	repo.quotes[pair.Symbol] = 100
+
+	config := testEngineConfig()
+	config.ConfigRetryDelay = time.Hour
+	config.ConfigRetryMaxDelay = 4 * time.Hour
+	config.ConfigQuarantineAfter = 3
+	engine := newTestEngine(repo, ex, config)
+	logger, hook := test.NewNullLogger()
+	engine.configs.logger = logger
+	quarantined := metrics.QuarantinedPairs.WithLabelValues(pair.Symbol)
+
+	// expireBackoff stands in for the backoff elapsing
+	expireBackoff := func() {
+		engine.configs.failures[pair.ID].retryAt = time.Now().Add(-time.Second)
+	}
+	process := func() {
+		t.Helper()
+		if err := engine.processPair(context.Background(), pair); err != nil {
+			t.Fatalf("processPair() error = %v, want the failure absorbed by the backoff", err)
+		}
+	}
+
+	process()
+	process() // Within the backoff: no new attempt
+	if repo.createConfigCalls != 1 {
+		t.Fatalf("attempted creation %d times within the backoff, want 1", repo.createConfigCalls)
+	}
+
+	expireBackoff()
+	process()
+	if testutil.ToFloat64(quarantined) != 0 {
+		t.Fatal("pair quarantined after 2 failures, want 3")
+	}
+
+	expireBackoff()
+	process()
+	if testutil.ToFloat64(quarantined) != 1 {
+		t.Fatal("pair not quarantined after 3 failures")
+	}
+
+	// Attempts continue at the longest delay without alerting again
+	expireBackoff()
+	process()
+	alerts := 0
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.ErrorLevel {
+			alerts++
+		}
+	}
+	if alerts != 1 {
+		t.Errorf("raised %d quarantine alerts over 4 failures, want 1", alerts)
+	}
+
+	// The fix lands: the next attempt succeeds and lifts the quarantine
+	repo.createConfigErr = nil
+	expireBackoff()
+	process()
+	if repo.createConfigCalls != 5 {
+		t.Errorf("attempted creation %d times, want 5", repo.createConfigCalls)
+	}
+	if testutil.ToFloat64(quarantined) != 0 {
+		t.Error("pair still quarantined after its config was created")
+	}
+	if _, ok := repo.configs[pair.ID]; !ok {
+		t.Error("trading config not stored after the successful attempt")
+	}
+}
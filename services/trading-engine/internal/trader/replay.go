@@ -0,0 +1,148 @@
+package trader
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// Basic strategy decisions
+const (
+	DecisionHold  = "hold"
+	DecisionEnter = "enter"
+	DecisionExit  = "exit"
+)
+
+// BasicDecision is what the basic strategy decided for a pair in one cycle
+type BasicDecision struct {
+	Action     string `json:"action"`
+	PositionID string `json:"position_id,omitempty"` // Position an exit closes
+}
+
+// DecisionRecord is one basic strategy decision with the inputs it was made
+// from, so it can be replayed against later code
+type DecisionRecord struct {
+	Account    string               `json:"account"`
+	Symbol     string               `json:"symbol"`
+	RecordedAt time.Time            `json:"recorded_at"`
+	Price      float64              `json:"price"`
+	Config     models.TradingConfig `json:"config"`
+	Signal     models.Signal        `json:"signal"` // Indicator values are in its metadata
+	Positions  []models.Position    `json:"positions"`
+	Decision   BasicDecision        `json:"decision"`
+}
+
+// decideBasic is the basic strategy's decision, free of side effects: enter
+// on a buy signal while below the pair's position limit, close the first
+// profitable long on a sell signal, otherwise hold. Exit confirmation on a
+// higher timeframe is applied by the caller and not part of the decision.
+func decideBasic(config models.TradingConfig, signal models.Signal, positions []models.Position) BasicDecision {
+	switch signal.Action {
+	case "BUY":
+		if len(positions) < config.MaxPositions {
+			return BasicDecision{Action: DecisionEnter}
+		}
+	case "SELL":
+		for _, position := range positions {
+			if position.Side == "buy" && position.UnrealizedPnL > 0 {
+				return BasicDecision{Action: DecisionExit, PositionID: position.ID}
+			}
+		}
+	}
+
+	return BasicDecision{Action: DecisionHold}
+}
+
+// DecisionRecorder appends decision records to a file as JSON lines. A nil
+// recorder records nothing.
+type DecisionRecorder struct {
+	mu     sync.Mutex
+	file   *os.File
+	enc    *json.Encoder
+	logger *logrus.Logger
+}
+
+func NewDecisionRecorder(path string, logger *logrus.Logger) (*DecisionRecorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open decision record file: %w", err)
+	}
+
+	return &DecisionRecorder{
+		file:   file,
+		enc:    json.NewEncoder(file),
+		logger: logger,
+	}, nil
+}
+
+// Record appends the record. A failed write is only logged: recording must
+// never hold up trading.
+func (r *DecisionRecorder) Record(record DecisionRecord) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.enc.Encode(record); err != nil {
+		r.logger.WithError(err).WithField("symbol", record.Symbol).Warn("Failed to record decision")
+	}
+}
+
+func (r *DecisionRecorder) Close() error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.file.Close()
+}
+
+// DecisionDiff is a recorded decision the current code decides differently
+type DecisionDiff struct {
+	Line     int // Line of the record in the input
+	Record   DecisionRecord
+	Replayed BasicDecision
+}
+
+// ReplayDecisions decides every recorded input again with the current code
+// and returns the records whose decision changed, along with the number of
+// records replayed
+func ReplayDecisions(input io.Reader) ([]DecisionDiff, int, error) {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var diffs []DecisionDiff
+	replayed := 0
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record DecisionRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, replayed, fmt.Errorf("failed to decode decision record on line %d: %w", line, err)
+		}
+		replayed++
+
+		decision := decideBasic(record.Config, record.Signal, record.Positions)
+		if decision != record.Decision {
+			diffs = append(diffs, DecisionDiff{Line: line, Record: record, Replayed: decision})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, replayed, fmt.Errorf("failed to read decision records: %w", err)
+	}
+	return diffs, replayed, nil
+}
@@ -0,0 +1,111 @@
+package trader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+func TestDecideBasic(t *testing.T) {
+	config := models.TradingConfig{MaxPositions: 2}
+	losing := models.Position{ID: "losing", Side: "buy", UnrealizedPnL: -1}
+	winning := models.Position{ID: "winning", Side: "buy", UnrealizedPnL: 2}
+	short := models.Position{ID: "short", Side: "sell", UnrealizedPnL: 3}
+
+	tests := []struct {
+		name      string
+		action    string
+		positions []models.Position
+		want      BasicDecision
+	}{
+		{name: "buy below the limit enters", action: "BUY", positions: []models.Position{losing}, want: BasicDecision{Action: DecisionEnter}},
+		{name: "buy at the limit holds", action: "BUY", positions: []models.Position{losing, winning}, want: BasicDecision{Action: DecisionHold}},
+		{name: "sell closes the profitable long", action: "SELL", positions: []models.Position{short, losing, winning}, want: BasicDecision{Action: DecisionExit, PositionID: "winning"}},
+		{name: "sell with only losing longs holds", action: "SELL", positions: []models.Position{losing}, want: BasicDecision{Action: DecisionHold}},
+		{name: "hold signal holds", action: "HOLD", want: BasicDecision{Action: DecisionHold}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decideBasic(config, models.Signal{Action: tt.action}, tt.positions); got != tt.want {
+				t.Errorf("decideBasic() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordedScenarioReplaysIdentically(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	recorder, err := NewDecisionRecorder(path, utils.NewDiscardLogger())
+	if err != nil {
+		t.Fatalf("NewDecisionRecorder() error = %v", err)
+	}
+
+	repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+	seedSellOff(repo)
+	engine := newTestEngine(repo, ex, testEngineConfig())
+	engine.decisions = recorder
+
+	for i := 0; i < 3; i++ {
+		if err := engine.processPair(context.Background(), testPair); err != nil {
+			t.Fatalf("processPair() error = %v", err)
+		}
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open the records: %v", err)
+	}
+	defer file.Close()
+
+	diffs, replayed, err := ReplayDecisions(file)
+	if err != nil {
+		t.Fatalf("ReplayDecisions() error = %v", err)
+	}
+	if replayed != 3 || len(diffs) != 0 {
+		t.Errorf("replayed %d records with %d diffs, want 3 reproduced identically", replayed, len(diffs))
+	}
+}
+
+func TestReplayReportsChangedDecisions(t *testing.T) {
+	position := models.Position{ID: "position-1", Side: "buy", UnrealizedPnL: 5}
+	records := []DecisionRecord{
+		{Symbol: testSymbol, Config: models.TradingConfig{MaxPositions: 2}, Signal: models.Signal{Action: "BUY"}, Decision: BasicDecision{Action: DecisionEnter}},
+		// Recorded by code that held profitable longs through a sell signal
+		{Symbol: testSymbol, Config: models.TradingConfig{MaxPositions: 2}, Signal: models.Signal{Action: "SELL"}, Positions: []models.Position{position}, Decision: BasicDecision{Action: DecisionHold}},
+	}
+
+	var input bytes.Buffer
+	for _, record := range records {
+		if err := json.NewEncoder(&input).Encode(record); err != nil {
+			t.Fatalf("failed to encode record: %v", err)
+		}
+		input.WriteString("\n")
+	}
+
+	diffs, replayed, err := ReplayDecisions(&input)
+	if err != nil {
+		t.Fatalf("ReplayDecisions() error = %v", err)
+	}
+	if replayed != 2 || len(diffs) != 1 {
+		t.Fatalf("replayed %d records with %d diffs, want 2 with 1", replayed, len(diffs))
+	}
+	diff := diffs[0]
+	if diff.Line != 3 || diff.Record.Decision.Action != DecisionHold || diff.Replayed != (BasicDecision{Action: DecisionExit, PositionID: "position-1"}) {
+		t.Errorf("diff = line %d, recorded %+v, replayed %+v; want line 3 now exiting position-1", diff.Line, diff.Record.Decision, diff.Replayed)
+	}
+
+	if _, _, err := ReplayDecisions(strings.NewReader("{not json}\n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("ReplayDecisions() error = %v, want one naming line 1", err)
+	}
+}
@@ -1,31 +1,309 @@
 package trader
 
 import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/quotes"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/database"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/signals"
 	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
 	"github.com/sirupsen/logrus"
 )
 
 type RiskManager struct {
-	config EngineConfig
-	logger *logrus.Logger
+	repo       database.RepositoryInterface
+	quoteRates *quotes.Converter
+	config     EngineConfig
+	clock      signals.Clock // Halts are timed and loss windows measured from it
+	logger     *logrus.Logger
+
+	mu                          sync.RWMutex
+	portfolioTradingHaltedUntil time.Time
+	portfolioHaltReason         string
+	pairFlashCrashHaltedUntil   map[int64]time.Time
+	betas                       betaBook // Zero until the first UpdatePortfolioBeta
 }
 
-func NewRiskManager(config EngineConfig, logger *logrus.Logger) *RiskManager {
+func NewRiskManager(repo database.RepositoryInterface, quoteRates *quotes.Converter, config EngineConfig, logger *logrus.Logger) *RiskManager {
 	return &RiskManager{
-		config: config,
-		logger: logger,
+		repo:       repo,
+		quoteRates: quoteRates,
+		config:     config,
+		clock:      signals.RealClock{},
+		logger:     logger,
+
+		pairFlashCrashHaltedUntil: make(map[int64]time.Time),
 	}
 }
 
-func (r *RiskManager) CanTrade(pair models.SelectedPair, positions []models.Position, currentPrice float64) bool {
+// CheckLossVelocity halts new entries across the portfolio when realized losses
+// within the configured rolling window exceed the threshold. A burst of
+// stop-outs usually means the strategy is misfiring in current conditions, so
+// trading pauses for the cooldown even if the daily limits are not reached.
+// Only losing closes count: a winner in the same window does not mask them.
+// Losses realized before a previous portfolio halt ended were already acted
+// on, so the window never reaches back past it.
+func (r *RiskManager) CheckLossVelocity(ctx context.Context) error {
+	if r.config.LossVelocityMaxLossUSDT <= 0 || r.config.LossVelocityWindow <= 0 {
+		return nil
+	}
+
+	if r.IsPortfolioHalted() {
+		return nil
+	}
+
+	since := r.clock.Now().Add(-r.config.LossVelocityWindow)
+	r.mu.RLock()
+	if r.portfolioTradingHaltedUntil.After(since) {
+		since = r.portfolioTradingHaltedUntil
+	}
+	r.mu.RUnlock()
+
+	loss, err := r.repo.GetRecentRealizedLoss(ctx, since)
+	if err != nil {
+		return fmt.Errorf("failed to check loss velocity: %w", err)
+	}
+
+	if loss < r.config.LossVelocityMaxLossUSDT {
+		return nil
+	}
+
+	haltedUntil := r.clock.Now().Add(r.config.LossVelocityCooldown)
+	r.haltPortfolio(ctx, haltedUntil, "loss velocity")
+
+	r.logger.WithFields(logrus.Fields{
+		"realized_loss": loss,
+		"window":        r.config.LossVelocityWindow,
+		"max_loss_usdt": r.config.LossVelocityMaxLossUSDT,
+		"halted_until":  haltedUntil,
+	}).Warn("Loss velocity breaker tripped, halting new entries")
+
+	return nil
+}
+
+// CheckDailyLossLimit halts new entries across the portfolio until the next
+// UTC midnight once the net realized loss since the last one reaches the
+// daily limit. Exits continue; the halt only lapses with the day.
+func (r *RiskManager) CheckDailyLossLimit(ctx context.Context) error {
+	if r.config.DailyMaxLossUSDT <= 0 {
+		return nil
+	}
+
+	if r.IsPortfolioHalted() {
+		return nil
+	}
+
+	dayStart := r.clock.Now().UTC().Truncate(24 * time.Hour)
+	pnl, err := r.repo.GetRecentRealizedPnL(ctx, dayStart)
+	if err != nil {
+		return fmt.Errorf("failed to check daily loss: %w", err)
+	}
+
+	if -pnl < r.config.DailyMaxLossUSDT {
+		return nil
+	}
+
+	haltedUntil := dayStart.Add(24 * time.Hour)
+	r.haltPortfolio(ctx, haltedUntil, "daily loss")
+
+	r.logger.WithFields(logrus.Fields{
+		"realized_pnl":  pnl,
+		"max_loss_usdt": r.config.DailyMaxLossUSDT,
+		"halted_until":  haltedUntil,
+	}).Warn("Daily loss limit reached, halting new entries until UTC midnight")
+
+	return nil
+}
+
+// CheckFlashCrash halts new entries on a pair whose price fell from the
+// highest high within the configured window by more than the threshold.
+// Entries resume after the cooldown. Protective exits always continue in the
+// meantime; whether discretionary closes do is up to the caller, see
+// EngineConfig.FlashCrashAllowExits.
+func (r *RiskManager) CheckFlashCrash(ctx context.Context, pair models.SelectedPair, currentPrice float64) error {
+	if r.config.FlashCrashDropPercent <= 0 || r.config.FlashCrashWindow <= 0 || currentPrice <= 0 {
+		return nil
+	}
+
+	if r.IsPairHalted(pair.ID) {
+		return nil
+	}
+
+	candles, err := r.repo.GetPriceHistory(ctx, pair.Symbol, r.clock.Now().Add(-r.config.FlashCrashWindow))
+	if err != nil {
+		return fmt.Errorf("failed to check flash crash: %w", err)
+	}
+
+	high := currentPrice
+	for _, candle := range candles {
+		if candle.High > high {
+			high = candle.High
+		}
+	}
+
+	drop := (high - currentPrice) / high
+	if drop < r.config.FlashCrashDropPercent {
+		return nil
+	}
+
+	haltedUntil := r.clock.Now().Add(r.config.FlashCrashCooldown)
+	r.mu.Lock()
+	r.pairFlashCrashHaltedUntil[pair.ID] = haltedUntil
+	r.mu.Unlock()
+
+	r.persistHalt(ctx, models.RiskHalt{
+		Scope:       models.HaltScopePair,
+		PairID:      pair.ID,
+		Reason:      "flash crash",
+		HaltedUntil: haltedUntil,
+	})
+
+	r.logger.WithFields(logrus.Fields{
+		"symbol":        pair.Symbol,
+		"window_high":   high,
+		"current_price": currentPrice,
+		"drop":          drop,
+		"halted_until":  haltedUntil,
+	}).Warn("Flash crash breaker tripped, halting new entries on pair")
+
+	return nil
+}
+
+// IsPairHalted reports whether a pair-level breaker is in effect
+func (r *RiskManager) IsPairHalted(pairID int64) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.clock.Now().Before(r.pairFlashCrashHaltedUntil[pairID])
+}
+
+// IsPortfolioHalted reports whether a portfolio-wide breaker is in effect
+func (r *RiskManager) IsPortfolioHalted() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.clock.Now().Before(r.portfolioTradingHaltedUntil)
+}
+
+func (r *RiskManager) haltPortfolio(ctx context.Context, until time.Time, reason string) {
+	r.mu.Lock()
+	if until.After(r.portfolioTradingHaltedUntil) {
+		r.portfolioTradingHaltedUntil = until
+		r.portfolioHaltReason = reason
+	}
+	r.mu.Unlock()
+
+	r.persistHalt(ctx, models.RiskHalt{
+		Scope:       models.HaltScopePortfolio,
+		Reason:      reason,
+		HaltedUntil: until,
+	})
+}
+
+// persistHalt stores a halt so it outlasts a restart. A failed write is only
+// logged: the halt is already in effect for this process.
+func (r *RiskManager) persistHalt(ctx context.Context, halt models.RiskHalt) {
+	if !r.config.PersistHalts {
+		return
+	}
+
+	if err := r.repo.SaveRiskHalt(ctx, halt); err != nil {
+		r.logger.WithError(err).WithFields(logrus.Fields{
+			"scope":        halt.Scope,
+			"pair_id":      halt.PairID,
+			"halted_until": halt.HaltedUntil,
+		}).Error("Failed to persist risk halt, it will not survive a restart")
+	}
+}
+
+// LoadHalts restores the halts still in effect from before a restart
+func (r *RiskManager) LoadHalts(ctx context.Context) error {
+	if !r.config.PersistHalts {
+		return nil
+	}
+
+	halts, err := r.repo.GetActiveRiskHalts(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, halt := range halts {
+		switch halt.Scope {
+		case models.HaltScopePortfolio:
+			if halt.HaltedUntil.After(r.portfolioTradingHaltedUntil) {
+				r.portfolioTradingHaltedUntil = halt.HaltedUntil
+				r.portfolioHaltReason = halt.Reason
+			}
+		case models.HaltScopePair:
+			if halt.HaltedUntil.After(r.pairFlashCrashHaltedUntil[halt.PairID]) {
+				r.pairFlashCrashHaltedUntil[halt.PairID] = halt.HaltedUntil
+			}
+		default:
+			continue
+		}
+
+		r.logger.WithFields(logrus.Fields{
+			"scope":        halt.Scope,
+			"pair_id":      halt.PairID,
+			"reason":       halt.Reason,
+			"halted_until": halt.HaltedUntil,
+		}).Warn("Restored risk halt from before restart")
+	}
+
+	return nil
+}
+
+// CanTrade reports whether a new entry may be opened on the pair. Breakers
+// and limits only gate entries; callers keep closing positions regardless.
+func (r *RiskManager) CanTrade(ctx context.Context, pair models.SelectedPair, positions []models.Position, currentPrice float64) bool {
+	// Check portfolio-wide circuit breakers
+	if r.IsPortfolioHalted() {
+		r.mu.RLock()
+		r.logger.WithFields(logrus.Fields{
+			"symbol":       pair.Symbol,
+			"reason":       r.portfolioHaltReason,
+			"halted_until": r.portfolioTradingHaltedUntil,
+		}).Debug("Portfolio trading halted")
+		r.mu.RUnlock()
+		return false
+	}
+
+	// Check pair-level circuit breakers
+	if r.IsPairHalted(pair.ID) {
+		r.mu.RLock()
+		r.logger.WithFields(logrus.Fields{
+			"symbol":       pair.Symbol,
+			"reason":       "flash crash",
+			"halted_until": r.pairFlashCrashHaltedUntil[pair.ID],
+		}).Debug("Pair trading halted")
+		r.mu.RUnlock()
+		return false
+	}
+
 	// Check maximum positions per pair
 	if len(positions) >= r.config.MaxPositionsPerPair {
 		r.logger.WithField("symbol", pair.Symbol).Debug("Maximum positions reached")
 		return false
 	}
 
-	// Check total exposure
-	totalExposure := r.calculateTotalExposure(positions, currentPrice)
+	// Check total exposure, valued in USDT like the limit
+	quote := quotes.QuoteCurrency(pair.Symbol)
+	totalExposure, rate, ok := r.quoteRates.ToUSDT(ctx, quote, r.calculateTotalExposure(positions, currentPrice))
+	if !ok && r.config.BlockOnStaleQuoteRate {
+		r.logger.WithFields(logrus.Fields{
+			"symbol":  pair.Symbol,
+			"quote":   quote,
+			"missing": rate.Missing,
+		}).Warn("Quote rate is not fresh, blocking entries")
+		return false
+	}
 	maxExposure := float64(r.config.MaxPositionsPerPair) * r.config.DefaultPositionSize
 
 	if totalExposure > maxExposure {
@@ -37,6 +315,11 @@ func (r *RiskManager) CanTrade(pair models.SelectedPair, positions []models.Posi
 		return false
 	}
 
+	// Check the portfolio's beta to the reference symbol
+	if !r.withinBetaLimit(pair) {
+		return false
+	}
+
 	// Check for stop loss conditions
 	for _, position := range positions {
 		if r.shouldStopLoss(position, currentPrice) {
@@ -54,7 +337,46 @@ func (r *RiskManager) CanTrade(pair models.SelectedPair, positions []models.Posi
 	return true
 }
 
+// MeetsRiskReward reports whether the pair's stop loss and first take profit
+// level reward at least the configured multiple of the risk. An entry without
+// a stop loss has unbounded risk and never qualifies.
+func (r *RiskManager) MeetsRiskReward(pair models.SelectedPair, config models.TradingConfig) bool {
+	if r.config.MinRiskReward <= 0 {
+		return true
+	}
+
+	riskReward := 0.0
+	if config.StopLossPercent > 0 {
+		riskReward = config.TakeProfitPercent / config.StopLossPercent
+	}
+	if riskReward >= r.config.MinRiskReward {
+		return true
+	}
+
+	r.logger.WithFields(logrus.Fields{
+		"symbol":          pair.Symbol,
+		"stop_loss":       config.StopLossPercent,
+		"take_profit":     config.TakeProfitPercent,
+		"risk_reward":     riskReward,
+		"min_risk_reward": r.config.MinRiskReward,
+	}).Info("Entry skipped, risk-reward below the minimum")
+
+	return false
+}
+
+// calculateTotalExposure values the open positions of one pair. In net mode
+// longs and shorts on the pair offset each other fully.
 func (r *RiskManager) calculateTotalExposure(positions []models.Position, currentPrice float64) float64 {
+	if r.config.ExposureMode == ExposureNet {
+		net := 0.0
+		for _, position := range positions {
+			if position.Status == "open" {
+				net += signedValue(position, currentPrice)
+			}
+		}
+		return math.Abs(net)
+	}
+
 	totalExposure := 0.0
 
 	for _, position := range positions {
@@ -0,0 +1,395 @@
+package trader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// closedPosition is a position closed at the given time with the given PnL
+func closedPosition(pnl float64, closedAt time.Time) models.Position {
+	return models.Position{PairID: 1, Side: "buy", Status: "closed", RealizedPnL: pnl, ClosedAt: &closedAt}
+}
+
+func lossVelocityConfig(cooldown time.Duration) EngineConfig {
+	return EngineConfig{
+		LossVelocityMaxLossUSDT: 50,
+		LossVelocityWindow:      10 * time.Minute,
+		LossVelocityCooldown:    cooldown,
+	}
+}
+
+func TestLossVelocity(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		closes     []models.Position
+		wantHalted bool
+	}{
+		{
+			name: "burst of stop-outs trips the breaker",
+			closes: []models.Position{
+				closedPosition(-15, now.Add(-8*time.Minute)),
+				closedPosition(-12, now.Add(-6*time.Minute)),
+				closedPosition(-14, now.Add(-3*time.Minute)),
+				closedPosition(-11, now.Add(-time.Minute)),
+			},
+			wantHalted: true,
+		},
+		{
+			name: "a winner does not mask the losses",
+			closes: []models.Position{
+				closedPosition(-30, now.Add(-5*time.Minute)),
+				closedPosition(-25, now.Add(-2*time.Minute)),
+				closedPosition(80, now.Add(-time.Minute)),
+			},
+			wantHalted: true,
+		},
+		{
+			name: "losses below the threshold",
+			closes: []models.Position{
+				closedPosition(-20, now.Add(-5*time.Minute)),
+				closedPosition(-20, now.Add(-2*time.Minute)),
+			},
+			wantHalted: false,
+		},
+		{
+			name: "losses outside the window",
+			closes: []models.Position{
+				closedPosition(-40, now.Add(-30*time.Minute)),
+				closedPosition(-40, now.Add(-20*time.Minute)),
+			},
+			wantHalted: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockDatabaseRepository("main")
+			for _, position := range tt.closes {
+				repo.AddPosition(position)
+			}
+			risk := NewRiskManager(repo, nil, lossVelocityConfig(time.Hour), utils.NewDiscardLogger())
+
+			if err := risk.CheckLossVelocity(context.Background()); err != nil {
+				t.Fatalf("CheckLossVelocity() error = %v", err)
+			}
+			if got := risk.IsPortfolioHalted(); got != tt.wantHalted {
+				t.Fatalf("IsPortfolioHalted() = %v, want %v", got, tt.wantHalted)
+			}
+			if tt.wantHalted && risk.CanTrade(context.Background(), models.SelectedPair{ID: 1, Symbol: "BTC-USDT"}, nil, 100) {
+				t.Error("CanTrade() = true while the loss velocity breaker is in effect")
+			}
+		})
+	}
+}
+
+// manualClock is a clock tests move forward by hand
+type manualClock struct {
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	return c.now
+}
+
+func (c *manualClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestLossVelocityRecoversAfterCooldown(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	repo := NewMockDatabaseRepository("main")
+	repo.AddPosition(closedPosition(-60, clock.now.Add(-time.Minute)))
+
+	risk := NewRiskManager(repo, nil, lossVelocityConfig(5*time.Minute), utils.NewDiscardLogger())
+	risk.clock = clock
+
+	check := func(wantHalted bool, when string) {
+		t.Helper()
+		if err := risk.CheckLossVelocity(context.Background()); err != nil {
+			t.Fatalf("CheckLossVelocity() error = %v", err)
+		}
+		if got := risk.IsPortfolioHalted(); got != wantHalted {
+			t.Fatalf("IsPortfolioHalted() = %v %s, want %v", got, when, wantHalted)
+		}
+	}
+
+	check(true, "after a burst of losses")
+
+	// The burst is still inside the 10 minute window once the cooldown ends,
+	// but it already caused the last halt
+	clock.Advance(6 * time.Minute)
+	if risk.IsPortfolioHalted() {
+		t.Fatal("IsPortfolioHalted() = true after the cooldown, want false")
+	}
+	check(false, "with only losses from before the last halt ended")
+
+	// New losses after the halt trip the breaker again
+	repo.AddPosition(closedPosition(-55, clock.now))
+	clock.Advance(time.Minute)
+	check(true, "after a new burst of losses")
+}
+
+func TestFlashCrashHaltBlocksEntriesButNotStopLoss(t *testing.T) {
+	tests := []struct {
+		name         string
+		openPosition bool
+		wantPlaced   []string // Sides placed this cycle
+	}{
+		{name: "entry blocked during the halt", openPosition: false, wantPlaced: nil},
+		{name: "open position still stopped out", openPosition: true, wantPlaced: []string{"sell"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+			seedSellOff(repo) // Falls about 5% from the window high to a BUY signal
+
+			config := testEngineConfig()
+			config.FlashCrashDropPercent = 0.04
+			config.FlashCrashWindow = 24 * time.Hour
+			config.FlashCrashCooldown = time.Hour
+			engine := newTestEngine(repo, ex, config)
+
+			if tt.openPosition {
+				// Entered before the crash, now through its 5% stop
+				repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", Quantity: 1, EntryPrice: 105, Status: "open"})
+			}
+
+			if err := engine.processPair(context.Background(), testPair); err != nil {
+				t.Fatalf("processPair() error = %v", err)
+			}
+
+			if !engine.riskManager.IsPairHalted(testPair.ID) {
+				t.Fatal("pair not halted, want the flash crash breaker tripped")
+			}
+
+			placed := ex.Placed()
+			if len(placed) != len(tt.wantPlaced) {
+				t.Fatalf("placed %+v, want sides %v", placed, tt.wantPlaced)
+			}
+			for i, side := range tt.wantPlaced {
+				if placed[i].Side != side {
+					t.Errorf("order %d side = %s, want %s", i, placed[i].Side, side)
+				}
+			}
+
+			if tt.openPosition {
+				if got := repo.Positions()[0].Status; got != "closed" {
+					t.Errorf("position status = %s, want closed by the stop loss", got)
+				}
+			}
+			for _, position := range repo.Positions() {
+				if position.Status == "open" {
+					t.Errorf("position %s opened during the halt", position.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestHaltsSurviveRestart(t *testing.T) {
+	tests := []struct {
+		name      string
+		persist   bool
+		cooldown  time.Duration
+		wantHalts bool
+	}{
+		{name: "halts restored after a restart", persist: true, cooldown: time.Hour, wantHalts: true},
+		{name: "expired halts not restored", persist: true, cooldown: 20 * time.Millisecond},
+		{name: "halts not persisted when disabled", persist: false, cooldown: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := NewMockDatabaseRepository("main")
+			seedSellOff(repo) // Falls about 5% from the window high
+			repo.AddPosition(closedPosition(-60, time.Now().Add(-time.Minute)))
+
+			config := lossVelocityConfig(tt.cooldown)
+			config.MaxPositionsPerPair = 3
+			config.DefaultPositionSize = 100
+			config.FlashCrashDropPercent = 0.04
+			config.FlashCrashWindow = 24 * time.Hour
+			config.FlashCrashCooldown = tt.cooldown
+			config.PersistHalts = tt.persist
+
+			before := NewRiskManager(repo, nil, config, utils.NewDiscardLogger())
+			if err := before.CheckLossVelocity(ctx); err != nil {
+				t.Fatalf("CheckLossVelocity() error = %v", err)
+			}
+			if err := before.CheckFlashCrash(ctx, testPair, repo.quotes[testSymbol]); err != nil {
+				t.Fatalf("CheckFlashCrash() error = %v", err)
+			}
+			if !before.IsPortfolioHalted() || !before.IsPairHalted(testPair.ID) {
+				t.Fatal("breakers not tripped before the restart")
+			}
+			if tt.cooldown < time.Second {
+				time.Sleep(2 * tt.cooldown)
+			}
+
+			// A fresh process starts with no halts in memory
+			after := NewRiskManager(repo, nil, config, utils.NewDiscardLogger())
+			if err := after.LoadHalts(ctx); err != nil {
+				t.Fatalf("LoadHalts() error = %v", err)
+			}
+
+			if got := after.IsPortfolioHalted(); got != tt.wantHalts {
+				t.Errorf("portfolio halted after restart = %v, want %v", got, tt.wantHalts)
+			}
+			if got := after.IsPairHalted(testPair.ID); got != tt.wantHalts {
+				t.Errorf("pair halted after restart = %v, want %v", got, tt.wantHalts)
+			}
+			if got := after.CanTrade(ctx, testPair, nil, repo.quotes[testSymbol]); got == tt.wantHalts {
+				t.Errorf("CanTrade() after restart = %v, want %v", got, !tt.wantHalts)
+			}
+		})
+	}
+}
+
+func TestMeetsRiskReward(t *testing.T) {
+	tests := []struct {
+		name          string
+		minRiskReward float64
+		stopLoss      float64
+		takeProfit    float64
+		want          bool
+	}{
+		{name: "check disabled", stopLoss: 0.1, takeProfit: 0.05, want: true},
+		{name: "above the minimum", minRiskReward: 1.5, stopLoss: 0.05, takeProfit: 0.1, want: true},
+		{name: "exactly the minimum", minRiskReward: 2, stopLoss: 0.05, takeProfit: 0.1, want: true},
+		{name: "below the minimum", minRiskReward: 1.5, stopLoss: 0.05, takeProfit: 0.06},
+		{name: "negative risk-reward", minRiskReward: 1, stopLoss: 0.1, takeProfit: 0.05},
+		{name: "no stop loss", minRiskReward: 1, takeProfit: 0.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testEngineConfig()
+			config.MinRiskReward = tt.minRiskReward
+			risk := NewRiskManager(NewMockDatabaseRepository("main"), nil, config, utils.NewDiscardLogger())
+
+			got := risk.MeetsRiskReward(testPair, models.TradingConfig{StopLossPercent: tt.stopLoss, TakeProfitPercent: tt.takeProfit})
+			if got != tt.want {
+				t.Errorf("MeetsRiskReward() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntrySkippedBelowMinRiskReward(t *testing.T) {
+	// The seeded config risks 5% for 10%, a risk-reward of 2
+	for _, tt := range []struct {
+		minRiskReward float64
+		wantEntries   int
+	}{{minRiskReward: 2, wantEntries: 1}, {minRiskReward: 2.5}} {
+		repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+		seedSellOff(repo)
+		config := testEngineConfig()
+		config.MinRiskReward = tt.minRiskReward
+		engine := newTestEngine(repo, ex, config)
+
+		if err := engine.processPair(context.Background(), testPair); err != nil {
+			t.Fatalf("processPair() error = %v", err)
+		}
+		if got := len(ex.Placed()); got != tt.wantEntries {
+			t.Errorf("minimum risk-reward %v placed %d entries, want %d", tt.minRiskReward, got, tt.wantEntries)
+		}
+	}
+}
+
+func TestDailyLossLimit(t *testing.T) {
+	dayStart := time.Now().UTC().Truncate(24 * time.Hour)
+	midnight := dayStart.Add(24 * time.Hour)
+
+	tests := []struct {
+		name       string
+		limit      float64
+		closes     []models.Position
+		wantHalted bool
+	}{
+		{
+			name:       "losses today reach the limit",
+			limit:      100,
+			closes:     []models.Position{closedPosition(-60, dayStart), closedPosition(-45, dayStart)},
+			wantHalted: true,
+		},
+		{
+			name:   "a winner today nets the loss below the limit",
+			limit:  100,
+			closes: []models.Position{closedPosition(-60, dayStart), closedPosition(-45, dayStart), closedPosition(30, dayStart)},
+		},
+		{
+			name:   "losses before midnight do not count",
+			limit:  100,
+			closes: []models.Position{closedPosition(-150, dayStart.Add(-time.Minute))},
+		},
+		{
+			name:   "disabled limit",
+			closes: []models.Position{closedPosition(-500, dayStart)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockDatabaseRepository("main")
+			for _, position := range tt.closes {
+				repo.AddPosition(position)
+			}
+			risk := NewRiskManager(repo, nil, EngineConfig{DailyMaxLossUSDT: tt.limit, PersistHalts: true}, utils.NewDiscardLogger())
+
+			if err := risk.CheckDailyLossLimit(context.Background()); err != nil {
+				t.Fatalf("CheckDailyLossLimit() error = %v", err)
+			}
+			if got := risk.IsPortfolioHalted(); got != tt.wantHalted {
+				t.Fatalf("IsPortfolioHalted() = %v, want %v", got, tt.wantHalted)
+			}
+			if !tt.wantHalted {
+				return
+			}
+			if !risk.portfolioTradingHaltedUntil.Equal(midnight) || risk.portfolioHaltReason != "daily loss" {
+				t.Errorf("halted until %v for %q, want the next UTC midnight %v for the daily loss", risk.portfolioTradingHaltedUntil, risk.portfolioHaltReason, midnight)
+			}
+			if halts, _ := repo.GetActiveRiskHalts(context.Background()); len(halts) != 1 || !halts[0].HaltedUntil.Equal(midnight) {
+				t.Errorf("persisted halts = %+v, want one until midnight", halts)
+			}
+		})
+	}
+}
+
+func TestDailyLossLimitBlocksEntries(t *testing.T) {
+	tests := []struct {
+		name      string
+		loss      float64
+		wantEntry bool
+	}{
+		{name: "within the limit", loss: 50, wantEntry: true},
+		{name: "beyond the limit", loss: 150, wantEntry: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+			seedSellOff(repo)
+			repo.pairs = []models.SelectedPair{testPair}
+			repo.AddPosition(closedPosition(-tt.loss, time.Now()))
+			config := testEngineConfig()
+			config.DailyMaxLossUSDT = 100
+			engine := newTestEngine(repo, ex, config)
+
+			if err := engine.processTradingCycle(context.Background()); err != nil {
+				t.Fatalf("processTradingCycle() error = %v", err)
+			}
+
+			if entered := len(ex.Placed()) > 0; entered != tt.wantEntry {
+				t.Errorf("entered = %v on the sell-off's BUY, want %v", entered, tt.wantEntry)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package trader
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/signals"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	minVolatilityMultiplier = 0.5
+	maxVolatilityMultiplier = 2.0
+)
+
+// DepthProvider reports the quote notional resting on each side of a
+// symbol's order book within the given basis points of the mid price
+type DepthProvider interface {
+	DepthWithin(symbol string, bps float64) (float64, float64, bool)
+}
+
+// PerformanceProvider reports closed-position history: the most recently
+// closed positions, newest first, and the track record of a strategy tag
+type PerformanceProvider interface {
+	GetRecentClosedPositions(ctx context.Context, limit int) ([]models.Position, error)
+	GetStrategyTrackRecord(ctx context.Context, strategyTag string) (int, float64, error)
+}
+
+// BalanceProvider reports the amount of a currency available for trading
+type BalanceProvider interface {
+	GetAvailableBalance(currency string) (float64, error)
+}
+
+type PositionSizer struct {
+	priceHistory signals.PriceHistoryProvider
+	depth        DepthProvider // nil disables the liquidity cap
+	balances     BalanceProvider
+	performance  PerformanceProvider
+	config       EngineConfig
+	logger       *logrus.Logger
+}
+
+func NewPositionSizer(priceHistory signals.PriceHistoryProvider, depth DepthProvider, balances BalanceProvider,
+	performance PerformanceProvider, config EngineConfig, logger *logrus.Logger) *PositionSizer {
+
+	return &PositionSizer{
+		priceHistory: priceHistory,
+		depth:        depth,
+		balances:     balances,
+		performance:  performance,
+		config:       config,
+		logger:       logger,
+	}
+}
+
+// CalculatePositionSize returns the quote amount (USDT) to commit to a new
+// position, scaling the configured base size by the pair's recent volatility
+// and the strategy's recent performance and track record, and capping it by
+// the per-trade risk budget. Whatever unit the config sizes in is translated
+// to quote first, so the caps, exposure and PnL treat every mode the same
+// way. Zero means no position should be opened.
+func (p *PositionSizer) CalculatePositionSize(ctx context.Context, pair models.SelectedPair, config models.TradingConfig, price float64) float64 {
+	baseSize, err := p.baseSize(pair, config, price)
+	if err != nil {
+		p.logger.WithError(err).WithField("symbol", pair.Symbol).Warn("Failed to determine base position size")
+		return 0
+	}
+	performance := p.performanceMultiplier(ctx)
+	ramp := p.rampFraction(ctx, strategyTag(p.config, config))
+
+	volatility, err := p.currentVolatility(ctx, pair.Symbol)
+	if err != nil {
+		p.logger.WithError(err).WithField("symbol", pair.Symbol).Warn("Failed to calculate volatility for sizing, using base size")
+		return p.applyLiquidityCap(pair.Symbol, p.applyRiskCap(baseSize*performance*ramp, config))
+	}
+
+	multiplier := p.calculateVolatilityMultiplier(volatility)
+	size := p.applyLiquidityCap(pair.Symbol, p.applyRiskCap(baseSize*performance*ramp*multiplier, config))
+
+	p.logger.WithFields(logrus.Fields{
+		"symbol":                 pair.Symbol,
+		"base_size":              baseSize,
+		"volatility":             volatility,
+		"volatility_model":       p.config.SizingVolatilityModel,
+		"volatility_multiplier":  multiplier,
+		"performance_multiplier": performance,
+		"ramp_fraction":          ramp,
+		"position_size":          size,
+	}).Debug("Calculated position size")
+
+	return size
+}
+
+// baseSize converts the config's position size to a quote amount
+func (p *PositionSizer) baseSize(pair models.SelectedPair, config models.TradingConfig, price float64) (float64, error) {
+	switch config.SizingMode {
+	case models.SizingBaseQuantity:
+		if config.PositionSizeBase <= 0 {
+			return 0, fmt.Errorf("base sizing requires a positive base quantity")
+		}
+		return config.PositionSizeBase * price, nil
+
+	case models.SizingBalancePercent:
+		if config.PositionSizePercent <= 0 || config.PositionSizePercent > 1 {
+			return 0, fmt.Errorf("balance sizing requires a fraction in (0, 1], got %v", config.PositionSizePercent)
+		}
+		balance, err := p.balances.GetAvailableBalance(quoteCurrency(pair.Symbol))
+		if err != nil {
+			return 0, fmt.Errorf("failed to get quote balance: %w", err)
+		}
+		return balance * config.PositionSizePercent, nil
+
+	case models.SizingQuoteFunds, "":
+		if config.PositionSizeUSDT > 0 {
+			return config.PositionSizeUSDT, nil
+		}
+		return p.config.DefaultPositionSize, nil
+
+	default:
+		return 0, fmt.Errorf("unknown sizing mode %q", config.SizingMode)
+	}
+}
+
+func (p *PositionSizer) currentVolatility(ctx context.Context, symbol string) (float64, error) {
+	since := time.Now().Add(-p.config.SizingVolatilityWindow)
+	candles, err := p.priceHistory.GetPriceHistory(ctx, symbol, since)
+	if err != nil {
+		return 0, err
+	}
+
+	closes := make([]float64, len(candles))
+	for i, candle := range candles {
+		closes[i] = candle.Close
+	}
+
+	if p.config.SizingVolatilityModel == "simple" {
+		return utils.CalculateVolatility(closes), nil
+	}
+	return utils.CalculateEWMAVolatility(closes, p.config.SizingEWMALambda), nil
+}
+
+// calculateVolatilityMultiplier scales size inversely to volatility relative to
+// the configured target, bounded to avoid extreme positions. Without a target,
+// or without a measured volatility (too little history, an invalid decay or a
+// flat series), the size is left unscaled.
+func (p *PositionSizer) calculateVolatilityMultiplier(volatility float64) float64 {
+	if volatility <= 0 || p.config.SizingTargetVolatility <= 0 {
+		return 1
+	}
+
+	multiplier := p.config.SizingTargetVolatility / volatility
+	if multiplier < minVolatilityMultiplier {
+		return minVolatilityMultiplier
+	}
+	if multiplier > maxVolatilityMultiplier {
+		return maxVolatilityMultiplier
+	}
+	return multiplier
+}
+
+// applyRiskCap limits the size so that hitting the stop loss never loses more
+// than the configured per-trade risk
+func (p *PositionSizer) applyRiskCap(size float64, config models.TradingConfig) float64 {
+	if p.config.MaxRiskPerTradeUSDT <= 0 || config.StopLossPercent <= 0 {
+		return size
+	}
+
+	maxSize := p.config.MaxRiskPerTradeUSDT / config.StopLossPercent
+	if size > maxSize {
+		return maxSize
+	}
+	return size
+}
+
+// applyLiquidityCap limits the size to a fraction of the ask-side depth near
+// the mid price, so an entry does not walk far into a thin book. Without a
+// synchronized book the size is left unchanged.
+func (p *PositionSizer) applyLiquidityCap(symbol string, size float64) float64 {
+	if p.depth == nil || p.config.LiquidityMaxDepthFraction <= 0 {
+		return size
+	}
+
+	_, askDepth, ok := p.depth.DepthWithin(symbol, p.config.LiquidityDepthBps)
+	if !ok {
+		p.logger.WithField("symbol", symbol).Debug("No order book depth available, skipping liquidity cap")
+		return size
+	}
+
+	maxSize := askDepth * p.config.LiquidityMaxDepthFraction
+	if size > maxSize {
+		p.logger.WithFields(logrus.Fields{
+			"symbol":        symbol,
+			"position_size": size,
+			"ask_depth":     askDepth,
+			"capped_size":   maxSize,
+		}).Info("Position size capped by order book liquidity")
+		return maxSize
+	}
+	return size
+}
+
+// performanceMultiplier leans into a strategy that has been winning and trims
+// one that has been losing, judged by the win rate and net PnL of the last
+// closed positions. The win rate sets the direction and strength; a net PnL
+// that disagrees with it (many small wins wiped out by one large loss, or the
+// reverse) leaves the size unchanged. Too little history is neutral.
+func (p *PositionSizer) performanceMultiplier(ctx context.Context) float64 {
+	if !p.config.AdaptiveSizingEnabled || p.performance == nil || p.config.AdaptiveSizingLookback <= 0 {
+		return 1
+	}
+
+	positions, err := p.performance.GetRecentClosedPositions(ctx, p.config.AdaptiveSizingLookback)
+	if err != nil {
+		p.logger.WithError(err).Warn("Failed to get recent performance for sizing, using neutral multiplier")
+		return 1
+	}
+	if len(positions) == 0 || len(positions) < p.config.AdaptiveSizingMinTrades {
+		return 1
+	}
+
+	wins := 0
+	netPnL := 0.0
+	for _, position := range positions {
+		if position.RealizedPnL > 0 {
+			wins++
+		}
+		netPnL += position.RealizedPnL
+	}
+	winRate := float64(wins) / float64(len(positions))
+
+	// Score in [-1, 1]: -1 when every trade lost, 1 when every trade won
+	score := 2*winRate - 1
+	if (score > 0 && netPnL <= 0) || (score < 0 && netPnL >= 0) {
+		score = 0
+	}
+
+	multiplier := 1.0
+	if score > 0 {
+		multiplier += score * (p.config.AdaptiveSizingMaxMultiplier - 1)
+	} else {
+		multiplier += score * (1 - p.config.AdaptiveSizingMinMultiplier)
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"recent_trades":          len(positions),
+		"win_rate":               winRate,
+		"net_pnl":                netPnL,
+		"performance_multiplier": multiplier,
+	}).Debug("Calculated performance sizing multiplier")
+
+	return multiplier
+}
+
+// rampFraction scales a strategy that has not yet proven itself down to a
+// share of its target size, growing linearly to full size as it closes
+// positions. Reaching the PnL target graduates it early.
+func (p *PositionSizer) rampFraction(ctx context.Context, tag string) float64 {
+	if !p.config.SizeRampEnabled || p.config.SizeRampTrades <= 0 {
+		return 1
+	}
+
+	trades, pnl, err := p.performance.GetStrategyTrackRecord(ctx, tag)
+	if err != nil {
+		// Without a track record the strategy is treated as new
+		p.logger.WithError(err).WithField("strategy_tag", tag).Warn("Failed to get strategy track record for sizing ramp")
+		trades, pnl = 0, 0
+	}
+
+	if trades >= p.config.SizeRampTrades || (p.config.SizeRampPnL > 0 && pnl >= p.config.SizeRampPnL) {
+		return 1
+	}
+
+	start := math.Min(math.Max(p.config.SizeRampStartFraction, 0), 1)
+	fraction := start + (1-start)*float64(trades)/float64(p.config.SizeRampTrades)
+
+	p.logger.WithFields(logrus.Fields{
+		"strategy_tag":  tag,
+		"closed_trades": trades,
+		"realized_pnl":  pnl,
+		"ramp_fraction": fraction,
+	}).Debug("Strategy still ramping up position size")
+
+	return fraction
+}
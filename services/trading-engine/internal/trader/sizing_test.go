@@ -0,0 +1,293 @@
+package trader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+func TestCalculateVolatilityMultiplier(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     float64
+		volatility float64
+		want       float64
+	}{
+		{"no history", 0.02, 0, 1},
+		{"no target", 0, 0.02, 1},
+		{"at target", 0.02, 0.02, 1},
+		{"calmer than target", 0.02, 0.016, 1.25},
+		{"twice as volatile", 0.02, 0.04, 0.5},
+		{"capped high", 0.02, 0.001, maxVolatilityMultiplier},
+		{"capped low", 0.02, 1, minVolatilityMultiplier},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &PositionSizer{config: EngineConfig{SizingTargetVolatility: tt.target}}
+			if got := p.calculateVolatilityMultiplier(tt.volatility); got != tt.want {
+				t.Errorf("calculateVolatilityMultiplier(%v) = %v, want %v", tt.volatility, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeDepth reports fixed order book depth for every symbol
+type fakeDepth struct {
+	bid, ask float64
+	ok       bool
+}
+
+func (d fakeDepth) DepthWithin(string, float64) (float64, float64, bool) {
+	return d.bid, d.ask, d.ok
+}
+
+func TestLiquidityCapOnThinBook(t *testing.T) {
+	// 500 USDT base size, capped to 200 by a 10 USDT risk budget at a 5% stop
+	config := EngineConfig{
+		DefaultPositionSize:       500,
+		MaxRiskPerTradeUSDT:       10,
+		LiquidityDepthBps:         50,
+		LiquidityMaxDepthFraction: 0.1,
+	}
+	pairConfig := models.TradingConfig{StopLossPercent: 0.05}
+
+	tests := []struct {
+		name  string
+		depth DepthProvider
+		want  float64
+	}{
+		{name: "thin book caps below the risk-based size", depth: fakeDepth{bid: 5000, ask: 1000, ok: true}, want: 100},
+		{name: "deep book leaves the risk-based size", depth: fakeDepth{bid: 50000, ask: 50000, ok: true}, want: 200},
+		{name: "only the ask side is counted for an entry", depth: fakeDepth{bid: 100, ask: 3000, ok: true}, want: 200},
+		{name: "unsynchronized book leaves the size", depth: fakeDepth{ok: false}, want: 200},
+		{name: "no order book", depth: nil, want: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockDatabaseRepository("main")
+			sizer := NewPositionSizer(repo, tt.depth, nil, nil, config, utils.NewDiscardLogger())
+
+			got := sizer.CalculatePositionSize(context.Background(), testPair, pairConfig, 100)
+			if !approxEqual(got, tt.want) {
+				t.Errorf("CalculatePositionSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLiquidityCapDisabled(t *testing.T) {
+	config := EngineConfig{DefaultPositionSize: 500, LiquidityDepthBps: 50}
+	sizer := NewPositionSizer(NewMockDatabaseRepository("main"), fakeDepth{ask: 10, ok: true}, nil, nil, config, utils.NewDiscardLogger())
+
+	if got := sizer.CalculatePositionSize(context.Background(), testPair, models.TradingConfig{}, 100); got != 500 {
+		t.Errorf("CalculatePositionSize() = %v with no depth fraction configured, want 500", got)
+	}
+}
+
+func TestSizingModesProduceExpectedOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*models.TradingConfig)
+		balance   float64
+		wantQuote float64 // Quote notional of the entry; 0 means no order
+		wantBase  float64 // Base quantity of the entry when fixed by the mode
+	}{
+		{
+			name:      "quote funds spends the configured amount",
+			configure: func(c *models.TradingConfig) { c.SizingMode = models.SizingQuoteFunds; c.PositionSizeUSDT = 80 },
+			wantQuote: 80,
+		},
+		{
+			name:      "unset mode sizes in quote funds",
+			configure: func(c *models.TradingConfig) { c.SizingMode = ""; c.PositionSizeUSDT = 80 },
+			wantQuote: 80,
+		},
+		{
+			name: "base quantity buys the configured quantity",
+			configure: func(c *models.TradingConfig) {
+				c.SizingMode = models.SizingBaseQuantity
+				c.PositionSizeBase = 1.5
+			},
+			wantBase: 1.5,
+		},
+		{
+			name: "balance percent spends a share of the quote balance",
+			configure: func(c *models.TradingConfig) {
+				c.SizingMode = models.SizingBalancePercent
+				c.PositionSizePercent = 0.05
+			},
+			balance:   1000,
+			wantQuote: 50,
+		},
+		{
+			name: "balance percent above one places nothing",
+			configure: func(c *models.TradingConfig) {
+				c.SizingMode = models.SizingBalancePercent
+				c.PositionSizePercent = 5
+			},
+			balance: 1000,
+		},
+		{
+			name:      "unknown mode places nothing",
+			configure: func(c *models.TradingConfig) { c.SizingMode = "lots" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+			price := seedSellOff(repo)
+			tt.configure(repo.configs[testPair.ID])
+			ex.balances["USDT"] = tt.balance
+			engine := newTestEngine(repo, ex, testEngineConfig())
+
+			if err := engine.processPair(context.Background(), testPair); err != nil {
+				t.Fatalf("processPair() error = %v", err)
+			}
+
+			placed := ex.Placed()
+			if tt.wantQuote == 0 && tt.wantBase == 0 {
+				if len(placed) != 0 {
+					t.Fatalf("placed %+v, want no order", placed)
+				}
+				return
+			}
+			if len(placed) != 1 || placed[0].Side != "buy" {
+				t.Fatalf("placed %+v, want one buy", placed)
+			}
+
+			order := placed[0]
+			wantBase, wantQuote := tt.wantBase, tt.wantQuote
+			if wantBase == 0 {
+				wantBase = wantQuote / order.Price
+			} else {
+				wantQuote = wantBase * price
+			}
+			if !approxEqual(order.Quantity, wantBase) || !approxEqual(order.Quantity*order.Price, wantQuote) {
+				t.Errorf("order = %v at %v (%v quote), want %v base for %v quote",
+					order.Quantity, order.Price, order.Quantity*order.Price, wantBase, wantQuote)
+			}
+
+			// Exposure and PnL are measured on the position the order opened
+			positions := repo.Positions()
+			if len(positions) != 1 || !approxEqual(positions[0].Quantity, order.Quantity) || positions[0].EntryPrice != order.Price {
+				t.Errorf("position = %+v, want %v at %v", positions, order.Quantity, order.Price)
+			}
+		})
+	}
+}
+
+// addClosedTrades records closed positions with the given realized PnLs, the
+// last one closed most recently
+func addClosedTrades(repo *MockDatabaseRepository, start time.Time, pnls ...float64) time.Time {
+	for _, pnl := range pnls {
+		start = start.Add(time.Hour)
+		closedAt := start
+		repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 100, Quantity: 1, Status: "closed", RealizedPnL: pnl, ClosedAt: &closedAt})
+	}
+	return start
+}
+
+func repeat(pnl float64, n int) []float64 {
+	pnls := make([]float64, n)
+	for i := range pnls {
+		pnls[i] = pnl
+	}
+	return pnls
+}
+
+func TestRecentPerformanceScalesSize(t *testing.T) {
+	config := EngineConfig{
+		DefaultPositionSize:         100,
+		AdaptiveSizingEnabled:       true,
+		AdaptiveSizingLookback:      10,
+		AdaptiveSizingMinTrades:     5,
+		AdaptiveSizingMaxMultiplier: 1.5,
+		AdaptiveSizingMinMultiplier: 0.5,
+	}
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		history [][]float64 // Batches closed one after another
+		want    float64
+	}{
+		{name: "winning streak leans in", history: [][]float64{repeat(5, 10)}, want: 150},
+		{name: "losing streak trims", history: [][]float64{repeat(-5, 10)}, want: 50},
+		{name: "mostly winning", history: [][]float64{append(repeat(5, 7), repeat(-2, 3)...)}, want: 120},
+		{name: "wins wiped out by one loss stay neutral", history: [][]float64{append(repeat(1, 8), -20, -1)}, want: 100},
+		{name: "recent streak outweighs older losses", history: [][]float64{repeat(-5, 10), repeat(5, 10)}, want: 150},
+		{name: "too little history is neutral", history: [][]float64{repeat(5, 4)}, want: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockDatabaseRepository("main")
+			at := start
+			for _, batch := range tt.history {
+				at = addClosedTrades(repo, at, batch...)
+			}
+			sizer := NewPositionSizer(repo, nil, nil, repo, config, utils.NewDiscardLogger())
+
+			if got := sizer.CalculatePositionSize(context.Background(), testPair, models.TradingConfig{}, 100); !approxEqual(got, tt.want) {
+				t.Errorf("CalculatePositionSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecentPerformanceDisabled(t *testing.T) {
+	repo := NewMockDatabaseRepository("main")
+	addClosedTrades(repo, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), repeat(5, 10)...)
+	config := EngineConfig{DefaultPositionSize: 100, AdaptiveSizingLookback: 10, AdaptiveSizingMaxMultiplier: 1.5}
+
+	sizer := NewPositionSizer(repo, nil, nil, repo, config, utils.NewDiscardLogger())
+	if got := sizer.CalculatePositionSize(context.Background(), testPair, models.TradingConfig{}, 100); got != 100 {
+		t.Errorf("CalculatePositionSize() = %v with adaptive sizing off, want 100", got)
+	}
+}
+
+func TestSizeRampGrowsWithTradeCount(t *testing.T) {
+	config := EngineConfig{
+		DefaultPositionSize:   100,
+		StrategyTag:           "breakout-v2",
+		SizeRampEnabled:       true,
+		SizeRampStartFraction: 0.25,
+		SizeRampTrades:        4,
+	}
+	repo := NewMockDatabaseRepository("main")
+	sizer := NewPositionSizer(repo, nil, nil, repo, config, utils.NewDiscardLogger())
+
+	// Another strategy's record does not graduate this one
+	repo.AddPosition(models.Position{PairID: testPair.ID, StrategyTag: "legacy", Status: "closed", RealizedPnL: 50})
+
+	for trades, want := range []float64{25, 43.75, 62.5, 81.25, 100, 100} {
+		if got := sizer.CalculatePositionSize(context.Background(), testPair, models.TradingConfig{}, 100); !approxEqual(got, want) {
+			t.Errorf("after %d trades CalculatePositionSize() = %v, want %v", trades, got, want)
+		}
+		repo.AddPosition(models.Position{PairID: testPair.ID, StrategyTag: "breakout-v2", Status: "closed", RealizedPnL: -1})
+	}
+}
+
+func TestSizeRampGraduatesOnPnL(t *testing.T) {
+	config := EngineConfig{
+		DefaultPositionSize:   100,
+		StrategyTag:           "breakout-v2",
+		SizeRampEnabled:       true,
+		SizeRampStartFraction: 0.25,
+		SizeRampTrades:        10,
+		SizeRampPnL:           20,
+	}
+	repo := NewMockDatabaseRepository("main")
+	repo.AddPosition(models.Position{PairID: testPair.ID, StrategyTag: "breakout-v2", Status: "closed", RealizedPnL: 25})
+
+	sizer := NewPositionSizer(repo, nil, nil, repo, config, utils.NewDiscardLogger())
+	if got := sizer.CalculatePositionSize(context.Background(), testPair, models.TradingConfig{}, 100); got != 100 {
+		t.Errorf("CalculatePositionSize() = %v after one trade past the PnL target, want the full 100", got)
+	}
+}
@@ -0,0 +1,214 @@
+package trader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/database"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/exchange"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// StaleOrderCanceller cancels limit entries that rested on the book longer
+// than the maximum age. Left alone, unfilled orders keep holding funds and an
+// order slot on the symbol, so the open order cap would never clear. Exit
+// orders are not cancelled: their position is already booked as closed and
+// the holding would be left behind unnoticed.
+//
+// Entries are also cancelled, whatever their age, once the price moves too
+// far from their limit: against them, where a fill would catch a falling (or,
+// for shorts, rising) market, or away from them, where the order would never
+// fill and the strategy should re-enter at the current price instead.
+type StaleOrderCanceller struct {
+	repo           database.RepositoryInterface
+	exchange       exchange.Exchange
+	maxAge         time.Duration
+	adverseBand    float64 // Move through the limit price that abandons the entry, 0 disables
+	chaseBand      float64 // Move away from the limit price that reprices the entry, 0 disables
+	reconcileFills bool    // Fill reconciliation settles cancelled orders from their fills
+	logger         *logrus.Logger
+}
+
+// Outcomes of checking a resting entry against the current price
+const (
+	EntryDriftNone    = ""
+	EntryDriftAdverse = "adverse" // Price moved through the limit: abandon
+	EntryDriftChase   = "chase"   // Price ran away from the limit: reprice
+)
+
+func NewStaleOrderCanceller(repo database.RepositoryInterface, exchange exchange.Exchange, maxAge time.Duration,
+	adverseBand, chaseBand float64, reconcileFills bool, logger *logrus.Logger) *StaleOrderCanceller {
+	return &StaleOrderCanceller{
+		repo:           repo,
+		exchange:       exchange,
+		maxAge:         maxAge,
+		adverseBand:    adverseBand,
+		chaseBand:      chaseBand,
+		reconcileFills: reconcileFills,
+		logger:         logger,
+	}
+}
+
+// Cancel cancels every pending limit entry older than the maximum age
+func (s *StaleOrderCanceller) Cancel(ctx context.Context) error {
+	orders, err := s.repo.GetPendingOrders(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get pending orders: %w", err)
+	}
+
+	cutoff := time.Now().Add(-s.maxAge)
+	for _, order := range orders {
+		if order.Type != "limit" || !order.CreatedAt.Before(cutoff) {
+			continue
+		}
+		if err := s.cancelOrder(ctx, order); err != nil {
+			s.logger.WithError(err).WithFields(logrus.Fields{
+				"order_id":        order.ID,
+				"kucoin_order_id": order.KuCoinOrderID,
+			}).Error("Failed to cancel stale order")
+		}
+	}
+
+	return nil
+}
+
+// CancelDrifted cancels the pair's resting limit entries whose price has
+// drifted beyond a band from the current price. Nothing is placed here: a
+// repriced entry is made by the strategy at the current price, if its signal
+// still holds.
+func (s *StaleOrderCanceller) CancelDrifted(ctx context.Context, pair models.SelectedPair, currentPrice float64) error {
+	orders, err := s.repo.GetPendingEntryOrders(ctx, pair.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get pending entry orders: %w", err)
+	}
+
+	for _, order := range orders {
+		drift := entryDrift(order, currentPrice, s.adverseBand, s.chaseBand)
+		if drift == EntryDriftNone {
+			continue
+		}
+
+		s.logger.WithFields(logrus.Fields{
+			"symbol":        pair.Symbol,
+			"order_id":      order.ID,
+			"side":          order.Side,
+			"limit_price":   order.Price,
+			"current_price": currentPrice,
+			"drift":         drift,
+		}).Info("Entry price drifted beyond band, cancelling")
+
+		if err := s.cancelOrder(ctx, order); err != nil {
+			s.logger.WithError(err).WithFields(logrus.Fields{
+				"order_id":        order.ID,
+				"kucoin_order_id": order.KuCoinOrderID,
+			}).Error("Failed to cancel drifted entry")
+		}
+	}
+
+	return nil
+}
+
+// entryDrift classifies a resting entry by how far the current price has
+// moved from its limit. A buy limit is abandoned when the price falls more
+// than the adverse band below it and repriced when it rises more than the
+// chase band above it; a sell limit mirrors that.
+func entryDrift(order models.Order, currentPrice, adverseBand, chaseBand float64) string {
+	if order.Price <= 0 || currentPrice <= 0 {
+		return EntryDriftNone
+	}
+
+	move := (currentPrice - order.Price) / order.Price
+	if order.Side == "sell" {
+		move = -move
+	}
+
+	switch {
+	case adverseBand > 0 && move < -adverseBand:
+		return EntryDriftAdverse
+	case chaseBand > 0 && move > chaseBand:
+		return EntryDriftChase
+	}
+	return EntryDriftNone
+}
+
+func (s *StaleOrderCanceller) cancelOrder(ctx context.Context, order models.Order) error {
+	var position *models.Position
+	if order.PositionID != nil {
+		var err error
+		if position, err = s.repo.GetPositionByID(ctx, *order.PositionID); err != nil {
+			return err
+		}
+		if order.Side != position.Side {
+			return nil // Exit order
+		}
+	}
+
+	// The order may have filled or been cancelled in the meantime, which
+	// the lookup below settles
+	if err := s.exchange.CancelOrder(order.KuCoinOrderID); err != nil {
+		s.logger.WithError(err).WithField("kucoin_order_id", order.KuCoinOrderID).Debug("Cancel of stale order failed, checking its state")
+	}
+
+	exchangeOrder, err := s.exchange.GetOrder(order.KuCoinOrderID)
+	if err != nil {
+		return err
+	}
+	if exchangeOrder.IsActive {
+		return nil // Cancellation still in flight, retried next cycle
+	}
+	dealt, err := exchange.ParseOrderFill(exchangeOrder)
+	if err != nil {
+		return err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"order_id":        order.ID,
+		"kucoin_order_id": order.KuCoinOrderID,
+		"side":            order.Side,
+		"quantity":        order.Quantity,
+		"filled":          dealt.DealSize,
+		"created_at":      order.CreatedAt,
+	}).Info("Cancelled resting limit order")
+
+	// Without fill reconciliation the order is settled here
+	if !s.reconcileFills {
+		order.FilledQuantity = dealt.DealSize
+		order.Status = "cancelled"
+		if dealt.DealSize > 0 {
+			order.Status = "filled"
+		}
+		if err := s.repo.UpdateOrderFill(ctx, order); err != nil {
+			return err
+		}
+	}
+
+	if position == nil || position.Status == "closed" {
+		return nil
+	}
+	return s.resizePosition(ctx, *position, dealt.DealSize)
+}
+
+// resizePosition shrinks a position to what its cancelled entry actually
+// bought, closing it when nothing executed
+func (s *StaleOrderCanceller) resizePosition(ctx context.Context, position models.Position, filled float64) error {
+	if filled >= position.Quantity {
+		return nil
+	}
+
+	position.Quantity = filled
+	if filled == 0 {
+		now := time.Now()
+		position.Status = "closed"
+		position.ClosedAt = &now
+		position.UnrealizedPnL = 0
+		position.ClosedFraction = 1
+	}
+
+	if err := s.repo.UpdatePosition(ctx, position); err != nil {
+		return fmt.Errorf("failed to update position: %w", err)
+	}
+
+	return nil
+}
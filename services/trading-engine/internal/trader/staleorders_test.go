@@ -0,0 +1,141 @@
+package trader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestOpenOrderCapBlocksUntilOrderResolves(t *testing.T) {
+	ctx := context.Background()
+	repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+	repo.pairs = []models.SelectedPair{testPair}
+	seedSellOff(repo)
+
+	config := testEngineConfig()
+	config.MaxOpenOrdersPerSymbol = 1
+	config.StaleOrderMaxAge = 10 * time.Minute
+	engine := newTestEngine(repo, ex, config)
+	throttles := metrics.OrderCapThrottles.WithLabelValues(testSymbol)
+	before := testutil.ToFloat64(throttles)
+
+	// A limit order placed a minute ago still rests on the book
+	resting := repo.AddOrder(models.Order{
+		PairID: testPair.ID, KuCoinOrderID: "resting-1", Side: "buy", Type: "limit",
+		Quantity: 1, Price: 90, Status: "pending", CreatedAt: time.Now().Add(-time.Minute),
+	})
+	ex.orders["resting-1"] = &kucoin.Order{ID: "resting-1", Symbol: testSymbol, DealSize: "0", DealFunds: "0"}
+
+	if err := engine.processTradingCycle(ctx); err != nil {
+		t.Fatalf("processTradingCycle() error = %v", err)
+	}
+	if placed := ex.Placed(); len(placed) != 0 {
+		t.Fatalf("placed %d orders at the cap, want none", len(placed))
+	}
+	if got := testutil.ToFloat64(throttles) - before; got != 1 {
+		t.Errorf("throttle metric rose by %v, want 1", got)
+	}
+
+	// Once stale, the resting order is cancelled and frees its slot
+	repo.mu.Lock()
+	for _, order := range repo.orders {
+		if order.ID == resting.ID {
+			order.CreatedAt = time.Now().Add(-time.Hour)
+		}
+	}
+	repo.mu.Unlock()
+
+	if err := engine.processTradingCycle(ctx); err != nil {
+		t.Fatalf("processTradingCycle() error = %v", err)
+	}
+	cancelled := ex.Cancelled()
+	if len(cancelled) != 1 || cancelled[0] != "resting-1" {
+		t.Errorf("cancelled %v, want the stale resting-1", cancelled)
+	}
+	if placed := ex.Placed(); len(placed) != 1 {
+		t.Errorf("placed %d orders after the slot cleared, want 1", len(placed))
+	}
+	if got := testutil.ToFloat64(throttles) - before; got != 1 {
+		t.Errorf("throttle metric rose by %v, want no further throttles", got)
+	}
+}
+
+func TestEntryDrift(t *testing.T) {
+	tests := []struct {
+		name  string
+		side  string
+		price float64 // Current price against a limit of 100
+		want  string
+	}{
+		{name: "buy within the bands", side: "buy", price: 99, want: EntryDriftNone},
+		{name: "buy with the price falling through", side: "buy", price: 97, want: EntryDriftAdverse},
+		{name: "buy with the price running away", side: "buy", price: 104, want: EntryDriftChase},
+		{name: "sell with the price rising through", side: "sell", price: 103, want: EntryDriftAdverse},
+		{name: "sell with the price running away", side: "sell", price: 96, want: EntryDriftChase},
+		{name: "sell within the bands", side: "sell", price: 101.5, want: EntryDriftNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := models.Order{Side: tt.side, Price: 100}
+			if got := entryDrift(order, tt.price, 0.02, 0.03); got != tt.want {
+				t.Errorf("entryDrift() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := entryDrift(models.Order{Side: "buy", Price: 100}, 50, 0, 0); got != EntryDriftNone {
+		t.Errorf("entryDrift() with no bands = %q, want none", got)
+	}
+}
+
+func TestCancelDriftedEntries(t *testing.T) {
+	tests := []struct {
+		name          string
+		price         float64
+		wantCancelled bool
+	}{
+		{name: "adverse move abandons the entry", price: 97, wantCancelled: true},
+		{name: "favourable run cancels it for repricing", price: 104, wantCancelled: true},
+		{name: "move within the bands keeps it", price: 101},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, ex := NewMockDatabaseRepository("main"), NewMockExchange()
+			config := testEngineConfig()
+			config.EntryAdverseBand = 0.02
+			config.EntryChaseBand = 0.03
+			engine := newTestEngine(repo, ex, config)
+
+			position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 100, Quantity: 1, Status: "open"})
+			repo.AddOrder(models.Order{PositionID: &position.ID, PairID: testPair.ID, KuCoinOrderID: "entry-1", Side: "buy", Type: "limit", Quantity: 1, Price: 100, Status: "pending"})
+			// The take profit resting on the same position is an exit, never cancelled here
+			repo.AddOrder(models.Order{PositionID: &position.ID, PairID: testPair.ID, KuCoinOrderID: "exit-1", Side: "sell", Type: "limit", Quantity: 1, Price: 110, Status: "pending"})
+			ex.orders["entry-1"] = &kucoin.Order{ID: "entry-1", Symbol: testSymbol, DealSize: "0", DealFunds: "0"}
+
+			if err := engine.staleOrders.CancelDrifted(context.Background(), testPair, tt.price); err != nil {
+				t.Fatalf("CancelDrifted() error = %v", err)
+			}
+
+			cancelled := ex.Cancelled()
+			if !tt.wantCancelled {
+				if len(cancelled) != 0 {
+					t.Errorf("cancelled %v, want nothing", cancelled)
+				}
+				return
+			}
+			if len(cancelled) != 1 || cancelled[0] != "entry-1" {
+				t.Fatalf("cancelled %v, want only entry-1", cancelled)
+			}
+			if got := repo.Positions()[0].Status; got != "closed" {
+				t.Errorf("position status = %s after its unfilled entry was cancelled, want closed", got)
+			}
+		})
+	}
+}
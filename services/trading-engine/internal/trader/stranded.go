@@ -0,0 +1,155 @@
+package trader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/database"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/exchange"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// StrandedOrderRecovery resolves pending orders that never had their
+// exchange order ID recorded. Fill reconciliation looks orders up by that ID,
+// so without recovery such an order would stay pending forever. Orders the
+// exchange knows by their client order ID get the ID filled in; the rest are
+// marked failed and their position reconciled.
+type StrandedOrderRecovery struct {
+	repo     database.RepositoryInterface
+	exchange exchange.Exchange
+	timeout  time.Duration // Age after which a pending order without an exchange ID is stranded
+	logger   *logrus.Logger
+}
+
+func NewStrandedOrderRecovery(repo database.RepositoryInterface, exchange exchange.Exchange, timeout time.Duration, logger *logrus.Logger) *StrandedOrderRecovery {
+	return &StrandedOrderRecovery{
+		repo:     repo,
+		exchange: exchange,
+		timeout:  timeout,
+		logger:   logger,
+	}
+}
+
+// Recover resolves every stranded order older than the timeout
+func (s *StrandedOrderRecovery) Recover(ctx context.Context) error {
+	orders, err := s.repo.GetStrandedOrders(ctx, time.Now().Add(-s.timeout))
+	if err != nil {
+		return err
+	}
+
+	for _, order := range orders {
+		if err := s.recoverOrder(ctx, order); err != nil {
+			s.logger.WithError(err).WithFields(logrus.Fields{
+				"order_id":   order.ID,
+				"client_oid": order.ClientOid,
+			}).Error("Failed to recover stranded order")
+		}
+	}
+
+	return nil
+}
+
+func (s *StrandedOrderRecovery) recoverOrder(ctx context.Context, order models.Order) error {
+	if order.ClientOid != "" {
+		exchangeOrder, err := s.exchange.GetOrderByClientOid(order.ClientOid)
+		switch {
+		case err == nil:
+			return s.adopt(ctx, order, exchangeOrder.ID)
+		case !errors.Is(err, exchange.ErrOrderNotFound):
+			return err // Lookup failed, retried next cycle
+		}
+	}
+
+	// The exchange never accepted the order
+	order.Status = "failed"
+	if err := s.repo.UpdateOrderFill(ctx, order); err != nil {
+		return err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"order_id":   order.ID,
+		"client_oid": order.ClientOid,
+		"side":       order.Side,
+		"created_at": order.CreatedAt,
+	}).Warn("Stranded order not found on exchange, marked failed")
+
+	if order.PositionID == nil {
+		return nil
+	}
+	return s.reconcilePosition(ctx, *order.PositionID, order)
+}
+
+// adopt records the exchange ID found by client order ID; fill
+// reconciliation settles the order from there
+func (s *StrandedOrderRecovery) adopt(ctx context.Context, order models.Order, kucoinOrderID string) error {
+	if err := s.repo.SetOrderExchangeID(ctx, order.ID, kucoinOrderID); err != nil {
+		return err
+	}
+
+	if order.PositionID != nil {
+		position, err := s.repo.GetPositionByID(ctx, *order.PositionID)
+		if err != nil {
+			return err
+		}
+		if position.OrderID == "" && order.Side == position.Side {
+			position.OrderID = kucoinOrderID
+			if err := s.repo.UpdatePosition(ctx, *position); err != nil {
+				return fmt.Errorf("failed to update position: %w", err)
+			}
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"order_id":        order.ID,
+		"client_oid":      order.ClientOid,
+		"kucoin_order_id": kucoinOrderID,
+	}).Info("Recovered exchange ID of stranded order")
+
+	return nil
+}
+
+// reconcilePosition undoes a position whose entry never reached the
+// exchange. A failed exit leaves the position's recorded state ahead of what
+// is actually held, which cannot be repaired safely here, so it is flagged
+// for an operator instead.
+func (s *StrandedOrderRecovery) reconcilePosition(ctx context.Context, positionID string, order models.Order) error {
+	position, err := s.repo.GetPositionByID(ctx, positionID)
+	if err != nil {
+		return err
+	}
+
+	if order.Side != position.Side {
+		metrics.PositionIntegrityErrors.WithLabelValues("stranded_exit").Inc()
+		s.logger.WithFields(logrus.Fields{
+			"position_id": position.ID,
+			"order_id":    order.ID,
+			"quantity":    order.Quantity,
+		}).Error("Exit order never reached the exchange, position may still be held")
+		return nil
+	}
+
+	if position.Status == "closed" {
+		return nil
+	}
+
+	now := time.Now()
+	position.Status = "closed"
+	position.ClosedAt = &now
+	position.UnrealizedPnL = 0
+	position.ClosedFraction = 1
+
+	if err := s.repo.UpdatePosition(ctx, *position); err != nil {
+		return fmt.Errorf("failed to update position: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"position_id": position.ID,
+		"order_id":    order.ID,
+	}).Warn("Entry order never reached the exchange, position closed")
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package trader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/kucoin"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStrandedOrderRecovery(t *testing.T) {
+	tests := []struct {
+		name             string
+		side             string
+		clientOid        string
+		onExchange       bool
+		wantExchangeID   string
+		wantOrderStatus  string
+		wantPosition     string
+		wantIntegrityErr float64
+	}{
+		{
+			name:            "entry found by client oid is adopted",
+			side:            "buy",
+			clientOid:       "client-1",
+			onExchange:      true,
+			wantExchangeID:  "kucoin-1",
+			wantOrderStatus: "pending",
+			wantPosition:    "open",
+		},
+		{
+			name:            "entry unknown to the exchange fails and closes its position",
+			side:            "buy",
+			clientOid:       "client-1",
+			wantOrderStatus: "failed",
+			wantPosition:    "closed",
+		},
+		{
+			name:            "entry without a client oid fails",
+			side:            "buy",
+			wantOrderStatus: "failed",
+			wantPosition:    "closed",
+		},
+		{
+			name:             "exit unknown to the exchange is flagged, position kept",
+			side:             "sell",
+			clientOid:        "client-1",
+			wantOrderStatus:  "failed",
+			wantPosition:     "open",
+			wantIntegrityErr: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := NewMockDatabaseRepository("main")
+			ex := NewMockExchange()
+			recovery := NewStrandedOrderRecovery(repo, ex, time.Minute, utils.NewDiscardLogger())
+			integrityErrors := metrics.PositionIntegrityErrors.WithLabelValues("stranded_exit")
+			before := testutil.ToFloat64(integrityErrors)
+
+			position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 100, Quantity: 1, Status: "open"})
+			stranded := repo.AddOrder(models.Order{
+				PositionID: &position.ID, PairID: testPair.ID, ClientOid: tt.clientOid, Side: tt.side,
+				Type: "limit", Quantity: 1, Price: 100, Status: "pending", CreatedAt: time.Now().Add(-time.Hour),
+			})
+			if tt.onExchange {
+				ex.orders["kucoin-1"] = &kucoin.Order{ID: "kucoin-1", ClientOid: tt.clientOid, IsActive: true}
+			}
+
+			if err := recovery.Recover(ctx); err != nil {
+				t.Fatalf("Recover() error = %v", err)
+			}
+
+			order := repo.Orders()[0]
+			if order.ID != stranded.ID || order.KuCoinOrderID != tt.wantExchangeID || order.Status != tt.wantOrderStatus {
+				t.Errorf("order = %s/%s, want exchange ID %q and status %s", order.KuCoinOrderID, order.Status, tt.wantExchangeID, tt.wantOrderStatus)
+			}
+
+			recovered := repo.Positions()[0]
+			if recovered.Status != tt.wantPosition {
+				t.Errorf("position status = %s, want %s", recovered.Status, tt.wantPosition)
+			}
+			if recovered.OrderID != tt.wantExchangeID {
+				t.Errorf("position order ID = %q, want %q", recovered.OrderID, tt.wantExchangeID)
+			}
+			if got := testutil.ToFloat64(integrityErrors) - before; got != tt.wantIntegrityErr {
+				t.Errorf("integrity error metric rose by %v, want %v", got, tt.wantIntegrityErr)
+			}
+		})
+	}
+}
+
+func TestStrandedOrderRecoveryWaitsForTimeout(t *testing.T) {
+	repo := NewMockDatabaseRepository("main")
+	recovery := NewStrandedOrderRecovery(repo, NewMockExchange(), time.Minute, utils.NewDiscardLogger())
+
+	position := repo.AddPosition(models.Position{PairID: testPair.ID, Side: "buy", EntryPrice: 100, Quantity: 1, Status: "open"})
+	repo.AddOrder(models.Order{
+		PositionID: &position.ID, PairID: testPair.ID, Side: "buy",
+		Type: "limit", Quantity: 1, Price: 100, Status: "pending", CreatedAt: time.Now(),
+	})
+
+	if err := recovery.Recover(context.Background()); err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+
+	if got := repo.Orders()[0].Status; got != "pending" {
+		t.Errorf("order status = %s, want a fresh order left pending", got)
+	}
+	if got := repo.Positions()[0].Status; got != "open" {
+		t.Errorf("position status = %s, want open", got)
+	}
+}
@@ -0,0 +1,33 @@
+package trader
+
+import (
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/internal/sink"
+	"github.com/paaavkata/crypto-trading-bot-v4/trading-engine/pkg/models"
+)
+
+// closedEvent describes a position that was just closed at the exit price
+func closedEvent(symbol string, position models.Position, exitPrice float64, reason string) sink.TradeEvent {
+	closedAt := time.Now()
+	if position.ClosedAt != nil {
+		closedAt = *position.ClosedAt
+	}
+
+	return sink.TradeEvent{
+		Type:          sink.EventPositionClosed,
+		PositionID:    position.ID,
+		AccountID:     position.AccountID,
+		Symbol:        symbol,
+		Side:          position.Side,
+		Quantity:      position.Quantity,
+		EntryPrice:    position.EntryPrice,
+		ExitPrice:     exitPrice,
+		RealizedPnL:   position.RealizedPnL,
+		StrategyTag:   position.StrategyTag,
+		ConfigVersion: position.ConfigVersion,
+		Reason:        reason,
+		OpenedAt:      position.CreatedAt,
+		ClosedAt:      closedAt,
+	}
+}
@@ -1,31 +1,51 @@
 package models
 
 import (
+	"errors"
+	"fmt"
 	"time"
 )
 
 type Position struct {
-	ID            string     `db:"id"`
-	PairID        int64      `db:"pair_id"`
-	ConfigID      string     `db:"config_id"`
-	Side          string     `db:"side"` // 'buy' or 'sell'
-	Quantity      float64    `db:"quantity"`
-	EntryPrice    float64    `db:"entry_price"`
-	CurrentPrice  float64    `db:"current_price"`
-	UnrealizedPnL float64    `db:"unrealized_pnl"`
-	RealizedPnL   float64    `db:"realized_pnl"`
-	Status        string     `db:"status"` // 'open', 'closed', 'partial'
-	OrderID       string     `db:"order_id"`
-	CreatedAt     time.Time  `db:"created_at"`
-	UpdatedAt     time.Time  `db:"updated_at"`
-	ClosedAt      *time.Time `db:"closed_at"`
+	ID            string  `db:"id"`
+	AccountID     string  `db:"account_id"`
+	PairID        int64   `db:"pair_id"`
+	ConfigID      string  `db:"config_id"`
+	Side          string  `db:"side"` // 'buy' or 'sell'
+	Quantity      float64 `db:"quantity"`
+	EntryPrice    float64 `db:"entry_price"`
+	CurrentPrice  float64 `db:"current_price"`
+	UnrealizedPnL float64 `db:"unrealized_pnl"`
+	RealizedPnL   float64 `db:"realized_pnl"`
+	TotalFees     float64 `db:"total_fees"` // Entry and exit fees deducted from RealizedPnL so far
+	Status        string  `db:"status"`     // 'open', 'closed', 'partial'
+	OrderID       string  `db:"order_id"`
+	StrategyTag   string  `db:"strategy_tag"`
+	ConfigVersion string  `db:"config_version"`
+
+	// Exit state persisted so stop/take-profit handling survives restarts
+	HighWaterMark       float64 `db:"high_water_mark"`        // Best price since entry (lowest for short positions)
+	TrailingStopPrice   float64 `db:"trailing_stop_price"`    // Armed trailing stop, 0 until armed; only moves in our favour
+	TakeProfitLevelsHit int     `db:"take_profit_levels_hit"` // Take profit ladder levels already executed
+	ClosedFraction      float64 `db:"closed_fraction"`        // Share of the original quantity already closed
+
+	// Furthest the price moved in favour of and against the position since
+	// entry, as fractions of the entry price; both are non-negative
+	MaxFavorableExcursion float64 `db:"max_favorable_excursion"`
+	MaxAdverseExcursion   float64 `db:"max_adverse_excursion"`
+
+	CreatedAt time.Time  `db:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at"`
+	ClosedAt  *time.Time `db:"closed_at"`
 }
 
 type Order struct {
 	ID             string     `db:"id"`
+	AccountID      string     `db:"account_id"`
 	PositionID     *string    `db:"position_id"`
 	PairID         int64      `db:"pair_id"`
 	KuCoinOrderID  string     `db:"kucoin_order_id"`
+	ClientOid      string     `db:"client_oid"`
 	Side           string     `db:"side"`
 	Type           string     `db:"type"`
 	Quantity       float64    `db:"quantity"`
@@ -33,9 +53,117 @@ type Order struct {
 	FilledQuantity float64    `db:"filled_quantity"`
 	Status         string     `db:"status"`
 	Fee            float64    `db:"fee"`
+	StrategyTag    string     `db:"strategy_tag"`
+	ConfigVersion  string     `db:"config_version"`
 	CreatedAt      time.Time  `db:"created_at"`
 	UpdatedAt      time.Time  `db:"updated_at"`
 	FilledAt       *time.Time `db:"filled_at"`
+
+	// Grid level orders
+	GridUnsettled  bool    `db:"grid_unsettled"`   // Filled grid order not yet applied to a position
+	GridPositionID *string `db:"grid_position_id"` // Position a grid exit sells
+}
+
+type BracketOrder struct {
+	ID              string     `db:"id"`
+	PositionID      string     `db:"position_id"`
+	PairID          int64      `db:"pair_id"`
+	Symbol          string     `db:"symbol"`
+	EntryOrderID    string     `db:"entry_order_id"`
+	OCOOrderID      string     `db:"oco_order_id"`
+	Side            string     `db:"side"` // Side of the exit legs
+	Quantity        float64    `db:"quantity"`
+	StopPrice       float64    `db:"stop_price"`
+	StopLimitPrice  float64    `db:"stop_limit_price"`
+	TakeProfitPrice float64    `db:"take_profit_price"`
+	Status          string     `db:"status"` // 'pending', 'active', 'stop_loss', 'take_profit', 'cancelled'
+	CreatedAt       time.Time  `db:"created_at"`
+	UpdatedAt       time.Time  `db:"updated_at"`
+	ClosedAt        *time.Time `db:"closed_at"`
+}
+
+type FailedOrder struct {
+	ID           string    `db:"id"`
+	Symbol       string    `db:"symbol"`
+	ClientOid    string    `db:"client_oid"`
+	Side         string    `db:"side"`
+	Type         string    `db:"type"`
+	Quantity     float64   `db:"quantity"`
+	Price        float64   `db:"price"`
+	ErrorCode    string    `db:"error_code"`
+	ErrorMessage string    `db:"error_message"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+// BacktestBaseline is the performance a strategy configuration achieved in
+// its backtest
+type BacktestBaseline struct {
+	StrategyTag    string    `db:"strategy_tag"`
+	ConfigVersion  string    `db:"config_version"`
+	WinRate        float64   `db:"win_rate"`          // Fraction of trades closed in profit
+	AvgPnLPerTrade float64   `db:"avg_pnl_per_trade"` // Mean realized PnL per trade in USDT
+	Trades         int       `db:"trades"`            // Trades the backtest measured
+	CreatedAt      time.Time `db:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at"`
+}
+
+// Risk halt scopes
+const (
+	HaltScopePortfolio = "portfolio"
+	HaltScopePair      = "pair"
+)
+
+// RiskHalt is a circuit breaker halt of new entries, on the whole portfolio
+// or on one pair
+type RiskHalt struct {
+	Scope       string    `db:"scope"`
+	PairID      int64     `db:"pair_id"` // 0 for portfolio halts
+	Reason      string    `db:"reason"`
+	HaltedUntil time.Time `db:"halted_until"`
+}
+
+// TradeDecision is the snapshot of inputs an entry was decided on. Context
+// holds the JSON encoded snapshot.
+type TradeDecision struct {
+	ID            string    `db:"id"`
+	PositionID    string    `db:"position_id"`
+	KuCoinOrderID string    `db:"kucoin_order_id"`
+	Symbol        string    `db:"symbol"`
+	Context       []byte    `db:"context"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+// WouldTrade is an order the engine decided on in observe mode but did not
+// place
+type WouldTrade struct {
+	ID          string    `db:"id"`
+	PairID      int64     `db:"pair_id"`
+	Symbol      string    `db:"symbol"`
+	PositionID  *string   `db:"position_id"` // Position the order would have closed, nil for entries
+	Action      string    `db:"action"`      // "entry", "exit", "partial_exit" or "grid"
+	Side        string    `db:"side"`
+	OrderType   string    `db:"order_type"`
+	Quantity    float64   `db:"quantity"`
+	Price       float64   `db:"price"`
+	Reason      string    `db:"reason"`
+	StrategyTag string    `db:"strategy_tag"`
+	Context     []byte    `db:"context"` // Decision context of entries as JSON, nil otherwise
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+type GridRecenterEvent struct {
+	ID              string    `db:"id"`
+	PairID          int64     `db:"pair_id"`
+	ConfigID        string    `db:"config_id"`
+	Price           float64   `db:"price"`
+	OldRangeMin     float64   `db:"old_range_min"`
+	OldRangeMax     float64   `db:"old_range_max"`
+	NewRangeMin     float64   `db:"new_range_min"`
+	NewRangeMax     float64   `db:"new_range_max"`
+	CancelledOrders int       `db:"cancelled_orders"`
+	BuyLevels       int       `db:"buy_levels"`
+	FundedBuyLevels int       `db:"funded_buy_levels"` // Buy levels the available capital and position limits allowed
+	CreatedAt       time.Time `db:"created_at"`
 }
 
 type TradingConfig struct {
@@ -52,8 +180,63 @@ type TradingConfig struct {
 	IsActive          bool      `db:"is_active"`
 	CreatedAt         time.Time `db:"created_at"`
 	UpdatedAt         time.Time `db:"updated_at"`
+
+	// Unit the position size is expressed in; PositionSizeUSDT applies in
+	// quote mode and the fields below in the other modes
+	SizingMode          string  `db:"sizing_mode"`           // SizingQuoteFunds, SizingBaseQuantity or SizingBalancePercent
+	PositionSizeBase    float64 `db:"position_size_base"`    // Base quantity per position
+	PositionSizePercent float64 `db:"position_size_percent"` // Share of the available quote balance per position
+
+	ConfirmExits bool `db:"confirm_exits"` // Hold signal exits until the confirmation timeframe also signals a sell
+
+	TrailingStopPercent float64 `db:"trailing_stop_percent"` // Trail distance from the high-water mark; 0 uses the engine default
+}
+
+// Bounds a trading config is validated against
+const (
+	MaxStopLossPercent   = 0.5 // Stops further away than half the entry are a mistake, not a strategy
+	MaxTakeProfitPercent = 5.0
+	MaxGridLevels        = 100
+)
+
+// Validate rejects a config that cannot be traded safely. minRiskReward is
+// the least take profit to stop loss ratio accepted, 0 accepting any.
+func (c TradingConfig) Validate(minRiskReward float64) error {
+	switch {
+	case c.StopLossPercent <= 0 || c.StopLossPercent > MaxStopLossPercent:
+		return fmt.Errorf("stop loss percent %v must be above 0 and at most %v", c.StopLossPercent, MaxStopLossPercent)
+	case c.TakeProfitPercent <= 0 || c.TakeProfitPercent > MaxTakeProfitPercent:
+		return fmt.Errorf("take profit percent %v must be above 0 and at most %v", c.TakeProfitPercent, MaxTakeProfitPercent)
+	case minRiskReward > 0 && c.TakeProfitPercent/c.StopLossPercent < minRiskReward:
+		return fmt.Errorf("risk-reward %.2f is below the minimum %v", c.TakeProfitPercent/c.StopLossPercent, minRiskReward)
+	case c.TrailingStopPercent < 0 || c.TrailingStopPercent > MaxStopLossPercent:
+		return fmt.Errorf("trailing stop percent %v must be between 0 and %v", c.TrailingStopPercent, MaxStopLossPercent)
+	case c.MaxPositions < 1:
+		return errors.New("max positions must be at least 1")
+	case c.PositionSizeUSDT <= 0:
+		return errors.New("position size must be positive")
+	case c.PriceRangeMin < 0 || c.PriceRangeMax < 0:
+		return errors.New("price range must not be negative")
+	case (c.PriceRangeMin == 0) != (c.PriceRangeMax == 0):
+		return errors.New("price range min and max must both be set, or both 0 to center the range on the price")
+	case c.PriceRangeMin > 0 && c.PriceRangeMin >= c.PriceRangeMax:
+		return fmt.Errorf("price range min %v must be below max %v", c.PriceRangeMin, c.PriceRangeMax)
+	}
+
+	if c.StrategyType == "grid" && (c.GridLevels < 2 || c.GridLevels > MaxGridLevels) {
+		return fmt.Errorf("grid levels %d must be between 2 and %d", c.GridLevels, MaxGridLevels)
+	}
+
+	return nil
 }
 
+// Units a trading config's position size is expressed in
+const (
+	SizingQuoteFunds     = "quote"           // Fixed quote amount per position
+	SizingBaseQuantity   = "base"            // Fixed base quantity per position
+	SizingBalancePercent = "balance_percent" // Fraction of the available quote balance
+)
+
 type Signal struct {
 	Symbol    string
 	Action    string // 'BUY', 'SELL', 'HOLD'
@@ -61,6 +244,16 @@ type Signal struct {
 	Strength  float64 // 0.0 to 1.0
 	Timestamp time.Time
 	Reason    string
+	Metadata  map[string]interface{}
+}
+
+type Candle struct {
+	Timestamp time.Time `db:"timestamp"`
+	Open      float64   `db:"open"`
+	High      float64   `db:"high"`
+	Low       float64   `db:"low"`
+	Close     float64   `db:"close"`
+	Volume    float64   `db:"volume"`
 }
 
 type GridLevel struct {
@@ -82,6 +275,7 @@ type SelectedPair struct {
 	CorrelationScore float64   `db:"correlation_score"`
 	RiskLevel        string    `db:"risk_level"`
 	Status           string    `db:"status"`
+	TradingEnabled   bool      `db:"trading_enabled"`
 	SelectedAt       time.Time `db:"selected_at"`
 	LastEvaluated    time.Time `db:"last_evaluated"`
 }
@@ -0,0 +1,2 @@
+-- Selected pairs are upserted by symbol, which requires a unique constraint
+CREATE UNIQUE INDEX IF NOT EXISTS idx_selected_pairs_symbol_unique ON selected_pairs(symbol);
@@ -0,0 +1,2 @@
+-- Allow operators to pause trading on a selected pair without removing it
+ALTER TABLE selected_pairs ADD COLUMN IF NOT EXISTS trading_enabled BOOLEAN NOT NULL DEFAULT true;
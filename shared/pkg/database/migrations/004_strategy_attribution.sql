@@ -0,0 +1,7 @@
+-- Record which strategy and config version opened each position and order
+ALTER TABLE positions ADD COLUMN IF NOT EXISTS strategy_tag VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE positions ADD COLUMN IF NOT EXISTS config_version VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS strategy_tag VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS config_version VARCHAR(50) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_positions_strategy ON positions(strategy_tag, config_version);
@@ -0,0 +1,16 @@
+-- Durable record of order placements the exchange rejected or that failed in transit
+CREATE TABLE IF NOT EXISTS failed_orders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    symbol VARCHAR(20) NOT NULL,
+    client_oid VARCHAR(64) NOT NULL,
+    side VARCHAR(10) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    quantity DECIMAL(20,8) NOT NULL,
+    price DECIMAL(20,8),
+    error_code VARCHAR(20) NOT NULL,
+    error_message TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_failed_orders_created_at ON failed_orders(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_failed_orders_symbol ON failed_orders(symbol, created_at DESC);
@@ -0,0 +1,22 @@
+-- Exchange-side OCO stop loss / take profit brackets protecting open positions
+CREATE TABLE IF NOT EXISTS bracket_orders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    position_id UUID NOT NULL,
+    pair_id BIGINT NOT NULL,
+    symbol VARCHAR(20) NOT NULL,
+    entry_order_id VARCHAR(50) NOT NULL,
+    oco_order_id VARCHAR(50),
+    side VARCHAR(10) NOT NULL, -- side of the exit legs
+    quantity DECIMAL(20,8) NOT NULL,
+    stop_price DECIMAL(20,8) NOT NULL,
+    stop_limit_price DECIMAL(20,8) NOT NULL,
+    take_profit_price DECIMAL(20,8) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- 'pending', 'active', 'stop_loss', 'take_profit', 'cancelled'
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    closed_at TIMESTAMP,
+    CONSTRAINT fk_bracket_orders_position FOREIGN KEY (position_id) REFERENCES positions(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_bracket_orders_status ON bracket_orders(status);
+CREATE INDEX IF NOT EXISTS idx_bracket_orders_position ON bracket_orders(position_id);
@@ -0,0 +1,4 @@
+-- Persist trailing stop and take profit ladder progress so exits resume after a restart
+ALTER TABLE positions ADD COLUMN IF NOT EXISTS high_water_mark DECIMAL(20,8);
+ALTER TABLE positions ADD COLUMN IF NOT EXISTS take_profit_levels_hit INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE positions ADD COLUMN IF NOT EXISTS closed_fraction DECIMAL(10,6) NOT NULL DEFAULT 0;
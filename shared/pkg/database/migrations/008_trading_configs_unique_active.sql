@@ -0,0 +1,14 @@
+-- At most one active trading config per pair, so concurrent creation cannot
+-- leave a duplicate behind. Existing duplicates keep only the oldest active.
+UPDATE trading_configs tc
+SET is_active = false, updated_at = NOW()
+WHERE is_active = true
+  AND EXISTS (
+      SELECT 1 FROM trading_configs older
+      WHERE older.pair_id = tc.pair_id
+        AND older.is_active = true
+        AND (older.created_at, older.id) < (tc.created_at, tc.id)
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trading_configs_active_pair
+    ON trading_configs(pair_id) WHERE is_active = true;
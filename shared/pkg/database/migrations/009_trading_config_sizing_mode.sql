@@ -0,0 +1,4 @@
+-- Make the unit of a trading config's position size explicit
+ALTER TABLE trading_configs ADD COLUMN IF NOT EXISTS sizing_mode VARCHAR(20) NOT NULL DEFAULT 'quote';
+ALTER TABLE trading_configs ADD COLUMN IF NOT EXISTS position_size_base DECIMAL(20,8) NOT NULL DEFAULT 0;
+ALTER TABLE trading_configs ADD COLUMN IF NOT EXISTS position_size_percent DECIMAL(10,6) NOT NULL DEFAULT 0;
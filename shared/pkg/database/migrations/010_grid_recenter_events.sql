@@ -0,0 +1,18 @@
+-- History of grids rebuilt around a new price after a breakout
+CREATE TABLE IF NOT EXISTS grid_recenter_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    pair_id BIGINT NOT NULL,
+    config_id UUID NOT NULL,
+    price DECIMAL(20,8) NOT NULL,
+    old_range_min DECIMAL(20,8) NOT NULL,
+    old_range_max DECIMAL(20,8) NOT NULL,
+    new_range_min DECIMAL(20,8) NOT NULL,
+    new_range_max DECIMAL(20,8) NOT NULL,
+    cancelled_orders INTEGER NOT NULL DEFAULT 0,
+    buy_levels INTEGER NOT NULL DEFAULT 0,
+    funded_buy_levels INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT fk_grid_recenter_events_pair FOREIGN KEY (pair_id) REFERENCES selected_pairs(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_grid_recenter_events_pair ON grid_recenter_events(pair_id, created_at DESC);
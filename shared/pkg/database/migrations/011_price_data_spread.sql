@@ -0,0 +1,4 @@
+-- Best bid and ask at collection time, for spread-based liquidity scoring.
+-- NULL for rows collected before spread collection or with an empty book.
+ALTER TABLE price_data ADD COLUMN IF NOT EXISTS best_bid DECIMAL(20,8);
+ALTER TABLE price_data ADD COLUMN IF NOT EXISTS best_ask DECIMAL(20,8);
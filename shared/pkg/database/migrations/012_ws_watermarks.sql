@@ -0,0 +1,7 @@
+-- Last processed sequence per websocket topic, so replayed messages are
+-- discarded after a reconnect or restart
+CREATE TABLE IF NOT EXISTS ws_watermarks (
+    topic VARCHAR(200) PRIMARY KEY,
+    sequence BIGINT NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW()
+);
@@ -0,0 +1,5 @@
+-- Client order ID each order was placed with, so an order whose exchange ID
+-- was never recorded can still be looked up
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS client_oid VARCHAR(50);
+
+CREATE INDEX IF NOT EXISTS idx_orders_stranded ON orders(created_at) WHERE status = 'pending' AND kucoin_order_id IS NULL;
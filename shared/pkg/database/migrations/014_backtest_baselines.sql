@@ -0,0 +1,12 @@
+-- Expected performance of a strategy configuration from its backtest, compared
+-- against live results to detect drift
+CREATE TABLE IF NOT EXISTS backtest_baselines (
+    strategy_tag VARCHAR(50) NOT NULL,
+    config_version VARCHAR(50) NOT NULL,
+    win_rate DECIMAL(10,6) NOT NULL,
+    avg_pnl_per_trade DECIMAL(20,8) NOT NULL,
+    trades INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (strategy_tag, config_version)
+);
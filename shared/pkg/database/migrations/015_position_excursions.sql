@@ -0,0 +1,4 @@
+-- Maximum favorable and adverse excursion over a position's life, as a
+-- fraction of the entry price, for tuning stop loss and take profit levels
+ALTER TABLE positions ADD COLUMN IF NOT EXISTS max_favorable_excursion DECIMAL(10,6) NOT NULL DEFAULT 0;
+ALTER TABLE positions ADD COLUMN IF NOT EXISTS max_adverse_excursion DECIMAL(10,6) NOT NULL DEFAULT 0;
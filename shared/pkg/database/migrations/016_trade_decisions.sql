@@ -0,0 +1,14 @@
+-- Inputs behind each entry (signal, indicators, open positions, risk state,
+-- size), captured when the order is placed for post-mortems of single trades
+CREATE TABLE IF NOT EXISTS trade_decisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    position_id UUID NOT NULL,
+    kucoin_order_id VARCHAR(50),
+    symbol VARCHAR(20) NOT NULL,
+    context JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT fk_trade_decisions_position FOREIGN KEY (position_id) REFERENCES positions(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_trade_decisions_position ON trade_decisions(position_id);
+CREATE INDEX IF NOT EXISTS idx_trade_decisions_order ON trade_decisions(kucoin_order_id);
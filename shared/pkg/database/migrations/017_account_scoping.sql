@@ -0,0 +1,8 @@
+-- Scope positions and orders to the trading account (exchange sub-account)
+-- that holds them, so several accounts can be traded side by side. Rows that
+-- predate multi-account support belong to the default account.
+ALTER TABLE positions ADD COLUMN IF NOT EXISTS account_id VARCHAR(50) NOT NULL DEFAULT 'default';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS account_id VARCHAR(50) NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_positions_account_status ON positions(account_id, status);
+CREATE INDEX IF NOT EXISTS idx_orders_account_status ON orders(account_id, status);
@@ -0,0 +1,13 @@
+-- Hourly candles downsampled from price_data, kept after the minute rows age
+-- out so long indicator windows can still be served. Each row covers the
+-- hour starting at timestamp.
+CREATE TABLE IF NOT EXISTS price_data_hourly (
+    symbol VARCHAR(20) NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    open DECIMAL(20,8) NOT NULL,
+    high DECIMAL(20,8) NOT NULL,
+    low DECIMAL(20,8) NOT NULL,
+    close DECIMAL(20,8) NOT NULL,
+    volume DECIMAL(20,8) NOT NULL,
+    PRIMARY KEY (symbol, timestamp)
+);
@@ -0,0 +1,12 @@
+-- Circuit breaker halts, kept so a restart during a halt does not resume
+-- trading early. Portfolio halts use pair_id 0.
+CREATE TABLE IF NOT EXISTS risk_halts (
+    account_id VARCHAR(50) NOT NULL DEFAULT 'default',
+    scope VARCHAR(20) NOT NULL,
+    pair_id BIGINT NOT NULL DEFAULT 0,
+    reason VARCHAR(50) NOT NULL,
+    halted_until TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (account_id, scope, pair_id)
+);
@@ -0,0 +1,20 @@
+-- Orders the engine would have placed while running in observe mode, where
+-- the full decision pipeline runs but nothing is sent to the exchange
+CREATE TABLE IF NOT EXISTS would_trade (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    account_id VARCHAR(50) NOT NULL DEFAULT 'default',
+    pair_id BIGINT NOT NULL,
+    symbol VARCHAR(20) NOT NULL,
+    position_id UUID,
+    action VARCHAR(20) NOT NULL,
+    side VARCHAR(10) NOT NULL,
+    order_type VARCHAR(20) NOT NULL,
+    quantity DECIMAL(20,8) NOT NULL,
+    price DECIMAL(20,8) NOT NULL,
+    reason VARCHAR(100),
+    strategy_tag VARCHAR(50),
+    context JSONB,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_would_trade_symbol_created ON would_trade(symbol, created_at DESC);
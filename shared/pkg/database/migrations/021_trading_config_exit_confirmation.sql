@@ -0,0 +1,3 @@
+-- Per-pair switch holding signal exits until the higher confirmation
+-- timeframe also signals a sell; stop losses are never held
+ALTER TABLE trading_configs ADD COLUMN IF NOT EXISTS confirm_exits BOOLEAN NOT NULL DEFAULT false;
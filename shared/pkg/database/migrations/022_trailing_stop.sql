@@ -0,0 +1,4 @@
+-- Per-pair trailing stop distance, 0 using the engine default, and the
+-- ratcheted stop price of each position so a restart resumes the trail
+ALTER TABLE trading_configs ADD COLUMN IF NOT EXISTS trailing_stop_percent DECIMAL(10,6) NOT NULL DEFAULT 0;
+ALTER TABLE positions ADD COLUMN IF NOT EXISTS trailing_stop_price DECIMAL(20,8);
@@ -0,0 +1,6 @@
+-- Grid level orders: whether a fill still has to be turned into a position
+-- change, and the position a grid exit sells. Exits are linked through their
+-- own column rather than position_id so fill reconciliation leaves the
+-- position to the grid.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS grid_unsettled BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS grid_position_id UUID;
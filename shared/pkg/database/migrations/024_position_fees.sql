@@ -0,0 +1,2 @@
+-- Entry and exit fees deducted from a position's realized PnL so far
+ALTER TABLE positions ADD COLUMN IF NOT EXISTS total_fees DECIMAL(20,8) NOT NULL DEFAULT 0;
@@ -1,21 +1,36 @@
 package kucoin
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-resty/resty/v2"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
 	"github.com/sirupsen/logrus"
 )
 
 const (
 	BaseURL    = "https://api.kucoin.com"
 	SandboxURL = "https://openapi-sandbox.kucoin.com"
+
+	DefaultErrorBodyLimit = 512
+
+	// Retries of a failed or rate-limited request, with the first backoff
+	// doubled on every attempt up to the longest wait
+	retryCount   = 3
+	retryWait    = 1 * time.Second
+	retryMaxWait = 30 * time.Second
 )
 
 type Client struct {
@@ -24,6 +39,9 @@ type Client struct {
 	apiSecret  string
 	passphrase string
 	sandbox    bool
+	throttle   *AdaptiveThrottle
+	limiter    *RateLimiter
+	bodyLimit  int // Bytes of an unparseable error body kept in HTTPError
 	logger     *logrus.Logger
 }
 
@@ -32,6 +50,21 @@ type Config struct {
 	APISecret  string
 	Passphrase string
 	Sandbox    bool
+
+	// Fraction of the reported rate-limit quota below which requests are
+	// slowed down; 0 disables adaptive throttling
+	ThrottleThreshold float64
+
+	// Bytes of a non-JSON error response body kept in HTTPError; 0 uses
+	// DefaultErrorBodyLimit
+	ErrorBodyLimit int
+
+	// Requests per second sent to public and authenticated endpoints; 0 uses
+	// the defaults. RateLimiter, when set, is used instead, letting clients
+	// share one limiter or tests supply a fast one.
+	PublicRequestsPerSecond  int
+	PrivateRequestsPerSecond int
+	RateLimiter              *RateLimiter
 }
 
 func NewClient(config Config, logger *logrus.Logger) *Client {
@@ -44,17 +77,135 @@ func NewClient(config Config, logger *logrus.Logger) *Client {
 
 	client.SetBaseURL(baseURL)
 	client.SetTimeout(30 * time.Second)
-	client.SetRetryCount(3)
-	client.SetRetryWaitTime(1 * time.Second)
+	client.SetRetryCount(retryCount)
+	client.SetRetryWaitTime(retryWait)
+	client.SetRetryMaxWaitTime(retryMaxWait)
+	client.AddRetryCondition(retryCondition)
+	client.SetRetryAfter(retryAfter)
 
-	return &Client{
+	c := &Client{
 		client:     client,
 		apiKey:     config.APIKey,
 		apiSecret:  config.APISecret,
 		passphrase: config.Passphrase,
 		sandbox:    config.Sandbox,
+		bodyLimit:  config.ErrorBodyLimit,
 		logger:     logger,
 	}
+	if c.bodyLimit <= 0 {
+		c.bodyLimit = DefaultErrorBodyLimit
+	}
+
+	c.limiter = config.RateLimiter
+	if c.limiter == nil {
+		public, private := config.PublicRequestsPerSecond, config.PrivateRequestsPerSecond
+		if public <= 0 {
+			public = DefaultPublicRequestsPerSecond
+		}
+		if private <= 0 {
+			private = DefaultPrivateRequestsPerSecond
+		}
+		c.limiter = NewRateLimiter(public, private)
+	}
+
+	// Every attempt, retries included, waits for its limiter; signed
+	// requests count against the private limit
+	client.OnBeforeRequest(func(_ *resty.Client, req *resty.Request) error {
+		if req.Header.Get("KC-API-KEY") != "" {
+			c.limiter.WaitForPrivate()
+		} else {
+			c.limiter.WaitForPublic()
+		}
+		return nil
+	})
+
+	if config.ThrottleThreshold > 0 {
+		c.throttle = NewAdaptiveThrottle(config.ThrottleThreshold, logger)
+		client.OnBeforeRequest(func(_ *resty.Client, req *resty.Request) error {
+			return c.throttle.Wait(req.Context())
+		})
+		client.OnAfterResponse(func(_ *resty.Client, resp *resty.Response) error {
+			c.throttle.Update(resp.Header())
+			return nil
+		})
+	}
+
+	// Signed requests are stamped after any wait above, and again on every
+	// retry, so KuCoin never receives a stale timestamp
+	client.OnBeforeRequest(func(_ *resty.Client, req *resty.Request) error {
+		if req.Header.Get("KC-API-KEY") != "" {
+			c.signRequest(req)
+		}
+		return nil
+	})
+
+	return c
+}
+
+// retryCondition retries transport errors, as resty does by default, and
+// requests KuCoin rejected for exceeding the rate limit
+func retryCondition(resp *resty.Response, err error) bool {
+	return err != nil || isRateLimited(resp)
+}
+
+// isRateLimited reports whether the response is a 429 status or carries
+// KuCoin's too-many-requests code
+func isRateLimited(resp *resty.Response) bool {
+	if resp == nil {
+		return false
+	}
+	if resp.StatusCode() == http.StatusTooManyRequests {
+		return true
+	}
+
+	var apiResp struct {
+		Code string `json:"code"`
+	}
+	return json.Unmarshal(resp.Body(), &apiResp) == nil && apiResp.Code == CodeTooManyRequests
+}
+
+// retryAfter backs off a rate-limited request exponentially with jitter, and
+// at least as long as KuCoin suggests. Other retries return zero and get
+// resty's default backoff.
+func retryAfter(_ *resty.Client, resp *resty.Response) (time.Duration, error) {
+	if !isRateLimited(resp) {
+		return 0, nil
+	}
+
+	wait := rateLimitBackoff(resp.Request.Attempt)
+	if suggested := suggestedWait(resp.Header()); suggested > wait {
+		wait = suggested
+	}
+	return wait, nil
+}
+
+// rateLimitBackoff is the jittered exponential backoff after the given
+// attempt: a random wait between half and all of retryWait*2^(attempt-1),
+// capped at retryMaxWait
+func rateLimitBackoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	backoff := retryMaxWait
+	if attempt <= 16 {
+		if doubled := retryWait << (attempt - 1); doubled < retryMaxWait {
+			backoff = doubled
+		}
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// suggestedWait reads the wait KuCoin suggests in a Retry-After header, in
+// seconds, or else the time until its rate-limit quota resets
+func suggestedWait(header http.Header) time.Duration {
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if resetMs, err := strconv.ParseInt(header.Get(HeaderRateLimitReset), 10, 64); err == nil && resetMs > 0 {
+		return time.Duration(resetMs) * time.Millisecond
+	}
+	return 0
 }
 
 func (c *Client) generateSignature(timestamp, method, endpoint, body string) string {
@@ -70,21 +221,30 @@ func (c *Client) generatePassphraseSignature() string {
 	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
 }
 
-func (c *Client) setAuthHeaders(req *resty.Request, method, endpoint, body string) {
-	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
-	signature := c.generateSignature(timestamp, method, endpoint, body)
-	passphraseSignature := c.generatePassphraseSignature()
-
+// setAuthHeaders marks the request as signed. Its timestamp and signature
+// are set by signRequest before every attempt.
+func (c *Client) setAuthHeaders(req *resty.Request) {
 	req.SetHeaders(map[string]string{
 		"KC-API-KEY":         c.apiKey,
-		"KC-API-SIGN":        signature,
-		"KC-API-TIMESTAMP":   timestamp,
-		"KC-API-PASSPHRASE":  passphraseSignature,
+		"KC-API-PASSPHRASE":  c.generatePassphraseSignature(),
 		"KC-API-KEY-VERSION": "2",
 		"Content-Type":       "application/json",
 	})
 }
 
+// signRequest stamps a signed request with the current time and the
+// signature over it, its method, endpoint and body
+func (c *Client) signRequest(req *resty.Request) {
+	var body string
+	if bodyBytes, ok := req.Body.([]byte); ok {
+		body = string(bodyBytes)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	req.Header.Set("KC-API-TIMESTAMP", timestamp)
+	req.Header.Set("KC-API-SIGN", c.generateSignature(timestamp, req.Method, req.URL, body))
+}
+
 func (c *Client) GetAllTickers() (*AllTickersResponse, error) {
 	endpoint := "/api/v1/market/allTickers"
 
@@ -96,13 +256,9 @@ func (c *Client) GetAllTickers() (*AllTickersResponse, error) {
 		return nil, fmt.Errorf("failed to fetch tickers: %w", err)
 	}
 
-	var apiResp APIResponse
-	if err := json.Unmarshal(resp.Body(), &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-	}
-
-	if apiResp.Code != "200000" {
-		return nil, fmt.Errorf("API error: %s", apiResp.Msg)
+	apiResp, err := c.decodeResponse(resp)
+	if err != nil {
+		return nil, err
 	}
 
 	// Convert data to AllTickersResponse
@@ -132,13 +288,9 @@ func (c *Client) GetSymbols() ([]Symbol, error) {
 		return nil, fmt.Errorf("failed to fetch symbols: %w", err)
 	}
 
-	var apiResp APIResponse
-	if err := json.Unmarshal(resp.Body(), &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-	}
-
-	if apiResp.Code != "200000" {
-		return nil, fmt.Errorf("API error: %s", apiResp.Msg)
+	apiResp, err := c.decodeResponse(resp)
+	if err != nil {
+		return nil, err
 	}
 
 	dataBytes, err := json.Marshal(apiResp.Data)
@@ -165,7 +317,7 @@ func (c *Client) PlaceOrder(order OrderRequest) (*OrderResponse, error) {
 	}
 
 	req := c.client.R().SetBody(bodyBytes)
-	c.setAuthHeaders(req, "POST", endpoint, string(bodyBytes))
+	c.setAuthHeaders(req)
 
 	resp, err := req.Post(endpoint)
 	if err != nil {
@@ -173,13 +325,9 @@ func (c *Client) PlaceOrder(order OrderRequest) (*OrderResponse, error) {
 		return nil, fmt.Errorf("failed to place order: %w", err)
 	}
 
-	var apiResp APIResponse
-	if err := json.Unmarshal(resp.Body(), &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-	}
-
-	if apiResp.Code != "200000" {
-		return nil, fmt.Errorf("API error: %s", apiResp.Msg)
+	apiResp, err := c.decodeResponse(resp)
+	if err != nil {
+		return nil, err
 	}
 
 	dataBytes, err := json.Marshal(apiResp.Data)
@@ -200,3 +348,342 @@ func (c *Client) PlaceOrder(order OrderRequest) (*OrderResponse, error) {
 
 	return &orderResp, nil
 }
+
+// GetLevel1Ticker fetches the current best bid and ask for a symbol
+func (c *Client) GetLevel1Ticker(symbol string) (*Level1Ticker, error) {
+	endpoint := "/api/v1/market/orderbook/level1"
+
+	resp, err := c.client.R().SetQueryParam("symbol", symbol).Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch ticker: %w", err)
+	}
+
+	apiResp, err := c.decodeResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	dataBytes, err := json.Marshal(apiResp.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	var ticker Level1Ticker
+	if err := json.Unmarshal(dataBytes, &ticker); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ticker: %w", err)
+	}
+
+	return &ticker, nil
+}
+
+// GetKlines fetches the symbol's candles of the given interval ("1min",
+// "1hour", "1day", ...) between startAt and endAt, Unix seconds of which 0
+// leaves the bound open. KuCoin returns the newest candle first and at most
+// 1500 per request; the candles are returned oldest first, like stored price
+// history.
+func (c *Client) GetKlines(ctx context.Context, symbol, interval string, startAt, endAt int64) ([]Candle, error) {
+	endpoint := "/api/v1/market/candles"
+
+	req := c.client.R().SetContext(ctx).
+		SetQueryParam("symbol", symbol).
+		SetQueryParam("type", interval)
+	if startAt > 0 {
+		req.SetQueryParam("startAt", strconv.FormatInt(startAt, 10))
+	}
+	if endAt > 0 {
+		req.SetQueryParam("endAt", strconv.FormatInt(endAt, 10))
+	}
+
+	resp, err := req.Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch klines: %w", err)
+	}
+
+	apiResp, err := c.decodeResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	dataBytes, err := json.Marshal(apiResp.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	var rows [][]string
+	if err := json.Unmarshal(dataBytes, &rows); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal klines: %w", err)
+	}
+
+	return parseKlines(rows)
+}
+
+// parseKlines converts KuCoin's newest-first string rows of [time, open,
+// close, high, low, volume, turnover] into candles, oldest first
+func parseKlines(rows [][]string) ([]Candle, error) {
+	candles := make([]Candle, len(rows))
+	for i, row := range rows {
+		if len(row) < 7 {
+			return nil, fmt.Errorf("kline has %d fields, expected 7", len(row))
+		}
+
+		var values [7]float64
+		for j := range values {
+			value, err := strconv.ParseFloat(row[j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid kline field %d %q: %w", j, row[j], err)
+			}
+			values[j] = value
+		}
+
+		candles[len(rows)-1-i] = Candle{
+			Time:     time.Unix(int64(values[0]), 0).UTC(),
+			Open:     values[1],
+			Close:    values[2],
+			High:     values[3],
+			Low:      values[4],
+			Volume:   values[5],
+			Turnover: values[6],
+		}
+	}
+
+	return candles, nil
+}
+
+// GetOrderBookSnapshot fetches the full order book together with the
+// sequence number level2 updates continue from. Level2 sync has to start from
+// the full book: a partial one misses the deeper levels that updates later
+// move to the top. The full snapshot is a signed endpoint.
+func (c *Client) GetOrderBookSnapshot(symbol string) (*OrderBookSnapshot, error) {
+	endpoint := "/api/v3/market/orderbook/level2?" + url.Values{"symbol": {symbol}}.Encode()
+
+	var snapshot OrderBookSnapshot
+	if err := c.doAuthenticated("GET", endpoint, nil, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to fetch order book: %w", err)
+	}
+
+	return &snapshot, nil
+}
+
+// GetOrder returns the current state of an order by its KuCoin order ID
+func (c *Client) GetOrder(orderID string) (*Order, error) {
+	endpoint := "/api/v1/orders/" + orderID
+
+	var order Order
+	if err := c.doAuthenticated("GET", endpoint, nil, &order); err != nil {
+		return nil, fmt.Errorf("failed to get order %s: %w", orderID, err)
+	}
+
+	return &order, nil
+}
+
+// GetOrderByClientOid returns the current state of an order by the client
+// order ID it was placed with
+func (c *Client) GetOrderByClientOid(clientOid string) (*Order, error) {
+	endpoint := "/api/v1/order/client-order/" + clientOid
+
+	var order Order
+	if err := c.doAuthenticated("GET", endpoint, nil, &order); err != nil {
+		return nil, fmt.Errorf("failed to get order by client oid %s: %w", clientOid, err)
+	}
+
+	return &order, nil
+}
+
+// CancelOrder cancels an open order by its KuCoin order ID. An order that
+// no longer exists, or has already filled or been cancelled, is not an
+// error: the response reports it as AlreadyGone.
+func (c *Client) CancelOrder(ctx context.Context, orderID string) (*CancelOrderResponse, error) {
+	endpoint := "/api/v1/orders/" + orderID
+
+	var response CancelOrderResponse
+	if err := c.doAuthenticatedContext(ctx, "DELETE", endpoint, nil, &response); err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Code == CodeOrderNotExist {
+			return &CancelOrderResponse{AlreadyGone: true}, nil
+		}
+		return nil, fmt.Errorf("failed to cancel order %s: %w", orderID, err)
+	}
+
+	return &response, nil
+}
+
+// GetAccounts returns the accounts holding the given currency of the given
+// type ("trade", "main", ...); empty arguments list all accounts
+func (c *Client) GetAccounts(currency, accountType string) ([]Account, error) {
+	query := url.Values{}
+	if currency != "" {
+		query.Set("currency", currency)
+	}
+	if accountType != "" {
+		query.Set("type", accountType)
+	}
+
+	endpoint := "/api/v1/accounts"
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var accounts []Account
+	if err := c.doAuthenticated("GET", endpoint, nil, &accounts); err != nil {
+		return nil, fmt.Errorf("failed to get accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// GetTradeFees returns the account's maker and taker fee rates for up to ten
+// symbols
+func (c *Client) GetTradeFees(symbols []string) ([]TradeFee, error) {
+	endpoint := "/api/v1/trade-fees?symbols=" + url.QueryEscape(strings.Join(symbols, ","))
+
+	var fees []TradeFee
+	if err := c.doAuthenticated("GET", endpoint, nil, &fees); err != nil {
+		return nil, fmt.Errorf("failed to get trade fees: %w", err)
+	}
+
+	return fees, nil
+}
+
+// PlaceOCOOrder places a linked limit and stop-limit pair; when one leg
+// executes the exchange cancels the other
+func (c *Client) PlaceOCOOrder(order OCOOrderRequest) (*OrderResponse, error) {
+	endpoint := "/api/v3/oco/order"
+
+	var orderResp OrderResponse
+	if err := c.doAuthenticated("POST", endpoint, order, &orderResp); err != nil {
+		c.logger.WithError(err).WithField("symbol", order.Symbol).Error("Failed to place OCO order")
+		return nil, fmt.Errorf("failed to place OCO order: %w", err)
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"order_id":   orderResp.OrderId,
+		"symbol":     order.Symbol,
+		"side":       order.Side,
+		"price":      order.Price,
+		"stop_price": order.StopPrice,
+	}).Info("OCO order placed successfully")
+
+	return &orderResp, nil
+}
+
+// GetOCOOrderDetails returns an OCO order together with the state of its legs
+func (c *Client) GetOCOOrderDetails(orderID string) (*OCOOrderDetails, error) {
+	endpoint := "/api/v3/oco/order/details/" + orderID
+
+	var details OCOOrderDetails
+	if err := c.doAuthenticated("GET", endpoint, nil, &details); err != nil {
+		return nil, fmt.Errorf("failed to get OCO order %s: %w", orderID, err)
+	}
+
+	return &details, nil
+}
+
+// CancelOCOOrder cancels both legs of an OCO order
+func (c *Client) CancelOCOOrder(orderID string) error {
+	endpoint := "/api/v3/oco/order/" + orderID
+
+	if err := c.doAuthenticated("DELETE", endpoint, nil, nil); err != nil {
+		return fmt.Errorf("failed to cancel OCO order %s: %w", orderID, err)
+	}
+
+	return nil
+}
+
+// GetFills returns every trade executed for an order, following pagination
+func (c *Client) GetFills(ctx context.Context, orderID string) ([]Fill, error) {
+	var fills []Fill
+
+	for page := 1; ; page++ {
+		query := url.Values{}
+		query.Set("orderId", orderID)
+		query.Set("currentPage", strconv.Itoa(page))
+		query.Set("pageSize", "500")
+		endpoint := "/api/v1/fills?" + query.Encode()
+
+		var fillsPage FillsPage
+		if err := c.doAuthenticatedContext(ctx, "GET", endpoint, nil, &fillsPage); err != nil {
+			return nil, fmt.Errorf("failed to get fills for order %s: %w", orderID, err)
+		}
+
+		fills = append(fills, fillsPage.Items...)
+		if page >= fillsPage.TotalPage {
+			break
+		}
+	}
+
+	return fills, nil
+}
+
+// doAuthenticated performs a signed request and decodes the response data
+// into result, which may be nil when the data is not needed
+func (c *Client) doAuthenticated(method, endpoint string, body interface{}, result interface{}) error {
+	return c.doAuthenticatedContext(context.Background(), method, endpoint, body, result)
+}
+
+func (c *Client) doAuthenticatedContext(ctx context.Context, method, endpoint string, body interface{}, result interface{}) error {
+	req := c.client.R().SetContext(ctx)
+
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		req.SetBody(bodyBytes)
+	}
+	c.setAuthHeaders(req)
+
+	resp, err := req.Execute(method, endpoint)
+	if err != nil {
+		return err
+	}
+
+	apiResp, err := c.decodeResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	dataBytes, err := json.Marshal(apiResp.Data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	if err := json.Unmarshal(dataBytes, result); err != nil {
+		return fmt.Errorf("failed to unmarshal data: %w", err)
+	}
+
+	return nil
+}
+
+// decodeResponse checks the HTTP status before decoding the response
+// envelope. An error status whose body is still a KuCoin envelope, as most
+// 4xx responses are, yields the APIError it carries; anything else, such as a
+// gateway's HTML error page, yields an HTTPError with the status and the
+// start of the body.
+func (c *Client) decodeResponse(resp *resty.Response) (*APIResponse, error) {
+	var apiResp APIResponse
+	decodeErr := json.Unmarshal(resp.Body(), &apiResp)
+
+	if resp.IsError() {
+		if decodeErr == nil && apiResp.Code != "" {
+			metrics.ExchangeAPIErrors.WithLabelValues(apiResp.Code).Inc()
+			return nil, &APIError{Code: apiResp.Code, Msg: apiResp.Msg}
+		}
+		metrics.ExchangeAPIErrors.WithLabelValues("http_" + strconv.Itoa(resp.StatusCode())).Inc()
+		return nil, newHTTPError(resp.StatusCode(), resp.Body(), c.bodyLimit)
+	}
+
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to unmarshal response (HTTP %d): %w", resp.StatusCode(), decodeErr)
+	}
+
+	if apiResp.Code != "200000" {
+		metrics.ExchangeAPIErrors.WithLabelValues(apiResp.Code).Inc()
+		return nil, &APIError{Code: apiResp.Code, Msg: apiResp.Msg}
+	}
+
+	return &apiResp, nil
+}
@@ -0,0 +1,339 @@
+package kucoin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testClient returns a client sending every request to server
+func testClient(server *httptest.Server, bodyLimit int) *Client {
+	c := NewClient(Config{APIKey: "key", APISecret: "secret", Passphrase: "pass", ErrorBodyLimit: bodyLimit}, utils.NewDiscardLogger())
+	c.client.SetBaseURL(server.URL)
+	return c
+}
+
+func TestNonSuccessStatusGivesHTTPError(t *testing.T) {
+	page := "<html><body><h1>502 Bad Gateway</h1><p>cloudflare</p></body></html>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	c := testClient(server, 16)
+	gatewayErrors := metrics.ExchangeAPIErrors.WithLabelValues("http_502")
+	before := testutil.ToFloat64(gatewayErrors)
+
+	calls := []struct {
+		name string
+		call func() error
+	}{
+		{name: "public", call: func() error { _, err := c.GetAllTickers(); return err }},
+		{name: "authenticated", call: func() error { _, err := c.GetOrder("order-1"); return err }},
+	}
+
+	for _, tt := range calls {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+
+			var httpErr *HTTPError
+			if !errors.As(err, &httpErr) {
+				t.Fatalf("error = %v, want an *HTTPError", err)
+			}
+			if httpErr.StatusCode != http.StatusBadGateway {
+				t.Errorf("status = %d, want 502", httpErr.StatusCode)
+			}
+			if want := page[:16] + "..."; httpErr.Body != want {
+				t.Errorf("body = %q, want %q", httpErr.Body, want)
+			}
+			if !strings.Contains(err.Error(), "HTTP 502 Bad Gateway") {
+				t.Errorf("error %q does not name the HTTP status", err)
+			}
+		})
+	}
+
+	if got := testutil.ToFloat64(gatewayErrors) - before; got != 2 {
+		t.Errorf("http_502 metric rose by %v, want 2", got)
+	}
+}
+
+func TestErrorStatusWithKuCoinBodyGivesAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":"400100","msg":"Order size below the minimum requirement."}`))
+	}))
+	defer server.Close()
+
+	_, err := testClient(server, 0).GetOrder("order-1")
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want an *APIError", err)
+	}
+	if apiErr.Code != "400100" {
+		t.Errorf("code = %s, want 400100", apiErr.Code)
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		t.Error("KuCoin error body reported as an HTTP error")
+	}
+}
+
+func TestUndecodableSuccessNamesStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("maintenance"))
+	}))
+	defer server.Close()
+
+	_, err := testClient(server, 0).GetAllTickers()
+	if err == nil {
+		t.Fatal("GetAllTickers() error = nil, want a decode failure")
+	}
+	if !strings.Contains(err.Error(), "HTTP 200") {
+		t.Errorf("error %q does not name the HTTP status", err)
+	}
+}
+
+func TestCancelOrder(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		body            string
+		wantCancelled   []string
+		wantAlreadyGone bool
+		wantErr         bool
+	}{
+		{
+			name:          "cancelled",
+			status:        http.StatusOK,
+			body:          `{"code":"200000","data":{"cancelledOrderIds":["order-1"]}}`,
+			wantCancelled: []string{"order-1"},
+		},
+		{
+			name:            "order already gone",
+			status:          http.StatusBadRequest,
+			body:            `{"code":"400100","msg":"order_not_exist_or_not_allow_to_cancel"}`,
+			wantAlreadyGone: true,
+		},
+		{
+			name:    "other KuCoin error",
+			status:  http.StatusBadRequest,
+			body:    `{"code":"400001","msg":"Please check the header of your request"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var method, path string
+			var signed bool
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method, path = r.Method, r.URL.Path
+				signed = r.Header.Get("KC-API-KEY") == "key" && r.Header.Get("KC-API-SIGN") != ""
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			response, err := testClient(server, 0).CancelOrder(context.Background(), "order-1")
+
+			if method != http.MethodDelete || path != "/api/v1/orders/order-1" || !signed {
+				t.Errorf("request = %s %s signed %v, want a signed DELETE of /api/v1/orders/order-1", method, path, signed)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CancelOrder() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if response.AlreadyGone != tt.wantAlreadyGone || strings.Join(response.CancelledOrderIDs, ",") != strings.Join(tt.wantCancelled, ",") {
+				t.Errorf("CancelOrder() = %+v, want cancelled %v, already gone %v", response, tt.wantCancelled, tt.wantAlreadyGone)
+			}
+		})
+	}
+}
+
+func TestGetKlines(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		// Newest first, as KuCoin returns them
+		w.Write([]byte(`{"code":"200000","data":[
+			["1709251320","101.5","102","102.5","101","3.5","355.25"],
+			["1709251260","100","101.5","101.75","99.5","2","201"]
+		]}`))
+	}))
+	defer server.Close()
+
+	candles, err := testClient(server, 0).GetKlines(context.Background(), "BTC-USDT", "1min", 1709251200, 0)
+	if err != nil {
+		t.Fatalf("GetKlines() error = %v", err)
+	}
+
+	if query.Get("symbol") != "BTC-USDT" || query.Get("type") != "1min" || query.Get("startAt") != "1709251200" || query.Has("endAt") {
+		t.Errorf("query = %v, want symbol, type and startAt without an open endAt", query)
+	}
+	want := []Candle{
+		{Time: time.Unix(1709251260, 0).UTC(), Open: 100, Close: 101.5, High: 101.75, Low: 99.5, Volume: 2, Turnover: 201},
+		{Time: time.Unix(1709251320, 0).UTC(), Open: 101.5, Close: 102, High: 102.5, Low: 101, Volume: 3.5, Turnover: 355.25},
+	}
+	if len(candles) != len(want) {
+		t.Fatalf("got %d candles, want %d", len(candles), len(want))
+	}
+	for i := range want {
+		if candles[i] != want[i] {
+			t.Errorf("candle %d = %+v, want %+v", i, candles[i], want[i])
+		}
+	}
+}
+
+func TestParseKlinesRejectsMalformedRows(t *testing.T) {
+	tests := []struct {
+		name string
+		row  []string
+	}{
+		{name: "missing fields", row: []string{"1709251260", "100", "101.5"}},
+		{name: "non-numeric field", row: []string{"1709251260", "100", "n/a", "101.75", "99.5", "2", "201"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseKlines([][]string{tt.row}); err == nil {
+				t.Errorf("parseKlines(%v) error = nil, want one", tt.row)
+			}
+		})
+	}
+}
+
+func TestRateLimitedRequestIsRetried(t *testing.T) {
+	tests := []struct {
+		name    string
+		limited func(w http.ResponseWriter)
+	}{
+		{
+			name: "429 status",
+			limited: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+		},
+		{
+			name: "KuCoin too-many-requests code",
+			limited: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"code":"429000","msg":"Too Many Requests"}`))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				if attempts == 1 {
+					tt.limited(w)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"code":"200000","data":{"id":"order-1"}}`))
+			}))
+			defer server.Close()
+
+			order, err := testClient(server, 0).GetOrder("order-1")
+			if err != nil {
+				t.Fatalf("GetOrder() error = %v, want success after a retry", err)
+			}
+			if order.ID != "order-1" || attempts != 2 {
+				t.Errorf("got order %q after %d attempts, want order-1 after 2", order.ID, attempts)
+			}
+		})
+	}
+}
+
+func TestRetriedRequestIsSignedAgain(t *testing.T) {
+	var timestamps, signatures, paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timestamps = append(timestamps, r.Header.Get("KC-API-TIMESTAMP"))
+		signatures = append(signatures, r.Header.Get("KC-API-SIGN"))
+		paths = append(paths, r.URL.RequestURI())
+		if len(timestamps) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"200000","data":{"id":"order-1"}}`))
+	}))
+	defer server.Close()
+
+	c := testClient(server, 0)
+	if _, err := c.GetOrder("order-1"); err != nil {
+		t.Fatalf("GetOrder() error = %v, want success after a retry", err)
+	}
+
+	if len(timestamps) != 2 {
+		t.Fatalf("got %d attempts, want 2", len(timestamps))
+	}
+	if timestamps[0] == timestamps[1] {
+		t.Errorf("both attempts sent timestamp %s, want the retry stamped again", timestamps[0])
+	}
+	for i := range timestamps {
+		if want := c.generateSignature(timestamps[i], "GET", paths[i], ""); signatures[i] != want {
+			t.Errorf("attempt %d signature = %q, want %q over its own timestamp", i+1, signatures[i], want)
+		}
+	}
+}
+
+func TestRateLimitBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{attempt: 1, min: retryWait / 2, max: retryWait},
+		{attempt: 3, min: 2 * retryWait, max: 4 * retryWait},
+		{attempt: 10, min: retryMaxWait / 2, max: retryMaxWait},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := rateLimitBackoff(tt.attempt); got < tt.min || got > tt.max {
+				t.Errorf("rateLimitBackoff(%d) = %v, want between %v and %v", tt.attempt, got, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestSuggestedWait(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{name: "retry-after seconds", header: http.Header{"Retry-After": {"3"}}, want: 3 * time.Second},
+		{name: "quota reset", header: http.Header{http.CanonicalHeaderKey(HeaderRateLimitReset): {"1500"}}, want: 1500 * time.Millisecond},
+		{name: "retry-after preferred", header: http.Header{"Retry-After": {"2"}, http.CanonicalHeaderKey(HeaderRateLimitReset): {"9000"}}, want: 2 * time.Second},
+		{name: "no suggestion", header: http.Header{}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := suggestedWait(tt.header); got != tt.want {
+				t.Errorf("suggestedWait() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
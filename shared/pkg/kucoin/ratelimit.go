@@ -1,18 +1,53 @@
 package kucoin
 
 import (
+	"context"
+	"net/http"
+	"strconv"
 	"sync"
 	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Default request rates of the client's limiter, below KuCoin's own limits
+const (
+	DefaultPublicRequestsPerSecond  = 25
+	DefaultPrivateRequestsPerSecond = 10
 )
 
+// RateLimiter paces requests with separate token buckets for public market
+// data and authenticated endpoints, which KuCoin limits separately
 type RateLimiter struct {
+	public  *tokenBucket
+	private *tokenBucket
+}
+
+func NewRateLimiter(publicPerSecond, privatePerSecond int) *RateLimiter {
+	return &RateLimiter{
+		public:  newTokenBucket(publicPerSecond),
+		private: newTokenBucket(privatePerSecond),
+	}
+}
+
+// WaitForPublic blocks until a public request may be sent
+func (rl *RateLimiter) WaitForPublic() {
+	rl.public.Wait()
+}
+
+// WaitForPrivate blocks until an authenticated request may be sent
+func (rl *RateLimiter) WaitForPrivate() {
+	rl.private.Wait()
+}
+
+type tokenBucket struct {
 	requests  chan struct{}
 	mu        sync.Mutex
 	lastReset time.Time
 }
 
-func NewRateLimiter(requestsPerSecond int) *RateLimiter {
-	rl := &RateLimiter{
+func newTokenBucket(requestsPerSecond int) *tokenBucket {
+	rl := &tokenBucket{
 		requests:  make(chan struct{}, requestsPerSecond),
 		lastReset: time.Now(),
 	}
@@ -28,7 +63,7 @@ func NewRateLimiter(requestsPerSecond int) *RateLimiter {
 	return rl
 }
 
-func (rl *RateLimiter) refillBucket(requestsPerSecond int) {
+func (rl *tokenBucket) refillBucket(requestsPerSecond int) {
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
 
@@ -47,6 +82,122 @@ func (rl *RateLimiter) refillBucket(requestsPerSecond int) {
 	}
 }
 
-func (rl *RateLimiter) Wait() {
+func (rl *tokenBucket) Wait() {
 	<-rl.requests
 }
+
+const (
+	HeaderRateLimitLimit     = "gw-ratelimit-limit"
+	HeaderRateLimitRemaining = "gw-ratelimit-remaining"
+	HeaderRateLimitReset     = "gw-ratelimit-reset" // Milliseconds until the quota resets
+)
+
+// AdaptiveThrottle paces requests from the quota KuCoin reports in its
+// rate-limit response headers. Requests are spread over the remaining window
+// once the remaining quota drops below the slowdown threshold, and held until
+// the reset when the quota is exhausted.
+type AdaptiveThrottle struct {
+	mu                sync.Mutex
+	limit             int
+	remaining         int
+	resetAt           time.Time
+	known             bool
+	throttling        bool
+	slowdownThreshold float64 // Fraction of the quota below which requests are spaced out
+	logger            *logrus.Logger
+}
+
+func NewAdaptiveThrottle(slowdownThreshold float64, logger *logrus.Logger) *AdaptiveThrottle {
+	return &AdaptiveThrottle{
+		slowdownThreshold: slowdownThreshold,
+		logger:            logger,
+	}
+}
+
+// Update records the quota reported by a response. Responses without the
+// headers leave the previous state untouched.
+func (t *AdaptiveThrottle) Update(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get(HeaderRateLimitRemaining))
+	if err != nil {
+		return
+	}
+	resetMs, err := strconv.ParseInt(header.Get(HeaderRateLimitReset), 10, 64)
+	if err != nil {
+		return
+	}
+	limit, err := strconv.Atoi(header.Get(HeaderRateLimitLimit))
+	if err != nil {
+		limit = 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.limit = limit
+	t.remaining = remaining
+	t.resetAt = time.Now().Add(time.Duration(resetMs) * time.Millisecond)
+	t.known = true
+}
+
+// Delay returns how long the next request should wait given the last
+// reported quota
+func (t *AdaptiveThrottle) Delay() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.delayLocked(time.Now())
+}
+
+func (t *AdaptiveThrottle) delayLocked(now time.Time) time.Duration {
+	if !t.known || !now.Before(t.resetAt) {
+		return 0
+	}
+
+	untilReset := t.resetAt.Sub(now)
+	if t.remaining <= 0 {
+		return untilReset
+	}
+
+	if t.limit <= 0 || float64(t.remaining)/float64(t.limit) >= t.slowdownThreshold {
+		return 0
+	}
+
+	// Spread the remaining requests evenly over what is left of the window
+	return untilReset / time.Duration(t.remaining+1)
+}
+
+// Wait blocks for the current delay, logging when throttling engages and
+// when it is released. It returns early with the context's error when ctx is
+// done first.
+func (t *AdaptiveThrottle) Wait(ctx context.Context) error {
+	t.mu.Lock()
+	delay := t.delayLocked(time.Now())
+	wasThrottling := t.throttling
+	t.throttling = delay > 0
+	remaining, limit := t.remaining, t.limit
+	t.mu.Unlock()
+
+	if delay > 0 && !wasThrottling {
+		t.logger.WithFields(logrus.Fields{
+			"remaining": remaining,
+			"limit":     limit,
+			"delay":     delay,
+		}).Warn("Rate limit quota low, adaptive throttling engaged")
+	} else if delay == 0 && wasThrottling {
+		t.logger.Info("Rate limit quota recovered, adaptive throttling released")
+	}
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
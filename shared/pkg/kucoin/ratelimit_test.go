@@ -0,0 +1,144 @@
+package kucoin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+)
+
+func rateLimitHeader(limit, remaining int, reset time.Duration) http.Header {
+	header := http.Header{}
+	header.Set(HeaderRateLimitLimit, strconv.Itoa(limit))
+	header.Set(HeaderRateLimitRemaining, strconv.Itoa(remaining))
+	header.Set(HeaderRateLimitReset, strconv.FormatInt(reset.Milliseconds(), 10))
+	return header
+}
+
+func TestAdaptiveThrottleDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    http.Header
+		wantZero  bool
+		wantAbove time.Duration
+	}{
+		{name: "no headers seen", header: http.Header{}, wantZero: true},
+		{name: "quota above threshold", header: rateLimitHeader(100, 80, 10*time.Second), wantZero: true},
+		{name: "quota low spreads requests", header: rateLimitHeader(100, 9, 10*time.Second), wantAbove: 500 * time.Millisecond},
+		{name: "quota exhausted waits for reset", header: rateLimitHeader(100, 0, 10*time.Second), wantAbove: 9 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := NewAdaptiveThrottle(0.2, utils.NewDiscardLogger())
+			throttle.Update(tt.header)
+
+			delay := throttle.Delay()
+			if tt.wantZero {
+				if delay != 0 {
+					t.Fatalf("Delay() = %v, want 0", delay)
+				}
+				return
+			}
+			if delay <= tt.wantAbove {
+				t.Fatalf("Delay() = %v, want above %v", delay, tt.wantAbove)
+			}
+		})
+	}
+}
+
+func TestAdaptiveThrottleWaitHonoursContext(t *testing.T) {
+	throttle := NewAdaptiveThrottle(0.2, utils.NewDiscardLogger())
+	throttle.Update(rateLimitHeader(100, 0, time.Minute))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := throttle.Wait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Wait() returned after %v, want it to stop at the context deadline", elapsed)
+	}
+}
+
+func TestAdaptiveThrottleWaitWithoutDelay(t *testing.T) {
+	throttle := NewAdaptiveThrottle(0.2, utils.NewDiscardLogger())
+	throttle.Update(rateLimitHeader(100, 90, time.Minute))
+
+	if err := throttle.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() error = %v, want nil", err)
+	}
+}
+
+func TestClientPacesRequestsToLimiter(t *testing.T) {
+	start := time.Now()
+	var mu sync.Mutex
+	arrivals := make(map[string][]time.Duration) // Request offsets by kind
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kind := "public"
+		if r.Header.Get("KC-API-KEY") != "" {
+			kind = "private"
+		}
+		mu.Lock()
+		arrivals[kind] = append(arrivals[kind], time.Since(start))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"200000","data":{}}`))
+	}))
+	defer server.Close()
+
+	// Two public and one private request per second
+	c := NewClient(Config{APIKey: "key", APISecret: "secret", Passphrase: "pass", RateLimiter: NewRateLimiter(2, 1)}, utils.NewDiscardLogger())
+	c.client.SetBaseURL(server.URL)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.GetAllTickers()
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.GetOrder("order-1")
+		}()
+	}
+	wg.Wait()
+
+	tests := []struct {
+		kind      string
+		want      int
+		immediate int // Requests sent before the first refill
+	}{
+		{kind: "public", want: 4, immediate: 2},
+		{kind: "private", want: 2, immediate: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			offsets := arrivals[tt.kind]
+			sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+			if len(offsets) != tt.want {
+				t.Fatalf("server received %d %s requests, want %d", len(offsets), tt.kind, tt.want)
+			}
+			for i, offset := range offsets {
+				if early := offset < 500*time.Millisecond; early != (i < tt.immediate) {
+					t.Errorf("%s request %d sent after %v, want %d sent before the first refill", tt.kind, i, offset, tt.immediate)
+				}
+			}
+		})
+	}
+}
@@ -1,11 +1,74 @@
 package kucoin
 
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
 type APIResponse struct {
 	Code string      `json:"code"`
 	Data interface{} `json:"data"`
 	Msg  string      `json:"msg"`
 }
 
+// CodeOrderNotExist is KuCoin's answer to a request on an order that does
+// not exist or, for a cancel, can no longer be cancelled
+const CodeOrderNotExist = "400100"
+
+// CodeTooManyRequests is KuCoin's answer to a request over the rate limit
+const CodeTooManyRequests = "429000"
+
+// APIError is a request KuCoin answered with a non-success code
+type APIError struct {
+	Code string
+	Msg  string
+}
+
+func (e *APIError) Error() string {
+	return "API error: " + e.Msg
+}
+
+// HTTPError is a request answered with an error status and a body that is
+// not a KuCoin response, typically a proxy or gateway error page
+type HTTPError struct {
+	StatusCode int
+	Body       string // Start of the response body
+}
+
+func newHTTPError(statusCode int, body []byte, limit int) *HTTPError {
+	if len(body) > limit {
+		body = append(body[:limit:limit], "..."...)
+	}
+	return &HTTPError{StatusCode: statusCode, Body: string(body)}
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("HTTP %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// CancelOrderResponse is the result of cancelling an order
+type CancelOrderResponse struct {
+	CancelledOrderIDs []string `json:"cancelledOrderIds"`
+
+	// Set when the order no longer existed or could not be cancelled any
+	// more, typically because it had already filled or been cancelled
+	AlreadyGone bool `json:"-"`
+}
+
+// Candle is one kline of a symbol. Volume is in the base currency and
+// turnover in the quote currency.
+type Candle struct {
+	Time     time.Time // Start of the candle's interval
+	Open     float64
+	Close    float64
+	High     float64
+	Low      float64
+	Volume   float64
+	Turnover float64
+}
+
 type Ticker struct {
 	Symbol       string `json:"symbol"`
 	SymbolName   string `json:"symbolName"`
@@ -26,6 +89,18 @@ type AllTickersResponse struct {
 	Ticker []Ticker `json:"ticker"`
 }
 
+// Level1Ticker is the best bid and ask of a single symbol
+type Level1Ticker struct {
+	Sequence    string `json:"sequence"`
+	Price       string `json:"price"`
+	Size        string `json:"size"`
+	BestBid     string `json:"bestBid"`
+	BestBidSize string `json:"bestBidSize"`
+	BestAsk     string `json:"bestAsk"`
+	BestAskSize string `json:"bestAskSize"`
+	Time        int64  `json:"time"`
+}
+
 type Symbol struct {
 	Symbol         string `json:"symbol"`
 	Name           string `json:"name"`
@@ -50,8 +125,143 @@ type OrderRequest struct {
 	Price       string `json:"price,omitempty"`
 	Funds       string `json:"funds,omitempty"`
 	TimeInForce string `json:"timeInForce,omitempty"`
+	CancelAfter int64  `json:"cancelAfter,omitempty"` // Seconds until a GTT order expires
 }
 
 type OrderResponse struct {
-	OrderId string `json:"orderId"`
+	OrderId   string `json:"orderId"`
+	ClientOid string `json:"clientOid,omitempty"` // Filled in from the request when the response omits it
+}
+
+type WSInstanceServer struct {
+	Endpoint     string `json:"endpoint"`
+	Encrypt      bool   `json:"encrypt"`
+	Protocol     string `json:"protocol"`
+	PingInterval int64  `json:"pingInterval"` // Milliseconds
+	PingTimeout  int64  `json:"pingTimeout"`  // Milliseconds
+}
+
+type WSToken struct {
+	Token           string             `json:"token"`
+	InstanceServers []WSInstanceServer `json:"instanceServers"`
+}
+
+type WSMessage struct {
+	ID       string          `json:"id"`
+	Type     string          `json:"type"`
+	Topic    string          `json:"topic,omitempty"`
+	Subject  string          `json:"subject,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Response bool            `json:"response,omitempty"`
+}
+
+type OrderBookSnapshot struct {
+	Sequence string     `json:"sequence"`
+	Time     int64      `json:"time"`
+	Bids     [][]string `json:"bids"` // [price, size]
+	Asks     [][]string `json:"asks"` // [price, size]
+}
+
+type Level2Changes struct {
+	Asks [][]string `json:"asks"` // [price, size, sequence]
+	Bids [][]string `json:"bids"` // [price, size, sequence]
+}
+
+type Level2Update struct {
+	SequenceStart int64         `json:"sequenceStart"`
+	SequenceEnd   int64         `json:"sequenceEnd"`
+	Symbol        string        `json:"symbol"`
+	Changes       Level2Changes `json:"changes"`
+	Time          int64         `json:"time"`
+}
+
+// Order is the state of a single order as reported by KuCoin
+type Order struct {
+	ID          string `json:"id"`
+	Symbol      string `json:"symbol"`
+	Type        string `json:"type"`
+	Side        string `json:"side"`
+	Price       string `json:"price"`
+	Size        string `json:"size"`
+	DealFunds   string `json:"dealFunds"`
+	DealSize    string `json:"dealSize"`
+	Fee         string `json:"fee"`
+	FeeCurrency string `json:"feeCurrency"`
+	ClientOid   string `json:"clientOid"`
+	IsActive    bool   `json:"isActive"`
+	CancelExist bool   `json:"cancelExist"`
+	TimeInForce string `json:"timeInForce"`
+	CancelAfter int64  `json:"cancelAfter"`
+	CreatedAt   int64  `json:"createdAt"`
+}
+
+type Account struct {
+	ID        string `json:"id"`
+	Currency  string `json:"currency"`
+	Type      string `json:"type"`
+	Balance   string `json:"balance"`
+	Available string `json:"available"`
+	Holds     string `json:"holds"`
+}
+
+// TradeFee is the account's fee tier for one symbol
+type TradeFee struct {
+	Symbol       string `json:"symbol"`
+	TakerFeeRate string `json:"takerFeeRate"`
+	MakerFeeRate string `json:"makerFeeRate"`
+}
+
+// Fill is a single trade executed against an order
+type Fill struct {
+	Symbol         string `json:"symbol"`
+	TradeID        string `json:"tradeId"`
+	OrderID        string `json:"orderId"`
+	CounterOrderID string `json:"counterOrderId"`
+	Side           string `json:"side"`
+	Liquidity      string `json:"liquidity"` // "taker" or "maker"
+	Price          string `json:"price"`
+	Size           string `json:"size"`
+	Funds          string `json:"funds"`
+	Fee            string `json:"fee"`
+	FeeRate        string `json:"feeRate"`
+	FeeCurrency    string `json:"feeCurrency"`
+	CreatedAt      int64  `json:"createdAt"`
+}
+
+type FillsPage struct {
+	CurrentPage int    `json:"currentPage"`
+	PageSize    int    `json:"pageSize"`
+	TotalNum    int    `json:"totalNum"`
+	TotalPage   int    `json:"totalPage"`
+	Items       []Fill `json:"items"`
+}
+
+type OCOOrderRequest struct {
+	ClientOid  string `json:"clientOid"`
+	Side       string `json:"side"`
+	Symbol     string `json:"symbol"`
+	Price      string `json:"price"`      // Limit (take profit) leg price
+	Size       string `json:"size"`       // Quantity of both legs
+	StopPrice  string `json:"stopPrice"`  // Trigger price of the stop leg
+	LimitPrice string `json:"limitPrice"` // Limit price the stop leg is placed at once triggered
+	TradeType  string `json:"tradeType,omitempty"`
+}
+
+type OCOLeg struct {
+	ID        string `json:"id"`
+	Symbol    string `json:"symbol"`
+	Side      string `json:"side"`
+	Price     string `json:"price"`
+	StopPrice string `json:"stopPrice"`
+	Size      string `json:"size"`
+	Status    string `json:"status"`
+}
+
+type OCOOrderDetails struct {
+	OrderID   string   `json:"orderId"`
+	Symbol    string   `json:"symbol"`
+	ClientOid string   `json:"clientOid"`
+	OrderTime int64    `json:"orderTime"`
+	Status    string   `json:"status"` // NEW, DONE, TRIGGERED, CANCELLED
+	Orders    []OCOLeg `json:"orders"`
 }
@@ -0,0 +1,165 @@
+package kucoin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// WSConn is a connection to KuCoin's public websocket feed. It answers the
+// server's keepalive requirement by pinging at the advertised interval.
+type WSConn struct {
+	conn         *websocket.Conn
+	writeMu      sync.Mutex
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+	done         chan struct{}
+	closeOnce    sync.Once
+	logger       *logrus.Logger
+}
+
+// GetPublicWSToken requests a token and server list for the public feed
+func (c *Client) GetPublicWSToken() (*WSToken, error) {
+	endpoint := "/api/v1/bullet-public"
+
+	resp, err := c.client.R().Post(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request websocket token: %w", err)
+	}
+
+	apiResp, err := c.decodeResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	dataBytes, err := json.Marshal(apiResp.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	var token WSToken
+	if err := json.Unmarshal(dataBytes, &token); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal websocket token: %w", err)
+	}
+
+	if len(token.InstanceServers) == 0 {
+		return nil, fmt.Errorf("no websocket servers returned")
+	}
+
+	return &token, nil
+}
+
+// DialPublicWS connects to the public feed and waits for the welcome message
+func (c *Client) DialPublicWS(ctx context.Context) (*WSConn, error) {
+	token, err := c.GetPublicWSToken()
+	if err != nil {
+		return nil, err
+	}
+
+	server := token.InstanceServers[0]
+	endpoint, err := url.Parse(server.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid websocket endpoint %q: %w", server.Endpoint, err)
+	}
+	query := endpoint.Query()
+	query.Set("token", token.Token)
+	query.Set("connectId", strconv.FormatInt(time.Now().UnixNano(), 10))
+	endpoint.RawQuery = query.Encode()
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, endpoint.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect websocket: %w", err)
+	}
+
+	ws := &WSConn{
+		conn:         conn,
+		pingInterval: time.Duration(server.PingInterval) * time.Millisecond,
+		pingTimeout:  time.Duration(server.PingTimeout) * time.Millisecond,
+		done:         make(chan struct{}),
+		logger:       c.logger,
+	}
+
+	welcome, err := ws.ReadMessage()
+	if err != nil {
+		ws.Close()
+		return nil, fmt.Errorf("failed to read welcome message: %w", err)
+	}
+	if welcome.Type != "welcome" {
+		ws.Close()
+		return nil, fmt.Errorf("unexpected first websocket message type %q", welcome.Type)
+	}
+
+	if ws.pingInterval > 0 {
+		go ws.keepAlive()
+	}
+
+	return ws, nil
+}
+
+// Subscribe subscribes to a topic such as "/market/level2:BTC-USDT,ETH-USDT"
+func (w *WSConn) Subscribe(topic string) error {
+	return w.writeJSON(WSMessage{
+		ID:       strconv.FormatInt(time.Now().UnixNano(), 10),
+		Type:     "subscribe",
+		Topic:    topic,
+		Response: true,
+	})
+}
+
+// ReadMessage blocks until the next message arrives. The read deadline is
+// extended on every message so a silent connection surfaces as an error.
+func (w *WSConn) ReadMessage() (WSMessage, error) {
+	if w.pingInterval > 0 {
+		w.conn.SetReadDeadline(time.Now().Add(w.pingInterval + w.pingTimeout))
+	}
+
+	var msg WSMessage
+	if err := w.conn.ReadJSON(&msg); err != nil {
+		return msg, err
+	}
+
+	if msg.Type == "error" {
+		return msg, fmt.Errorf("websocket error: %s", string(msg.Data))
+	}
+
+	return msg, nil
+}
+
+func (w *WSConn) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+	return w.conn.Close()
+}
+
+func (w *WSConn) writeJSON(msg WSMessage) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	return w.conn.WriteJSON(msg)
+}
+
+func (w *WSConn) keepAlive() {
+	ticker := time.NewTicker(w.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			ping := WSMessage{ID: strconv.FormatInt(time.Now().UnixNano(), 10), Type: "ping"}
+			if err := w.writeJSON(ping); err != nil {
+				w.logger.WithError(err).Warn("Failed to send websocket ping")
+				return
+			}
+		}
+	}
+}
@@ -1 +1,194 @@
 package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "crypto_bot"
+
+var (
+	// FailedOrders counts order placements rejected by the exchange or lost
+	// in transit, labelled by the exchange error code
+	FailedOrders = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "failed_orders_total",
+		Help:      "Order placements that failed, by symbol and reason.",
+	}, []string{"symbol", "reason"})
+
+	// StaleSignals counts signal evaluations skipped because the newest
+	// candle was older than the allowed data age
+	StaleSignals = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stale_signals_total",
+		Help:      "Signal evaluations held because price data was stale, by symbol.",
+	}, []string{"symbol"})
+
+	// PositionIntegrityErrors counts positions found in a state the engine
+	// cannot manage, such as an unrecognized side; any increase needs an
+	// operator
+	PositionIntegrityErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "position_integrity_errors_total",
+		Help:      "Open positions the engine cannot manage, by reason.",
+	}, []string{"reason"})
+
+	// EmptyTickerResponses counts collection cycles in which the exchange
+	// returned no usable tickers
+	EmptyTickerResponses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "empty_ticker_responses_total",
+		Help:      "Collection cycles that returned no usable tickers.",
+	})
+
+	// ConsecutiveEmptyTickerResponses is the current run of empty cycles;
+	// it resets to zero on the first cycle with data
+	ConsecutiveEmptyTickerResponses = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "consecutive_empty_ticker_responses",
+		Help:      "Consecutive collection cycles that returned no usable tickers.",
+	})
+
+	// StrategyDrift is how far live results deviate from the backtest
+	// baseline: the win rate difference and the relative average PnL
+	// difference, labelled by strategy configuration
+	StrategyDrift = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "strategy_drift",
+		Help:      "Deviation of live results from the backtest baseline, by strategy, config version and metric.",
+	}, []string{"strategy_tag", "config_version", "metric"})
+
+	// QuarantinedPairs is 1 for each pair whose trading config repeatedly
+	// failed to be created; the engine skips it until creation succeeds
+	QuarantinedPairs = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "quarantined_pairs",
+		Help:      "Pairs skipped after repeated trading config creation failures, by symbol.",
+	}, []string{"symbol"})
+
+	// FlatlinedFeeds is 1 for each symbol whose recent closes are all
+	// identical; the engine pauses trading on it until prices move again
+	FlatlinedFeeds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "flatlined_feeds",
+		Help:      "Symbols whose price feed repeats the same close, by symbol.",
+	}, []string{"symbol"})
+
+	// FeeAnomalies counts settled orders whose fees deviate from the
+	// account's fee rates, by symbol and reason ("rate" or "currency")
+	FeeAnomalies = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fee_anomalies_total",
+		Help:      "Settled orders whose fees deviate from the expected fee rate, by symbol and reason.",
+	}, []string{"symbol", "reason"})
+
+	// OrderCapThrottles counts limit orders not placed because the symbol
+	// already had the maximum number of open orders
+	OrderCapThrottles = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "order_cap_throttles_total",
+		Help:      "Orders held back by the per-symbol open order cap, by symbol.",
+	}, []string{"symbol"})
+
+	// TradeSinkFailures counts trade events that did not reach an export
+	// sink, by sink and reason ("dropped" when the buffer was full, "send")
+	TradeSinkFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "trade_sink_failures_total",
+		Help:      "Trade events not delivered to an export sink, by sink and reason.",
+	}, []string{"sink", "reason"})
+
+	// StaleQuoteRates counts quote to USDT conversions made with a rate that
+	// was stale or missing, by quote currency and reason
+	StaleQuoteRates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stale_quote_rates_total",
+		Help:      "Quote conversions using a stale or missing USDT rate, by quote and reason.",
+	}, []string{"quote", "reason"})
+
+	// PortfolioOpenPositions, PortfolioUnrealizedPnL and PortfolioExposure
+	// describe all open positions of a trading account together; its engine
+	// sets them from one snapshot at the end of each trading cycle
+	PortfolioOpenPositions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "portfolio_open_positions",
+		Help:      "Open positions across all pairs.",
+	}, []string{"account"})
+	PortfolioUnrealizedPnL = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "portfolio_unrealized_pnl_usdt",
+		Help:      "Unrealized PnL of all open positions in USDT.",
+	}, []string{"account"})
+	PortfolioExposure = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "portfolio_exposure_usdt",
+		Help:      "Gross market value of all open positions in USDT.",
+	}, []string{"account"})
+
+	// PortfolioBeta is the exposure-weighted beta of a trading account's open
+	// positions to the beta reference symbol, updated each trading cycle
+	// while the beta limit is enabled
+	PortfolioBeta = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "portfolio_beta",
+		Help:      "Exposure-weighted beta of all open positions to the reference symbol.",
+	}, []string{"account"})
+
+	// OrdersPlaced counts orders the exchange accepted, by symbol, side and
+	// order type; rejected placements are counted by FailedOrders
+	OrdersPlaced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_placed_total",
+		Help:      "Orders accepted by the exchange, by symbol, side and type.",
+	}, []string{"symbol", "side", "type"})
+
+	// OrdersFilled counts orders whose execution was confirmed, fully or in
+	// part, by symbol and side
+	OrdersFilled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_filled_total",
+		Help:      "Orders confirmed filled, by symbol and side.",
+	}, []string{"symbol", "side"})
+
+	// RealizedPnL is the PnL a trading account's closes have booked since the
+	// engine started, net of the fees booked with them. Later fill
+	// corrections are not included.
+	RealizedPnL = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "realized_pnl_usdt",
+		Help:      "Realized PnL booked by closes since the engine started, in USDT.",
+	}, []string{"account"})
+
+	// ExchangeAPIErrors counts exchange responses that carried an error, by
+	// KuCoin error code, or "http_<status>" when the body was not a KuCoin
+	// response
+	ExchangeAPIErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "exchange_api_errors_total",
+		Help:      "Exchange API responses that returned an error, by code.",
+	}, []string{"code"})
+
+	// PriceRowsInserted counts price rows the collector wrote
+	PriceRowsInserted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "price_rows_inserted_total",
+		Help:      "Price data rows written by the collector.",
+	})
+
+	// PairSelectionDuration observes how long each completed pair selection
+	// cycle took
+	PairSelectionDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "pair_selection_duration_seconds",
+		Help:      "Duration of completed pair selection cycles.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 10),
+	})
+)
+
+// Handler exposes the registered metrics for scraping
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,116 @@
+package quotes
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// Accounting is the currency volumes and exposures are aggregated in
+const Accounting = "USDT"
+
+// RateSource returns the latest price of a symbol and when it was observed
+type RateSource interface {
+	GetLatestQuote(ctx context.Context, symbol string) (float64, time.Time, error)
+}
+
+// Rate is the USDT value of one unit of a quote currency
+type Rate struct {
+	Quote      string
+	Value      float64
+	ObservedAt time.Time
+	Stale      bool // Observed longer ago than the maximum age
+	Missing    bool // No rate has ever been obtained
+}
+
+// Converter values amounts quoted in other currencies in USDT, using the
+// latest <QUOTE>-USDT price. Rates are cached for the TTL. When a refresh
+// fails the last rate is kept, and a rate observed longer ago than the
+// maximum age is flagged stale so callers can decide whether to trust it.
+// A nil Converter leaves every amount unconverted.
+type Converter struct {
+	source RateSource
+	ttl    time.Duration
+	maxAge time.Duration
+	logger *logrus.Logger
+
+	mu        sync.Mutex
+	rates     map[string]Rate
+	fetchedAt map[string]time.Time
+}
+
+func NewConverter(source RateSource, ttl, maxAge time.Duration, logger *logrus.Logger) *Converter {
+	return &Converter{
+		source:    source,
+		ttl:       ttl,
+		maxAge:    maxAge,
+		logger:    logger,
+		rates:     make(map[string]Rate),
+		fetchedAt: make(map[string]time.Time),
+	}
+}
+
+// Rate returns the current USDT rate of the quote currency
+func (c *Converter) Rate(ctx context.Context, quote string) Rate {
+	quote = strings.ToUpper(quote)
+	if c == nil || quote == "" || quote == Accounting {
+		return Rate{Quote: quote, Value: 1, ObservedAt: time.Now()}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rate, cached := c.rates[quote]
+	if !cached || time.Since(c.fetchedAt[quote]) >= c.ttl {
+		price, observedAt, err := c.source.GetLatestQuote(ctx, quote+"-"+Accounting)
+		switch {
+		case err == nil && price > 0:
+			rate = Rate{Quote: quote, Value: price, ObservedAt: observedAt}
+			c.rates[quote] = rate
+			c.fetchedAt[quote] = time.Now()
+			cached = true
+		case err != nil:
+			c.logger.WithError(err).WithField("quote", quote).Warn("Failed to refresh quote rate")
+		}
+	}
+
+	if !cached {
+		metrics.StaleQuoteRates.WithLabelValues(quote, "missing").Inc()
+		return Rate{Quote: quote, Missing: true, Stale: true}
+	}
+
+	rate.Stale = c.maxAge > 0 && time.Since(rate.ObservedAt) > c.maxAge
+	if rate.Stale {
+		metrics.StaleQuoteRates.WithLabelValues(quote, "stale").Inc()
+		c.logger.WithFields(logrus.Fields{
+			"quote":       quote,
+			"rate":        rate.Value,
+			"observed_at": rate.ObservedAt,
+		}).Warn("Quote rate is stale")
+	}
+	return rate
+}
+
+// ToUSDT converts an amount in the quote currency. ok is false when the rate
+// is stale, the amount then converted at the last rate, or when no rate is
+// available, the amount then returned unconverted for callers that choose to
+// fall back on it.
+func (c *Converter) ToUSDT(ctx context.Context, quote string, amount float64) (float64, Rate, bool) {
+	rate := c.Rate(ctx, quote)
+	if rate.Missing {
+		return amount, rate, false
+	}
+	return amount * rate.Value, rate, !rate.Stale
+}
+
+// QuoteCurrency returns the quote asset of a symbol such as BTC-USDT
+func QuoteCurrency(symbol string) string {
+	if i := strings.LastIndex(symbol, "-"); i >= 0 {
+		return symbol[i+1:]
+	}
+	return ""
+}
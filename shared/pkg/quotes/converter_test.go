@@ -0,0 +1,141 @@
+package quotes
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/metrics"
+	"github.com/paaavkata/crypto-trading-bot-v4/shared/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// quote is what the fake source answers for one symbol
+type quote struct {
+	price      float64
+	observedAt time.Time
+	err        error
+}
+
+// fakeSource serves fixed quotes and counts the lookups
+type fakeSource struct {
+	quotes  map[string]quote
+	lookups int
+}
+
+func (s *fakeSource) GetLatestQuote(_ context.Context, symbol string) (float64, time.Time, error) {
+	s.lookups++
+	q, ok := s.quotes[symbol]
+	if !ok {
+		return 0, time.Time{}, errors.New("no price for " + symbol)
+	}
+	return q.price, q.observedAt, q.err
+}
+
+func TestToUSDT(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		quote       string
+		source      map[string]quote
+		want        float64
+		wantOK      bool
+		wantStale   bool
+		wantMissing bool
+	}{
+		{
+			name:   "fresh rate converts",
+			quote:  "BTC",
+			source: map[string]quote{"BTC-USDT": {price: 60000, observedAt: now.Add(-time.Minute)}},
+			want:   120000,
+			wantOK: true,
+		},
+		{
+			name:   "USDT needs no rate",
+			quote:  "usdt",
+			want:   2,
+			wantOK: true,
+		},
+		{
+			name:      "stale rate converts but is flagged",
+			quote:     "ETH",
+			source:    map[string]quote{"ETH-USDT": {price: 3000, observedAt: now.Add(-2 * time.Hour)}},
+			want:      6000,
+			wantStale: true,
+		},
+		{
+			name:        "missing rate leaves the amount unconverted",
+			quote:       "KCS",
+			want:        2,
+			wantStale:   true,
+			wantMissing: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConverter(&fakeSource{quotes: tt.source}, time.Minute, time.Hour, utils.NewDiscardLogger())
+
+			got, rate, ok := c.ToUSDT(context.Background(), tt.quote, 2)
+			if math.Abs(got-tt.want) > 1e-9 || ok != tt.wantOK {
+				t.Errorf("ToUSDT() = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+			if rate.Stale != tt.wantStale || rate.Missing != tt.wantMissing {
+				t.Errorf("stale/missing = %v/%v, want %v/%v", rate.Stale, rate.Missing, tt.wantStale, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestStaleRateFlagged(t *testing.T) {
+	source := &fakeSource{quotes: map[string]quote{"XRP-USDT": {price: 0.5, observedAt: time.Now().Add(-2 * time.Hour)}}}
+	c := NewConverter(source, time.Minute, time.Hour, utils.NewDiscardLogger())
+	stale := metrics.StaleQuoteRates.WithLabelValues("XRP", "stale")
+	before := testutil.ToFloat64(stale)
+
+	c.Rate(context.Background(), "XRP")
+
+	if got := testutil.ToFloat64(stale) - before; got != 1 {
+		t.Errorf("stale rate metric rose by %v, want 1", got)
+	}
+}
+
+func TestRateCachedForTTL(t *testing.T) {
+	source := &fakeSource{quotes: map[string]quote{"BTC-USDT": {price: 60000, observedAt: time.Now()}}}
+	c := NewConverter(source, time.Hour, time.Hour, utils.NewDiscardLogger())
+
+	for i := 0; i < 3; i++ {
+		c.Rate(context.Background(), "BTC")
+	}
+	if source.lookups != 1 {
+		t.Errorf("looked up the rate %d times within the TTL, want 1", source.lookups)
+	}
+}
+
+func TestFailedRefreshKeepsLastRate(t *testing.T) {
+	source := &fakeSource{quotes: map[string]quote{"BTC-USDT": {price: 60000, observedAt: time.Now()}}}
+	c := NewConverter(source, 0, time.Hour, utils.NewDiscardLogger())
+
+	c.Rate(context.Background(), "BTC")
+	source.quotes["BTC-USDT"] = quote{err: errors.New("database unavailable")}
+
+	rate := c.Rate(context.Background(), "BTC")
+	if rate.Missing || rate.Value != 60000 || rate.Stale {
+		t.Errorf("rate = %+v, want the last fresh rate of 60000 kept", rate)
+	}
+	if source.lookups != 2 {
+		t.Errorf("looked up the rate %d times, want a refresh attempt", source.lookups)
+	}
+}
+
+func TestNilConverterIsOneToOne(t *testing.T) {
+	var c *Converter
+
+	got, rate, ok := c.ToUSDT(context.Background(), "BTC", 2)
+	if got != 2 || !ok || rate.Stale || rate.Missing {
+		t.Errorf("ToUSDT() = %v, %+v, %v; want the amount unchanged", got, rate, ok)
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"io"
 	"os"
 
 	"github.com/sirupsen/logrus"
@@ -39,3 +40,11 @@ func NewLogger(service string) *logrus.Logger {
 
 	return logger
 }
+
+// NewDiscardLogger returns a logger that drops all output, for tests that
+// need a logger but not its output
+func NewDiscardLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
@@ -76,6 +76,47 @@ func CalculateVolatility(prices []float64) float64 {
 	return math.Sqrt(variance)
 }
 
+// CalculateEWMAVolatility returns the exponentially weighted standard deviation
+// of returns, so recent moves count more than older ones. lambda is the decay
+// factor in (0, 1); higher values give a longer memory (0.94 is the RiskMetrics
+// convention).
+func CalculateEWMAVolatility(prices []float64, lambda float64) float64 {
+	if len(prices) < 2 || lambda <= 0 || lambda >= 1 {
+		return 0
+	}
+
+	var returns []float64
+	for i := 1; i < len(prices); i++ {
+		if prices[i-1] != 0 {
+			ret := (prices[i] - prices[i-1]) / prices[i-1]
+			returns = append(returns, ret)
+		}
+	}
+
+	if len(returns) == 0 {
+		return 0
+	}
+
+	// Seed with the first squared return and decay forward in time
+	variance := returns[0] * returns[0]
+	for _, ret := range returns[1:] {
+		variance = lambda*variance + (1-lambda)*ret*ret
+	}
+
+	return math.Sqrt(variance)
+}
+
+// CalculateTrueRangeVolatility returns the average true range over the given
+// period as a fraction of the last close. Unlike close-to-close returns it
+// includes the intrabar range and gaps from the previous close, so wicks that
+// reverse before the close still register.
+func CalculateTrueRangeVolatility(highs, lows, closes []float64, period int) float64 {
+	if len(closes) == 0 || closes[len(closes)-1] <= 0 {
+		return 0
+	}
+	return CalculateATR(highs, lows, closes, period) / closes[len(closes)-1]
+}
+
 func CalculateCorrelation(x, y []float64) float64 {
 	if len(x) != len(y) || len(x) == 0 {
 		return 0
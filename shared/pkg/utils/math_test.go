@@ -0,0 +1,114 @@
+package utils
+
+import "testing"
+
+// pricesWithSpike returns n calm prices alternating by a small return,
+// followed by one large move
+func pricesWithSpike(n int, calmReturn, spikeReturn float64) []float64 {
+	prices := []float64{100}
+	for i := 1; i < n; i++ {
+		step := calmReturn
+		if i%2 == 0 {
+			step = -calmReturn
+		}
+		prices = append(prices, prices[i-1]*(1+step))
+	}
+	return append(prices, prices[len(prices)-1]*(1+spikeReturn))
+}
+
+func TestEWMAVolatilityRespondsFasterToRecentSpike(t *testing.T) {
+	calm := pricesWithSpike(200, 0.001, 0.001)
+	spiked := pricesWithSpike(200, 0.001, 0.05)
+
+	simpleCalm, simpleSpiked := CalculateVolatility(calm), CalculateVolatility(spiked)
+	ewmaCalm, ewmaSpiked := CalculateEWMAVolatility(calm, 0.94), CalculateEWMAVolatility(spiked, 0.94)
+
+	simpleJump := simpleSpiked / simpleCalm
+	ewmaJump := ewmaSpiked / ewmaCalm
+
+	if ewmaJump <= simpleJump {
+		t.Fatalf("EWMA volatility rose %.2fx after the spike, want more than the simple %.2fx", ewmaJump, simpleJump)
+	}
+	if ewmaJump < 5 {
+		t.Errorf("EWMA volatility rose %.2fx after a 50x return, want at least 5x", ewmaJump)
+	}
+}
+
+func TestEWMAVolatilityWeighsOldSpikeLess(t *testing.T) {
+	recent := pricesWithSpike(100, 0.001, 0.05)
+
+	// The same spike followed by a long calm stretch
+	old := append([]float64(nil), recent...)
+	for i := 0; i < 100; i++ {
+		step := 0.001
+		if i%2 == 0 {
+			step = -0.001
+		}
+		old = append(old, old[len(old)-1]*(1+step))
+	}
+
+	if recentVol, oldVol := CalculateEWMAVolatility(recent, 0.94), CalculateEWMAVolatility(old, 0.94); oldVol >= recentVol/5 {
+		t.Errorf("EWMA volatility %v long after the spike, want it decayed well below %v", oldVol, recentVol)
+	}
+}
+
+func TestEWMAVolatilityInvalidInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		prices []float64
+		lambda float64
+	}{
+		{"too few prices", []float64{100}, 0.94},
+		{"zero lambda", []float64{100, 101, 102}, 0},
+		{"lambda of one", []float64{100, 101, 102}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CalculateEWMAVolatility(tt.prices, tt.lambda); got != 0 {
+				t.Errorf("CalculateEWMAVolatility() = %v, want 0", got)
+			}
+		})
+	}
+}
+
+// wickedBars returns n bars whose closes alternate by a small return while
+// every bar wicks the given fraction above and below its close
+func wickedBars(n int, calmReturn, wick float64) (highs, lows, closes []float64) {
+	closes = pricesWithSpike(n-1, calmReturn, calmReturn)
+	for _, price := range closes {
+		highs = append(highs, price*(1+wick))
+		lows = append(lows, price*(1-wick))
+	}
+	return highs, lows, closes
+}
+
+func TestTrueRangeVolatilityCapturesWicks(t *testing.T) {
+	highs, lows, closes := wickedBars(50, 0.001, 0.03)
+
+	closeBased := CalculateVolatility(closes)
+	trueRange := CalculateTrueRangeVolatility(highs, lows, closes, 14)
+
+	// Each bar spans 6% of its close though closes barely move
+	if trueRange < 0.05 || trueRange > 0.07 {
+		t.Errorf("true range volatility = %v, want about 0.06", trueRange)
+	}
+	if closeBased > 0.002 {
+		t.Errorf("close-based volatility = %v, want it blind to the wicks", closeBased)
+	}
+
+	// Without wicks both measures agree the series is calm
+	_, _, calm := wickedBars(50, 0.001, 0)
+	if got := CalculateTrueRangeVolatility(calm, calm, calm, 14); got > 0.002 {
+		t.Errorf("true range volatility without wicks = %v, want about the 0.1%% close moves", got)
+	}
+}
+
+func TestTrueRangeVolatilityInvalidInput(t *testing.T) {
+	if got := CalculateTrueRangeVolatility(nil, nil, nil, 14); got != 0 {
+		t.Errorf("empty series = %v, want 0", got)
+	}
+	if got := CalculateTrueRangeVolatility([]float64{1, 1}, []float64{0, 0}, []float64{1, 0}, 1); got != 0 {
+		t.Errorf("zero last close = %v, want 0", got)
+	}
+}